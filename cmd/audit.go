@@ -0,0 +1,299 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// Environment variables the audit log, and its key, are read from, if not given as flags,
+// so they can be set for all users of a machine.
+const (
+	auditLogEnv = "PAPERCRYPT_AUDIT_LOG"
+	auditKeyEnv = "PAPERCRYPT_AUDIT_KEY"
+)
+
+var (
+	auditLogPath string
+	auditKeyPath string
+	auditHead    string
+)
+
+// auditSerialNumber is the serial number of the document an audited command works on, once known.
+var auditSerialNumber string
+
+// auditedCommands are the commands recorded in the audit log: those creating, or accessing, recovery material.
+var auditedCommands = []*cobra.Command{generateCmd, decodeCmd, restoreCmd, verifyCmd, keyRestoreCmd, passRestoreCmd}
+
+var auditCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "audit",
+	Short:        "Verify, and read, the audit log. Subcommands: 'verify', 'show'",
+	Long: `With --audit-log, or the PAPERCRYPT_AUDIT_LOG environment variable, every invocation of
+'generate', 'decode', 'restore', 'verify', 'key restore', and 'pass restore', as well as every document generated, or decoded, by 'serve', is recorded in an audit log: when it ran, the serial number of the document,
+whether it succeeded, and the user and host running it. Nothing is run if the log can not be written.
+
+The records are encrypted to the OpenPGP public key given with --audit-key, or PAPERCRYPT_AUDIT_KEY,
+so only the holder of the private key can read them, and chained by their checksums,
+so records can not be removed, reordered, or changed unnoticed.
+The checksums are not keyed: anyone who can write the log can also rewrite it as a whole, with a new chain.
+Note the head printed by 'audit verify' outside the log, and check the log against it with 'audit verify --head'.`,
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeFiles("jsonl", "log"),
+	SilenceUsage:      true,
+	Use:               "verify [<log>]",
+	Short:             "Verify the chain of the audit log, without decrypting it",
+	Long: `This command verifies that no record of the audit log was removed, reordered, or changed,
+and prints the number of records, and the checksum of the last one, the head of the chain.
+Records removed from the end of the log, or a log rewritten as a whole, can only be noticed against a head noted earlier,
+outside the log, such as on paper, or in a ticket: with --head, the log must still hold the record of that head.`,
+	Example: `papercrypt audit verify /var/log/papercrypt-audit.jsonl
+papercrypt audit verify /var/log/papercrypt-audit.jsonl --head 3f2a...`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := readAuditLogFile(args)
+		if err != nil {
+			return err
+		}
+
+		entries, head, err := internal.VerifyAuditLog(data)
+		if err != nil {
+			return err
+		}
+		fields := [][2]string{
+			{"Records", fmt.Sprint(entries)},
+			{"Head", head},
+		}
+		if auditHead != "" {
+			anchored, err := internal.VerifyAuditLogHead(data, auditHead)
+			if err != nil {
+				return err
+			}
+			fields = append(fields, [2]string{"Unchanged", fmt.Sprintf("records 1 to %d", anchored)})
+		}
+
+		return writeFields(cmd.OutOrStdout(), fields)
+	},
+}
+
+var auditShowCmd = &cobra.Command{
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeFiles("jsonl", "log"),
+	SilenceUsage:      true,
+	Use:               "show [<log>]",
+	Short:             "Decrypt, and list, the records of the audit log",
+	Long: `This command verifies the chain of the audit log (see 'audit verify'),
+and lists its records, decrypted using the private key given with --audit-key.
+You will be asked for the passphrase of the key, if it is locked.`,
+	Example: `papercrypt audit show /var/log/papercrypt-audit.jsonl --audit-key auditor.asc`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := readAuditLogFile(args)
+		if err != nil {
+			return err
+		}
+
+		// the key in the environment is the public key, used to write the log
+		if auditKeyPath == "" {
+			return errors.New("give the private key of the audit log with --audit-key")
+		}
+		keyData, err := os.ReadFile(auditKeyPath)
+		if err != nil {
+			return errors.Join(errors.New("error reading the private key of the audit log"), err)
+		}
+		privateKey, err := internal.ReadAuditPrivateKey(keyData, func() ([]byte, error) {
+			passphraseBytes, ok, err := readPassphraseSource(cmd)
+			if err != nil || ok {
+				return passphraseBytes, err
+			}
+
+			cmd.Println("Enter the passphrase of the private key of the audit log")
+			return internal.SensitivePrompt()
+		})
+		if err != nil {
+			return err
+		}
+
+		records, err := internal.ReadAuditLog(data, privateKey)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditRecords(cmd.OutOrStdout(), records)
+	},
+}
+
+// readAuditLogFile reads the audit log given as argument, with --audit-log, or in the environment.
+func readAuditLogFile(args []string) ([]byte, error) {
+	path := auditLogFileName()
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no audit log given, pass it as argument, with --audit-log, or in %s", auditLogEnv)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the audit log"), err)
+	}
+
+	return data, nil
+}
+
+// auditLogFileName returns the path of the audit log given with --audit-log, or in the environment, if any.
+func auditLogFileName() string {
+	if auditLogPath != "" {
+		return auditLogPath
+	}
+
+	return os.Getenv(auditLogEnv)
+}
+
+// openAuditLog returns the audit log commands are recorded in, or nil, if there is none.
+func openAuditLog() (*internal.AuditLog, error) {
+	path := auditLogFileName()
+	if path == "" {
+		return nil, nil
+	}
+
+	keyPath := auditKeyPath
+	if keyPath == "" {
+		keyPath = os.Getenv(auditKeyEnv)
+	}
+	if keyPath == "" {
+		return nil, fmt.Errorf("the audit log needs a public key to encrypt its records, give it with --audit-key, or in %s", auditKeyEnv)
+	}
+	publicKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the public key of the audit log"), err)
+	}
+
+	return internal.NewAuditLog(path, publicKey)
+}
+
+// audited wraps the RunE of a command, recording its invocation in the audit log, if there is one.
+// The command is not run if the log can not be opened, and fails if its record can not be written.
+func audited(run func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		auditLog, err := openAuditLog()
+		if err != nil {
+			return err
+		}
+
+		auditSerialNumber = ""
+		err = run(cmd, args)
+		if auditLog == nil {
+			return err
+		}
+
+		command := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+		if auditErr := recordAudit(auditLog, command, auditSerialNumber, err); auditErr != nil {
+			return errors.Join(err, auditErr)
+		}
+		return err
+	}
+}
+
+// recordAudit appends the record of a command to the audit log, with the serial number of the document,
+// and the error it failed with, if any.
+func recordAudit(auditLog *internal.AuditLog, command string, serialNumber string, err error) error {
+	record := internal.AuditRecord{
+		Time:         time.Now(),
+		Command:      command,
+		SerialNumber: serialNumber,
+		Outcome:      internal.AuditOutcomeSuccess,
+		Version:      core.VersionInfo.GitVersion,
+	}
+	if err != nil {
+		record.Outcome = internal.AuditOutcomeFailure
+		record.Error = err.Error()
+	}
+	if current, userErr := user.Current(); userErr == nil {
+		record.User = current.Username
+	}
+	record.Host, _ = os.Hostname()
+
+	if auditErr := auditLog.Append(record); auditErr != nil {
+		return errors.Join(errors.New("error recording the command in the audit log"), auditErr)
+	}
+	log.WithField("log", auditLog.Path()).Debug("Recorded the command in the audit log")
+	return nil
+}
+
+// writeAuditRecords writes the records as a table, one per line.
+func writeAuditRecords(w io.Writer, records []internal.AuditRecord) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "#\tTIME\tCOMMAND\tSERIAL\tUSER\tOUTCOME")
+	for i, record := range records {
+		outcome := record.Outcome.String()
+		if record.Error != "" {
+			// only the first line, the cause is joined below it
+			message, _, _ := strings.Cut(record.Error, "\n")
+			outcome += ": " + message
+		}
+		who := record.User
+		if record.Host != "" {
+			who += "@" + record.Host
+		}
+		fields := []string{fmt.Sprint(i + 1), record.Time.Format(time.RFC3339), record.Command, record.SerialNumber, who, outcome}
+		fmt.Fprintln(table, strings.Join(fields, "\t"))
+	}
+
+	if err := table.Flush(); err != nil {
+		return errors.Join(errors.New("error writing to file"), err)
+	}
+	return nil
+}
+
+func init() {
+	for _, cmd := range auditedCommands {
+		cmd.RunE = audited(cmd.RunE)
+	}
+
+	auditCmd.AddCommand(auditVerifyCmd, auditShowCmd)
+	rootCmd.AddCommand(auditCmd)
+
+	rootCmd.PersistentFlags().StringVar(&auditLogPath, "audit-log", "", "Record generate, decode, restore, and verify in this audit log (default: $"+auditLogEnv+")")
+	rootCmd.PersistentFlags().StringVar(&auditKeyPath, "audit-key", "", "OpenPGP public key the records of the audit log are encrypted to, or, for 'audit show', the private key to read them (default: $"+auditKeyEnv+")")
+	_ = rootCmd.RegisterFlagCompletionFunc("audit-log", completeFiles("jsonl", "log"))
+	_ = rootCmd.RegisterFlagCompletionFunc("audit-key", completeFiles("asc", "gpg", "pgp", "key"))
+
+	auditVerifyCmd.Flags().StringVar(&auditHead, "head", "", "Head of the chain noted earlier, fail unless the log still holds its record")
+
+	auditShowCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Passphrase of the private key (not recommended, will be prompted for if not provided)")
+	auditShowCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "Read the passphrase of the private key from the first line of this file, instead of prompting for it")
+	auditShowCmd.Flags().IntVar(&passphraseFD, "passphrase-fd", -1, "Read the passphrase of the private key from the first line of this file descriptor, instead of prompting for it")
+}
@@ -0,0 +1,123 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/spf13/cobra"
+)
+
+func TestAuditLog(t *testing.T) {
+	resetFlags(rootCmd)
+	defer resetFlags(rootCmd)
+	for _, cmd := range []*cobra.Command{decodeCmd, auditShowCmd, auditVerifyCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+
+	key, err := crypto.GenerateKey("Auditor", "audit@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := key.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := key.Armor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "input.txt")
+	logPath := filepath.Join(tempDir, "audit.jsonl")
+	publicKeyPath := filepath.Join(tempDir, "auditor.pub.asc")
+	privateKeyPath := filepath.Join(tempDir, "auditor.asc")
+	for path, content := range map[string]string{inPath: doc, publicKeyPath: publicKey, privateKeyPath: privateKey} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without the public key, nothing is run
+	rootCmd.SetArgs([]string{"decode", "-i", inPath, "-o", filepath.Join(tempDir, "none.json"), "-P", "example", "--audit-log", logPath})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error without the key of the audit log")
+	}
+	resetFlags(rootCmd)
+
+	for i, passphrase := range []string{"wrong", "example"} {
+		resetFlags(decodeCmd)
+		rootCmd.SetArgs([]string{"decode", "-i", inPath, "-o", filepath.Join(tempDir, passphrase+".json"), "-P", passphrase, "--audit-log", logPath, "--audit-key", publicKeyPath})
+		if err := rootCmd.Execute(); (err == nil) != (i == 1) {
+			t.Fatalf("Unexpected result decoding with passphrase %q: %v", passphrase, err)
+		}
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"audit", "show", logPath, "--audit-key", privateKeyPath})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 records, got:\n%s", out.String())
+	}
+	for i, want := range []string{"failure: error decrypting data", "success"} {
+		if fields := strings.Fields(lines[i+1]); fields[2] != "decode" || fields[3] != "EIPESR" || !strings.Contains(lines[i+1], want) {
+			t.Fatalf("Expected record %d to be a decode of EIPESR, with %q, got:\n%s", i+1, want, out.String())
+		}
+	}
+
+	// the head printed by 'audit verify' is checked against the log later on
+	out.Reset()
+	rootCmd.SetArgs([]string{"audit", "verify", logPath})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	head := ""
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && strings.HasPrefix(fields[0], "Head") {
+			head = fields[1]
+		}
+	}
+	if len(head) != 64 {
+		t.Fatalf("Expected the head of the chain, got:\n%s", out.String())
+	}
+
+	rootCmd.SetArgs([]string{"audit", "verify", logPath, "--head", head})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"audit", "verify", logPath, "--head", strings.Repeat("0", 64)})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for a head the log does not hold")
+	}
+}
@@ -0,0 +1,305 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var benchmarkSize int
+
+// benchmarkCodeData is the length of the data the 2D codes are benchmarked with, split over several codes at most settings.
+const benchmarkCodeData = 4 * 1024
+
+var benchmarkCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "benchmark",
+	Short:        "Measure the speed of encryption and 2D codes, and how much data fits on a page, to plan large backups",
+	Long: `This command measures how fast this machine encrypts, and decrypts, data, and encodes, and reads, 2D codes,
+and how much data fits on a page of a document generated with the given settings (encoding, 2D code, paper size),
+so you can plan how to split a large backup over several documents.
+
+The data is random, so it does not compress: data that does, such as text, fits more of it on a page.
+Use the same flags as for 'generate', the sizes are those of the encrypted data.`,
+	Example: `papercrypt benchmark
+papercrypt benchmark --encoding base64 --code-type qr --qr-ec L --paper letter`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		opts, err := benchmarkTextOptions(cmd)
+		if err != nil {
+			return err
+		}
+		if opts.Code2D.Type == core.Code2DTypeColor {
+			return errors.New("only aztec, and qr codes can be benchmarked")
+		}
+		if benchmarkSize < 1 {
+			return fmt.Errorf("invalid size %d, must be positive", benchmarkSize)
+		}
+
+		var fields [][2]string
+
+		// 1. Encryption, and decryption
+		plaintext := make([]byte, benchmarkSize)
+		if _, err := rand.Read(plaintext); err != nil {
+			return errors.Join(errors.New("error generating random data"), err)
+		}
+		passphraseBytes := []byte("benchmark")
+
+		log.WithField("size", internal.SprintBinarySize(benchmarkSize)).Info("Measuring encryption")
+		start := time.Now()
+		data, err := core.CompressAndEncrypt(passphraseBytes, plaintext, false)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, [2]string{"Encryption", throughput(benchmarkSize, time.Since(start))})
+
+		pc := core.NewPaperCrypt(core.VersionInfo.GitVersion, data, "BENCHM", "", "", time.Now(), core.PaperCryptDataFormatPGP)
+		start = time.Now()
+		if _, err := pc.Decode(passphraseBytes); err != nil {
+			return err
+		}
+		fields = append(fields, [2]string{"Decryption", throughput(benchmarkSize, time.Since(start))})
+
+		// 2. 2D codes
+		log.WithField("type", opts.Code2D.Type).Info("Measuring 2D codes")
+		codes, perCode, err := benchmarkCodes(opts)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, codes...)
+
+		// 3. Data per page
+		log.Info("Measuring how much data fits on a page")
+		leastPages, err := textPages(opts, 1)
+		if err != nil {
+			return err
+		}
+		least, err := pageCapacity(opts, leastPages)
+		if err != nil {
+			return err
+		}
+		more, err := pageCapacity(opts, leastPages+1)
+		if err != nil {
+			return err
+		}
+		perPage := more - least
+
+		pages := leastPages
+		if len(data) > least {
+			pages += (len(data) - least + perPage - 1) / perPage
+		}
+		fields = append(fields,
+			[2]string{"Data on the Least Pages", fmt.Sprintf("%s on %d pages", internal.SprintBinarySize(least), leastPages)},
+			[2]string{"Data per Additional Page", internal.SprintBinarySize(perPage)},
+			[2]string{"Pages of Text", fmt.Sprintf("%d for %s of encrypted data", pages, internal.SprintBinarySize(len(data)))},
+			[2]string{"Pages of 2D Codes", fmt.Sprintf("about %d for %s of encrypted data", (len(data)+perCode-1)/perCode, internal.SprintBinarySize(len(data)))},
+		)
+
+		return writeFields(cmd.OutOrStdout(), fields)
+	},
+}
+
+// benchmarkTextOptions returns the options documents are generated with, from the flags shared with 'generate'.
+func benchmarkTextOptions(cmd *cobra.Command) (internal.TextOptions, error) {
+	encoding := core.PaperCryptDataEncodingFromString(dataEncoding)
+	if encoding == core.PaperCryptDataEncodingUnknown {
+		return internal.TextOptions{}, fmt.Errorf("unknown data encoding '%s', must be one of: base16, base32, base64, armor, words", dataEncoding)
+	}
+	paper := core.PaperSizeFromString(paperSize)
+	if paper == core.PaperSizeUnknown {
+		return internal.TextOptions{}, fmt.Errorf("unknown paper size '%s', must be one of: a4, letter, a5, legal", paperSize)
+	}
+	page := core.Page{Paper: paper, Landscape: landscape}
+
+	code2D := core.Code2DTypeFromString(codeType)
+	if code2D == core.Code2DTypeUnknown {
+		return internal.TextOptions{}, fmt.Errorf("unknown 2D code type '%s', must be one of: aztec, qr, color", codeType)
+	}
+	code2DOptions := core.Code2DOptions{
+		Type:              code2D,
+		QRErrorCorrection: core.QRErrorCorrectionFromString(qrEC),
+		DPI:               core.Code2DDefaultDPI,
+		PrintArea:         page.Code2DPrintSize(),
+	}
+	if err := code2DOptions.Validate(); err != nil {
+		return internal.TextOptions{}, errors.Join(errors.New("invalid 2D code options"), err)
+	}
+	if code2D == core.Code2DTypeAztec && cmd.Flags().Lookup("qr-ec").Changed {
+		return internal.TextOptions{}, errors.New("--qr-ec requires --code-type qr")
+	}
+	if code2D != core.Code2DTypeAztec && !cmd.Flags().Lookup("qr-payload").Changed {
+		// as 'generate' does
+		qrPayload = "cbor"
+	}
+	payloadFormat := core.QRPayloadFormatFromString(qrPayload)
+	if payloadFormat == core.QRPayloadFormatUnknown {
+		return internal.TextOptions{}, fmt.Errorf("unknown 2D code payload format '%s', must be one of: json, cbor", qrPayload)
+	}
+
+	layout := core.DefaultDataLayout
+	if encoding != core.PaperCryptDataEncodingArmor && encoding != core.PaperCryptDataEncodingWords {
+		layout.Columns = max(core.BytesPerLine/layout.GroupSize, 1)
+		layout = page.FitDataLayout(layout)
+	} else if eccLevel != 0 {
+		return internal.TextOptions{}, fmt.Errorf("error correction is not supported for the %s encoding", encoding)
+	}
+	checksum := core.LineChecksumFromString(lineChecksum)
+	if checksum == core.LineChecksumUnknown {
+		return internal.TextOptions{}, fmt.Errorf("unknown line checksum '%s', must be one of: crc24, crc32, sha256", lineChecksum)
+	}
+	if eccLevel < 0 || eccLevel > 100 {
+		return internal.TextOptions{}, fmt.Errorf("invalid error correction level %d, must be between 0 and 100 percent", eccLevel)
+	}
+
+	language, err := internal.LoadLanguage(internal.DefaultLanguage)
+	if err != nil {
+		return internal.TextOptions{}, err
+	}
+
+	return internal.TextOptions{
+		Encoding:             encoding,
+		Layout:               layout,
+		LineChecksum:         checksum,
+		ErrorCorrectionLevel: eccLevel,
+		QRPayload:            payloadFormat,
+		Code2D:               code2DOptions,
+		Page:                 page,
+		Language:             language,
+	}, nil
+}
+
+// benchmarkCodes measures how fast 2D codes are encoded, and read, and how much data each holds, with opts.
+// It returns the fields to print, and the bytes of data per code.
+func benchmarkCodes(opts internal.TextOptions) ([][2]string, int, error) {
+	data := make([]byte, benchmarkCodeData)
+	if _, err := rand.Read(data); err != nil {
+		return nil, 0, errors.Join(errors.New("error generating random data"), err)
+	}
+	payload, err := core.NewPaperCrypt(core.VersionInfo.GitVersion, data, "BENCHM", "", "", time.Now(), core.PaperCryptDataFormatPGP).QRPayload(opts.QRPayload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+	codes, err := core.Encode2DParts(payload, opts.Code2D)
+	if err != nil {
+		return nil, 0, errors.Join(errors.New("error generating 2D code"), err)
+	}
+	encoding := time.Since(start) / time.Duration(len(codes))
+
+	modules := codes[0].Bounds().Dx() + 2*internal.Code2DQuietZone
+	img, err := internal.Code2DImage(codes[0], 4*modules)
+	if err != nil {
+		return nil, 0, err
+	}
+	start = time.Now()
+	if _, err := core.ScanCodeImage(img); err != nil {
+		return nil, 0, err
+	}
+	decoding := time.Since(start)
+
+	perCode := len(data) / len(codes)
+	return [][2]string{
+		{"2D Code Encoding", fmt.Sprintf("%s per code", encoding.Round(time.Millisecond))},
+		{"2D Code Reading", fmt.Sprintf("%s per code", decoding.Round(time.Millisecond))},
+		{"Data per 2D Code", fmt.Sprintf("%s, one code per page", internal.SprintBinarySize(perCode))},
+	}, perCode, nil
+}
+
+// pageCapacity returns the most data the text of a document generated with opts holds on the given number of pages.
+func pageCapacity(opts internal.TextOptions, pages int) (int, error) {
+	fits := func(length int) (bool, error) {
+		n, err := textPages(opts, length)
+		return n <= pages, err
+	}
+
+	// double the length until it no longer fits, then search between the last two lengths
+	low, high := 1, 256
+	for {
+		ok, err := fits(high)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		low, high = high, 2*high
+	}
+	for high-low > 1 {
+		middle := (low + high) / 2
+		ok, err := fits(middle)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+
+	return low, nil
+}
+
+// textPages returns the number of pages of a document generated with opts, and without a 2D code, holding length bytes of data.
+func textPages(opts internal.TextOptions, length int) (int, error) {
+	pc := core.NewPaperCrypt(core.VersionInfo.GitVersion, make([]byte, length), "BENCHM", "", "", time.Now(), core.PaperCryptDataFormatPGP)
+	pdf, err := internal.RendererPDF.Render(pc, true, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	return internal.CountPDFPages(pdf)
+}
+
+// throughput formats the speed of processing size bytes in elapsed.
+func throughput(size int, elapsed time.Duration) string {
+	return fmt.Sprintf("%s/s (%s in %s)", internal.SprintBinarySize(int(float64(size)/elapsed.Seconds())), internal.SprintBinarySize(size), elapsed.Round(time.Millisecond))
+}
+
+func init() {
+	rootCmd.AddCommand(benchmarkCmd)
+
+	benchmarkCmd.Flags().IntVar(&benchmarkSize, "size", 1024*1024, "Bytes of data to encrypt, and decrypt")
+	benchmarkCmd.Flags().StringVar(&dataEncoding, "encoding", "base16", "Encoding of the printed data, either 'base16', 'base32', 'base64', 'armor', or 'words'")
+	benchmarkCmd.Flags().StringVar(&lineChecksum, "line-checksum", "crc24", "Checksum of each line of the data block, either 'crc24', 'crc32', or 'sha256'")
+	benchmarkCmd.Flags().IntVar(&eccLevel, "ecc-level", 0, "Percentage of Reed-Solomon parity lines appended to the data block (0 to disable)")
+	benchmarkCmd.Flags().StringVar(&codeType, "code-type", "aztec", "Type of the 2D code, either 'aztec', or 'qr'")
+	benchmarkCmd.Flags().StringVar(&qrEC, "qr-ec", "M", "Error correction level of the QR code, either L (7%), M (15%), Q (25%), or H (30%)")
+	benchmarkCmd.Flags().StringVar(&qrPayload, "qr-payload", "json", "Serialization of the document inside the 2D code, either 'json', or 'cbor'")
+	benchmarkCmd.Flags().StringVar(&paperSize, "paper", "a4", "Paper size of the PDF document, either 'a4', 'letter', 'a5', or 'legal'")
+	benchmarkCmd.Flags().BoolVar(&landscape, "landscape", false, "Print the PDF document in landscape orientation")
+
+	_ = benchmarkCmd.RegisterFlagCompletionFunc("encoding", completeValues(encodingValues...))
+	_ = benchmarkCmd.RegisterFlagCompletionFunc("line-checksum", completeValues(lineChecksumValues...))
+	_ = benchmarkCmd.RegisterFlagCompletionFunc("code-type", completeValues("aztec", "qr"))
+	_ = benchmarkCmd.RegisterFlagCompletionFunc("qr-ec", completeValues(qrECValues...))
+	_ = benchmarkCmd.RegisterFlagCompletionFunc("qr-payload", completeValues(qrPayloadValues...))
+	_ = benchmarkCmd.RegisterFlagCompletionFunc("paper", completePaperSizes)
+}
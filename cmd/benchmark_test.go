@@ -0,0 +1,55 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestBenchmark(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	defer resetFlags(benchmarkCmd)
+
+	rootCmd.SetArgs([]string{"benchmark", "--size", "4096", "--code-type", "qr"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("benchmark failed with error %s", err)
+	}
+	for _, field := range []string{"Encryption:", "Decryption:", "2D Code Encoding:", "2D Code Reading:", "Data per 2D Code:", "Data per Additional Page:", "Pages of Text:"} {
+		if !strings.Contains(out.String(), field) {
+			t.Fatalf("Expected %q in the output, got:\n%s", field, out.String())
+		}
+	}
+
+	resetFlags(benchmarkCmd)
+	rootCmd.SetArgs([]string{"benchmark", "--code-type", "color"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for the color code")
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	catalogPath     string
+	catalogLocation string
+	catalogPages    int
+	catalogPurpose  string
+)
+
+var catalogCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "catalog",
+	Short:        "Keep a list of your documents, to find the sheet holding some data. Subcommands: 'add', 'list', 'show'",
+	Long: `The catalog is a list of your documents, kept on this computer:
+their serial number, purpose, comment, creation date, content checksum, number of pages, and where they are stored.
+Use it to find the sheet holding some data, without opening the safe.
+
+'generate' adds every document it writes, unless '--no-catalog' is given.
+Documents generated elsewhere, or before the catalog existed, are added with 'catalog add'.
+The catalog holds no secrets: the purpose, and comment, of documents generated with '--private-metadata' are left out,
+unless given to 'catalog add --purpose'.`,
+}
+
+var catalogAddCmd = &cobra.Command{
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "add [<input>...]",
+	Short:             "Add a document to the catalog, or update where it is stored",
+	Long: `This command adds a document to the catalog, read like 'restore' does, without decrypting it.
+A document already in the catalog is updated, keeping its number of pages, purpose, and location, unless given again.`,
+	Example: `papercrypt catalog add document.pdf --location "safe, top shelf"
+papercrypt catalog add scan.png --location "bank deposit box" --pages 2`,
+	RunE: func(_ *cobra.Command, args []string) error {
+		catalog, err := internal.NewCatalog(catalogPath)
+		if err != nil {
+			return err
+		}
+
+		kind, inputs, contents, err := readInputs(args)
+		if err != nil {
+			return err
+		}
+		pc, err := restoreDocument(kind, inputs, contents)
+		if err != nil {
+			return err
+		}
+
+		pages := catalogPages
+		if pages == 0 && internal.IsPDF(contents[0]) {
+			// scans of a document hold no more pages than the document itself
+			if pages, err = internal.CountPDFPages(contents[0]); err != nil {
+				log.WithError(err).Warn("Could not count the pages of the document")
+			}
+		}
+
+		entry := internal.NewCatalogEntry(pc, pages, catalogLocation)
+		if catalogPurpose != "" {
+			entry.Purpose = catalogPurpose
+		}
+		return addToCatalog(catalog, entry)
+	},
+}
+
+var catalogListCmd = &cobra.Command{
+	Aliases:      []string{"ls"},
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	Use:          "list [<query>]",
+	Short:        "List the documents in the catalog",
+	Long: `This command lists the documents in the catalog, oldest first.
+Given a query, only the documents whose serial number, purpose, comment, or location contain it are listed, ignoring case.
+Documents that have expired, or are due for review, are marked as overdue.`,
+	Example: `papercrypt catalog list
+papercrypt catalog list bank`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		catalog, err := internal.NewCatalog(catalogPath)
+		if err != nil {
+			return err
+		}
+		entries, err := catalog.Entries()
+		if err != nil {
+			return err
+		}
+
+		var matching []internal.CatalogEntry
+		for _, entry := range entries {
+			if len(args) == 0 || entry.Matches(args[0]) {
+				matching = append(matching, entry)
+			}
+		}
+		if len(matching) == 0 {
+			log.WithField("catalog", catalog.Path()).Info("No documents found in the catalog")
+			return nil
+		}
+
+		return writeCatalogList(cmd.OutOrStdout(), matching, time.Now())
+	},
+}
+
+var catalogShowCmd = &cobra.Command{
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeCatalogSerialNumbers,
+	SilenceUsage:      true,
+	Use:               "show <serial number>",
+	Short:             "Show a document in the catalog",
+	Example:           `papercrypt catalog show EIPESR`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		catalog, err := internal.NewCatalog(catalogPath)
+		if err != nil {
+			return err
+		}
+		entry, ok, err := catalog.Find(args[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("no document with serial number %s in the catalog %s", args[0], catalog.Path())
+		}
+
+		for _, notice := range entry.Overdue(time.Now()) {
+			log.Warn(notice)
+		}
+		return writeFields(cmd.OutOrStdout(), catalogEntryFields(entry))
+	},
+}
+
+// addToCatalog adds the entry to the catalog, and logs where it was added.
+func addToCatalog(catalog *internal.Catalog, entry internal.CatalogEntry) error {
+	replaced, err := catalog.Add(entry)
+	if err != nil {
+		return err
+	}
+
+	message := "Added the document to the catalog"
+	if replaced {
+		message = "Updated the document in the catalog"
+	}
+	log.WithField("serial", entry.SerialNumber).WithField("catalog", catalog.Path()).Info(message)
+	return nil
+}
+
+// writeCatalogList writes the entries as a table, one per line, marking those overdue at now.
+func writeCatalogList(w io.Writer, entries []internal.CatalogEntry, now time.Time) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SERIAL\tPURPOSE\tCREATED\tPAGES\tLOCATION\tSTATUS")
+	for _, entry := range entries {
+		pages := "?"
+		if entry.Pages > 0 {
+			pages = fmt.Sprint(entry.Pages)
+		}
+		status := ""
+		if len(entry.Overdue(now)) > 0 {
+			status = "overdue"
+		}
+		fields := []string{entry.SerialNumber, entry.Purpose, entry.CreatedAt.Format(core.TimeStampFormatDate), pages, entry.Location, status}
+		// empty cells at the end of the line would be padded with spaces
+		fmt.Fprintln(table, strings.TrimRight(strings.Join(fields, "\t"), "\t"))
+	}
+
+	if err := table.Flush(); err != nil {
+		return errors.Join(errors.New("error writing to file"), err)
+	}
+	return nil
+}
+
+// catalogEntryFields returns the fields of the entry, as pairs of field names and values, see writeFields.
+func catalogEntryFields(entry internal.CatalogEntry) [][2]string {
+	fields := [][2]string{
+		{core.HeaderFieldSerial, entry.SerialNumber},
+		{core.HeaderFieldPurpose, entry.Purpose},
+		{core.HeaderFieldComment, entry.Comment},
+		{core.HeaderFieldDate, core.FormatTimeStamp(entry.CreatedAt)},
+	}
+	if !entry.ExpiresAt.IsZero() {
+		fields = append(fields, [2]string{core.HeaderFieldExpires, core.FormatDueDate(entry.ExpiresAt)})
+	}
+	if !entry.ReviewBy.IsZero() {
+		fields = append(fields, [2]string{core.HeaderFieldReviewBy, core.FormatDueDate(entry.ReviewBy)})
+	}
+	if entry.Supersedes != "" {
+		fields = append(fields, [2]string{core.HeaderFieldSupersedes, entry.Supersedes})
+	}
+
+	pages := "unknown"
+	if entry.Pages > 0 {
+		pages = fmt.Sprint(entry.Pages)
+	}
+	return append(fields,
+		[2]string{core.HeaderFieldSHA256, entry.ContentSHA256},
+		[2]string{"Pages", pages},
+		[2]string{"Location", entry.Location},
+	)
+}
+
+// completeCatalogSerialNumbers completes the serial numbers of the documents in the catalog,
+// each described by its purpose.
+func completeCatalogSerialNumbers(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return catalogSerialNumbers(toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// catalogSerialNumbers returns the serial numbers in the catalog starting with prefix, as completions,
+// or none, if the catalog can not be read.
+func catalogSerialNumbers(prefix string) []string {
+	catalog, err := internal.NewCatalog(catalogPath)
+	if err != nil {
+		return nil
+	}
+	entries, err := catalog.Entries()
+	if err != nil {
+		return nil
+	}
+
+	var serials []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.SerialNumber, prefix) {
+			continue
+		}
+		completion := entry.SerialNumber
+		if entry.Purpose != "" {
+			completion += "\t" + entry.Purpose
+		}
+		serials = append(serials, completion)
+	}
+
+	return serials
+}
+
+func init() {
+	catalogCmd.AddCommand(catalogAddCmd, catalogListCmd, catalogShowCmd)
+	rootCmd.AddCommand(catalogCmd)
+
+	catalogCmd.PersistentFlags().StringVar(&catalogPath, "catalog", "", "File the catalog is kept in (default: catalog.json in the PaperCrypt configuration directory)")
+	catalogAddCmd.Flags().StringVar(&catalogLocation, "location", "", "Where the sheets are stored, such as 'safe, top shelf'")
+	catalogAddCmd.Flags().IntVar(&catalogPages, "pages", 0, "Number of pages of the document (default: counted for PDF documents)")
+	catalogAddCmd.Flags().StringVar(&catalogPurpose, "purpose", "", "Purpose of the document, for documents generated with --private-metadata")
+	addStrictFlag(catalogAddCmd)
+
+	_ = catalogCmd.RegisterFlagCompletionFunc("catalog", completeFiles("json"))
+}
@@ -0,0 +1,126 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestMain(m *testing.M) {
+	// generate adds every document to the catalog in the configuration directory,
+	// which must not be the one of the user running the tests
+	configDir, err := os.MkdirTemp("", "papercrypt-test-config")
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"XDG_CONFIG_HOME", "HOME", "AppData"} {
+		_ = os.Setenv(name, configDir)
+	}
+	// neither is any audit log configured for the user
+	for _, name := range []string{auditLogEnv, auditKeyEnv} {
+		_ = os.Unsetenv(name)
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(configDir)
+	os.Exit(code)
+}
+
+func TestCatalog(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	resetFlags(generateCmd)
+	defer resetFlags(generateCmd)
+	for _, cmd := range []*cobra.Command{catalogCmd, catalogAddCmd, catalogListCmd, catalogShowCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "secret.json")
+	if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	docPath := filepath.Join(tempDir, "document.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	catalogFile := filepath.Join(tempDir, "catalog.json")
+
+	rootCmd.SetArgs([]string{"generate", "-i", inPath, "-o", filepath.Join(tempDir, "sheet.pdf"), "-P", "example", "--no-qr",
+		"--serial-number", "VAULT1", "--purpose", "Bank vault", "--private-metadata", "--location", "safe", "--catalog", catalogFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"catalog", "add", docPath, "--location", "drawer", "--catalog", catalogFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"catalog", "list", "vault", "--catalog", catalogFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	// the purpose is private on the sheet, and left out of the catalog
+	if !strings.Contains(out.String(), "VAULT1") || strings.Contains(out.String(), "Bank vault") || strings.Contains(out.String(), "EIPESR") {
+		t.Fatalf("Expected only the generated document to be listed, without its purpose, got:\n%s", out.String())
+	}
+
+	// unless it is given explicitly
+	rootCmd.SetArgs([]string{"catalog", "add", filepath.Join(tempDir, "sheet.pdf"), "--purpose", "Bank vault", "--catalog", catalogFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	rootCmd.SetArgs([]string{"catalog", "list", "vault", "--catalog", catalogFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "VAULT1  Bank vault") {
+		t.Fatalf("Expected the purpose given to catalog add to be listed, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	rootCmd.SetArgs([]string{"catalog", "show", "EIPESR", "--catalog", catalogFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Purpose:         Example Sheet", "Location:        drawer"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("Expected %q in the output, got:\n%s", want, out.String())
+		}
+	}
+
+	rootCmd.SetArgs([]string{"catalog", "show", "MISSING", "--catalog", catalogFile})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for a serial number not in the catalog")
+	}
+}
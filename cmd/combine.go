@@ -0,0 +1,86 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+)
+
+var nup int
+
+// combineCmd represents the combine command.
+var combineCmd = &cobra.Command{
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeFiles("pdf"),
+	SilenceUsage:      true,
+	Use:               "combine <document.pdf>...",
+	Short:             "Combine PaperCrypt documents, placing several pages on each sheet of paper",
+	Long: `The 'combine' command places the pages of several PaperCrypt documents on shared sheets of paper,
+two or four pages per sheet, with cutting guides between them. This saves paper when printing many small documents,
+such as one document per account. The pages are shrunk to fit, so their 2D codes are printed smaller.`,
+	Example: "papercrypt combine --nup 4 -o sheets.pdf bank.pdf mail.pdf server.pdf",
+	RunE: func(_ *cobra.Command, args []string) error {
+		docs := make([][]byte, 0, len(args))
+		for _, path := range args {
+			doc, err := os.ReadFile(path)
+			if err != nil {
+				return errors.Join(fmt.Errorf("error reading %s", path), err)
+			}
+			docs = append(docs, doc)
+		}
+
+		data, err := internal.NUpPDF(docs, nup)
+		if err != nil {
+			return errors.Join(errors.New("error combining documents"), err)
+		}
+
+		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
+			if err != nil {
+				log.WithError(err).Error("Error closing file")
+			}
+		}(outFile)
+
+		n, err := outFile.Write(data)
+		if err != nil {
+			return errors.Join(errors.New("error writing PDF"), err)
+		}
+
+		internal.PrintWrittenSize(n, outFile)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(combineCmd)
+
+	combineCmd.Flags().IntVar(&nup, "nup", 2, "Number of pages per sheet, either 2 or 4")
+}
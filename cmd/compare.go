@@ -0,0 +1,91 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var compareCmd = &cobra.Command{
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeFiles("pdf"),
+	SilenceUsage:      true,
+	Use:               "compare <original> <reprint>",
+	Short:             "Check that two documents hold the same content, such as a reprint and its original",
+	Long: `This command compares two documents, each read like 'restore' does
+(a PDF, the text of a document, a scan of its 2D code, or the payload of the code),
+and reports whether they hold the same content (the encrypted data), serial number, and checksums.
+
+Use it when reprinting a faded sheet, to make sure nothing changed on the way.
+The purpose, comment, date, and version of PaperCrypt may change with a reprint, their differences are only reported.
+No passphrase is needed, the documents are not decrypted.`,
+	Example: `papercrypt compare original.pdf reprint.pdf
+papercrypt compare original.txt scan-of-reprint.png`,
+	RunE: func(_ *cobra.Command, args []string) error {
+		documents := make([]*core.PaperCrypt, len(args))
+		for i, arg := range args {
+			var err error
+			documents[i], err = readRestoreInputs([]string{arg})
+			if err != nil {
+				return errors.Join(fmt.Errorf("error reading %s", arg), err)
+			}
+		}
+
+		var differences []string
+		for _, c := range core.CompareDocuments(documents[0], documents[1]) {
+			entry := log.WithField("value", c.A)
+			if !c.Equal {
+				entry = log.WithField("first", c.A).WithField("second", c.B)
+			}
+
+			switch {
+			case c.Equal:
+				entry.Info(c.Field)
+			case c.Essential:
+				entry.Error(core.Warning(c.Field + " differs"))
+				differences = append(differences, c.Field)
+			default:
+				entry.Warn(c.Field + " differs")
+			}
+		}
+
+		if len(differences) > 0 {
+			return fmt.Errorf("the documents do not hold the same content, they differ in: %s", strings.Join(differences, ", "))
+		}
+
+		log.Info(core.Bold("The documents hold the same content."))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+	addScanJobsFlag(compareCmd)
+	addStrictFlag(compareCmd)
+}
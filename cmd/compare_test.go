@@ -0,0 +1,57 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rawPath := filepath.Join(tempDir, "raw.txt")
+	if err := os.WriteFile(rawPath, []byte(docRaw), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the document, and its 2D code
+	codePath := filepath.Join(tempDir, "code.png")
+	cmd := rootCmd
+	cmd.SetArgs([]string{"qr", "encode", "-i", docPath, "-o", codePath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.SetArgs([]string{"compare", docPath, codePath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.SetArgs([]string{"compare", docPath, rawPath})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("Expected different documents to be reported")
+	}
+}
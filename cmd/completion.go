@@ -0,0 +1,203 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// Extensions of the files the commands read and write, completed for --in, --out, and their arguments.
+var (
+	documentExtensions = []string{"txt", "pdf"}
+	imageExtensions    = []string{"png", "jpg", "jpeg"}
+	messageExtensions  = []string{"asc", "gpg"}
+)
+
+// inFileExtensions are the extensions completed for --in, and the arguments, by command, other commands complete any file.
+var inFileExtensions = map[string][]string{
+	"decode":    slices.Concat(documentExtensions, imageExtensions, messageExtensions),
+	"scan":      slices.Concat([]string{"pdf"}, imageExtensions),
+	"info":      slices.Concat(documentExtensions, imageExtensions, messageExtensions),
+	"verify":    slices.Concat(documentExtensions, imageExtensions),
+	"restore":   slices.Concat(documentExtensions, imageExtensions, messageExtensions),
+	"upgrade":   documentExtensions,
+	"reencrypt": slices.Concat(documentExtensions, imageExtensions),
+}
+
+// outFileExtensions are the extensions completed for --out, by command, other commands complete any file.
+var outFileExtensions = map[string][]string{
+	"generate":               {"pdf", "png", "html", "typ", "txt"},
+	"generate-key":           {"txt"},
+	"gen-key":                {"txt"},
+	"upgrade":                {"pdf"},
+	"reencrypt":              {"pdf"},
+	"testpage":               {"pdf"},
+	"transcription-template": {"pdf"},
+	"encode":                 {"png", "svg"},
+}
+
+// Values of the flags shared by several commands, each followed by a tab and its description.
+var (
+	encodingValues = []string{
+		"base16\thexadecimal",
+		"base32\tCrockford's alphabet",
+		"base64",
+		"armor\tOpenPGP-style ASCII armor",
+		"words\tPGP words, for reading aloud",
+	}
+	qrECValues          = []string{"L\t7%", "M\t15%", "Q\t25%", "H\t30%"}
+	lineChecksumValues  = []string{"crc24", "crc32", "sha256\ttruncated to 4 bytes"}
+	qrPayloadValues     = []string{"json", "cbor\tmore compact"}
+	codeTypeValues      = []string{"aztec", "qr", "color\texperimental"}
+	transcriptionValues = []string{"base16\thexadecimal", "base32\tCrockford's alphabet", "base64"}
+)
+
+// maxCompletedDocumentSize is the size of the largest file read to complete serial numbers,
+// completion runs on every key press, and should not read large files.
+const maxCompletedDocumentSize = 4 << 20
+
+// completeValues completes a flag with one of the values, each followed by a tab and its description.
+func completeValues(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return cobra.FixedCompletions(values, cobra.ShellCompDirectiveNoFileComp)
+}
+
+// completePaperSizes completes --paper with the paper sizes supported.
+func completePaperSizes(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	sizes := make([]string, 0, len(core.PaperSizes))
+	for _, size := range core.PaperSizes {
+		sizes = append(sizes, strings.ToLower(size.String()))
+	}
+
+	return sizes, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeLanguages completes --lang with the languages documents can be printed in.
+func completeLanguages(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return internal.Languages(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFiles completes files with one of the extensions, or any file, if none are given.
+func completeFiles(extensions ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		if len(extensions) == 0 {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+
+		return extensions, cobra.ShellCompDirectiveFilterFileExt
+	}
+}
+
+// completeDirectories completes directories.
+func completeDirectories(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
+
+// completeInFile completes --in with the files the command reads.
+func completeInFile(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeFiles(inFileExtensions[cmd.Name()]...)(cmd, args, toComplete)
+}
+
+// completeOutFile completes --out with the files the command writes.
+func completeOutFile(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeFiles(outFileExtensions[cmd.Name()]...)(cmd, args, toComplete)
+}
+
+// completeSerialNumbers completes --serial-number with the serial numbers of the PaperCrypt documents
+// in the current directory, text documents, and PDF documents carrying the document as an attachment,
+// each described by its purpose, and file name, followed by those of the other documents in the catalog.
+func completeSerialNumbers(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var serials []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !slices.Contains(documentExtensions, strings.TrimPrefix(filepath.Ext(entry.Name()), ".")) {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || info.Size() > maxCompletedDocumentSize {
+			continue
+		}
+
+		serial, purpose, ok := readSerialNumber(entry.Name())
+		if !ok || !strings.HasPrefix(serial, toComplete) {
+			continue
+		}
+
+		description := entry.Name()
+		if purpose != "" {
+			description = purpose + ", " + description
+		}
+		serials = append(serials, serial+"\t"+description)
+	}
+
+	for _, completion := range catalogSerialNumbers(toComplete) {
+		serial, _, _ := strings.Cut(completion, "\t")
+		if !slices.ContainsFunc(serials, func(s string) bool { return strings.HasPrefix(s, serial+"\t") }) {
+			serials = append(serials, completion)
+		}
+	}
+
+	return serials, cobra.ShellCompDirectiveNoFileComp
+}
+
+// readSerialNumber reads the serial number, and purpose, of the PaperCrypt document at path,
+// ok is false if it is no PaperCrypt document.
+func readSerialNumber(path string) (serial string, purpose string, ok bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+
+	if strings.HasSuffix(path, ".pdf") {
+		attachment, ok, err := internal.ExtractPDFAttachment(data)
+		if err != nil || !ok {
+			return "", "", false
+		}
+
+		var pc core.PaperCrypt
+		if err := json.Unmarshal(attachment, &pc); err != nil {
+			return "", "", false
+		}
+		return pc.SerialNumber, pc.Purpose, pc.SerialNumber != ""
+	}
+
+	header, _, err := core.SplitTextHeaderAndBody(core.NormalizeLineEndings(data))
+	if err != nil {
+		return "", "", false
+	}
+	headers, err := core.TextToHeaderMap(header)
+	if err != nil {
+		return "", "", false
+	}
+
+	serial = headers[core.HeaderFieldSerial]
+	return serial, headers[core.HeaderFieldPurpose], serial != ""
+}
@@ -0,0 +1,92 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCompletePaperSizes(t *testing.T) {
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+
+	rootCmd.SetArgs([]string{cobra.ShellCompRequestCmd, "generate", "--paper", ""})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []string{"a4", "letter", "a5", "legal"} {
+		if !strings.Contains(out.String(), size+"\n") {
+			t.Fatalf("Expected %s to be completed, got %s", size, out.String())
+		}
+	}
+}
+
+func TestCompleteInFile(t *testing.T) {
+	extensions, directive := completeInFile(decodeCmd, nil, "")
+	if directive != cobra.ShellCompDirectiveFilterFileExt {
+		t.Fatalf("Expected the files to be filtered, got directive %d", directive)
+	}
+	if !slices.Contains(extensions, "pdf") || !slices.Contains(extensions, "asc") {
+		t.Fatalf("Expected documents and messages to be completed, got %v", extensions)
+	}
+
+	if _, directive := completeInFile(generateCmd, nil, ""); directive != cobra.ShellCompDirectiveDefault {
+		t.Fatalf("Expected any file to be completed, got directive %d", directive)
+	}
+}
+
+func TestCompleteSerialNumbers(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(wd)
+	}()
+
+	tempDir := t.TempDir()
+	if err := os.WriteFile(tempDir+"/sheet.txt", []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tempDir+"/notes.txt", []byte("not a document"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatal(err)
+	}
+
+	serials, _ := completeSerialNumbers(generateCmd, nil, "")
+	if len(serials) != 1 || serials[0] != "EIPESR\tExample Sheet, sheet.txt" {
+		t.Fatalf("Expected the serial number of the document, got %v", serials)
+	}
+
+	if serials, _ := completeSerialNumbers(generateCmd, nil, "X"); len(serials) != 0 {
+		t.Fatalf("Expected no serial number starting with X, got %v", serials)
+	}
+}
@@ -22,16 +22,32 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"image"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/log"
 	"github.com/spf13/cobra"
 	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 var (
 	ignoreVersionMismatch  bool
 	ignoreChecksumMismatch bool
+	decodeWordStream       bool
+	ignoreMismatch         bool
+	ocrScanFiles           []string
+	ocrTextPath            string
+	tesseractPath          string
+	decodeInteractive      bool
+	decodeSessionPath      string
+	decodePartial          bool
+	strictParsing          bool
+	minFormatVersion       int
+	decompressMessage      bool
 )
 
 // decodeCmd represents the decode command.
@@ -42,8 +58,52 @@ var decodeCmd = &cobra.Command{
 	Use:          "decode",
 	Short:        "Decode a PaperCrypt document",
 	Long: `This command allows you to decode binary data saved by PaperCrypt. 
-The data should be read from a file or stdin, you will be required to provide a passphrase.`,
-	Example: `papercrypt decode -i <file>.txt -o <file>.txt`,
+The data should be read from a file or stdin, you will be required to provide a passphrase.
+
+The encoding of the data (base16, base32, base64, armor, or words) is read from the document header,
+or detected from the data itself, if the header does not state it.
+
+With --words, the input is a bare stream of PGP words (as written with 'generate --encoding words'),
+without a header, for example transcribed from a phone call or an audio recording.
+
+The SHA-256 checksum of the encrypted content, and that of the decrypted data (if it was printed,
+see 'generate --plaintext-hash'), are verified, and decoding stops if either does not match.
+With --ignore-mismatch, mismatches are reported as warnings instead.
+
+With --scan, the printed text of scanned pages (images, PDF, or TIFF files) is read by OCR, using Tesseract,
+for when the 2D code can not be read. Characters commonly misread (such as 8 and B) are corrected, as long as
+the checksum of the line confirms the correction, and lines that can not be read are listed.
+With --ocr-text, the text read is written to a file, to be corrected by hand, and decoded using -i.
+
+With --interactive, the document is typed in on the terminal, line by line. The expected structure of every line
+is shown, and its checksum is checked as it is typed, highlighting the character at fault where it can be found.
+The data block is laid out once the header fields describing it (such as the Content Length) are entered.
+Ctrl+R lists the corrections of a line failing its checksum (a single wrong character, or two swapped characters),
+the most likely first, to be applied instead of typing the line again.
+With --session, the progress is saved to an encrypted file, whenever a changed line is left, or Ctrl+S is pressed,
+so the transcription can be paused (with Ctrl+C), and resumed later, or by someone else, using the same file.
+The session file is protected by a passphrase of its own, so a transcription can be handed over
+without sharing the passphrase of the document.
+
+With --partial, a document with lines missing, or damaged beyond what error correction can repair,
+is decoded as far as possible, instead of failing. The byte ranges of the content that are lost are listed,
+and the data is recovered up to the first lost byte, as the content is compressed and encrypted in a stream.
+Partial recovery requires line numbers in the data block (see 'generate --layout').
+
+A bare OpenPGP message (ASCII armored, or binary, such as a .asc or .gpg file written by gpg) is decrypted as well,
+without a PaperCrypt header, for when only the encrypted content survived. The data is written as 'gpg --decrypt' returns it,
+use --decompress for messages written by 'generate --export-cipher', whose data PaperCrypt compressed before encrypting it.
+
+The digital PDF generated by PaperCrypt is read directly, without printing and scanning it:
+the document attached to it is read, or, if it has none (such as PDF/A documents), the text printed on its pages,
+or else its pages are rendered, and their 2D codes are read. As by --scan, only base16, base32, and base64 data blocks
+with line numbers are read from the text, documents without 2D codes must be written using one of them.`,
+	Example: `papercrypt decode -i <file>.txt -o <file>.txt
+papercrypt decode --scan page-1.png --scan page-2.png -o <file>.txt
+papercrypt decode --interactive --session transcription.session -o <file>.txt
+papercrypt decode --partial -i <file>.txt -o <file>.partial.txt
+papercrypt decode -i <file>.asc -o <file>.txt
+papercrypt decode -i <file>.pdf -o <file>.txt`,
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		// 1. Open output file
 		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
@@ -57,71 +117,144 @@ The data should be read from a file or stdin, you will be required to provide a
 			}
 		}(outFile)
 
-		// 2. Read inFile
-		paperCryptFileContents, err := internal.PrintInputAndRead(inFileName)
-		if err != nil {
-			return err
+		// 2. Read inFile, or the scanned pages
+		var paperCryptFileContents []byte
+		fromPDF := false
+		if decodeSessionPath != "" {
+			decodeInteractive = true
 		}
-		paperCryptFileContents = internal.NormalizeLineEndings(paperCryptFileContents)
-
-		headersSection, bodySection, err := internal.SplitTextHeaderAndBody(paperCryptFileContents)
-		if err != nil {
-			return errors.Join(errors.New("header not found"), err)
+		if decodeInteractive && (decodeWordStream || len(ocrScanFiles) > 0 || inFileName != "") {
+			return errors.New("--interactive can not be combined with --words, --scan, or --in")
 		}
+		if len(ocrScanFiles) > 0 {
+			if decodeWordStream {
+				return errors.New("--words can not be combined with --scan")
+			}
 
-		if len(bodySection) == 0 {
-			return errors.New("no content found")
-		}
+			paperCryptFileContents, err = readDocumentByOCR(ocrScanFiles)
+		} else if decodeInteractive {
+			var session *entrySessionFile
+			if decodeSessionPath != "" {
+				cmd.Println("Enter the passphrase of the session file (it protects the progress saved, and may differ from the passphrase of the document)")
+				sessionPassphrase, err := internal.SensitivePrompt()
+				if err != nil {
+					return errors.Join(errors.New("error reading passphrase"), err)
+				}
+				session = &entrySessionFile{path: decodeSessionPath, passphrase: sessionPassphrase}
+			}
+
+			paperCryptFileContents, err = readDocumentInteractively(session)
+		} else {
+			paperCryptFileContents, err = internal.PrintInputAndRead(inFileName)
+			if err == nil && internal.IsPDF(paperCryptFileContents) {
+				if decodeWordStream {
+					return errors.New("--words can not be combined with a PDF document")
+				}
 
-		headers, err := internal.TextToHeaderMap(headersSection)
+				// the read-back phrase is shown by payloadToText
+				fromPDF = true
+				paperCryptFileContents, err = readGeneratedPDF(paperCryptFileContents)
+			}
+		}
 		if err != nil {
-			return errors.Join(errors.New("error reading headers"), err)
+			return err
 		}
-
-		paperCryptMajorVersion := internal.PaperCryptContainerVersionFromString(headers[internal.HeaderFieldVersion])
-
-		if paperCryptMajorVersion == internal.PaperCryptContainerVersionUnknown {
-			return errors.New("unknown version")
+		// a binary OpenPGP message must not have its line endings changed
+		bareMessage := !decodeWordStream && core.IsPGPMessage(paperCryptFileContents)
+		if decodeWordStream {
+			paperCryptFileContents = core.NormalizeLineEndings(paperCryptFileContents)
+		} else if !bareMessage {
+			paperCryptFileContents, err = prepareDocumentText(paperCryptFileContents)
+			if err != nil {
+				return err
+			}
 		}
 
-		// 8. Read passphrase from stdin
-		var passphraseBytes []byte
-		if !cmd.Flags().Lookup("passphrase").Changed {
-			cmd.Println("Enter your decryption passphrase (the passphrase you used to encrypt the data)")
-			passphraseBytes, err = internal.SensitivePrompt()
+		var pc *core.PaperCrypt
+		var lost []core.ByteRange
+		if bareMessage {
+			if decodePartial {
+				return errors.New("--partial requires a PaperCrypt document, not a bare OpenPGP message")
+			}
+
+			log.Info("Reading a bare OpenPGP message, without a PaperCrypt header.")
+			pc, err = readBareMessage(paperCryptFileContents)
 			if err != nil {
-				return errors.Join(errors.New("error reading passphrase"), err)
+				return err
+			}
+		} else if decodePartial {
+			if decodeWordStream {
+				return errors.New("--partial can not be combined with --words")
 			}
-		} else {
-			passphraseBytes = []byte(passphrase)
-		}
-		passphrase = "" // clear passphrase
 
-		var decoded []byte
-		switch paperCryptMajorVersion {
-		case internal.PaperCryptContainerVersionMajor1:
-			pc, err := internal.DeserializeV1Text(paperCryptFileContents, ignoreVersionMismatch, ignoreChecksumMismatch)
+			pc, lost, err = core.DeserializeV2TextPartial(paperCryptFileContents, ignoreVersionMismatch)
 			if err != nil {
 				return errors.Join(errors.New("error deserializing PaperCrypt document"), err)
 			}
+			if len(lost) > 0 {
+				log.WithField("lost", core.FormatByteRanges(lost)).Warn(core.Warning("Parts of the content can not be recovered."))
+			}
+		} else if decodeWordStream {
+			format, data, err := core.DecodeWordStream(paperCryptFileContents)
+			if err != nil {
+				return errors.Join(errors.New("error decoding word stream"), err)
+			}
 
-			decoded, err = pc.Decode(passphraseBytes)
+			pc = core.NewPaperCrypt(core.VersionInfo.GitVersion, data, "", "", "", time.Now(), format)
+		} else {
+			pc, err = deserializeDocument(paperCryptFileContents)
 			if err != nil {
-				return errors.Join(errors.New("error decrypting data"), err)
+				return err
 			}
-		case internal.PaperCryptContainerVersionDevel,
-			internal.PaperCryptContainerVersionMajor2:
-			pc, err := internal.DeserializeV2Text(paperCryptFileContents, ignoreVersionMismatch, ignoreChecksumMismatch)
+		}
+
+		if version := pc.ContainerVersion(); int(version) < minFormatVersion {
+			return core.WithCategory(core.ErrorCategoryVersion, fmt.Errorf("the document is of format version %d, --min-format-version requires at least %d, it may have been replaced by an older version", version, minFormatVersion))
+		}
+
+		if !bareMessage && !fromPDF {
+			log.WithField("phrase", core.Bold(pc.ReadBackPhrase())).Info("Read-back phrase")
+		}
+		warnOverdue(pc)
+		if !bareMessage && !decodeWordStream {
+			warnUnauthenticated(pc)
+		}
+
+		// 8. Read passphrase from stdin
+		passphraseBytes, err := readDecryptionPassphrase(cmd)
+		if err != nil {
+			return err
+		}
+
+		var decoded []byte
+		complete := true
+		if decodePartial {
+			recovered, err := pc.DecodePartial(passphraseBytes, lost)
 			if err != nil {
-				return errors.Join(errors.New("error deserializing PaperCrypt document"), err)
+				return errors.Join(errors.New("error decrypting data"), err)
 			}
+			decoded, complete = recovered.Data, recovered.Complete
 
+			if !complete {
+				log.WithField("recovered", fmt.Sprintf("%d bytes", len(decoded))).
+					Warn(core.Warning("The decrypted data is incomplete, only its beginning was recovered."))
+			} else if len(lost) > 0 {
+				log.Info("All of the decrypted data was recovered.")
+			}
+		} else {
 			decoded, err = pc.Decode(passphraseBytes)
 			if err != nil {
 				return errors.Join(errors.New("error decrypting data"), err)
 			}
-		default:
-			return errors.New("unknown version")
+		}
+
+		logPrivateMetadata(pc)
+
+		// an incomplete plaintext can not match its checksum
+		if complete {
+			if err := verifyDecoded(pc, decoded); err != nil {
+				return err
+			}
 		}
 
 		// 11. Write decompressed to outFile
@@ -135,11 +268,285 @@ The data should be read from a file or stdin, you will be required to provide a
 	},
 }
 
+// readGeneratedPDF reads the text of a document from the digital PDF generated by PaperCrypt:
+// from the document attached to it, from the text printed on its pages, or else by rendering its pages,
+// and reading their 2D codes.
+func readGeneratedPDF(data []byte) ([]byte, error) {
+	payload, ok, err := internal.ExtractPDFAttachment(data)
+	if err != nil {
+		log.WithError(err).Debug("error reading the pdf attachment")
+	}
+
+	if ok {
+		log.Info("Read the document attached to the PDF")
+		payload, err = payloadJSON(payload)
+	} else {
+		text, textErr := readPDFText(data)
+		if textErr == nil {
+			log.Info("Read the text printed in the PDF")
+			return text, nil
+		}
+
+		log.WithError(textErr).Info("The PDF has no document attached, and its text can not be read, reading its 2D codes")
+		payload, err = readRenderedPDF(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return payloadToText(payload)
+}
+
+// readPDFText reads the text of a document from the text printed on the pages of a PDF generated by PaperCrypt,
+// failing unless the header, and every line, are read.
+func readPDFText(data []byte) ([]byte, error) {
+	result, err := internal.ReadDocumentFromPDFText(data)
+	if err != nil {
+		return nil, err
+	}
+	if !result.HeaderValid {
+		return nil, errors.New("the header printed in the PDF does not match its checksum")
+	}
+	if len(result.Unreadable) > 0 {
+		return nil, fmt.Errorf("lines %s printed in the PDF can not be read", strings.Join(result.Unreadable, ", "))
+	}
+
+	return result.Text, nil
+}
+
+// readRenderedPDF renders the pages of a PDF generated by PaperCrypt, and reads the payload of the 2D codes on them,
+// including the layers of color codes, as JSON.
+func readRenderedPDF(data []byte) ([]byte, error) {
+	collector := newPayloadCollector()
+	err := internal.RasterizePDF(data, internal.DefaultRasterDPI, func(page, _ int, img *image.RGBA) error {
+		var payloads [][]byte
+		var err error
+		hasColor := core.HasColor(img)
+		if hasColor {
+			// the layers of experimental color codes overlap, and are read one by one,
+			// before the page is scanned as a whole, which may read a single layer only
+			payloads, err = scanColorImage(img)
+		}
+		if !hasColor || err != nil {
+			payloads, err = scanImage(img)
+		}
+		if err != nil {
+			log.WithError(err).WithField("page", page).Debug("no 2D code found")
+			return nil
+		}
+
+		for _, scanned := range payloads {
+			if err := collector.add(fmt.Sprintf("page %d", page), scanned); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Join(errors.New("error rendering the PDF"), err)
+	}
+	if !collector.complete() {
+		return nil, core.WithCategory(core.ErrorCategoryUnreadableCode, errors.New("no complete 2D code found in the PDF, nor a document in the text printed on it"))
+	}
+
+	return collector.payload()
+}
+
+// readDecryptionPassphrase returns the passphrase given on the command line, in the environment,
+// or cached in the keychain (see readPassphrase), or asks for it.
+func readDecryptionPassphrase(cmd *cobra.Command) ([]byte, error) {
+	return readPassphrase(cmd, func() ([]byte, error) {
+		cmd.Println("Enter your decryption passphrase (the passphrase you used to encrypt the data)")
+		passphraseBytes, err := internal.SensitivePrompt()
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading passphrase"), err)
+		}
+
+		return passphraseBytes, nil
+	})
+}
+
+// verifyDecoded verifies the decrypted data against the checksum of the plaintext, if the document holds it.
+// A mismatch is reported as a warning, rather than an error, with --ignore-mismatch.
+func verifyDecoded(pc *core.PaperCrypt, decoded []byte) error {
+	if pc.HeaderMAC != nil {
+		// checked by Decode
+		log.Info("Header MAC verified.")
+	}
+
+	if err := pc.VerifyPlaintext(decoded); err != nil {
+		if !ignoreMismatch {
+			return errors.Join(errors.New("the decrypted data does not match the document, use --ignore-mismatch to write it anyway"), err)
+		}
+
+		log.WithError(err).Warn(core.Warning("Plaintext SHA-256 mismatch!"))
+	} else if len(pc.PlaintextSHA256) > 0 {
+		log.Info("Plaintext SHA-256 verified.")
+	}
+
+	return nil
+}
+
+// readBareMessage wraps a bare OpenPGP message in a document, whose data is decompressed after decryption with --decompress.
+func readBareMessage(message []byte) (*core.PaperCrypt, error) {
+	pc, err := core.NewPaperCryptFromPGPMessage(message)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading OpenPGP message"), err)
+	}
+	// only the user knows whether the message was exported by PaperCrypt, its plaintext is not guessed at
+	pc.ExternalMessage = !decompressMessage
+
+	return pc, nil
+}
+
+// logPrivateMetadata shows the purpose and comment of a document with private metadata, once it is decrypted.
+func logPrivateMetadata(pc *core.PaperCrypt) {
+	if !pc.PrivateMetadata {
+		return
+	}
+
+	log.WithField("purpose", pc.Purpose).WithField("comment", pc.Comment).Info("Decrypted the private metadata")
+}
+
+// warnOverdue warns about the dates of the document that have passed, when it expired, or was due for review.
+func warnOverdue(pc *core.PaperCrypt) {
+	for _, notice := range pc.Overdue(time.Now()) {
+		log.Warn(core.Warning(notice + "."))
+	}
+}
+
+// warnUnauthenticated points out documents without a header MAC, whose header may have been changed unnoticed.
+// Documents of format version 3 turn into such documents, once their MAC is removed.
+func warnUnauthenticated(pc *core.PaperCrypt) {
+	if pc.HeaderMAC != nil {
+		return
+	}
+
+	log.WithField("format version", pc.ContainerVersion()).Warn(core.Warning("The header of the document is not authenticated, its purpose, dates, and checksums may have been changed. Documents of format version 3 read like this once their MAC is removed, pass 'decode --min-format-version 3' to reject them."))
+}
+
+func deserializeDocument(paperCryptFileContents []byte) (*core.PaperCrypt, error) {
+	// audited even if the document can not be read, or decrypted
+	if headersSection, _, err := core.SplitTextHeaderAndBody(paperCryptFileContents); err == nil {
+		if headers, err := core.TextToHeaderMap(headersSection); err == nil {
+			auditSerialNumber = headers[core.HeaderFieldSerial]
+		}
+	}
+
+	return core.DeserializeText(paperCryptFileContents, ignoreVersionMismatch, ignoreChecksumMismatch || ignoreMismatch)
+}
+
+// prepareDocumentText returns the text of a document to be parsed: as it is with --strict, if it follows the format
+// exactly, or else with the changes picked up when it was edited by hand, or read by OCR, undone.
+func prepareDocumentText(text []byte) ([]byte, error) {
+	if strictParsing {
+		if err := core.ValidateDocumentText(text); err != nil {
+			return nil, errors.Join(errors.New("the document does not follow the format exactly (leave out --strict to tolerate this)"), err)
+		}
+
+		return text, nil
+	}
+
+	return core.NormalizeDocumentText(text), nil
+}
+
+// addStrictFlag adds the --strict flag, rejecting documents that do not follow the format exactly, to a command reading documents.
+func addStrictFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&strictParsing, "strict", false, "Reject documents that do not follow the format exactly, instead of tolerating whitespace, blank lines, reordered header fields, byte order marks, and CRLF line endings")
+}
+
+// readDocumentByOCR reads the text of a document from scanned pages, using Tesseract.
+func readDocumentByOCR(paths []string) ([]byte, error) {
+	paths, err := expandInputs(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	ocr, err := internal.NewTesseractOCR(tesseractPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []image.Image
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading %s", path), err)
+		}
+
+		filePages, err := decodePages(data)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error decoding image %s", path), err)
+		}
+		pages = append(pages, filePages...)
+	}
+
+	log.WithField("pages", len(pages)).Info("Reading the printed text by OCR...")
+	result, err := internal.ReadDocumentByOCR(pages, ocr)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the document by OCR"), err)
+	}
+
+	if len(result.Corrected) > 0 {
+		log.WithField("lines", strings.Join(result.Corrected, ", ")).Info("Corrected characters misread by OCR, confirmed by the checksums")
+	}
+	if !result.HeaderValid {
+		log.Warn(core.Warning("The header could not be read without errors, check it against the printed sheet"))
+	}
+	if len(result.Unreadable) > 0 {
+		log.WithField("lines", strings.Join(result.Unreadable, ", ")).Warn(core.Warning("Lines could not be read by OCR, check them against the printed sheet"))
+	}
+
+	if ocrTextPath != "" {
+		if err := writeOCRText(result.Text); err != nil {
+			return nil, err
+		}
+	} else if len(result.Unreadable) > 0 || !result.HeaderValid {
+		log.Info("Use --ocr-text to write the text read to a file, and correct it by hand")
+	}
+
+	return result.Text, nil
+}
+
+func writeOCRText(text []byte) error {
+	file, err := internal.GetFileHandleCarefully(ocrTextPath, overrideOutFile)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := internal.CloseFileIfNotStd(file)
+		if err != nil {
+			log.WithError(err).Error("Error closing file")
+		}
+	}(file)
+
+	if _, err := file.Write(text); err != nil {
+		return errors.Join(errors.New("error writing the text read by OCR"), err)
+	}
+
+	log.WithField("file", ocrTextPath).Info("Wrote the text read by OCR, correct it if needed, and decode it using -i")
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(decodeCmd)
 
 	decodeCmd.Flags().BoolVar(&ignoreVersionMismatch, "ignore-version-mismatch", false, "Ignore version mismatch and continue anyway")
 	decodeCmd.Flags().BoolVar(&ignoreChecksumMismatch, "ignore-header-checksum-mismatch", false, "Ignore header checksum mismatches and continue anyway")
 
+	decodeCmd.Flags().BoolVar(&ignoreMismatch, "ignore-mismatch", false, "Warn about checksum mismatches of the content or the decrypted data, instead of stopping")
+	decodeCmd.Flags().BoolVar(&decodeWordStream, "words", false, "Read a bare stream of PGP words, without a header")
+	decodeCmd.Flags().StringSliceVar(&ocrScanFiles, "scan", nil, "Read the printed text of scanned pages (images, PDF, or TIFF files, in order) by OCR, instead of the input file, for when the 2D code can not be read")
+	decodeCmd.Flags().StringVar(&ocrTextPath, "ocr-text", "", "Also write the text read by OCR to this file, to be corrected by hand if needed (optional)")
+	decodeCmd.Flags().StringVar(&tesseractPath, "tesseract", "tesseract", "Path of the Tesseract OCR program, used by --scan")
+	decodeCmd.Flags().BoolVar(&decodeInteractive, "interactive", false, "Type in the document on the terminal, checking every line as it is typed")
+	decodeCmd.Flags().IntVar(&minFormatVersion, "min-format-version", 0, "Reject documents of a container format version below this one, such as 3, to only accept documents whose header is authenticated (default: accept all versions)")
+	decodeCmd.Flags().BoolVar(&decompressMessage, "decompress", false, "Decompress the data of a bare OpenPGP message after decrypting it, for messages written by 'generate --export-cipher'")
+	decodeCmd.Flags().BoolVar(&decodePartial, "partial", false, "Decode as much as possible of a document with lost lines, listing the byte ranges lost, instead of failing")
+	addStrictFlag(decodeCmd)
+	decodeCmd.Flags().StringVar(&decodeSessionPath, "session", "", "Save the progress of --interactive to this encrypted file, and resume from it, if it exists (implies --interactive)")
+
 	decodeCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Passphrase to use for encryption (not recommended, will be prompted for if not provided)")
+	addPassphraseSourceFlags(decodeCmd)
 }
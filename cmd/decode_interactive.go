@@ -0,0 +1,631 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"golang.org/x/term"
+)
+
+// entryKey is a key pressed while typing in a document, see readEntryKey.
+type entryKey uint8
+
+const (
+	entryKeyUnknown entryKey = iota
+	entryKeyRune
+	entryKeyUp
+	entryKeyDown
+	entryKeyLeft
+	entryKeyRight
+	entryKeyHome
+	entryKeyEnd
+	entryKeyPageUp
+	entryKeyPageDown
+	entryKeyBackspace
+	entryKeyDelete
+	entryKeyEnter
+	entryKeyTab
+	entryKeyBackTab
+	entryKeyFinish
+	entryKeySave
+	entryKeyRepair
+	entryKeyAbort
+)
+
+// readEntryKey reads a key press from a terminal in raw mode, decoding the escape sequences of special keys.
+func readEntryKey(r *bufio.Reader) (entryKey, rune, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return entryKeyUnknown, 0, err
+	}
+
+	switch c {
+	case 3: // Ctrl+C
+		return entryKeyAbort, 0, nil
+	case 4: // Ctrl+D
+		return entryKeyFinish, 0, nil
+	case 19: // Ctrl+S
+		return entryKeySave, 0, nil
+	case 18: // Ctrl+R
+		return entryKeyRepair, 0, nil
+	case '\t':
+		return entryKeyTab, 0, nil
+	case '\r', '\n':
+		return entryKeyEnter, 0, nil
+	case 8, 127:
+		return entryKeyBackspace, 0, nil
+	case 1: // Ctrl+A
+		return entryKeyHome, 0, nil
+	case 5: // Ctrl+E
+		return entryKeyEnd, 0, nil
+	case 27:
+		return readEntryEscapeSequence(r)
+	}
+
+	if c < ' ' {
+		return entryKeyUnknown, 0, nil
+	}
+	return entryKeyRune, c, nil
+}
+
+// readEntryEscapeSequence reads the rest of an escape sequence (ESC [ or ESC O, a parameter, and a final character).
+func readEntryEscapeSequence(r *bufio.Reader) (entryKey, rune, error) {
+	if r.Buffered() == 0 {
+		// a single escape key press
+		return entryKeyUnknown, 0, nil
+	}
+
+	introducer, _, err := r.ReadRune()
+	if err != nil || introducer != '[' && introducer != 'O' {
+		return entryKeyUnknown, 0, err
+	}
+
+	parameter := ""
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return entryKeyUnknown, 0, err
+		}
+		if c >= '0' && c <= '9' || c == ';' {
+			parameter += string(c)
+			continue
+		}
+
+		switch {
+		case c == 'A':
+			return entryKeyUp, 0, nil
+		case c == 'B':
+			return entryKeyDown, 0, nil
+		case c == 'C':
+			return entryKeyRight, 0, nil
+		case c == 'D':
+			return entryKeyLeft, 0, nil
+		case c == 'H':
+			return entryKeyHome, 0, nil
+		case c == 'F':
+			return entryKeyEnd, 0, nil
+		case c == 'Z':
+			return entryKeyBackTab, 0, nil
+		case c == '~' && (parameter == "1" || parameter == "7"):
+			return entryKeyHome, 0, nil
+		case c == '~' && (parameter == "4" || parameter == "8"):
+			return entryKeyEnd, 0, nil
+		case c == '~' && parameter == "3":
+			return entryKeyDelete, 0, nil
+		case c == '~' && parameter == "5":
+			return entryKeyPageUp, 0, nil
+		case c == '~' && parameter == "6":
+			return entryKeyPageDown, 0, nil
+		default:
+			return entryKeyUnknown, 0, nil
+		}
+	}
+}
+
+var (
+	entryStyleValid     = lipgloss.NewStyle().Foreground(lipgloss.Color("2")).Render
+	entryStyleInvalid   = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true).Render
+	entryStyleHighlight = lipgloss.NewStyle().Foreground(lipgloss.Color("15")).Background(lipgloss.Color("1")).Bold(true).Render
+	entryStyleFaint     = lipgloss.NewStyle().Faint(true).Render
+	entryStyleHeading   = lipgloss.NewStyle().Bold(true).Underline(true).Render
+	entryStyleSelected  = lipgloss.NewStyle().Bold(true).Render
+)
+
+// entryMarkers are shown in front of every line, depending on its status.
+var entryMarkers = map[internal.LineStatus]string{
+	internal.LineStatusEmpty:      entryStyleFaint("·"),
+	internal.LineStatusIncomplete: entryStyleFaint("…"),
+	internal.LineStatusUnverified: "?",
+	internal.LineStatusValid:      entryStyleValid("✓"),
+	internal.LineStatusInvalid:    entryStyleInvalid("✗"),
+}
+
+// entryHelp lists the keys of the interactive entry, entrySessionHelp those of an entry saved to a session file.
+const (
+	entryHelp        = "↑/↓ move · Enter next line · Tab/Shift+Tab next/previous line to fix · Ctrl+R repair · Ctrl+D decode · Ctrl+C abort"
+	entrySessionHelp = "↑/↓ move · Enter next line · Tab/Shift+Tab next/previous line to fix · Ctrl+R repair · Ctrl+D decode · Ctrl+S save · Ctrl+C save and quit"
+	entryRepairHelp  = "↑/↓ choose · Enter or 1-9 apply · any other key cancel"
+)
+
+// entrySessionFile is the encrypted file the progress of `decode --interactive` is saved to, see internal.EntrySession.
+type entrySessionFile struct {
+	path       string
+	passphrase []byte
+}
+
+// load returns the entry saved to the session file, or a new entry, if the file does not exist yet.
+func (f *entrySessionFile) load() (*interactiveEntry, error) {
+	s := &interactiveEntry{entry: internal.NewDataEntry(), session: f}
+	if _, err := os.Stat(f.path); errors.Is(err, os.ErrNotExist) {
+		log.WithField("path", f.path).Info("Starting a new session.")
+		return s, nil
+	}
+
+	session, err := internal.LoadEntrySession(f.path, f.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	s.entry, err = internal.RestoreDataEntry(session)
+	if err != nil {
+		return nil, err
+	}
+	s.line, s.column = session.Line, session.Column
+	s.moveTo(s.line)
+
+	log.WithField("path", f.path).
+		WithField("saved", session.SavedAt.Format(time.RFC1123)).
+		Info("Resuming session.")
+	return s, nil
+}
+
+// save writes the entry to the session file.
+func (f *entrySessionFile) save(s *interactiveEntry) error {
+	return internal.SaveEntrySession(f.path, s.entry.Session(s.line, s.column), f.passphrase)
+}
+
+// interactiveEntry is the state of `decode --interactive`: a document being typed in, and the position of the cursor.
+type interactiveEntry struct {
+	entry *internal.DataEntry
+
+	// line and column are the position of the cursor, column is an index into the value of the line.
+	line, column int
+
+	// top is the first row shown, when the lines do not fit the terminal.
+	top int
+
+	// message is shown above the help, until the next key press.
+	message string
+
+	// finishing is set after Ctrl+D was pressed while lines were missing or invalid, to confirm decoding anyway.
+	finishing bool
+
+	// session is the file progress is saved to, if any, whenever the cursor leaves a line that was changed.
+	session *entrySessionFile
+	changed bool
+
+	// repairs are the corrections of the current line offered after Ctrl+R, until one is applied, or the offer cancelled.
+	repairs  []internal.LineRepair
+	repairAt int
+}
+
+// value returns the value of the current line, as runes.
+func (s *interactiveEntry) value() []rune {
+	return []rune(s.entry.Lines[s.line].Value)
+}
+
+// moveTo moves the cursor to the line, keeping its column if possible.
+func (s *interactiveEntry) moveTo(line int) {
+	s.line = max(0, min(line, len(s.entry.Lines)-1))
+	s.column = min(s.column, len(s.value()))
+}
+
+// needsAttention returns whether the line is still to be typed in, or fixed.
+func (s *interactiveEntry) needsAttention(i int) bool {
+	switch s.entry.Check(i).Status {
+	case internal.LineStatusInvalid, internal.LineStatusIncomplete:
+		return true
+	case internal.LineStatusEmpty:
+		return !s.entry.Lines[i].Header
+	default:
+		return false
+	}
+}
+
+// jump moves the cursor to the next (or previous) line needing attention, wrapping around.
+func (s *interactiveEntry) jump(step int) {
+	n := len(s.entry.Lines)
+	for i := 1; i < n; i++ {
+		line := ((s.line+i*step)%n + n) % n
+		if s.needsAttention(line) {
+			s.line = line
+			s.column = len(s.value())
+			return
+		}
+	}
+
+	s.message = "No line needs attention."
+}
+
+// repair offers the corrections of the current line making it match its checksum, see internal.DataEntry.RepairCandidates.
+func (s *interactiveEntry) repair() {
+	if s.entry.Check(s.line).Status != internal.LineStatusInvalid || s.entry.Lines[s.line].Header {
+		s.message = "Only complete lines of the data block failing their checksum can be repaired."
+		return
+	}
+
+	s.repairs, s.repairAt = s.entry.RepairCandidates(s.line), 0
+	if len(s.repairs) == 0 {
+		s.message = "No single wrong character, or swapped pair of characters, explains the mismatch, check the line again."
+	}
+}
+
+// handleRepair applies a key press while corrections are offered.
+func (s *interactiveEntry) handleRepair(key entryKey, r rune) {
+	choice := -1
+	switch {
+	case key == entryKeyUp:
+		s.repairAt = max(0, s.repairAt-1)
+		return
+	case key == entryKeyDown:
+		s.repairAt = min(len(s.repairs)-1, s.repairAt+1)
+		return
+	case key == entryKeyEnter:
+		choice = s.repairAt
+	case key == entryKeyRune && r >= '1' && r <= '9' && int(r-'1') < len(s.repairs):
+		choice = int(r - '1')
+	}
+
+	if choice >= 0 {
+		repair := s.repairs[choice]
+		s.entry.SetValue(s.line, repair.Value)
+		s.column = repair.Column + 1
+		s.changed = true
+		s.message = fmt.Sprintf("Repaired: %s.", repair.Description)
+	} else {
+		s.message = "Repair cancelled."
+	}
+	s.repairs = nil
+}
+
+// handle applies a key press, and returns true once the document is to be decoded.
+func (s *interactiveEntry) handle(key entryKey, r rune, pageSize int) (bool, error) {
+	s.message = ""
+	if key != entryKeyFinish {
+		s.finishing = false
+	}
+	if s.repairs != nil && key != entryKeyAbort {
+		s.handleRepair(key, r)
+		return false, nil
+	}
+
+	line := s.line
+	value := s.value()
+	switch key {
+	case entryKeyAbort:
+		if s.session != nil {
+			if err := s.session.save(s); err != nil {
+				return false, err
+			}
+
+			return false, fmt.Errorf("aborted, the progress is saved, continue with --session %s", s.session.path)
+		}
+
+		return false, errors.New("aborted")
+	case entryKeySave:
+		if s.session == nil {
+			s.message = "Use --session to save the progress."
+			return false, nil
+		}
+		if err := s.session.save(s); err != nil {
+			return false, err
+		}
+
+		s.changed = false
+		s.message = "Progress saved."
+	case entryKeyFinish:
+		if s.entry.Complete() || s.finishing {
+			if s.session != nil {
+				// the document may still fail to decode, so keep the progress
+				if err := s.session.save(s); err != nil {
+					return false, err
+				}
+			}
+
+			return true, nil
+		}
+		if err := s.entry.StructureError(); err != nil {
+			s.message = err.Error()
+			return false, nil
+		}
+
+		s.finishing = true
+		s.message = "Some lines are missing or invalid, press Ctrl+D again to decode anyway (error correction may reconstruct them)."
+	case entryKeyRune:
+		value = append(value[:s.column], append([]rune{r}, value[s.column:]...)...)
+		s.entry.SetValue(s.line, string(value))
+		s.column++
+		s.changed = true
+	case entryKeyBackspace:
+		if s.column > 0 {
+			s.entry.SetValue(s.line, string(append(value[:s.column-1], value[s.column:]...)))
+			s.column--
+			s.changed = true
+		}
+	case entryKeyDelete:
+		if s.column < len(value) {
+			s.entry.SetValue(s.line, string(append(value[:s.column], value[s.column+1:]...)))
+			s.changed = true
+		}
+	case entryKeyLeft:
+		s.column = max(0, s.column-1)
+	case entryKeyRight:
+		s.column = min(len(value), s.column+1)
+	case entryKeyHome:
+		s.column = 0
+	case entryKeyEnd:
+		s.column = len(value)
+	case entryKeyUp:
+		s.moveTo(s.line - 1)
+	case entryKeyDown:
+		s.moveTo(s.line + 1)
+	case entryKeyPageUp:
+		s.moveTo(s.line - pageSize)
+	case entryKeyPageDown:
+		s.moveTo(s.line + pageSize)
+	case entryKeyEnter:
+		s.moveTo(s.line + 1)
+		s.column = len(s.value())
+	case entryKeyRepair:
+		s.repair()
+	case entryKeyTab:
+		s.jump(1)
+	case entryKeyBackTab:
+		s.jump(-1)
+	}
+
+	// the lines change, as the header is typed in
+	s.moveTo(s.line)
+
+	if s.session != nil && s.changed && s.line != line {
+		if err := s.session.save(s); err != nil {
+			return false, err
+		}
+		s.changed = false
+	}
+
+	return false, nil
+}
+
+// entryRow is a row of the screen: a heading, or a line.
+type entryRow struct {
+	heading string
+	line    int
+}
+
+// rows returns the rows of the screen, the lines of the header and the data block, under headings.
+func (s *interactiveEntry) rows() []entryRow {
+	rows := []entryRow{{heading: "Header"}}
+	for i, line := range s.entry.Lines {
+		if !line.Header && (i == 0 || s.entry.Lines[i-1].Header) {
+			rows = append(rows, entryRow{heading: "Data Block"})
+		}
+		rows = append(rows, entryRow{line: i})
+	}
+
+	return rows
+}
+
+// render returns the screen, and the position of the cursor on it (counted from 0).
+func (s *interactiveEntry) render(width, height int) (string, int, int) {
+	labelWidth := 0
+	for _, line := range s.entry.Lines {
+		labelWidth = max(labelWidth, len(line.Label))
+	}
+	prefixWidth := labelWidth + 4 // marker, space, label, colon, space
+
+	rows := s.rows()
+	visible := max(1, height-3-len(s.repairs))
+	cursorRow := 0
+	for i, row := range rows {
+		if row.heading == "" && row.line == s.line {
+			cursorRow = i
+		}
+	}
+	if cursorRow < s.top {
+		s.top = cursorRow
+	}
+	if cursorRow >= s.top+visible {
+		s.top = cursorRow - visible + 1
+	}
+	// show the heading above the first line
+	if s.top == 1 {
+		s.top = 0
+	}
+
+	var screen strings.Builder
+	cursorX, cursorY := 0, 0
+	for i := s.top; i < min(len(rows), s.top+visible); i++ {
+		row := rows[i]
+		if row.heading != "" {
+			screen.WriteString(entryStyleHeading(row.heading) + "\r\n")
+			continue
+		}
+
+		line := s.entry.Lines[row.line]
+		check := s.entry.Check(row.line)
+		value := []rune(line.Value)
+		template := []rune(line.Template)
+		if line.Optional && len(value) == 0 {
+			template = []rune("(if printed)")
+		}
+
+		// scroll the current line horizontally, if it is too long
+		space := max(1, width-prefixWidth-1)
+		offset := 0
+		if row.line == s.line && s.column >= space {
+			offset = s.column - space + 1
+		}
+
+		var text strings.Builder
+		for x := offset; x < offset+space; x++ {
+			switch {
+			case x < len(value) && x == check.Column:
+				text.WriteString(entryStyleHighlight(string(value[x])))
+			case x < len(value):
+				text.WriteRune(value[x])
+			case x < len(template):
+				text.WriteString(entryStyleFaint(string(template[x])))
+			}
+		}
+
+		label := fmt.Sprintf("%*s", labelWidth, line.Label)
+		if row.line == s.line {
+			label = entryStyleSelected(label)
+			cursorX, cursorY = prefixWidth+s.column-offset, i-s.top
+		}
+		screen.WriteString(fmt.Sprintf("%s %s: %s\r\n", entryMarkers[check.Status], label, text.String()))
+	}
+	for i := min(len(rows), s.top+visible) - s.top; i < visible; i++ {
+		screen.WriteString("\r\n")
+	}
+
+	message := s.message
+	if message == "" && s.repairs != nil {
+		message = fmt.Sprintf("%d corrections make line %s match its checksum, the most likely first:", len(s.repairs), s.entry.Lines[s.line].Label)
+		if len(s.repairs) == 1 {
+			message = fmt.Sprintf("A single correction makes line %s match its checksum:", s.entry.Lines[s.line].Label)
+		}
+	}
+	if message == "" {
+		check := s.entry.Check(s.line)
+		message = check.Message
+		if check.Status == internal.LineStatusInvalid && !s.entry.Lines[s.line].Header {
+			message += " (Ctrl+R to repair)"
+		}
+	}
+	if message == "" && s.entry.Lines[s.line].Header {
+		if err := s.entry.StructureError(); err != nil {
+			message = err.Error()
+		}
+	}
+	if message == "" && s.entry.Complete() {
+		message = "All lines are valid, press Ctrl+D to decode."
+	}
+	screen.WriteString(truncate(message, width) + "\r\n")
+	for i, repair := range s.repairs {
+		row := fmt.Sprintf("%d. %-40s %s", i+1, repair.Description, repair.Value)
+		if i == s.repairAt {
+			row = entryStyleSelected("› " + truncate(row, width-2))
+		} else {
+			row = "  " + truncate(row, width-2)
+		}
+		screen.WriteString(row + "\r\n")
+	}
+	help := entryHelp
+	if s.session != nil {
+		help = entrySessionHelp
+	}
+	if s.repairs != nil {
+		help = entryRepairHelp
+	}
+	screen.WriteString(entryStyleFaint(truncate(help, width)))
+
+	return screen.String(), cursorX, cursorY
+}
+
+// truncate shortens s to width runes.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:max(0, width-1)]) + "…"
+	}
+
+	return s
+}
+
+// readDocumentInteractively lets the user type in a document, checking every line as it is typed,
+// on the terminal of stdin and stderr (stdout may be the output file).
+// If session is not nil, the progress is saved to it, and resumed from it.
+func readDocumentInteractively(session *entrySessionFile) ([]byte, error) {
+	if err := internal.RequireInteraction("the document, typed in with --interactive"); err != nil {
+		return nil, err
+	}
+	in, out := int(os.Stdin.Fd()), int(os.Stderr.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return nil, errors.New("--interactive requires a terminal")
+	}
+
+	s := &interactiveEntry{entry: internal.NewDataEntry()}
+	if session != nil {
+		var err error
+		s, err = session.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return nil, errors.Join(errors.New("error switching the terminal to raw mode"), err)
+	}
+	// use the alternate screen, so the terminal is left as it was
+	fmt.Fprint(os.Stderr, "\x1b[?1049h")
+	defer func() {
+		fmt.Fprint(os.Stderr, "\x1b[?1049l")
+		_ = term.Restore(in, state)
+	}()
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		width, height, err := term.GetSize(out)
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		screen, x, y := s.render(width, height)
+		fmt.Fprintf(os.Stderr, "\x1b[H\x1b[2J%s\x1b[%d;%dH", screen, y+1, x+1)
+
+		key, r, err := readEntryKey(reader)
+		if err == io.EOF {
+			key = entryKeyFinish
+		} else if err != nil {
+			return nil, errors.Join(errors.New("error reading from terminal"), err)
+		}
+
+		done, err := s.handle(key, r, max(1, height-4))
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return s.entry.Text(), nil
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+)
+
+// keystrokes returns the keys typed to enter the document, field by field, and line by line.
+func keystrokes(document string) string {
+	header, data, _ := strings.Cut(document, "\n\n\n")
+	values := make(map[string]string)
+	for _, line := range strings.Split(header, "\n") {
+		name, value, _ := strings.Cut(strings.TrimPrefix(line, "# "), ": ")
+		values[name] = value
+	}
+
+	var keys strings.Builder
+	for _, line := range internal.NewDataEntry().Lines {
+		keys.WriteString(values[line.Label] + "\r")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		_, value, _ := strings.Cut(line, ": ")
+		keys.WriteString(value + "\r")
+	}
+
+	return keys.String()
+}
+
+func TestReadEntryKey(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("a\x1b[A\x1b[3~\x1bOF\x1b[Z\r\x7f\x04"))
+	want := []entryKey{entryKeyRune, entryKeyUp, entryKeyDelete, entryKeyEnd, entryKeyBackTab, entryKeyEnter, entryKeyBackspace, entryKeyFinish}
+	for _, w := range want {
+		key, _, err := readEntryKey(reader)
+		if err != nil {
+			t.Fatalf("readEntryKey failed with error %s", err)
+		}
+		if key != w {
+			t.Errorf("Key was incorrect, got: %d, want: %d.", key, w)
+		}
+	}
+}
+
+func TestInteractiveEntry(t *testing.T) {
+	for name, document := range map[string]string{"v1": docV1, "v2": doc} {
+		t.Run(name, func(t *testing.T) {
+			// line 2 is typed with a mistake, and fixed after jumping back to it
+			value := strings.Split(strings.SplitN(document, "\n\n\n", 2)[1], "\n")[1][4:]
+			typed := strings.Replace(document, value, "0"+value[1:], 1)
+			if value[0] == '0' {
+				typed = strings.Replace(document, value, "1"+value[1:], 1)
+			}
+			keys := keystrokes(typed) + "\x04\t\x1b[H\x1b[3~" + value[:1] + "\x04"
+
+			s := &interactiveEntry{entry: internal.NewDataEntry()}
+			reader := bufio.NewReader(strings.NewReader(keys))
+			for {
+				key, r, err := readEntryKey(reader)
+				if err != nil {
+					t.Fatalf("the entry was not finished: %s", s.message)
+				}
+
+				_, _, _ = s.render(120, 40)
+				done, err := s.handle(key, r, 10)
+				if err != nil {
+					t.Fatalf("handle failed with error %s", err)
+				}
+				if done {
+					break
+				}
+			}
+
+			pc, err := deserializeDocument(s.entry.Text())
+			if err != nil {
+				t.Fatalf("deserializeDocument failed with error %s", err)
+			}
+			out, err := pc.Decode([]byte("example"))
+			if err != nil {
+				t.Fatalf("Decode failed with error %s", err)
+			}
+			if string(out) != input {
+				t.Errorf("Decoding was incorrect, got: %s, want: %s.", out, input)
+			}
+		})
+	}
+}
+
+func TestInteractiveEntrySession(t *testing.T) {
+	session := &entrySessionFile{path: filepath.Join(t.TempDir(), "transcription.session"), passphrase: []byte("session")}
+	keys := keystrokes(doc)
+	half := len(keys) / 2
+
+	// type half of the document, and quit
+	s, err := session.load()
+	if err != nil {
+		t.Fatalf("load failed with error %s", err)
+	}
+	reader := bufio.NewReader(strings.NewReader(keys[:half] + "\x03"))
+	for {
+		key, r, err := readEntryKey(reader)
+		if err != nil {
+			t.Fatalf("the entry was not aborted")
+		}
+		if _, err := s.handle(key, r, 10); err != nil {
+			break
+		}
+	}
+
+	// resume, and type the rest
+	s, err = session.load()
+	if err != nil {
+		t.Fatalf("load failed with error %s", err)
+	}
+	reader = bufio.NewReader(strings.NewReader(keys[half:] + "\x04"))
+	for {
+		key, r, err := readEntryKey(reader)
+		if err != nil {
+			t.Fatalf("the entry was not finished")
+		}
+		done, err := s.handle(key, r, 10)
+		if err != nil {
+			t.Fatalf("handle failed with error %s", err)
+		}
+		if done {
+			break
+		}
+	}
+
+	if !s.entry.Complete() {
+		t.Errorf("the resumed entry should be complete")
+	}
+}
+
+func TestInteractiveEntryRepair(t *testing.T) {
+	// line 2 is typed with two characters swapped, and repaired after jumping back to it
+	value := strings.Split(strings.SplitN(doc, "\n\n\n", 2)[1], "\n")[1][4:]
+	swapped := value[1:2] + value[:1] + value[2:]
+	if swapped == value {
+		t.Fatalf("the first two characters of line 2 must differ")
+	}
+	keys := keystrokes(strings.Replace(doc, value, swapped, 1)) + "\t\x12\r\x04"
+
+	s := &interactiveEntry{entry: internal.NewDataEntry()}
+	reader := bufio.NewReader(strings.NewReader(keys))
+	for {
+		key, r, err := readEntryKey(reader)
+		if err != nil {
+			t.Fatalf("the entry was not finished: %s", s.message)
+		}
+
+		done, err := s.handle(key, r, 10)
+		if err != nil {
+			t.Fatalf("handle failed with error %s", err)
+		}
+		if done {
+			break
+		}
+		if s.repairs != nil {
+			if screen, _, _ := s.render(120, 40); !strings.Contains(screen, "1. ") {
+				t.Errorf("the corrections should be listed")
+			}
+		}
+	}
+
+	if !s.entry.Complete() {
+		t.Errorf("the repaired entry should be complete")
+	}
+}
@@ -21,10 +21,16 @@
 package cmd
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/caarlos0/log"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 const input = `{
@@ -190,6 +196,115 @@ func TestDecodeV2(t *testing.T) {
 	}
 }
 
+func TestDecodeOverwrite(t *testing.T) {
+	tempDir := t.TempDir()
+	inPath := tempDir + "/input.txt"
+	outPath := tempDir + "/output.json"
+
+	if err := os.WriteFile(inPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outPath, []byte("existing"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { overrideOutFile = false }()
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"decode", "-i", inPath, "-o", outPath, "-P", "example"})
+	if err := cmd.Execute(); core.CategoryOf(err) != core.ErrorCategoryFileExists {
+		t.Fatalf("Expected the existing output file to be kept, got %v", err)
+	}
+
+	// -f is the persistent flag of the root command, it is not hidden by the flags of decode
+	cmd.SetArgs([]string{"decode", "-f", "-i", inPath, "-o", outPath, "-P", "example"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != input {
+		t.Fatalf("Expected %s, got %s", input, string(out))
+	}
+}
+
+func TestDecodePGPMessage(t *testing.T) {
+	// a gzip compressed plaintext, such as a .tar.gz file encrypted using gpg, or the data of 'generate --export-cipher'
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	if _, err := gzipWriter.Write([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(compressed.Bytes()), []byte("example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := encrypted.GetArmored()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	messagePath := filepath.Join(tempDir, "message.asc")
+	if err := os.WriteFile(messagePath, []byte(armored), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { decompressMessage = false }()
+
+	for name, tc := range map[string]struct {
+		args []string
+		want []byte
+	}{
+		"as gpg returns it": {want: compressed.Bytes()},
+		"decompressed":      {args: []string{"--decompress"}, want: []byte(input)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			decompressMessage = false
+			outPath := filepath.Join(t.TempDir(), "output")
+			cmd := rootCmd
+			cmd.SetArgs(append([]string{"decode", "-i", messagePath, "-o", outPath, "-P", "example"}, tc.args...))
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, tc.want) {
+				t.Fatalf("Expected %x, got %x", tc.want, out)
+			}
+		})
+	}
+}
+
+func TestDecodeMinFormatVersion(t *testing.T) {
+	tempDir := t.TempDir()
+	inPath := tempDir + "/input.txt"
+	outPath := tempDir + "/output.json"
+
+	if err := os.WriteFile(inPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"decode", "-i", inPath, "-o", outPath, "-P", "example", "--min-format-version", "3"})
+	defer func() { minFormatVersion = 0 }()
+
+	err := cmd.Execute()
+	if err == nil {
+		t.Fatal("Expected the format version 2 document to be rejected")
+	}
+	if core.CategoryOf(err) != core.ErrorCategoryVersion {
+		t.Fatalf("Expected a version error, got %s", err)
+	}
+}
+
 func TestDecodeV2Raw(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 
@@ -217,3 +332,149 @@ func TestDecodeV2Raw(t *testing.T) {
 		t.Fatalf("Expected %s, got %s", input, string(out))
 	}
 }
+
+func TestDecodeWordStream(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	tempDir := t.TempDir()
+	inPath := tempDir + "/input.txt"
+	outPath := tempDir + "/output.json"
+
+	pc, err := core.DeserializeV2Text([]byte(docRaw), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"decode", "-v", "--words", "-i", inPath, "-o", outPath, "-P", "example"})
+	t.Cleanup(func() { decodeWordStream = false })
+
+	if err := os.WriteFile(inPath, []byte(core.EncodeWordStream(pc.DataFormat, pc.Data)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != input {
+		t.Fatalf("Expected %s, got %s", input, string(out))
+	}
+}
+
+func TestDecodePlaintextHash(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	pc, err := core.DeserializeV2Text([]byte(docRaw), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { ignoreMismatch = false })
+
+	for name, tc := range map[string]struct {
+		plaintext string
+		ignore    bool
+		wantError bool
+	}{
+		"matching":         {plaintext: input},
+		"mismatch":         {plaintext: "something else", wantError: true},
+		"mismatch ignored": {plaintext: "something else", ignore: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			inPath := tempDir + "/input.txt"
+			outPath := tempDir + "/output.json"
+
+			plaintextSHA256 := sha256.Sum256([]byte(tc.plaintext))
+			pc.PlaintextSHA256 = plaintextSHA256[:]
+			text, err := pc.GetText(core.EncodingOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(inPath, text, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			args := []string{"decode", "-v", "-i", inPath, "-o", outPath, "-P", "example"}
+			if tc.ignore {
+				args = append(args, "--ignore-mismatch")
+			}
+
+			cmd := rootCmd
+			cmd.SetArgs(args)
+			ignoreMismatch = false
+
+			err = cmd.Execute()
+			if tc.wantError {
+				if err == nil {
+					t.Fatal("Expected decoding to fail with a plaintext checksum mismatch")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(out) != input {
+				t.Fatalf("Expected %s, got %s", input, string(out))
+			}
+		})
+	}
+}
+
+func TestDecodePDF(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "input.json")
+	if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the attached document is read, or else the printed text, or else the 2D code on the rendered page,
+	// the words encoding can not be read from the text
+	for name, args := range map[string][]string{
+		"attachment": nil,
+		"text":       {"--pdfa", "--no-qr"},
+		"code":       {"--no-attachment", "--encoding", "words"},
+		"color code": {"--no-attachment", "--encoding", "words", "--code-type", "color"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pdfPath := filepath.Join(t.TempDir(), "document.pdf")
+			outPath := filepath.Join(t.TempDir(), "output.json")
+
+			cmd := rootCmd
+			cmd.SetArgs(append([]string{"generate", "-i", inPath, "-o", pdfPath, "-P", "example"}, args...))
+			defer func() { noAttachment, codeType, dataEncoding, pdfa, noQR = false, "aztec", "base16", false, false }()
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd.SetArgs([]string{"decode", "-i", pdfPath, "-o", outPath, "-P", "example"})
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != input {
+				t.Fatalf("Expected %s, got %s", input, string(out))
+			}
+		})
+	}
+}
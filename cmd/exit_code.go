@@ -0,0 +1,120 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// exitCode is the status PaperCrypt exits with, distinct for the failures a script may want to handle.
+// The codes are stable, new ones are only ever appended.
+type exitCode uint8
+
+const (
+	exitOK exitCode = iota
+	// exitError is any failure not listed below.
+	exitError
+	// exitUsage is an unknown or invalid flag.
+	exitUsage
+	// exitInteractionRequired is input to be prompted for, with --non-interactive.
+	exitInteractionRequired
+	// exitFileExists is an output file that exists, without --force.
+	exitFileExists
+	// exitDecryption is data that can not be decrypted, mostly with an incorrect passphrase.
+	exitDecryption
+	// exitChecksum is a document, or data, not matching its checksums.
+	exitChecksum
+	// exitUnreadableCode is an image, or a PDF, in which no 2D code can be read.
+	exitUnreadableCode
+	// exitVersion is a document of an unknown, or unsupported, version of PaperCrypt.
+	exitVersion
+	// exitIO is a file that can not be opened, read, or written.
+	exitIO
+)
+
+func (c exitCode) String() string {
+	switch c {
+	case exitOK:
+		return "ok"
+	case exitError:
+		return "error"
+	case exitUsage:
+		return "usage"
+	case exitInteractionRequired:
+		return "interaction required"
+	case exitFileExists:
+		return "file exists"
+	case exitDecryption:
+		return "decryption failed"
+	case exitChecksum:
+		return "checksum mismatch"
+	case exitUnreadableCode:
+		return "unreadable 2D code"
+	case exitVersion:
+		return "unsupported version"
+	case exitIO:
+		return "I/O error"
+	default:
+		return "unknown"
+	}
+}
+
+// categoryExitCodes are the exit codes of the categories of errors, see core.ErrorCategory.
+var categoryExitCodes = map[core.ErrorCategory]exitCode{
+	core.ErrorCategoryOther:          exitError,
+	core.ErrorCategoryInteraction:    exitInteractionRequired,
+	core.ErrorCategoryFileExists:     exitFileExists,
+	core.ErrorCategoryPassphrase:     exitDecryption,
+	core.ErrorCategoryChecksum:       exitChecksum,
+	core.ErrorCategoryUnreadableCode: exitUnreadableCode,
+	core.ErrorCategoryVersion:        exitVersion,
+	core.ErrorCategoryIO:             exitIO,
+}
+
+// usageError marks an error in the use of a command, such as an invalid flag.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// exitCodeOf returns the exit code for the error returned by a command.
+func exitCodeOf(err error) exitCode {
+	if err == nil {
+		return exitOK
+	}
+	if errors.As(err, &usageError{}) {
+		return exitUsage
+	}
+	if code, ok := categoryExitCodes[core.CategoryOf(err)]; ok {
+		return code
+	}
+
+	return exitError
+}
@@ -0,0 +1,103 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+)
+
+func TestExitCode(t *testing.T) {
+	t.Setenv(passphraseEnv, "")
+	os.Unsetenv(passphraseEnv)
+	defer func() {
+		internal.NonInteractive = false
+		qrCmdNoPreprocess = false
+		decodeCmd.Flags().Lookup("passphrase").Changed = false
+	}()
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "input.txt")
+	if err := os.WriteFile(inPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	damagedPath := filepath.Join(tempDir, "damaged.txt")
+	if err := os.WriteFile(damagedPath, []byte(strings.Replace(doc, "Header CRC-32: ecded03b", "Header CRC-32: ecded03c", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	futurePath := filepath.Join(tempDir, "future.txt")
+	if err := os.WriteFile(futurePath, []byte(strings.Replace(doc, "Version: 2.0.0", "Version: 9.0.0", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	blankPath := filepath.Join(tempDir, "blank.png")
+	blank := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range blank.Pix {
+		blank.Pix[i] = 0xff
+	}
+	blankFile, err := os.Create(blankPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(blankFile, blank); err != nil {
+		t.Fatal(err)
+	}
+	blankFile.Close()
+	existingPath := filepath.Join(tempDir, "existing.json")
+	if err := os.WriteFile(existingPath, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want exitCode
+	}{
+		{"non-interactive", []string{"decode", "-i", inPath, "-o", filepath.Join(tempDir, "out1.json"), "--non-interactive"}, exitInteractionRequired},
+		{"yes", []string{"decode", "-i", inPath, "-o", filepath.Join(tempDir, "out2.json"), "--yes"}, exitInteractionRequired},
+		{"existing file", []string{"decode", "-i", inPath, "-o", existingPath, "-P", "example"}, exitFileExists},
+		{"wrong passphrase", []string{"decode", "-i", inPath, "-o", filepath.Join(tempDir, "out3.json"), "-P", "wrong"}, exitDecryption},
+		{"invalid flag", []string{"decode", "--no-such-flag"}, exitUsage},
+		{"checksum mismatch", []string{"decode", "-i", damagedPath, "-o", filepath.Join(tempDir, "out5.json"), "-P", "example"}, exitChecksum},
+		{"unsupported version", []string{"decode", "-i", futurePath, "-o", filepath.Join(tempDir, "out6.json"), "-P", "example"}, exitVersion},
+		{"unreadable code", []string{"scan", blankPath, "--no-preprocess", "-o", filepath.Join(tempDir, "out7.txt")}, exitUnreadableCode},
+		{"missing input", []string{"decode", "-i", filepath.Join(tempDir, "missing.txt"), "-o", filepath.Join(tempDir, "out8.json"), "-P", "example"}, exitIO},
+		{"ok", []string{"decode", "-i", inPath, "-o", filepath.Join(tempDir, "out4.json"), "-P", "example"}, exitOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			internal.NonInteractive = false
+			decodeCmd.Flags().Lookup("passphrase").Changed = false
+
+			cmd := rootCmd
+			cmd.SetArgs(test.args)
+			got := exitCodeOf(cmd.Execute())
+			if got != test.want {
+				t.Fatalf("Expected exit code %d (%s), got %d (%s)", test.want, test.want, got, got)
+			}
+		})
+	}
+}
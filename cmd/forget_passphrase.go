@@ -0,0 +1,53 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+)
+
+var forgetPassphraseCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "forget-passphrase",
+	Short:        "Remove the passphrase cached in the keychain with --cache-passphrase",
+	Long: `This command removes the passphrase cached in the keychain of the operating system (see '--cache-passphrase'),
+before it expires, such as when a batch of documents is done.
+Once expired, it is removed by the next command run, whichever it is.`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cache, err := internal.NewPassphraseCache()
+		if err != nil {
+			return err
+		}
+		if err := cache.Forget(passphraseCacheName); err != nil {
+			return err
+		}
+
+		log.Info("Removed the cached passphrase from the keychain")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(forgetPassphraseCmd)
+}
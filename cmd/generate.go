@@ -21,33 +21,91 @@
 package cmd
 
 import (
-	"bytes"
-	"compress/gzip"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"image"
+	"io"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/caarlos0/log"
 	"github.com/spf13/cobra"
 	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 var (
-	serialNumber string
-	purpose      string
-	comment      string
-	date         string
+	serialNumber       string
+	serialTemplateText string
+	serialCharset      string
+	serialLength       int
+	serialCounterPath  string
+	purpose            string
+	comment            string
+	date               string
+	timezone           string
+	expires            string
+	reviewBy           string
 )
 
 var (
 	noQR             bool
 	lowerCasedBase16 bool
 	rawData          bool
+	privateMetadata  bool
+	noCatalog        bool
+	dataEncoding     string
+	plaintextHash    bool
+	qrPayload        string
+	codeType         string
+	outputProfile    string
+	qrEC             string
+	qrMaxVersion     int
+	qrModuleSize     string
+	qrDPI            int
+	noFiducials      bool
+	paperSize        string
+	landscape        bool
+	templatePath     string
+	dataFontPath     string
+	dataFontSize     float64
+	watermark        string
+	banner           string
+	instructions     bool
+	pdfa             bool
+	noAttachment     bool
+	outputFormat     string
+	rendererName     string
+	languageCode     string
+	rasterDPI        float64
+	duplex           string
+	generateDryRun   bool
+	formatVersion    int
+)
+
+var (
+	layoutGroupSize     int
+	layoutColumns       int
+	layoutBlockLines    int
+	layoutNoLineIndices bool
+	layoutColumnIndices bool
+	lineChecksum        string
+	eccLevel            int
 )
 
 var passphrase string
 
+// pgpMessagePath is the OpenPGP message given with --from-pgp, which is wrapped in the document as it is.
+var pgpMessagePath string
+
+// exportCipherPath is the file the bare OpenPGP message of the document is written to, with --export-cipher.
+var exportCipherPath string
+
+// presetInput is the data to generate the document from, in place of the input file, while 'key backup' runs generate.
+var presetInput []byte
+
 // generateCmd represents the generate command.
 var generateCmd = &cobra.Command{
 	Aliases:      []string{"gen", "g"},
@@ -60,11 +118,269 @@ newly created PDF file that you can print for physical storage.
 
 Please note, to decrypt the data from the output PaperCrypt PDF, you'll need the original passphrase used during the 
 encryption process. Treat this passphrase with care; loss of the passphrase could result in the permanent loss of the 
-encrypted data.`,
-	Example: "papercrypt generate -i <file>.json -o <file>.pdf --purpose \"My secret data\" --comment \"This is a comment\" --date \"2021-01-01 12:00:00\"",
+encrypted data.
+
+With --dry-run, the document is laid out, encrypted with a random passphrase, without asking for one, and not written.
+Instead, the number of pages, data lines, and 2D codes (with their versions and error correction) is printed,
+with an estimate of how hard the codes are to scan, to tune the options before generating the document.
+
+With --from-pgp, the document holds an OpenPGP message encrypted beforehand, using gpg, or any other OpenPGP software,
+with parameters of your own choosing: PaperCrypt never sees the plaintext, or the passphrase, and only adds the header,
+checksums, layout, and 2D code. Decode the document with 'papercrypt decode', or with gpg, using the key the message
+is encrypted to.`,
+	Example: "papercrypt generate -i <file>.json -o <file>.pdf --purpose \"My secret data\" --comment \"This is a comment\" --date \"2021-01-01T12:00:00+01:00\"",
 	RunE: func(cmd *cobra.Command, _ []string) error {
-		// 1. Open output file
-		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if vaultFormatName != "" {
+			return generateFromVault(cmd)
+		}
+
+		return generateDocument(cmd)
+	},
+}
+
+// generateDocument generates a document from the input file, or presetInput, as set by the flags of generate.
+func generateDocument(cmd *cobra.Command) error {
+	if exportCipherPath == "-" {
+		return errors.New("--export-cipher needs a file name, the message is not written to the standard output")
+	}
+	if pgpMessagePath != "" && (inFileName != "" || presetInput != nil) {
+		return errors.New("--from-pgp names the input already, it can not be combined with --in, or another input")
+	}
+	version := core.PaperCryptContainerVersionMajor3
+	if formatVersion == 0 && (pgpMessagePath != "" || rawData) {
+		// there is no passphrase to key the header MAC by
+		version = core.PaperCryptContainerVersionMajor2
+	} else if formatVersion != 0 {
+		var err error
+		version, err = parseFormatVersionFlag(formatVersion)
+		if err != nil {
+			return err
+		}
+	}
+	if version == core.PaperCryptContainerVersionMajor3 && (pgpMessagePath != "" || rawData) {
+		return errors.New("--format-version 3 keys the header MAC by the passphrase, it can not be combined with --from-pgp, or --raw")
+	}
+
+	encoding := core.PaperCryptDataEncodingFromString(dataEncoding)
+	if encoding == core.PaperCryptDataEncodingUnknown {
+		return fmt.Errorf("unknown data encoding '%s', must be one of: base16, base32, base64, armor, words", dataEncoding)
+	}
+
+	paper := core.PaperSizeFromString(paperSize)
+	if paper == core.PaperSizeUnknown {
+		return fmt.Errorf("unknown paper size '%s', must be one of: a4, letter, a5, legal", paperSize)
+	}
+	page := core.Page{Paper: paper, Landscape: landscape}
+
+	code2D := core.Code2DTypeFromString(codeType)
+	if code2D == core.Code2DTypeUnknown {
+		return fmt.Errorf("unknown 2D code type '%s', must be one of: aztec, qr, color", codeType)
+	}
+	if code2D == core.Code2DTypeColor {
+		log.Warn(core.Warning("The color code is experimental, it needs a color printer, and 'papercrypt scan --color' to be read. Keep the text representation as a fallback."))
+	}
+	code2DOptions := core.Code2DOptions{
+		Type:              code2D,
+		QRErrorCorrection: core.QRErrorCorrectionFromString(qrEC),
+		QRMaxVersion:      qrMaxVersion,
+		DPI:               qrDPI,
+		PrintArea:         page.Code2DPrintSize(),
+	}
+	if qrModuleSize != "" {
+		moduleSize, err := core.ParseModuleSize(qrModuleSize, qrDPI)
+		if err != nil {
+			return err
+		}
+		if moduleSize < core.MinScannableModuleSize {
+			log.Warn(core.Warning(fmt.Sprintf("Modules of %.2f mm may be too small for phone cameras, consider at least %.1f mm", moduleSize, core.MinScannableModuleSize)))
+		}
+		code2DOptions.ModuleSize = moduleSize
+	}
+	if err := code2DOptions.Validate(); err != nil {
+		return errors.Join(errors.New("invalid 2D code options"), err)
+	}
+	if code2D == core.Code2DTypeAztec && (cmd.Flags().Lookup("qr-ec").Changed || cmd.Flags().Lookup("qr-version").Changed) {
+		return errors.New("--qr-ec and --qr-version require --code-type qr or color")
+	}
+
+	if code2D != core.Code2DTypeAztec && !cmd.Flags().Lookup("qr-payload").Changed {
+		// store the raw ciphertext bytes in the code's byte mode, instead of base64 text
+		qrPayload = "cbor"
+	}
+	payloadFormat := core.QRPayloadFormatFromString(qrPayload)
+	if payloadFormat == core.QRPayloadFormatUnknown {
+		return fmt.Errorf("unknown 2D code payload format '%s', must be one of: json, cbor", qrPayload)
+	}
+
+	layout := core.DataLayout{
+		GroupSize:     layoutGroupSize,
+		Columns:       layoutColumns,
+		BlockLines:    layoutBlockLines,
+		LineIndices:   !layoutNoLineIndices,
+		ColumnIndices: layoutColumnIndices,
+	}
+	if !cmd.Flags().Lookup("columns").Changed {
+		// keep lines at about the default width, adjusted to the width of the page
+		layout.Columns = max(core.BytesPerLine/layout.GroupSize, 1)
+		if encoding != core.PaperCryptDataEncodingArmor && encoding != core.PaperCryptDataEncodingWords {
+			layout = page.FitDataLayout(layout)
+			if dataFontSize > internal.PdfDataLineFontSize {
+				// larger type needs shorter lines
+				layout.Columns = max(int(float64(layout.Columns)*internal.PdfDataLineFontSize/dataFontSize), 1)
+			}
+		}
+	}
+	if err := layout.Validate(); err != nil {
+		return errors.Join(errors.New("invalid data layout"), err)
+	}
+	checksum := core.LineChecksumFromString(lineChecksum)
+	if checksum == core.LineChecksumUnknown {
+		return fmt.Errorf("unknown line checksum '%s', must be one of: crc24, crc32, sha256", lineChecksum)
+	}
+	if encoding == core.PaperCryptDataEncodingArmor || encoding == core.PaperCryptDataEncodingWords {
+		if layout != core.DefaultDataLayout {
+			return fmt.Errorf("the data layout can not be changed for the %s encoding", encoding)
+		}
+		if checksum != core.LineChecksumCRC24 {
+			return fmt.Errorf("the line checksum can not be changed for the %s encoding", encoding)
+		}
+		if eccLevel != 0 {
+			return fmt.Errorf("error correction is not supported for the %s encoding", encoding)
+		}
+	}
+	if eccLevel != 0 {
+		if eccLevel < 0 || eccLevel > 100 {
+			return fmt.Errorf("invalid error correction level %d, must be between 0 and 100 percent", eccLevel)
+		}
+		if !layout.LineIndices {
+			return errors.New("error correction requires line numbers, it can not be used with --no-line-indices")
+		}
+	}
+
+	duplexMode := internal.DuplexFromString(duplex)
+	if duplexMode == internal.DuplexUnknown {
+		return fmt.Errorf("unknown duplex mode '%s', must be one of: long-edge, short-edge", duplex)
+	}
+
+	language, err := internal.LoadLanguage(languageCode)
+	if err != nil {
+		return err
+	}
+
+	opts := internal.TextOptions{
+		LowerCase:            lowerCasedBase16,
+		Encoding:             encoding,
+		Layout:               layout,
+		LineChecksum:         checksum,
+		ErrorCorrectionLevel: eccLevel,
+		QRPayload:            payloadFormat,
+		Code2D:               code2DOptions,
+		NoFiducials:          noFiducials,
+		Page:                 page,
+		Watermark:            watermark,
+		Banner:               banner,
+		Instructions:         instructions,
+		PDFA:                 pdfa,
+		Duplex:               duplexMode,
+		NoAttachment:         noAttachment,
+		Language:             language,
+	}
+	if cmd.Flags().Lookup("font-size").Changed {
+		if dataFontSize < internal.MinDataFontSize || dataFontSize > internal.MaxDataFontSize {
+			return fmt.Errorf("invalid font size %.1f, must be between %.0f and %.0f pt", dataFontSize, internal.MinDataFontSize, internal.MaxDataFontSize)
+		}
+		opts.DataFontSize = dataFontSize
+	}
+	if dataFontPath != "" {
+		font, err := internal.LoadTrueTypeFont(dataFontPath)
+		if err != nil {
+			return err
+		}
+		opts.DataFont = font
+	}
+	if templatePath != "" {
+		template, err := internal.LoadPDFTemplate(templatePath)
+		if err != nil {
+			return err
+		}
+		opts.Template = template
+	}
+
+	profile := internal.OutputProfileFromString(outputProfile)
+	if profile == internal.OutputProfileUnknown {
+		return fmt.Errorf("unknown output profile '%s', must be one of: default, stamping, wallet", outputProfile)
+	}
+	if profile != internal.OutputProfileDefault {
+		for _, flag := range []string{"encoding", "group", "columns", "block-lines", "no-line-indices", "column-indices"} {
+			if cmd.Flags().Lookup(flag).Changed {
+				return fmt.Errorf("--%s can not be combined with the %s profile", flag, profile)
+			}
+		}
+	}
+	if profile == internal.OutputProfileWallet {
+		// the card holds a single QR code of fixed size, and a few lines of text
+		for _, flag := range []string{"no-qr", "code-type", "qr-ec", "qr-version", "qr-module-size", "qr-payload", "template", "watermark", "banner", "instructions", "font", "font-size", "duplex"} {
+			if cmd.Flags().Lookup(flag).Changed {
+				return fmt.Errorf("--%s can not be combined with the %s profile", flag, profile)
+			}
+		}
+	}
+	opts, err = profile.Apply(opts)
+	if err != nil {
+		return err
+	}
+
+	outFormat := internal.OutputFormatFromString(outputFormat)
+	switch outFormat {
+	case internal.OutputFormatUnknown:
+		return fmt.Errorf("unknown output format '%s', must be one of: pdf, png, html", outputFormat)
+	case internal.OutputFormatPNG:
+		if outFileName == "" || outFileName == "-" {
+			return errors.New("PNG output needs an output file (--out), every page is written to a file of its own")
+		}
+		if pdfa {
+			return errors.New("--pdfa can only be used with PDF output")
+		}
+	default:
+		if cmd.Flags().Lookup("dpi").Changed {
+			return errors.New("--dpi can only be used with PNG output")
+		}
+	}
+
+	renderer := outFormat.Renderer()
+	if cmd.Flags().Lookup("renderer").Changed {
+		renderer = internal.RendererFromName(rendererName)
+		if renderer == nil {
+			return fmt.Errorf("unknown renderer '%s', must be one of: %s", rendererName, strings.Join(internal.RendererNames(), ", "))
+		}
+		if cmd.Flags().Lookup("output-format").Changed && renderer != outFormat.Renderer() {
+			return fmt.Errorf("--output-format %s can not be combined with --renderer %s", outputFormat, renderer.Name())
+		}
+	}
+	if renderer != internal.RendererPDF {
+		if pdfa {
+			return errors.New("--pdfa can only be used with PDF output")
+		}
+		if duplexMode != internal.DuplexNone {
+			return errors.New("--duplex can only be used with PDF output, use the duplex setting of the print dialog instead")
+		}
+		if profile == internal.OutputProfileWallet {
+			return errors.New("the wallet profile can only be written as PDF or PNG")
+		}
+	}
+
+	var serialTemplate internal.SerialTemplate
+	if serialTemplateText != "" {
+		serialTemplate, err = internal.ParseSerialTemplate(serialTemplateText)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 1. Open output file, and the file of --export-cipher, pages of PNG output are opened as they are written
+	outFile := os.Stdout
+	if outFormat != internal.OutputFormatPNG && !generateDryRun {
+		outFile, err = internal.GetFileHandleCarefully(outFileName, overrideOutFile)
 		if err != nil {
 			return err
 		}
@@ -74,145 +390,500 @@ encrypted data.`,
 				log.WithError(err).Error("Error closing file")
 			}
 		}(outFile)
+	}
 
-		// 2. generate serial number if not provided
-		if serialNumber == "" {
-			var err error
-			serialNumber, err = internal.GenerateSerial(6)
-			if err != nil {
-				return errors.Join(errors.New("error generating serial number"), err)
-			}
+	var cipherFile *os.File
+	if exportCipherPath != "" && !generateDryRun {
+		cipherFile, err = internal.GetFileHandleCarefully(exportCipherPath, overrideOutFile)
+		if err != nil {
+			return err
 		}
-
-		// 3. parse date if provided
-		var timestamp time.Time
-		if date == "" {
-			timestamp = time.Now()
-		} else {
-			var err error
-			timestamp, err = time.Parse(internal.TimeStampFormatLong, date)
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
 			if err != nil {
-				// try other formats if this fails
-				timestamp, err = time.Parse(internal.TimeStampFormatShort, date)
-				if err != nil {
-					timestamp, err = time.Parse(internal.TimeStampFormatDate, date)
-					if err != nil {
-						return errors.Join(errors.New("error parsing date"), err)
-					}
-				}
+				log.WithError(err).Error("Error closing file")
 			}
-		}
+		}(cipherFile)
+	}
+
+	// 2. parse date if provided
+	timestamp, err := documentDate(date, timezone, time.Now())
+	if err != nil {
+		return err
+	}
 
-		// 4. Read input file as bytes
-		secretContentsFile, err := internal.PrintInputAndRead(inFileName)
+	var expiresAt, reviewByDate time.Time
+	if expires != "" {
+		expiresAt, err = parseDueDateFlag("expires", expires, timestamp)
 		if err != nil {
 			return err
 		}
+	}
+	if reviewBy != "" {
+		reviewByDate, err = parseDueDateFlag("review-by", reviewBy, timestamp)
+		if err != nil {
+			return err
+		}
+	}
 
-		// 5. Read passphrase from stdin
-		var passphraseBytes []byte
-		if !cmd.Flags().Lookup("passphrase").Changed {
-			log.Info("Enter your encryption passphrase")
-			passphraseBytes, err = internal.SensitivePrompt()
+	// 3. generate serial number if not provided, from the template, or at random
+	var serialCounter *internal.SerialCounter
+	var serialSequence uint64
+	switch {
+	case serialNumber != "":
+	case serialTemplateText != "":
+		if serialTemplate.HasSequence() {
+			serialCounter, err = internal.NewSerialCounter(serialCounterPath)
 			if err != nil {
-				return errors.Join(errors.New("error reading passphrase"), err)
+				return err
 			}
-
-			log.Info("Enter your passphrase again to confirm")
-			passphraseAgain, err := internal.SensitivePrompt()
+			serialSequence, err = serialCounter.Next(serialTemplate)
 			if err != nil {
-				return errors.Join(errors.New("error reading passphrase"), err)
-			}
-			if string(passphraseBytes) != string(passphraseAgain) {
-				return errors.New("passphrases do not match")
+				return err
 			}
-		} else {
-			passphraseBytes = []byte(passphrase)
+			// the counter is locked until the number is stored, it is released without storing it if generating fails
+			defer func() {
+				if err := serialCounter.Release(); err != nil {
+					log.WithError(err).Warn("Could not release the serial number counter")
+				}
+			}()
+		}
+		serialNumber, err = serialTemplate.Expand(serialSequence, serialCharset, timestamp)
+		if err != nil {
+			return errors.Join(errors.New("error generating serial number"), err)
+		}
+	default:
+		serialNumber, err = core.GenerateSerialFromCharset(serialLength, serialCharset)
+		if err != nil {
+			return errors.Join(errors.New("error generating serial number"), err)
+		}
+	}
+	auditSerialNumber = serialNumber
+
+	// 4.-6. Read, and encrypt the input, a message given with --from-pgp is encrypted already
+	var secretContentsFile, data, passphraseBytes []byte
+	if pgpMessagePath != "" {
+		data, err = readPGPMessageFile(pgpMessagePath)
+	} else {
+		secretContentsFile, data, passphraseBytes, err = readAndEncryptInput(cmd)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 7. Write encryptedSecretContents to outFile
+	format := core.PaperCryptDataFormatPGP
+	if rawData {
+		format = core.PaperCryptDataFormatRaw
+	}
+	crypt := core.NewPaperCrypt(core.VersionInfo.GitVersion, data, serialNumber, purpose, comment, timestamp, format)
+	// the plaintext of the message is not compressed by PaperCrypt, and is decoded as gpg returns it
+	crypt.ExternalMessage = pgpMessagePath != ""
+	if plaintextHash {
+		plaintextSHA256 := sha256.Sum256(secretContentsFile)
+		crypt.PlaintextSHA256 = plaintextSHA256[:]
+	}
+	if privateMetadata {
+		// only the encrypted data holds the purpose and comment
+		crypt.Purpose, crypt.Comment = "", ""
+		crypt.PrivateMetadata = true
+	}
+	crypt.ExpiresAt = expiresAt
+	crypt.ReviewBy = reviewByDate
+	if version == core.PaperCryptContainerVersionMajor3 {
+		// the header is complete, it is authenticated as it is
+		if err := crypt.Authenticate(passphraseBytes); err != nil {
+			return err
 		}
+	}
 
-		// 6. Compress secret data
-		compressedData := new(bytes.Buffer)
-		gzipWriter, err := gzip.NewWriterLevel(compressedData, gzip.BestCompression)
+	pages := 0
+	if renderer == internal.RendererPDF && outFormat == internal.OutputFormatPDF && !generateDryRun {
+		// the document is written as it is rendered, rather than held in memory, see internal.WritePDF
+		output := &countingWriter{w: outFile}
+		pages, err = internal.WritePDF(crypt, output, noQR, opts)
 		if err != nil {
-			return errors.Join(errors.New("error creating gzip writer"), err)
+			return errors.Join(fmt.Errorf("error rendering the document using the %s renderer", renderer.Name()), err)
 		}
 
-		_, err = gzipWriter.Write(secretContentsFile)
+		internal.PrintWrittenSize(output.n, outFile)
+	} else {
+		text, err := renderer.Render(crypt, noQR, opts)
 		if err != nil {
-			return errors.Join(errors.New("error writing to gzip writer"), err)
+			return errors.Join(fmt.Errorf("error rendering the document using the %s renderer", renderer.Name()), err)
 		}
-		if err := gzipWriter.Close(); err != nil {
-			return errors.Join(errors.New("error closing gzip writer"), err)
+		if generateDryRun {
+			return writeLayoutSummary(cmd, crypt, opts, renderer, text)
 		}
 
-		var data []byte
-
-		// 7. Encrypt with passphrase
-		if !rawData {
-			encryptedSecretContents, err := encrypt(passphraseBytes, compressedData.Bytes())
+		if outFormat == internal.OutputFormatPNG {
+			err = internal.RasterizePDF(text, rasterDPI, func(page, pages int, img *image.RGBA) error {
+				return writePNGPage(internal.PagePath(outFileName, page, pages), img)
+			})
 			if err != nil {
-				return errors.Join(errors.New("error encrypting secret contents"), err)
+				return err
 			}
-
-			compressedData.Reset()
-			gzipWriter.Reset(compressedData)
-			_, err = gzipWriter.Write(encryptedSecretContents.GetBinary())
+		} else {
+			n, err := outFile.Write(text)
 			if err != nil {
-				return errors.Join(errors.New("error writing to gzip writer"), err)
+				return errors.Join(errors.New("error writing to file"), err)
 			}
-			if err := gzipWriter.Close(); err != nil {
-				return errors.Join(errors.New("error closing gzip writer"), err)
+
+			internal.PrintWrittenSize(n, outFile)
+		}
+		if internal.IsPDF(text) {
+			if pages, err = internal.CountPDFPages(text); err != nil {
+				return err
 			}
 		}
+	}
+	if cipherFile != nil {
+		if err := exportCipher(crypt, cipherFile); err != nil {
+			return err
+		}
+	}
+
+	// 8. count the sequence number as issued, once the document has been written
+	if serialCounter != nil {
+		if err := serialCounter.Store(serialTemplate, serialSequence); err != nil {
+			return err
+		}
+		log.WithField("serial", serialNumber).WithField("counter", serialCounter.Path()).Info("Issued serial number")
+	}
 
-		// Take the unencrypted, compressed data (if rawData is true) or the encrypted, re-compressed data
-		data = compressedData.Bytes()
+	// 9. add the document to the catalog, the document is written already, so failing to do so is not fatal
+	if !noCatalog {
+		if err := catalogGeneratedDocument(crypt, pages); err != nil {
+			log.WithError(err).Warn("Could not add the document to the catalog, add it with 'papercrypt catalog add'")
+		}
+	}
+	return nil
+}
 
-		// 8. Write encryptedSecretContents to outFile
-		format := internal.PaperCryptDataFormatPGP
-		if rawData {
-			format = internal.PaperCryptDataFormatRaw
+// readAndEncryptInput reads the input file, or presetInput, and the passphrase, and returns the input,
+// its data compressed, and encrypted, unless it is to be stored raw, and the passphrase.
+func readAndEncryptInput(cmd *cobra.Command) ([]byte, []byte, []byte, error) {
+	// 4. Read input file as bytes
+	secretContentsFile := presetInput
+	if secretContentsFile == nil {
+		var err error
+		secretContentsFile, err = internal.PrintInputAndRead(inFileName)
+		if err != nil {
+			return nil, nil, nil, err
 		}
-		crypt := internal.NewPaperCrypt(internal.VersionInfo.GitVersion, data, serialNumber, purpose, comment, timestamp, format)
+	}
 
-		var text []byte
+	// 5. Read passphrase from its source, or from stdin, a dry run encrypts using a random passphrase instead,
+	// as the length of the encrypted data does not depend on it
+	var passphraseBytes []byte
+	var err error
+	if generateDryRun {
+		var randomPassphrase string
+		randomPassphrase, err = core.GenerateSerial(32)
+		passphraseBytes = []byte(randomPassphrase)
+	} else {
+		passphraseBytes, err = readPassphrase(cmd, promptNewPassphrase)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		text, err = crypt.GetPDF(noQR, lowerCasedBase16)
+	// 6. Compress, and encrypt the secret data, unless it is to be stored raw
+	plaintext := secretContentsFile
+	if privateMetadata {
+		plaintext, err = core.WrapPrivateMetadata(purpose, comment, secretContentsFile)
 		if err != nil {
-			return errors.Join(errors.New("error generating PDF"), err)
+			return nil, nil, nil, err
 		}
+	}
+	data, err := core.CompressAndEncrypt(passphraseBytes, plaintext, rawData)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return secretContentsFile, data, passphraseBytes, nil
+}
+
+// parseFormatVersionFlag parses the value of --format-version, the container format version of the document written.
+func parseFormatVersionFlag(value int) (core.PaperCryptContainerVersion, error) {
+	switch value {
+	case 2:
+		return core.PaperCryptContainerVersionMajor2, nil
+	case 3:
+		return core.PaperCryptContainerVersionMajor3, nil
+	default:
+		return core.PaperCryptContainerVersionUnknown, fmt.Errorf("unsupported --format-version %d, must be either 2, or 3", value)
+	}
+}
+
+// readPGPMessageFile reads the OpenPGP message at path (see --from-pgp), ASCII armored, or binary,
+// and returns it compressed, as the data of a document.
+func readPGPMessageFile(path string) ([]byte, error) {
+	message, err := internal.PrintInputAndRead(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := core.NewPaperCryptFromPGPMessage(message)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error reading the OpenPGP message %s", path), err)
+	}
+	if info, err := wrapped.EncryptionInfo(); err == nil {
+		log.WithField("kdf", info.KDF).WithField("integrity", info.Integrity).Info("Wrapping the OpenPGP message as it is")
+	}
+
+	return wrapped.Data, nil
+}
+
+// countingWriter counts the bytes written to w, for documents written as they are rendered.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
 
-		n, err := outFile.Write(text)
+func (c *countingWriter) Write(data []byte) (int, error) {
+	n, err := c.w.Write(data)
+	c.n += n
+	return n, err
+}
+
+// exportCipher writes the OpenPGP message of crypt, ASCII armored, to file (see --export-cipher).
+func exportCipher(crypt *core.PaperCrypt, file *os.File) error {
+	armored, err := crypt.ArmoredPGPMessage()
+	if err != nil {
+		return err
+	}
+
+	n, err := file.WriteString(armored + "\n")
+	if err != nil {
+		return errors.Join(errors.New("error writing the OpenPGP message"), err)
+	}
+	internal.PrintWrittenSize(n, file)
+
+	return nil
+}
+
+// catalogGeneratedDocument adds the generated document to the catalog, with its number of pages (0 for documents other than PDF).
+// Its purpose and comment are left out, if they are private (see --private-metadata), as the catalog is not encrypted.
+func catalogGeneratedDocument(crypt *core.PaperCrypt, pages int) error {
+	catalog, err := internal.NewCatalog(catalogPath)
+	if err != nil {
+		return err
+	}
+
+	return addToCatalog(catalog, internal.NewCatalogEntry(crypt, pages, catalogLocation))
+}
+
+// documentDate returns the date of the document, given with --date (or now, if empty), in the time zone given with --timezone.
+// Dates without a time zone are read in that time zone, or the local one, if none is given.
+func documentDate(value string, zone string, now time.Time) (time.Time, error) {
+	location, err := core.ParseTimeZone(zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	timestamp := now
+	if value != "" {
+		timestamp, err = core.ParseTimeStamp(value, location)
 		if err != nil {
-			return errors.Join(errors.New("error writing to file"), err)
+			return time.Time{}, errors.Join(errors.New("error parsing date"), err)
 		}
+	}
+	if zone != "" {
+		timestamp = timestamp.In(location)
+	}
 
-		internal.PrintWrittenSize(n, outFile)
-		return nil
-	},
+	return timestamp, nil
 }
 
-func encrypt(passphrase []byte, data []byte) (*crypto.PGPMessage, error) {
-	message := crypto.NewPlainMessage(data)
+// parseDueDateFlag parses the value of --expires, or --review-by, which must not be before the date of the document.
+func parseDueDateFlag(flag string, value string, createdAt time.Time) (time.Time, error) {
+	due, err := core.ParseDueDate(value, createdAt)
+	if err != nil {
+		return time.Time{}, errors.Join(fmt.Errorf("invalid --%s", flag), err)
+	}
+	if core.FormatDueDate(due) < createdAt.Format(core.TimeStampFormatDate) {
+		return time.Time{}, fmt.Errorf("--%s %s is before the date of the document", flag, core.FormatDueDate(due))
+	}
+
+	return due, nil
+}
 
-	encrypted, err := crypto.EncryptMessageWithPassword(message, passphrase)
+// writeLayoutSummary prints how the rendered document is laid out, for --dry-run.
+func writeLayoutSummary(cmd *cobra.Command, crypt *core.PaperCrypt, opts internal.TextOptions, renderer internal.Renderer, rendered []byte) error {
+	var pdf []byte
+	if renderer == internal.RendererPDF {
+		pdf = rendered
+	}
+	summary, err := internal.NewLayoutSummary(crypt, noQR, opts, pdf)
 	if err != nil {
-		return nil, errors.Join(errors.New("error encrypting message"), err)
+		return errors.Join(errors.New("error summarizing the layout"), err)
 	}
 
-	return encrypted, nil
+	pages := "unknown, laid out by the " + renderer.Name() + " renderer"
+	if summary.Pages > 0 {
+		pages = fmt.Sprint(summary.Pages)
+	}
+	codes := "none"
+	if len(summary.Codes) > 0 {
+		codes = fmt.Sprint(len(summary.Codes))
+	}
+	fields := [][2]string{
+		{"Serial Number", crypt.SerialNumber},
+		{"Pages", pages},
+		{"Data Length", fmt.Sprintf("%d bytes", summary.DataLength)},
+		{"Data Lines", fmt.Sprint(summary.DataLines)},
+		{"2D Codes", codes},
+	}
+	for i, code := range summary.Codes {
+		description := fmt.Sprintf("%s, %s error correction", code.Type, code.ErrorCorrection)
+		if code.Version > 0 {
+			description = fmt.Sprintf("%s version %d, error correction %s", code.Type, code.Version, code.ErrorCorrection)
+		}
+		description += fmt.Sprintf(", %d modules of %.2f mm", code.Modules, code.ModuleSize)
+		fields = append(fields, [2]string{fmt.Sprintf("Code %d", i+1), description})
+	}
+	fields = append(fields, [2]string{"Scan Difficulty", summary.ScanDifficulty().String()})
+
+	log.Info("Dry run, nothing was written.")
+	return writeFields(cmd.OutOrStdout(), fields)
+}
+
+// writePNGPage writes a page of the document as a PNG image to its own file.
+func writePNGPage(path string, img *image.RGBA) error {
+	data, err := internal.EncodePNG(img, rasterDPI)
+	if err != nil {
+		return err
+	}
+
+	outFile, err := internal.GetFileHandleCarefully(path, overrideOutFile)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := internal.CloseFileIfNotStd(file)
+		if err != nil {
+			log.WithError(err).Error("Error closing file")
+		}
+	}(outFile)
+
+	n, err := outFile.Write(data)
+	if err != nil {
+		return errors.Join(errors.New("error writing to file"), err)
+	}
+
+	internal.PrintWrittenSize(n, outFile)
+	return nil
+}
+
+// promptNewPassphrase asks for the passphrase to encrypt with, twice, so a typo does not lock the data away.
+func promptNewPassphrase() ([]byte, error) {
+	log.Info("Enter your encryption passphrase")
+	passphraseBytes, err := internal.SensitivePrompt()
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading passphrase"), err)
+	}
+
+	log.Info("Enter your passphrase again to confirm")
+	passphraseAgain, err := internal.SensitivePrompt()
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading passphrase"), err)
+	}
+	if string(passphraseBytes) != string(passphraseAgain) {
+		return nil, errors.New("passphrases do not match")
+	}
+
+	return passphraseBytes, nil
 }
 
 func init() {
 	rootCmd.AddCommand(generateCmd)
 
 	generateCmd.Flags().StringVarP(&serialNumber, "serial-number", "s", "", "Serial number of the sheet (optional, default: 6 random characters)")
+	generateCmd.Flags().StringVar(&serialTemplateText, "serial-template", "", "Template of the serial number, such as 'HOME-{seq:04}', with the placeholders {seq} (the next number of a counter kept for the template, {seq:04} pads it to 4 digits), {random} ({random:8} for 8 characters), {date}, and {year}")
+	generateCmd.Flags().StringVar(&serialCharset, "serial-charset", core.DefaultSerialCharset, "Characters of random serial numbers, and of {random} in --serial-template")
+	generateCmd.Flags().IntVar(&serialLength, "serial-length", core.DefaultSerialLength, "Length of random serial numbers")
+	generateCmd.Flags().StringVar(&serialCounterPath, "serial-counter", "", "File keeping the counters of --serial-template, share it to number the sheets of several machines consecutively (default: serial-counter.json in the PaperCrypt configuration directory)")
+	generateCmd.Flags().StringVar(&catalogPath, "catalog", "", "File of the catalog the document is added to (default: catalog.json in the PaperCrypt configuration directory)")
+	generateCmd.Flags().BoolVar(&noCatalog, "no-catalog", false, "Do not add the document to the catalog")
+	generateCmd.Flags().StringVar(&catalogLocation, "location", "", "Where the sheets will be stored, such as 'safe, top shelf', noted in the catalog")
+	generateCmd.MarkFlagsMutuallyExclusive("serial-number", "serial-template")
+	generateCmd.MarkFlagsMutuallyExclusive("serial-number", "serial-length")
+	generateCmd.MarkFlagsMutuallyExclusive("serial-template", "serial-length")
+	generateCmd.MarkFlagsMutuallyExclusive("no-catalog", "catalog")
+	generateCmd.MarkFlagsMutuallyExclusive("no-catalog", "location")
 	generateCmd.Flags().StringVarP(&purpose, "purpose", "p", "", "Purpose of the sheet (optional)")
 	generateCmd.Flags().StringVarP(&comment, "comment", "c", "", "Comment on the sheet (optional)")
-	generateCmd.Flags().StringVarP(&date, "date", "d", "", "Date of the sheet (optional, defaults to now)")
+	generateCmd.Flags().StringVarP(&date, "date", "d", "", "Date of the sheet, as RFC 3339 (such as 2024-08-01T20:38:10+02:00), or ISO 8601 (such as '2024-08-01 20:38', or 2024-08-01) (optional, defaults to now)")
+	generateCmd.Flags().StringVar(&timezone, "timezone", "", "Time zone the date of the sheet is written in, and dates without one are read in, such as Europe/Berlin, UTC, or +02:00 (optional, defaults to the local time zone)")
+	generateCmd.Flags().StringVar(&expires, "expires", "", "Date after which the content is no longer valid, such as 2030-01-31, or a period after the date of the sheet, such as 5y, 18m, or 90d, 'decode' and 'info' warn once it has passed (optional)")
+	generateCmd.Flags().StringVar(&reviewBy, "review-by", "", "Date by which the sheet should be printed again, and verified, as a date, or a period like --expires, 'decode' and 'info' warn once it has passed (optional)")
 	generateCmd.Flags().BoolVar(&noQR, "no-qr", false, "Do not generate 2D code (optional)")
+	generateCmd.Flags().StringVar(&paperSize, "paper", "a4", "Paper size of the PDF document, either 'a4', 'letter', 'a5', or 'legal', the lines of the data block are adjusted to the width of the page")
+	generateCmd.Flags().StringVar(&templatePath, "template", "", "Template file (YAML) customizing the PDF document, with a logo, header and footer text, contact information, and the order of the header fields and sections (optional)")
+	generateCmd.Flags().StringVar(&dataFontPath, "font", "", "TrueType font (.ttf) to print the header and data lines in, such as OCR-B, or another monospace font that tells 0 from O, and 1 from l (optional)")
+	generateCmd.Flags().Float64Var(&dataFontSize, "font-size", internal.PdfDataLineFontSize, "Font size of the header and data lines in pt, larger sizes get fewer bytes per line")
+	generateCmd.Flags().BoolVar(&instructions, "instructions", false, "Append a page explaining, step by step, how to restore the document without PaperCrypt, using common tools and GnuPG")
+	generateCmd.Flags().StringVar(&outputFormat, "output-format", "pdf", "Format of the output, either 'pdf', 'png' (one image per page, written to files numbered after --out), or 'html' (a single page for printing from a browser)")
+	generateCmd.Flags().StringVar(&languageCode, "lang", internal.DefaultLanguage, fmt.Sprintf("Language of the text printed on the document, one of: %s (the header and data lines are always written in English, as PaperCrypt reads them back)", strings.Join(internal.Languages(), ", ")))
+	generateCmd.Flags().StringVar(&rendererName, "renderer", "pdf", "Backend laying out the document, either 'pdf', 'html', or 'typst' (Typst source code, for complete control over the typography, compile it using 'typst compile'), set by --output-format by default")
+	generateCmd.Flags().Float64Var(&rasterDPI, "dpi", internal.DefaultRasterDPI, "Resolution of PNG output, in dots per inch")
+	generateCmd.Flags().StringVar(&duplex, "duplex", "", "Lay the document out for printing on both sides of the paper, either 'long-edge', or 'short-edge' (the edge the paper is flipped on): the 2D code and the data go on the front, the information on the back")
+	generateCmd.Flags().BoolVar(&pdfa, "pdfa", false, "Write a PDF/A-2b document, for archival in document management systems")
+	generateCmd.Flags().BoolVar(&noAttachment, "no-attachment", false, "Do not attach the document (JSON serialized) to the PDF, which lets 'papercrypt scan' restore it from the digital PDF; PDF/A documents never carry it")
+	generateCmd.Flags().StringVar(&watermark, "watermark", "", "Print this text in large, light grey letters diagonally across each page, e.g. 'CONFIDENTIAL' (optional)")
+	generateCmd.Flags().StringVar(&banner, "banner", "", "Print this text as a classification banner at the top and bottom of each page, e.g. 'SECRET' (optional)")
+	generateCmd.Flags().BoolVar(&landscape, "landscape", false, "Print the PDF document in landscape orientation, with longer lines of data, and fewer pages for large documents")
+	generateCmd.Flags().BoolVar(&noFiducials, "no-fiducials", false, "Do not print markers in the corners of each page, which let scans and photos of the page be straightened automatically")
+	generateCmd.Flags().StringVar(&codeType, "code-type", "aztec", "Type of the 2D code, either 'aztec', 'qr' (byte mode, defaults to the cbor payload), or 'color' (experimental, three QR codes in cyan, magenta, and yellow)")
+	generateCmd.Flags().StringVar(&qrEC, "qr-ec", "M", "Error correction level of the QR code, either L (7%), M (15%), Q (25%), or H (30%), higher levels need more or larger codes")
+	generateCmd.Flags().IntVar(&qrMaxVersion, "qr-version", 0, "Largest QR code version (1-40) to use, larger payloads are split over several codes (0 for no limit)")
+	generateCmd.Flags().StringVar(&qrModuleSize, "qr-module-size", "", "Printed size of a single module of the 2D code, in mm (e.g. '0.6mm') or printer dots (e.g. '8dots'), larger codes are split (default: fill the page)")
+	generateCmd.Flags().IntVar(&qrDPI, "qr-dpi", core.Code2DDefaultDPI, "Printer resolution the 2D code is rendered for, so each module covers whole dots")
+	generateCmd.Flags().StringVar(&qrPayload, "qr-payload", "json", "Serialization of the document inside the 2D code, either 'json', or 'cbor' (more compact, fits more data)")
 	generateCmd.Flags().BoolVar(&lowerCasedBase16, "lowercase", false, "Whether to use lower case letters for hexadecimal digits")
+	generateCmd.Flags().StringVar(&outputProfile, "profile", "default", "Output profile, either 'default', 'stamping' (upper case base32 in a grid of large cells, for letter-punching onto metal plates), or 'wallet' (a credit-card-sized card with a single QR code, for lamination)")
+	generateCmd.Flags().StringVar(&dataEncoding, "encoding", "base16", "Encoding of the printed data, either 'base16' (hexadecimal), 'base32' (Crockford's alphabet, without I, L, O, and U), 'base64', 'armor' (OpenPGP-style ASCII armor), or 'words' (PGP words, for reading aloud)")
 	generateCmd.Flags().BoolVar(&rawData, "raw", false, "Do not encrypt the data, just compress it")
+	generateCmd.Flags().BoolVar(&privateMetadata, "private-metadata", false, "Encrypt the purpose and comment along with the data, so the printed sheet reveals nothing about its contents beyond the serial number, they are shown once the data is decrypted")
+	generateCmd.MarkFlagsMutuallyExclusive("private-metadata", "raw")
+	generateCmd.Flags().StringVar(&exportCipherPath, "export-cipher", "", "Also write the bare OpenPGP message, ASCII armored, to this file, a digital copy restored by 'gpg --decrypt <file> | gunzip' (without gunzip for messages of --from-pgp)")
+	generateCmd.MarkFlagsMutuallyExclusive("export-cipher", "raw")
+	generateCmd.Flags().StringVar(&pgpMessagePath, "from-pgp", "", "Wrap this OpenPGP message (ASCII armored, or binary), encrypted beforehand using gpg, or other OpenPGP software, in the document, without encrypting anything, or asking for a passphrase")
+	generateCmd.Flags().IntVar(&formatVersion, "format-version", 0, "Container format version of the document, either 3 (authenticates the header by a MAC keyed by the passphrase, so changes to the purpose, dates, or checksums are found when decoding), or 2 (for older versions of PaperCrypt, which can not read format version 3) (default: 3, or 2 for --raw, and --from-pgp, which have no passphrase to key the MAC by)")
+	generateCmd.Flags().BoolVar(&plaintextHash, "plaintext-hash", false, "Also print the SHA-256 checksum of the unencrypted data, to be verified after decryption (allows anyone holding the sheet to confirm guesses of its contents)")
+
+	generateCmd.Flags().IntVar(&layoutGroupSize, "group", core.DefaultDataLayout.GroupSize, "Number of bytes printed together, before a space (base16 only)")
+	generateCmd.Flags().IntVar(&layoutColumns, "columns", core.DefaultDataLayout.Columns, "Number of groups per line (defaults to about 24 bytes per line)")
+	generateCmd.Flags().IntVar(&layoutBlockLines, "block-lines", core.DefaultDataLayout.BlockLines, "Insert an empty line after this many lines (0 to disable)")
+	generateCmd.Flags().BoolVar(&layoutNoLineIndices, "no-line-indices", false, "Do not print line numbers")
+	generateCmd.Flags().BoolVar(&layoutColumnIndices, "column-indices", false, "Print column numbers above each block")
 
+	generateCmd.Flags().StringVar(&lineChecksum, "line-checksum", "crc24", "Checksum of each line of the data block, either 'crc24', 'crc32', or 'sha256' (truncated to 4 bytes)")
+	generateCmd.Flags().IntVar(&eccLevel, "ecc-level", 0, "Append Reed-Solomon parity lines to the data block, amounting to this percentage of its lines, so damaged lines can be reconstructed (0 to disable)")
+
+	generateCmd.Flags().BoolVar(&generateDryRun, "dry-run", false, "Lay the document out without writing it, and print the number of pages, data lines, and 2D codes, without asking for the passphrase")
 	generateCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Passphrase to use for encryption. Not recommended, will be prompted for if not provided")
+	addPassphraseSourceFlags(generateCmd)
+	for _, flag := range []string{"raw", "private-metadata", "plaintext-hash", "passphrase", "passphrase-file", "passphrase-fd", "cache-passphrase"} {
+		generateCmd.MarkFlagsMutuallyExclusive("from-pgp", flag)
+	}
+
+	_ = generateCmd.RegisterFlagCompletionFunc("serial-number", completeSerialNumbers)
+	_ = generateCmd.RegisterFlagCompletionFunc("paper", completePaperSizes)
+	_ = generateCmd.RegisterFlagCompletionFunc("lang", completeLanguages)
+	_ = generateCmd.RegisterFlagCompletionFunc("encoding", completeValues(encodingValues...))
+	_ = generateCmd.RegisterFlagCompletionFunc("line-checksum", completeValues(lineChecksumValues...))
+	_ = generateCmd.RegisterFlagCompletionFunc("code-type", completeValues(codeTypeValues...))
+	_ = generateCmd.RegisterFlagCompletionFunc("qr-ec", completeValues(qrECValues...))
+	_ = generateCmd.RegisterFlagCompletionFunc("qr-payload", completeValues(qrPayloadValues...))
+	_ = generateCmd.RegisterFlagCompletionFunc("output-format", completeValues("pdf", "png\tone image per page", "html\ta single page"))
+	_ = generateCmd.RegisterFlagCompletionFunc("renderer", completeValues("pdf", "html", "typst\tTypst source code"))
+	_ = generateCmd.RegisterFlagCompletionFunc("duplex", completeValues("long-edge", "short-edge"))
+	_ = generateCmd.RegisterFlagCompletionFunc("profile", completeValues("default", "stamping\tfor letter-punching onto metal plates", "wallet\ta credit-card-sized card"))
+	_ = generateCmd.RegisterFlagCompletionFunc("template", completeFiles("yaml", "yml"))
+	_ = generateCmd.RegisterFlagCompletionFunc("font", completeFiles("ttf"))
+	_ = generateCmd.RegisterFlagCompletionFunc("catalog", completeFiles("json"))
+	_ = generateCmd.RegisterFlagCompletionFunc("from-pgp", completeFiles("asc", "gpg", "pgp"))
+	_ = generateCmd.RegisterFlagCompletionFunc("export-cipher", completeFiles("asc"))
 }
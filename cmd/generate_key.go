@@ -21,38 +21,116 @@
 package cmd
 
 import (
-	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/big"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/log"
 	"github.com/spf13/cobra"
 	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
-var words int
+var (
+	words        int
+	bits         int
+	keyFormat    string
+	keySheetPath string
+	keySheetLang string
+)
+
+const (
+	keyFormatEFF   = "eff"
+	keyFormatBIP39 = "bip39"
+)
+
+// keyPhraseFormat describes how phrases of a format are generated,
+// and how their length relates to their entropy.
+type keyPhraseFormat struct {
+	generate     func(words int) ([]string, error)
+	entropyBits  func(words int) float64
+	wordsForBits func(bits int) (int, error)
+}
+
+var keyPhraseFormats = map[string]keyPhraseFormat{
+	keyFormatEFF: {
+		generate: generateMnemonic,
+		entropyBits: func(words int) float64 {
+			loadWordList()
+			return internal.PhraseEntropyBits(len(wordList), words)
+		},
+		wordsForBits: func(bits int) (int, error) {
+			loadWordList()
+			return internal.WordsForEntropy(len(wordList), bits)
+		},
+	},
+	keyFormatBIP39: {
+		generate: generateBIP39Mnemonic,
+		entropyBits: func(words int) float64 {
+			entropyBytes, _ := internal.BIP39EntropyBytes(words)
+			return float64(entropyBytes * 8)
+		},
+		wordsForBits: internal.BIP39WordsForEntropy,
+	},
+}
 
 var (
-	WordListFile *string
-	wordList     = make([]string, 0)
+	WordListFile      *string
+	wordList          = make([]string, 0)
+	BIP39WordListFile *string
+	bip39WordList     = make([]string, 0)
 )
 
-const wordListURL = "https://www.eff.org/files/2016/07/18/eff_large_wordlist.txt"
+const (
+	wordListURL      = "https://www.eff.org/files/2016/07/18/eff_large_wordlist.txt"
+	bip39WordListURL = "https://github.com/bitcoin/bips/blob/master/bip-0039/english.txt"
+)
 
-var wordListURLFormatted = internal.URL(wordListURL)
+var (
+	wordListURLFormatted      = core.URL(wordListURL)
+	bip39WordListURLFormatted = core.URL(bip39WordListURL)
+)
 
 var generateKeyCmd = &cobra.Command{
-	Aliases:      []string{"key", "gen", "k"},
+	Aliases:      []string{"gen", "k"},
 	Args:         cobra.NoArgs,
 	SilenceUsage: true,
 	Use:          "generate-key",
 	Short:        "Generates a mnemonic key phrase",
 	Long: fmt.Sprintf(`This command generates a mnemonic key phrase base on the eff.org large word list,
-which can be found here: %s.`, wordListURLFormatted),
-	RunE: func(_ *cobra.Command, _ []string) error {
+which can be found here: %s.
+
+With --format bip39, a standard BIP39 mnemonic (including its checksum) is generated instead,
+using the BIP39 english word list: %s.
+BIP39 mnemonics must be 12, 15, 18, 21, or 24 words long.
+
+With --sheet, a printable key sheet PDF is written as well, containing the phrase in large type,
+and as a QR code, so the key can be stored on paper, separately from the documents it protects.
+
+The length of the phrase can be chosen with either --words, or --bits, which selects the shortest
+phrase providing at least the given entropy. The entropy of the generated phrase is reported,
+alongside an estimate of the average time needed to guess it.`, wordListURLFormatted, bip39WordListURLFormatted),
+	Example: "papercrypt generate-key --format bip39 --words 24 --sheet key-sheet.pdf",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, ok := keyPhraseFormats[keyFormat]
+		if !ok {
+			return fmt.Errorf("unknown key format '%s', must be one of: %s, %s", keyFormat, keyFormatEFF, keyFormatBIP39)
+		}
+		language, err := internal.LoadLanguage(keySheetLang)
+		if err != nil {
+			return err
+		}
+
+		if cmd.Flags().Lookup("bits").Changed {
+			var err error
+			words, err = format.wordsForBits(bits)
+			if err != nil {
+				return errors.Join(errors.New("error determining phrase length"), err)
+			}
+		}
+
 		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
 		if err != nil {
 			return err
@@ -65,15 +143,27 @@ which can be found here: %s.`, wordListURLFormatted),
 		}(outFile)
 
 		log.Info("Generating key phrase...")
-		keyPhrase, err := generateMnemonic(words)
+		keyPhrase, err := format.generate(words)
 		if err != nil {
 			return errors.Join(errors.New("error generating key phrase"), err)
 		}
 		log.Info("Key phrase generated.")
 
+		entropy := format.entropyBits(len(keyPhrase))
+		log.WithField("words", len(keyPhrase)).
+			WithField("entropy", fmt.Sprintf("%.1f bits", entropy)).
+			WithField("brute-force", internal.BruteForceEstimate(entropy)).
+			Info(fmt.Sprintf("Key phrase strength (assuming an attacker makes %.0e guesses per second)", internal.BruteForceGuessesPerSecond))
+
+		if keySheetPath != "" {
+			if err := writeKeySheet(keySheetPath, keyPhrase, language); err != nil {
+				return err
+			}
+		}
+
 		wordString := strings.Join(keyPhrase, " ")
 		if outFile == os.Stdout {
-			wordString = internal.Bold(wordString)
+			wordString = core.Bold(wordString)
 		}
 
 		n, err := outFile.WriteString(wordString)
@@ -90,6 +180,44 @@ which can be found here: %s.`, wordListURLFormatted),
 	},
 }
 
+func writeKeySheet(path string, keyPhrase []string, language *internal.Language) error {
+	sheetFile, err := internal.GetFileHandleCarefully(path, overrideOutFile)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := internal.CloseFileIfNotStd(file)
+		if err != nil {
+			log.WithError(err).Error("Error closing file")
+		}
+	}(sheetFile)
+
+	sheetSerial, err := core.GenerateSerial(6)
+	if err != nil {
+		return errors.Join(errors.New("error generating serial number"), err)
+	}
+
+	data, err := internal.GenerateKeySheetPDF(sheetSerial, time.Now(), keyFormat, keyPhrase, language)
+	if err != nil {
+		return errors.Join(errors.New("error generating key sheet PDF"), err)
+	}
+
+	n, err := sheetFile.Write(data)
+	if err != nil {
+		return errors.Join(errors.New("error writing key sheet"), err)
+	}
+
+	log.WithField("serial", sheetSerial).Info("Key sheet generated.")
+	internal.PrintWrittenSize(n, sheetFile)
+	return nil
+}
+
+func loadWordList() {
+	if len(wordList) == 0 {
+		generateWordList()
+	}
+}
+
 func generateWordList() {
 	wordListArray := strings.Split(*WordListFile, "\n")
 
@@ -107,21 +235,58 @@ func generateWordList() {
 }
 
 func generateMnemonic(amount int) ([]string, error) {
-	if len(wordList) == 0 {
-		generateWordList()
+	loadWordList()
+
+	// choose `amount` random words from wordList
+	return internal.GenerateRandomWords(amount, wordList)
+}
+
+func generateBIP39WordList() {
+	for _, word := range strings.Split(*BIP39WordListFile, "\n") {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+
+		bip39WordList = append(bip39WordList, word)
 	}
+}
 
-	// choose `amount` random words from wordListArray
-	randInt, err := rand.Int(rand.Reader, big.NewInt(int64(len(wordList))))
-	if err != nil {
-		return nil, errors.Join(errors.New("error generating random seed"), err)
+func generateBIP39Mnemonic(amount int) ([]string, error) {
+	if len(bip39WordList) == 0 {
+		generateBIP39WordList()
 	}
 
-	return internal.GenerateFromSeed(randInt.Int64(), amount, &wordList)
+	return internal.GenerateBIP39Mnemonic(amount, bip39WordList)
+}
+
+// genKeyCmd keeps the behavior of 'papercrypt key' reachable, which used to be an alias of generate-key,
+// before 'key' became the group of the key backup commands.
+var genKeyCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "gen-key",
+	Short:        generateKeyCmd.Short,
+	Deprecated:   "use 'generate-key' instead, 'key' now backs up OpenPGP and SSH keys.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return generateKeyCmd.RunE(cmd, args)
+	},
 }
 
 func init() {
 	rootCmd.AddCommand(generateKeyCmd)
 
 	generateKeyCmd.Flags().IntVarP(&words, "words", "w", 24, "Number of words to include in the key phrase")
+	generateKeyCmd.Flags().IntVar(&bits, "bits", 0, "Minimum entropy of the key phrase in bits, chooses the number of words accordingly")
+	generateKeyCmd.MarkFlagsMutuallyExclusive("words", "bits")
+	generateKeyCmd.Flags().StringVar(&keyFormat, "format", keyFormatEFF, "Key phrase format, either 'eff' (eff.org large word list) or 'bip39' (BIP39 mnemonic with checksum)")
+	generateKeyCmd.Flags().StringVar(&keySheetPath, "sheet", "", "Also write a printable key sheet PDF to this file (optional)")
+	generateKeyCmd.Flags().StringVar(&keySheetLang, "lang", internal.DefaultLanguage, fmt.Sprintf("Language of the text printed on the key sheet, one of: %s", strings.Join(internal.Languages(), ", ")))
+
+	_ = generateKeyCmd.RegisterFlagCompletionFunc("format", completeValues("eff\teff.org large word list", "bip39\tBIP39 mnemonic with checksum"))
+	_ = generateKeyCmd.RegisterFlagCompletionFunc("sheet", completeFiles("pdf"))
+	_ = generateKeyCmd.RegisterFlagCompletionFunc("lang", completeLanguages)
+
+	rootCmd.AddCommand(genKeyCmd)
+	genKeyCmd.Flags().AddFlagSet(generateKeyCmd.Flags())
 }
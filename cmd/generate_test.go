@@ -0,0 +1,289 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestGenerateDryRun(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	resetFlags(generateCmd)
+	defer resetFlags(generateCmd)
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "secret.json")
+	if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(tempDir, "sheet.pdf")
+
+	var out bytes.Buffer
+	cmd := rootCmd
+	cmd.SetOut(&out)
+	defer cmd.SetOut(nil)
+	// no passphrase is given, a dry run does not ask for it
+	cmd.SetArgs([]string{"generate", "--dry-run", "-i", inPath, "-o", outPath, "--code-type", "qr", "--qr-version", "5", "--qr-module-size", "1mm", "--qr-dpi", "100"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(outPath); err == nil {
+		t.Fatal("Expected no document to be written")
+	}
+	for _, want := range []string{"Pages:", "Data Lines:", "Code 1:", "QR version 5, error correction M", "Scan Difficulty:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("Expected %q in the output, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestGenerateSerialTemplate(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	resetFlags(generateCmd)
+	defer resetFlags(generateCmd)
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "secret.json")
+	if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	counterPath := filepath.Join(tempDir, "counter.json")
+
+	for i, want := range []string{"HOME-0001", "HOME-0002"} {
+		resetFlags(generateCmd)
+		outPath := filepath.Join(tempDir, fmt.Sprintf("sheet%d.pdf", i))
+		rootCmd.SetArgs([]string{"generate", "-i", inPath, "-o", outPath, "-P", "example", "--no-qr", "--serial-template", "HOME-{seq:04}", "--serial-counter", counterPath})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+
+		serial, _, ok := readSerialNumber(outPath)
+		if !ok || serial != want {
+			t.Fatalf("Expected serial number %s, got %s", want, serial)
+		}
+	}
+}
+
+func TestGenerateFromPGPMessage(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	for _, cmd := range []*cobra.Command{generateCmd, decodeCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+
+	// the message is encrypted elsewhere, as gpg would, without compressing the plaintext using gzip,
+	// which may be gzip data itself, such as a .tar.gz file, and is restored byte for byte
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	if _, err := gzipWriter.Write([]byte("The quick brown fox jumps over the lazy dog.")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, plaintext := range map[string][]byte{
+		"text": []byte("The quick brown fox jumps over the lazy dog."),
+		"gzip": compressed.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(plaintext), []byte("example"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			armored, err := encrypted.GetArmored()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tempDir := t.TempDir()
+			messagePath := filepath.Join(tempDir, "message.asc")
+			if err := os.WriteFile(messagePath, []byte(armored), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			pdfPath := filepath.Join(tempDir, "message.pdf")
+			rootCmd.SetArgs([]string{"generate", "--from-pgp", messagePath, "-o", pdfPath, "-P", "example"})
+			if err := rootCmd.Execute(); err == nil {
+				t.Fatal("Expected an error for a passphrase given along with an encrypted message")
+			}
+			resetFlags(generateCmd)
+
+			rootCmd.SetArgs([]string{"generate", "--from-pgp", filepath.Join(tempDir, "missing.asc"), "-o", filepath.Join(tempDir, "none.pdf"), "--no-catalog"})
+			if err := rootCmd.Execute(); err == nil {
+				t.Fatal("Expected an error for a missing message")
+			}
+			resetFlags(generateCmd)
+
+			// no passphrase is needed to wrap the message
+			rootCmd.SetArgs([]string{"generate", "--from-pgp", messagePath, "-o", pdfPath, "--purpose", "Wrapped", "--no-qr", "--no-catalog"})
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			resetFlags(generateCmd)
+
+			outPath := filepath.Join(tempDir, "restored")
+			rootCmd.SetArgs([]string{"decode", "-i", pdfPath, "-o", outPath, "-P", "example"})
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			restored, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(restored, plaintext) {
+				t.Fatalf("Expected the plaintext of the message, %x, got: %x", plaintext, restored)
+			}
+		})
+	}
+}
+
+func TestGenerateFormatVersion3(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	for _, cmd := range []*cobra.Command{generateCmd, decodeCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+	defer func() { minFormatVersion = 0 }()
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "input.json")
+	if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pdfPath := filepath.Join(tempDir, "v3.pdf")
+	rootCmd.SetArgs([]string{"generate", "-i", inPath, "-o", pdfPath, "-P", "example", "--format-version", "4", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for an unsupported format version")
+	}
+	resetFlags(generateCmd)
+
+	rootCmd.SetArgs([]string{"generate", "-i", inPath, "-o", pdfPath, "-P", "example", "--format-version", "3", "--purpose", "Authenticated", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	outPath := filepath.Join(tempDir, "restored.json")
+	rootCmd.SetArgs([]string{"decode", "-i", pdfPath, "-o", outPath, "-P", "example", "--min-format-version", "3"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) != input {
+		t.Fatalf("Expected %s, got %s", input, restored)
+	}
+}
+
+func TestGenerateExportCipher(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	resetFlags(generateCmd)
+	defer resetFlags(generateCmd)
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "secret.txt")
+	if err := os.WriteFile(inPath, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cipherPath := filepath.Join(tempDir, "secret.asc")
+
+	rootCmd.SetArgs([]string{"generate", "-i", inPath, "-o", filepath.Join(tempDir, "raw.pdf"), "--raw", "--export-cipher", cipherPath})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for exporting the message of raw data")
+	}
+	resetFlags(generateCmd)
+
+	rootCmd.SetArgs([]string{"generate", "-i", inPath, "-o", filepath.Join(tempDir, "secret.pdf"), "-P", "example", "--export-cipher", cipherPath, "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message decrypts as 'gpg --decrypt' would, to the compressed data
+	armored, err := os.ReadFile(cipherPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := crypto.NewPGPMessageFromArmored(string(armored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := crypto.DecryptMessageWithPassword(message, []byte("example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(decrypted.GetBinary()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "secret" {
+		t.Fatalf("Expected the exported message to hold the input, got: %s", plaintext)
+	}
+}
+
+func TestDocumentDate(t *testing.T) {
+	now := time.Date(2024, 8, 1, 18, 38, 10, 0, time.UTC)
+
+	for _, tc := range []struct {
+		value, zone, want string
+	}{
+		{"", "", "Thu, 01 Aug 2024 18:38:10.000000000 +0000"},
+		{"", "+02:00", "Thu, 01 Aug 2024 20:38:10.000000000 +0200"},
+		{"2024-08-01T20:38:10+02:00", "", "Thu, 01 Aug 2024 20:38:10.000000000 +0200"},
+		{"2024-08-01T20:38:10+02:00", "UTC", "Thu, 01 Aug 2024 18:38:10.000000000 +0000"},
+		{"2024-08-01 20:38", "Europe/Berlin", "Thu, 01 Aug 2024 20:38:00.000000000 +0200"},
+	} {
+		got, err := documentDate(tc.value, tc.zone, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if core.FormatTimeStamp(got) != tc.want {
+			t.Fatalf("Expected %s for --date %q --timezone %q, got %s", tc.want, tc.value, tc.zone, core.FormatTimeStamp(got))
+		}
+	}
+
+	if _, err := documentDate("2024-08-01", "Nowhere/Land", now); err == nil {
+		t.Fatal("Expected an unknown time zone to be rejected")
+	}
+}
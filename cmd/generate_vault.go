@@ -0,0 +1,195 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+)
+
+var (
+	vaultFormatName string
+	vaultFolder     string
+	vaultTag        string
+	vaultPerEntry   bool
+	vaultEntryNames []string
+
+	keePassKeyFile      string
+	keePassPasswordFile string
+)
+
+// generateFromVault generates documents from the entries of a password manager export, read from the input file:
+// a single document holding all of them, or, with --per-entry, one document per entry.
+// The entries are normalized, see internal.VaultEntry, and written as JSON.
+func generateFromVault(cmd *cobra.Command) error {
+	format := internal.VaultFormatFromString(vaultFormatName)
+	if format == internal.VaultFormatUnknown {
+		return fmt.Errorf("unknown vault export format '%s', must be one of: bitwarden, 1password, keepass", vaultFormatName)
+	}
+	if rawData {
+		return errors.New("--from can not be combined with --raw, the vault must be encrypted")
+	}
+
+	data, err := internal.PrintInputAndRead(inFileName)
+	if err != nil {
+		return err
+	}
+	var entries []internal.VaultEntry
+	if format == internal.VaultFormatKeePass {
+		key, err := readKeePassKey()
+		if err != nil {
+			return err
+		}
+		entries, err = internal.ReadKeePassDatabase(data, key)
+		if err != nil {
+			return err
+		}
+	} else {
+		entries, err = internal.ReadVaultExport(format, data)
+		if err != nil {
+			return err
+		}
+	}
+	entries = internal.FilterVaultEntries(entries, vaultFolder, vaultTag, vaultEntryNames)
+	if len(entries) == 0 {
+		return fmt.Errorf("no entries found in the %s export, check --folder, --tag, and --entry", format)
+	}
+	log.WithField("entries", len(entries)).WithField("format", format).Info("Read the vault export")
+
+	if !vaultPerEntry {
+		secrets, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return errors.Join(errors.New("error serializing the vault entries"), err)
+		}
+		if !cmd.Flags().Lookup("purpose").Changed {
+			purpose = fmt.Sprintf("%s vault, %d entries", format, len(entries))
+		}
+
+		presetInput = secrets
+		defer func() {
+			presetInput = nil
+		}()
+		return generateDocument(cmd)
+	}
+
+	if outFileName == "" || outFileName == "-" {
+		return errors.New("--per-entry writes a document per entry, give the file name to number them after with --out")
+	}
+	if serialNumber != "" {
+		return errors.New("--serial-number can not be combined with --per-entry, each document gets a serial number of its own")
+	}
+
+	// the passphrase is asked for once, for all documents
+	if !generateDryRun {
+		passphraseBytes, err := readPassphrase(cmd, promptNewPassphrase)
+		if err != nil {
+			return err
+		}
+		presetPassphrase = passphraseBytes
+	}
+
+	out, cipherOut, documentPurpose := outFileName, exportCipherPath, purpose
+	defer func() {
+		outFileName, exportCipherPath, purpose, serialNumber = out, cipherOut, documentPurpose, ""
+		presetInput, presetPassphrase = nil, nil
+	}()
+	for i, entry := range entries {
+		secrets, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return errors.Join(errors.New("error serializing the vault entry"), err)
+		}
+
+		presetInput = secrets
+		outFileName = internal.PagePath(out, i+1, len(entries))
+		if cipherOut != "" {
+			exportCipherPath = internal.PagePath(cipherOut, i+1, len(entries))
+		}
+		purpose = entry.Name
+		if documentPurpose != "" {
+			purpose = documentPurpose + ": " + entry.Name
+		}
+		// generated for each document
+		serialNumber = ""
+
+		if err := generateDocument(cmd); err != nil {
+			return errors.Join(fmt.Errorf("error generating the document of entry '%s'", entry.Name), err)
+		}
+	}
+
+	log.WithField("documents", len(entries)).Info("Generated a document per entry")
+	return nil
+}
+
+// readKeePassKey returns the key of a KeePass database: its key file, given with --kdbx-key-file,
+// and its master password, read from --kdbx-password-file, or prompted for.
+func readKeePassKey() (internal.KeePassKey, error) {
+	var key internal.KeePassKey
+	if keePassKeyFile != "" {
+		keyFile, err := os.ReadFile(keePassKeyFile)
+		if err != nil {
+			return key, errors.Join(errors.New("error reading the key file of the KeePass database"), err)
+		}
+		key.KeyFile = keyFile
+	}
+
+	if keePassPasswordFile != "" {
+		password, err := readPassphraseFile(keePassPasswordFile)
+		if err != nil {
+			return key, err
+		}
+		key.Password = password
+		return key, nil
+	}
+
+	if key.KeyFile != nil {
+		log.Info("Enter the master password of the KeePass database, or nothing, if it is only locked by the key file")
+	} else {
+		log.Info("Enter the master password of the KeePass database")
+	}
+	password, err := internal.SensitivePrompt()
+	if err != nil {
+		return key, errors.Join(errors.New("error reading the master password"), err)
+	}
+	key.Password = password
+
+	return key, nil
+}
+
+func init() {
+	generateCmd.Flags().StringVar(&vaultFormatName, "from", "", "Read the input file as the export of a password manager, either 'bitwarden' (unencrypted JSON), '1password' (1PUX), or 'keepass' (a .kdbx database), and generate documents from its entries")
+	generateCmd.Flags().StringVar(&vaultFolder, "folder", "", "With --from, only the entries in this folder (Bitwarden), vault (1Password), or group (KeePass, such as Banking/Cards), and its subfolders")
+	generateCmd.Flags().StringVar(&vaultTag, "tag", "", "With --from, only the entries with this tag (1Password, KeePass)")
+	generateCmd.Flags().StringSliceVar(&vaultEntryNames, "entry", nil, "With --from, only the entries of these names (can be repeated)")
+	generateCmd.Flags().BoolVar(&vaultPerEntry, "per-entry", false, "With --from, generate a document per entry, written to files numbered after --out, instead of a single document")
+	generateCmd.Flags().StringVar(&keePassKeyFile, "kdbx-key-file", "", "With --from keepass, the key file of the database")
+	generateCmd.Flags().StringVar(&keePassPasswordFile, "kdbx-password-file", "", "With --from keepass, read the master password of the database from the first line of this file, instead of prompting for it")
+
+	generateCmd.MarkFlagsMutuallyExclusive("from", "from-pgp")
+	_ = generateCmd.RegisterFlagCompletionFunc("from", completeValues("bitwarden\tunencrypted JSON export", "1password\t1PUX export", "keepass\tKDBX database"))
+	_ = generateCmd.RegisterFlagCompletionFunc("kdbx-key-file", completeFiles("keyx", "key"))
+	_ = generateCmd.RegisterFlagCompletionFunc("kdbx-password-file", completeFiles())
+}
@@ -0,0 +1,128 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestGenerateFromVault(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	for _, cmd := range []*cobra.Command{generateCmd, decodeCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+
+	const export = `{"encrypted": false, "folders": [{"id": "f1", "name": "Banking"}], "items": [
+  {"type": 1, "name": "Bank", "folderId": "f1", "login": {"username": "owner", "password": "hunter2"}},
+  {"type": 2, "name": "Safe", "folderId": "f1", "notes": "12-34-56"},
+  {"type": 2, "name": "Shopping List", "notes": "milk"}
+]}`
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "export.json")
+	if err := os.WriteFile(inPath, []byte(export), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// decode returns the entries of a generated document
+	decode := func(path string) []internal.VaultEntry {
+		t.Helper()
+		outPath := strings.TrimSuffix(path, ".pdf") + ".json"
+		rootCmd.SetArgs([]string{"decode", "-i", path, "-o", outPath, "-P", "example"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entries []internal.VaultEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			// a document per entry holds a single entry
+			var entry internal.VaultEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	rootCmd.SetArgs([]string{"generate", "--from", "keepass", "-i", inPath, "-o", filepath.Join(tempDir, "none.pdf"), "-P", "example"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for an unknown vault export format")
+	}
+	resetFlags(generateCmd)
+
+	pdfPath := filepath.Join(tempDir, "vault.pdf")
+	rootCmd.SetArgs([]string{"generate", "--from", "bitwarden", "--folder", "banking", "-i", inPath, "-o", pdfPath, "-P", "example", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(generateCmd)
+	entries := decode(pdfPath)
+	if len(entries) != 2 || entries[0].Password != "hunter2" || entries[1].Notes != "12-34-56" {
+		t.Fatalf("Expected the two entries in the Banking folder, got: %v", entries)
+	}
+
+	pdfPath = filepath.Join(tempDir, "list.pdf")
+	rootCmd.SetArgs([]string{"generate", "--from", "bitwarden", "--entry", "shopping list", "-i", inPath, "-o", pdfPath, "-P", "example", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(generateCmd)
+	if entries := decode(pdfPath); len(entries) != 1 || entries[0].Notes != "milk" {
+		t.Fatalf("Expected the shopping list, got: %v", entries)
+	}
+
+	// the file is checked to be a KeePass database, once the master password is read
+	passwordPath := filepath.Join(tempDir, "master.txt")
+	if err := os.WriteFile(passwordPath, []byte("master password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"generate", "--from", "keepass", "--kdbx-password-file", passwordPath, "-i", inPath, "-o", filepath.Join(tempDir, "none.pdf"), "-P", "example"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "not a KeePass database") {
+		t.Fatalf("Expected an error for an export read as a KeePass database, got %v", err)
+	}
+	resetFlags(generateCmd)
+
+	sheetPath := filepath.Join(tempDir, "sheet.pdf")
+	rootCmd.SetArgs([]string{"generate", "--from", "bitwarden", "--per-entry", "-i", inPath, "-o", sheetPath, "-P", "example", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(generateCmd)
+	for i, name := range []string{"Bank", "Safe", "Shopping List"} {
+		entries := decode(internal.PagePath(sheetPath, i+1, 3))
+		if len(entries) != 1 || entries[0].Name != name {
+			t.Fatalf("Expected the document of %s, got: %v", name, entries)
+		}
+	}
+}
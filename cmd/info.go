@@ -0,0 +1,225 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// Fields printed by info, in addition to the header fields of the document.
+const (
+	infoFieldReadBackPhrase = "Read-Back Phrase"
+	infoFieldCipher         = "Cipher"
+	infoFieldKDF            = "Key Derivation"
+	infoFieldIntegrity      = "Integrity"
+)
+
+var infoCmd = &cobra.Command{
+	Aliases:           []string{"i"},
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "info [<input>]",
+	Short:             "Show the metadata of a document, without decrypting it",
+	Long: `This command shows the metadata of a document, without asking for the passphrase:
+its serial number, purpose, comment, creation date, the version of PaperCrypt that generated it,
+how the data is written (for the text of a document), the length and checksums of the content,
+its read-back phrase, and how the data is encrypted (cipher and key derivation), as read from the OpenPGP packets.
+
+The document is read like 'restore' does, from a PDF, the text of a document, a scan of its 2D code,
+the payload of the code, or a bare OpenPGP message. Use it to catalog a drawer full of sheets.`,
+	Example: `papercrypt info document.pdf
+papercrypt info scan.png`,
+	RunE: func(_ *cobra.Command, args []string) error {
+		// 1. Open output file
+		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
+			if err != nil {
+				log.WithError(err).Error("Error closing file")
+			}
+		}(outFile)
+
+		// 2. Read the document
+		fields, err := readDocumentInfo(args)
+		if err != nil {
+			return err
+		}
+
+		// 3. Write the fields, aligned by their names
+		return writeFields(outFile, fields)
+	},
+}
+
+// writeFields writes pairs of field names and values, one per line, aligned by their names.
+func writeFields(w io.Writer, fields [][2]string) error {
+	width := 0
+	for _, field := range fields {
+		width = max(width, len(field[0]))
+	}
+	for _, field := range fields {
+		if _, err := fmt.Fprintf(w, "%-*s %s\n", width+1, field[0]+":", field[1]); err != nil {
+			return errors.Join(errors.New("error writing to file"), err)
+		}
+	}
+
+	return nil
+}
+
+// readDocumentInfo reads the document from the inputs given as arguments, or from the input file,
+// and returns its metadata, as pairs of field names and values.
+func readDocumentInfo(args []string) ([][2]string, error) {
+	kind, inputs, contents, err := readInputs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return documentInfo(kind, inputs, contents)
+}
+
+// documentInfo returns the metadata of the document read from inputs of the given kind, see readDocumentInfo.
+func documentInfo(kind restoreInput, inputs []string, contents [][]byte) ([][2]string, error) {
+	var pc *core.PaperCrypt
+	var err error
+	var headers map[string]string
+	if kind == restoreInputMessage {
+		pc, err = core.NewPaperCryptFromPGPMessage(contents[0])
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading OpenPGP message"), err)
+		}
+	} else {
+		text, err := documentText(kind, inputs, contents)
+		if err != nil {
+			return nil, err
+		}
+		pc, err = deserializeDocument(text)
+		if err != nil {
+			return nil, err
+		}
+
+		// how the data is written is only known from the text of a document, the 2D code holds the data itself
+		if kind == restoreInputText {
+			headerSection, _, err := core.SplitTextHeaderAndBody(text)
+			if err != nil {
+				return nil, errors.Join(errors.New("header not found"), err)
+			}
+			headers, err = core.TextToHeaderMap(headerSection)
+			if err != nil {
+				return nil, errors.Join(errors.New("error reading headers"), err)
+			}
+		}
+	}
+
+	purpose, comment := pc.Purpose, pc.Comment
+	if pc.PrivateMetadata {
+		// only known once the data is decrypted
+		purpose, comment = "(encrypted)", "(encrypted)"
+	}
+	fields := [][2]string{
+		{core.HeaderFieldSerial, pc.SerialNumber},
+		{core.HeaderFieldPurpose, purpose},
+		{core.HeaderFieldComment, comment},
+		{core.HeaderFieldDate, core.FormatTimeStamp(pc.CreatedAt)},
+	}
+	if !pc.ExpiresAt.IsZero() {
+		fields = append(fields, [2]string{core.HeaderFieldExpires, core.FormatDueDate(pc.ExpiresAt)})
+	}
+	if !pc.ReviewBy.IsZero() {
+		fields = append(fields, [2]string{core.HeaderFieldReviewBy, core.FormatDueDate(pc.ReviewBy)})
+	}
+	if pc.Supersedes != "" {
+		fields = append(fields, [2]string{core.HeaderFieldSupersedes, pc.Supersedes})
+	}
+	warnOverdue(pc)
+	fields = append(fields, [][2]string{
+		{core.HeaderFieldVersion, pc.Version},
+		{core.HeaderFieldFormatVersion, pc.ContainerVersion().String()},
+		{core.HeaderFieldDataFormat, pc.DataFormat.String()},
+	}...)
+	if headers != nil {
+		fields = append(fields,
+			[2]string{core.HeaderFieldDataEncoding, headerOrDefault(headers, core.HeaderFieldDataEncoding, core.PaperCryptDataEncodingBase16.String())},
+			[2]string{core.HeaderFieldDataLayout, headerOrDefault(headers, core.HeaderFieldDataLayout, core.DefaultDataLayout.String())},
+			[2]string{core.HeaderFieldLineChecksum, headerOrDefault(headers, core.HeaderFieldLineChecksum, core.LineChecksumCRC24.String())},
+			[2]string{core.HeaderFieldErrorCorrection, headerOrDefault(headers, core.HeaderFieldErrorCorrection, "none")},
+		)
+	}
+	fields = append(fields,
+		[2]string{core.HeaderFieldContentLength, fmt.Sprintf("%d bytes", pc.GetDataLength())},
+		[2]string{core.HeaderFieldCRC24, fmt.Sprintf("%06x", pc.DataCRC24)},
+		[2]string{core.HeaderFieldCRC32, fmt.Sprintf("%08x", pc.DataCRC32)},
+		[2]string{core.HeaderFieldSHA256, base64.StdEncoding.EncodeToString(pc.DataSHA256[:])},
+	)
+	if len(pc.PlaintextSHA256) > 0 {
+		fields = append(fields, [2]string{core.HeaderFieldPlaintextSHA256, base64.StdEncoding.EncodeToString(pc.PlaintextSHA256)})
+	}
+	if pc.HeaderMAC != nil {
+		// the MAC is keyed by the passphrase, it is checked by decode
+		fields = append(fields, [2]string{core.HeaderFieldMACAlgorithm, pc.HeaderMAC.Algorithm.String() + " (verified by decode)"})
+	}
+	fields = append(fields, [2]string{infoFieldReadBackPhrase, pc.ReadBackPhrase()})
+
+	encryption, err := pc.EncryptionInfo()
+	switch {
+	case err != nil:
+		// the metadata is still useful, even if the packets cannot be read
+		log.WithError(err).Warn("Could not read how the data is encrypted")
+	case encryption == nil:
+		fields = append(fields, [2]string{infoFieldCipher, "none (raw data, encrypted outside of PaperCrypt, if at all)"})
+	default:
+		fields = append(fields,
+			[2]string{infoFieldCipher, encryption.Cipher},
+			[2]string{infoFieldKDF, encryption.KDF},
+			[2]string{infoFieldIntegrity, encryption.Integrity},
+		)
+	}
+
+	return fields, nil
+}
+
+// headerOrDefault returns the value of a header field, or its default, if the field is not written.
+func headerOrDefault(headers map[string]string, field string, defaultValue string) string {
+	if value, ok := headers[field]; ok && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+
+	infoCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+	addScanJobsFlag(infoCmd)
+	addStrictFlag(infoCmd)
+}
@@ -0,0 +1,53 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(tempDir, "info.txt")
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"info", docPath, "-o", outPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Content Serial:", "Data Encoding:", "Content SHA-256:", "Cipher:"} {
+		if !strings.Contains(string(info), want) {
+			t.Fatalf("Expected %q in the output, got:\n%s", want, info)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	keyGPGKeyID       string
+	keyGPGPath        string
+	keyPublicKeyPath  string
+	keyArmor          bool
+	keyImport         bool
+	keySSHFingerprint string
+)
+
+var keyCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "key",
+	Short:        "Back up, and restore, OpenPGP secret keys, and SSH private keys. Subcommands: 'backup', 'restore'",
+	Long: `These commands back up an OpenPGP secret key on paper, like paperkey (https://www.jabberwocky.com/software/paperkey/):
+only the secret parts of the key, and of its subkeys, are stored in the document, as everything else
+(the public keys, user IDs, and signatures) can be restored from the public key.
+This makes the document a fraction of the size of the exported secret key.
+
+The secrets are stored in the raw format of paperkey, so the decrypted document can also be restored using paperkey.
+
+SSH private keys (as written by ssh-keygen) are backed up as they are, the type, fingerprint, and comment of the key
+are printed on the document, so it can be told which key it holds, and the fingerprint is checked when restoring it.`,
+}
+
+var keyBackupCmd = &cobra.Command{
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() != 0 && len(args) > 0 {
+			return fmt.Errorf("unexpected argument '%s', flags of 'generate' follow --", args[0])
+		}
+
+		return nil
+	},
+	SilenceUsage: true,
+	Use:          "backup [-- <generate flags>...]",
+	Short:        "Generate a document holding the secret parts of an OpenPGP key, or an SSH private key",
+	Long: `This command extracts the secret parts of an OpenPGP secret key, and of its subkeys,
+and generates a document holding them, encrypted with a passphrase (see 'generate'),
+and prints how to restore the key.
+
+The key is exported from the keyring of GnuPG with --gpg-key, gpg may ask for its passphrase,
+or read from the input file, as exported by 'gpg --export-secret-keys' (ASCII armored, or binary).
+The secrets stay protected by the passphrase of the key, if it has one.
+
+SSH private keys are read from the input file, and told apart by their contents. Their type, and fingerprint,
+and the comment of the public key next to it (such as id_ed25519.pub), if there is one, are written to the comment of the document.
+
+Flags following -- are passed on to 'generate', such as --paper, or --purpose.`,
+	Example: `papercrypt key backup --gpg-key 0x1234ABCD -o key.pdf
+gpg --export-secret-keys 0x1234ABCD | papercrypt key backup -o key.pdf -- --paper letter
+papercrypt key backup -i ~/.ssh/id_ed25519 -o ssh-key.pdf`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var secretKey []byte
+		var err error
+		if keyGPGKeyID != "" {
+			if inFileName != "" {
+				return errors.New("--gpg-key can not be combined with --in")
+			}
+
+			var gpg *internal.GnuPG
+			gpg, err = internal.NewGnuPG(keyGPGPath)
+			if err != nil {
+				return errors.Join(err, errors.New("alternatively, export the key yourself"))
+			}
+			log.WithField("key", keyGPGKeyID).Info("Exporting the secret key from GnuPG...")
+			secretKey, err = gpg.ExportSecretKey(keyGPGKeyID)
+		} else {
+			secretKey, err = internal.PrintInputAndRead(inFileName)
+		}
+		if err != nil {
+			return err
+		}
+
+		backup := backupOpenPGPKey
+		if internal.IsSSHPrivateKey(secretKey) {
+			backup = backupSSHKey
+		}
+		data, err := backup(secretKey)
+		if err != nil {
+			return err
+		}
+
+		// the purpose, and comment, may be replaced by flags passed on to generate
+		presetInput = data.secrets
+		defer func() {
+			presetInput = nil
+		}()
+		generateArgs := append([]string{"--purpose", data.purpose, "--comment", data.comment}, args...)
+		if err := runWizardCommand(generateCmd, generateArgs, ""); err != nil {
+			return err
+		}
+
+		cmd.Println(data.instructions)
+		return nil
+	},
+}
+
+var keyRestoreCmd = &cobra.Command{
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "restore [<input>...]",
+	Short:             "Restore an OpenPGP secret key, with its public key, or an SSH private key, from a document generated by 'key backup'",
+	Long: `This command restores the document (see 'restore'), and combines the secrets it holds
+with the public key, given with --public-key (ASCII armored, or binary), or exported from the keyring of GnuPG with --gpg-key,
+into the full secret key, and writes it to the output, ASCII armored for .asc files, the terminal, or with --armor.
+With --import, it is imported into the keyring of GnuPG instead, using 'gpg --import', and only written if --out is given.
+
+The secrets are checked against the public key: restoring fails if a key, or subkey, has no secret,
+or if the secret of a key without a passphrase is damaged.
+
+SSH private keys are written as they are, readable only by their owner, once their fingerprint is checked against
+the one recorded in the comment of the document, or given with --ssh-fingerprint.`,
+	Example: `papercrypt key restore key.pdf --public-key public.asc -o secret.gpg
+papercrypt key restore scan.png --gpg-key 0x1234ABCD -o secret.asc
+papercrypt key restore key.pdf --public-key public.asc --import
+papercrypt key restore ssh-key.pdf -o ~/.ssh/id_ed25519`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if keyPublicKeyPath != "" && keyGPGKeyID != "" {
+			return errors.New("--public-key can not be combined with --gpg-key")
+		}
+
+		// 1. Open output file, with --import, the key is only written to a file if one is given
+		var outFile *os.File
+		var err error
+		if !keyImport || outFileName != "" {
+			outFile, err = internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+			if err != nil {
+				return err
+			}
+			defer func(file *os.File) {
+				err := internal.CloseFileIfNotStd(file)
+				if err != nil {
+					log.WithError(err).Error("Error closing file")
+				}
+			}(outFile)
+		}
+
+		// 2. Read, and decrypt the document
+		pc, err := readRestoreInputs(args)
+		if err != nil {
+			return err
+		}
+		passphraseBytes, err := readDecryptionPassphrase(cmd)
+		if err != nil {
+			return err
+		}
+		decoded, err := pc.Decode(passphraseBytes)
+		if err != nil {
+			return errors.Join(errors.New("error decrypting data"), err)
+		}
+		logPrivateMetadata(pc)
+		if err := verifyDecoded(pc, decoded); err != nil {
+			return err
+		}
+
+		// 3. Restore the key, checking it against the public key, or the fingerprint recorded on the document
+		var key []byte
+		sshKey := internal.IsSSHPrivateKey(decoded)
+		if sshKey {
+			key, err = restoreSSHKey(pc, decoded)
+		} else {
+			key, err = restoreOpenPGPKey(decoded)
+		}
+		if err != nil {
+			return err
+		}
+		if outFile == nil {
+			return nil
+		}
+
+		// 4. Write to file, OpenPGP keys ASCII armored for .asc files, and the terminal
+		switch {
+		case sshKey && outFile != os.Stdout:
+			// ssh refuses private keys others can read
+			if err := outFile.Chmod(0o600); err != nil {
+				return errors.Join(errors.New("error restricting the permissions of the key file"), err)
+			}
+		case !sshKey && (keyArmor || outFile == os.Stdout || strings.EqualFold(filepath.Ext(outFileName), ".asc")):
+			armored, err := internal.ArmorSecretKey(key)
+			if err != nil {
+				return errors.Join(errors.New("error armoring the secret key"), err)
+			}
+			key = []byte(armored)
+		}
+		n, err := outFile.Write(key)
+		if err != nil {
+			return errors.Join(errors.New("error writing to file"), err)
+		}
+
+		internal.PrintWrittenSize(n, outFile)
+		if !sshKey && !keyImport {
+			log.Info("Import the secret key using 'gpg --import', or 'key restore --import'")
+		}
+		return nil
+	},
+}
+
+// keyBackup is the data of a document generated by 'key backup', and how it is described.
+type keyBackup struct {
+	secrets      []byte
+	purpose      string
+	comment      string
+	instructions string
+}
+
+// backupOpenPGPKey extracts the secrets of an OpenPGP secret key, see internal.ExtractPaperKey.
+func backupOpenPGPKey(secretKey []byte) (keyBackup, error) {
+	secrets, err := internal.ExtractPaperKey(secretKey)
+	if err != nil {
+		return keyBackup{}, errors.Join(errors.New("error extracting the secrets of the key"), err)
+	}
+	keys, err := internal.ReadPaperKey(secrets)
+	if err != nil {
+		return keyBackup{}, err
+	}
+	fingerprint := internal.FormatFingerprint(keys[0].Fingerprint)
+	log.WithField("fingerprint", fingerprint).
+		WithField("subkeys", len(keys)-1).
+		WithField("size", fmt.Sprintf("%d bytes", len(secrets))).
+		Info("Extracted the secrets of the key")
+
+	return keyBackup{
+		secrets:      secrets,
+		purpose:      "OpenPGP secret key",
+		comment:      "Fingerprint " + fingerprint,
+		instructions: keyRestoreInstructions(fingerprint),
+	}, nil
+}
+
+// backupSSHKey backs up an SSH private key as it is, described by its type, fingerprint, and comment,
+// read from the public key next to the input file (such as id_ed25519.pub), if there is one.
+func backupSSHKey(privateKey []byte) (keyBackup, error) {
+	info, err := internal.ReadSSHPrivateKey(privateKey)
+	if err != nil {
+		return keyBackup{}, err
+	}
+	if inFileName != "" && inFileName != "-" {
+		if publicKey, err := os.ReadFile(inFileName + ".pub"); err == nil {
+			info.Comment, err = internal.ReadSSHPublicKeyComment(publicKey, info.Fingerprint)
+			if err != nil {
+				log.WithError(err).WithField("file", inFileName+".pub").Warn(core.Warning("The comment of the SSH key could not be read"))
+			}
+		}
+	}
+	log.WithField("key", info.String()).WithField("encrypted", info.Encrypted).Info("Read the SSH private key")
+
+	return keyBackup{
+		secrets:      privateKey,
+		purpose:      "OpenSSH private key",
+		comment:      info.String(),
+		instructions: sshKeyRestoreInstructions(info),
+	}, nil
+}
+
+// restoreOpenPGPKey combines the secrets of an OpenPGP key with the public key, see internal.RestorePaperKey,
+// and imports the secret key into the keyring of GnuPG, with --import.
+func restoreOpenPGPKey(secrets []byte) ([]byte, error) {
+	var gpg *internal.GnuPG
+	var err error
+	if keyGPGKeyID != "" || keyImport {
+		gpg, err = internal.NewGnuPG(keyGPGPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var publicKey []byte
+	switch {
+	case keyPublicKeyPath != "":
+		publicKey, err = os.ReadFile(keyPublicKeyPath)
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading the public key"), err)
+		}
+	case keyGPGKeyID != "":
+		publicKey, err = gpg.ExportPublicKey(keyGPGKeyID)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("the document holds an OpenPGP key, give its public key with --public-key, or --gpg-key")
+	}
+
+	secretKey, err := internal.RestorePaperKey(publicKey, secrets)
+	if err != nil {
+		return nil, core.WithCategory(core.ErrorCategoryChecksum, errors.Join(errors.New("error restoring the secret key"), err))
+	}
+
+	if keyImport {
+		report, err := gpg.ImportKey(secretKey)
+		if err != nil {
+			return nil, errors.Join(errors.New("error importing the secret key"), err)
+		}
+		log.Debug(report)
+		log.Info("Imported the secret key into the keyring of GnuPG")
+	}
+
+	return secretKey, nil
+}
+
+// restoreSSHKey checks that the SSH private key restored from the document is the one it was generated for,
+// by the fingerprint given with --ssh-fingerprint, or else recorded in the comment of the document.
+func restoreSSHKey(pc *core.PaperCrypt, privateKey []byte) ([]byte, error) {
+	if keyImport || keyPublicKeyPath != "" || keyGPGKeyID != "" {
+		return nil, errors.New("the document holds an SSH key, --import, --public-key, and --gpg-key only apply to OpenPGP keys")
+	}
+
+	info, err := internal.ReadSSHPrivateKey(privateKey)
+	if err != nil {
+		return nil, core.WithCategory(core.ErrorCategoryChecksum, err)
+	}
+
+	expected := keySSHFingerprint
+	if expected == "" {
+		var ok bool
+		expected, ok = internal.FindSSHFingerprint(pc.Comment)
+		if !ok {
+			log.Warn(core.Warning("The document records no fingerprint of the SSH key, check it using 'ssh-keygen -l -f <key>'"))
+			return privateKey, nil
+		}
+	}
+	if info.Fingerprint != expected {
+		return nil, core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("the fingerprint of the restored SSH key, %s, does not match %s", info.Fingerprint, expected))
+	}
+	log.WithField("key", info.String()).Info("Verified the fingerprint of the SSH key")
+
+	return privateKey, nil
+}
+
+// keyRestoreInstructions explains how to restore the key with the fingerprint from the document written by 'key backup'.
+func keyRestoreInstructions(fingerprint string) string {
+	document := outFileName
+	if document == "" {
+		document = "<document>"
+	}
+
+	return fmt.Sprintf(`The public key is needed to restore the secret key, keep a copy of it, or publish it to a keyserver:
+    gpg --export %[1]s > public.gpg
+Restore the secret key into the keyring of GnuPG using PaperCrypt:
+    papercrypt key restore %[2]s --public-key public.gpg --import
+Or using paperkey, as the decrypted document holds the secrets in its raw format:
+    papercrypt restore %[2]s -o secrets.bin
+    paperkey --pubring public.gpg --secrets secrets.bin --input-type raw --output secret.gpg
+    gpg --import secret.gpg`, fingerprint, document)
+}
+
+// sshKeyRestoreInstructions explains how to restore the SSH key from the document written by 'key backup'.
+func sshKeyRestoreInstructions(info internal.SSHKeyInfo) string {
+	document := outFileName
+	if document == "" {
+		document = "<document>"
+	}
+	name := "id_" + strings.TrimPrefix(info.Type, "ssh-")
+	if strings.HasPrefix(info.Type, "ecdsa-") {
+		name = "id_ecdsa"
+	}
+
+	return fmt.Sprintf(`Restore the SSH key, checking its fingerprint (%[1]s), using PaperCrypt:
+    papercrypt key restore %[2]s -o ~/.ssh/%[3]s
+Or without checking it:
+    papercrypt restore %[2]s -o ~/.ssh/%[3]s
+    chmod 600 ~/.ssh/%[3]s`, info.Fingerprint, document, name)
+}
+
+func init() {
+	keyCmd.AddCommand(keyBackupCmd, keyRestoreCmd)
+	rootCmd.AddCommand(keyCmd)
+
+	for _, cmd := range []*cobra.Command{keyBackupCmd, keyRestoreCmd} {
+		cmd.Flags().StringVar(&keyGPGKeyID, "gpg-key", "", "ID, or fingerprint, of the key to export from the keyring of GnuPG")
+		cmd.Flags().StringVar(&keyGPGPath, "gpg", "gpg", "Path of the gpg program, used by --gpg-key")
+	}
+
+	keyRestoreCmd.Flags().StringVar(&keyPublicKeyPath, "public-key", "", "File holding the public key (ASCII armored, or binary), as exported by 'gpg --export'")
+	keyRestoreCmd.Flags().BoolVar(&keyArmor, "armor", false, "Write the secret key ASCII armored, instead of binary (the default for .asc files, and the terminal)")
+	keyRestoreCmd.Flags().StringVar(&keySSHFingerprint, "ssh-fingerprint", "", "SHA-256 fingerprint the restored SSH key must have, as shown by 'ssh-keygen -l' (default: the one recorded in the comment of the document)")
+	keyRestoreCmd.Flags().BoolVar(&keyImport, "import", false, "Import the secret key into the keyring of GnuPG, using 'gpg --import', instead of writing it (unless --out is given)")
+	keyRestoreCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Passphrase to use for decryption (not recommended, will be prompted for if not provided)")
+	addPassphraseSourceFlags(keyRestoreCmd)
+
+	_ = keyRestoreCmd.RegisterFlagCompletionFunc("public-key", completeFiles("asc", "gpg", "pgp", "key"))
+}
@@ -0,0 +1,225 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKeyBackup(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	defer resetFlags(rootCmd)
+	for _, cmd := range []*cobra.Command{generateCmd, keyBackupCmd, keyRestoreCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+
+	key, err := crypto.GenerateKey("Owner", "owner@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := key.Lock([]byte("key passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretKey, err := locked.Armor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := locked.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	secretKeyPath := filepath.Join(tempDir, "secret.asc")
+	publicKeyPath := filepath.Join(tempDir, "public.asc")
+	for path, content := range map[string]string{secretKeyPath: secretKey, publicKeyPath: publicKey} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pdfPath := filepath.Join(tempDir, "key.pdf")
+
+	// arguments are only passed on to generate after --
+	rootCmd.SetArgs([]string{"key", "backup", "-i", secretKeyPath, "-o", pdfPath, "letter"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "unexpected argument") {
+		t.Fatalf("Expected an error for an argument before --, got %v", err)
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"key", "backup", "-i", secretKeyPath, "-o", pdfPath, "--", "-P", "example", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "papercrypt key restore "+pdfPath) {
+		t.Fatalf("Expected the restore instructions, got:\n%s", out.String())
+	}
+	resetFlags(rootCmd)
+
+	// written ASCII armored, as an .asc file
+	restoredPath := filepath.Join(tempDir, "restored.asc")
+	rootCmd.SetArgs([]string{"key", "restore", pdfPath, "--public-key", publicKeyPath, "-o", restoredPath, "-P", "example"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := os.ReadFile(restoredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredKey, err := crypto.NewKeyFromArmored(string(restored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restoredKey.IsPrivate() || restoredKey.GetFingerprint() != key.GetFingerprint() {
+		t.Fatalf("Expected the secret key %s, got %s", key.GetFingerprint(), restoredKey.GetFingerprint())
+	}
+	if _, err := restoredKey.Unlock([]byte("key passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+func TestKeyBackupSSH(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	defer resetFlags(rootCmd)
+	for _, cmd := range []*cobra.Command{generateCmd, keyBackupCmd, keyRestoreCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := ssh.FingerprintSHA256(sshPublic)
+
+	tempDir := t.TempDir()
+	keyPath := filepath.Join(tempDir, "id_ed25519")
+	privateKey := pem.EncodeToMemory(block)
+	for path, content := range map[string][]byte{keyPath: privateKey, keyPath + ".pub": append(bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshPublic)), " owner@example\n"...)} {
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pdfPath := filepath.Join(tempDir, "ssh-key.pdf")
+
+	rootCmd.SetArgs([]string{"key", "backup", "-i", keyPath, "-o", pdfPath, "--", "-P", "example", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(rootCmd)
+
+	// the key is identified on the document
+	infoPath := filepath.Join(tempDir, "info.txt")
+	rootCmd.SetArgs([]string{"info", pdfPath, "-o", infoPath})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.ReadFile(infoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(info), "ssh-ed25519 "+fingerprint+" owner@example") {
+		t.Fatalf("Expected the type, fingerprint, and comment of the key in the comment, got:\n%s", info)
+	}
+	resetFlags(rootCmd)
+
+	// a key with another fingerprint is not written
+	restoredPath := filepath.Join(tempDir, "restored")
+	rootCmd.SetArgs([]string{"key", "restore", pdfPath, "-o", restoredPath, "-P", "example", "--ssh-fingerprint", "SHA256:other"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+	resetFlags(keyRestoreCmd)
+
+	rootCmd.SetArgs([]string{"key", "restore", pdfPath, "-o", restoredPath, "-f", "-P", "example"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := os.ReadFile(restoredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, privateKey) {
+		t.Fatal("Expected the restored key to match the original")
+	}
+	if info, err := os.Stat(restoredPath); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0o600) {
+		t.Fatalf("Expected the key file to be readable by its owner only, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestGenKeyDeprecated(t *testing.T) {
+	list, err := os.ReadFile("../eff.org_files_2016_07_18_eff_large_wordlist.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordListString := string(list)
+	WordListFile = &wordListString
+	defer resetFlags(rootCmd)
+	defer resetFlags(generateKeyCmd)
+
+	outPath := filepath.Join(t.TempDir(), "phrase.txt")
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"gen-key", "--words", "12", "-o", outPath})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	phrase, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := strings.Fields(string(phrase)); len(words) != 12 {
+		t.Fatalf("Expected a phrase of 12 words, got %d", len(words))
+	}
+	if !strings.Contains(out.String(), "deprecated") {
+		t.Fatalf("Expected a deprecation notice, got %q", out.String())
+	}
+}
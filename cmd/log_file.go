@@ -0,0 +1,81 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// ansiEscape matches the escape sequences used to color log messages on a terminal.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// plainWriter writes to w without the escape sequences coloring the log, for a log file.
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := p.w.Write(ansiEscape.ReplaceAll(b, nil)); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// logFile is the file opened by --log-file, kept open until the program exits.
+var logFile *os.File
+
+// setupLogging sets the level of the log, and appends it to the file at path, if not empty,
+// in addition to stderr.
+func setupLogging(level log.Level, path string) error {
+	if logFile != nil {
+		_ = logFile.Close()
+		logFile = nil
+	}
+
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return errors.Join(errors.New("error opening log file"), err)
+		}
+		logFile = f
+		// separate the runs appended to the same file
+		if _, err := fmt.Fprintf(f, "--- papercrypt %s, %s\n", core.VersionInfo.GitVersion, time.Now().Format(time.RFC3339)); err != nil {
+			return errors.Join(errors.New("error writing log file"), err)
+		}
+		w = io.MultiWriter(os.Stderr, plainWriter{f})
+	}
+
+	logger := log.New(w)
+	logger.Level = level
+	log.Log = logger
+
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/caarlos0/log"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestLogFile(t *testing.T) {
+	resetFlags(decodeCmd)
+	defer resetFlags(decodeCmd)
+	defer func() {
+		core.TraceParsing = false
+		_ = setupLogging(log.InfoLevel, "")
+	}()
+
+	tempDir := t.TempDir()
+	inPath := tempDir + "/input.txt"
+	outPath := tempDir + "/output.json"
+	logPath := tempDir + "/papercrypt.log"
+
+	if err := os.WriteFile(inPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"decode", "-vv", "--log-file", logPath, "-i", inPath, "-o", outPath, "-P", "example"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	logged, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -vv traces how the lines of the document were read
+	if !strings.Contains(string(logged), "read line") || !strings.Contains(string(logged), "comparing block checksum") {
+		t.Fatalf("Expected the log file to trace the parsing of the document, got %s", logged)
+	}
+	// the document is of format version 2, without a header MAC
+	if !strings.Contains(string(logged), "The header of the document is not authenticated") {
+		t.Fatalf("Expected a warning about the unauthenticated header, got %s", logged)
+	}
+	if strings.Contains(string(logged), "\x1b[") {
+		t.Fatalf("Expected the log file to contain no escape sequences, got %q", logged)
+	}
+}
+
+func TestQuietVerboseExclusive(t *testing.T) {
+	resetFlags(decodeCmd)
+	defer resetFlags(decodeCmd)
+
+	rootCmd.SetArgs([]string{"decode", "-q", "-v", "-i", "missing.txt"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for --quiet and --verbose")
+	}
+}
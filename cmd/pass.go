@@ -0,0 +1,308 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+)
+
+var (
+	passStoreDir string
+	passGPGPath  string
+	passPer      string
+)
+
+// passPerValues are the values of --per, how the entries are split into documents, each followed by a tab and its description.
+var passPerValues = []string{"folder\ta document per folder", "entry\ta document per entry", "store\ta single document"}
+
+var passCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "pass",
+	Short:        "Back up, and restore, entries of a password store of pass. Subcommands: 'backup', 'restore'",
+	Long: `These commands back up the entries of a password store of pass (https://www.passwordstore.org) on paper,
+decrypting them using gpg, and restore them in place, encrypted again for the keys of the store.
+
+The path of each entry in the store, such as email/work, is stored in the document next to its content,
+so the entries are put back where they were, in the same, or another store.`,
+}
+
+var passBackupCmd = &cobra.Command{
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completePassEntries,
+	SilenceUsage:      true,
+	Use:               "backup [<entry, or folder>...] [-- <generate flags>...]",
+	Short:             "Generate documents holding entries of a password store",
+	Long: `This command decrypts the given entries, and the entries in the given folders, of the password store,
+or all of them, using gpg, which may ask for the passphrase of the key, and generates documents holding them,
+encrypted with a passphrase (see 'generate'): a document per folder, per entry, or a single document, with --per.
+Several documents are written to files numbered after --out, all encrypted with the same passphrase.
+
+The store is the one pass uses, in PASSWORD_STORE_DIR, or ~/.password-store, unless given with --store.
+
+Flags following -- are passed on to 'generate', such as --paper, or --purpose.`,
+	Example: `papercrypt pass backup -o pass.pdf
+papercrypt pass backup email social/mastodon --per entry -o pass.pdf -- --paper letter`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selected, generateArgs := args, []string(nil)
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			selected, generateArgs = args[:dash], args[dash:]
+		}
+		if passPer != "folder" && passPer != "entry" && passPer != "store" {
+			return fmt.Errorf("invalid value for --per: '%s', must be one of: folder, entry, store", passPer)
+		}
+
+		store, err := passStore()
+		if err != nil {
+			return err
+		}
+		paths, err := store.Entries(selected)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("no entries found in the password store at %s", store.Dir)
+		}
+		gpg, err := internal.NewGnuPG(passGPGPath)
+		if err != nil {
+			return err
+		}
+
+		// 1. Decrypt the entries, grouped into documents
+		var names []string
+		documents := make(map[string][]internal.PassEntry)
+		for _, entryPath := range paths {
+			content, err := gpg.Decrypt(store.File(entryPath))
+			if err != nil {
+				return errors.Join(fmt.Errorf("error decrypting the entry %s", entryPath), err)
+			}
+			log.WithField("entry", entryPath).Debug("Decrypted the entry")
+
+			name := ""
+			switch passPer {
+			case "entry":
+				name = entryPath
+			case "folder":
+				if name = path.Dir(entryPath); name == "." {
+					name = ""
+				}
+			}
+			if _, ok := documents[name]; !ok {
+				names = append(names, name)
+			}
+			documents[name] = append(documents[name], internal.NewPassEntry(entryPath, content))
+		}
+		log.WithField("entries", len(paths)).WithField("documents", len(names)).Info("Decrypted the entries of the password store")
+
+		// 2. Generate the documents, the flags following -- are parsed once, for all of them
+		if err := generateCmd.ParseFlags(generateArgs); err != nil {
+			return err
+		}
+		if extra := generateCmd.Flags().Args(); len(extra) > 0 {
+			return fmt.Errorf("unexpected argument '%s', entries, and folders, go before --", extra[0])
+		}
+		if len(names) > 1 {
+			if outFileName == "" || outFileName == "-" {
+				return errors.New("the entries are written to a document per folder, or entry, give the file name to number them after with --out")
+			}
+			if serialNumber != "" {
+				return errors.New("--serial-number can not be used for several documents, each gets a serial number of its own")
+			}
+			// the passphrase is asked for once, for all documents
+			if !generateDryRun {
+				passphraseBytes, err := readPassphrase(generateCmd, promptNewPassphrase)
+				if err != nil {
+					return err
+				}
+				presetPassphrase = passphraseBytes
+			}
+		}
+
+		out, cipherOut, documentPurpose, documentComment := outFileName, exportCipherPath, purpose, comment
+		defer func() {
+			outFileName, exportCipherPath, purpose, comment, serialNumber = out, cipherOut, documentPurpose, documentComment, ""
+			presetInput, presetPassphrase = nil, nil
+		}()
+		for i, name := range names {
+			data, err := json.MarshalIndent(internal.PassBackup{Entries: documents[name]}, "", "  ")
+			if err != nil {
+				return errors.Join(errors.New("error serializing the entries"), err)
+			}
+
+			presetInput = data
+			outFileName = internal.PagePath(out, i+1, len(names))
+			if cipherOut != "" {
+				exportCipherPath = internal.PagePath(cipherOut, i+1, len(names))
+			}
+			serialNumber = ""
+			purpose = "Password store"
+			if name != "" {
+				purpose += ": " + name
+			}
+			if generateCmd.Flags().Lookup("purpose").Changed {
+				purpose = documentPurpose
+				if len(names) > 1 && name != "" {
+					purpose += ": " + name
+				}
+			}
+			if !generateCmd.Flags().Lookup("comment").Changed {
+				comment = fmt.Sprintf("%d entries of a password store of pass, restore them using 'papercrypt pass restore'", len(documents[name]))
+			}
+
+			if err := generateCmd.RunE(generateCmd, nil); err != nil {
+				return errors.Join(fmt.Errorf("error generating the document of %s", purpose), err)
+			}
+		}
+
+		document := out
+		switch {
+		case len(names) > 1:
+			document = fmt.Sprintf("<document>, for each of %s to %s", internal.PagePath(out, 1, len(names)), internal.PagePath(out, len(names), len(names)))
+		case document == "" || document == "-":
+			document = "<document>"
+		}
+		cmd.Printf("Restore the entries into the password store using PaperCrypt:\n    papercrypt pass restore %s\n", document)
+		return nil
+	},
+}
+
+var passRestoreCmd = &cobra.Command{
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "restore [<input>...]",
+	Short:             "Restore entries of a password store from a document generated by 'pass backup'",
+	Long: `This command restores the document (see 'restore'), and puts each entry it holds back in its place
+in the password store, encrypted using gpg for the keys listed in the .gpg-id file of its folder,
+as pass does. The store must be initialized, using 'pass init <gpg-id>'.
+
+Restoring fails, before writing any entry, if one of them is already in the store, unless --force is given.`,
+	Example: `papercrypt pass restore pass.pdf
+papercrypt pass restore scan-1.png scan-2.png --store ~/.password-store-restored`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := passStore()
+		if err != nil {
+			return err
+		}
+		gpg, err := internal.NewGnuPG(passGPGPath)
+		if err != nil {
+			return err
+		}
+
+		// 1. Read, and decrypt the document
+		pc, err := readRestoreInputs(args)
+		if err != nil {
+			return err
+		}
+		passphraseBytes, err := readDecryptionPassphrase(cmd)
+		if err != nil {
+			return err
+		}
+		decoded, err := pc.Decode(passphraseBytes)
+		if err != nil {
+			return errors.Join(errors.New("error decrypting data"), err)
+		}
+		logPrivateMetadata(pc)
+		if err := verifyDecoded(pc, decoded); err != nil {
+			return err
+		}
+		backup, err := internal.ReadPassBackup(decoded)
+		if err != nil {
+			return err
+		}
+
+		// 2. Check that the entries can be restored, before writing any of them
+		recipients := make([][]string, len(backup.Entries))
+		for i, entry := range backup.Entries {
+			if _, err := os.Stat(store.File(entry.Path)); err == nil && !overrideOutFile {
+				return fmt.Errorf("the entry %s is already in the password store, use --force to replace it", entry.Path)
+			}
+			if recipients[i], err = store.Recipients(entry.Path); err != nil {
+				return err
+			}
+		}
+
+		// 3. Encrypt the entries into the store
+		for i, entry := range backup.Entries {
+			file := store.File(entry.Path)
+			if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+				return errors.Join(fmt.Errorf("error creating the folder of the entry %s", entry.Path), err)
+			}
+			if err := gpg.Encrypt(entry.Data(), recipients[i], file); err != nil {
+				return errors.Join(fmt.Errorf("error encrypting the entry %s", entry.Path), err)
+			}
+			log.WithField("entry", entry.Path).Debug("Restored the entry")
+		}
+
+		log.WithField("entries", len(backup.Entries)).WithField("store", store.Dir).Info("Restored the entries into the password store")
+		return nil
+	},
+}
+
+// passStore returns the password store given with --store, or else the one pass uses.
+func passStore() (*internal.PassStore, error) {
+	if passStoreDir != "" {
+		return &internal.PassStore{Dir: passStoreDir}, nil
+	}
+
+	return internal.DefaultPassStore()
+}
+
+// completePassEntries completes the entries of the password store.
+func completePassEntries(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	store, err := passStore()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	entries, err := store.Entries(nil)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return entries, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	passCmd.AddCommand(passBackupCmd, passRestoreCmd)
+	rootCmd.AddCommand(passCmd)
+
+	for _, cmd := range []*cobra.Command{passBackupCmd, passRestoreCmd} {
+		cmd.Flags().StringVar(&passStoreDir, "store", "", "Directory of the password store (default: PASSWORD_STORE_DIR, or ~/.password-store)")
+		cmd.Flags().StringVar(&passGPGPath, "gpg", "gpg", "Path of the gpg program, used to decrypt, and encrypt the entries")
+	}
+
+	passBackupCmd.Flags().StringVar(&passPer, "per", "folder", "Generate a document per folder, per entry, or a single document for the whole store (folder, entry, store)")
+	passRestoreCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Passphrase to use for decryption (not recommended, will be prompted for if not provided)")
+	addPassphraseSourceFlags(passRestoreCmd)
+
+	_ = passBackupCmd.RegisterFlagCompletionFunc("per", completeValues(passPerValues...))
+	_ = passBackupCmd.RegisterFlagCompletionFunc("store", completeDirectories)
+	_ = passRestoreCmd.RegisterFlagCompletionFunc("store", completeDirectories)
+}
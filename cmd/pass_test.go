@@ -0,0 +1,143 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestPassBackup(t *testing.T) {
+	gpg, err := internal.NewGnuPG("gpg")
+	if err != nil {
+		t.Skip("gpg is not installed")
+	}
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	defer resetFlags(rootCmd)
+	for _, cmd := range []*cobra.Command{generateCmd, passBackupCmd, passRestoreCmd} {
+		resetFlags(cmd)
+		defer resetFlags(cmd)
+	}
+
+	home := t.TempDir()
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() {
+		// stop the agent started for the keyring
+		_ = exec.Command("gpgconf", "--kill", "all").Run()
+	})
+	key, err := crypto.GenerateKey("Owner", "owner@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := key.Armor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpg.ImportKey([]byte(armored)); err != nil {
+		t.Fatal(err)
+	}
+	trust := exec.Command(gpg.Path, "--batch", "--import-ownertrust")
+	trust.Stdin = strings.NewReader(strings.ToUpper(key.GetFingerprint()) + ":6:\n")
+	if err := trust.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	storeDir, newStoreDir := filepath.Join(tempDir, "store"), filepath.Join(tempDir, "new")
+	store := &internal.PassStore{Dir: storeDir}
+	entries := map[string]string{"email/work": "hunter2\nuser: owner\n", "email/home": "secret\n", "server": "root password\n"}
+	for _, dir := range []string{storeDir, newStoreDir} {
+		if err := os.MkdirAll(filepath.Join(dir, "email"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".gpg-id"), []byte(key.GetFingerprint()+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for entry, content := range entries {
+		if err := gpg.Encrypt([]byte(content), []string{key.GetFingerprint()}, store.File(entry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a document per folder
+	pdfPath := filepath.Join(tempDir, "pass.pdf")
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"pass", "backup", "--store", storeDir, "-o", pdfPath, "--", "-P", "example", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "papercrypt pass restore") {
+		t.Fatalf("Expected the restore instructions, got:\n%s", out.String())
+	}
+	resetFlags(generateCmd)
+	resetFlags(passBackupCmd)
+
+	newStore := &internal.PassStore{Dir: newStoreDir}
+	for _, document := range []string{"pass-1.pdf", "pass-2.pdf"} {
+		rootCmd.SetArgs([]string{"pass", "restore", filepath.Join(tempDir, document), "--store", newStoreDir, "-P", "example"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for entry, content := range entries {
+		restored, err := gpg.Decrypt(newStore.File(entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(restored) != content {
+			t.Fatalf("Expected %q in the entry %s, got %q", content, entry, restored)
+		}
+	}
+
+	// entries in the store are only replaced with --force
+	rootCmd.SetArgs([]string{"pass", "restore", filepath.Join(tempDir, "pass-2.pdf"), "--store", newStoreDir, "-P", "example"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "already in the password store") {
+		t.Fatalf("Expected an error for an entry already in the store, got %v", err)
+	}
+	rootCmd.SetArgs([]string{"pass", "restore", filepath.Join(tempDir, "pass-2.pdf"), "--store", newStoreDir, "-P", "example", "--force"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(rootCmd)
+
+	// a single entry, in a single document
+	pdfPath = filepath.Join(tempDir, "server.pdf")
+	rootCmd.SetArgs([]string{"pass", "backup", "server", "--store", storeDir, "--per", "entry", "-o", pdfPath, "--", "-P", "example", "--no-qr", "--no-catalog"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pdfPath); err != nil {
+		t.Fatal(err)
+	}
+}
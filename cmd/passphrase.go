@@ -0,0 +1,189 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// passphraseEnv is the environment variable the passphrase is read from, if no other source is given.
+const passphraseEnv = "PAPERCRYPT_PASSPHRASE"
+
+// passphraseCacheName is the name the passphrase is cached under in the keychain, with --cache-passphrase.
+const passphraseCacheName = "passphrase"
+
+var (
+	passphraseFile     string
+	passphraseFD       int
+	passphraseCacheTTL time.Duration
+)
+
+// presetPassphrase is the passphrase chosen in the wizard, used in place of any other source, while it runs a command.
+var presetPassphrase []byte
+
+// addPassphraseSourceFlags adds the flags reading the passphrase from a file, or a file descriptor,
+// and caching it in the keychain, to a command, next to its --passphrase flag.
+func addPassphraseSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "Read the passphrase from the first line of this file, instead of prompting for it")
+	cmd.Flags().IntVar(&passphraseFD, "passphrase-fd", -1, "Read the passphrase from the first line of this file descriptor (such as 3, for 3<passphrase.txt), instead of prompting for it")
+	cmd.Flags().DurationVar(&passphraseCacheTTL, "cache-passphrase", 0, "Cache the passphrase in the keychain of the operating system for this long (such as 15m), and use the cached passphrase while it lasts (see 'forget-passphrase')")
+}
+
+// readPassphrase returns the passphrase given on the command line, or in the environment (see readPassphraseSource),
+// the passphrase cached in the keychain, with --cache-passphrase, or asks for it, using prompt.
+// With --cache-passphrase, the passphrase is cached, unless it was read from the cache.
+func readPassphrase(cmd *cobra.Command, prompt func() ([]byte, error)) ([]byte, error) {
+	var cache *internal.PassphraseCache
+	if cmd.Flags().Lookup("cache-passphrase").Changed {
+		var err error
+		cache, err = internal.NewPassphraseCache()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	passphraseBytes, ok, err := readPassphraseSource(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && cache != nil {
+		passphraseBytes, ok, err = cache.Load(passphraseCacheName)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			log.Info("Using the passphrase cached in the keychain")
+			return passphraseBytes, nil
+		}
+	}
+	if !ok {
+		passphraseBytes, err = prompt()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cache != nil {
+		if err := cache.Store(passphraseCacheName, passphraseBytes, passphraseCacheTTL); err != nil {
+			return nil, err
+		}
+		log.WithField("for", passphraseCacheTTL).Info("Cached the passphrase in the keychain, remove it earlier using 'papercrypt forget-passphrase'")
+	}
+
+	return passphraseBytes, nil
+}
+
+// readPassphraseSource returns the passphrase given with --passphrase, --passphrase-file, or --passphrase-fd,
+// or in the PAPERCRYPT_PASSPHRASE environment variable. ok is false if no source is given, and it is to be prompted for.
+func readPassphraseSource(cmd *cobra.Command) (passphraseBytes []byte, ok bool, err error) {
+	if presetPassphrase != nil {
+		return presetPassphrase, true, nil
+	}
+
+	var sources []string
+	for _, name := range []string{"passphrase", "passphrase-file", "passphrase-fd"} {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+			sources = append(sources, "--"+name)
+		}
+	}
+	if len(sources) > 1 {
+		return nil, false, fmt.Errorf("the passphrase can only be given once, got %s and %s", sources[0], sources[1])
+	}
+	if len(sources) == 0 {
+		if env, set := os.LookupEnv(passphraseEnv); set {
+			log.Warn(core.Warning(fmt.Sprintf("Using the passphrase in %s, unset it when done, as it is passed on to every program started from this shell", passphraseEnv)))
+			return []byte(env), true, nil
+		}
+
+		return nil, false, nil
+	}
+
+	switch sources[0] {
+	case "--passphrase":
+		log.Warn(core.Warning("The passphrase given with --passphrase may be seen by other users, and kept in the shell history, prefer --passphrase-file"))
+		passphraseBytes = []byte(passphrase)
+		passphrase = "" // clear passphrase
+		return passphraseBytes, true, nil
+	case "--passphrase-file":
+		passphraseBytes, err = readPassphraseFile(passphraseFile)
+	default:
+		if passphraseFD < 0 {
+			return nil, false, fmt.Errorf("invalid file descriptor %d", passphraseFD)
+		}
+		// the file descriptor is closed once read, it is of no further use
+		fdFile := os.NewFile(uintptr(passphraseFD), fmt.Sprintf("fd %d", passphraseFD))
+		defer fdFile.Close()
+		passphraseBytes, err = readPassphraseLine(fdFile)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return passphraseBytes, true, nil
+}
+
+// readPassphraseFile reads the passphrase from the first line of a file,
+// warning if other users may read the file.
+func readPassphraseFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("error opening passphrase file"), err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading passphrase file"), err)
+	}
+	// file permissions are not checked on Windows, where they are not represented by the mode
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		log.WithField("file", path).WithField("mode", info.Mode().Perm()).Warn(core.Warning("The passphrase file may be read by other users, restrict it using 'chmod 600'"))
+	}
+
+	return readPassphraseLine(file)
+}
+
+// readPassphraseLine reads the first line of r, without its line ending.
+func readPassphraseLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return nil, errors.Join(errors.New("error reading passphrase"), err)
+	}
+
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	if len(line) == 0 {
+		return nil, errors.New("the passphrase is empty")
+	}
+
+	return line, nil
+}
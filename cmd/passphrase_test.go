@@ -0,0 +1,114 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newPassphraseTestCommand returns a command with the passphrase flags, parsed from args.
+func newPassphraseTestCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "")
+	addPassphraseSourceFlags(cmd)
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd
+}
+
+func TestReadPassphraseSource(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "passphrase.txt")
+	if err := os.WriteFile(filePath, []byte("from file\r\nsecond line\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  string
+		want string
+	}{
+		{"flag", []string{"-P", "from flag"}, "", "from flag"},
+		{"file", []string{"--passphrase-file", filePath}, "", "from file"},
+		{"environment", nil, "from environment", "from environment"},
+		{"flag over environment", []string{"-P", "from flag"}, "from environment", "from flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv(passphraseEnv, tt.env)
+			}
+
+			got, ok, err := readPassphraseSource(newPassphraseTestCommand(t, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || string(got) != tt.want {
+				t.Fatalf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// the read end of a pipe, it is closed once read
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString("from file\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	got, ok, err := readPassphraseSource(newPassphraseTestCommand(t, "--passphrase-fd", strconv.Itoa(int(r.Fd()))))
+	_ = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || string(got) != "from file" {
+		t.Fatalf("Expected %q, got %q", "from file", got)
+	}
+
+	// without a source, the passphrase is prompted for
+	if _, ok, err := readPassphraseSource(newPassphraseTestCommand(t)); ok || err != nil {
+		t.Fatalf("Expected no passphrase, got ok: %t, error: %v", ok, err)
+	}
+
+	if _, _, err := readPassphraseSource(newPassphraseTestCommand(t, "-P", "a", "--passphrase-file", filePath)); err == nil {
+		t.Fatal("Expected several sources of the passphrase to be rejected")
+	}
+
+	emptyPath := filepath.Join(tempDir, "empty.txt")
+	if err := os.WriteFile(emptyPath, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readPassphraseSource(newPassphraseTestCommand(t, "--passphrase-file", emptyPath)); err == nil {
+		t.Fatal("Expected an empty passphrase to be rejected")
+	}
+}
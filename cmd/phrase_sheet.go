@@ -59,9 +59,7 @@ var phraseSheetCmd = &cobra.Command{
 			}
 		}(outFile)
 
-		if len(wordList) == 0 {
-			generateWordList()
-		}
+		loadWordList()
 
 		// 2. Generate seed (if not provided)
 		var seed int64
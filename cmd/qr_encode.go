@@ -0,0 +1,208 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	qrEncodeFormat     string
+	qrEncodeSize       int
+	qrEncodeCodeType   string
+	qrEncodePayload    string
+	qrEncodeEC         string
+	qrEncodeMaxVersion int
+	qrEncodeVersion    int
+)
+
+var qrEncodeCmd = &cobra.Command{
+	Aliases:      []string{"enc", "e"},
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "encode",
+	Short:        "Write the 2D code of a document as PNG or SVG image(s)",
+	Long: `This command reads an existing PaperCrypt document, either the text representation,
+or the JSON (or CBOR) payload of its 2D code, and writes its 2D code as a PNG or SVG image,
+so it can be re-printed on its own, or embedded in other documents.
+
+The image is at most --size pixels wide, including a quiet zone of 4 modules around the code.
+Large documents are split over several codes, just like in the PDF,
+they are written to numbered files next to --out (for example code-1.png, code-2.png).
+
+The code keeps the format version of the document. With --format-version 2, the header MAC of a document
+of format version 3 is left out, so older versions of PaperCrypt can read the code, which no longer authenticates the header.`,
+	Example: `papercrypt qr encode -i document.txt -o code.svg --format svg --code-type qr --qr-ec H`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format := strings.ToLower(qrEncodeFormat)
+		if format != "png" && format != "svg" {
+			return fmt.Errorf("unknown image format '%s', must be one of: png, svg", qrEncodeFormat)
+		}
+
+		code2D := core.Code2DTypeFromString(qrEncodeCodeType)
+		if code2D != core.Code2DTypeAztec && code2D != core.Code2DTypeQR {
+			return fmt.Errorf("unknown 2D code type '%s', must be one of: aztec, qr", qrEncodeCodeType)
+		}
+		opts := core.Code2DOptions{
+			Type:              code2D,
+			QRErrorCorrection: core.QRErrorCorrectionFromString(qrEncodeEC),
+			QRMaxVersion:      qrEncodeMaxVersion,
+		}
+		if err := opts.Validate(); err != nil {
+			return errors.Join(errors.New("invalid 2D code options"), err)
+		}
+		if code2D == core.Code2DTypeQR && !cmd.Flags().Lookup("qr-payload").Changed {
+			qrEncodePayload = "cbor"
+		}
+		payloadFormat := core.QRPayloadFormatFromString(qrEncodePayload)
+		if payloadFormat == core.QRPayloadFormatUnknown {
+			return fmt.Errorf("unknown 2D code payload format '%s', must be one of: json, cbor", qrEncodePayload)
+		}
+
+		// 1. Read the document
+		contents, err := internal.PrintInputAndRead(inFileName)
+		if err != nil {
+			return err
+		}
+
+		var pc *core.PaperCrypt
+		if core.DetectQRPayloadFormat(contents) != core.QRPayloadFormatUnknown {
+			pc, err = core.DeserializeQRPayload(contents)
+		} else {
+			contents, err = prepareDocumentText(contents)
+			if err == nil {
+				pc, err = deserializeDocument(contents)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if cmd.Flags().Lookup("format-version").Changed {
+			version, err := parseFormatVersionFlag(qrEncodeVersion)
+			if err != nil {
+				return err
+			}
+			if version > max(pc.FormatVersion, core.PaperCryptContainerVersionMajor2) {
+				return fmt.Errorf("the document is of an earlier format version, upgrade it using 'papercrypt upgrade --format-version %d' first", version)
+			}
+			if version < pc.FormatVersion {
+				log.Warn(core.Warning(fmt.Sprintf("The code is written in format version %d, its header is no longer authenticated.", version)))
+				pc.FormatVersion, pc.HeaderMAC = core.PaperCryptContainerVersionUnknown, nil
+			}
+		}
+
+		// 2. Encode the 2D code(s)
+		payload, err := pc.QRPayload(payloadFormat)
+		if err != nil {
+			return errors.Join(fmt.Errorf("error serializing PaperCrypt to %s", payloadFormat), err)
+		}
+
+		codes, err := core.Encode2DParts(payload, opts)
+		if err != nil {
+			return errors.Join(errors.New("error generating 2D code"), err)
+		}
+		if len(codes) > 1 && outFileName == "" {
+			return fmt.Errorf("the document is split over %d codes, use --out to write them to files", len(codes))
+		}
+
+		// 3. Write the image(s)
+		for i, code := range codes {
+			var image []byte
+			if format == "svg" {
+				image = internal.Code2DSVG(code, qrEncodeSize)
+			} else {
+				image, err = internal.Code2DPNG(code, qrEncodeSize)
+				if err != nil {
+					return errors.Join(errors.New("error generating 2D code image"), err)
+				}
+			}
+
+			fileName := outFileName
+			if len(codes) > 1 {
+				fileName = numberedFileName(outFileName, i+1)
+			}
+
+			if err := writeCodeImage(fileName, image); err != nil {
+				return err
+			}
+		}
+
+		log.WithField("codes", len(codes)).WithField("type", code2D).Info("2D code written.")
+		return nil
+	},
+}
+
+// numberedFileName inserts a number before the extension of a file name, "code.png" becomes "code-1.png".
+func numberedFileName(fileName string, number int) string {
+	ext := filepath.Ext(fileName)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(fileName, ext), number, ext)
+}
+
+func writeCodeImage(fileName string, image []byte) error {
+	outFile, err := internal.GetFileHandleCarefully(fileName, overrideOutFile)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := internal.CloseFileIfNotStd(file)
+		if err != nil {
+			log.WithError(err).Error("Error closing file")
+		}
+	}(outFile)
+
+	n, err := outFile.Write(image)
+	if err != nil {
+		return errors.Join(errors.New("error writing image"), err)
+	}
+
+	internal.PrintWrittenSize(n, outFile)
+	return nil
+}
+
+func init() {
+	scanCmd.AddCommand(qrEncodeCmd)
+
+	qrEncodeCmd.Flags().StringVar(&qrEncodeFormat, "format", "png", "Image format, either 'png' or 'svg'")
+	qrEncodeCmd.Flags().IntVar(&qrEncodeSize, "size", 1024, "Width (and height) of the image in pixels")
+	qrEncodeCmd.Flags().StringVar(&qrEncodeCodeType, "code-type", "aztec", "Type of the 2D code, either 'aztec', or 'qr' (byte mode, defaults to the cbor payload)")
+	qrEncodeCmd.Flags().StringVar(&qrEncodePayload, "qr-payload", "json", "Serialization of the document inside the 2D code, either 'json', or 'cbor'")
+	qrEncodeCmd.Flags().StringVar(&qrEncodeEC, "qr-ec", "M", "Error correction level of the QR code, either L, M, Q, or H")
+	qrEncodeCmd.Flags().IntVar(&qrEncodeMaxVersion, "qr-version", 0, "Largest QR code version (1-40) to use, larger payloads are split over several codes (0 for no limit)")
+
+	qrEncodeCmd.Flags().IntVar(&qrEncodeVersion, "format-version", 0, "Container format version of the payload, 2 leaves out the header MAC of a format version 3 document, for older versions of PaperCrypt (default: that of the document)")
+
+	addStrictFlag(qrEncodeCmd)
+
+	_ = qrEncodeCmd.RegisterFlagCompletionFunc("format", completeValues("png", "svg"))
+	_ = qrEncodeCmd.RegisterFlagCompletionFunc("code-type", completeValues("aztec", "qr"))
+	_ = qrEncodeCmd.RegisterFlagCompletionFunc("qr-payload", completeValues(qrPayloadValues...))
+	_ = qrEncodeCmd.RegisterFlagCompletionFunc("qr-ec", completeValues(qrECValues...))
+}
@@ -0,0 +1,194 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	reencryptNewPassphrase string
+	reencryptSerialNumber  string
+	reencryptReviewBy      string
+	reencryptFormatVersion int
+	reencryptNoQR          bool
+	reencryptPaperSize     string
+	reencryptLandscape     bool
+	reencryptLang          string
+)
+
+var reencryptCmd = &cobra.Command{
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "reencrypt [<input>]",
+	Short:             "Rotate the passphrase of a document, printing a new sheet",
+	Long: `This command reads a document, like 'restore' does (its text, JSON, a PDF, or scans of the sheet),
+asks for its passphrase, and a new one, and encrypts the data again using the new passphrase.
+The data is only decrypted in memory, it is never written to disk.
+
+The new document gets a new serial number, and notes the serial number of the old one in its header, as 'Supersedes'.
+Its purpose, comment, and dates are kept, but for the date of the document, which is today,
+and the review date, which is set anew with --review-by.
+Documents of format version 3 are authenticated again, keyed by the new passphrase.
+
+The new document is added to the catalog, unless --no-catalog is given.
+Check it using 'papercrypt verify', with the new passphrase, before discarding the old sheet.`,
+	Example: `papercrypt reencrypt old.pdf -o new.pdf
+papercrypt reencrypt scan.png -o new.pdf --review-by 5y`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := reprintOptions(reencryptPaperSize, reencryptLandscape, reencryptLang)
+		if err != nil {
+			return err
+		}
+		var version core.PaperCryptContainerVersion
+		if cmd.Flags().Lookup("format-version").Changed {
+			if version, err = parseFormatVersionFlag(reencryptFormatVersion); err != nil {
+				return err
+			}
+		}
+
+		// 1. Open output file
+		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
+			if err != nil {
+				log.WithError(err).Error("Error closing file")
+			}
+		}(outFile)
+
+		// 2. Read the document, and re-encrypt its data
+		pc, err := readRestoreInputs(args)
+		if err != nil {
+			return err
+		}
+		data, newPassphrase, err := reencryptDocument(cmd, pc, reencryptNewPassphrase)
+		if err != nil {
+			return err
+		}
+
+		// 3. Describe the new document
+		serial := reencryptSerialNumber
+		if serial == "" {
+			serial, err = core.GenerateSerialFromCharset(core.DefaultSerialLength, core.DefaultSerialCharset)
+			if err != nil {
+				return errors.Join(errors.New("error generating serial number"), err)
+			}
+		}
+		if serial == pc.SerialNumber {
+			return fmt.Errorf("the new document must have a serial number other than that of the old one, %s", pc.SerialNumber)
+		}
+
+		now := time.Now()
+		reencrypted := core.NewPaperCrypt(core.VersionInfo.GitVersion, data, serial, pc.Purpose, pc.Comment, now, pc.DataFormat)
+		// the plaintext is unchanged, and verified by decrypting it, so its checksum is kept
+		reencrypted.PlaintextSHA256 = pc.PlaintextSHA256
+		reencrypted.ExpiresAt = pc.ExpiresAt
+		reencrypted.ReviewBy = pc.ReviewBy
+		reencrypted.Supersedes = pc.SerialNumber
+		if pc.PrivateMetadata {
+			reencrypted.Purpose, reencrypted.Comment = "", ""
+			reencrypted.PrivateMetadata = true
+		}
+		if reencryptReviewBy != "" {
+			if reencrypted.ReviewBy, err = parseDueDateFlag("review-by", reencryptReviewBy, now); err != nil {
+				return err
+			}
+		}
+		if version == core.PaperCryptContainerVersionUnknown {
+			version = max(pc.FormatVersion, core.PaperCryptContainerVersionMajor2)
+		}
+		if version == core.PaperCryptContainerVersionMajor3 {
+			if err := reencrypted.Authenticate(newPassphrase); err != nil {
+				return err
+			}
+		}
+		log.WithField("serial", serial).WithField("supersedes", pc.SerialNumber).Info("Re-encrypted document")
+
+		// 4. Render the new document
+		doc, err := internal.GetPDF(reencrypted, reencryptNoQR, opts)
+		if err != nil {
+			return errors.Join(errors.New("error rendering the document"), err)
+		}
+
+		n, err := outFile.Write(doc)
+		if err != nil {
+			return errors.Join(errors.New("error writing to file"), err)
+		}
+		internal.PrintWrittenSize(n, outFile)
+
+		if !noCatalog {
+			catalog, err := internal.NewCatalog(catalogPath)
+			if err != nil {
+				return err
+			}
+			pages, err := internal.CountPDFPages(doc)
+			if err != nil {
+				return err
+			}
+			entry := internal.NewCatalogEntry(reencrypted, pages, catalogLocation)
+			// private purposes, and comments, are only kept, if given to 'catalog add' for the old document
+			if old, ok, err := catalog.Find(pc.SerialNumber); err == nil && ok && reencrypted.PrivateMetadata {
+				entry.Purpose, entry.Comment = old.Purpose, old.Comment
+			}
+			if err := addToCatalog(catalog, entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reencryptCmd)
+
+	reencryptCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Current passphrase of the document (not recommended, will be prompted for if not provided)")
+	addPassphraseSourceFlags(reencryptCmd)
+	reencryptCmd.Flags().StringVar(&reencryptNewPassphrase, "new-passphrase", "", "New passphrase (not recommended, will be prompted for if not provided)")
+	reencryptCmd.Flags().StringVarP(&reencryptSerialNumber, "serial-number", "s", "", "Serial number of the new sheet (optional, default: 6 random characters)")
+	reencryptCmd.Flags().StringVar(&reencryptReviewBy, "review-by", "", "New date by which the sheet should be printed again, and verified, such as 2030-01-31, or a period after today, such as 5y (default: keep the date of the document)")
+	reencryptCmd.Flags().IntVar(&reencryptFormatVersion, "format-version", 0, "Container format version of the new document, either 2, or 3 (authenticates the header by a MAC keyed by the new passphrase) (default: that of the document, at least 2)")
+	reencryptCmd.Flags().BoolVar(&noCatalog, "no-catalog", false, "Do not add the new document to the catalog")
+	reencryptCmd.Flags().StringVar(&catalogLocation, "location", "", "Where the new sheets will be stored, such as 'safe, top shelf', noted in the catalog")
+	reencryptCmd.Flags().BoolVar(&reencryptNoQR, "no-qr", false, "Do not generate 2D code (optional)")
+	reencryptCmd.Flags().StringVar(&reencryptPaperSize, "paper", "a4", "Paper size of the PDF document, either 'a4', 'letter', 'a5', or 'legal'")
+	reencryptCmd.Flags().BoolVar(&reencryptLandscape, "landscape", false, "Print the PDF document in landscape orientation")
+	reencryptCmd.Flags().StringVar(&reencryptLang, "lang", internal.DefaultLanguage, fmt.Sprintf("Language of the text printed on the document, one of: %s", strings.Join(internal.Languages(), ", ")))
+	reencryptCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+	addScanJobsFlag(reencryptCmd)
+	addStrictFlag(reencryptCmd)
+
+	_ = reencryptCmd.RegisterFlagCompletionFunc("paper", completePaperSizes)
+	_ = reencryptCmd.RegisterFlagCompletionFunc("lang", completeLanguages)
+}
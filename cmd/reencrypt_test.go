@@ -0,0 +1,165 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestReencrypt(t *testing.T) {
+	loadFonts(t)
+	// the version is set by the main package, documents of unknown versions are not read back
+	core.VersionInfo.GitVersion = "2.0.0"
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "old.txt")
+	if err := os.WriteFile(inPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, args := range map[string][]string{
+		"default":      {},
+		"authenticate": {"--format-version", "3"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			newPath := filepath.Join(t.TempDir(), "new.pdf")
+			cmd := rootCmd
+			cmd.SetArgs(append([]string{"reencrypt", inPath, "-o", newPath, "-P", "example", "--new-passphrase", "new", "-s", "ROTATE", "--no-catalog"}, args...))
+			defer resetFlags(reencryptCmd)
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			rendered, err := os.ReadFile(newPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			attachment, ok, err := internal.ExtractPDFAttachment(rendered)
+			if err != nil || !ok {
+				t.Fatalf("no document attached to the PDF: %v", err)
+			}
+			var pc core.PaperCrypt
+			if err := json.Unmarshal(attachment, &pc); err != nil {
+				t.Fatal(err)
+			}
+			if pc.SerialNumber != "ROTATE" || pc.Supersedes != "EIPESR" || pc.Purpose != "Example Sheet" {
+				t.Fatalf("Expected serial ROTATE superseding EIPESR, got %s superseding %s (purpose %s)", pc.SerialNumber, pc.Supersedes, pc.Purpose)
+			}
+
+			// the old passphrase no longer decrypts the document, the new one does
+			cmd.SetArgs([]string{"restore", newPath, "-o", filepath.Join(t.TempDir(), "rejected.json"), "-P", "example"})
+			if err := cmd.Execute(); err == nil {
+				t.Fatal("Expected the old passphrase to be rejected")
+			}
+			outPath := filepath.Join(t.TempDir(), "output.json")
+			cmd.SetArgs([]string{"restore", newPath, "-o", outPath, "-P", "new"})
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != input {
+				t.Fatalf("Expected %s, got %s", input, string(out))
+			}
+		})
+	}
+}
+
+func TestReencryptSameSerial(t *testing.T) {
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "old.txt")
+	if err := os.WriteFile(inPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"reencrypt", inPath, "-o", filepath.Join(tempDir, "new.pdf"), "-P", "example", "--new-passphrase", "new", "-s", "EIPESR", "--no-catalog"})
+	defer resetFlags(reencryptCmd)
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("Expected an error for the serial number of the old document")
+	}
+}
+
+func TestReencryptCatalog(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	resetFlags(generateCmd)
+	defer resetFlags(generateCmd)
+	defer resetFlags(catalogAddCmd)
+	defer resetFlags(reencryptCmd)
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "secret.json")
+	if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := filepath.Join(tempDir, "old.pdf")
+	catalogFile := filepath.Join(tempDir, "catalog.json")
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"generate", "-i", inPath, "-o", oldPath, "-P", "example", "--no-qr",
+		"--serial-number", "VAULT1", "--purpose", "Bank vault", "--private-metadata", "--catalog", catalogFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := internal.NewCatalog(catalogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencrypt := func(serial string) internal.CatalogEntry {
+		t.Helper()
+
+		// reencrypt has no --catalog flag, and shares the catalog given to generate
+		cmd.SetArgs([]string{"reencrypt", oldPath, "-o", filepath.Join(tempDir, serial+".pdf"), "-P", "example", "--new-passphrase", "new", "-s", serial})
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		entry, ok, err := catalog.Find(serial)
+		if err != nil || !ok {
+			t.Fatalf("Expected %s in the catalog: %v", serial, err)
+		}
+		return entry
+	}
+
+	// the private purpose, revealed by decrypting the document, is not written to the catalog
+	if entry := reencrypt("ROTATE"); entry.Purpose != "" || entry.Supersedes != "VAULT1" {
+		t.Fatalf("Expected no purpose, superseding VAULT1, got %q superseding %s", entry.Purpose, entry.Supersedes)
+	}
+
+	// unless it was given to catalog add for the old document
+	cmd.SetArgs([]string{"catalog", "add", oldPath, "--purpose", "Bank vault", "--catalog", catalogFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if entry := reencrypt("ROTATE2"); entry.Purpose != "Bank vault" {
+		t.Fatalf("Expected the purpose given to catalog add, got %q", entry.Purpose)
+	}
+}
@@ -0,0 +1,250 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// restoreInput is the kind of input restore reads a document from, see detectRestoreInput.
+type restoreInput uint8
+
+const (
+	// restoreInputScan is an image, a scanned PDF, or a TIFF file, holding the 2D code of the document.
+	restoreInputScan restoreInput = iota
+	// restoreInputPayload is the payload of the 2D code, JSON or CBOR.
+	restoreInputPayload
+	// restoreInputMessage is a bare OpenPGP message, see core.IsPGPMessage.
+	restoreInputMessage
+	// restoreInputText is the text of the document, as read by decode.
+	restoreInputText
+)
+
+// String returns the name of the kind of input.
+func (i restoreInput) String() string {
+	switch i {
+	case restoreInputScan:
+		return "scan"
+	case restoreInputPayload:
+		return "2D code payload"
+	case restoreInputMessage:
+		return "OpenPGP message"
+	case restoreInputText:
+		return "text"
+	default:
+		return "unknown"
+	}
+}
+
+// detectRestoreInput tells the kind of input from its contents.
+func detectRestoreInput(data []byte) restoreInput {
+	if internal.IsPDF(data) || internal.IsTIFF(data) {
+		return restoreInputScan
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		return restoreInputScan
+	}
+	if core.IsPGPMessage(data) {
+		return restoreInputMessage
+	}
+	if core.DetectQRPayloadFormat(data) != core.QRPayloadFormatUnknown {
+		return restoreInputPayload
+	}
+
+	return restoreInputText
+}
+
+var restoreCmd = &cobra.Command{
+	Aliases:           []string{"r"},
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "restore [<input>...]",
+	Short:             "Restore the data of a document in one step, from scans, the 2D code payload, or the text of the document",
+	Long: `This command restores the data of a document in one step, combining 'scan' and 'decode'.
+
+The kind of input is detected from its contents:
+images, scanned PDF, and TIFF files are scanned for the 2D code of the document (see 'scan'),
+the digital PDF documents generated by PaperCrypt are read from their attachment,
+JSON or CBOR files are read as the payload of the 2D code, bare OpenPGP messages are decrypted as they are,
+and anything else is read as the text of the document (see 'decode').
+Several images may be passed, holding the parts of a document split over several 2D codes.
+
+You will be asked for the passphrase, and the decrypted data is written to the output,
+after verifying its checksum, if it was printed (see 'generate --plaintext-hash').`,
+	Example: `papercrypt restore scan.png -o secrets.json
+papercrypt restore page-1.jpg page-2.jpg -o secrets.json
+papercrypt restore document.txt -o secrets.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// 1. Open output file
+		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
+			if err != nil {
+				log.WithError(err).Error("Error closing file")
+			}
+		}(outFile)
+
+		// 2. Read the document
+		pc, err := readRestoreInputs(args)
+		if err != nil {
+			return err
+		}
+
+		// 3. Decrypt
+		passphraseBytes, err := readDecryptionPassphrase(cmd)
+		if err != nil {
+			return err
+		}
+
+		decoded, err := pc.Decode(passphraseBytes)
+		if err != nil {
+			return errors.Join(errors.New("error decrypting data"), err)
+		}
+		logPrivateMetadata(pc)
+		if err := verifyDecoded(pc, decoded); err != nil {
+			return err
+		}
+
+		// 4. Write to file
+		n, err := outFile.Write(decoded)
+		if err != nil {
+			return errors.Join(errors.New("error writing to file"), err)
+		}
+
+		internal.PrintWrittenSize(n, outFile)
+		return nil
+	},
+}
+
+// readRestoreInputs reads the document from the inputs given as arguments, or from the input file,
+// telling their kind from their contents.
+func readRestoreInputs(args []string) (*core.PaperCrypt, error) {
+	kind, inputs, contents, err := readInputs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return restoreDocument(kind, inputs, contents)
+}
+
+// readInputs reads the inputs given as arguments, or the input file, and tells their kind from their contents.
+func readInputs(args []string) (restoreInput, []string, [][]byte, error) {
+	inputs, err := expandInputs(args)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if len(inputs) == 0 {
+		inputs = []string{inFileName}
+	}
+
+	contents := make([][]byte, len(inputs))
+	for i, input := range inputs {
+		contents[i], err = internal.PrintInputAndRead(input)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	kind := detectRestoreInput(contents[0])
+	for i := range inputs[1:] {
+		if kind != restoreInputScan || detectRestoreInput(contents[i+1]) != restoreInputScan {
+			return 0, nil, nil, errors.New("only images and scans can be combined, other inputs are read on their own")
+		}
+	}
+	log.WithField("input", kind).Debug("detected input")
+
+	return kind, inputs, contents, nil
+}
+
+// restoreDocument reads the document from inputs of the given kind.
+func restoreDocument(kind restoreInput, inputs []string, contents [][]byte) (*core.PaperCrypt, error) {
+	if kind == restoreInputMessage {
+		return readBareMessage(contents[0])
+	}
+
+	text, err := documentText(kind, inputs, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := deserializeDocument(text)
+	if err != nil {
+		return nil, err
+	}
+	if kind == restoreInputText {
+		log.WithField("phrase", core.Bold(pc.ReadBackPhrase())).Info("Read-back phrase")
+	}
+	warnOverdue(pc)
+	warnUnauthenticated(pc)
+
+	return pc, nil
+}
+
+// documentText returns the text of the document read from inputs of the given kind,
+// which is not available for bare OpenPGP messages.
+func documentText(kind restoreInput, inputs []string, contents [][]byte) ([]byte, error) {
+	switch kind {
+	case restoreInputScan, restoreInputPayload:
+		var data []byte
+		var err error
+		if kind == restoreInputScan {
+			data, err = readScannedPayload(inputs, contents)
+		} else {
+			data, err = payloadJSON(contents[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the read-back phrase is shown by payloadToText
+		return payloadToText(data)
+	case restoreInputText:
+		return prepareDocumentText(contents[0])
+	default:
+		return nil, fmt.Errorf("unsupported input: %s", kind)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Passphrase to use for decryption (not recommended, will be prompted for if not provided)")
+	addPassphraseSourceFlags(restoreCmd)
+	restoreCmd.Flags().BoolVar(&decompressMessage, "decompress", false, "Decompress the data of a bare OpenPGP message after decrypting it, for messages written by 'generate --export-cipher'")
+	restoreCmd.Flags().BoolVar(&ignoreMismatch, "ignore-mismatch", false, "Warn about checksum mismatches of the content or the decrypted data, instead of stopping")
+	restoreCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+	addScanJobsFlag(restoreCmd)
+	addStrictFlag(restoreCmd)
+	restoreCmd.Flags().BoolVar(&qrCmdColor, "color", false, "Read the layers of an experimental color code (see 'generate --code-type color')")
+}
@@ -0,0 +1,189 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestDetectRestoreInput(t *testing.T) {
+	code, err := core.Encode2D([]byte(input), core.Code2DOptions{Type: core.Code2DTypeQR})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := internal.Code2DImage(code, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		data []byte
+		want restoreInput
+	}{
+		"image":   {data: encoded.Bytes(), want: restoreInputScan},
+		"json":    {data: []byte(`{"v": "2.0.0"}`), want: restoreInputPayload},
+		"message": {data: []byte("-----BEGIN PGP MESSAGE-----\n"), want: restoreInputMessage},
+		"text":    {data: []byte(doc), want: restoreInputText},
+	} {
+		if got := detectRestoreInput(tc.data); got != tc.want {
+			t.Errorf("Detection of %s was incorrect, got: %s, want: %s.", name, got, tc.want)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := deserializeDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cbor, err := pc.QRPayload(core.QRPayloadFormatCBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cborPath := filepath.Join(tempDir, "payload.cbor")
+	if err := os.WriteFile(cborPath, cbor, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage([]byte(input)), []byte("example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messagePath := filepath.Join(tempDir, "message.gpg")
+	if err := os.WriteFile(messagePath, encrypted.GetBinary(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"qr", "encode", "-i", docPath, "-o", filepath.Join(tempDir, "code.png")})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, inputPath := range map[string]string{
+		"text":    docPath,
+		"payload": cborPath,
+		"message": messagePath,
+		"image":   filepath.Join(tempDir, "code.png"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "output.json")
+			cmd.SetArgs([]string{"restore", inputPath, "-o", outPath, "-P", "example"})
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != input {
+				t.Fatalf("Expected %s, got %s", input, string(out))
+			}
+		})
+	}
+}
+
+func TestRestoreStrict(t *testing.T) {
+	t.Cleanup(func() { strictParsing = false })
+
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	editedPath := filepath.Join(tempDir, "edited.txt")
+	if err := os.WriteFile(editedPath, []byte("\uFEFF"+strings.ReplaceAll(doc, "\n", " \r\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd
+	for _, tc := range []struct {
+		path   string
+		strict bool
+		fails  bool
+	}{
+		{path: docPath, strict: true},
+		{path: editedPath},
+		{path: editedPath, strict: true, fails: true},
+	} {
+		strictParsing = false
+		args := []string{"restore", tc.path, "-o", filepath.Join(t.TempDir(), "output.txt"), "-P", "example"}
+		if tc.strict {
+			args = append(args, "--strict")
+		}
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); (err != nil) != tc.fails {
+			t.Fatalf("Restoring %s with strict %t returned %v", filepath.Base(tc.path), tc.strict, err)
+		}
+	}
+}
+
+func TestRestoreOverwrite(t *testing.T) {
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	outPath := filepath.Join(tempDir, "output.json")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outPath, []byte("existing"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { overrideOutFile = false }()
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"restore", docPath, "-o", outPath, "-P", "example"})
+	if err := cmd.Execute(); core.CategoryOf(err) != core.ErrorCategoryFileExists {
+		t.Fatalf("Expected the existing output file to be kept, got %v", err)
+	}
+
+	cmd.SetArgs([]string{"restore", docPath, "-f", "-o", outPath, "-P", "example"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != input {
+		t.Fatalf("Expected %s, got %s", input, string(out))
+	}
+}
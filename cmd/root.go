@@ -26,6 +26,7 @@ import (
 	"github.com/caarlos0/log"
 	"github.com/spf13/cobra"
 	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 var (
@@ -34,7 +35,11 @@ var (
 	overrideOutFile bool
 )
 
-var verbosity int
+var (
+	verbosity   int
+	quiet       bool
+	logFileName string
+)
 
 const repo = "https://github.com/TMUniversal/papercrypt"
 
@@ -47,10 +52,24 @@ var rootCmd = &cobra.Command{
 
 It is designed to let you enter data, encrypt it with a passphrase,
 and then prepare a printable document that is optimized for being able to restore the data.`,
-	PersistentPreRun: func(_ *cobra.Command, _ []string) {
+	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
 		level := max(log.InfoLevel-log.Level(verbosity), log.DebugLevel)
-		log.SetLevel(level)
+		if quiet {
+			level = log.WarnLevel
+		}
+		// -vv traces every decision made while parsing a document
+		core.TraceParsing = verbosity >= 2
+
+		if err := setupLogging(level, logFileName); err != nil {
+			return err
+		}
 		log.Debug("verbosity set to " + level.String())
+
+		// the keychain does not expire cached passphrases itself, every command removes those that have expired
+		if err := internal.PurgeExpiredPassphrases(); err != nil {
+			log.WithError(err).Warn("Could not remove the expired passphrase from the keychain, remove it using 'papercrypt forget-passphrase'")
+		}
+		return nil
 	},
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		cmd.Println("PaperCrypt  Copyright (C) 2023-2024  TMUniversal <me@tmuniversal.eu>")
@@ -58,7 +77,7 @@ and then prepare a printable document that is optimized for being able to restor
 		cmd.Println("This is free software, and you are welcome to redistribute it")
 		cmd.Println("under certain conditions; type `papercrypt show c' for details.")
 		cmd.Print("PaperCrypt's source code can be found at ")
-		cmd.Print(internal.URL(repo))
+		cmd.Print(core.URL(repo))
 		cmd.Println(".")
 		cmd.Println()
 		return cmd.Help()
@@ -70,7 +89,7 @@ and then prepare a printable document that is optimized for being able to restor
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(int(exitCodeOf(err)))
 	}
 }
 
@@ -78,5 +97,17 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&inFileName, "in", "i", "", "Input file to read from, or stdin if not provided")
 	rootCmd.PersistentFlags().StringVarP(&outFileName, "out", "o", "", "Output file to write to, or stdout if not provided")
 	rootCmd.PersistentFlags().BoolVarP(&overrideOutFile, "force", "f", false, "Force override of existing file")
-	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Increase verbosity level")
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Increase verbosity level, -v shows debug messages, -vv also traces how documents are parsed")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only show warnings and errors")
+	rootCmd.PersistentFlags().StringVar(&logFileName, "log-file", "", "Append the log to this file, in addition to stderr")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+	rootCmd.PersistentFlags().BoolVar(&internal.NonInteractive, "non-interactive", false, "Fail instead of prompting for anything, such as a passphrase, for use in scripts")
+	rootCmd.PersistentFlags().BoolVarP(&internal.NonInteractive, "yes", "y", false, "Same as --non-interactive")
+	_ = rootCmd.RegisterFlagCompletionFunc("in", completeInFile)
+	_ = rootCmd.RegisterFlagCompletionFunc("out", completeOutFile)
+	_ = rootCmd.RegisterFlagCompletionFunc("log-file", completeFiles("log", "txt"))
+
+	rootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return usageError{err}
+	})
 }
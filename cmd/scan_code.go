@@ -21,23 +21,41 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"image"
-	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/caarlos0/log"
-	"github.com/makiuchi-d/gozxing"
-	"github.com/makiuchi-d/gozxing/aztec"
-	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 var (
 	qrCmdFromJSON = false
 	qrCmdToJSON   = false
+	qrCmdColor    = false
+
+	qrCmdNoPreprocess = false
+	qrCmdDiagnose     = false
+	scanJobs          int
+
+	qrCmdCamera  = false
+	cameraDevice string
+	ffmpegPath   string
+
+	qrCmdScanner  = false
+	scannerDevice string
+	scannerDPI    int
+	scanimagePath string
 )
 
 type versionContainerV1 struct {
@@ -48,20 +66,59 @@ type versionContainerV1 struct {
 type versionContainer struct {
 	// Version should contain the semver version of PaperCrypt used to generate the document
 	Version string `json:"v"`
+
+	// FormatVersion is the container format version, stated by documents from format version 3 on
+	FormatVersion core.PaperCryptContainerVersion `json:"fv"`
 }
 
 // scanCmd represents the data command.
 var scanCmd = &cobra.Command{
-	Aliases:      []string{"q", "qr", "scan"},
-	Args:         cobra.MaximumNArgs(1),
-	SilenceUsage: true,
-	Use:          "scan <input>",
-	Short:        "Decode a document from a 2D code (aztec or qr).",
+	Aliases:           []string{"q", "qr", "scan"},
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "scan [<input>...]",
+	Short:             "Decode a document from a 2D code (aztec or qr).",
 	Long: `Decode a document from a 2D code (aztec or qr).
 
 This command allows you to decode data saved by PaperCrypt.
 The Aztec/QR code in a PaperCrypt document contains a JSON serialized object
 that contains the encrypted data and the PaperCrypt metadata.
+Documents generated with '--qr-payload cbor' contain a more compact CBOR object instead,
+which is detected automatically.
+
+Large documents are split into several 2D codes, each on a page of its own.
+Pass an image of every code, in any order, to reassemble the document.
+Images may hold several codes, codes found more than once are ignored,
+and glob patterns (such as "scans/*.jpg") are expanded, if your shell does not.
+
+Scanned PDF and multi-page TIFF files are read page by page. For PDF files,
+the page images stored by the scanner are read, so the PDF is not rendered,
+and pages must be scanned images (which is the case for virtually every scanner).
+PDF documents generated by PaperCrypt carry the document as an attachment,
+which is read instead, so the digital PDF restores the document without scanning.
+
+Images in which no 2D code is found are preprocessed, and read again:
+their contrast is stretched, they are converted to black and white with an adaptive threshold
+(to deal with shadows and uneven lighting), they are turned straight, codes photographed
+at an angle are mapped onto a rectangle, and they are scaled up and down.
+Use --no-preprocess to skip this.
+
+If a code can not be read, or only barely, --diagnose reports how far the readers got:
+the finder patterns found, the estimated module size, the number of errors corrected,
+and suggestions for a better scan.
+
+With --scanner, the sheets are scanned on a locally attached scanner, using SANE (scanimage) on Linux and macOS,
+or Windows Image Acquisition on Windows: put the sheet on the scanner, and run the command.
+For documents split over several codes, you are asked to put the next sheet on the scanner, until the document is complete.
+
+With --camera, the 2D code is read from the camera, using FFmpeg, instead of images:
+hold the code in front of the camera, and show every part of a split code in turn,
+until the document is complete. Use --camera-device to choose another camera.
+
+Documents generated with '--code-type color' hold an experimental color code,
+made up of three QR codes printed in cyan, magenta, and yellow.
+Scan them in color, and pass --color to separate and read the layers.
 
 If you have trouble scanning the QR code with this command,
 you may also try a QR code scanner app on your phone or tablet,
@@ -69,57 +126,28 @@ such as "Scandit" (https://apps.apple.com/de/app/scandit-barcode-scanner/id45388
 or https://play.google.com/store/apps/details?id=com.scandit.demoapp).
 The resulting JSON data can be read by this command, by supplying the --json flag.
 `,
-	Example: `papercrypt scan ./code.png | papercrypt decode -o ./out.json -P passphrase`,
+	Example: `papercrypt scan ./code.png | papercrypt decode -o ./out.json -P passphrase
+papercrypt scan --scanner | papercrypt decode -o ./out.json
+papercrypt scan --camera | papercrypt decode -o ./out.json`,
 	RunE: func(_ *cobra.Command, args []string) error {
-		// 1. get data from either argument or inFileName
-		if len(args) != 0 {
-			inFileName = args[0]
+		// 1. get data from the camera, the scanner, or from either the arguments or inFileName
+		var data []byte
+		var err error
+		switch {
+		case qrCmdCamera && qrCmdScanner:
+			return errors.New("--camera can not be used with --scanner")
+		case (qrCmdCamera || qrCmdScanner) && (len(args) > 0 || qrCmdFromJSON):
+			return errors.New("--camera and --scanner can not be used with inputs, or --from-json")
+		case qrCmdCamera:
+			data, err = readCameraPayload()
+		case qrCmdScanner:
+			data, err = readScannerPayload()
+		default:
+			data, err = readScanInputs(args)
 		}
-
-		inFile, err := internal.PrintInputAndGetReader(inFileName)
 		if err != nil {
 			return err
 		}
-		defer inFile.Close()
-
-		var data []byte
-
-		if qrCmdFromJSON {
-			data, err = io.ReadAll(inFile)
-			if err != nil && err != io.EOF {
-				return errors.Join(errors.New("error reading input file"), err)
-			}
-		} else {
-			img, _, err := image.Decode(inFile)
-			if err != nil {
-				return errors.Join(errors.New("error decoding image"), err)
-			}
-
-			if err := inFile.Close(); err != nil {
-				return errors.Join(errors.New("error closing input file"), err)
-			}
-
-			bmp, err := gozxing.NewBinaryBitmapFromImage(img)
-			if err != nil {
-				return errors.Join(errors.New("error creating binary bitmap"), err)
-			}
-
-			// attempt to decode as aztec first
-			aztecReader := aztec.NewAztecReader()
-			result, err := aztecReader.Decode(bmp, nil)
-			if err != nil {
-				log.Debugf("error decoding aztec: %s", err)
-				// if that fails, try qrcode
-				qrReader := qrcode.NewQRCodeReader()
-				result, err = qrReader.Decode(bmp, nil)
-				if err != nil {
-					return errors.Join(errors.New("error decoding QR code"), err)
-				}
-				log.Debug("decoded as QR code")
-			}
-
-			data = []byte(result.GetText())
-		}
 
 		// 2. Open output file
 		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
@@ -144,65 +172,566 @@ The resulting JSON data can be read by this command, by supplying the --json fla
 		}
 
 		// 3. Deserialize
-		var output []byte
-		var paperCryptMajorVersion internal.PaperCryptContainerVersion
+		output, err := payloadToText(data)
+		if err != nil {
+			return err
+		}
 
-		// decode version information or find .Data.Data (string)
-		vc := versionContainerV1{}
-		err = json.Unmarshal(data, &vc)
+		// 6. Write to file
+		n, err := outFile.Write(output)
 		if err != nil {
-			return errors.Join(errors.New("error deserializing version"), err)
+			return errors.Join(errors.New("error writing output"), err)
 		}
 
-		paperCryptMajorVersion = internal.PaperCryptContainerVersionFromString(vc.Version)
+		internal.PrintWrittenSize(n, outFile)
+		return nil
+	},
+}
 
-		if paperCryptMajorVersion == internal.PaperCryptContainerVersionUnknown {
-			vc := versionContainer{}
-			err = json.Unmarshal(data, &vc)
-			if err != nil {
-				return errors.Join(errors.New("error deserializing version"), err)
-			}
+// readScanInputs reads the payload of the document from the inputs given as arguments, or from the input file.
+func readScanInputs(args []string) ([]byte, error) {
+	inputs, err := expandInputs(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		inputs = []string{inFileName}
+	}
+	if qrCmdFromJSON && len(inputs) > 1 {
+		return nil, errors.New("only a single JSON input can be read")
+	}
+	if qrCmdFromJSON && qrCmdColor {
+		return nil, errors.New("--color can not be used with --from-json")
+	}
 
-			paperCryptMajorVersion = internal.PaperCryptContainerVersionFromString(vc.Version)
+	contents := make([][]byte, len(inputs))
+	for i, input := range inputs {
+		contents[i], err = internal.PrintInputAndRead(input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return readScannedPayload(inputs, contents)
+}
+
+// readScannedPayload reads the 2D codes in the contents of the inputs, reassembling the parts of a split code,
+// and returns the payload of the document, as JSON.
+// The pages of all inputs are scanned at once (see scanPages), their codes are collected in the order of the inputs.
+func readScannedPayload(inputs []string, contents [][]byte) ([]byte, error) {
+	scannedCodes := make([][][]byte, len(inputs))
+	pagesOf := make([][]image.Image, len(inputs))
+	var pages []image.Image
+	for i, input := range inputs {
+		var err error
+		scannedCodes[i], pagesOf[i], err = readInputPages(input, contents[i])
+		if err != nil {
+			return nil, err
 		}
+		pages = append(pages, pagesOf[i]...)
+	}
 
-		switch paperCryptMajorVersion {
-		case internal.PaperCryptContainerVersionMajor1:
-			pc := internal.PaperCryptV1{}
-			err = json.Unmarshal(data, &pc)
+	pagePayloads, pageErrs := scanPages(pages)
+	collector := newPayloadCollector()
+	for i, input := range inputs {
+		if scannedCodes[i] == nil {
+			n := len(pagesOf[i])
+			var err error
+			scannedCodes[i], err = collectPagePayloads(input, pagePayloads[:n], pageErrs[:n])
 			if err != nil {
-				return errors.Join(errors.New("error deserializing data"), err)
+				return nil, err
 			}
+			pagePayloads, pageErrs = pagePayloads[n:], pageErrs[n:]
+		}
 
-			output, err = pc.GetText(false)
-			if err != nil {
-				return errors.Join(errors.New("error deserializing data"), err)
+		for _, scanned := range scannedCodes[i] {
+			if err := collector.add(input, scanned); err != nil {
+				return nil, err
 			}
-		case internal.PaperCryptContainerVersionDevel,
-			internal.PaperCryptContainerVersionMajor2:
-			pc := internal.PaperCrypt{}
-			err = json.Unmarshal(data, &pc)
-			if err != nil {
-				return errors.Join(errors.New("error deserializing data"), err)
+		}
+	}
+
+	return collector.payload()
+}
+
+// payloadCollector collects the scanned 2D codes of a document, a complete code, or the parts of a split code.
+type payloadCollector struct {
+	data  []byte
+	parts []core.QRPart
+	seen  map[string]bool
+}
+
+func newPayloadCollector() *payloadCollector {
+	return &payloadCollector{seen: make(map[string]bool)}
+}
+
+// add adds a scanned code, read from the source, codes found before are skipped.
+func (c *payloadCollector) add(source string, scanned []byte) error {
+	// the same code may be found in several images, e.g. when a page was scanned twice
+	if c.seen[string(scanned)] {
+		log.WithField("input", source).Debug("skipping duplicate 2D code")
+		return nil
+	}
+
+	if !core.IsQRPart(scanned) {
+		if c.data != nil {
+			return fmt.Errorf("%s holds a different document, only the parts of a single split 2D code can be read at once", source)
+		}
+		if len(c.parts) > 0 {
+			return errors.New("found both a complete document and parts of a split 2D code, only the parts of a single split 2D code can be read at once")
+		}
+
+		c.seen[string(scanned)] = true
+		c.data = scanned
+		return nil
+	}
+
+	part, err := core.ParseQRPart(scanned)
+	if err != nil {
+		return errors.Join(fmt.Errorf("error reading 2D code part from %s", source), err)
+	}
+	if c.data != nil {
+		return errors.New("found both a complete document and parts of a split 2D code, only the parts of a single split 2D code can be read at once")
+	}
+	if len(c.parts) > 0 && (part.Total != c.parts[0].Total || part.Checksum != c.parts[0].Checksum) {
+		return fmt.Errorf("%s holds a part of a different document, only the parts of a single split 2D code can be read at once", source)
+	}
+
+	c.seen[string(scanned)] = true
+	log.WithField("part", fmt.Sprintf("%d/%d", part.Number, part.Total)).Info("Scanned 2D code part")
+	c.parts = append(c.parts, part)
+	return nil
+}
+
+// complete returns whether a complete code, or all parts of a split code were collected.
+func (c *payloadCollector) complete() bool {
+	return c.data != nil || (len(c.parts) > 0 && len(c.parts) >= c.parts[0].Total)
+}
+
+// payload returns the payload of the document, as JSON, reassembling the parts of a split code, regardless of their order.
+func (c *payloadCollector) payload() ([]byte, error) {
+	data := c.data
+	if len(c.parts) > 0 {
+		var err error
+		data, err = core.JoinQRParts(c.parts)
+		if err != nil {
+			return nil, errors.Join(errors.New("error reassembling 2D code parts"), err)
+		}
+	}
+
+	return payloadJSON(data)
+}
+
+// payloadJSON converts compact CBOR payloads to JSON, so both are handled alike, JSON payloads are returned as they are.
+func payloadJSON(data []byte) ([]byte, error) {
+	if core.DetectQRPayloadFormat(data) != core.QRPayloadFormatCBOR {
+		return data, nil
+	}
+	log.Debug("decoded CBOR payload")
+
+	pc, err := core.DeserializeQRPayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(pc)
+	if err != nil {
+		return nil, errors.Join(errors.New("error encoding JSON"), err)
+	}
+
+	return data, nil
+}
+
+// payloadToText converts the JSON payload of a 2D code to the text of the document, as read by decode.
+func payloadToText(data []byte) ([]byte, error) {
+	var output []byte
+	var paperCryptMajorVersion core.PaperCryptContainerVersion
+
+	// decode version information or find .Data.Data (string)
+	vc := versionContainerV1{}
+	err := json.Unmarshal(data, &vc)
+	if err != nil {
+		return nil, errors.Join(errors.New("error deserializing version"), err)
+	}
+
+	paperCryptMajorVersion = core.PaperCryptContainerVersionFromString(vc.Version)
+
+	if paperCryptMajorVersion == core.PaperCryptContainerVersionUnknown {
+		vc := versionContainer{}
+		err = json.Unmarshal(data, &vc)
+		if err != nil {
+			return nil, errors.Join(errors.New("error deserializing version"), err)
+		}
+
+		paperCryptMajorVersion, err = core.NegotiateContainerVersion(vc.Version, vc.FormatVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch paperCryptMajorVersion {
+	case core.PaperCryptContainerVersionMajor1:
+		pc := core.PaperCryptV1{}
+		err = json.Unmarshal(data, &pc)
+		if err != nil {
+			return nil, errors.Join(errors.New("error deserializing data"), err)
+		}
+
+		output, err = pc.GetText(false)
+		if err != nil {
+			return nil, errors.Join(errors.New("error deserializing data"), err)
+		}
+	case core.PaperCryptContainerVersionDevel,
+		core.PaperCryptContainerVersionMajor2,
+		core.PaperCryptContainerVersionMajor3:
+		pc, err := core.DeserializeQRPayload(data)
+		if err != nil {
+			return nil, errors.Join(errors.New("error deserializing data"), err)
+		}
+
+		log.WithField("phrase", core.Bold(pc.ReadBackPhrase())).Info("Read-back phrase")
+
+		output, err = pc.GetText(core.EncodingOptions{})
+		if err != nil {
+			return nil, errors.Join(errors.New("error deserializing data"), err)
+		}
+	default:
+		return nil, core.WithCategory(core.ErrorCategoryVersion, errors.New("unknown version"))
+	}
+
+	return output, nil
+}
+
+// expandInputs expands glob patterns (e.g. "scans/*.png") among the inputs,
+// for shells that do not expand them, the matches of each pattern are sorted by name.
+func expandInputs(args []string) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			inputs = append(inputs, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("invalid pattern %s", arg), err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+
+		inputs = append(inputs, matches...)
+	}
+
+	return inputs, nil
+}
+
+// scanInput reads the payloads of all 2D codes in the data of an image, or the JSON payload, if --from-json is set.
+// PDF and TIFF files are read page by page, pages without 2D codes are skipped.
+func scanInput(inFileName string, data []byte) ([][]byte, error) {
+	payloads, pages, err := readInputPages(inFileName, data)
+	if err != nil || payloads != nil {
+		return payloads, err
+	}
+
+	pagePayloads, pageErrs := scanPages(pages)
+	return collectPagePayloads(inFileName, pagePayloads, pageErrs)
+}
+
+// readInputPages returns the pages to scan in the data of an input, or its payloads, if no scan is needed (nil otherwise):
+// the JSON payload, if --from-json is set, or the document attached to a PDF file generated by PaperCrypt.
+func readInputPages(inFileName string, data []byte) ([][]byte, []image.Image, error) {
+	if qrCmdFromJSON {
+		return [][]byte{data}, nil, nil
+	}
+
+	if internal.IsPDF(data) {
+		attachment, ok, err := internal.ExtractPDFAttachment(data)
+		if err != nil {
+			log.WithError(err).Debug("error reading the pdf attachment")
+		}
+		if ok {
+			log.Info("Read the document attached to the PDF, no 2D code was scanned")
+			return [][]byte{attachment}, nil, nil
+		}
+	}
+
+	pages, err := decodePages(data)
+	if err != nil {
+		return nil, nil, errors.Join(fmt.Errorf("error decoding image %s", inFileName), err)
+	}
+
+	return nil, pages, nil
+}
+
+// collectPagePayloads returns the payloads scanned on the pages of an input, pages without 2D codes are skipped,
+// unless the input has a single page.
+func collectPagePayloads(inFileName string, pagePayloads [][][]byte, pageErrs []error) ([][]byte, error) {
+	var payloads [][]byte
+	for i, err := range pageErrs {
+		if err != nil {
+			if len(pageErrs) == 1 {
+				logDiagnoseHint()
+				return nil, err
 			}
 
-			output, err = pc.GetText(false)
-			if err != nil {
-				return errors.Join(errors.New("error deserializing data"), err)
+			log.WithError(err).WithField("page", i+1).Debug("no 2D code found")
+			continue
+		}
+
+		payloads = append(payloads, pagePayloads[i]...)
+	}
+	if len(payloads) == 0 {
+		logDiagnoseHint()
+		return nil, core.WithCategory(core.ErrorCategoryUnreadableCode, fmt.Errorf("no 2D code found on any of the %d pages of %s", len(pageErrs), inFileName))
+	}
+
+	return payloads, nil
+}
+
+// scanPages reads the payloads of the 2D codes on the pages, scanning up to --jobs pages at once,
+// and returns them, and the errors of pages without codes, in the order of the pages.
+// With --diagnose, pages are scanned one after the other, so their reports are not mixed up.
+func scanPages(pages []image.Image) ([][][]byte, []error) {
+	payloads := make([][][]byte, len(pages))
+	errs := make([]error, len(pages))
+
+	workers := scanJobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if qrCmdDiagnose {
+		workers = 1
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(pages)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if qrCmdColor {
+					payloads[i], errs[i] = scanColorImage(pages[i])
+				} else {
+					payloads[i], errs[i] = scanImage(pages[i])
+				}
 			}
-		default:
-			return errors.New("unknown version")
+		}()
+	}
+	for i := range pages {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return payloads, errs
+}
+
+// decodePages returns the pages of a scanned document:
+// the images embedded in a PDF file, the pages of a TIFF file, or a single image.
+func decodePages(data []byte) ([]image.Image, error) {
+	switch {
+	case internal.IsPDF(data):
+		return internal.ExtractPDFImages(data)
+	case internal.IsTIFF(data):
+		return internal.DecodeTIFFPages(data)
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
 		}
 
-		// 6. Write to file
-		n, err := outFile.Write(output)
+		return []image.Image{img}, nil
+	}
+}
+
+// scanColorImage reads the payloads of the layers of the experimental color code in an image.
+func scanColorImage(img image.Image) ([][]byte, error) {
+	var payloads [][]byte
+	for i, layer := range core.SplitColorLayers(img) {
+		layerPayloads, err := scanImage(layer)
 		if err != nil {
-			return errors.Join(errors.New("error writing output"), err)
+			return nil, errors.Join(fmt.Errorf("error reading layer %d of the color code", i+1), err)
 		}
 
-		internal.PrintWrittenSize(n, outFile)
-		return nil
-	},
+		payloads = append(payloads, layerPayloads...)
+	}
+
+	return payloads, nil
+}
+
+// scanImage reads the payloads of the 2D codes in an image.
+// A single Aztec code, and any number of QR codes are found.
+// If no code is found, the image is preprocessed (see core.PreprocessSteps), unless --no-preprocess is set.
+func scanImage(img image.Image) ([][]byte, error) {
+	payloads, err := core.ScanCodeImage(img)
+	if err != nil && !qrCmdNoPreprocess {
+		log.WithError(err).Debug("no 2D code found, preprocessing the image")
+
+		if processed, processedPayloads := scanPreprocessed(img); processed != nil {
+			img, payloads, err = processed, processedPayloads, nil
+		}
+	}
+	if qrCmdDiagnose {
+		logDiagnosis(img)
+	}
+	if err != nil {
+		return nil, core.WithCategory(core.ErrorCategoryUnreadableCode, err)
+	}
+
+	return payloads, nil
+}
+
+// scanPreprocessed scans the image after each of core.PreprocessSteps, all at once, and returns the image,
+// and the payloads, of the first step, in their order, after which a code is found, or nil, if none is.
+func scanPreprocessed(img image.Image) (*image.Gray, [][]byte) {
+	type outcome struct {
+		processed *image.Gray
+		payloads  [][]byte
+		err       error
+	}
+
+	stretched := core.ContrastStretch(img)
+	outcomes := make([]outcome, len(core.PreprocessSteps))
+	var wg sync.WaitGroup
+	for i, step := range core.PreprocessSteps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if processed := step.Apply(stretched); processed != nil {
+				payloads, err := core.ScanCodeImage(processed)
+				outcomes[i] = outcome{processed, payloads, err}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, outcome := range outcomes {
+		step := core.PreprocessSteps[i]
+		if outcome.processed == nil {
+			continue
+		}
+		if outcome.err == nil {
+			log.WithField("step", step.Name).Info("2D code found after preprocessing the image")
+			return outcome.processed, outcome.payloads
+		}
+
+		log.WithField("step", step.Name).Debug("no 2D code found")
+	}
+
+	return nil, nil
+}
+
+// addScanJobsFlag adds the --jobs flag, the number of images scanned at once, to a command reading scans.
+func addScanJobsFlag(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&scanJobs, "jobs", 0, "Number of images, or pages, to scan at once (default: the number of CPU cores)")
+}
+
+// readScannerPayload scans pages on the scanner, until the 2D code of a document, or all parts of a split code are read,
+// and returns the payload of the document, as JSON. The user is asked to put the next sheet on the scanner in between.
+func readScannerPayload() ([]byte, error) {
+	scanner, err := internal.NewScanner(runtime.GOOS, scanimagePath, scannerDevice, scannerDPI)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := newPayloadCollector()
+	for page := 1; ; page++ {
+		source := fmt.Sprintf("page %d", page)
+		log.WithField("page", page).Info("Scanning...")
+		data, err := scanner.Acquire()
+		if err != nil {
+			return nil, err
+		}
+
+		payloads, err := scanInput(source, data)
+		if err != nil {
+			// the sheet may be placed again, and scanned once more
+			log.WithError(err).Warn(core.Warning("No 2D code found on the scanned page"))
+		}
+		for _, scanned := range payloads {
+			if err := collector.add(source, scanned); err != nil {
+				return nil, err
+			}
+		}
+		if collector.complete() {
+			return collector.payload()
+		}
+
+		if err := internal.RequireInteraction("the next sheet, the code is not complete"); err != nil {
+			return nil, err
+		}
+		prompt := promptui.Prompt{
+			Label:  "Put the next sheet on the scanner, and press Enter",
+			Stdout: os.Stderr,
+		}
+		if _, err := prompt.Run(); err != nil {
+			return nil, errors.Join(errors.New("scanning was cancelled"), err)
+		}
+	}
+}
+
+// readCameraPayload captures frames from the camera, until the 2D code of a document, or all parts of a split code are read,
+// and returns the payload of the document, as JSON.
+func readCameraPayload() ([]byte, error) {
+	camera, err := internal.NewFFmpegCamera(ffmpegPath, cameraDevice)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("camera", camera.Device).Info("Hold the 2D code in front of the camera, and show every part of a split code in turn")
+	collector := newPayloadCollector()
+	err = camera.Capture(func(img image.Image) (bool, error) {
+		var payloads [][]byte
+		var scanErr error
+		if qrCmdColor {
+			payloads, scanErr = scanColorImage(img)
+		} else {
+			// frames are not preprocessed, the next one is read instead
+			payloads, scanErr = core.ScanCodeImage(img)
+		}
+		if scanErr != nil {
+			log.WithError(scanErr).Debug("no 2D code found in frame")
+			return false, nil
+		}
+
+		for _, scanned := range payloads {
+			// codes of other documents may come into view, they are skipped
+			if err := collector.add("camera", scanned); err != nil {
+				log.WithError(err).Warn(core.Warning("Skipped a 2D code"))
+			}
+		}
+
+		return collector.complete(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return collector.payload()
+}
+
+func logDiagnoseHint() {
+	if !qrCmdDiagnose {
+		log.Info("Use --diagnose for details, and suggestions for a better scan.")
+	}
+}
+
+// logDiagnosis logs the diagnoses of the codes located in an image, or of all formats, if none was located.
+func logDiagnosis(img image.Image) {
+	diagnoses := diagnoseImage(img)
+
+	located := false
+	for _, d := range diagnoses {
+		located = located || d.Located
+	}
+
+	for _, d := range diagnoses {
+		if d.Located || !located {
+			d.Log()
+		}
+	}
 }
 
 func init() {
@@ -210,4 +739,15 @@ func init() {
 
 	scanCmd.Flags().BoolVarP(&qrCmdFromJSON, "from-json", "j", false, "Read input from JSON instead of an image")
 	scanCmd.Flags().BoolVarP(&qrCmdToJSON, "to-json", "J", false, "Write JSON output instead of plaintext, this cannot be used in the decode command (yet).")
+	scanCmd.Flags().BoolVar(&qrCmdDiagnose, "diagnose", false, "Report the finder patterns, module size, and error corrections of the codes in each image, with suggestions for better scans")
+	scanCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+	addScanJobsFlag(scanCmd)
+	scanCmd.Flags().BoolVar(&qrCmdColor, "color", false, "Read the layers of an experimental color code (see 'generate --code-type color')")
+	scanCmd.Flags().BoolVar(&qrCmdCamera, "camera", false, "Read the 2D code from the camera, instead of images, until the document is complete (needs FFmpeg)")
+	scanCmd.Flags().StringVar(&cameraDevice, "camera-device", "", "Camera to read from, such as /dev/video1 on Linux, 1 on macOS, or the name of the camera on Windows (default: the first camera)")
+	scanCmd.Flags().StringVar(&ffmpegPath, "ffmpeg", "ffmpeg", "Path of the FFmpeg program, used by --camera")
+	scanCmd.Flags().BoolVar(&qrCmdScanner, "scanner", false, "Scan the sheets on a locally attached scanner (SANE on Linux and macOS, WIA on Windows), instead of reading images")
+	scanCmd.Flags().StringVar(&scannerDevice, "scanner-device", "", "Scanner to use, as listed by 'scanimage -L' (SANE), or as named by Windows (WIA) (default: the first scanner)")
+	scanCmd.Flags().IntVar(&scannerDPI, "scanner-dpi", internal.DefaultScannerDPI, "Resolution to scan at, in dots per inch")
+	scanCmd.Flags().StringVar(&scanimagePath, "scanimage", "scanimage", "Path of the scanimage program of SANE, used by --scanner")
 }
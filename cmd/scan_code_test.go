@@ -0,0 +1,287 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestScanMultipleImages(t *testing.T) {
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	outPath := filepath.Join(tempDir, "output.txt")
+
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// split the document over several codes, code-1.png, code-2.png, ...
+	cmd := rootCmd
+	cmd.SetArgs([]string{"qr", "encode", "-i", docPath, "-o", filepath.Join(tempDir, "code.png"), "--code-type", "qr", "--qr-version", "8", "--size", "400"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	codes, err := filepath.Glob(filepath.Join(tempDir, "code-*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) < 3 {
+		t.Fatalf("Expected the document to be split over at least 3 codes, got %d", len(codes))
+	}
+
+	// place the first two codes side by side on a single page
+	page := image.NewGray(image.Rect(0, 0, 800, 400))
+	for i, code := range codes[:2] {
+		f, err := os.Open(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		draw.Draw(page, img.Bounds().Add(image.Pt(i*400, 0)), img, image.Point{}, draw.Src)
+	}
+
+	pagePath := filepath.Join(tempDir, "page.png")
+	f, err := os.Create(pagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, page); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// the codes on the page are scanned a second time by the pattern
+	cmd.SetArgs([]string{"scan", "-o", outPath, pagePath, filepath.Join(tempDir, "code-*.png")})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := deserializeDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := pc.GetText(core.EncodingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != string(want) {
+		t.Fatalf("Expected %s, got %s", string(want), string(out))
+	}
+}
+
+func TestScanPages(t *testing.T) {
+	var pages []image.Image
+	for i := range 5 {
+		code, err := core.Encode2D([]byte{byte(i)}, core.Code2DOptions{Type: core.Code2DTypeQR})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := internal.Code2DImage(code, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, img)
+	}
+	// a blank page, without any code
+	pages[2] = image.NewGray(image.Rect(0, 0, 200, 200))
+
+	t.Cleanup(func() { scanJobs = 0 })
+	for _, jobs := range []int{1, 3, 0} {
+		scanJobs = jobs
+		payloads, errs := scanPages(pages)
+		for i := range pages {
+			if i == 2 {
+				if errs[i] == nil {
+					t.Fatalf("Expected no 2D code on the blank page with %d jobs", jobs)
+				}
+				continue
+			}
+			if errs[i] != nil {
+				t.Fatal(errs[i])
+			}
+			if len(payloads[i]) != 1 || len(payloads[i][0]) != 1 || payloads[i][0][0] != byte(i) {
+				t.Fatalf("Expected the payload of page %d with %d jobs, got %v", i+1, jobs, payloads[i])
+			}
+		}
+	}
+}
+
+func TestScanPreprocess(t *testing.T) {
+	code, err := core.Encode2D(make([]byte, 300), core.Code2DOptions{Type: core.Code2DTypeQR})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean, err := internal.Code2DImage(code, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a faded print, lit from the right
+	bounds := clean.Bounds()
+	photo := image.NewGray(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			light := 40 + 200*x/bounds.Dx()
+			if clean.GrayAt(x, y).Y < 0x80 {
+				light = light * 6 / 10
+			}
+			photo.SetGray(x, y, color.Gray{Y: uint8(light)})
+		}
+	}
+
+	qrCmdNoPreprocess = true
+	if _, err := scanImage(photo); err == nil {
+		t.Fatal("Expected the photo to be unreadable without preprocessing")
+	}
+
+	qrCmdNoPreprocess = false
+	payloads, err := scanImage(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 1 || len(payloads[0]) != 300 {
+		t.Fatalf("Expected a single payload of 300 bytes, got %d payloads", len(payloads))
+	}
+}
+
+func TestScanCamera(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("the stand-in for ffmpeg is a shell script")
+	}
+
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	outPath := filepath.Join(tempDir, "output.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd
+	cmd.SetArgs([]string{"qr", "encode", "-i", docPath, "-o", filepath.Join(tempDir, "code.png"), "--code-type", "qr", "--qr-version", "8", "--size", "400"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := filepath.Glob(filepath.Join(tempDir, "code-*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the camera shows the first code twice, then the others, as a stream of PNG images
+	frames := append([]string{codes[0]}, codes...)
+	ffmpeg := filepath.Join(tempDir, "ffmpeg")
+	script := "#!/bin/sh\ncat '" + strings.Join(frames, "' '") + "'\n"
+	if err := os.WriteFile(ffmpeg, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.SetArgs([]string{"scan", "--camera", "--ffmpeg", ffmpeg, "-o", outPath})
+	defer func() { qrCmdCamera = false }()
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := deserializeDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := pc.GetText(core.EncodingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(want) {
+		t.Fatalf("Expected %s, got %s", string(want), string(out))
+	}
+}
+
+func TestScanScanner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stand-in for scanimage is a shell script")
+	}
+
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	codePath := filepath.Join(tempDir, "code.png")
+	outPath := filepath.Join(tempDir, "output.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd
+	// a single code, other tests leave the flags of qr encode set
+	cmd.SetArgs([]string{"qr", "encode", "-i", docPath, "-o", codePath, "--code-type", "aztec", "--qr-version", "0", "--size", "1024"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the scanner returns the page holding the code
+	scanimage := filepath.Join(tempDir, "scanimage")
+	if err := os.WriteFile(scanimage, []byte("#!/bin/sh\ncat '"+codePath+"'\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.SetArgs([]string{"scan", "--scanner", "--scanimage", scanimage, "-o", outPath})
+	defer func() { qrCmdScanner = false }()
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := deserializeDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := pc.GetText(core.EncodingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(want) {
+		t.Fatalf("Expected %s, got %s", string(want), string(out))
+	}
+}
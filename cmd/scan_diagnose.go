@@ -0,0 +1,246 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/caarlos0/log"
+	"github.com/makiuchi-d/gozxing"
+	aztecdecoder "github.com/makiuchi-d/gozxing/aztec/decoder"
+	aztecdetector "github.com/makiuchi-d/gozxing/aztec/detector"
+	"github.com/makiuchi-d/gozxing/common/reedsolomon"
+	qrdecoder "github.com/makiuchi-d/gozxing/qrcode/decoder"
+	qrdetector "github.com/makiuchi-d/gozxing/qrcode/detector"
+)
+
+// minModulePixels is the module size, in pixels, below which codes are hard to read.
+const minModulePixels = 3.0
+
+// codeDiagnosis describes how far the readers got with a code, see diagnoseImage.
+type codeDiagnosis struct {
+	// Format is the format of the code ("QR" or "Aztec").
+	Format string
+
+	// Located is set if the finder patterns (or the bull's eye, for Aztec codes) were found.
+	Located bool
+
+	// Patterns describes the patterns found, and their position in the image.
+	Patterns string
+
+	// ModuleSize is the estimated size of a module, in pixels.
+	ModuleSize float64
+
+	// Symbol describes the size (and version) of the code, once it was sampled.
+	Symbol string
+
+	// ECLevel is the error correction level of the code.
+	ECLevel string
+
+	// ErrorsCorrected and ErrorCapacity are the number of codewords corrected, and the number that could be.
+	// ErrorCapacity is 0 if it is unknown.
+	ErrorsCorrected, ErrorCapacity int
+
+	// Err is the reason the code could not be read, nil if it was read.
+	Err error
+}
+
+// diagnoseImage runs the stages of the QR and Aztec readers one by one, and reports the results of each.
+func diagnoseImage(img image.Image) []codeDiagnosis {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return []codeDiagnosis{{Format: "image", Err: err}}
+	}
+
+	matrix, err := bmp.GetBlackMatrix()
+	if err != nil {
+		return []codeDiagnosis{{Format: "image", Err: err}}
+	}
+
+	return []codeDiagnosis{diagnoseQR(matrix), diagnoseAztec(matrix)}
+}
+
+func diagnoseQR(matrix *gozxing.BitMatrix) codeDiagnosis {
+	d := codeDiagnosis{Format: "QR"}
+
+	info, notFound := qrdetector.NewFinderPatternFinder(matrix, nil).Find(nil)
+	if notFound != nil {
+		d.Err = fmt.Errorf("no finder patterns found: %w", notFound)
+		return d
+	}
+
+	d.Located = true
+	patterns := []*qrdetector.FinderPattern{info.GetTopLeft(), info.GetTopRight(), info.GetBottomLeft()}
+	for i, pattern := range patterns {
+		d.ModuleSize += pattern.GetEstimatedModuleSize() / float64(len(patterns))
+		if i > 0 {
+			d.Patterns += ", "
+		}
+		d.Patterns += fmt.Sprintf("(%.0f, %.0f)", pattern.GetX(), pattern.GetY())
+	}
+
+	detected, err := qrdetector.NewDetector(matrix).Detect(nil)
+	if err != nil {
+		d.Err = fmt.Errorf("the code could not be sampled: %w", err)
+		return d
+	}
+
+	parser, err := qrdecoder.NewBitMatrixParser(detected.GetBits())
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	version, err := parser.ReadVersion()
+	if err != nil {
+		d.Err = fmt.Errorf("the version could not be read: %w", err)
+		return d
+	}
+	d.Symbol = fmt.Sprintf("version %d (%dx%d modules)", version.GetVersionNumber(), version.GetDimensionForVersion(), version.GetDimensionForVersion())
+
+	format, err := parser.ReadFormatInformation()
+	if err != nil {
+		d.Err = fmt.Errorf("the format information could not be read: %w", err)
+		return d
+	}
+	d.ECLevel = format.GetErrorCorrectionLevel().String()
+
+	codewords, err := parser.ReadCodewords()
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	blocks, err := qrdecoder.DataBlock_GetDataBlocks(codewords, version, format.GetErrorCorrectionLevel())
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	// correct every block, counting the codewords that changed
+	rs := reedsolomon.NewReedSolomonDecoder(reedsolomon.GenericGF_QR_CODE_FIELD_256)
+	for i, block := range blocks {
+		received := make([]int, len(block.GetCodewords()))
+		for j, codeword := range block.GetCodewords() {
+			received[j] = int(codeword)
+		}
+
+		ecCodewords := len(received) - block.GetNumDataCodewords()
+		d.ErrorCapacity += ecCodewords / 2
+
+		if err := rs.Decode(received, ecCodewords); err != nil {
+			d.Err = fmt.Errorf("block %d of %d has too many errors: %w", i+1, len(blocks), err)
+			return d
+		}
+
+		for j, codeword := range block.GetCodewords() {
+			if received[j] != int(codeword) {
+				d.ErrorsCorrected++
+			}
+		}
+	}
+
+	return d
+}
+
+func diagnoseAztec(matrix *gozxing.BitMatrix) codeDiagnosis {
+	d := codeDiagnosis{Format: "Aztec"}
+
+	detected, err := aztecdetector.NewDetector(matrix).Detect(false)
+	if err != nil {
+		d.Err = fmt.Errorf("no bull's eye found: %w", err)
+		return d
+	}
+
+	d.Located = true
+	size := detected.GetBits().GetWidth()
+	points := detected.GetPoints()
+	if len(points) >= 2 {
+		d.Patterns = fmt.Sprintf("corners at (%.0f, %.0f) and (%.0f, %.0f)", points[0].GetX(), points[0].GetY(), points[2%len(points)].GetX(), points[2%len(points)].GetY())
+		d.ModuleSize = math.Hypot(points[0].GetX()-points[1].GetX(), points[0].GetY()-points[1].GetY()) / float64(size)
+	}
+
+	kind := "full range"
+	if detected.IsCompact() {
+		kind = "compact"
+	}
+	d.Symbol = fmt.Sprintf("%s, %d layers (%dx%d modules)", kind, detected.GetNbLayers(), size, size)
+
+	result, err := aztecdecoder.NewDecoder().Decode(detected)
+	if err != nil {
+		d.Err = fmt.Errorf("the code could not be decoded: %w", err)
+		return d
+	}
+	d.ECLevel = result.GetECLevel()
+
+	return d
+}
+
+// Suggestions returns advice on how to get a better scan of the code.
+func (d codeDiagnosis) Suggestions() []string {
+	var suggestions []string
+	if !d.Located {
+		suggestions = append(suggestions, "Make sure the whole code is visible, with a white margin around it, and that the image is sharp and evenly lit.")
+	}
+	if d.ModuleSize > 0 && d.ModuleSize < minModulePixels {
+		suggestions = append(suggestions, fmt.Sprintf("Modules are only %.1f pixels wide, scan at a higher resolution (at least %.0f pixels per module, e.g. 600 dpi), or move the camera closer.", d.ModuleSize, minModulePixels))
+	}
+	if d.Located && d.Err != nil {
+		suggestions = append(suggestions, "The code was found, but could not be read. Flatten the page, avoid glare and shadows, and scan it straight on.")
+	}
+	if d.Err == nil && d.ErrorCapacity > 0 && d.ErrorsCorrected*2 > d.ErrorCapacity {
+		suggestions = append(suggestions, "The code was read, but barely. Consider reprinting it, with a higher error correction level (--qr-ec H).")
+	}
+
+	return suggestions
+}
+
+// Log writes the diagnosis to the log.
+func (d codeDiagnosis) Log() {
+	entry := log.WithField("format", d.Format)
+	if d.Patterns != "" {
+		entry = entry.WithField("patterns", d.Patterns)
+	}
+	if d.ModuleSize > 0 {
+		entry = entry.WithField("module size", fmt.Sprintf("%.1f px", d.ModuleSize))
+	}
+	if d.Symbol != "" {
+		entry = entry.WithField("symbol", d.Symbol)
+	}
+	if d.ECLevel != "" {
+		entry = entry.WithField("error correction", d.ECLevel)
+	}
+	if d.ErrorCapacity > 0 {
+		entry = entry.WithField("errors corrected", fmt.Sprintf("%d of %d", d.ErrorsCorrected, d.ErrorCapacity))
+	}
+
+	if d.Err != nil {
+		entry.WithError(d.Err).Warn("2D code diagnostics")
+	} else {
+		entry.Info("2D code diagnostics")
+	}
+
+	for _, suggestion := range d.Suggestions() {
+		log.Info(suggestion)
+	}
+}
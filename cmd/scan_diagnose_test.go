@@ -0,0 +1,127 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestDiagnoseImage(t *testing.T) {
+	code, err := core.Encode2D(make([]byte, 100), core.Code2DOptions{Type: core.Code2DTypeQR, QRErrorCorrection: core.QRErrorCorrectionH})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := internal.Code2DImage(code, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modulePixels := float64(img.Bounds().Dx() / (code.Bounds().Dx() + 2*internal.Code2DQuietZone))
+
+	t.Run("clean", func(t *testing.T) {
+		d := diagnoseQR(matrixOf(t, img))
+		if d.Err != nil {
+			t.Fatalf("diagnoseQR failed with error %s", d.Err)
+		}
+		if math.Abs(d.ModuleSize-modulePixels) > 1 {
+			t.Errorf("got: %.1f px, want: %.1f px.", d.ModuleSize, modulePixels)
+		}
+		if d.ECLevel != "H" || d.ErrorsCorrected != 0 || d.ErrorCapacity == 0 {
+			t.Errorf("got: level %s, %d of %d errors corrected, want: level H, no errors.", d.ECLevel, d.ErrorsCorrected, d.ErrorCapacity)
+		}
+		if len(d.Suggestions()) != 0 {
+			t.Errorf("Expected no suggestions, got %v", d.Suggestions())
+		}
+	})
+
+	t.Run("damaged", func(t *testing.T) {
+		damaged := image.NewGray(img.Bounds())
+		copy(damaged.Pix, img.Pix)
+
+		// blot out a patch in the middle of the code
+		center := img.Bounds().Dx() / 2
+		for y := center - 40; y < center+40; y++ {
+			for x := center - 40; x < center+40; x++ {
+				damaged.SetGray(x, y, color.Gray{})
+			}
+		}
+
+		d := diagnoseQR(matrixOf(t, damaged))
+		if d.Err != nil {
+			t.Fatalf("diagnoseQR failed with error %s", d.Err)
+		}
+		if d.ErrorsCorrected == 0 {
+			t.Errorf("Expected corrected errors")
+		}
+	})
+
+	t.Run("blank", func(t *testing.T) {
+		blank := image.NewGray(image.Rect(0, 0, 200, 200))
+		for i := range blank.Pix {
+			blank.Pix[i] = 0xFF
+		}
+
+		for _, d := range diagnoseImage(blank) {
+			if d.Located || d.Err == nil || len(d.Suggestions()) == 0 {
+				t.Errorf("Expected %s code not to be located, with suggestions", d.Format)
+			}
+		}
+	})
+
+	t.Run("aztec", func(t *testing.T) {
+		code, err := core.Encode2D(make([]byte, 100), core.Code2DOptions{Type: core.Code2DTypeAztec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := internal.Code2DImage(code, 400)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := diagnoseAztec(matrixOf(t, img))
+		if !d.Located || d.Err != nil {
+			t.Fatalf("diagnoseAztec failed with error %v", d.Err)
+		}
+		if d.Symbol == "" || d.ECLevel == "" {
+			t.Errorf("Expected the symbol size and error correction level, got: %s, %s.", d.Symbol, d.ECLevel)
+		}
+	})
+}
+
+func matrixOf(t *testing.T, img image.Image) *gozxing.BitMatrix {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, err := bmp.GetBlackMatrix()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return matrix
+}
@@ -0,0 +1,269 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// selfTestVectors are the documents, and the data they hold, the self-test decrypts.
+// The documents were generated by earlier versions of PaperCrypt, using the passphrase selfTestPassphrase.
+//
+//go:embed selftest/*
+var selfTestVectors embed.FS
+
+const selfTestPassphrase = "example"
+
+// selfTest is a known-answer test run by 'selftest', failing with an error if the answer differs.
+type selfTest struct {
+	name string
+	run  func() error
+}
+
+// selfTests are the known-answer tests run by 'selftest', in order.
+var selfTests = []selfTest{
+	{"CRC-24", func() error {
+		return expectAnswer(fmt.Sprintf("%06x", core.Crc24Checksum([]byte("123456789"))), "21cf02")
+	}},
+	{"CRC-32", func() error {
+		return expectAnswer(fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte("123456789"))), "cbf43926")
+	}},
+	{"SHA-256", func() error {
+		sum := sha256.Sum256([]byte("abc"))
+		return expectAnswer(hex.EncodeToString(sum[:]), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+	}},
+	{"Version 1 document", func() error { return selfTestDocument("document-v1.txt") }},
+	{"Version 2 document", func() error { return selfTestDocument("document-v2.txt") }},
+	{"Encryption", selfTestEncryption},
+	{"Base 16 encoding", func() error {
+		return selfTestEncoding(internal.TextOptions{}, "a567bc6546ef1bdc1da9c0eeff8e75dbd6f15f26866cf9a6cc60c97ec91b694f")
+	}},
+	{"Base 32 encoding", func() error {
+		return selfTestEncoding(internal.TextOptions{Encoding: core.PaperCryptDataEncodingBase32}, "81b096a25c54d39e786832cefb4f323a32fc0b73257c3ebf9ebb20f1f951db4b")
+	}},
+	{"Base 64 encoding, SHA-256 line checksums", func() error {
+		return selfTestEncoding(internal.TextOptions{Encoding: core.PaperCryptDataEncodingBase64, LineChecksum: core.LineChecksumSHA256}, "91f1bc025a442acb56ab6ad9635e3aeaafe08973045dd68d1c81c21b0b8cead5")
+	}},
+	{"QR code", func() error {
+		return selfTestCode(core.Code2DTypeQR, "3dd349dfbc5cd5befc4a86e7a5b453879d311b41acc0a7bf1156ac70259d8b24")
+	}},
+	{"Aztec code", func() error {
+		return selfTestCode(core.Code2DTypeAztec, "a68248bdbbfd059a8654550450f6e9b2a47d1043ca28e76e304a00aed10f35e2")
+	}},
+}
+
+var selfTestCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "selftest",
+	Short:        "Check that this copy of PaperCrypt works correctly, before using it",
+	Long: `This command runs known-answer tests of the checksums, the encryption, the encodings of the data,
+the 2D codes, and the reading of version 1 and 2 documents, against test vectors built into the binary.
+
+Run it on an air-gapped machine, before generating, or restoring, a document,
+to make sure the binary was not corrupted on its way there. The command fails if any test fails.`,
+	Example: `papercrypt selftest`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		var fields [][2]string
+		failed := 0
+		for _, test := range selfTests {
+			result := "ok"
+			if err := test.run(); err != nil {
+				failed++
+				result = "FAILED: " + strings.ReplaceAll(err.Error(), "\n", ", ")
+			}
+			fields = append(fields, [2]string{test.name, result})
+		}
+
+		if err := writeFields(cmd.OutOrStdout(), fields); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("%d of %d self-tests failed, this copy of PaperCrypt may be corrupted, do not use it", failed, len(selfTests)))
+		}
+
+		log.Info(core.Bold(fmt.Sprintf("All %d self-tests passed.", len(selfTests))))
+		return nil
+	},
+}
+
+// expectAnswer returns an error if got is not the known answer want.
+func expectAnswer(got string, want string) error {
+	if got != want {
+		return fmt.Errorf("got %s, expected %s", got, want)
+	}
+
+	return nil
+}
+
+// selfTestPlaintext returns the data the test documents hold.
+func selfTestPlaintext() ([]byte, error) {
+	return selfTestVectors.ReadFile("selftest/plaintext.json")
+}
+
+// selfTestDocument reads, and decrypts, a test document, comparing the data to the known plaintext.
+func selfTestDocument(name string) error {
+	text, err := selfTestVectors.ReadFile("selftest/" + name)
+	if err != nil {
+		return err
+	}
+	want, err := selfTestPlaintext()
+	if err != nil {
+		return err
+	}
+
+	pc, err := deserializeDocument(text)
+	if err != nil {
+		return err
+	}
+	decoded, err := pc.Decode([]byte(selfTestPassphrase))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(decoded, want) {
+		return errors.New("the decrypted data differs from the known plaintext")
+	}
+
+	return nil
+}
+
+// selfTestEncryption encrypts the known plaintext, the encryption being randomized, the result is decrypted,
+// rather than compared to a known answer, a wrong passphrase must not decrypt it.
+func selfTestEncryption() error {
+	plaintext, err := selfTestPlaintext()
+	if err != nil {
+		return err
+	}
+
+	data, err := core.CompressAndEncrypt([]byte(selfTestPassphrase), plaintext, false)
+	if err != nil {
+		return err
+	}
+	pc := core.NewPaperCrypt("selftest", data, "SELFTEST", "", "", time.Now(), core.PaperCryptDataFormatPGP)
+
+	decoded, err := pc.Decode([]byte(selfTestPassphrase))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(decoded, plaintext) {
+		return errors.New("the decrypted data differs from the plaintext encrypted")
+	}
+	if _, err := pc.Decode([]byte("not the " + selfTestPassphrase)); err == nil {
+		return errors.New("the data was decrypted with a wrong passphrase")
+	}
+
+	return nil
+}
+
+// selfTestEncodingDocument returns the document the encodings are tested with,
+// holding every byte value, so the text written is always the same.
+func selfTestEncodingDocument() *core.PaperCrypt {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	return core.NewPaperCrypt("2.0.0", data, "SELFTEST", "Self-Test", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), core.PaperCryptDataFormatRaw)
+}
+
+// selfTestEncoding writes the test document with opts, comparing the SHA-256 checksum of its text to the known answer,
+// and reads it back.
+func selfTestEncoding(opts internal.TextOptions, want string) error {
+	pc := selfTestEncodingDocument()
+	text, err := pc.GetText(opts.EncodingOptions())
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(text)
+	if err := expectAnswer(hex.EncodeToString(sum[:]), want); err != nil {
+		return err
+	}
+
+	restored, err := core.DeserializeV2Text(text, false, false)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(restored.Data, pc.Data) {
+		return errors.New("the data read back differs from the data written")
+	}
+
+	return nil
+}
+
+// selfTestCode encodes the 2D code payload of the test document, comparing the SHA-256 checksum of its modules
+// to the known answer, and reads the code back from an image of it.
+func selfTestCode(codeType core.Code2DType, want string) error {
+	payload, err := selfTestEncodingDocument().QRPayload(core.QRPayloadFormatJSON)
+	if err != nil {
+		return err
+	}
+
+	code, err := core.Encode2D(payload, core.Code2DOptions{Type: codeType, QRErrorCorrection: core.QRErrorCorrectionM})
+	if err != nil {
+		return err
+	}
+	var modules bytes.Buffer
+	bounds := code.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _, _ := code.At(x, y).RGBA()
+			modules.WriteByte(byte(r >> 15))
+		}
+	}
+	sum := sha256.Sum256(modules.Bytes())
+	if err := expectAnswer(hex.EncodeToString(sum[:]), want); err != nil {
+		return err
+	}
+
+	img, err := internal.Code2DImage(code, 4*bounds.Dx()+4*2*internal.Code2DQuietZone)
+	if err != nil {
+		return err
+	}
+	payloads, err := core.ScanCodeImage(img)
+	if err != nil {
+		return err
+	}
+	for _, scanned := range payloads {
+		if bytes.Equal(scanned, payload) {
+			return nil
+		}
+	}
+
+	return errors.New("the payload read back differs from the payload encoded")
+}
+
+func init() {
+	rootCmd.AddCommand(selfTestCmd)
+}
@@ -0,0 +1,54 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+
+	rootCmd.SetArgs([]string{"selftest"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Expected all self-tests to pass, got %s:\n%s", err, out.String())
+	}
+	if strings.Count(out.String(), ": ") != len(selfTests) || strings.Contains(out.String(), "FAILED") {
+		t.Fatalf("Expected a result for each self-test, got:\n%s", out.String())
+	}
+
+	// a failing test fails the command
+	defer func(tests []selfTest) { selfTests = tests }(selfTests)
+	selfTests = append(selfTests, selfTest{"corrupted", func() error { return errors.New("corrupted") }})
+
+	out.Reset()
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("Expected an error for a failing self-test")
+	}
+	if !strings.Contains(out.String(), "FAILED: corrupted") {
+		t.Fatalf("Expected the failing self-test in the output, got:\n%s", out.String())
+	}
+}
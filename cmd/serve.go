@@ -0,0 +1,435 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// serveMaxRequestSize limits the body of API requests, large enough for scans of a few pages.
+const serveMaxRequestSize = 64 << 20
+
+var (
+	serveAddress string
+	serveWebPage bool
+)
+
+var serveCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "serve",
+	Short:        "Serve an HTTP API on localhost, to generate, decode, and inspect documents",
+	Long: `This command serves a REST API on the loopback interface, for tools and browser-based front ends
+to drive PaperCrypt without running the CLI for every operation. Requests and responses are JSON,
+binary data (the input of a document, and the document to decode) is base64 encoded.
+
+  POST /api/generate  {"data", "passphrase", "purpose", "comment", "serial_number", "raw", "plaintext_hash",
+                       "encoding", "paper", "lang", "no_qr", "format": "pdf", "html", or "text"}
+                      returns the document, its serial number in the X-PaperCrypt-Serial header
+  POST /api/decode    {"document", "passphrase"}, the document as read by 'restore': a PDF, its text, a scan,
+                      the 2D code payload, or an OpenPGP message, returns {"data", "serial_number", "purpose", "comment"}
+  POST /api/info      {"document"}, returns the fields printed by 'info', as [{"name", "value"}]
+
+Failures return {"error", "category"}, with the category of the failure, as told by the exit codes.
+With --web, a minimal page for these operations is served at /.
+
+The API handles plaintext, and passphrases, unencrypted, so it only listens on the loopback interface,
+and only answers requests for a loopback host name, and with a JSON body, which web pages of other origins
+can not send. Generated, and decoded documents are recorded in the audit log, if there is one.
+Requests are handled one at a time.`,
+	Example: "papercrypt serve --listen 127.0.0.1:8080 --web",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		host, _, err := net.SplitHostPort(serveAddress)
+		if err != nil {
+			return errors.Join(fmt.Errorf("invalid address '%s'", serveAddress), err)
+		}
+		if !isLoopbackHost(host) {
+			return fmt.Errorf("the API handles plaintext, and passphrases, unencrypted, it only listens on the loopback interface, not on '%s'", host)
+		}
+
+		auditLog, err := openAuditLog()
+		if err != nil {
+			return err
+		}
+
+		listener, err := net.Listen("tcp", serveAddress)
+		if err != nil {
+			return errors.Join(errors.New("error listening"), err)
+		}
+		server := &http.Server{
+			Handler:           newAPIHandler(auditLog, serveWebPage),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+
+		log.WithField("address", "http://"+listener.Addr().String()).Info("Serving the PaperCrypt API, stop with Ctrl+C")
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return errors.Join(errors.New("error serving the API"), err)
+		}
+		return nil
+	},
+}
+
+// isLoopbackHost returns whether host names the loopback interface, as localhost, or a loopback IP address.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// generateRequest is the body of POST /api/generate.
+type generateRequest struct {
+	Data          []byte `json:"data"`
+	Passphrase    string `json:"passphrase"`
+	Purpose       string `json:"purpose"`
+	Comment       string `json:"comment"`
+	SerialNumber  string `json:"serial_number"`
+	Raw           bool   `json:"raw"`
+	PlaintextHash bool   `json:"plaintext_hash"`
+	Encoding      string `json:"encoding"`
+	Paper         string `json:"paper"`
+	Language      string `json:"lang"`
+	NoQR          bool   `json:"no_qr"`
+	Format        string `json:"format"`
+}
+
+// decodeRequest is the body of POST /api/decode, and of POST /api/info, which ignores the passphrase.
+type decodeRequest struct {
+	Document   []byte `json:"document"`
+	Passphrase string `json:"passphrase"`
+}
+
+// decodeResponse is the body answering POST /api/decode.
+type decodeResponse struct {
+	Data         []byte `json:"data"`
+	SerialNumber string `json:"serial_number"`
+	Purpose      string `json:"purpose,omitempty"`
+	Comment      string `json:"comment,omitempty"`
+}
+
+// infoField is a field of the body answering POST /api/info.
+type infoField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// apiError is the body answering failed requests.
+type apiError struct {
+	Error    string `json:"error"`
+	Category string `json:"category"`
+}
+
+// apiHandler serves the API of 'serve'. Requests are handled one at a time,
+// as the commands it shares code with keep their settings in package variables.
+type apiHandler struct {
+	mu       sync.Mutex
+	mux      *http.ServeMux
+	auditLog *internal.AuditLog
+}
+
+// newAPIHandler returns the handler of the API, recording documents in auditLog, if not nil,
+// and serving the web page at /, if web is set.
+func newAPIHandler(auditLog *internal.AuditLog, web bool) http.Handler {
+	h := &apiHandler{mux: http.NewServeMux(), auditLog: auditLog}
+	h.mux.HandleFunc("POST /api/generate", h.generate)
+	h.mux.HandleFunc("POST /api/decode", h.decode)
+	h.mux.HandleFunc("POST /api/info", h.info)
+	if web {
+		h.mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'; img-src blob:")
+			_, _ = w.Write([]byte(serveWebPageHTML))
+		})
+	}
+
+	return h
+}
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// requests naming another host are sent by web pages resolving their own domain to the loopback address
+	host := r.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	if !isLoopbackHost(host) {
+		writeAPIError(w, http.StatusForbidden, fmt.Errorf("requests for the host '%s' are not answered", r.Host))
+		return
+	}
+	if r.Method == http.MethodPost {
+		if mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";"); !strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+			writeAPIError(w, http.StatusUnsupportedMediaType, errors.New("the body of requests must be JSON (Content-Type: application/json)"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, serveMaxRequestSize)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mux.ServeHTTP(w, r)
+}
+
+// audit records an operation of the API in the audit log, if there is one.
+func (h *apiHandler) audit(operation string, serialNumber string, err error) {
+	if h.auditLog == nil {
+		return
+	}
+	if auditErr := recordAudit(h.auditLog, "serve "+operation, serialNumber, err); auditErr != nil {
+		log.WithError(auditErr).Error("Could not record the request in the audit log")
+	}
+}
+
+func (h *apiHandler) generate(w http.ResponseWriter, r *http.Request) {
+	var req generateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errors.Join(errors.New("invalid request"), err))
+		return
+	}
+
+	document, contentType, serial, err := generateAPIDocument(req)
+	h.audit("generate", serial, err)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-PaperCrypt-Serial", serial)
+	_, _ = w.Write(document)
+}
+
+func (h *apiHandler) decode(w http.ResponseWriter, r *http.Request) {
+	var req decodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errors.Join(errors.New("invalid request"), err))
+		return
+	}
+
+	pc, decoded, err := decodeAPIDocument(req)
+	serial := ""
+	if pc != nil {
+		serial = pc.SerialNumber
+	}
+	h.audit("decode", serial, err)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeAPIJSON(w, decodeResponse{Data: decoded, SerialNumber: pc.SerialNumber, Purpose: pc.Purpose, Comment: pc.Comment})
+}
+
+func (h *apiHandler) info(w http.ResponseWriter, r *http.Request) {
+	var req decodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errors.Join(errors.New("invalid request"), err))
+		return
+	}
+	if len(req.Document) == 0 {
+		writeAPIError(w, http.StatusBadRequest, errors.New("the request holds no document"))
+		return
+	}
+
+	fields, err := documentInfo(detectRestoreInput(req.Document), []string{"document"}, [][]byte{req.Document})
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := make([]infoField, len(fields))
+	for i, field := range fields {
+		response[i] = infoField{Name: field[0], Value: field[1]}
+	}
+	writeAPIJSON(w, response)
+}
+
+// generateAPIDocument generates the document of a request to /api/generate,
+// and returns it, with its content type, and serial number.
+func generateAPIDocument(req generateRequest) ([]byte, string, string, error) {
+	if len(req.Data) == 0 {
+		return nil, "", "", errors.New("the request holds no data")
+	}
+	if req.Passphrase == "" && !req.Raw {
+		return nil, "", "", errors.New("the request holds no passphrase, give one, or generate a raw document")
+	}
+
+	if req.Encoding == "" {
+		req.Encoding = core.PaperCryptDataEncodingBase16.String()
+	}
+	encoding := core.PaperCryptDataEncodingFromString(req.Encoding)
+	if encoding == core.PaperCryptDataEncodingUnknown {
+		return nil, "", "", fmt.Errorf("unknown data encoding '%s', must be one of: base16, base32, base64, armor, words", req.Encoding)
+	}
+	paper := core.PaperSizeFromString(req.Paper)
+	if paper == core.PaperSizeUnknown {
+		return nil, "", "", fmt.Errorf("unknown paper size '%s', must be one of: a4, letter, a5, legal", req.Paper)
+	}
+	page := core.Page{Paper: paper}
+	language, err := internal.LoadLanguage(req.Language)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	layout := core.DefaultDataLayout
+	if encoding != core.PaperCryptDataEncodingArmor && encoding != core.PaperCryptDataEncodingWords {
+		// as 'generate' does
+		layout.Columns = max(core.BytesPerLine/layout.GroupSize, 1)
+		layout = page.FitDataLayout(layout)
+	}
+	opts := internal.TextOptions{
+		Encoding: encoding,
+		Layout:   layout,
+		Code2D: core.Code2DOptions{
+			DPI:       core.Code2DDefaultDPI,
+			PrintArea: page.Code2DPrintSize(),
+		},
+		Page:     page,
+		Language: language,
+	}
+
+	serial := req.SerialNumber
+	if serial == "" {
+		serial, err = core.GenerateSerialFromCharset(core.DefaultSerialLength, core.DefaultSerialCharset)
+		if err != nil {
+			return nil, "", "", errors.Join(errors.New("error generating serial number"), err)
+		}
+	}
+
+	data, err := core.CompressAndEncrypt([]byte(req.Passphrase), req.Data, req.Raw)
+	if err != nil {
+		return nil, "", serial, err
+	}
+	format := core.PaperCryptDataFormatPGP
+	if req.Raw {
+		format = core.PaperCryptDataFormatRaw
+	}
+	crypt := core.NewPaperCrypt(core.VersionInfo.GitVersion, data, serial, req.Purpose, req.Comment, time.Now(), format)
+	if req.PlaintextHash {
+		plaintextSHA256 := sha256.Sum256(req.Data)
+		crypt.PlaintextSHA256 = plaintextSHA256[:]
+	}
+	if !req.Raw {
+		// as 'generate' does, documents with a passphrase are of format version 3, with a header MAC
+		if err := crypt.Authenticate([]byte(req.Passphrase)); err != nil {
+			return nil, "", serial, err
+		}
+	}
+
+	var document []byte
+	var contentType string
+	switch strings.ToLower(req.Format) {
+	case "", "pdf":
+		document, err = internal.RendererPDF.Render(crypt, req.NoQR, opts)
+		contentType = "application/pdf"
+	case "html":
+		document, err = internal.RendererHTML.Render(crypt, req.NoQR, opts)
+		contentType = "text/html; charset=utf-8"
+	case "text":
+		document, err = crypt.GetText(opts.EncodingOptions())
+		contentType = "text/plain; charset=utf-8"
+	default:
+		return nil, "", serial, fmt.Errorf("unknown format '%s', must be one of: pdf, html, text", req.Format)
+	}
+	if err != nil {
+		return nil, "", serial, errors.Join(errors.New("error rendering the document"), err)
+	}
+
+	return document, contentType, serial, nil
+}
+
+// decodeAPIDocument reads the document of a request to /api/decode, as restore does, and decrypts it.
+// The document is returned as soon as it is read, so its serial number can be recorded.
+func decodeAPIDocument(req decodeRequest) (*core.PaperCrypt, []byte, error) {
+	if len(req.Document) == 0 {
+		return nil, nil, errors.New("the request holds no document")
+	}
+
+	pc, err := restoreDocument(detectRestoreInput(req.Document), []string{"document"}, [][]byte{req.Document})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoded, err := pc.Decode([]byte(req.Passphrase))
+	if err != nil {
+		return pc, nil, errors.Join(errors.New("error decrypting data"), err)
+	}
+	if err := verifyDecoded(pc, decoded); err != nil {
+		return pc, nil, err
+	}
+
+	return pc, decoded, nil
+}
+
+// writeAPIJSON answers a request with body, serialized as JSON.
+func writeAPIJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Error("Error writing the response")
+	}
+}
+
+// writeAPIError answers a failed request, with status, or the status fitting the category of err.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	category := core.CategoryOf(err)
+	switch category {
+	case core.ErrorCategoryPassphrase:
+		status = http.StatusForbidden
+	case core.ErrorCategoryChecksum, core.ErrorCategoryUnreadableCode, core.ErrorCategoryVersion:
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiError{Error: err.Error(), Category: category.String()})
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddress, "listen", "127.0.0.1:8080", "Address to listen on, on the loopback interface (port 0 picks a free port)")
+	serveCmd.Flags().BoolVar(&serveWebPage, "web", false, "Also serve a minimal web page at /, to generate, decode, and inspect documents from a browser")
+}
@@ -0,0 +1,143 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+// serveWebPageHTML is the web page of 'serve --web', a front end to its API, without any dependencies.
+const serveWebPageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>PaperCrypt</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; padding: 0 1em; }
+fieldset { margin-bottom: 1.5em; }
+label { display: block; margin: 0.5em 0; }
+textarea { width: 100%; height: 8em; font-family: monospace; }
+pre { background: #f0f0f0; padding: 0.5em; white-space: pre-wrap; word-break: break-all; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>PaperCrypt</h1>
+
+<fieldset>
+<legend>Generate a document</legend>
+<label>Data <textarea id="generate-data"></textarea></label>
+<label>or a file <input type="file" id="generate-file"></label>
+<label>Passphrase <input type="password" id="generate-passphrase"></label>
+<label>Purpose <input type="text" id="generate-purpose"></label>
+<label>Comment <input type="text" id="generate-comment"></label>
+<label>Format <select id="generate-format"><option>pdf</option><option>html</option><option>text</option></select></label>
+<button id="generate">Generate</button>
+</fieldset>
+
+<fieldset>
+<legend>Decode, or inspect, a document</legend>
+<label>Document (PDF, text, scan, or OpenPGP message) <input type="file" id="decode-file"></label>
+<label>Passphrase <input type="password" id="decode-passphrase"></label>
+<button id="decode">Decode</button> <button id="info">Info</button>
+</fieldset>
+
+<div id="result"></div>
+
+<script>
+const result = document.getElementById("result");
+
+function show(text, error) {
+  const pre = document.createElement("pre");
+  pre.textContent = text;
+  if (error) pre.className = "error";
+  result.replaceChildren(pre);
+}
+
+function readBase64(file) {
+  return new Promise((resolve, reject) => {
+    const reader = new FileReader();
+    reader.onload = () => resolve(reader.result.substring(reader.result.indexOf(",") + 1));
+    reader.onerror = () => reject(reader.error);
+    reader.readAsDataURL(file);
+  });
+}
+
+function textBase64(text) {
+  return btoa(String.fromCharCode(...new TextEncoder().encode(text)));
+}
+
+async function call(path, body) {
+  const response = await fetch(path, {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify(body)});
+  if (!response.ok) {
+    const failure = await response.json();
+    throw new Error(failure.error + " (" + failure.category + ")");
+  }
+  return response;
+}
+
+async function documentFile() {
+  const file = document.getElementById("decode-file").files[0];
+  if (!file) throw new Error("Choose a document first.");
+  return readBase64(file);
+}
+
+document.getElementById("generate").onclick = async () => {
+  try {
+    const file = document.getElementById("generate-file").files[0];
+    const response = await call("/api/generate", {
+      data: file ? await readBase64(file) : textBase64(document.getElementById("generate-data").value),
+      passphrase: document.getElementById("generate-passphrase").value,
+      purpose: document.getElementById("generate-purpose").value,
+      comment: document.getElementById("generate-comment").value,
+      format: document.getElementById("generate-format").value,
+    });
+    const serial = response.headers.get("X-PaperCrypt-Serial");
+    const link = document.createElement("a");
+    link.href = URL.createObjectURL(await response.blob());
+    link.download = "papercrypt-" + serial + "." + {pdf: "pdf", html: "html", text: "txt"}[document.getElementById("generate-format").value];
+    link.textContent = "Download the document " + serial;
+    result.replaceChildren(link);
+  } catch (error) {
+    show(error.message, true);
+  }
+};
+
+document.getElementById("decode").onclick = async () => {
+  try {
+    const response = await call("/api/decode", {document: await documentFile(), passphrase: document.getElementById("decode-passphrase").value});
+    const decoded = await response.json();
+    const bytes = Uint8Array.from(atob(decoded.data || ""), c => c.charCodeAt(0));
+    show(new TextDecoder().decode(bytes));
+  } catch (error) {
+    show(error.message, true);
+  }
+};
+
+document.getElementById("info").onclick = async () => {
+  try {
+    const response = await call("/api/info", {document: await documentFile()});
+    const fields = await response.json();
+    show(fields.map(field => field.name + ": " + field.value).join("\n"));
+  } catch (error) {
+    show(error.message, true);
+  }
+};
+</script>
+</body>
+</html>
+`
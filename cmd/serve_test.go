@@ -0,0 +1,128 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// serveRequest sends a request to handler, for the loopback host, with body serialized as JSON.
+func serveRequest(t *testing.T, handler http.Handler, method string, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Host = "127.0.0.1:8080"
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestServe(t *testing.T) {
+	loadFonts(t)
+	core.VersionInfo.GitVersion = "2.0.0"
+	handler := newAPIHandler(nil, true)
+
+	generated := serveRequest(t, handler, http.MethodPost, "/api/generate", generateRequest{Data: []byte("secret"), Passphrase: "example", Purpose: "API", Format: "text"})
+	if generated.Code != http.StatusOK {
+		t.Fatalf("Expected the document, got: %d %s", generated.Code, generated.Body)
+	}
+	serial := generated.Header().Get("X-PaperCrypt-Serial")
+	if serial == "" || !strings.Contains(generated.Body.String(), serial) {
+		t.Fatalf("Expected the serial number of the document, got: %s", serial)
+	}
+	document := generated.Body.Bytes()
+	pc, err := core.DeserializeText(document, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.FormatVersion != core.PaperCryptContainerVersionMajor3 || pc.VerifyHeaderMAC([]byte("example")) != nil {
+		t.Fatalf("Expected a document with a header MAC, got format version: %v", pc.FormatVersion)
+	}
+
+	decoded := serveRequest(t, handler, http.MethodPost, "/api/decode", decodeRequest{Document: document, Passphrase: "example"})
+	var response decodeResponse
+	if err := json.Unmarshal(decoded.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if string(response.Data) != "secret" || response.SerialNumber != serial || response.Purpose != "API" {
+		t.Fatalf("Expected the data of the document, got: %+v", response)
+	}
+
+	if got := serveRequest(t, handler, http.MethodPost, "/api/decode", decodeRequest{Document: document, Passphrase: "wrong"}); got.Code != http.StatusForbidden || !strings.Contains(got.Body.String(), core.ErrorCategoryPassphrase.String()) {
+		t.Fatalf("Expected a bad passphrase to be forbidden, got: %d %s", got.Code, got.Body)
+	}
+
+	info := serveRequest(t, handler, http.MethodPost, "/api/info", decodeRequest{Document: document})
+	var fields []infoField
+	if err := json.Unmarshal(info.Body.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) == 0 || fields[0].Name != core.HeaderFieldSerial || fields[0].Value != serial {
+		t.Fatalf("Expected the fields of the document, got: %v", fields)
+	}
+
+	if got := serveRequest(t, handler, http.MethodPost, "/api/generate", generateRequest{Data: []byte("secret")}); got.Code != http.StatusBadRequest {
+		t.Fatalf("Expected an error for a missing passphrase, got: %d", got.Code)
+	}
+	if got := serveRequest(t, handler, http.MethodGet, "/", nil); got.Code != http.StatusOK || !strings.Contains(got.Body.String(), "/api/generate") {
+		t.Fatalf("Expected the web page, got: %d", got.Code)
+	}
+
+	// requests web pages of other origins could send are not answered
+	req := httptest.NewRequest(http.MethodPost, "/api/info", strings.NewReader("document="))
+	req.Host = "127.0.0.1:8080"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected form data to be refused, got: %d", recorder.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "attacker.example:8080"
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("Expected a request for another host to be refused, got: %d", recorder.Code)
+	}
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{"localhost": true, "127.0.0.1": true, "[::1]": true, "::1": true, "0.0.0.0": false, "192.168.1.2": false, "example.com": false, "": false} {
+		if got := isLoopbackHost(host); got != want {
+			t.Errorf("isLoopbackHost(%q) was incorrect, got: %t, want: %t.", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	testPagePaperSize string
+	testPageDPI       int
+)
+
+var testPageCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "testpage",
+	Short:        "Generate a calibration page, to find the smallest 2D codes your printer and scanner reproduce",
+	Long: `This command generates a calibration page: 2D codes (Aztec, and QR codes of each error correction level)
+of several module sizes, samples of the data font in several sizes, a ruler, and the corner markers that locate the page in a scan.
+Print it at actual size, on the printer and paper you print documents on, scan it, and check the scan using 'papercrypt testpage verify',
+which reports the codes read, and the smallest module size that is safe to pass to 'generate --qr-module-size'.
+
+The codes are rendered for a printer of the resolution given with --qr-dpi, pass the same value to 'generate'.`,
+	Example: `papercrypt testpage -o testpage.pdf
+papercrypt testpage verify scan.png`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		paper := core.PaperSizeFromString(testPagePaperSize)
+		if paper == core.PaperSizeUnknown {
+			return fmt.Errorf("unknown paper size '%s', must be one of: a4, letter, legal", testPagePaperSize)
+		}
+
+		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
+			if err != nil {
+				log.WithError(err).Error("Error closing file")
+			}
+		}(outFile)
+
+		doc, err := internal.GetTestPagePDF(core.Page{Paper: paper}, testPageDPI)
+		if err != nil {
+			return errors.Join(errors.New("error generating the test page"), err)
+		}
+
+		n, err := outFile.Write(doc)
+		if err != nil {
+			return errors.Join(errors.New("error writing to file"), err)
+		}
+
+		internal.PrintWrittenSize(n, outFile)
+		return nil
+	},
+}
+
+var testPageVerifyCmd = &cobra.Command{
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "verify [<scan>]",
+	Short:             "Check a scan of the printed test page",
+	Long: `This command reads the codes of a scan, or photo, of the printed test page (an image, or a scanned PDF or TIFF file),
+and reports which were read. Each code is located by the corner markers, and read on its own, at the resolution of the scan.
+
+For each kind of code, the smallest safe module size is the next larger one after the smallest size read,
+along with every larger size, so one size is kept as a margin for worn sheets and other scanners.
+Pass it to 'generate --qr-module-size'. Codes that fail because the scan resolution is too low are pointed out,
+scan at a higher resolution to test them.`,
+	Example: `papercrypt testpage verify scan.png`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input := inFileName
+		if len(args) > 0 {
+			input = args[0]
+		}
+		data, err := internal.PrintInputAndRead(input)
+		if err != nil {
+			return err
+		}
+		pages, err := testPagePages(data)
+		if err != nil {
+			return errors.Join(fmt.Errorf("error decoding image %s", input), err)
+		}
+
+		scan := internal.TestPageScan{Read: map[internal.TestPageSample]bool{}}
+		for _, page := range pages {
+			pageScan := internal.ScanTestPage(page, scanImage)
+			if pageScan.Located && !scan.Located {
+				scan.Located, scan.PixelsPerMM = true, pageScan.PixelsPerMM
+			}
+			for sample := range pageScan.Read {
+				scan.Read[sample] = true
+			}
+		}
+
+		if scan.Located {
+			log.WithField("resolution", fmt.Sprintf("%.1f pixels per mm (%.0f dpi)", scan.PixelsPerMM, scan.PixelsPerMM*25.4)).Info("Located the test page")
+		} else {
+			log.Warn(core.Warning("The corner markers of the test page were not found, the codes were looked for in the whole image. Scan the whole page, including its corners."))
+		}
+		if len(scan.Read) == 0 {
+			return core.WithCategory(core.ErrorCategoryUnreadableCode, errors.New("no code of the test page was read"))
+		}
+
+		if err := writeTestPageResults(cmd.OutOrStdout(), scan); err != nil {
+			return err
+		}
+		logTestPageResolution(scan)
+		log.Info("Pass the module size of the SAFE row to 'generate --qr-module-size', for the kind of code you print.")
+		return nil
+	},
+}
+
+// testPagePages returns the pages of a scan of the test page. The test page PDF itself is rendered,
+// at internal.DefaultRasterDPI, as its codes are images, which would be read as they are, rather than as printed.
+func testPagePages(data []byte) ([]image.Image, error) {
+	if !internal.IsTestPagePDF(data) {
+		return decodePages(data)
+	}
+
+	log.Warn(core.Warning(fmt.Sprintf("This is the test page PDF, not a scan of it, it is checked as rendered at %d dpi. Print, and scan it, to test your printer and scanner.", internal.DefaultRasterDPI)))
+	var pages []image.Image
+	err := internal.RasterizePDF(data, internal.DefaultRasterDPI, func(_, _ int, img *image.RGBA) error {
+		pages = append(pages, img)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+// safeTestPageModuleSize returns the smallest module size of a kind of code, such as internal.TestPageCodes returns,
+// that was read, along with every larger size, and the next larger size, if there is one, as a margin.
+// It returns false if the largest size was not read.
+func safeTestPageModuleSize(scan internal.TestPageScan, kind internal.TestPageSample) (float64, bool) {
+	sizes := internal.TestPageModuleSizes
+	smallest := len(sizes)
+	for i := len(sizes) - 1; i >= 0; i-- {
+		kind.ModuleSize = sizes[i]
+		if !readTestPageSample(scan, kind) {
+			break
+		}
+		smallest = i
+	}
+	if smallest == len(sizes) {
+		return 0, false
+	}
+
+	return sizes[min(smallest+1, len(sizes)-1)], true
+}
+
+// readTestPageSample returns whether the code of the given kind, and module size, was read.
+func readTestPageSample(scan internal.TestPageScan, kind internal.TestPageSample) bool {
+	for sample := range scan.Read {
+		if sample.ModuleSize == kind.ModuleSize && sample.Code() == kind.Code() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeTestPageResults writes the codes read as a table, a row per module size, and a column per kind of code,
+// followed by the smallest safe module size of each kind.
+func writeTestPageResults(w io.Writer, scan internal.TestPageScan) error {
+	kinds := internal.TestPageCodes()
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := []string{"MODULE"}
+	for _, kind := range kinds {
+		header = append(header, strings.ToUpper(kind.Code()))
+	}
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+
+	for _, size := range internal.TestPageModuleSizes {
+		row := []string{fmt.Sprintf("%.2f mm", size)}
+		for _, kind := range kinds {
+			kind.ModuleSize = size
+			result := "failed"
+			if readTestPageSample(scan, kind) {
+				result = "read"
+			}
+			row = append(row, result)
+		}
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+
+	safe := []string{"SAFE"}
+	for _, kind := range kinds {
+		size, ok := safeTestPageModuleSize(scan, kind)
+		if !ok {
+			safe = append(safe, "none")
+			continue
+		}
+		safe = append(safe, fmt.Sprintf("%.2fmm", size))
+	}
+	fmt.Fprintln(table, strings.Join(safe, "\t"))
+
+	if err := table.Flush(); err != nil {
+		return errors.Join(errors.New("error writing to file"), err)
+	}
+	return nil
+}
+
+// logTestPageResolution points out the module sizes that failed, as they are too few pixels wide in the scan,
+// rather than printed badly.
+func logTestPageResolution(scan internal.TestPageScan) {
+	if !scan.Located {
+		return
+	}
+
+	for _, size := range internal.TestPageModuleSizes {
+		pixels := size * scan.PixelsPerMM
+		if pixels >= minModulePixels {
+			return
+		}
+		for _, kind := range internal.TestPageCodes() {
+			kind.ModuleSize = size
+			if !readTestPageSample(scan, kind) {
+				log.WithField("module size", fmt.Sprintf("%.2f mm", size)).Info(fmt.Sprintf("Modules are only %.1f pixels wide in the scan, scan at a higher resolution to test this size.", pixels))
+				break
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(testPageCmd)
+	testPageCmd.AddCommand(testPageVerifyCmd)
+
+	testPageCmd.Flags().StringVar(&testPagePaperSize, "paper", "a4", "Paper size of the test page, either 'a4', 'letter', or 'legal'")
+	testPageCmd.Flags().IntVar(&testPageDPI, "qr-dpi", core.Code2DDefaultDPI, "Printer resolution the codes are rendered for, so each module covers whole dots")
+	testPageVerifyCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+
+	_ = testPageCmd.RegisterFlagCompletionFunc("paper", completePaperSizes)
+}
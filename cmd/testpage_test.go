@@ -0,0 +1,106 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// verifyTestPage runs 'testpage verify' on the file, and returns the rows of the table it writes,
+// failing the test unless the largest codes are read.
+func verifyTestPage(t *testing.T, path string) []string {
+	t.Helper()
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"testpage", "verify", path})
+	defer resetFlags(testPageVerifyCmd)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(internal.TestPageModuleSizes)+2 {
+		t.Fatalf("Expected a row per module size, got:\n%s", out.String())
+	}
+	if fields := strings.Fields(lines[len(lines)-1]); len(fields) != 6 || fields[0] != "SAFE" || fields[1] == "none" {
+		t.Fatalf("Expected a safe module size for each kind of code, got: %s", lines[len(lines)-1])
+	}
+	if !strings.Contains(lines[len(lines)-2], "0.60 mm  read    read    read    read    read") {
+		t.Fatalf("Expected the largest codes to be read, got: %s", lines[len(lines)-2])
+	}
+
+	return lines
+}
+
+func TestTestPage(t *testing.T) {
+	loadFonts(t)
+
+	tempDir := t.TempDir()
+	pdfPath := filepath.Join(tempDir, "testpage.pdf")
+	rootCmd.SetArgs([]string{"testpage", "-o", pdfPath})
+	defer resetFlags(testPageCmd)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("pdf", func(t *testing.T) {
+		// the page is rendered, rather than its code images read
+		lines := verifyTestPage(t, pdfPath)
+		if !strings.Contains(lines[1], "0.20 mm  read    read    read    read    read") {
+			t.Fatalf("Expected all codes to be read, got: %s", lines[1])
+		}
+	})
+
+	// print, and scan the page in shades of gray, as scanners do, at 300 dpi,
+	// and at 150 dpi, where the smaller codes are preprocessed, and fail
+	doc, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dpi := range []float64{300, 150} {
+		t.Run(fmt.Sprintf("%.0f dpi", dpi), func(t *testing.T) {
+			scanPath := filepath.Join(tempDir, fmt.Sprintf("scan-%.0f.png", dpi))
+			err := internal.RasterizePDF(doc, dpi, func(_, _ int, img *image.RGBA) error {
+				scan, err := internal.EncodePNG(core.GrayImage(img), dpi)
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(scanPath, scan, 0o600)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verifyTestPage(t, scanPath)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	transcriptionLines         int
+	transcriptionEncoding      string
+	transcriptionGroupSize     int
+	transcriptionColumns       int
+	transcriptionBlockLines    int
+	transcriptionNoLineIndices bool
+	transcriptionColumnIndices bool
+	transcriptionLineChecksum  string
+	transcriptionPaperSize     string
+	transcriptionLandscape     bool
+	transcriptionLang          string
+)
+
+// transcriptionTemplateCmd represents the transcription-template command.
+var transcriptionTemplateCmd = &cobra.Command{
+	Aliases:      []string{"blank", "tt"},
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "transcription-template",
+	Short:        "Generate a blank template to copy a document onto by hand",
+	Long: `The 'transcription-template' command writes a blank PDF template, holding the fields of the header,
+and a grid of cells sized for the encoding and layout of the data block, with cells for the checksum of each line.
+
+Where no printer can be trusted with a secret, print the template in advance, generate the document on an
+offline machine using the options printed on the template, and copy it onto the template by hand.
+To restore it, type the copy into a text file, and decode it using 'papercrypt decode'.`,
+	Example: "papercrypt transcription-template --encoding base32 --lines 30 -o template.pdf",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		encoding := core.PaperCryptDataEncodingFromString(transcriptionEncoding)
+		switch encoding {
+		case core.PaperCryptDataEncodingUnknown:
+			return fmt.Errorf("unknown data encoding '%s', must be one of: base16, base32, base64", transcriptionEncoding)
+		case core.PaperCryptDataEncodingArmor, core.PaperCryptDataEncodingWords:
+			return fmt.Errorf("the %s encoding can not be laid out in a grid, use base16, base32, or base64", encoding)
+		}
+
+		paper := core.PaperSizeFromString(transcriptionPaperSize)
+		if paper == core.PaperSizeUnknown {
+			return fmt.Errorf("unknown paper size '%s', must be one of: a4, letter, a5, legal", transcriptionPaperSize)
+		}
+
+		checksum := core.LineChecksumFromString(transcriptionLineChecksum)
+		if checksum == core.LineChecksumUnknown {
+			return fmt.Errorf("unknown line checksum '%s', must be one of: crc24, crc32, sha256", transcriptionLineChecksum)
+		}
+
+		if transcriptionLines < 0 {
+			return fmt.Errorf("invalid number of lines %d, must not be negative", transcriptionLines)
+		}
+
+		language, err := internal.LoadLanguage(transcriptionLang)
+		if err != nil {
+			return err
+		}
+
+		opts := internal.TextOptions{
+			Encoding: encoding,
+			Layout: core.DataLayout{
+				GroupSize:     transcriptionGroupSize,
+				Columns:       transcriptionColumns,
+				BlockLines:    transcriptionBlockLines,
+				LineIndices:   !transcriptionNoLineIndices,
+				ColumnIndices: transcriptionColumnIndices,
+			},
+			LineChecksum: checksum,
+			Page:         core.Page{Paper: paper, Landscape: transcriptionLandscape},
+			Language:     language,
+		}
+		if !cmd.Flags().Lookup("columns").Changed {
+			opts.Layout.Columns = internal.TranscriptionColumns(opts)
+		}
+		if err := opts.Layout.Validate(); err != nil {
+			return errors.Join(errors.New("invalid data layout"), err)
+		}
+
+		command := transcriptionGenerateCommand(opts)
+		data, err := internal.GenerateTranscriptionTemplatePDF(transcriptionLines, command, opts)
+		if err != nil {
+			return errors.Join(errors.New("error generating transcription template"), err)
+		}
+
+		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
+			if err != nil {
+				log.WithError(err).Error("Error closing file")
+			}
+		}(outFile)
+
+		n, err := outFile.Write(data)
+		if err != nil {
+			return errors.Join(errors.New("error writing to file"), err)
+		}
+
+		log.WithField("command", command).Info("Generate the document to copy using the options of the template")
+		internal.PrintWrittenSize(n, outFile)
+		return nil
+	},
+}
+
+// transcriptionGenerateCommand returns the generate command writing documents that match the template,
+// the input and output files are left to the user.
+func transcriptionGenerateCommand(opts internal.TextOptions) string {
+	args := []string{"papercrypt", "generate"}
+	if opts.Encoding != core.PaperCryptDataEncodingBase16 {
+		args = append(args, "--encoding", strings.ToLower(opts.Encoding.String()))
+	}
+
+	layout := opts.DataLayout()
+	if opts.Encoding == core.PaperCryptDataEncodingBase16 && layout.GroupSize != core.DefaultDataLayout.GroupSize {
+		args = append(args, "--group", fmt.Sprint(layout.GroupSize))
+	}
+	// the number of columns is always given, as generate fits it to the page otherwise
+	args = append(args, "--columns", fmt.Sprint(layout.Columns))
+	if layout.BlockLines > 0 {
+		args = append(args, "--block-lines", fmt.Sprint(layout.BlockLines))
+	}
+	if !layout.LineIndices {
+		args = append(args, "--no-line-indices")
+	}
+	if layout.ColumnIndices {
+		args = append(args, "--column-indices")
+	}
+	if opts.LineChecksum != core.LineChecksumCRC24 {
+		args = append(args, "--line-checksum", strings.ToLower(strings.ReplaceAll(opts.LineChecksum.String(), "-", "")))
+	}
+
+	return strings.Join(args, " ")
+}
+
+func init() {
+	rootCmd.AddCommand(transcriptionTemplateCmd)
+
+	transcriptionTemplateCmd.Flags().IntVar(&transcriptionLines, "lines", 0, "Number of lines of the grid, at least one more than the data lines of the document, whose checksum takes a line of its own (default: fill the first page)")
+	transcriptionTemplateCmd.Flags().StringVar(&transcriptionEncoding, "encoding", "base16", "Encoding of the data to copy, either 'base16' (hexadecimal), 'base32' (Crockford's alphabet), or 'base64'")
+	transcriptionTemplateCmd.Flags().IntVar(&transcriptionGroupSize, "group", core.DefaultDataLayout.GroupSize, "Number of bytes written together, before a space (base16 only)")
+	transcriptionTemplateCmd.Flags().IntVar(&transcriptionColumns, "columns", 0, "Number of groups per line (default: as many as fit the width of the page)")
+	transcriptionTemplateCmd.Flags().IntVar(&transcriptionBlockLines, "block-lines", core.DefaultDataLayout.BlockLines, "Leave space after this many lines (0 to disable)")
+	transcriptionTemplateCmd.Flags().BoolVar(&transcriptionNoLineIndices, "no-line-indices", false, "Do not print line numbers")
+	transcriptionTemplateCmd.Flags().BoolVar(&transcriptionColumnIndices, "column-indices", false, "Print column numbers above each block")
+	transcriptionTemplateCmd.Flags().StringVar(&transcriptionLineChecksum, "line-checksum", "crc24", "Checksum of each line of the data block, either 'crc24', 'crc32', or 'sha256'")
+	transcriptionTemplateCmd.Flags().StringVar(&transcriptionPaperSize, "paper", "a4", "Paper size of the template, either 'a4', 'letter', 'a5', or 'legal'")
+	transcriptionTemplateCmd.Flags().BoolVar(&transcriptionLandscape, "landscape", false, "Print the template in landscape orientation, with longer lines")
+	transcriptionTemplateCmd.Flags().StringVar(&transcriptionLang, "lang", internal.DefaultLanguage, fmt.Sprintf("Language of the text printed on the template, one of: %s", strings.Join(internal.Languages(), ", ")))
+
+	_ = transcriptionTemplateCmd.RegisterFlagCompletionFunc("encoding", completeValues(transcriptionValues...))
+	_ = transcriptionTemplateCmd.RegisterFlagCompletionFunc("line-checksum", completeValues(lineChecksumValues...))
+	_ = transcriptionTemplateCmd.RegisterFlagCompletionFunc("paper", completePaperSizes)
+	_ = transcriptionTemplateCmd.RegisterFlagCompletionFunc("lang", completeLanguages)
+}
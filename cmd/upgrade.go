@@ -0,0 +1,285 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	upgradeReencrypt     bool
+	upgradeNewPassphrase string
+	upgradeNoQR          bool
+	upgradePaperSize     string
+	upgradeLandscape     bool
+	upgradeLang          string
+	upgradeReviewBy      string
+	upgradeFormatVersion int
+)
+
+var upgradeCmd = &cobra.Command{
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "upgrade [<input>]",
+	Short:             "Upgrade a document to the current format, such as a PaperCrypt V1 document",
+	Long: `This command reads a document, such as the text of a PaperCrypt V1 document, and generates a new PDF document
+in the current format, holding the same content, serial number, purpose, comment, and date.
+The document is read like 'restore' does, so scans of the old document work, too.
+
+By default, the encrypted data is re-wrapped as it is, and no passphrase is needed.
+With --reencrypt, the data is decrypted, and encrypted again using the current settings (cipher and key derivation),
+asking for the current passphrase, and the new one, which may be the same.
+
+With --format-version 3, the header of the new document is authenticated by a MAC keyed by the passphrase,
+which is asked for, and checked by decrypting the data, unless the header MAC of the document still applies.
+Documents of format version 3 keep their version, unless --format-version 2 is given.
+
+Check the new document using 'papercrypt verify' before discarding the old one.
+The checksums of a V1 document cover the data before compression, so they differ from those of the new document.`,
+	Example: `papercrypt upgrade old.txt -o new.pdf
+papercrypt upgrade old.txt -o new.pdf --reencrypt`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := reprintOptions(upgradePaperSize, upgradeLandscape, upgradeLang)
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Lookup("new-passphrase").Changed && !upgradeReencrypt {
+			return errors.New("--new-passphrase requires --reencrypt")
+		}
+		var version core.PaperCryptContainerVersion
+		if cmd.Flags().Lookup("format-version").Changed {
+			if version, err = parseFormatVersionFlag(upgradeFormatVersion); err != nil {
+				return err
+			}
+		}
+
+		// 1. Open output file
+		outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := internal.CloseFileIfNotStd(file)
+			if err != nil {
+				log.WithError(err).Error("Error closing file")
+			}
+		}(outFile)
+
+		// 2. Read the document
+		pc, err := readRestoreInputs(args)
+		if err != nil {
+			return err
+		}
+		log.WithField("from", pc.Version).WithField("to", core.VersionInfo.GitVersion).Info("Upgrading document")
+
+		if version == core.PaperCryptContainerVersionUnknown {
+			version = max(pc.FormatVersion, core.PaperCryptContainerVersionMajor2)
+		}
+		if version == core.PaperCryptContainerVersionMajor3 && pc.DataFormat != core.PaperCryptDataFormatPGP {
+			return fmt.Errorf("the data of the document is not encrypted by PaperCrypt (format %s), its header can not be authenticated", pc.DataFormat)
+		}
+		if version < pc.FormatVersion {
+			log.Warn(core.Warning(fmt.Sprintf("The document is written in format version %d, its header is no longer authenticated.", version)))
+		}
+
+		// 3. Re-wrap the data, or re-encrypt it
+		data := pc.Data
+		var newPassphrase []byte
+		if upgradeReencrypt {
+			data, newPassphrase, err = reencryptDocument(cmd, pc, upgradeNewPassphrase)
+			if err != nil {
+				return err
+			}
+		}
+
+		upgraded := core.NewPaperCrypt(core.VersionInfo.GitVersion, data, pc.SerialNumber, pc.Purpose, pc.Comment, pc.CreatedAt, pc.DataFormat)
+		// the plaintext is unchanged, and verified if re-encrypted, so its checksum is kept
+		upgraded.PlaintextSHA256 = pc.PlaintextSHA256
+		upgraded.ExpiresAt = pc.ExpiresAt
+		upgraded.ReviewBy = pc.ReviewBy
+		// re-encrypted data is compressed by PaperCrypt
+		upgraded.ExternalMessage = pc.ExternalMessage && !upgradeReencrypt
+		if pc.PrivateMetadata {
+			upgraded.Purpose, upgraded.Comment = "", ""
+			upgraded.PrivateMetadata = true
+		}
+		if upgradeReviewBy != "" {
+			// the new sheet is the one to be reviewed, the period starts today
+			upgraded.ReviewBy, err = parseDueDateFlag("review-by", upgradeReviewBy, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+		if version == core.PaperCryptContainerVersionMajor3 {
+			if err := authenticateUpgraded(cmd, pc, upgraded, newPassphrase); err != nil {
+				return err
+			}
+		}
+
+		// 4. Render the new document
+		doc, err := internal.GetPDF(upgraded, upgradeNoQR, opts)
+		if err != nil {
+			return errors.Join(errors.New("error rendering the document"), err)
+		}
+
+		n, err := outFile.Write(doc)
+		if err != nil {
+			return errors.Join(errors.New("error writing to file"), err)
+		}
+
+		internal.PrintWrittenSize(n, outFile)
+		return nil
+	},
+}
+
+// reprintOptions returns the options of a document printed again, by 'upgrade', or 'reencrypt',
+// on the given paper size, and in the given language, in the default layout.
+func reprintOptions(paperSize string, landscape bool, lang string) (internal.TextOptions, error) {
+	paper := core.PaperSizeFromString(paperSize)
+	if paper == core.PaperSizeUnknown {
+		return internal.TextOptions{}, fmt.Errorf("unknown paper size '%s', must be one of: a4, letter, a5, legal", paperSize)
+	}
+	page := core.Page{Paper: paper, Landscape: landscape}
+
+	language, err := internal.LoadLanguage(lang)
+	if err != nil {
+		return internal.TextOptions{}, err
+	}
+
+	return internal.TextOptions{
+		Layout: page.FitDataLayout(core.DataLayout{
+			GroupSize:   core.DefaultDataLayout.GroupSize,
+			Columns:     core.BytesPerLine / core.DefaultDataLayout.GroupSize,
+			BlockLines:  core.DefaultDataLayout.BlockLines,
+			LineIndices: true,
+		}),
+		Code2D: core.Code2DOptions{
+			DPI:       core.Code2DDefaultDPI,
+			PrintArea: page.Code2DPrintSize(),
+		},
+		Page:     page,
+		Language: language,
+	}, nil
+}
+
+// authenticateUpgraded adds a header MAC to the upgraded document, keyed by newPassphrase, if the data is re-encrypted.
+// Otherwise, the header MAC of the document is kept, if the authenticated header is unchanged,
+// or the current passphrase is read, and checked by decrypting the document, to key the new one.
+func authenticateUpgraded(cmd *cobra.Command, pc *core.PaperCrypt, upgraded *core.PaperCrypt, newPassphrase []byte) error {
+	if newPassphrase != nil {
+		return upgraded.Authenticate(newPassphrase)
+	}
+	if pc.HeaderMAC != nil && upgradeReviewBy == "" {
+		upgraded.FormatVersion, upgraded.HeaderMAC = pc.FormatVersion, pc.HeaderMAC
+		return nil
+	}
+
+	passphraseBytes, err := readDecryptionPassphrase(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := pc.Decode(passphraseBytes); err != nil {
+		return errors.Join(errors.New("error decrypting data"), err)
+	}
+
+	return upgraded.Authenticate(passphraseBytes)
+}
+
+// reencryptDocument decrypts the data of a document, and encrypts it again using the current settings,
+// returning the new data of the document, and the new passphrase, given with --new-passphrase (newPassphraseFlag),
+// or prompted for. The decrypted data is only held in memory, and cleared once encrypted again.
+func reencryptDocument(cmd *cobra.Command, pc *core.PaperCrypt, newPassphraseFlag string) ([]byte, []byte, error) {
+	if pc.DataFormat != core.PaperCryptDataFormatPGP {
+		return nil, nil, fmt.Errorf("the data of the document is not encrypted by PaperCrypt (format %s), it can not be re-encrypted", pc.DataFormat)
+	}
+
+	passphraseBytes, err := readDecryptionPassphrase(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	decoded, err := pc.Decode(passphraseBytes)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("error decrypting data"), err)
+	}
+	if err := verifyDecoded(pc, decoded); err != nil {
+		return nil, nil, err
+	}
+
+	var newPassphrase []byte
+	if cmd.Flags().Lookup("new-passphrase").Changed {
+		newPassphrase = []byte(newPassphraseFlag)
+	} else {
+		newPassphrase, err = promptNewPassphrase()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	defer clear(decoded)
+
+	if pc.PrivateMetadata {
+		// the purpose and comment were revealed by decrypting the data, and are encrypted again along with it
+		wrapped, err := core.WrapPrivateMetadata(pc.Purpose, pc.Comment, decoded)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer clear(wrapped)
+		decoded = wrapped
+	}
+
+	data, err := core.CompressAndEncrypt(newPassphrase, decoded, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, newPassphrase, nil
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+
+	upgradeCmd.Flags().BoolVar(&upgradeReencrypt, "reencrypt", false, "Decrypt the data, and encrypt it again using the current settings, asking for the current and the new passphrase")
+	upgradeCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Current passphrase of the document, for --reencrypt (not recommended, will be prompted for if not provided)")
+	addPassphraseSourceFlags(upgradeCmd)
+	upgradeCmd.Flags().StringVar(&upgradeNewPassphrase, "new-passphrase", "", "New passphrase, for --reencrypt (not recommended, will be prompted for if not provided)")
+	upgradeCmd.Flags().StringVar(&upgradeReviewBy, "review-by", "", "New date by which the sheet should be printed again, and verified, such as 2030-01-31, or a period after today, such as 5y (default: keep the date of the document)")
+	upgradeCmd.Flags().IntVar(&upgradeFormatVersion, "format-version", 0, "Container format version of the new document, either 2, or 3 (authenticates the header by a MAC keyed by the passphrase) (default: that of the document, at least 2)")
+	upgradeCmd.Flags().BoolVar(&upgradeNoQR, "no-qr", false, "Do not generate 2D code (optional)")
+	upgradeCmd.Flags().StringVar(&upgradePaperSize, "paper", "a4", "Paper size of the PDF document, either 'a4', 'letter', 'a5', or 'legal'")
+	upgradeCmd.Flags().BoolVar(&upgradeLandscape, "landscape", false, "Print the PDF document in landscape orientation")
+	upgradeCmd.Flags().StringVar(&upgradeLang, "lang", internal.DefaultLanguage, fmt.Sprintf("Language of the text printed on the document, one of: %s", strings.Join(internal.Languages(), ", ")))
+	upgradeCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+	addScanJobsFlag(upgradeCmd)
+	addStrictFlag(upgradeCmd)
+
+	_ = upgradeCmd.RegisterFlagCompletionFunc("paper", completePaperSizes)
+	_ = upgradeCmd.RegisterFlagCompletionFunc("lang", completeLanguages)
+}
@@ -0,0 +1,87 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// loadFonts loads the fonts embedded by the main package, to render PDF documents.
+func loadFonts(t *testing.T) {
+	t.Helper()
+
+	if err := internal.LoadFontFiles("../font"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	loadFonts(t)
+	// the version is set by the main package, documents of unknown versions are not read back
+	core.VersionInfo.GitVersion = "2.0.0"
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "v1.txt")
+	if err := os.WriteFile(inPath, []byte(docV1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, args := range map[string][]string{
+		"rewrap":       {"-P", "example"},
+		"reencrypt":    {"--reencrypt", "-P", "example", "--new-passphrase", "new"},
+		"authenticate": {"--format-version", "3", "-P", "example"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			upgradedPath := filepath.Join(t.TempDir(), "upgraded.pdf")
+			cmd := rootCmd
+			cmd.SetArgs(append([]string{"upgrade", inPath, "-o", upgradedPath}, args...))
+			defer func() {
+				upgradeReencrypt = false
+				upgradeCmd.Flags().Lookup("new-passphrase").Changed = false
+				upgradeCmd.Flags().Lookup("format-version").Changed = false
+			}()
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			// restoring reads the document attached to the PDF
+			passphrase := args[len(args)-1]
+			outPath := filepath.Join(t.TempDir(), "output.json")
+			cmd.SetArgs([]string{"restore", upgradedPath, "-o", outPath, "-P", passphrase})
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != input {
+				t.Fatalf("Expected %s, got %s", input, string(out))
+			}
+		})
+	}
+}
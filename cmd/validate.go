@@ -0,0 +1,134 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var validateSchema bool
+
+var validateCmd = &cobra.Command{
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeFiles("json", "pdf"),
+	SilenceUsage:      true,
+	Use:               "validate [<file>]",
+	Short:             "Check that a document in JSON follows the published schema, and matches its checksums",
+	Long: `This command checks a document in its JSON serialization, as held by the 2D code (its JSON payload),
+and attached to the PDF, against the JSON Schema of PaperCrypt documents, of any version,
+and its checksums (CRC-24, CRC-32, and SHA-256) against its data.
+Use it to confirm that documents written by other programs are read by PaperCrypt.
+
+The document is read from the file given, or the standard input. The attachment of a PDF is validated,
+and CBOR payloads are converted to JSON first. No passphrase is needed, the document is not decrypted,
+so the header MAC of documents of format version 3 is left to 'papercrypt decode'.
+
+With --schema, the JSON Schema is written instead, to validate documents using other tools.`,
+	Example: `papercrypt validate document.json
+papercrypt validate --schema -o papercrypt.schema.json`,
+	RunE: func(_ *cobra.Command, args []string) error {
+		if validateSchema {
+			return writeSchema()
+		}
+
+		path := inFileName
+		if len(args) == 1 {
+			path = args[0]
+		}
+		data, err := internal.PrintInputAndRead(path)
+		if err != nil {
+			return err
+		}
+		if internal.IsPDF(data) {
+			payload, ok, err := internal.ExtractPDFAttachment(data)
+			if err != nil {
+				return errors.Join(errors.New("error reading the PDF attachment"), err)
+			}
+			if !ok {
+				return errors.New("the PDF has no document attached, validate the payload of its 2D code instead")
+			}
+			data = payload
+		}
+		data, err = payloadJSON(data)
+		if err != nil {
+			return errors.Join(errors.New("error converting the CBOR payload to JSON"), err)
+		}
+
+		version, problems := core.ValidateContainerJSON(data)
+		checksumMismatch := false
+		for _, problem := range problems {
+			entry := log.WithField("problem", problem.Message)
+			if problem.Field != "" {
+				entry = entry.WithField("field", problem.Field)
+			}
+			entry.Error(core.Warning("Invalid document"))
+			checksumMismatch = checksumMismatch || problem.Checksum
+		}
+		if len(problems) > 0 {
+			err := fmt.Errorf("the document is not valid, %d problems found", len(problems))
+			if checksumMismatch {
+				err = core.WithCategory(core.ErrorCategoryChecksum, err)
+			}
+			return err
+		}
+
+		if version == core.PaperCryptContainerVersionMajor3 {
+			log.Info("The header MAC is keyed by the passphrase, 'papercrypt decode' checks it.")
+		}
+		log.WithField("version", version).Info(core.Bold("The document is valid."))
+		return nil
+	},
+}
+
+// writeSchema writes the JSON Schema of documents to the output file, see --schema.
+func writeSchema() error {
+	outFile, err := internal.GetFileHandleCarefully(outFileName, overrideOutFile)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := internal.CloseFileIfNotStd(file)
+		if err != nil {
+			log.WithError(err).Error("Error closing file")
+		}
+	}(outFile)
+
+	n, err := outFile.Write(core.ContainerSchema)
+	if err != nil {
+		return errors.Join(errors.New("error writing to file"), err)
+	}
+
+	internal.PrintWrittenSize(n, outFile)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().BoolVar(&validateSchema, "schema", false, "Write the JSON Schema of PaperCrypt documents, of all versions, instead of validating a document")
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestValidate(t *testing.T) {
+	defer resetFlags(validateCmd)
+
+	pc, err := core.DeserializeText([]byte(doc), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := json.Marshal(pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	validPath := filepath.Join(tempDir, "valid.json")
+	if err := os.WriteFile(validPath, document, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"validate", validPath})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the CRC-32 of the data is changed
+	pc.DataCRC32++
+	invalid, err := json.Marshal(pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidPath := filepath.Join(tempDir, "invalid.json")
+	if err := os.WriteFile(invalidPath, invalid, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"validate", invalidPath})
+	err = rootCmd.Execute()
+	if core.CategoryOf(err) != core.ErrorCategoryChecksum {
+		t.Fatalf("Expected a checksum mismatch, got %v", err)
+	}
+
+	schemaPath := filepath.Join(tempDir, "papercrypt.schema.json")
+	rootCmd.SetArgs([]string{"validate", "--schema", "-o", schemaPath})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := os.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(schema, core.ContainerSchema) {
+		t.Fatal("Expected the embedded schema to be written")
+	}
+}
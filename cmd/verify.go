@@ -0,0 +1,192 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+var (
+	verifyOriginalPath string
+	verifySHA256       string
+	verifyExternalGPG  bool
+	verifyGPGPath      string
+)
+
+var verifyCmd = &cobra.Command{
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeInFile,
+	SilenceUsage:      true,
+	Use:               "verify [<input>...]",
+	Short:             "Check that a document restores the original data, before deleting it",
+	Long: `This command checks that a document can be restored, before the digital copy of the data is deleted.
+
+The document is read like 'restore' does (from the PDF, its text, scans of its 2D code, or the payload of the code),
+decrypted using the passphrase, and the result is compared to the original file given with --original,
+or to its SHA-256 checksum given with --sha256 (as printed by sha256sum). Without either,
+the checksum of the decrypted data printed on the document is used, if it was generated with --plaintext-hash.
+Nothing is written, the command fails if the data restored differs from the original.
+
+With --external-gpg, the document is also decrypted by an installed gpg program (GnuPG), rather than only by
+the OpenPGP implementation PaperCrypt is built on, proving that it can be restored using standard tools alone.
+gpg runs in a temporary home directory, neither your keyring, nor its passphrase cache, are used.`,
+	Example: `papercrypt verify document.pdf --original secrets.json
+papercrypt verify scan.png --sha256 "$(sha256sum secrets.json | cut -d ' ' -f 1)"
+papercrypt verify document.pdf --original secrets.json --external-gpg`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// 1. Determine the expected checksum
+		var original []byte
+		var want []byte
+		switch {
+		case verifyOriginalPath != "":
+			var err error
+			original, err = os.ReadFile(verifyOriginalPath)
+			if err != nil {
+				return errors.Join(errors.New("error reading original file"), err)
+			}
+			sum := sha256.Sum256(original)
+			want = sum[:]
+		case verifySHA256 != "":
+			var err error
+			want, err = core.ParseSHA256(verifySHA256)
+			if err != nil {
+				return err
+			}
+		}
+
+		var gpg *internal.GnuPG
+		if verifyExternalGPG {
+			var err error
+			gpg, err = internal.NewGnuPG(verifyGPGPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		// 2. Read the document
+		pc, err := readRestoreInputs(args)
+		if err != nil {
+			return err
+		}
+		if want == nil {
+			if len(pc.PlaintextSHA256) == 0 {
+				return errors.New("the document holds no checksum of the decrypted data, use --original or --sha256 to compare against")
+			}
+
+			log.Info("Comparing against the checksum of the decrypted data printed on the document.")
+			want = pc.PlaintextSHA256
+		}
+
+		// 3. Decrypt
+		passphraseBytes, err := readDecryptionPassphrase(cmd)
+		if err != nil {
+			return err
+		}
+
+		decoded, err := pc.Decode(passphraseBytes)
+		if err != nil {
+			return errors.Join(errors.New("error decrypting data"), err)
+		}
+		if err := pc.VerifyPlaintext(decoded); err != nil {
+			return errors.Join(errors.New("the decrypted data does not match the checksum printed on the document"), err)
+		}
+		if pc.HeaderMAC != nil {
+			log.Info("Header MAC verified.")
+		}
+
+		// 4. Compare
+		got := sha256.Sum256(decoded)
+		if !bytes.Equal(got[:], want) {
+			err := core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("SHA-256 mismatch: expected %s, got %s", core.FormatSHA256(want), core.FormatSHA256(got[:])))
+			if original != nil {
+				err = errors.Join(err, fmt.Errorf("the original holds %d bytes, the document restores %d bytes", len(original), len(decoded)))
+			}
+
+			return errors.Join(errors.New("the document does not restore the original data, keep the digital copy"), err)
+		}
+
+		log.WithField("size", fmt.Sprintf("%d bytes", len(decoded))).
+			WithField("sha256", core.FormatSHA256(got[:])).
+			Info(core.Bold("Verified: the document restores the original data."))
+
+		// 5. Decrypt using GnuPG
+		if gpg != nil {
+			return verifyWithGnuPG(gpg, pc, passphraseBytes, want)
+		}
+
+		return nil
+	},
+}
+
+// verifyWithGnuPG decrypts the document using gpg, rather than gopenpgp, and compares the result to the expected checksum.
+// Only the decryption is left to gpg, decompressing the data (gzip) is the same as before,
+// and the header MAC is checked, as gpg knows nothing of it.
+func verifyWithGnuPG(gpg *internal.GnuPG, pc *core.PaperCrypt, passphrase []byte, want []byte) error {
+	if pc.DataFormat != core.PaperCryptDataFormatPGP {
+		return errors.New("the document is not encrypted, there is nothing for gpg to decrypt")
+	}
+	if err := pc.VerifyHeaderMAC(passphrase); err != nil {
+		return err
+	}
+
+	decoded, err := pc.DecodeWith(func(message []byte) ([]byte, error) {
+		return gpg.DecryptSymmetric(message, passphrase)
+	})
+	if err != nil {
+		return errors.Join(errors.New("gpg could not restore the document"), err)
+	}
+
+	got := sha256.Sum256(decoded)
+	if !bytes.Equal(got[:], want) {
+		return core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("gpg restores different data: SHA-256 mismatch: expected %s, got %s", core.FormatSHA256(want), core.FormatSHA256(got[:])))
+	}
+
+	version, err := gpg.Version()
+	if err != nil {
+		version = gpg.Path
+	}
+	log.WithField("gpg", version).Info(core.Bold("Verified: GnuPG restores the original data as well."))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVar(&verifyOriginalPath, "original", "", "Original file the document was generated from, to compare the restored data to")
+	verifyCmd.Flags().StringVar(&verifySHA256, "sha256", "", "SHA-256 checksum of the original data (hexadecimal), to compare the restored data to")
+	verifyCmd.MarkFlagsMutuallyExclusive("original", "sha256")
+	verifyCmd.Flags().BoolVar(&verifyExternalGPG, "external-gpg", false, "Also decrypt the document using an installed gpg program (GnuPG), to prove it can be restored using standard tools")
+	verifyCmd.Flags().StringVar(&verifyGPGPath, "gpg", "gpg", "Path of the gpg program, used by --external-gpg")
+	verifyCmd.Flags().StringVarP(&passphrase, "passphrase", "P", "", "Passphrase to use for decryption (not recommended, will be prompted for if not provided)")
+	addPassphraseSourceFlags(verifyCmd)
+	verifyCmd.Flags().BoolVar(&qrCmdNoPreprocess, "no-preprocess", false, "Do not preprocess images in which no 2D code is found (contrast stretch, adaptive threshold, deskew, perspective correction, rescaling)")
+	addScanJobsFlag(verifyCmd)
+	addStrictFlag(verifyCmd)
+}
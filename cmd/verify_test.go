@@ -0,0 +1,112 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestVerify(t *testing.T) {
+	tempDir := t.TempDir()
+	docPath := filepath.Join(tempDir, "document.txt")
+	if err := os.WriteFile(docPath, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	originalPath := filepath.Join(tempDir, "original.json")
+	if err := os.WriteFile(originalPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	otherPath := filepath.Join(tempDir, "other.json")
+	if err := os.WriteFile(otherPath, []byte("something else"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(input))
+
+	t.Cleanup(func() { verifyOriginalPath, verifySHA256, verifyExternalGPG = "", "", false })
+	_, gpgErr := exec.LookPath("gpg")
+
+	for name, tc := range map[string]struct {
+		args      []string
+		wantError bool
+	}{
+		"original":          {args: []string{"--original", originalPath}},
+		"sha256":            {args: []string{"--sha256", hex.EncodeToString(sum[:])}},
+		"different":         {args: []string{"--original", otherPath}, wantError: true},
+		"no plaintext hash": {wantError: true},
+		"external gpg":      {args: []string{"--original", originalPath, "--external-gpg"}, wantError: gpgErr != nil},
+		"missing gpg":       {args: []string{"--original", originalPath, "--external-gpg", "--gpg", filepath.Join(tempDir, "gpg")}, wantError: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// flags keep their state between executions of the command
+			verifyOriginalPath, verifySHA256, verifyExternalGPG, verifyGPGPath = "", "", false, "gpg"
+			verifyCmd.Flags().Lookup("original").Changed = false
+			verifyCmd.Flags().Lookup("sha256").Changed = false
+
+			cmd := rootCmd
+			cmd.SetArgs(append([]string{"verify", docPath, "-P", "example"}, tc.args...))
+			err := cmd.Execute()
+			if tc.wantError && err == nil {
+				t.Fatal("Expected verification to fail")
+			}
+			if !tc.wantError && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestVerifyWithGnuPGHeaderMAC(t *testing.T) {
+	gpg, err := internal.NewGnuPG("gpg")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	passphrase := []byte("example")
+	data, err := core.CompressAndEncrypt(passphrase, []byte(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := core.NewPaperCrypt("2.0.0", data, "ABC123", "Purpose", "Comment", time.Now(), core.PaperCryptDataFormatPGP)
+	if err := pc.Authenticate(passphrase); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte(input))
+
+	if err := verifyWithGnuPG(gpg, pc, passphrase, want[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	// gpg decrypts the data all the same, the changed header is only found by its MAC
+	pc.Purpose = "Changed"
+	if err := verifyWithGnuPG(gpg, pc, passphrase, want[:]); !errors.Is(err, core.ErrHeaderMAC) {
+		t.Fatalf("got: %v, want: %v.", err, core.ErrHeaderMAC)
+	}
+}
@@ -24,7 +24,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
-	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 var versionCmd = &cobra.Command{
@@ -37,7 +37,7 @@ var versionCmd = &cobra.Command{
 		// Present to override the default behavior of the root command
 	},
 	Run: func(_ *cobra.Command, _ []string) {
-		fmt.Println(internal.VersionInfo.String())
+		fmt.Println(core.VersionInfo.String())
 	},
 }
 
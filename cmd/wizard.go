@@ -0,0 +1,724 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+	"golang.org/x/term"
+)
+
+// wizardKeyPhraseBits is the entropy of the key phrase generated by the wizard.
+const wizardKeyPhraseBits = 128
+
+var wizardLPPath string
+
+var wizardCmd = &cobra.Command{
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Use:          "wizard",
+	Short:        "Guides you through protecting data on paper, or restoring it, step by step",
+	Long: `Guides you through protecting data on paper, or restoring it, step by step, on a full-screen terminal interface.
+
+To protect data, it asks for the file to protect, generates a key phrase (or lets you choose a passphrase),
+and lets you pick the paper, the 2D code, and the encoding of the data, before previewing the sheet,
+writing it, and sending it to the printer (using lp of CUPS on Linux and macOS).
+
+To restore data, it asks where the document comes from: its text or digital PDF, a photo or scan of its 2D code,
+scans of its printed text, or typing it in, and for the passphrase, before decoding it.
+
+Before writing anything, the equivalent command is shown, so the wizard can be left behind for scripts.`,
+	Example: "papercrypt wizard",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if err := internal.RequireInteraction("the choices of the wizard"); err != nil {
+			return err
+		}
+
+		// printing is offered if a printer is available
+		printer, err := internal.NewPrinter(runtime.GOOS, wizardLPPath)
+		if err != nil {
+			log.WithError(err).Debug("Printing is not available")
+			printer = nil
+		}
+
+		w := newWizard(printer != nil)
+		if err := runWizard(w); err != nil {
+			return err
+		}
+
+		switch w.answers["mode"] {
+		case "generate":
+			if err := runWizardCommand(generateCmd, wizardGenerateArgs(w.answers), w.answers["passphrase"]); err != nil {
+				return err
+			}
+			if w.answers["print"] == "print" {
+				if err := printer.Print(w.answers["out"]); err != nil {
+					return err
+				}
+				log.WithField("path", w.answers["out"]).Info("Sent the sheet to the printer.")
+			}
+
+			return nil
+		default:
+			return runWizardRestore(w.answers)
+		}
+	},
+}
+
+// wizardOption is a choice offered by a step of the wizard.
+type wizardOption struct {
+	value       string
+	label       string
+	description string
+}
+
+// wizardStep is a question of the wizard: a choice among its options, or, without options, a text to type in.
+type wizardStep struct {
+	name  string
+	title string
+
+	// body explains the question, given the answers so far, it may be nil.
+	body func(answers map[string]string) string
+
+	options []wizardOption
+
+	// masked hides the text typed in, for passphrases.
+	masked bool
+
+	// fallback is the answer, if no text is typed in.
+	fallback string
+
+	// when returns whether the step applies, given the answers so far, it is nil for steps that always apply.
+	when func(answers map[string]string) bool
+
+	// check validates the answer, and may derive further answers from it, it may be nil.
+	check func(answers map[string]string, value string) error
+}
+
+// wizardHelp lists the keys of the wizard, for choices and for text.
+const (
+	wizardChoiceHelp = "↑/↓ choose · Enter confirm · Shift+Tab back · Ctrl+C abort"
+	wizardTextHelp   = "Enter confirm · Shift+Tab back · Ctrl+C abort"
+)
+
+// wizard is the state of `papercrypt wizard`, the steps it goes through, and the answers given.
+type wizard struct {
+	steps   []wizardStep
+	answers map[string]string
+
+	// at is the current step, history the steps answered before it, to go back to.
+	at      int
+	history []int
+
+	// choice is the option highlighted, input the text typed in, of the current step.
+	choice int
+	input  []rune
+
+	// message is the problem with the last answer, shown until the next key press.
+	message string
+}
+
+func newWizard(canPrint bool) *wizard {
+	w := &wizard{steps: wizardSteps(canPrint), answers: make(map[string]string)}
+	w.enter(0)
+	return w
+}
+
+// step returns the current step.
+func (w *wizard) step() *wizardStep {
+	return &w.steps[w.at]
+}
+
+// enter makes the step current, showing its previous answer, if any.
+func (w *wizard) enter(at int) {
+	w.at = at
+	w.choice, w.input = 0, nil
+	answer, ok := w.answers[w.step().name]
+	if !ok {
+		return
+	}
+	for i, option := range w.step().options {
+		if option.value == answer {
+			w.choice = i
+		}
+	}
+	if len(w.step().options) == 0 && !w.step().masked {
+		w.input = []rune(answer)
+	}
+}
+
+// answer records the answer to the current step, and moves on to the next step that applies.
+// It returns true, once no step is left.
+func (w *wizard) answer(value string) bool {
+	step := w.step()
+	if step.check != nil {
+		if err := step.check(w.answers, value); err != nil {
+			w.message = err.Error()
+			return false
+		}
+	}
+	w.answers[step.name] = value
+
+	for next := w.at + 1; next < len(w.steps); next++ {
+		if when := w.steps[next].when; when == nil || when(w.answers) {
+			w.history = append(w.history, w.at)
+			w.enter(next)
+			return false
+		}
+	}
+
+	return true
+}
+
+// handle applies a key press, it returns true, once all steps are answered.
+func (w *wizard) handle(key entryKey, r rune) (bool, error) {
+	w.message = ""
+	step := w.step()
+
+	switch key {
+	case entryKeyAbort:
+		return false, errors.New("aborted")
+	case entryKeyBackTab:
+		if len(w.history) > 0 {
+			previous := w.history[len(w.history)-1]
+			w.history = w.history[:len(w.history)-1]
+			w.enter(previous)
+		}
+	case entryKeyUp:
+		w.choice = max(0, w.choice-1)
+	case entryKeyDown, entryKeyTab:
+		w.choice = min(len(step.options)-1, w.choice+1)
+	case entryKeyBackspace:
+		if len(w.input) > 0 {
+			w.input = w.input[:len(w.input)-1]
+		}
+	case entryKeyRune:
+		if len(step.options) == 0 {
+			w.input = append(w.input, r)
+		} else if i := int(r - '1'); i >= 0 && i < len(step.options) {
+			w.choice = i
+		}
+	case entryKeyEnter:
+		if len(step.options) > 0 {
+			return w.answer(step.options[w.choice].value), nil
+		}
+
+		value := string(w.input)
+		if value == "" {
+			value = step.fallback
+		}
+		return w.answer(value), nil
+	}
+
+	return false, nil
+}
+
+// render returns the screen, and the position of the cursor on it (counted from 0).
+func (w *wizard) render(width int) (string, int, int) {
+	step := w.step()
+	lines := []string{
+		entryStyleHeading("PaperCrypt") + entryStyleFaint(fmt.Sprintf("  step %d", len(w.history)+1)),
+		"",
+		entryStyleSelected(step.title),
+	}
+	if step.body != nil {
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(step.body(w.answers), "\n")...)
+	}
+	lines = append(lines, "")
+
+	cursorX, cursorY := 0, 0
+	if len(step.options) == 0 {
+		value := string(w.input)
+		if step.masked {
+			value = strings.Repeat("*", len(w.input))
+		}
+		if value == "" && step.fallback != "" {
+			lines = append(lines, "› "+entryStyleFaint(step.fallback))
+		} else {
+			lines = append(lines, "› "+value)
+		}
+		cursorX, cursorY = 2+len([]rune(value)), len(lines)-1
+	}
+	for i, option := range step.options {
+		row := fmt.Sprintf("%d. %s", i+1, option.label)
+		if option.description != "" {
+			row += entryStyleFaint(" — " + option.description)
+		}
+		if i == w.choice {
+			row = entryStyleSelected("› ") + row
+			cursorY = len(lines)
+		} else {
+			row = "  " + row
+		}
+		lines = append(lines, row)
+	}
+
+	lines = append(lines, "")
+	if w.message != "" {
+		lines = append(lines, entryStyleInvalid(truncate(w.message, width)))
+	} else {
+		lines = append(lines, "")
+	}
+	help := wizardChoiceHelp
+	if len(step.options) == 0 {
+		help = wizardTextHelp
+	}
+	lines = append(lines, entryStyleFaint(truncate(help, width)))
+
+	return strings.Join(lines, "\r\n"), cursorX, cursorY
+}
+
+// runWizard goes through the steps of the wizard, on the terminal of stdin and stderr.
+func runWizard(w *wizard) error {
+	in, out := int(os.Stdin.Fd()), int(os.Stderr.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return errors.New("the wizard requires a terminal")
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return errors.Join(errors.New("error switching the terminal to raw mode"), err)
+	}
+	// use the alternate screen, so the terminal is left as it was
+	fmt.Fprint(os.Stderr, "\x1b[?1049h")
+	defer func() {
+		fmt.Fprint(os.Stderr, "\x1b[?1049l")
+		_ = term.Restore(in, state)
+	}()
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		width, _, err := term.GetSize(out)
+		if err != nil || width <= 0 {
+			width = 80
+		}
+
+		screen, x, y := w.render(width)
+		fmt.Fprintf(os.Stderr, "\x1b[H\x1b[2J%s\x1b[%d;%dH", screen, y+1, x+1)
+
+		key, r, err := readEntryKey(reader)
+		if err == io.EOF {
+			key = entryKeyAbort
+		} else if err != nil {
+			return errors.Join(errors.New("error reading from terminal"), err)
+		}
+
+		done, err := w.handle(key, r)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// isMode returns a condition of a step, applying to the given mode.
+func isMode(mode string) func(answers map[string]string) bool {
+	return func(answers map[string]string) bool {
+		return answers["mode"] == mode
+	}
+}
+
+// checkExistingFiles checks that the comma-separated files exist.
+func checkExistingFiles(_ map[string]string, value string) error {
+	if value == "" {
+		return errors.New("enter the path of a file")
+	}
+	for _, path := range strings.Split(value, ",") {
+		info, err := os.Stat(strings.TrimSpace(path))
+		if err != nil {
+			return fmt.Errorf("%s can not be read: %s", path, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory, enter the path of a file", path)
+		}
+	}
+
+	return nil
+}
+
+// checkNewFile checks that nothing is in the way of writing the file, as the wizard does not override files.
+func checkNewFile(_ map[string]string, value string) error {
+	if value == "" {
+		return errors.New("enter the path of the file to write")
+	}
+	if _, err := os.Stat(value); err == nil {
+		return fmt.Errorf("%s already exists, choose another name", value)
+	}
+
+	return nil
+}
+
+// wizardSteps returns the steps of the wizard, for both protecting and restoring data.
+// Printing is offered, if canPrint is set.
+func wizardSteps(canPrint bool) []wizardStep {
+	generating := isMode("generate")
+	restoring := isMode("restore")
+
+	return []wizardStep{
+		{
+			name:  "mode",
+			title: "What would you like to do?",
+			options: []wizardOption{
+				{"generate", "Protect data on paper", "encrypt a file, and print it"},
+				{"restore", "Restore data from paper", "read a printed sheet back, and decrypt it"},
+			},
+		},
+
+		// protecting data
+		{
+			name:  "in",
+			title: "Which file holds the data to protect?",
+			body: func(map[string]string) string {
+				return "Enter its path. Small files, such as keys, recovery codes, or passwords, fit best."
+			},
+			when:  generating,
+			check: checkExistingFiles,
+		},
+		{
+			name:  "key",
+			title: "How should the data be encrypted?",
+			options: []wizardOption{
+				{"generate", "Generate a key phrase", fmt.Sprintf("random words, %d bits strong (recommended)", wizardKeyPhraseBits)},
+				{"enter", "Enter a passphrase of your own", ""},
+			},
+			when: generating,
+			check: func(answers map[string]string, value string) error {
+				if value != "generate" {
+					return nil
+				}
+
+				format := keyPhraseFormats[keyFormatEFF]
+				count, err := format.wordsForBits(wizardKeyPhraseBits)
+				if err != nil {
+					return err
+				}
+				phrase, err := format.generate(count)
+				if err != nil {
+					return errors.Join(errors.New("error generating key phrase"), err)
+				}
+				answers["passphrase"] = strings.Join(phrase, " ")
+				return nil
+			},
+		},
+		{
+			name:  "key-phrase",
+			title: "Write down your key phrase",
+			body: func(answers map[string]string) string {
+				return core.Bold(answers["passphrase"]) + "\n\n" +
+					"Keep it apart from the sheet: without it, the data can not be restored,\n" +
+					"and anyone holding both can read the data. It is not printed on the sheet."
+			},
+			options: []wizardOption{{"written", "I have written it down", ""}},
+			when: func(answers map[string]string) bool {
+				return generating(answers) && answers["key"] == "generate"
+			},
+		},
+		{
+			name:   "passphrase",
+			title:  "Enter the passphrase",
+			masked: true,
+			body: func(answers map[string]string) string {
+				if restoring(answers) {
+					return "The passphrase, or key phrase, the document was encrypted with."
+				}
+				return "Choose a long passphrase, and keep it apart from the sheet."
+			},
+			when: func(answers map[string]string) bool {
+				return restoring(answers) || answers["key"] == "enter"
+			},
+			check: func(answers map[string]string, value string) error {
+				if value == "" {
+					return errors.New("the passphrase can not be empty")
+				}
+				answers["passphrase"] = value
+				return nil
+			},
+		},
+		{
+			name:   "passphrase-again",
+			title:  "Enter the passphrase again",
+			masked: true,
+			when: func(answers map[string]string) bool {
+				return generating(answers) && answers["key"] == "enter"
+			},
+			check: func(answers map[string]string, value string) error {
+				if value != answers["passphrase"] {
+					return errors.New("the passphrases do not match")
+				}
+				return nil
+			},
+		},
+		{
+			name:  "paper",
+			title: "Which paper will you print on?",
+			options: []wizardOption{
+				{"a4", "A4", ""},
+				{"letter", "US Letter", ""},
+				{"a5", "A5", ""},
+				{"legal", "US Legal", ""},
+			},
+			when: generating,
+		},
+		{
+			name:  "code",
+			title: "Which 2D code should be printed?",
+			body: func(map[string]string) string {
+				return "The 2D code restores the data in seconds, from a photo or a scan of the sheet.\n" +
+					"The printed text can always be typed in, if the code is damaged."
+			},
+			options: []wizardOption{
+				{"aztec", "Aztec code", "compact and robust (recommended)"},
+				{"qr", "QR code", "read by most phone apps"},
+				{"none", "No 2D code", "the data is only printed as text"},
+			},
+			when: generating,
+		},
+		{
+			name:  "encoding",
+			title: "How should the data be printed?",
+			options: []wizardOption{
+				{"base16", "Hexadecimal digits", "the default"},
+				{"base32", "Base 32", "shorter to type in, without easily confused letters"},
+				{"words", "Words", "for reading aloud"},
+			},
+			when: generating,
+		},
+		{
+			name:  "purpose",
+			title: "What is the sheet for? (optional)",
+			body: func(map[string]string) string {
+				return "Printed on the sheet, such as \"Recovery codes of my e-mail account\". Leave empty to skip."
+			},
+			when: generating,
+		},
+		{
+			name:     "out",
+			title:    "Where should the sheet be written?",
+			fallback: "papercrypt.pdf",
+			when:     generating,
+			check:    checkNewFile,
+		},
+		{
+			name:    "preview",
+			title:   "Preview",
+			body:    wizardGeneratePreview,
+			options: []wizardOption{{"write", "Write the sheet", ""}},
+			when:    generating,
+		},
+		{
+			name:  "print",
+			title: "Print the sheet now?",
+			options: []wizardOption{
+				{"print", "Print it", "on the default printer"},
+				{"save", "Only save it", "to print it later"},
+			},
+			when: func(answers map[string]string) bool {
+				return generating(answers) && canPrint
+			},
+		},
+
+		// restoring data
+		{
+			name:  "source",
+			title: "What do you have of the document?",
+			options: []wizardOption{
+				{"file", "Its text, or the digital PDF", "a file written by papercrypt"},
+				{"code", "A photo or scan of its 2D code", "an image file"},
+				{"ocr", "Scans of its printed text", "image or PDF files, read using Tesseract OCR"},
+				{"type", "Only the printed sheet", "type it in, line by line"},
+			},
+			when: restoring,
+		},
+		{
+			name:  "restore-in",
+			title: "Which file holds the document?",
+			body: func(answers map[string]string) string {
+				if answers["source"] == "ocr" {
+					return "Enter the paths of the scans, separated by commas, in the order of the pages."
+				}
+				return "Enter its path."
+			},
+			when: func(answers map[string]string) bool {
+				return restoring(answers) && answers["source"] != "type"
+			},
+			check: checkExistingFiles,
+		},
+		{
+			name:  "restore-out",
+			title: "Where should the restored data be written?",
+			when:  restoring,
+			check: checkNewFile,
+		},
+		{
+			name:    "confirm",
+			title:   "Ready to restore",
+			body:    wizardRestorePreview,
+			options: []wizardOption{{"restore", "Restore the data", ""}},
+			when:    restoring,
+		},
+	}
+}
+
+// wizardGenerateArgs returns the flags of the generate command, for the answers given in the wizard.
+// The passphrase is not part of them.
+func wizardGenerateArgs(answers map[string]string) []string {
+	args := []string{"-i", answers["in"], "-o", answers["out"], "--paper", answers["paper"], "--encoding", answers["encoding"]}
+	if answers["code"] == "none" {
+		args = append(args, "--no-qr")
+	} else {
+		args = append(args, "--code-type", answers["code"])
+	}
+	if answers["purpose"] != "" {
+		args = append(args, "--purpose", answers["purpose"])
+	}
+
+	return args
+}
+
+// quoteArgs joins the arguments to a command line, quoting those with spaces.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \"'") {
+			quoted[i] = fmt.Sprintf("%q", arg)
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func wizardGeneratePreview(answers map[string]string) string {
+	key := "the passphrase you entered"
+	if answers["key"] == "generate" {
+		key = "the key phrase you wrote down"
+	}
+	code := map[string]string{"aztec": "Aztec code", "qr": "QR code", "none": "none"}[answers["code"]]
+	size := ""
+	if info, err := os.Stat(answers["in"]); err == nil {
+		size = fmt.Sprintf(" (%d bytes)", info.Size())
+	}
+
+	rows := [][2]string{
+		{"Data", answers["in"] + size},
+		{"Encrypted with", key},
+		{"Paper", core.PaperSizeFromString(answers["paper"]).String()},
+		{"2D code", code},
+		{"Encoding", answers["encoding"]},
+		{"Purpose", answers["purpose"]},
+		{"Written to", answers["out"]},
+	}
+
+	var body strings.Builder
+	for _, row := range rows {
+		if row[1] != "" {
+			fmt.Fprintf(&body, "%-15s %s\n", row[0]+":", row[1])
+		}
+	}
+	body.WriteString("\nThe same sheet is generated without the wizard by:\n")
+	body.WriteString(entryStyleFaint("papercrypt generate " + quoteArgs(wizardGenerateArgs(answers))))
+
+	return body.String()
+}
+
+func wizardRestorePreview(answers map[string]string) string {
+	command := "papercrypt decode " + quoteArgs(wizardDecodeArgs(answers, answers["restore-in"]))
+	if answers["source"] == "code" {
+		command = fmt.Sprintf("papercrypt scan %s | papercrypt decode %s", quoteArgs([]string{answers["restore-in"]}), quoteArgs(wizardDecodeArgs(answers, "")))
+	}
+
+	return fmt.Sprintf("The data is written to %s.\n\nThe same is done without the wizard by:\n%s", answers["restore-out"], entryStyleFaint(command))
+}
+
+// wizardDecodeArgs returns the flags of the decode command, for the answers given in the wizard, reading the document
+// from the given input. The passphrase is not part of them.
+func wizardDecodeArgs(answers map[string]string, input string) []string {
+	args := []string{"-o", answers["restore-out"]}
+	switch answers["source"] {
+	case "ocr":
+		return append(args, "--scan", input)
+	case "type":
+		return append(args, "--interactive")
+	default:
+		if input != "" {
+			args = append(args, "-i", input)
+		}
+		return args
+	}
+}
+
+// runWizardRestore decodes the document as chosen in the wizard,
+// reading its 2D code first, if the document is an image of it.
+func runWizardRestore(answers map[string]string) error {
+	input := answers["restore-in"]
+	if answers["source"] == "code" {
+		dir, err := os.MkdirTemp("", "papercrypt-wizard")
+		if err != nil {
+			return errors.Join(errors.New("error creating temporary directory"), err)
+		}
+		defer os.RemoveAll(dir)
+
+		// the document read from the code is still encrypted
+		document := filepath.Join(dir, "document.txt")
+		if err := runWizardCommand(scanCmd, []string{input, "-o", document}, ""); err != nil {
+			return err
+		}
+		input = document
+	}
+
+	return runWizardCommand(decodeCmd, wizardDecodeArgs(answers, input), answers["passphrase"])
+}
+
+// runWizardCommand runs the command with the flags chosen in the wizard, as if they were typed in,
+// using the passphrase, if not empty, instead of prompting for it.
+func runWizardCommand(cmd *cobra.Command, args []string, passphrase string) error {
+	if err := cmd.ParseFlags(args); err != nil {
+		return err
+	}
+	if passphrase != "" {
+		presetPassphrase = []byte(passphrase)
+		defer func() {
+			presetPassphrase = nil
+		}()
+	}
+
+	return cmd.RunE(cmd, cmd.Flags().Args())
+}
+
+func init() {
+	rootCmd.AddCommand(wizardCmd)
+
+	wizardCmd.Flags().StringVar(&wizardLPPath, "lp", "lp", "Path of the lp program of CUPS, used to print the sheet on Linux and macOS")
+}
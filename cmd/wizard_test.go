@@ -0,0 +1,174 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// resetFlags sets the flags of the command back to their defaults, as other tests may have set them.
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	})
+}
+
+// typeKeys feeds the keys to the wizard, until it is done, or the keys run out.
+func typeKeys(t *testing.T, w *wizard, keys string) bool {
+	t.Helper()
+
+	reader := bufio.NewReader(strings.NewReader(keys))
+	for {
+		key, r, err := readEntryKey(reader)
+		if err != nil {
+			return false
+		}
+		done, err := w.handle(key, r)
+		if err != nil {
+			t.Fatalf("handle failed with error %s", err)
+		}
+		if done {
+			return true
+		}
+	}
+}
+
+func TestWizardSteps(t *testing.T) {
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "secret.txt")
+	if err := os.WriteFile(inPath, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	w := newWizard(false)
+	// a missing file is refused, then the passphrases do not match
+	typeKeys(t, w, "\r"+filepath.Join(tempDir, "missing.txt")+"\r")
+	if w.step().name != "in" || w.message == "" {
+		t.Fatalf("Step was incorrect, got: %s, want: in, with a message.", w.step().name)
+	}
+	typeKeys(t, w, strings.Repeat("\x7f", len(tempDir)+20)+inPath+"\r\x1b[B\rsecret\rsecrat\r")
+	if w.step().name != "passphrase-again" || w.message != "the passphrases do not match" {
+		t.Fatalf("Step was incorrect, got: %s (%s), want: passphrase-again.", w.step().name, w.message)
+	}
+
+	// going back keeps the answers
+	typeKeys(t, w, "\x1b[Z\x1b[Z")
+	if w.step().name != "key" || w.choice != 1 {
+		t.Fatalf("Step was incorrect, got: %s (option %d), want: key (option 1).", w.step().name, w.choice)
+	}
+
+	outPath := filepath.Join(tempDir, "sheet.pdf")
+	if !typeKeys(t, w, "\rsecret\rsecret\r\x1b[B\r\r\x1b[B\rMy secret\r"+outPath+"\r\r") {
+		screen, _, _ := w.render(80)
+		t.Fatalf("The wizard was not done, at:\n%s", screen)
+	}
+
+	got := quoteArgs(wizardGenerateArgs(w.answers))
+	want := "-i " + inPath + " -o " + outPath + ` --paper letter --encoding base32 --code-type aztec --purpose "My secret"`
+	if got != want {
+		t.Errorf("Arguments were incorrect, got: %s, want: %s.", got, want)
+	}
+	if w.answers["passphrase"] != "secret" {
+		t.Errorf("Passphrase was incorrect, got: %s, want: secret.", w.answers["passphrase"])
+	}
+}
+
+func TestWizardKeyPhrase(t *testing.T) {
+	list, err := os.ReadFile("../eff.org_files_2016_07_18_eff_large_wordlist.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordListString := string(list)
+	WordListFile = &wordListString
+
+	w := newWizard(true)
+	w.answers["mode"] = "generate"
+	w.enter(2) // key
+	typeKeys(t, w, "\r")
+	if w.step().name != "key-phrase" {
+		t.Fatalf("Step was incorrect, got: %s, want: key-phrase.", w.step().name)
+	}
+	if words := strings.Fields(w.answers["passphrase"]); len(words) != 10 {
+		t.Errorf("Key phrase was incorrect, got: %d words, want: 10.", len(words))
+	}
+}
+
+func TestWizardRoundTrip(t *testing.T) {
+	loadFonts(t)
+	// the version is set by the main package, documents of unknown versions are not read back
+	core.VersionInfo.GitVersion = "2.0.0"
+	resetFlags(generateCmd)
+	resetFlags(decodeCmd)
+	defer resetFlags(generateCmd)
+	defer resetFlags(decodeCmd)
+
+	tempDir := t.TempDir()
+	inPath := filepath.Join(tempDir, "secret.json")
+	if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := map[string]string{
+		"mode":       "generate",
+		"in":         inPath,
+		"passphrase": "example",
+		"paper":      "a4",
+		"code":       "aztec",
+		"encoding":   "base32",
+		"out":        filepath.Join(tempDir, "sheet.pdf"),
+	}
+	if err := runWizardCommand(generateCmd, wizardGenerateArgs(answers), answers["passphrase"]); err != nil {
+		t.Fatal(err)
+	}
+
+	restorePath := filepath.Join(tempDir, "restored.json")
+	err := runWizardRestore(map[string]string{
+		"mode":        "restore",
+		"source":      "file",
+		"restore-in":  answers["out"],
+		"passphrase":  "example",
+		"restore-out": restorePath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := os.ReadFile(restorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) != input {
+		t.Fatalf("Expected %s, got %s", input, restored)
+	}
+}
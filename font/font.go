@@ -0,0 +1,47 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package font holds the fonts documents are laid out in: Noto Sans for the text, and Inconsolata for the data,
+// both under the SIL Open Font License, see the OFL.txt files.
+package font
+
+import (
+	_ "embed"
+)
+
+// TextRegular, TextBold, and TextItalic are the styles of Noto Sans.
+var (
+	//go:embed "Noto_Sans/NotoSans-Regular.ttf"
+	TextRegular []byte
+	//go:embed "Noto_Sans/NotoSans-Bold.ttf"
+	TextBold []byte
+	//go:embed "Noto_Sans/NotoSans-Italic.ttf"
+	TextItalic []byte
+)
+
+// MonoRegular, MonoBold, and MonoItalic are the styles of Inconsolata.
+var (
+	//go:embed "Inconsolata/static/Inconsolata-Medium.ttf"
+	MonoRegular []byte
+	//go:embed "Inconsolata/static/Inconsolata-ExtraBold.ttf"
+	MonoBold []byte
+	//go:embed "Inconsolata/Inconsolata-VariableFont_wdth,wght.ttf"
+	MonoItalic []byte
+)
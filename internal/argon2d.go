@@ -0,0 +1,266 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Argon2d is not provided by golang.org/x/crypto/argon2, which only implements Argon2i, and Argon2id,
+// but is the key derivation function KeePassXC uses by default. It is implemented here following RFC 9106,
+// for version 0x13 only.
+
+const (
+	argon2Version     = 0x13
+	argon2BlockWords  = 128 // 1 KiB
+	argon2SyncPoints  = 4
+	argon2TypeArgon2d = 0
+)
+
+type argon2Block [argon2BlockWords]uint64
+
+// argon2dKey derives a key of keyLen bytes from the password, salt, secret, and associated data, using Argon2d,
+// with time passes over memory KiB, in threads lanes.
+func argon2dKey(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	if time < 1 {
+		time = 1
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	if memory < 2*argon2SyncPoints*uint32(threads) {
+		memory = 2 * argon2SyncPoints * uint32(threads)
+	}
+
+	h0 := argon2InitHash(password, salt, secret, data, time, memory, uint32(threads), keyLen)
+	memory = memory / (argon2SyncPoints * uint32(threads)) * (argon2SyncPoints * uint32(threads))
+	blocks := make([]argon2Block, memory)
+	laneLength := memory / uint32(threads)
+
+	var input [blake2b.Size + 8]byte
+	copy(input[:], h0[:])
+	var output [argon2BlockWords * 8]byte
+	for lane := uint32(0); lane < uint32(threads); lane++ {
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(input[blake2b.Size:], i)
+			binary.LittleEndian.PutUint32(input[blake2b.Size+4:], lane)
+			argon2Hash(output[:], input[:])
+			block := &blocks[lane*laneLength+i]
+			for j := range block {
+				block[j] = binary.LittleEndian.Uint64(output[j*8:])
+			}
+		}
+	}
+
+	argon2ProcessBlocks(blocks, time, laneLength, uint32(threads))
+
+	last := blocks[laneLength-1]
+	for lane := uint32(1); lane < uint32(threads); lane++ {
+		for i, word := range blocks[lane*laneLength+laneLength-1] {
+			last[i] ^= word
+		}
+	}
+	for i, word := range last {
+		binary.LittleEndian.PutUint64(output[i*8:], word)
+	}
+	key := make([]byte, keyLen)
+	argon2Hash(key, output[:])
+
+	return key
+}
+
+// argon2InitHash returns H0, the hash of the parameters, and the inputs.
+func argon2InitHash(password, salt, secret, data []byte, time, memory, threads, keyLen uint32) [blake2b.Size]byte {
+	h, _ := blake2b.New512(nil)
+	var params [24]byte
+	binary.LittleEndian.PutUint32(params[0:], threads)
+	binary.LittleEndian.PutUint32(params[4:], keyLen)
+	binary.LittleEndian.PutUint32(params[8:], memory)
+	binary.LittleEndian.PutUint32(params[12:], time)
+	binary.LittleEndian.PutUint32(params[16:], argon2Version)
+	binary.LittleEndian.PutUint32(params[20:], argon2TypeArgon2d)
+	_, _ = h.Write(params[:])
+	for _, input := range [][]byte{password, salt, secret, data} {
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(input)))
+		_, _ = h.Write(length[:])
+		_, _ = h.Write(input)
+	}
+
+	var h0 [blake2b.Size]byte
+	h.Sum(h0[:0])
+	return h0
+}
+
+// argon2Hash is H', the variable length hash function of Argon2, filling out with the hash of in.
+func argon2Hash(out, in []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+
+	if len(out) <= blake2b.Size {
+		h, _ := blake2b.New(len(out), nil)
+		_, _ = h.Write(length[:])
+		_, _ = h.Write(in)
+		h.Sum(out[:0])
+		return
+	}
+
+	h, _ := blake2b.New512(nil)
+	_, _ = h.Write(length[:])
+	_, _ = h.Write(in)
+	var v [blake2b.Size]byte
+	h.Sum(v[:0])
+	// each hash but the last adds its first half to the output
+	n := copy(out, v[:blake2b.Size/2])
+	for len(out)-n > blake2b.Size {
+		v = blake2b.Sum512(v[:])
+		n += copy(out[n:], v[:blake2b.Size/2])
+	}
+	h, _ = blake2b.New(len(out)-n, nil)
+	_, _ = h.Write(v[:])
+	h.Sum(out[n:n])
+}
+
+// argon2ProcessBlocks fills the memory in time passes, the lanes of each slice in parallel.
+func argon2ProcessBlocks(blocks []argon2Block, time, laneLength, threads uint32) {
+	segmentLength := laneLength / argon2SyncPoints
+
+	processSegment := func(pass, slice, lane uint32) {
+		index := uint32(0)
+		if pass == 0 && slice == 0 {
+			index = 2 // the first two blocks are derived from H0
+		}
+		offset := lane*laneLength + slice*segmentLength + index
+		for ; index < segmentLength; index, offset = index+1, offset+1 {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += laneLength // the last block of the lane
+			}
+			// Argon2d depends on the data: the reference block is chosen by the previous one
+			ref := argon2IndexAlpha(blocks[prev][0], pass, slice, lane, index, laneLength, segmentLength, threads)
+			argon2Compress(&blocks[offset], &blocks[prev], &blocks[ref])
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < threads; lane++ {
+				wg.Add(1)
+				go func(lane uint32) {
+					defer wg.Done()
+					processSegment(pass, slice, lane)
+				}(lane)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+// argon2IndexAlpha returns the index of the reference block, chosen by rand, among the blocks that may be referenced.
+func argon2IndexAlpha(rand uint64, pass, slice, lane, index, laneLength, segmentLength, threads uint32) uint32 {
+	refLane := uint32(rand>>32) % threads
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+
+	// the size of the reference area, and where it starts
+	size, start := 3*segmentLength, ((slice+1)%argon2SyncPoints)*segmentLength
+	if lane == refLane {
+		size += index
+	}
+	if pass == 0 {
+		size, start = slice*segmentLength, 0
+		if slice == 0 || lane == refLane {
+			size += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		size--
+	}
+
+	x := rand & 0xFFFFFFFF
+	x = x * x >> 32
+	x = x * uint64(size) >> 32
+	return refLane*laneLength + uint32((uint64(start)+uint64(size)-(x+1))%uint64(laneLength))
+}
+
+// argon2Compress is G, the compression function, XORed into out, as of version 0x13.
+func argon2Compress(out, x, y *argon2Block) {
+	var r, q argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	q = r
+
+	var v [16]uint64
+	// rows of 16 words
+	for row := 0; row < 8; row++ {
+		copy(v[:], q[row*16:row*16+16])
+		argon2Permute(&v)
+		copy(q[row*16:row*16+16], v[:])
+	}
+	// columns of 2 words in each row
+	for column := 0; column < 8; column++ {
+		for i := 0; i < 8; i++ {
+			v[2*i], v[2*i+1] = q[i*16+2*column], q[i*16+2*column+1]
+		}
+		argon2Permute(&v)
+		for i := 0; i < 8; i++ {
+			q[i*16+2*column], q[i*16+2*column+1] = v[2*i], v[2*i+1]
+		}
+	}
+
+	for i := range out {
+		out[i] ^= q[i] ^ r[i]
+	}
+}
+
+// argon2Permute is P, the permutation of the BLAKE2b round, with the multiplications of BlaMka.
+func argon2Permute(v *[16]uint64) {
+	argon2Mix(v, 0, 4, 8, 12)
+	argon2Mix(v, 1, 5, 9, 13)
+	argon2Mix(v, 2, 6, 10, 14)
+	argon2Mix(v, 3, 7, 11, 15)
+	argon2Mix(v, 0, 5, 10, 15)
+	argon2Mix(v, 1, 6, 11, 12)
+	argon2Mix(v, 2, 7, 8, 13)
+	argon2Mix(v, 3, 4, 9, 14)
+}
+
+func argon2Mix(v *[16]uint64, a, b, c, d int) {
+	blamka := func(x, y uint64) uint64 {
+		return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+	}
+
+	v[a] = blamka(v[a], v[b])
+	v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+	v[c] = blamka(v[c], v[d])
+	v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+	v[a] = blamka(v[a], v[b])
+	v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+	v[c] = blamka(v[c], v[d])
+	v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+}
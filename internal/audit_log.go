@@ -0,0 +1,316 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// AuditOutcome tells whether an audited command succeeded.
+type AuditOutcome uint8
+
+const (
+	AuditOutcomeSuccess AuditOutcome = iota
+	AuditOutcomeFailure
+)
+
+// String returns the name of the outcome.
+func (o AuditOutcome) String() string {
+	switch o {
+	case AuditOutcomeSuccess:
+		return "success"
+	case AuditOutcomeFailure:
+		return "failure"
+	default:
+		return "unknown"
+	}
+}
+
+func (o AuditOutcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *AuditOutcome) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "success":
+		*o = AuditOutcomeSuccess
+	case "failure":
+		*o = AuditOutcomeFailure
+	default:
+		return fmt.Errorf("unknown outcome '%s'", text)
+	}
+
+	return nil
+}
+
+// AuditRecord is an invocation of a command, as recorded in the AuditLog.
+type AuditRecord struct {
+	Time         time.Time    `json:"time"`
+	Command      string       `json:"command"`
+	SerialNumber string       `json:"serial,omitempty"`
+	Outcome      AuditOutcome `json:"outcome"`
+	Error        string       `json:"error,omitempty"`
+	User         string       `json:"user,omitempty"`
+	Host         string       `json:"host,omitempty"`
+	Version      string       `json:"version"`
+}
+
+// auditEntry is a line of the audit log: the record, encrypted, chained to the line before it
+// by its SHA-256 checksum, so lines can not be removed, reordered, or changed unnoticed.
+// The checksums are not keyed, anyone who can write the log can rewrite it, and compute a new chain,
+// so a rewrite is only noticed against a head noted outside the log earlier, see VerifyAuditLogHead.
+type auditEntry struct {
+	Sequence int    `json:"n"`
+	Previous string `json:"prev"`
+	Record   string `json:"record"`
+}
+
+// AuditLog is an append-only log of the commands run, kept in a file of one JSON line per record.
+// The records are encrypted to an OpenPGP public key, so the log can be written without being readable,
+// and only the holder of the private key can read it, see ReadAuditLog.
+type AuditLog struct {
+	path      string
+	recipient *crypto.KeyRing
+}
+
+// NewAuditLog returns the audit log at path, encrypting records to publicKey, an OpenPGP key, armored, or binary.
+func NewAuditLog(path string, publicKey []byte) (*AuditLog, error) {
+	key, err := readOpenPGPKey(publicKey)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the public key of the audit log"), err)
+	}
+	if key.IsPrivate() {
+		// only the public part is needed to write the log
+		if key, err = key.ToPublic(); err != nil {
+			return nil, errors.Join(errors.New("error reading the public key of the audit log"), err)
+		}
+	}
+	if !key.CanEncrypt() {
+		return nil, errors.New("the key of the audit log can not be used for encryption, it may be expired, or revoked")
+	}
+
+	recipient, err := crypto.NewKeyRing(key)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the public key of the audit log"), err)
+	}
+
+	return &AuditLog{path: path, recipient: recipient}, nil
+}
+
+// Path returns the path of the file the log is kept in.
+func (l *AuditLog) Path() string {
+	return l.path
+}
+
+// Append encrypts the record, and appends it to the log, chained to the last line.
+// The chain is verified first, so a record is never appended to a log that was tampered with.
+// The log is locked from reading its last line until the record is written, so records appended at the same time
+// are chained one after the other.
+func (l *AuditLog) Append(record AuditRecord) (err error) {
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return errors.Join(errors.New("error opening the audit log"), err)
+	}
+	lock, err := lockOpenFile(file)
+	if err != nil {
+		_ = file.Close()
+		return errors.Join(errors.New("error locking the audit log"), err)
+	}
+	defer func() {
+		if unlockErr := lock.Unlock(); unlockErr != nil && err == nil {
+			err = errors.Join(errors.New("error writing the audit log"), unlockErr)
+		}
+	}()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return errors.Join(errors.New("error reading the audit log"), err)
+	}
+	entries, head, err := VerifyAuditLog(data)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(record)
+	if err != nil {
+		return errors.Join(errors.New("error serializing the audit record"), err)
+	}
+	message, err := l.recipient.Encrypt(crypto.NewPlainMessage(plaintext), nil)
+	if err != nil {
+		return errors.Join(errors.New("error encrypting the audit record"), err)
+	}
+
+	line, err := json.Marshal(auditEntry{
+		Sequence: entries + 1,
+		Previous: head,
+		Record:   base64.StdEncoding.EncodeToString(message.GetBinary()),
+	})
+	if err != nil {
+		return errors.Join(errors.New("error serializing the audit record"), err)
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return errors.Join(errors.New("error writing the audit log"), err)
+	}
+
+	return nil
+}
+
+// VerifyAuditLog verifies the chain of the lines of the audit log, without decrypting the records,
+// and returns the number of records, and the checksum of the last line, the head of the chain.
+// The chain only shows the log is consistent, removing records from the end of the log, or rewriting it as a whole,
+// can only be noticed by comparing the head to one noted earlier, see VerifyAuditLogHead.
+func VerifyAuditLog(data []byte) (entries int, head string, err error) {
+	lines, head, err := readAuditEntries(data, nil)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return len(lines), head, nil
+}
+
+// VerifyAuditLogHead verifies the chain of the audit log, as VerifyAuditLog does, and that it still holds the record
+// whose checksum is head, a head of the chain noted outside the log earlier, such as on paper, or in a ticket.
+// It returns the number of that record: the records up to it are unchanged since.
+func VerifyAuditLogHead(data []byte, head string) (int, error) {
+	head = strings.ToLower(strings.TrimSpace(head))
+	found := 0
+	entries, _, err := readAuditEntries(data, func(sequence int, sum string) {
+		if sum == head {
+			found = sequence
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if found == 0 {
+		return 0, core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("the audit log of %d records does not hold the head %s, it was rewritten, or records were removed from its end", len(entries), head))
+	}
+
+	return found, nil
+}
+
+// readAuditEntries reads, and verifies the chain of, the lines of the audit log.
+// visit, if not nil, is called with the sequence number, and checksum, of every line.
+func readAuditEntries(data []byte, visit func(sequence int, sum string)) ([]auditEntry, string, error) {
+	var entries []auditEntry
+	head := ""
+	if len(data) == 0 {
+		return entries, head, nil
+	}
+
+	for i, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		var entry auditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, "", core.WithCategory(core.ErrorCategoryChecksum, errors.Join(fmt.Errorf("audit log line %d is not a record", i+1), err))
+		}
+		if entry.Sequence != i+1 {
+			return nil, "", core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("audit log line %d holds record %d, records were removed, or reordered", i+1, entry.Sequence))
+		}
+		if entry.Previous != head {
+			return nil, "", core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("audit log line %d does not follow the line before it, the log was changed", i+1))
+		}
+
+		sum := sha256.Sum256(line)
+		head = hex.EncodeToString(sum[:])
+		entries = append(entries, entry)
+		if visit != nil {
+			visit(entry.Sequence, head)
+		}
+	}
+
+	return entries, head, nil
+}
+
+// ReadAuditLog verifies the chain of the audit log (see VerifyAuditLog), and decrypts its records using privateKey.
+func ReadAuditLog(data []byte, privateKey *crypto.KeyRing) ([]AuditRecord, error) {
+	entries, _, err := readAuditEntries(data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]AuditRecord, len(entries))
+	for i, entry := range entries {
+		binary, err := base64.StdEncoding.DecodeString(entry.Record)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading audit record %d", entry.Sequence), err)
+		}
+		plaintext, err := privateKey.Decrypt(crypto.NewPGPMessage(binary), nil, 0)
+		if err != nil {
+			return nil, core.WithCategory(core.ErrorCategoryPassphrase, errors.Join(fmt.Errorf("error decrypting audit record %d", entry.Sequence), err))
+		}
+		if err := json.Unmarshal(plaintext.GetBinary(), &records[i]); err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading audit record %d", entry.Sequence), err)
+		}
+	}
+
+	return records, nil
+}
+
+// ReadAuditPrivateKey reads the private key of the audit log, an OpenPGP key, armored, or binary,
+// and unlocks it, if it is locked, with the passphrase returned by passphrase.
+func ReadAuditPrivateKey(data []byte, passphrase func() ([]byte, error)) (*crypto.KeyRing, error) {
+	key, err := readOpenPGPKey(data)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the private key of the audit log"), err)
+	}
+	if !key.IsPrivate() {
+		return nil, errors.New("the key of the audit log is a public key, its records can only be read using the private key")
+	}
+
+	locked, err := key.IsLocked()
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the private key of the audit log"), err)
+	}
+	if locked {
+		passphraseBytes, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if key, err = key.Unlock(passphraseBytes); err != nil {
+			return nil, core.WithCategory(core.ErrorCategoryPassphrase, errors.Join(errors.New("error unlocking the private key of the audit log"), err))
+		}
+	}
+
+	return crypto.NewKeyRing(key)
+}
+
+// readOpenPGPKey reads an OpenPGP key, armored, or binary.
+func readOpenPGPKey(data []byte) (*crypto.Key, error) {
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return crypto.NewKeyFromArmored(string(data))
+	}
+
+	return crypto.NewKey(data)
+}
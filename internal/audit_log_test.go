@@ -0,0 +1,266 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+func TestAuditLog(t *testing.T) {
+	key, err := crypto.GenerateKey("Auditor", "audit@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	publicKey, err := key.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatalf("GetArmoredPublicKey failed with error %s", err)
+	}
+	locked, err := key.Lock([]byte("auditor"))
+	if err != nil {
+		t.Fatalf("Lock failed with error %s", err)
+	}
+	privateKey, err := locked.Armor()
+	if err != nil {
+		t.Fatalf("Armor failed with error %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := NewAuditLog(path, []byte(publicKey))
+	if err != nil {
+		t.Fatalf("NewAuditLog failed with error %s", err)
+	}
+
+	want := []AuditRecord{
+		{Time: time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), Command: "generate", SerialNumber: "ABCDEF", Version: "2.0.0"},
+		{Time: time.Date(2024, 8, 2, 12, 0, 0, 0, time.UTC), Command: "decode", SerialNumber: "ABCDEF", Outcome: AuditOutcomeFailure, Error: "error decrypting data", Version: "2.0.0"},
+		{Time: time.Date(2024, 8, 3, 12, 0, 0, 0, time.UTC), Command: "restore", SerialNumber: "ABCDEF", Version: "2.0.0"},
+	}
+	for _, record := range want {
+		if err := auditLog.Append(record); err != nil {
+			t.Fatalf("Append failed with error %s", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("ABCDEF")) {
+		t.Errorf("The records should be encrypted, got: %s", data)
+	}
+
+	entries, head, err := VerifyAuditLog(data)
+	if err != nil {
+		t.Fatalf("VerifyAuditLog failed with error %s", err)
+	}
+	if entries != len(want) || len(head) != 64 {
+		t.Errorf("got: %d records, head %s, want: %d records.", entries, head, len(want))
+	}
+
+	keyRing, err := ReadAuditPrivateKey([]byte(privateKey), func() ([]byte, error) { return []byte("auditor"), nil })
+	if err != nil {
+		t.Fatalf("ReadAuditPrivateKey failed with error %s", err)
+	}
+	records, err := ReadAuditLog(data, keyRing)
+	if err != nil {
+		t.Fatalf("ReadAuditLog failed with error %s", err)
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got: %d records, want: %d.", len(records), len(want))
+	}
+	for i := range want {
+		if !records[i].Time.Equal(want[i].Time) || records[i].Command != want[i].Command || records[i].Outcome != want[i].Outcome || records[i].Error != want[i].Error {
+			t.Errorf("got: %+v, want: %+v.", records[i], want[i])
+		}
+	}
+
+	if _, err := ReadAuditPrivateKey([]byte(publicKey), nil); err == nil {
+		t.Errorf("ReadAuditPrivateKey should fail for a public key")
+	}
+	if _, err := ReadAuditPrivateKey([]byte(privateKey), func() ([]byte, error) { return []byte("wrong"), nil }); err == nil {
+		t.Errorf("ReadAuditPrivateKey should fail for a wrong passphrase")
+	}
+}
+
+func TestAuditLogTampering(t *testing.T) {
+	key, err := crypto.GenerateKey("Auditor", "audit@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	publicKey, err := key.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatalf("GetArmoredPublicKey failed with error %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := NewAuditLog(path, []byte(publicKey))
+	if err != nil {
+		t.Fatalf("NewAuditLog failed with error %s", err)
+	}
+	for _, command := range []string{"generate", "decode", "verify"} {
+		if err := auditLog.Append(AuditRecord{Time: time.Now(), Command: command}); err != nil {
+			t.Fatalf("Append failed with error %s", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+
+	tests := []struct {
+		name  string
+		lines [][]byte
+	}{
+		{"removed", [][]byte{lines[0], lines[2]}},
+		{"reordered", [][]byte{lines[1], lines[0], lines[2]}},
+		{"changed", [][]byte{lines[0], bytes.Replace(lines[1], []byte(`"record":"`), []byte(`"record":"A`), 1), lines[2]}},
+		{"garbage", [][]byte{lines[0], []byte("not a record"), lines[2]}},
+	}
+	for _, test := range tests {
+		tampered := append(bytes.Join(test.lines, []byte("\n")), '\n')
+		if _, _, err := VerifyAuditLog(tampered); err == nil {
+			t.Errorf("VerifyAuditLog should fail for a log with a %s line", test.name)
+		}
+	}
+
+	// nothing is appended to a log that was tampered with
+	if err := os.WriteFile(path, append(bytes.Join([][]byte{lines[0], lines[2]}, []byte("\n")), '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditLog.Append(AuditRecord{Time: time.Now(), Command: "restore"}); err == nil {
+		t.Errorf("Append should fail for a log that was tampered with")
+	}
+}
+
+func TestAuditLogConcurrent(t *testing.T) {
+	key, err := crypto.GenerateKey("Auditor", "audit@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	publicKey, err := key.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatalf("GetArmoredPublicKey failed with error %s", err)
+	}
+
+	// every command opens the log on its own
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	const runs = 8
+	errs := make(chan error, runs)
+	var wg sync.WaitGroup
+	for range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			auditLog, err := NewAuditLog(path, []byte(publicKey))
+			if err != nil {
+				errs <- err
+				return
+			}
+			errs <- auditLog.Append(AuditRecord{Time: time.Now(), Command: "generate"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Append failed with error %s", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _, err := VerifyAuditLog(data); err != nil || entries != runs {
+		t.Errorf("VerifyAuditLog failed with error %v, got: %d records, want: %d.", err, entries, runs)
+	}
+}
+
+func TestVerifyAuditLogHead(t *testing.T) {
+	key, err := crypto.GenerateKey("Auditor", "audit@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	publicKey, err := key.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatalf("GetArmoredPublicKey failed with error %s", err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, commands ...string) []byte {
+		auditLog, err := NewAuditLog(filepath.Join(dir, name), []byte(publicKey))
+		if err != nil {
+			t.Fatalf("NewAuditLog failed with error %s", err)
+		}
+		for _, command := range commands {
+			if err := auditLog.Append(AuditRecord{Time: time.Now(), Command: command}); err != nil {
+				t.Fatalf("Append failed with error %s", err)
+			}
+		}
+		data, err := os.ReadFile(auditLog.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// the head is noted after two records, more are appended later on
+	data := write("audit.jsonl", "generate", "decode")
+	_, head, err := VerifyAuditLog(data)
+	if err != nil {
+		t.Fatalf("VerifyAuditLog failed with error %s", err)
+	}
+	data = write("audit.jsonl", "restore")
+
+	anchored, err := VerifyAuditLogHead(data, strings.ToUpper(head))
+	if err != nil {
+		t.Fatalf("VerifyAuditLogHead failed with error %s", err)
+	}
+	if anchored != 2 {
+		t.Errorf("got: %v, want: %v.", anchored, 2)
+	}
+
+	// a log rewritten as a whole has a valid chain, but not the noted head
+	rewritten := write("rewritten.jsonl", "generate", "decode", "restore")
+	if _, _, err := VerifyAuditLog(rewritten); err != nil {
+		t.Fatalf("VerifyAuditLog failed with error %s", err)
+	}
+	if _, err := VerifyAuditLogHead(rewritten, head); err == nil {
+		t.Errorf("VerifyAuditLogHead should fail for a rewritten log")
+	}
+
+	// as does a log whose last records were removed
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if _, err := VerifyAuditLogHead(lines[0], head); err == nil {
+		t.Errorf("VerifyAuditLogHead should fail for a log whose last records were removed")
+	}
+}
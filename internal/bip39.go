@@ -0,0 +1,145 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// BIP39WordListSize is the number of words in a BIP39 word list, each word encodes 11 bits.
+	BIP39WordListSize = 2048
+	bip39BitsPerWord  = 11
+)
+
+// BIP39ValidWordCounts lists the mnemonic lengths allowed by BIP39.
+var BIP39ValidWordCounts = []int{12, 15, 18, 21, 24}
+
+// BIP39EntropyBytes returns the amount of entropy (in bytes) encoded by a mnemonic of `words` words.
+// Every 3 words hold 32 bits of entropy and 1 bit of checksum.
+func BIP39EntropyBytes(words int) (int, error) {
+	for _, valid := range BIP39ValidWordCounts {
+		if words == valid {
+			return words * 4 / 3, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid BIP39 word count %d, must be one of %v", words, BIP39ValidWordCounts)
+}
+
+// BIP39WordsForEntropy returns the number of words of a mnemonic encoding `bits` bits of entropy.
+func BIP39WordsForEntropy(bits int) (int, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return 0, fmt.Errorf("invalid BIP39 entropy of %d bits, must be a multiple of 32 between 128 and 256", bits)
+	}
+
+	return bits * 3 / 32, nil
+}
+
+// GenerateBIP39Mnemonic generates a random BIP39 mnemonic of `words` words.
+func GenerateBIP39Mnemonic(words int, wordList []string) ([]string, error) {
+	entropyBytes, err := BIP39EntropyBytes(words)
+	if err != nil {
+		return nil, err
+	}
+
+	entropy := make([]byte, entropyBytes)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, errors.Join(errors.New("error generating entropy"), err)
+	}
+
+	return BIP39MnemonicFromEntropy(entropy, wordList)
+}
+
+// BIP39MnemonicFromEntropy encodes entropy as a BIP39 mnemonic.
+// The entropy is followed by the first len(entropy)*8/32 bits of its SHA-256 hash,
+// and the result is split into 11-bit groups, each selecting one word.
+func BIP39MnemonicFromEntropy(entropy []byte, wordList []string) ([]string, error) {
+	if len(wordList) != BIP39WordListSize {
+		return nil, fmt.Errorf("invalid BIP39 word list length %d, expected %d", len(wordList), BIP39WordListSize)
+	}
+
+	entropyBits := len(entropy) * 8
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return nil, fmt.Errorf("invalid entropy length of %d bits", entropyBits)
+	}
+
+	checksumBits := entropyBits / 32
+	hash := sha256.Sum256(entropy)
+
+	combined := new(big.Int).SetBytes(entropy)
+	combined.Lsh(combined, uint(checksumBits))
+	combined.Or(combined, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	wordCount := (entropyBits + checksumBits) / bip39BitsPerWord
+	mask := big.NewInt(BIP39WordListSize - 1)
+	mnemonic := make([]string, wordCount)
+	index := new(big.Int)
+	for i := wordCount - 1; i >= 0; i-- {
+		index.And(combined, mask)
+		mnemonic[i] = wordList[index.Int64()]
+		combined.Rsh(combined, bip39BitsPerWord)
+	}
+
+	return mnemonic, nil
+}
+
+// ValidateBIP39Mnemonic checks that every word of the mnemonic is part of the word list,
+// and that the embedded checksum matches.
+func ValidateBIP39Mnemonic(mnemonic []string, wordList []string) error {
+	entropyBytes, err := BIP39EntropyBytes(len(mnemonic))
+	if err != nil {
+		return err
+	}
+
+	indices := make(map[string]int64, len(wordList))
+	for i, word := range wordList {
+		indices[word] = int64(i)
+	}
+
+	combined := new(big.Int)
+	for _, word := range mnemonic {
+		index, ok := indices[strings.ToLower(strings.TrimSpace(word))]
+		if !ok {
+			return fmt.Errorf("word '%s' is not part of the BIP39 word list", word)
+		}
+
+		combined.Lsh(combined, bip39BitsPerWord)
+		combined.Or(combined, big.NewInt(index))
+	}
+
+	checksumBits := entropyBytes * 8 / 32
+	checksum := new(big.Int).And(combined, big.NewInt(1<<checksumBits-1)).Int64()
+	combined.Rsh(combined, uint(checksumBits))
+
+	entropy := combined.FillBytes(make([]byte, entropyBytes))
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return errors.New("invalid BIP39 checksum")
+	}
+
+	return nil
+}
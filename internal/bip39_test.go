@@ -0,0 +1,103 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func readBIP39WordList(t *testing.T) []string {
+	t.Helper()
+
+	data, err := os.ReadFile("../bip-0039_english.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Fields(string(data))
+}
+
+func TestBIP39MnemonicFromEntropy(t *testing.T) {
+	wordList := readBIP39WordList(t)
+
+	// test vectors from https://github.com/trezor/python-mnemonic/blob/master/vectors.json
+	vectors := []struct {
+		entropy  []byte
+		mnemonic string
+	}{
+		{bytes.Repeat([]byte{0x00}, 16), "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+		{bytes.Repeat([]byte{0x7f}, 16), "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+		{bytes.Repeat([]byte{0xff}, 16), "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"},
+		{bytes.Repeat([]byte{0x00}, 32), "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"},
+	}
+
+	for _, vector := range vectors {
+		mnemonic, err := BIP39MnemonicFromEntropy(vector.entropy, wordList)
+		if err != nil {
+			t.Fatalf("BIP39MnemonicFromEntropy failed with error %s", err)
+		}
+
+		if strings.Join(mnemonic, " ") != vector.mnemonic {
+			t.Errorf("Mnemonic was incorrect, got: %s, want: %s.", strings.Join(mnemonic, " "), vector.mnemonic)
+		}
+
+		if err := ValidateBIP39Mnemonic(mnemonic, wordList); err != nil {
+			t.Errorf("ValidateBIP39Mnemonic failed with error %s", err)
+		}
+	}
+}
+
+func TestGenerateBIP39Mnemonic(t *testing.T) {
+	wordList := readBIP39WordList(t)
+
+	t.Run("generate valid mnemonics", func(t *testing.T) {
+		for _, words := range BIP39ValidWordCounts {
+			mnemonic, err := GenerateBIP39Mnemonic(words, wordList)
+			if err != nil {
+				t.Fatalf("GenerateBIP39Mnemonic failed with error %s", err)
+			}
+
+			if len(mnemonic) != words {
+				t.Errorf("Mnemonic length was incorrect, got: %d, want: %d.", len(mnemonic), words)
+			}
+
+			if err := ValidateBIP39Mnemonic(mnemonic, wordList); err != nil {
+				t.Errorf("ValidateBIP39Mnemonic failed with error %s", err)
+			}
+		}
+	})
+
+	t.Run("reject invalid word count", func(t *testing.T) {
+		if _, err := GenerateBIP39Mnemonic(13, wordList); err == nil {
+			t.Errorf("GenerateBIP39Mnemonic should fail with an invalid word count")
+		}
+	})
+
+	t.Run("detect invalid checksum", func(t *testing.T) {
+		mnemonic := strings.Fields("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")
+		if err := ValidateBIP39Mnemonic(mnemonic, wordList); err == nil {
+			t.Errorf("ValidateBIP39Mnemonic should fail with an invalid checksum")
+		}
+	})
+}
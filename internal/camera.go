@@ -0,0 +1,151 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// CameraFrameRate is the number of frames per second captured from the camera,
+// a few are plenty to read a code held still, and leave time to look for codes in each.
+const CameraFrameRate = 4
+
+// FFmpegCamera captures the frames of a camera using the ffmpeg command line program (https://ffmpeg.org).
+type FFmpegCamera struct {
+	// Path is the path of the ffmpeg program.
+	Path string
+
+	// Device is the camera to capture from, as named by the operating system,
+	// such as "/dev/video0" on Linux, "0" on macOS, or the name of the camera on Windows.
+	Device string
+}
+
+// NewFFmpegCamera looks up the ffmpeg program, by name in the PATH, or at the given path.
+// If device is empty, the default camera of the operating system is used, see DefaultCameraDevice.
+func NewFFmpegCamera(path string, device string) (*FFmpegCamera, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%s not found, install FFmpeg (https://ffmpeg.org) to capture images from a camera", path), err)
+	}
+
+	if device == "" {
+		device = DefaultCameraDevice(runtime.GOOS)
+		if device == "" {
+			return nil, fmt.Errorf("there is no default camera on %s, name the camera to use", runtime.GOOS)
+		}
+	}
+
+	return &FFmpegCamera{Path: resolved, Device: device}, nil
+}
+
+// DefaultCameraDevice returns the default camera of an operating system, or an empty string,
+// if cameras must be named (such as on Windows).
+func DefaultCameraDevice(goos string) string {
+	switch goos {
+	case "linux":
+		return "/dev/video0"
+	case "darwin":
+		return "0"
+	default:
+		return ""
+	}
+}
+
+// cameraInputArgs returns the arguments of ffmpeg capturing from a camera, by operating system.
+func cameraInputArgs(goos string, device string) ([]string, error) {
+	switch goos {
+	case "linux":
+		return []string{"-f", "v4l2", "-i", device}, nil
+	case "darwin":
+		return []string{"-f", "avfoundation", "-framerate", "30", "-i", device}, nil
+	case "windows":
+		return []string{"-f", "dshow", "-i", "video=" + device}, nil
+	default:
+		return nil, fmt.Errorf("capturing from a camera is not supported on %s", goos)
+	}
+}
+
+// Capture captures frames from the camera, CameraFrameRate per second, and passes each to frame,
+// until it returns done, or an error.
+func (c *FFmpegCamera) Capture(frame func(img image.Image) (done bool, err error)) error {
+	input, err := cameraInputArgs(runtime.GOOS, c.Device)
+	if err != nil {
+		return err
+	}
+
+	// the frames are written as a stream of PNG images
+	args := append([]string{"-hide_banner", "-loglevel", "error"}, input...)
+	args = append(args, "-vf", "fps="+strconv.Itoa(CameraFrameRate), "-f", "image2pipe", "-c:v", "png", "-")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.Path, args...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Join(errors.New("error capturing from the camera"), err)
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.Join(errors.New("error running ffmpeg"), err)
+	}
+
+	readErr := ReadFrames(stdout, frame)
+
+	// ffmpeg is stopped once no more frames are needed
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	if readErr == io.ErrUnexpectedEOF {
+		return fmt.Errorf("error capturing from the camera %s: %s", c.Device, strings.TrimSpace(stderr.String()))
+	}
+
+	return readErr
+}
+
+// ReadFrames reads a stream of PNG images, passing each to frame, until it returns done, or an error.
+// If the stream ends before, io.ErrUnexpectedEOF is returned.
+func ReadFrames(r io.Reader, frame func(img image.Image) (done bool, err error)) error {
+	// the PNG decoder reads exactly one image, so consecutive images are read from the same reader
+	reader := bufio.NewReader(r)
+	for {
+		if _, err := reader.Peek(1); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		img, err := png.Decode(reader)
+		if err != nil {
+			return errors.Join(errors.New("error decoding a frame of the camera"), err)
+		}
+
+		done, err := frame(img)
+		if err != nil || done {
+			return err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestReadFrames(t *testing.T) {
+	var stream bytes.Buffer
+	for i := 1; i <= 3; i++ {
+		if err := png.Encode(&stream, image.NewGray(image.Rect(0, 0, i, i))); err != nil {
+			t.Fatalf("Encode failed with error %s", err)
+		}
+	}
+
+	// every frame is read, in order, until the stream ends
+	var sizes []int
+	err := ReadFrames(bytes.NewReader(stream.Bytes()), func(img image.Image) (bool, error) {
+		sizes = append(sizes, img.Bounds().Dx())
+		return false, nil
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFrames was incorrect, got: %v, want: %v.", err, io.ErrUnexpectedEOF)
+	}
+	if len(sizes) != 3 || sizes[0] != 1 || sizes[2] != 3 {
+		t.Errorf("ReadFrames was incorrect, got: %v, want: [1 2 3].", sizes)
+	}
+
+	// reading stops once done
+	frames := 0
+	err = ReadFrames(bytes.NewReader(stream.Bytes()), func(image.Image) (bool, error) {
+		frames++
+		return frames == 2, nil
+	})
+	if err != nil {
+		t.Fatalf("ReadFrames failed with error %s", err)
+	}
+	if frames != 2 {
+		t.Errorf("ReadFrames was incorrect, got: %d frames, want: 2.", frames)
+	}
+}
+
+func TestCameraInputArgs(t *testing.T) {
+	for _, goos := range []string{"linux", "darwin", "windows"} {
+		args, err := cameraInputArgs(goos, "camera")
+		if err != nil {
+			t.Fatalf("cameraInputArgs(%s) failed with error %s", goos, err)
+		}
+		if len(args) < 4 || args[0] != "-f" {
+			t.Errorf("cameraInputArgs(%s) was incorrect, got: %v.", goos, args)
+		}
+	}
+
+	if _, err := cameraInputArgs("plan9", "camera"); err == nil {
+		t.Errorf("cameraInputArgs should fail on unsupported systems")
+	}
+	if got := DefaultCameraDevice("windows"); got != "" {
+		t.Errorf("DefaultCameraDevice was incorrect, got: %s, want: no default.", got)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// CatalogEntry describes a document in the Catalog, so the sheet holding some data can be found
+// without reading every sheet.
+type CatalogEntry struct {
+	SerialNumber string    `json:"serial"`
+	Purpose      string    `json:"purpose,omitempty"`
+	Comment      string    `json:"comment,omitempty"`
+	CreatedAt    time.Time `json:"created"`
+	ExpiresAt    time.Time `json:"-"`
+	ReviewBy     time.Time `json:"-"`
+
+	// ContentSHA256 is the SHA-256 checksum of the content, base64 encoded, as printed in the header of the document.
+	ContentSHA256 string `json:"sha256"`
+
+	// Pages is the number of pages of the document, 0 if unknown.
+	Pages int `json:"pages,omitempty"`
+
+	// Location is a note on where the sheets are stored, such as "safe, top shelf".
+	Location string `json:"location,omitempty"`
+
+	// Supersedes is the serial number of the document this one replaces, if any.
+	Supersedes string `json:"supersedes,omitempty"`
+}
+
+func (e *CatalogEntry) MarshalJSON() ([]byte, error) { // nosemgrep
+	type Alias CatalogEntry
+	return json.Marshal(&struct {
+		ExpiresAt string `json:"expires,omitempty"`
+		ReviewBy  string `json:"review_by,omitempty"`
+		*Alias
+	}{
+		ExpiresAt: core.FormatDueDate(e.ExpiresAt),
+		ReviewBy:  core.FormatDueDate(e.ReviewBy),
+		Alias:     (*Alias)(e),
+	})
+}
+
+func (e *CatalogEntry) UnmarshalJSON(data []byte) error {
+	type Alias CatalogEntry
+	aux := &struct {
+		ExpiresAt string `json:"expires,omitempty"`
+		ReviewBy  string `json:"review_by,omitempty"`
+		*Alias
+	}{
+		Alias: (*Alias)(e),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var err error
+	if e.ExpiresAt, err = core.ParseOptionalDueDate(aux.ExpiresAt); err != nil {
+		return err
+	}
+	if e.ReviewBy, err = core.ParseOptionalDueDate(aux.ReviewBy); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NewCatalogEntry returns the entry describing the document, of the given number of pages (0 if unknown),
+// stored at location.
+func NewCatalogEntry(p *core.PaperCrypt, pages int, location string) CatalogEntry {
+	return CatalogEntry{
+		SerialNumber:  p.SerialNumber,
+		Purpose:       p.Purpose,
+		Comment:       p.Comment,
+		CreatedAt:     p.CreatedAt,
+		ExpiresAt:     p.ExpiresAt,
+		ReviewBy:      p.ReviewBy,
+		ContentSHA256: base64.StdEncoding.EncodeToString(p.DataSHA256[:]),
+		Pages:         pages,
+		Location:      location,
+		Supersedes:    p.Supersedes,
+	}
+}
+
+// Overdue returns a notice for each date of the document that has passed at now, see PaperCrypt.Overdue.
+func (e *CatalogEntry) Overdue(now time.Time) []string {
+	return core.OverdueNotices(e.ExpiresAt, e.ReviewBy, now)
+}
+
+// Matches reports whether the serial number, purpose, comment, or location of the entry contain query, ignoring case.
+func (e *CatalogEntry) Matches(query string) bool {
+	query = strings.ToLower(query)
+	for _, value := range []string{e.SerialNumber, e.Purpose, e.Comment, e.Location} {
+		if strings.Contains(strings.ToLower(value), query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Catalog is a list of the documents generated, or added, kept in a JSON file.
+type Catalog struct {
+	path string
+}
+
+// NewCatalog returns the catalog stored at path, or, if path is empty,
+// in the configuration directory of the user.
+func NewCatalog(path string) (*Catalog, error) {
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, errors.Join(errors.New("error finding the configuration directory"), err)
+		}
+		path = filepath.Join(dir, "papercrypt", "catalog.json")
+	}
+
+	return &Catalog{path: path}, nil
+}
+
+// Path returns the path of the file the catalog is stored in.
+func (c *Catalog) Path() string {
+	return c.path
+}
+
+// Entries returns the documents in the catalog, oldest first.
+// A catalog that does not exist yet is empty.
+func (c *Catalog) Entries() ([]CatalogEntry, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the catalog"), err)
+	}
+
+	var entries []CatalogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Join(fmt.Errorf("error parsing the catalog %s", c.path), err)
+	}
+
+	return entries, nil
+}
+
+// Find returns the document with the serial number, ok is false if it is not in the catalog.
+func (c *Catalog) Find(serialNumber string) (entry CatalogEntry, ok bool, err error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return CatalogEntry{}, false, err
+	}
+
+	i := slices.IndexFunc(entries, func(e CatalogEntry) bool { return e.SerialNumber == serialNumber })
+	if i < 0 {
+		return CatalogEntry{}, false, nil
+	}
+
+	return entries[i], true, nil
+}
+
+// Add adds the document to the catalog, replacing the entry with the same serial number, if any,
+// and returns whether one was replaced.
+// The pages, purpose, and location of the replaced entry are kept, unless set in entry,
+// so adding a scan of a sheet does not lose what was known when it was generated.
+func (c *Catalog) Add(entry CatalogEntry) (bool, error) {
+	if entry.SerialNumber == "" {
+		return false, errors.New("documents without a serial number can not be cataloged")
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		return false, err
+	}
+
+	i := slices.IndexFunc(entries, func(e CatalogEntry) bool { return e.SerialNumber == entry.SerialNumber })
+	replaced := i >= 0
+	if replaced {
+		previous := entries[i]
+		if entry.Pages == 0 {
+			entry.Pages = previous.Pages
+		}
+		if entry.Purpose == "" && entry.Comment == "" {
+			entry.Purpose, entry.Comment = previous.Purpose, previous.Comment
+		}
+		if entry.Location == "" {
+			entry.Location = previous.Location
+		}
+		entries = slices.Delete(entries, i, i+1)
+	}
+
+	entries = append(entries, entry)
+	slices.SortStableFunc(entries, func(a, b CatalogEntry) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return false, errors.Join(errors.New("error serializing the catalog"), err)
+	}
+	if err := writeFileAtomically(c.path, append(data, '\n')); err != nil {
+		return false, errors.Join(errors.New("error writing the catalog"), err)
+	}
+
+	return replaced, nil
+}
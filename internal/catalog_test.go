@@ -0,0 +1,102 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestCatalog(t *testing.T) {
+	catalog, err := NewCatalog(filepath.Join(t.TempDir(), "papercrypt", "catalog.json"))
+	if err != nil {
+		t.Fatalf("NewCatalog failed with error %s", err)
+	}
+
+	// a catalog that does not exist yet is empty
+	entries, err := catalog.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed with error %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got: %v, want: no entries.", entries)
+	}
+
+	newer := core.NewPaperCrypt("2.0.0", []byte("newer data"), "NEWER1", "Wifi", "", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), core.PaperCryptDataFormatPGP)
+	older := core.NewPaperCrypt("2.0.0", []byte("older data"), "OLDER1", "Bank vault", "Box 12", time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), core.PaperCryptDataFormatPGP)
+	older.ReviewBy = time.Date(2027, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, entry := range []CatalogEntry{NewCatalogEntry(newer, 2, ""), NewCatalogEntry(older, 3, "safe, top shelf")} {
+		replaced, err := catalog.Add(entry)
+		if err != nil {
+			t.Fatalf("Add failed with error %s", err)
+		}
+		if replaced {
+			t.Errorf("got: %v, want: %v.", replaced, false)
+		}
+	}
+
+	// adding a document again keeps what is not known anymore, such as from a scan
+	replaced, err := catalog.Add(NewCatalogEntry(older, 0, ""))
+	if err != nil {
+		t.Fatalf("Add failed with error %s", err)
+	}
+	if !replaced {
+		t.Errorf("got: %v, want: %v.", replaced, true)
+	}
+
+	entries, err = catalog.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed with error %s", err)
+	}
+	if len(entries) != 2 || entries[0].SerialNumber != "OLDER1" {
+		t.Fatalf("got: %v, want: 2 entries, oldest first.", entries)
+	}
+	entry := entries[0]
+	if entry.Pages != 3 || entry.Location != "safe, top shelf" || !entry.ReviewBy.Equal(older.ReviewBy) {
+		t.Errorf("got: %+v, want: the pages, location, and review date kept.", entry)
+	}
+
+	found, ok, err := catalog.Find("NEWER1")
+	if err != nil {
+		t.Fatalf("Find failed with error %s", err)
+	}
+	if !ok || found.Purpose != "Wifi" {
+		t.Errorf("got: %+v, want: the entry of NEWER1.", found)
+	}
+	if _, ok, _ := catalog.Find("MISSING"); ok {
+		t.Errorf("Find should not find a serial number not in the catalog")
+	}
+
+	if !entry.Matches("VAULT") || !entry.Matches("top shelf") || entry.Matches("wifi") {
+		t.Errorf("Matching was incorrect for %+v", entry)
+	}
+	if got := entry.Overdue(time.Date(2027, 8, 2, 0, 0, 0, 0, time.UTC)); len(got) != 1 {
+		t.Errorf("got: %v, want: 1 notice.", got)
+	}
+
+	if _, err := catalog.Add(CatalogEntry{}); err == nil {
+		t.Errorf("Add should fail for a document without a serial number")
+	}
+}
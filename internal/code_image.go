@@ -0,0 +1,304 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/boombuler/barcode"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// Code2DQuietZone is the width, in modules, of the empty margin around standalone 2D code images.
+const Code2DQuietZone = 4
+
+// codeImageModules returns the width of a code including its quiet zone, in modules.
+func codeImageModules(code barcode.Barcode) int {
+	return code.Bounds().Dx() + 2*Code2DQuietZone
+}
+
+// Code2DImage renders a code, surrounded by its quiet zone, as a grayscale image at most `size` pixels wide.
+// Each module is drawn as a square of a whole number of pixels, so the image may be slightly smaller.
+func Code2DImage(code barcode.Barcode, size int) (*image.Gray, error) {
+	modules := codeImageModules(code)
+	if size < modules {
+		return nil, fmt.Errorf("an image of %d pixels is too small for a code of %d modules", size, modules)
+	}
+
+	modulePixels := size / modules
+	img := image.NewGray(image.Rect(0, 0, modules*modulePixels, modules*modulePixels))
+	drawModules(img, code, modulePixels, Code2DQuietZone*modulePixels, Code2DQuietZone*modulePixels)
+
+	return img, nil
+}
+
+// writeScaledCodePNG writes the code as a grayscale PNG image, `pixels` wide, as barcode.Scale draws it:
+// each module is a square of the largest whole number of pixels that fits, and the code is centered on a white background.
+// The image is encoded a row at a time, rather than drawn first, as the codes of a document are several megapixels each.
+func writeScaledCodePNG(w io.Writer, code barcode.Barcode, pixels int) error {
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return err
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:4], uint32(pixels))
+	binary.BigEndian.PutUint32(header[4:8], uint32(pixels))
+	header[8] = 8 // bits per sample, the color type (grayscale), compression, filter, and interlace methods are 0
+	if err := writePNGChunk(w, "IHDR", header); err != nil {
+		return err
+	}
+
+	chunks := &pngChunkWriter{w: w}
+	buffered := bufio.NewWriterSize(chunks, 1<<15)
+	if err := writeScaledCodeRows(buffered, code, pixels); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	return writePNGChunk(w, "IEND", nil)
+}
+
+// writeScaledCodeRows writes the image data of writeScaledCodePNG: its rows, filtered as PNG rows, and compressed using zlib.
+// This is the content of the IDAT chunks of the PNG image, or of a PDF image stream, using the PNG predictors.
+func writeScaledCodeRows(w io.Writer, code barcode.Barcode, pixels int) error {
+	bounds := code.Bounds()
+	modulePixels := min(pixels/bounds.Dx(), pixels/bounds.Dy())
+	if modulePixels <= 0 {
+		return fmt.Errorf("can not scale barcode to an image smaller than %dx%d", bounds.Dx(), bounds.Dy())
+	}
+	offsetX, offsetY := (pixels-bounds.Dx()*modulePixels)/2, (pixels-bounds.Dy()*modulePixels)/2
+
+	// the rows of a code are runs of the same few bytes, which compress just as well at the fastest level
+	compressed, err := zlib.NewWriterLevel(w, zlib.BestSpeed)
+	if err != nil {
+		return err
+	}
+
+	// each row is written as a filtered line, starting with its filter type: the first row of a module as the difference
+	// from the pixel to its left (type 1), which is zero but at the edges of modules, the further rows of a module as the
+	// difference from the row above (type 2), which is all zeros
+	row := make([]byte, pixels)
+	first := make([]byte, 1+pixels)
+	first[0] = 1
+	same := make([]byte, 1+pixels)
+	same[0] = 2
+	for i := range row {
+		row[i] = 0xFF
+	}
+	writeRows := func(n int) error {
+		if n == 0 {
+			return nil
+		}
+
+		first[1] = row[0]
+		for i := 1; i < len(row); i++ {
+			first[1+i] = row[i] - row[i-1]
+		}
+		if _, err := compressed.Write(first); err != nil {
+			return err
+		}
+		for range n - 1 {
+			if _, err := compressed.Write(same); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := writeRows(offsetY); err != nil {
+		return err
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			value := byte(0xFF)
+			if core.Dark(code.At(x, y)) {
+				value = 0
+			}
+
+			module := row[offsetX+(x-bounds.Min.X)*modulePixels:][:modulePixels]
+			for i := range module {
+				module[i] = value
+			}
+		}
+		if err := writeRows(modulePixels); err != nil {
+			return err
+		}
+	}
+	for i := range row {
+		row[i] = 0xFF
+	}
+	if err := writeRows(pixels - offsetY - bounds.Dy()*modulePixels); err != nil {
+		return err
+	}
+
+	return compressed.Close()
+}
+
+// pngChunkWriter writes each write as an IDAT chunk of a PNG image.
+type pngChunkWriter struct {
+	w io.Writer
+}
+
+func (c *pngChunkWriter) Write(data []byte) (int, error) {
+	if err := writePNGChunk(c.w, "IDAT", data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// writePNGChunk writes a chunk of a PNG image: its length, type, data, and checksum.
+func writePNGChunk(w io.Writer, chunkType string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	copy(header[4:8], chunkType)
+
+	checksum := crc32.NewIEEE()
+	checksum.Write(header[4:8])
+	checksum.Write(data)
+
+	for _, part := range [][]byte{header, data, checksum.Sum(nil)} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawModules clears img to white, and draws the dark modules of the code onto it,
+// as squares modulePixels wide, starting at offsetX, and offsetY.
+// Pixels are written directly, rows of the same module are copied, as codes are drawn at hundreds of pixels per module.
+func drawModules(img *image.Gray, code barcode.Barcode, modulePixels int, offsetX int, offsetY int) {
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	bounds := code.Bounds()
+	for y := 0; y < bounds.Dy(); y++ {
+		top := img.PixOffset(offsetX, offsetY+y*modulePixels)
+		row := img.Pix[top : top+bounds.Dx()*modulePixels]
+		for x := 0; x < bounds.Dx(); x++ {
+			if !core.Dark(code.At(bounds.Min.X+x, bounds.Min.Y+y)) {
+				continue
+			}
+
+			module := row[x*modulePixels : (x+1)*modulePixels]
+			for i := range module {
+				module[i] = 0
+			}
+		}
+
+		for dy := 1; dy < modulePixels; dy++ {
+			copy(img.Pix[top+dy*img.Stride:], row)
+		}
+	}
+}
+
+// Code2DPNG renders a code as a PNG image, see Code2DImage.
+func Code2DPNG(code barcode.Barcode, size int) ([]byte, error) {
+	img, err := Code2DImage(code, size)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Code2DSVG renders a code, surrounded by its quiet zone, as an SVG image `size` pixels wide.
+// Modules are drawn as a single path, in units of modules, so the image scales without loss.
+func Code2DSVG(code barcode.Barcode, size int) []byte {
+	modules := codeImageModules(code)
+	bounds := code.Bounds()
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", size, size, modules, modules)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", modules, modules)
+	buf.WriteString(`<path fill="#000" d="`)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		// consecutive dark modules of a row are drawn as one rectangle
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !core.Dark(code.At(x, y)) {
+				continue
+			}
+
+			run := 1
+			for x+run < bounds.Max.X && core.Dark(code.At(x+run, y)) {
+				run++
+			}
+
+			fmt.Fprintf(buf, "M%d %dh%dv1h-%dz", x-bounds.Min.X+Code2DQuietZone, y-bounds.Min.Y+Code2DQuietZone, run, run)
+			x += run - 1
+		}
+	}
+	buf.WriteString(`"/>` + "\n</svg>\n")
+
+	return buf.Bytes()
+}
+
+// colorCodePNGs encodes a payload as color codes, and renders them as PNG images.
+// It returns the images and their printed sizes in mm.
+func colorCodePNGs(payload []byte, opts core.Code2DOptions) ([]*bytes.Buffer, []float64, error) {
+	codes, err := core.EncodeColorCodes(payload, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	images := make([]*bytes.Buffer, 0, len(codes))
+	sizes := make([]float64, 0, len(codes))
+	for _, code := range codes {
+		size, pixels := opts.PrintSize(code.Modules())
+		if opts.ModuleSize == 0 {
+			// color printers rarely exceed 300 dpi, and RGBA images grow quickly
+			pixels = 1949 // 165 mm at 300 dpi
+		}
+
+		img, err := core.RenderColorCode(code, pixels)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		codePNG := new(bytes.Buffer)
+		if err := png.Encode(codePNG, img); err != nil {
+			return nil, nil, errors.Join(errors.New("error generating color code PNG"), err)
+		}
+
+		images = append(images, codePNG)
+		sizes = append(sizes, size)
+	}
+
+	return images, sizes, nil
+}
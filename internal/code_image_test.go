@@ -0,0 +1,123 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/boombuler/barcode"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestCode2DImage(t *testing.T) {
+	code, err := core.Encode2D([]byte("PaperCrypt"), core.Code2DOptions{Type: core.Code2DTypeQR})
+	if err != nil {
+		t.Fatalf("Encode2D failed with error %s", err)
+	}
+	modules := code.Bounds().Dx() + 2*Code2DQuietZone
+
+	t.Run("png", func(t *testing.T) {
+		data, err := Code2DPNG(code, 1000)
+		if err != nil {
+			t.Fatalf("Code2DPNG failed with error %s", err)
+		}
+
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("png.Decode failed with error %s", err)
+		}
+
+		modulePixels := 1000 / modules
+		if img.Bounds().Dx() != modules*modulePixels {
+			t.Errorf("got: %d pixels, want: %d pixels.", img.Bounds().Dx(), modules*modulePixels)
+		}
+		if core.Dark(img.At(0, 0)) {
+			t.Errorf("The quiet zone should be white")
+		}
+		// the top left corner of the code is part of a finder pattern
+		if !core.Dark(img.At(Code2DQuietZone*modulePixels, Code2DQuietZone*modulePixels)) {
+			t.Errorf("The finder pattern should be dark")
+		}
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		svg := string(Code2DSVG(code, 500))
+		want := `width="500" height="500" viewBox="0 0 ` + fmt.Sprint(modules)
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG does not contain %s", want)
+		}
+		// the first row starts with the 7 modules of the finder pattern
+		if !strings.Contains(svg, `d="M4 4h7v1h-7z`) {
+			t.Errorf("SVG does not start with the finder pattern")
+		}
+	})
+
+	t.Run("too small", func(t *testing.T) {
+		if _, err := Code2DImage(code, modules-1); err == nil {
+			t.Errorf("Code2DImage should fail for images smaller than the code")
+		}
+	})
+}
+
+func TestWriteScaledCodePNG(t *testing.T) {
+	for _, codeType := range []core.Code2DType{core.Code2DTypeQR, core.Code2DTypeAztec} {
+		code, err := core.Encode2D([]byte("PaperCrypt"), core.Code2DOptions{Type: codeType})
+		if err != nil {
+			t.Fatalf("Encode2D failed with error %s", err)
+		}
+
+		for _, pixels := range []int{code.Bounds().Dx(), 301, 640} {
+			want, err := barcode.Scale(code, pixels, pixels)
+			if err != nil {
+				t.Fatalf("barcode.Scale failed with error %s", err)
+			}
+
+			buf := new(bytes.Buffer)
+			if err := writeScaledCodePNG(buf, code, pixels); err != nil {
+				t.Fatalf("writeScaledCodePNG failed with error %s", err)
+			}
+			img, err := png.Decode(buf)
+			if err != nil {
+				t.Fatalf("png.Decode failed with error %s", err)
+			}
+			if img.Bounds() != want.Bounds() {
+				t.Fatalf("writeScaledCodePNG was incorrect, got: %v, want: %v.", img.Bounds(), want.Bounds())
+			}
+			for y := 0; y < pixels; y++ {
+				for x := 0; x < pixels; x++ {
+					if got, want := img.At(x, y), color.GrayModel.Convert(want.At(x, y)); got != want {
+						t.Fatalf("writeScaledCodePNG (%s, %d pixels) was incorrect at %d, %d, got: %v, want: %v.", codeType, pixels, x, y, got, want)
+					}
+				}
+			}
+		}
+
+		if err := writeScaledCodePNG(io.Discard, code, code.Bounds().Dx()-1); err == nil {
+			t.Errorf("writeScaledCodePNG should fail for images smaller than the code")
+		}
+	}
+}
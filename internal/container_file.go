@@ -22,30 +22,22 @@ package internal
 
 import (
 	"bytes"
-	"compress/gzip"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"hash/crc32"
-	"image"
 	"image/png"
-	"strings"
+	"io"
+	"os"
+	"path/filepath"
 	"time"
 
-	"github.com/ProtonMail/gopenpgp/v2/crypto"
-	"github.com/boombuler/barcode"
-	"github.com/boombuler/barcode/aztec"
 	"github.com/boombuler/barcode/qr"
-	"github.com/caarlos0/log"
 	"github.com/jung-kurt/gofpdf/v2"
 	"github.com/makiuchi-d/gozxing"
 	"github.com/makiuchi-d/gozxing/datamatrix"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 const (
-	BytesPerLine        = 24
 	PdfTextFont         = "Text"
 	PdfMonoFont         = "Mono"
 	PdfDataLineFontSize = 11
@@ -65,148 +57,158 @@ var (
 	PdfMonoFontItalicBytes  []byte
 )
 
+// LoadFontFiles reads the fonts of PDF documents from the font directory of the repository,
+// for builds without the main package, which embeds them, such as tests.
+func LoadFontFiles(dir string) error {
+	fonts := map[*[]byte]string{
+		&PdfTextFontRegularBytes: "Noto_Sans/NotoSans-Regular.ttf",
+		&PdfTextFontBoldBytes:    "Noto_Sans/NotoSans-Bold.ttf",
+		&PdfTextFontItalicBytes:  "Noto_Sans/NotoSans-Italic.ttf",
+		&PdfMonoFontRegularBytes: "Inconsolata/static/Inconsolata-Medium.ttf",
+		&PdfMonoFontBoldBytes:    "Inconsolata/static/Inconsolata-ExtraBold.ttf",
+		&PdfMonoFontItalicBytes:  "Inconsolata/Inconsolata-VariableFont_wdth,wght.ttf",
+	}
+	for font, path := range fonts {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			return errors.Join(errors.New("error reading font"), err)
+		}
+		*font = data
+	}
+
+	return nil
+}
+
 const (
-	HeaderFieldVersion              = "PaperCrypt Version"
-	HeaderFieldSerial               = "Content Serial"
-	HeaderFieldPurpose              = "Purpose"
-	HeaderFieldComment              = "Comment"
-	HeaderFieldDate                 = "Date"
-	HeaderFieldDataFormat           = "Data Format"
-	HeaderFieldContentLength        = "Content Length"
-	HeaderFieldCRC24                = "Content CRC-24"
-	HeaderFieldCRC32                = "Content CRC-32"
-	HeaderFieldSHA256               = "Content SHA-256"
-	HeaderFieldHeaderCRC32          = "Header CRC-32"
-	PDFHeaderSheetID                = "Sheet ID"
-	PDFHeading                      = "PaperCrypt Recovery Sheet"
-	PDFSectionDescriptionHeading    = "What is this?"
-	PDFSectionDescriptionContent    = "This is a PaperCrypt recovery sheet. It contains encrypted data, its own creation date, purpose, and a comment, as well as an identifier. This sheet is intended to help recover the original information, in case it is lost or destroyed."
-	PDFSectionRepresentationHeading = "Binary Data Representation"
-	PDFSectionRepresentationContent = "Data is written as base 16 (hexadecimal) digits, each representing a half-byte. Two half-bytes are grouped together as a byte, which are then grouped together in lines of %d bytes, where bytes are separated by a space. Each line begins with its line number and a colon, denoting its position and the beginning of the data. Each line is then followed by its CRC-24 checksum. The last line holds the checksum of the entire block. For the checksum algorithm, the polynomial mask %#x and initial value %#x are used. Data is compressed using the gzip algorithm."
-	PDFSectionRecoveryHeading       = "Recovering the data"
-	PDFSectionRecoveryContent       = "Firstly, scan the 2D code, or copy (i.e. type in, or use OCR on) the encrypted data into a computer. Then decrypt it, either using the PaperCrypt CLI, or manually construct the data into a binary file, and decrypt it using OpenPGP-compatible software."
-	PDFSectionRecoveryContentNo2D   = "Firstly, copy (i.e. type in, or use OCR on) the encrypted data into a computer. Then decrypt it, either using the PaperCrypt CLI, or manually construct the data into a binary file, and decrypt it using OpenPGP-compatible software."
+	PDFHeaderSheetID                     = "Sheet ID"
+	PDFHeading                           = "PaperCrypt Recovery Sheet"
+	PDFSectionDescriptionHeading         = "What is this?"
+	PDFSectionDescriptionContent         = "This is a PaperCrypt recovery sheet. It contains encrypted data, its own creation date, purpose, and a comment, as well as an identifier. This sheet is intended to help recover the original information, in case it is lost or destroyed."
+	PDFSectionRepresentationHeading      = "Binary Data Representation"
+	PDFSectionRepresentationContent      = "Data is written as base 16 (hexadecimal) digits, each representing a half-byte. Two half-bytes are grouped together as a byte, which are then grouped together in lines of %d bytes, where bytes are separated by a space. Each line begins with its line number and a colon, denoting its position and the beginning of the data. Each line is then followed by its CRC-24 checksum. The last line holds the checksum of the entire block. For the checksum algorithm, the polynomial mask %#x and initial value %#x are used. Data is compressed using the gzip algorithm."
+	PDFSectionRepresentationBase32       = "Data is written as base 32 digits, using Crockford's alphabet (0-9 and A-Z, without I, L, O, and U), each representing five bits. The bytes of a line are encoded together, and the digits are written in groups of four, separated by a space. Lines hold %d bytes each. Each line begins with its line number and a colon, denoting its position and the beginning of the data. Each line is then followed by its CRC-24 checksum, written as base 16 (hexadecimal) digits. The last line holds the checksum of the entire block. For the checksum algorithm, the polynomial mask %#x and initial value %#x are used. Data is compressed using the gzip algorithm."
+	PDFSectionRepresentationBase64       = "Data is written as base 64 digits (A-Z, a-z, 0-9, + and /, padded with =), each representing six bits. Letters are case-sensitive. The bytes of a line are encoded together, and the digits are written in groups of eight, separated by a space. Lines hold %d bytes each. Each line begins with its line number and a colon, denoting its position and the beginning of the data. Each line is then followed by its CRC-24 checksum, written as base 16 (hexadecimal) digits. The last line holds the checksum of the entire block. For the checksum algorithm, the polynomial mask %#x and initial value %#x are used. Data is compressed using the gzip algorithm."
+	PDFSectionRepresentationArmor        = "Data is written as an ASCII armor block, as defined by OpenPGP (RFC 4880): base 64 digits, followed by a line starting with =, holding the CRC-24 checksum of the data (polynomial mask %[2]#x, initial value %[3]#x). Letters are case-sensitive. Data is compressed using the gzip algorithm."
+	PDFSectionRepresentationWords        = "Data is written as words of the PGP word list, each representing a byte, so it can be read aloud. Words at even positions are taken from the list of two-syllable words, words at odd positions from the list of three-syllable words. The first word holds the data format. Each line holds up to %d words of data, followed by a checksum word, holding the lowest byte of the CRC-24 checksum of the line number (as four bytes) and the line's data. The last line holds the CRC-24 checksum of all data. For the checksum algorithm, the polynomial mask %#x and initial value %#x are used. Data is compressed using the gzip algorithm."
+	PDFSectionRepresentationLayout       = "The layout of the data block (the number of bytes per group, groups per line, lines per block, and whether line and column numbers are printed) is noted in the header, as `%s`. Lines of column numbers are labelled with #, and are not part of the data."
+	PDFSectionRepresentationChecksum     = "Instead of CRC-24, the lines and the block are checked using %s (truncated to four bytes, if longer), as noted in the header as `%s`."
+	PDFSectionRepresentationParity       = "The data block is followed by %d parity lines (numbered P1, P2, ...), computed using a Reed-Solomon code across the lines, as noted in the header as `%s`. If lines are damaged or missing, PaperCrypt can reconstruct them, as long as no more lines are lost than there are parity lines, so do not retype lines that cannot be read."
+	PDFSectionRepresentationStamping     = "The data block is laid out for letter-punching onto a metal plate: one character per cell, using only digits and upper case letters (and a colon after each line number). Transfer each line as shown, keeping the line numbers and the spaces between groups."
+	PDFSectionRecoveryHeading            = "Recovering the data"
+	PDFSectionRecoveryContent            = "Firstly, scan the 2D code, or copy (i.e. type in, or use OCR on) the encrypted data into a computer. Then decrypt it, either using the PaperCrypt CLI, or manually construct the data into a binary file, and decrypt it using OpenPGP-compatible software."
+	PDFSectionRecoveryContentNo2D        = "Firstly, copy (i.e. type in, or use OCR on) the encrypted data into a computer. Then decrypt it, either using the PaperCrypt CLI, or manually construct the data into a binary file, and decrypt it using OpenPGP-compatible software."
+	PDFSectionRecoveryContentParts       = "The data is too large for a single 2D code, it is split into %d codes, the first on this page, and the others on pages of their own. Scan all of them, in any order."
+	PDFSectionRecoveryContentPartsDuplex = "The data is too large for a single 2D code, it is split into %d codes, the first on the front page, and the others on pages of their own, following the data. Scan all of them, in any order."
+	PDFSectionRecoveryContentColor       = "The 2D code is an experimental color code, made up of three QR codes printed in cyan, magenta, and yellow. Scan it in color, and read it with `papercrypt scan --color`."
+	PDFCodePartCaption                   = "2D code %d of %d"
+	PDFPageCaption                       = "Page %d/{nb}"
+	PDFBlankPageNote                     = "This page is intentionally left blank."
+	PDFSectionReadBackHeading            = "Read-back phrase"
+	PDFSectionChecksumHeading            = "Document checksums"
+	PDFSectionContactHeading             = "Contact"
+	PDFSectionChecksumContent            = "The SHA-256 checksum of the encrypted content is printed below, and noted in the header as `%s`. PaperCrypt verifies it when decoding, and refuses to continue if the content does not match, so transcription errors can not go unnoticed."
+	PDFSectionChecksumPlaintext          = "The second checksum is that of the decrypted data, noted in the header as `%s`, and verified after decryption."
+	PDFSectionReadBackContent            = "The following words encode the beginning of the content's SHA-256 checksum using the PGP word list. PaperCrypt displays the same phrase when decoding the document, so it can be read aloud to confirm that the right document was restored:"
 )
 
-var (
-	errorParsingHeader     = errors.New("error parsing header")
-	errorParsingBody       = errors.New("error parsing body")
-	errorValidationFailure = errors.New("validation failure")
-)
+// TextOptions control how the text representation of a document is written.
+type TextOptions struct {
+	// LowerCase writes the encoded data and its checksums using lower case letters.
+	LowerCase bool
 
-type PaperCrypt struct {
-	// Version is the version of papercrypt used to generate the document.
-	Version string `json:"v"`
+	// Encoding is the encoding of the data block.
+	Encoding core.PaperCryptDataEncoding
 
-	// DataFormat determines whether the data is raw (although still gzipped), or follows the PGP message format (gzipped).
-	DataFormat PaperCryptDataFormat `json:"f"`
+	// Layout is the layout of the data block, DefaultDataLayout is used if unset.
+	// It does not apply to the armor and words encodings.
+	Layout core.DataLayout
 
-	// SerialNumber is the serial number of document, used to identify it. It is generated randomly if not provided.
-	SerialNumber string `json:"sn"`
+	// LineChecksum is the checksum algorithm of the lines of the data block, and the block itself.
+	// It does not apply to the armor and words encodings.
+	LineChecksum core.LineChecksum
 
-	// Purpose is the purpose of document
-	Purpose string `json:"p"`
+	// ErrorCorrectionLevel is the amount of parity lines appended to the data block, in percent of its lines,
+	// 0 disables error correction. It does not apply to the armor and words encodings.
+	ErrorCorrectionLevel int
 
-	// Comment is the comment on document
-	Comment string `json:"cm"`
+	// QRPayload is the serialization of the document inside its 2D code.
+	QRPayload core.QRPayloadFormat
 
-	// CreatedAt is the creation timestamp
-	CreatedAt time.Time `json:"ct"`
+	// Code2D controls the 2D code holding the document, an Aztec code by default.
+	Code2D core.Code2DOptions
 
-	// DataCRC24 is the CRC-24 checksum of the encrypted data
-	DataCRC24 uint32 `json:"d_c24"`
+	// Profile is the output profile the options were prepared by, see OutputProfile.Apply.
+	// The stamping profile draws the data block as a grid of large cells.
+	Profile OutputProfile
 
-	// DataCRC32 is the CRC-32 checksum of the encrypted data
-	DataCRC32 uint32 `json:"d_c32"`
+	// NoFiducials omits the markers printed in the corners of each page, see Page.Fiducials.
+	NoFiducials bool
 
-	// DataSHA256 is the SHA-256 checksum of the encrypted data
-	DataSHA256 [32]byte `json:"d_s256"`
+	// Page is the size and orientation of the pages of the PDF document, A4 portrait by default.
+	Page core.Page
 
-	// Data is the contents of the document
-	// it can be either of two formats:
-	//   a) ASCII armored OpenPGP data, if DataFormat is PGP
-	//      the contained message is gzipped before encryption
-	//   b) Raw data of any kind, if DataFormat is Raw
-	// either way, data is always gzipped after processing
-	Data []byte `json:"d"`
-}
+	// Template customizes the PDF document, nil keeps the default layout.
+	Template *PDFTemplate
 
-func (p *PaperCrypt) MarshalJSON() ([]byte, error) { // nosemgrep
-	type Alias PaperCrypt
-	return json.Marshal(&struct {
-		CreatedAt  string `json:"ct"`
-		DataSHA256 string `json:"d_s256"`
-		*Alias
-	}{
-		CreatedAt:  p.CreatedAt.Format(TimeStampFormatLong),
-		DataSHA256: base64.StdEncoding.EncodeToString(p.DataSHA256[:]),
-		Alias:      (*Alias)(p),
-	})
-}
+	// DataFont is a TrueType font the header and data lines are printed in, see LoadTrueTypeFont.
+	// The built-in monospace font is used if nil.
+	DataFont []byte
 
-func (p *PaperCrypt) UnmarshalJSON(data []byte) error {
-	type Alias PaperCrypt
-	aux := &struct {
-		CreatedAt  string `json:"ct"`
-		DataSHA256 string `json:"d_s256"`
-		*Alias
-	}{
-		Alias: (*Alias)(p),
-	}
+	// DataFontSize is the font size of the header and data lines, in pt, PdfDataLineFontSize if 0.
+	DataFontSize float64
 
-	if err := json.Unmarshal(data, &aux); err != nil {
-		return err
-	}
+	// Watermark is printed in large, light grey letters diagonally across each page, if set.
+	Watermark string
 
-	createdAt, err := time.Parse(TimeStampFormatLong, aux.CreatedAt)
-	if err != nil {
-		return err
-	}
-	p.CreatedAt = createdAt
+	// Banner is printed as a classification banner at the top and bottom of each page, if set.
+	Banner string
 
-	dataSHA256, err := BytesFromBase64(aux.DataSHA256)
-	if err != nil {
-		return err
-	}
-	copy(p.DataSHA256[:], dataSHA256)
+	// Instructions appends a page explaining how to restore the document without PaperCrypt,
+	// see RecoveryInstructions.
+	Instructions bool
 
-	return nil
-}
+	// PDFA writes a PDF/A-2b document for archival, see ConvertToPDFA.
+	PDFA bool
 
-// NewPaperCrypt creates a new paper crypt.
-func NewPaperCrypt(version string, data []byte, serialNumber string, purpose string, comment string, createdAt time.Time, format PaperCryptDataFormat) *PaperCrypt {
-	dataCRC24 := Crc24Checksum(data)
-	dataCRC32 := crc32.ChecksumIEEE(data)
-	dataSHA256 := sha256.Sum256(data)
-
-	return &PaperCrypt{
-		Version:      version,
-		Data:         data,
-		SerialNumber: serialNumber,
-		Purpose:      purpose,
-		Comment:      comment,
-		CreatedAt:    createdAt,
-		DataCRC24:    dataCRC24,
-		DataCRC32:    dataCRC32,
-		DataSHA256:   dataSHA256,
-		DataFormat:   format,
-	}
+	// Duplex lays the document out for printing on both sides of the paper, see Duplex.
+	Duplex Duplex
+
+	// NoAttachment omits the JSON serialized document attached to the PDF document, see ExtractPDFAttachment.
+	NoAttachment bool
+
+	// Language translates the text printed on the document, English if nil.
+	Language *Language
 }
 
-func (p *PaperCrypt) GetBinarySerialized() (string, error) {
-	if p.Data == nil {
-		return "", errors.New("no data to serialize")
+// dataFontSize returns the font size of the header and data lines, in pt.
+func (o TextOptions) dataFontSize() float64 {
+	if o.DataFontSize == 0 {
+		return PdfDataLineFontSize
 	}
 
-	if len(p.Data) == 0 {
-		return "", errors.New("no data to serialize")
+	return o.DataFontSize
+}
+
+// EncodingOptions returns the options the data block is written with, see PaperCrypt.GetText.
+func (o TextOptions) EncodingOptions() core.EncodingOptions {
+	return core.EncodingOptions{
+		LowerCase:            o.LowerCase,
+		Encoding:             o.Encoding,
+		Layout:               o.Layout,
+		LineChecksum:         o.LineChecksum,
+		ErrorCorrectionLevel: o.ErrorCorrectionLevel,
 	}
+}
 
-	return SerializeBinaryV2(&p.Data), nil
+// DataLayout returns the layout of the data block.
+func (o TextOptions) DataLayout() core.DataLayout {
+	return o.EncodingOptions().DataLayout()
 }
 
-func (p *PaperCrypt) GetDataLength() int {
-	return len(p.Data)
+// ErrorCorrection returns the error correction of a data block of `dataLength` bytes.
+// ok is false if error correction is disabled.
+func (o TextOptions) ErrorCorrection(dataLength int) (ecc core.ErrorCorrection, ok bool, err error) {
+	return o.EncodingOptions().ErrorCorrection(dataLength)
 }
 
 // GetPDF returns the binary representation of the paper crypt
@@ -216,7 +218,7 @@ func (p *PaperCrypt) GetDataLength() int {
 // The data will be formatted as
 //
 //	a) ASCII armored OpenPGP data, if --armor is specified
-//	b) Base16 (hex) encoded binary data, if --armor is not specified
+//	b) Binary data encoded as set in opts (base16 by default), if --armor is not specified
 //
 // The PDF Document will have a header row, containing the following information:
 //   - Serial Number
@@ -224,80 +226,111 @@ func (p *PaperCrypt) GetDataLength() int {
 //   - Purpose
 //
 // and, next to the markdown information, a 2D code containing the encrypted data.
-func (p *PaperCrypt) GetPDF(no2D bool, lowerCaseEncoding bool) ([]byte, error) {
-	text, err := p.GetText(lowerCaseEncoding)
-	if err != nil {
-		return nil, fmt.Errorf("error getting text content: %s", err)
+func GetPDF(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := WritePDF(p, &buf, no2D, opts); err != nil {
+		return nil, err
 	}
 
-	// split at 2 empty lines, to get the header and the data
-	parts := strings.Split(string(text), "\n\n\n")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("error splitting text content into header and data")
+	return buf.Bytes(), nil
+}
+
+// WritePDF writes the PDF document of GetPDF to w, returning its number of pages.
+// The document is laid out with placeholders for its 2D codes, and written an object at a time,
+// each code is encoded as its image is written (see writeStreamedPDF), so documents of hundreds of codes
+// need little more memory than their text.
+func WritePDF(p *core.PaperCrypt, w io.Writer, no2D bool, opts TextOptions) (int, error) {
+	if opts.Profile == OutputProfileWallet {
+		doc, err := getWalletPDF(p, no2D, opts)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := w.Write(doc); err != nil {
+			return 0, errors.Join(errors.New("error writing pdf"), err)
+		}
+		return CountPDFPages(doc)
 	}
 
-	productLinkQr := new(bytes.Buffer)
-	if printProductQrCode {
-		qrSize := 709
+	// the payload is encoded into codes once, their images are drawn as the document is written
+	codes, err := newCode2DImageSet(p, no2D, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// every sheet lists the content hashes of all sheets, so documents of several sheets are rendered twice:
+	// first to learn the content of each sheet, then with the hashes in the footer
+	pdf, err := renderPDF(p, no2D, opts, nil, codes)
+	if err != nil {
+		return 0, err
+	}
+	doc, err := outputPDF(pdf)
+	if err != nil {
+		return 0, err
+	}
 
-		code, err := qr.Encode(VersionInfo.URL, qr.M, qr.Auto)
+	sheets, err := sheetHashes(doc, opts.Duplex)
+	if err != nil {
+		return 0, err
+	}
+	if len(sheets) > 1 {
+		pdf, err = renderPDF(p, no2D, opts, sheets, codes)
 		if err != nil {
-			return nil, errors.Join(errors.New("error generating 2D code"), err)
+			return 0, err
 		}
-
-		code, err = barcode.Scale(code, qrSize, qrSize)
+		doc, err = outputPDF(pdf)
 		if err != nil {
-			return nil, errors.Join(errors.New("error scaling 2D code"), err)
+			return 0, err
 		}
+	}
 
-		converted := image.NewGray(code.Bounds())
-		for y := 0; y < code.Bounds().Dy(); y++ {
-			for x := 0; x < code.Bounds().Dx(); x++ {
-				converted.Set(x, y, code.At(x, y))
-			}
-		}
+	doc, err = finishPDF(doc, opts)
+	if err != nil {
+		return 0, err
+	}
+	pages, err := CountPDFPages(doc)
+	if err != nil {
+		return 0, errors.Join(errors.New("error reading the generated pdf"), err)
+	}
 
-		err = png.Encode(productLinkQr, converted)
-		if err != nil {
-			return nil, errors.Join(errors.New("error generating 2D code PNG"), err)
-		}
+	if codes.streamed() && codes.Len() > 0 {
+		return pages, writeStreamedPDF(w, doc, codes)
+	}
+	if _, err := w.Write(doc); err != nil {
+		return 0, errors.Join(errors.New("error writing pdf"), err)
 	}
 
-	data2D := new(bytes.Buffer)
-	dm := new(bytes.Buffer)
+	return pages, nil
+}
 
-	if !no2D {
-		// for the qr-code, encode the *p as json, then base64 encode it
-		qrDataJSON, err := json.Marshal(p)
-		if err != nil {
-			return nil, errors.Join(errors.New("error marshalling PaperCrypt to JSON"), err)
-		}
+// renderPDF lays out the document, with the content hashes of its sheets in the footer, if given,
+// and its 2D codes.
+func renderPDF(p *core.PaperCrypt, no2D bool, opts TextOptions, sheets []string, codes *code2DImageSet) (*gofpdf.Fpdf, error) {
+	text, err := p.GetText(opts.EncodingOptions())
+	if err != nil {
+		return nil, fmt.Errorf("error getting text content: %s", err)
+	}
 
-		// qrSize := 1949 // 165 mm at 300 dpi
-		qrSize := 7795 // 165 mm at 1200 dpi
-		code, err := aztec.Encode(qrDataJSON, 35, 0)
-		if err != nil {
-			return nil, errors.Join(errors.New("error generating 2D code"), err)
-		}
+	headerLines, dataLines, err := splitDocumentText(text)
+	if err != nil {
+		return nil, err
+	}
 
-		code, err = barcode.Scale(code, qrSize, qrSize)
-		if err != nil {
-			return nil, errors.Join(errors.New("error scaling 2D code"), err)
-		}
+	productLinkQr := new(bytes.Buffer)
+	if printProductQrCode {
+		qrSize := 709
 
-		converted := image.NewGray(code.Bounds())
-		for y := 0; y < code.Bounds().Dy(); y++ {
-			for x := 0; x < code.Bounds().Dx(); x++ {
-				converted.Set(x, y, code.At(x, y))
-			}
+		code, err := qr.Encode(core.VersionInfo.URL, qr.M, qr.Auto)
+		if err != nil {
+			return nil, errors.Join(errors.New("error generating 2D code"), err)
 		}
 
-		err = png.Encode(data2D, converted)
+		err = writeScaledCodePNG(productLinkQr, code, qrSize)
 		if err != nil {
 			return nil, errors.Join(errors.New("error generating 2D code PNG"), err)
 		}
 	}
 
+	dm := new(bytes.Buffer)
 	{
 		// generate a data matrix with the sheet id
 		enc := datamatrix.NewDataMatrixWriter()
@@ -312,471 +345,297 @@ func (p *PaperCrypt) GetPDF(no2D bool, lowerCaseEncoding bool) ([]byte, error) {
 		}
 	}
 
-	pdf := getPdf()
+	pageWidth, _ := opts.Page.Dimensions()
+	margin := opts.Page.Margin()
+
+	pdf := getPdf(opts.Page)
+	if err := attachDocument(p, pdf, opts); err != nil {
+		return nil, err
+	}
+	if opts.Banner != "" {
+		pdf.SetAutoPageBreak(true, 15+pdfBannerHeight)
+	}
 	pdf.SetHeaderFuncMode(func() {
+		if opts.Watermark != "" {
+			// drawn first, so everything else is printed over it
+			drawWatermark(pdf, opts.Page, opts.Watermark)
+		}
+
 		pdf.SetY(5)
 		pdf.SetFont(PdfMonoFont, "", 10)
-		headerLine := fmt.Sprintf("%s: %s - %s", PDFHeaderSheetID, p.SerialNumber, p.CreatedAt.Format(TimeStampFormatPDFHeader))
-		if p.Purpose != "" {
-			headerLine += fmt.Sprintf(" - %s", p.Purpose)
+		pdf.CellFormat(0, 10, headerLine(p, opts), "", 0, "C", false, 0, "")
+
+		if opts.Template != nil && opts.Template.logo != nil {
+			// add the logo in the upper left corner, inside the corner markers
+			pdf.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: opts.Template.logoType}, bytes.NewReader(opts.Template.logo))
+			width, height := opts.Template.logoSize()
+			pdf.ImageOptions("logo", margin, 4, width, height, false, gofpdf.ImageOptions{ImageType: opts.Template.logoType}, 0, "")
 		}
-		pdf.CellFormat(0, 10, headerLine,
-			"", 0, "C", false, 0, "")
 
 		{
 			// add the data matrix code
 			pdf.RegisterImageReader("dm.png", "PNG", dm)
 			imageSize := 5.0
-			pdf.ImageOptions("dm.png", 195, 50, imageSize, imageSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			pdf.ImageOptions("dm.png", pageWidth-15, 50, imageSize, imageSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
 		}
 
 		pdf.Ln(10)
 
+		if opts.Template != nil && opts.Template.Header != "" {
+			pdf.SetFont(PdfTextFont, "", 8)
+			pdf.CellFormat(0, 4, opts.Template.Header, "", 1, "C", false, 0, "")
+		}
+
+		if opts.Banner != "" {
+			drawBanner(pdf, opts.Page, opts.Banner, pdf.GetY())
+			pdf.Ln(pdfBannerHeight)
+		}
+
 		if printProductQrCode {
 			// add product qr code in upper left corner
 			pdf.RegisterImageReader("product_link_qr.png", "PNG", productLinkQr)
 			imageSize := 15.0
-			pdf.ImageOptions("product_link_qr.png", 186, 11, imageSize, imageSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			pdf.ImageOptions("product_link_qr.png", pageWidth-24, 11, imageSize, imageSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+		}
+
+		if !opts.NoFiducials {
+			// corner markers, so scans and photos of the page can be straightened
+			drawFiducials(pdf, opts.Page)
 		}
 	}, true)
 	pdf.SetFooterFunc(func() {
-		pdf.SetY(-15)
-		pdf.SetFont(PdfMonoFont, "", 10)
-		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d/{nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
-	})
-	pdf.AddPage()
-
-	{
-		// Info text
-		pdf.SetFont(PdfTextFont, "B", 16)
-		pdf.CellFormat(0, 10, PDFHeading, "", 0, "C", false, 0, "")
-		pdf.Ln(10)
-
-		pdf.SetFont(PdfTextFont, "B", 10)
-		pdf.CellFormat(0, 5, PDFSectionDescriptionHeading, "", 0, "L", false, 0, "")
-		pdf.Ln(5)
-
-		pdf.SetFont(PdfTextFont, "", 10)
-		pdf.MultiCell(0, 5, PDFSectionDescriptionContent, "", "", false)
-		pdf.Ln(5)
-
-		pdf.SetFont(PdfTextFont, "B", 10)
-		pdf.CellFormat(0, 5, PDFSectionRepresentationHeading, "", 0, "L", false, 0, "")
-		pdf.Ln(5)
-
-		pdf.SetFont(PdfTextFont, "", 10)
-		pdf.MultiCell(0, 5, fmt.Sprintf(PDFSectionRepresentationContent, BytesPerLine, CRC24Polynomial, CRC24Initial), "", "", false)
-		pdf.Ln(5)
-
-		pdf.SetFont(PdfTextFont, "B", 10)
-		pdf.CellFormat(0, 5, PDFSectionRecoveryHeading, "", 0, "L", false, 0, "")
-		pdf.Ln(5)
-
-		pdf.SetFont(PdfTextFont, "", 10)
-		recoverInstruction := PDFSectionRecoveryContent
-		if no2D {
-			recoverInstruction = PDFSectionRecoveryContentNo2D
+		if opts.Banner != "" {
+			drawBanner(pdf, opts.Page, opts.Banner, -15-pdfBannerHeight)
 		}
-		pdf.MultiCell(0, 5, recoverInstruction, "", "", false)
-	}
-
-	// add the qr code
-	if !no2D {
-		pdf.RegisterImageReader("data2D.png", "PNG", data2D)
-		imageSize := 167.0
-		pdf.ImageOptions("data2D.png", 21, 5, imageSize, imageSize, true, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
-		pdf.Ln(50)
-	}
-
-	pdf.AddPage()
-	// print header lines
-	pdf.SetFont(PdfMonoFont, "B", PdfDataLineFontSize)
-	for _, line := range strings.Split(parts[0], "\n") {
-		pdf.Cell(0, 5, "# "+line)
-		pdf.Ln(5)
-	}
-	pdf.Ln(10)
 
-	// print data lines
-	dataLines := strings.Split(parts[1], "\n")
-
-	// cut empty lines (should be one at the end)
-	filtered := dataLines[:0]
-	for _, line := range dataLines {
-		if line != "" {
-			filtered = append(filtered, line)
+		if opts.Template != nil && opts.Template.Footer != "" {
+			pdf.SetY(-15)
+			pdf.SetFont(PdfTextFont, "", 8)
+			pdf.CellFormat(0, 10, opts.Template.Footer, "", 0, "L", false, 0, "")
 		}
-	}
 
-	pdf.SetFont(PdfMonoFont, "B", PdfDataLineFontSize)
-	for n, line := range filtered {
-		// mark every second line with a grey background
-		if n%2 == 0 {
-			pdf.SetFillColor(240, 240, 240)
-			pdf.Rect(20, pdf.GetY(), 166, 5, "F")
+		pdf.SetY(-15)
+		pdf.SetFont(PdfMonoFont, "", 10)
+		if sheets == nil {
+			pdf.CellFormat(0, 10, opts.Language.Sprintf(PDFPageCaption, pdf.PageNo()), "", 0, "R", false, 0, "")
+		} else {
+			sheet := sheetOfPage(pdf.PageNo(), opts.Duplex)
+			pdf.CellFormat(0, 10, sheetCaption(opts.Language, pdf.PageNo(), len(sheets), opts.Duplex), "", 0, "R", false, 0, "")
+			drawSheetHashes(pdf, opts, p.SerialNumber, sheets, sheet)
 		}
+	})
 
-		pdf.Cell(0, 5, line)
-		pdf.Ln(5)
-	}
-
-	pdf.Close()
-
-	var buf bytes.Buffer
-	err = pdf.Output(&buf)
-	if err != nil {
-		return nil, errors.Join(errors.New("error generating pdf"), err)
-	}
-
-	return buf.Bytes(), nil
-}
-
-// GetText returns the text representation of the paper crypt.
-func (p *PaperCrypt) GetText(lowerCaseEncoding bool) ([]byte, error) {
-	header := fmt.Sprintf(
-		`%s: %s
-%s: %s
-%s: %s
-%s: %s
-%s: %s
-%s: %s
-%s: %d
-%s: %06x
-%s: %08x
-%s: %s`,
-		HeaderFieldVersion,
-		p.Version,
-		HeaderFieldSerial,
-		p.SerialNumber,
-		HeaderFieldPurpose,
-		p.Purpose,
-		HeaderFieldComment,
-		p.Comment,
-		HeaderFieldDate,
-		// format time with nanosecond precision
-		// Sat, 12 Aug 2023 17:33:20.123456789
-		p.CreatedAt.Format(TimeStampFormatLong),
-		HeaderFieldDataFormat,
-		p.DataFormat,
-		HeaderFieldContentLength,
-		p.GetDataLength(),
-		HeaderFieldCRC24,
-		p.DataCRC24,
-		HeaderFieldCRC32,
-		p.DataCRC32,
-		HeaderFieldSHA256,
-		base64.StdEncoding.EncodeToString(p.DataSHA256[:]))
-
-	headerCRC32 := crc32.ChecksumIEEE([]byte(header))
-
-	serializedData, err := p.GetBinarySerialized()
-	if err != nil {
-		return nil, errors.Join(errors.New("failed to get serialized data"), err)
-	}
-	if lowerCaseEncoding {
-		serializedData = strings.ToLower(serializedData)
-	}
-
-	return []byte(
-		fmt.Sprintf(`%s
-%s: %08x
-
-
-%s
-`,
-			header,
-			HeaderFieldHeaderCRC32,
-			headerCRC32,
-			serializedData)), nil
-}
-
-func getPdf() *gofpdf.Fpdf {
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.SetCreator("PaperCrypt/"+VersionInfo.GitVersion, true)
-	pdf.SetTextRenderingMode(4)
-	pdf.SetTopMargin(20)
-	pdf.SetLeftMargin(20)
-	pdf.SetRightMargin(20)
-	pdf.SetAutoPageBreak(true, 15)
-	pdf.AliasNbPages("")
-
-	pdf.AddUTF8FontFromBytes(PdfTextFont, "", PdfTextFontRegularBytes)
-	pdf.AddUTF8FontFromBytes(PdfTextFont, "B", PdfTextFontBoldBytes)
-	pdf.AddUTF8FontFromBytes(PdfTextFont, "I", PdfTextFontItalicBytes)
-
-	pdf.AddUTF8FontFromBytes(PdfMonoFont, "", PdfMonoFontRegularBytes)
-	pdf.AddUTF8FontFromBytes(PdfMonoFont, "B", PdfMonoFontBoldBytes)
-	pdf.AddUTF8FontFromBytes(PdfMonoFont, "I", PdfMonoFontItalicBytes)
+	writeSections := func() {
+		// the sections are printed in the order of the template, separated by an empty line
+		for i, section := range documentSections(p, no2D, codes.Len(), opts) {
+			if i > 0 {
+				pdf.Ln(5)
+			}
 
-	return pdf
-}
+			pdf.SetFont(PdfTextFont, "B", 10)
+			pdf.CellFormat(0, 5, section.Heading, "", 0, "L", false, 0, "")
+			pdf.Ln(5)
 
-func newFieldNotPresentError(field string) error {
-	return fmt.Errorf("`%s` not present in header", field)
-}
+			pdf.SetFont(PdfTextFont, "", 10)
+			for _, paragraph := range section.Paragraphs {
+				pdf.MultiCell(0, 5, paragraph, "", "", false)
+			}
 
-func (p *PaperCrypt) Decode(passphrase []byte) ([]byte, error) {
-	data := p.Data
-	if p.DataFormat == PaperCryptDataFormatPGP {
-		// 1. Decompress
-		gzipReader, err := gzip.NewReader(bytes.NewReader(p.Data))
-		if err != nil {
-			return nil, errors.Join(errors.New("error creating gzip reader"), err)
+			pdf.SetFont(PdfMonoFont, "B", section.CodeSize)
+			for _, line := range section.Code {
+				pdf.CellFormat(0, section.CodeSize/2+1, line, "", 0, "C", false, 0, "")
+				pdf.Ln(section.CodeSize/2 + 1)
+			}
 		}
+	}
 
-		decompressed := new(bytes.Buffer)
-		if _, err := decompressed.ReadFrom(gzipReader); err != nil {
-			return nil, errors.Join(errors.New("error reading from gzip reader"), err)
-		}
-		if err := gzipReader.Close(); err != nil {
-			return nil, errors.Join(errors.New("error closing gzip reader"), err)
+	// add the qr code, further parts of a split code get a page each
+	writeCode := func(i int) {
+		name := fmt.Sprintf("data2D-%d.png", i+1)
+		var codePNG []byte
+		var err error
+		if codes.streamed() {
+			// the image is encoded as the document is written
+			codePNG, err = pdfCodePlaceholderPNG(i)
+		} else {
+			codePNG, err = codes.PNG(i)
 		}
-
-		pgpMessage := crypto.NewPGPMessage(decompressed.Bytes())
-
-		// 9. Decrypt secretContents
-		decryptedMessage, err := crypto.DecryptMessageWithPassword(pgpMessage, passphrase)
 		if err != nil {
-			return nil, errors.Join(errors.New("error decrypting secret contents"), err)
+			pdf.SetError(err)
+			return
 		}
-
-		data = decryptedMessage.GetBinary()
-	}
-
-	// 10. Decompress content
-	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, errors.Join(errors.New("error creating gzip reader"), err)
-	}
-
-	decompressed := new(bytes.Buffer)
-	if _, err := decompressed.ReadFrom(gzipReader); err != nil {
-		return nil, errors.Join(errors.New("error reading from gzip reader"), err)
-	}
-	if err := gzipReader.Close(); err != nil {
-		return nil, errors.Join(errors.New("error closing gzip reader"), err)
-	}
-
-	return decompressed.Bytes(), nil
-}
-
-func TextToHeaderMap(text []byte) (map[string]string, error) {
-	headers := make(map[string]string)
-
-	headerLines := bytes.Split(text, []byte("\n"))
-	for _, headerLine := range headerLines {
-		headerLineSplit := bytes.SplitN(headerLine, []byte(": "), 2)
-		if len(headerLineSplit) != 2 {
-			return nil, errors.Join(errorParsingHeader, fmt.Errorf("error parsing header line: %s", headerLine))
+		pdf.RegisterImageReader(name, "PNG", bytes.NewReader(codePNG))
+		imageSize := codes.sizes[i]
+		imageX := margin + 1 + (opts.Page.Code2DPrintSize()-imageSize)/2
+		if i == 0 {
+			pdf.ImageOptions(name, imageX, 5, imageSize, imageSize, true, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			pdf.Ln(50)
+			return
 		}
 
-		key := string(headerLineSplit[0])
-		key = strings.TrimPrefix(key, "# ")
-
-		headers[key] = string(headerLineSplit[1])
-	}
-
-	return headers, nil
-}
-
-func SplitTextHeaderAndBody(data []byte) ([]byte, []byte, error) {
-	dataSplit := bytes.SplitN(data, []byte("\n\n\n"), 2)
-	if len(dataSplit) != 2 {
-		return nil, nil, errors.New("header not discernible, header and content should be separated by two empty lines")
-	}
-	return dataSplit[0], dataSplit[1], nil
-}
-
-func DeserializeV2Text(data []byte, ignoreVersionMismatch bool, ignoreChecksumMismatch bool) (*PaperCrypt, error) {
-	paperCryptFileContents := NormalizeLineEndings(data)
-
-	headersSection, bodySection, err := SplitTextHeaderAndBody(paperCryptFileContents)
-	if err != nil {
-		return nil, errors.Join(errorParsingHeader, err)
+		pdf.AddPage()
+		pdf.SetFont(PdfTextFont, "B", 10)
+		pdf.CellFormat(0, 5, opts.Language.Sprintf(PDFCodePartCaption, i+1, codes.Len()), "", 0, "C", false, 0, "")
+		pdf.Ln(5)
+		pdf.ImageOptions(name, imageX, pdf.GetY(), imageSize, imageSize, true, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
 	}
 
-	headers, err := TextToHeaderMap(headersSection)
-	if err != nil {
-		return nil, errors.Join(errorParsingHeader, err)
+	dataFont := PdfMonoFont
+	if opts.DataFont != nil {
+		// a single style is used for both the data, and the column numbers
+		dataFont = PdfDataFont
+		pdf.AddUTF8FontFromBytes(PdfDataFont, "", opts.DataFont)
+		pdf.AddUTF8FontFromBytes(PdfDataFont, "B", opts.DataFont)
 	}
+	lineHeight := max(5, 5*opts.dataFontSize()/PdfDataLineFontSize)
 
-	// Debug: print headers
-	log.WithField("headers", headers).Debug("Read headers")
-
-	// 4. Run Header Validation
-	versionLine, ok := headers[HeaderFieldVersion]
-	if !ok {
-		if !ignoreVersionMismatch {
-			return nil, errors.Join(errorParsingHeader, newFieldNotPresentError(HeaderFieldVersion))
+	writeData := func() {
+		// print header lines
+		pdf.SetFont(dataFont, "B", opts.dataFontSize())
+		for _, line := range headerLines {
+			pdf.Cell(0, lineHeight, "# "+line)
+			pdf.Ln(lineHeight)
 		}
+		pdf.Ln(10)
 
-		log.Warn(Warning("PaperCrypt Version not present in header."))
-	}
-
-	majorVersion := PaperCryptContainerVersionFromString(versionLine)
-	if !ignoreVersionMismatch && !(majorVersion == PaperCryptContainerVersionMajor2 || majorVersion == PaperCryptContainerVersionDevel) {
-		return nil, errors.Join(errorParsingHeader, fmt.Errorf("unsupported PaperCrypt version '%s'", versionLine))
-	}
-
-	// Validate Header checksum
-	{
-		headerCrc, ok := headers[HeaderFieldHeaderCRC32]
-		if !ok {
-			if !ignoreChecksumMismatch {
-				return nil, errors.Join(errorParsingHeader, newFieldNotPresentError(HeaderFieldHeaderCRC32))
+		// print data lines, empty lines in between separate blocks
+		// lines that do not fit the page (such as the fixed-width armor lines on A5 paper) are printed smaller
+		dataLineFontSize := opts.dataFontSize()
+		pdf.SetFont(dataFont, "B", dataLineFontSize)
+		for _, line := range dataLines {
+			if width := pdf.GetStringWidth(line); width > opts.Page.ContentWidth() {
+				dataLineFontSize = min(dataLineFontSize, opts.dataFontSize()*opts.Page.ContentWidth()/width)
 			}
-
-			log.Warn(Warning("Header CRC-32 not present in header"))
 		}
 
-		headerCrc = strings.ToLower(headerCrc)
-		headerCrc = strings.ReplaceAll(headerCrc, "0x", "")
-		headerCrc = strings.ReplaceAll(headerCrc, " ", "")
-		headerCrc32, err := ParseHexUint32(headerCrc)
-		if err != nil {
-			return nil, errors.Join(errorParsingHeader, errors.New("invalid CRC-32 format"), err)
-		}
-
-		headerWithoutCrc := bytes.ReplaceAll(headersSection, []byte("# "), []byte{})
-		headerWithoutCrc = bytes.ReplaceAll(headerWithoutCrc, []byte("\n"+HeaderFieldHeaderCRC32+": "+headers[HeaderFieldHeaderCRC32]), []byte{})
+		pdf.SetFont(dataFont, "B", dataLineFontSize)
+		n := 0
+		for _, line := range dataLines {
+			if line == "" {
+				pdf.Ln(2.5)
+				n = 0
+				continue
+			}
+			if opts.Profile == OutputProfileStamping {
+				pdf.SetFont(PdfMonoFont, "B", stampingFontSize)
+				drawStampingLine(pdf, line)
+				continue
+			}
+			if core.IsColumnIndexLine([]byte(line)) {
+				pdf.SetFont(dataFont, "", dataLineFontSize)
+				pdf.Cell(0, lineHeight, line)
+				pdf.Ln(lineHeight)
+				pdf.SetFont(dataFont, "B", dataLineFontSize)
+				continue
+			}
 
-		if !ValidateCRC32(headerWithoutCrc, headerCrc32) {
-			if !ignoreChecksumMismatch {
-				return nil, errors.Join(errorParsingHeader, errorValidationFailure, errors.New("header CRC-32 mismatch: expected "+headers[HeaderFieldHeaderCRC32]+", got "+fmt.Sprintf("%x", crc32.ChecksumIEEE(headerWithoutCrc))))
+			// mark every second line with a grey background
+			n++
+			if n%2 == 1 {
+				pdf.SetFillColor(240, 240, 240)
+				pdf.Rect(margin, pdf.GetY(), opts.Page.ContentWidth()-4, lineHeight, "F")
 			}
 
-			log.Warn(Warning("Header CRC-32 mismatch!"))
+			pdf.Cell(0, lineHeight, line)
+			pdf.Ln(lineHeight)
 		}
 	}
 
-	var dataFormat PaperCryptDataFormat
-	{
-		dataFormatString, ok := headers[HeaderFieldDataFormat]
-		if !ok {
-			return nil, errors.Join(errorParsingHeader, newFieldNotPresentError(HeaderFieldDataFormat))
-		}
-
-		log.Debugf("Data Format: %s", dataFormatString)
+	pdf.AddPage()
+	pdf.SetFont(PdfTextFont, "B", 16)
+	pdf.CellFormat(0, 10, opts.Language.T(PDFHeading), "", 0, "C", false, 0, "")
+	pdf.Ln(10)
 
-		dataFormat = PaperCryptDataFormatFromString(dataFormatString)
+	if opts.Duplex == DuplexNone {
+		writeSections()
+		for i := range codes.Len() {
+			writeCode(i)
+		}
+		pdf.AddPage()
+		writeData()
+	} else {
+		// the front holds the 2D code and the data, which continues on the back,
+		// the information on the document follows after the data
+		if codes.Len() > 0 {
+			writeCode(0)
+		}
+		writeData()
+		for i := 1; i < codes.Len(); i++ {
+			writeCode(i)
+		}
+		pdf.AddPage()
+		writeSections()
 	}
 
-	var pgpMessage *crypto.PGPMessage
-	var body []byte
-	body, err = DeserializeBinary(&bodySection)
-	if err != nil {
-		return nil, errors.Join(errorParsingBody, err)
+	if opts.Instructions {
+		writeRecoveryInstructions(p, pdf, opts)
 	}
 
-	switch dataFormat {
-	case PaperCryptDataFormatPGP:
-		pgpMessage = crypto.NewPGPMessage(body)
-		body = pgpMessage.GetBinary()
-	case PaperCryptDataFormatRaw:
-		// do nothing
-	default:
-		return nil, errors.Join(errorParsingBody, errors.New("unsupported data format"))
+	if opts.Duplex != DuplexNone && pdf.PageNo()%2 == 1 {
+		// an even number of pages, so the next document printed starts on a sheet of its own
+		pdf.AddPage()
+		pdf.SetFont(PdfTextFont, "I", 10)
+		pdf.CellFormat(0, 10, opts.Language.T(PDFBlankPageNote), "", 0, "C", false, 0, "")
 	}
 
-	// 5. Verify Body Hashes
-
-	// 5.1 Verify Content Length
-	bodyLength, ok := headers[HeaderFieldContentLength]
-	if !ok {
-		return nil, errors.Join(errorParsingBody, newFieldNotPresentError(HeaderFieldContentLength))
-	}
+	return pdf, nil
+}
 
-	if fmt.Sprint(len(body)) != bodyLength {
-		return nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch: expected %s, got %d", HeaderFieldContentLength, bodyLength, len(body)))
-	}
+// outputPDF returns the document, it can be called once per document.
+func outputPDF(pdf *gofpdf.Fpdf) ([]byte, error) {
+	pdf.Close()
 
-	// 5.2 Verify CRC-32
-	bodyCrc32, ok := headers[HeaderFieldCRC32]
-	if !ok {
-		return nil, errors.Join(errorValidationFailure, newFieldNotPresentError(HeaderFieldCRC32))
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, errors.Join(errors.New("error generating pdf"), err)
 	}
 
-	bodyCrc32Uint32, err := ParseHexUint32(bodyCrc32)
-	if err != nil {
-		return nil, errors.Join(errorParsingBody, err)
-	}
+	return buf.Bytes(), nil
+}
 
-	if !ValidateCRC32(body, bodyCrc32Uint32) {
-		if !ignoreChecksumMismatch {
-			return nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch", HeaderFieldCRC32))
+// finishPDF returns the document, converted to PDF/A, and with its duplex mode set, if requested.
+func finishPDF(doc []byte, opts TextOptions) ([]byte, error) {
+	if opts.PDFA {
+		var err error
+		doc, err = ConvertToPDFA(doc, "PaperCrypt/"+core.VersionInfo.GitVersion, time.Now())
+		if err != nil {
+			return nil, errors.Join(errors.New("error converting pdf to PDF/A"), err)
 		}
-
-		log.Warn(Warning("Content CRC-32 mismatch!"))
-	}
-
-	// 5.3 Verify CRC-24
-	bodyCrc24, ok := headers[HeaderFieldCRC24]
-	if !ok {
-		return nil, errors.Join(errorParsingBody, newFieldNotPresentError(HeaderFieldCRC24))
-	}
-
-	bodyCrc24Uint32, err := ParseHexUint32(bodyCrc24)
-	if err != nil {
-		return nil, errors.Join(errorParsingBody, err)
 	}
 
-	if !ValidateCRC24(body, bodyCrc24Uint32) {
-		if !ignoreChecksumMismatch {
-			return nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch", HeaderFieldCRC24))
+	if opts.Duplex != DuplexNone {
+		var err error
+		doc, err = updatePDFCatalog(doc, "/ViewerPreferences << /Duplex /"+opts.Duplex.viewerPreference()+" >>")
+		if err != nil {
+			return nil, errors.Join(errors.New("error setting the duplex mode of the pdf"), err)
 		}
-
-		log.Warn(Warning("Content CRC-24 mismatch!"))
 	}
 
-	// 5.4 Verify SHA-256
-	bodySha256, ok := headers[HeaderFieldSHA256]
-	if !ok {
-		return nil, errors.Join(errorParsingBody, newFieldNotPresentError(HeaderFieldSHA256))
-	}
+	return doc, nil
+}
 
-	bodySha256Bytes, err := BytesFromBase64(bodySha256)
-	if err != nil {
-		return nil, errors.Join(errorParsingBody, err)
+func getPdf(page core.Page) *gofpdf.Fpdf {
+	orientation := "P"
+	if page.Landscape {
+		orientation = "L"
 	}
 
-	actualSha256 := sha256.Sum256(body)
-	if !bytes.Equal(actualSha256[:], bodySha256Bytes) {
-		if !ignoreChecksumMismatch {
-			return nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch", HeaderFieldSHA256))
-		}
-
-		log.Warn(Warning("Content SHA-256 mismatch!"))
-	}
+	pdf := gofpdf.New(orientation, "mm", page.Paper.String(), "")
+	pdf.SetCreator("PaperCrypt/"+core.VersionInfo.GitVersion, true)
+	pdf.SetTextRenderingMode(4)
+	pdf.SetTopMargin(20)
+	pdf.SetLeftMargin(page.Margin())
+	pdf.SetRightMargin(page.Margin())
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AliasNbPages("")
 
-	// 6. Construct PaperCrypt object
-	headerDate, ok := headers[HeaderFieldDate]
-	if !ok {
-		log.Warn(Warning("Date not present in header!"))
-	}
+	pdf.AddUTF8FontFromBytes(PdfTextFont, "", PdfTextFontRegularBytes)
+	pdf.AddUTF8FontFromBytes(PdfTextFont, "B", PdfTextFontBoldBytes)
+	pdf.AddUTF8FontFromBytes(PdfTextFont, "I", PdfTextFontItalicBytes)
 
-	timestamp, err := time.Parse(TimeStampFormatLong, headerDate)
-	if err != nil {
-		return nil, errors.Join(errors.New("invalid date format"), err)
-	}
-
-	// we don't need to pass the checksums, as they are already verified
-	// and will just be recalculated
-	paperCrypt := NewPaperCrypt(
-		versionLine,
-		body,
-		headers[HeaderFieldSerial],
-		headers[HeaderFieldPurpose],
-		headers[HeaderFieldComment],
-		timestamp,
-		dataFormat,
-	)
-
-	// 7. Serialize PaperCrypt object
-	_, err = json.MarshalIndent(paperCrypt, "", "  ")
-	if err != nil {
-		return nil, errors.Join(errors.New("error encoding JSON"), err)
-	}
-	log.WithField("json", paperCrypt).Debug("Serialized PaperCrypt document")
+	pdf.AddUTF8FontFromBytes(PdfMonoFont, "", PdfMonoFontRegularBytes)
+	pdf.AddUTF8FontFromBytes(PdfMonoFont, "B", PdfMonoFontBoldBytes)
+	pdf.AddUTF8FontFromBytes(PdfMonoFont, "I", PdfMonoFontItalicBytes)
 
-	return paperCrypt, nil
+	return pdf
 }
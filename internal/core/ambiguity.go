@@ -0,0 +1,274 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/caarlos0/log"
+)
+
+// maxAmbiguousSubstitutions is the number of characters per line (or per header) that are corrected,
+// by trying the characters they are commonly mistaken for.
+const maxAmbiguousSubstitutions = 2
+
+// AmbiguousCharacters maps characters to the characters they are commonly mistaken for, when typed or read by OCR.
+var AmbiguousCharacters = map[rune][]rune{
+	'0': {'O', 'D', 'Q', 'o', '8'},
+	'O': {'0', 'D', 'Q'},
+	'o': {'0', 'O'},
+	'D': {'0', 'O'},
+	'Q': {'0', 'O'},
+	'1': {'I', 'l', '7', 'i'},
+	'I': {'1', 'l'},
+	'L': {'1'},
+	'l': {'1', 'I'},
+	'i': {'1', 'l'},
+	'7': {'1', 'T'},
+	'T': {'7'},
+	'2': {'Z', 'z'},
+	'Z': {'2'},
+	'z': {'2'},
+	'4': {'A'},
+	'A': {'4'},
+	'5': {'S', 's'},
+	'S': {'5', '8'},
+	's': {'5'},
+	'6': {'G', 'b'},
+	'G': {'6', 'C'},
+	'b': {'6'},
+	'C': {'G'},
+	'8': {'B', '0', '3'},
+	'B': {'8', 'E'},
+	'3': {'8', 'E'},
+	'E': {'F', 'B', '3'},
+	'F': {'E'},
+	'9': {'g', 'q'},
+	'g': {'9'},
+	'q': {'9'},
+	'V': {'U', 'Y'},
+	'U': {'V'},
+	'+': {'t'},
+	't': {'+'},
+	'/': {'l', '1'},
+}
+
+const HexAlphabet = "0123456789ABCDEFabcdef"
+
+// Alphabet returns the digits of the encoding, in upper and lower case, if the encoding is not case-sensitive.
+// It is empty for the armor and words encodings, whose lines are not made of digits.
+func (e PaperCryptDataEncoding) Alphabet() string {
+	switch e {
+	case PaperCryptDataEncodingBase16:
+		return HexAlphabet
+	case PaperCryptDataEncodingBase32:
+		return "0123456789ABCDEFGHJKMNPQRSTVWXYZabcdefghjkmnpqrstvwxyz"
+	case PaperCryptDataEncodingBase64:
+		return "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+	default:
+		return ""
+	}
+}
+
+// RepairAmbiguous replaces up to maxAmbiguousSubstitutions of the characters of text at the given positions
+// with the characters they are commonly mistaken for, until valid returns true.
+// Replacements must be allowed at their position by `allowed`, if it is not nil.
+// It returns false (leaving text unchanged) if no combination is valid.
+func RepairAmbiguous(text []rune, positions []int, allowed func(position int, r rune) bool, valid func([]rune) bool) bool {
+	if valid(text) {
+		return true
+	}
+
+	var try func(start, depth int) bool
+	try = func(start, depth int) bool {
+		for i := start; i < len(positions); i++ {
+			p := positions[i]
+			original := text[p]
+			for _, alternative := range AmbiguousCharacters[original] {
+				if allowed != nil && !allowed(p, alternative) {
+					continue
+				}
+
+				text[p] = alternative
+				if depth == 1 && valid(text) || depth > 1 && try(i+1, depth-1) {
+					return true
+				}
+			}
+			text[p] = original
+		}
+
+		return false
+	}
+
+	for depth := 1; depth <= maxAmbiguousSubstitutions; depth++ {
+		if try(0, depth) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeAmbiguous replaces the characters of text that are not allowed at their position
+// with the first allowed character they are commonly mistaken for, such as O with 0 in base16 digits.
+func normalizeAmbiguous(text []rune, allowed func(position int, r rune) bool) {
+	for i, r := range text {
+		if allowed(i, r) {
+			continue
+		}
+
+		for _, alternative := range AmbiguousCharacters[r] {
+			if allowed(i, alternative) {
+				text[i] = alternative
+				break
+			}
+		}
+	}
+}
+
+// DecodeAmbiguousLine decodes the part of a line after its line number, like DecodeLineContent,
+// correcting characters commonly mistaken for each other (such as O and 0, or B and 8),
+// as long as the checksum of the line confirms the correction.
+// If expectedSize is greater than 0, the line must hold that many bytes.
+// The corrections are described as "B→8 (group 3)", the checksum counts as the last group.
+func DecodeAmbiguousLine(content string, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum, expectedSize int) (data []byte, sum uint32, corrections []string, ok bool) {
+	alphabet := encoding.Alphabet()
+	if alphabet == "" {
+		return nil, 0, nil, false
+	}
+
+	groups := strings.Fields(content)
+	var digits []rune
+	var groupOf []int
+	for i, group := range groups {
+		for _, r := range group {
+			digits = append(digits, r)
+			groupOf = append(groupOf, i+1)
+		}
+	}
+
+	split := len(digits) - len(checksum.Format(0))
+	if split <= 0 {
+		return nil, 0, nil, false
+	}
+
+	original := append([]rune(nil), digits...)
+	allowed := func(position int, r rune) bool {
+		if position >= split {
+			return strings.ContainsRune(HexAlphabet, r)
+		}
+
+		return strings.ContainsRune(alphabet, r)
+	}
+	normalizeAmbiguous(digits, allowed)
+
+	positions := make([]int, len(digits))
+	for i := range positions {
+		positions[i] = i
+	}
+	ok = RepairAmbiguous(digits, positions, allowed, func(candidate []rune) bool {
+		decoded, err := encoding.DecodeLine([][]byte{[]byte(string(candidate[:split]))})
+		if err != nil || len(decoded) == 0 || len(decoded) > layout.BytesPerLine() || expectedSize > 0 && len(decoded) != expectedSize {
+			return false
+		}
+		parsed, err := ParseHexUint32(string(candidate[split:]))
+		if err != nil || checksum.Sum(decoded) != parsed {
+			return false
+		}
+
+		data, sum = decoded, parsed
+		return true
+	})
+	if !ok {
+		return nil, 0, nil, false
+	}
+
+	for i := range digits {
+		if digits[i] != original[i] && (encoding.IsCaseSensitive() || !strings.EqualFold(string(digits[i]), string(original[i]))) {
+			corrections = append(corrections, fmt.Sprintf("%c→%c (group %d)", original[i], digits[i], groupOf[i]))
+		}
+	}
+
+	return data, sum, corrections, true
+}
+
+// correctAmbiguousLine decodes a line that could not be decoded as written, or failed its checksum,
+// using DecodeAmbiguousLine, and logs the corrections applied.
+func correctAmbiguousLine(content []byte, lineNumber string, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum, expectedSize int) ([]byte, uint32, bool) {
+	data, sum, corrections, ok := DecodeAmbiguousLine(string(content), encoding, layout, checksum, expectedSize)
+	if ok {
+		log.WithField("line", lineNumber).
+			WithField("corrections", strings.Join(corrections, ", ")).
+			Info("Corrected commonly confused characters")
+	}
+
+	return data, sum, ok
+}
+
+// correctAmbiguousChecksum parses a block checksum that failed to match the data
+// using DecodeAmbiguousChecksum, and logs the corrections applied.
+func correctAmbiguousChecksum(content []byte, lineNumber string, checksum LineChecksum, data []byte) (uint32, bool) {
+	sum, corrections, ok := DecodeAmbiguousChecksum(string(content), checksum, data)
+	if ok && len(corrections) > 0 {
+		log.WithField("line", lineNumber).
+			WithField("corrections", strings.Join(corrections, ", ")).
+			Info("Corrected commonly confused characters")
+	}
+
+	return sum, ok
+}
+
+// DecodeAmbiguousChecksum parses the checksum of a block, correcting ambiguous characters,
+// as long as the checksum matches the data.
+func DecodeAmbiguousChecksum(content string, checksum LineChecksum, data []byte) (uint32, []string, bool) {
+	digits := []rune(strings.Join(strings.Fields(content), ""))
+	if len(digits) != len(checksum.Format(0)) {
+		return 0, nil, false
+	}
+
+	original := append([]rune(nil), digits...)
+	allowed := func(_ int, r rune) bool { return strings.ContainsRune(HexAlphabet, r) }
+	normalizeAmbiguous(digits, allowed)
+
+	positions := make([]int, len(digits))
+	for i := range positions {
+		positions[i] = i
+	}
+	var sum uint32
+	ok := RepairAmbiguous(digits, positions, allowed, func(candidate []rune) bool {
+		parsed, err := ParseHexUint32(string(candidate))
+		sum = parsed
+		return err == nil && checksum.Sum(data) == parsed
+	})
+	if !ok {
+		return 0, nil, false
+	}
+
+	var corrections []string
+	for i := range digits {
+		if !strings.EqualFold(string(digits[i]), string(original[i])) {
+			corrections = append(corrections, fmt.Sprintf("%c→%c", original[i], digits[i]))
+		}
+	}
+
+	return sum, corrections, true
+}
@@ -0,0 +1,115 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// confuse replaces the first occurrence of old after the line number of the line with new.
+func confuse(t *testing.T, line string, old, new string) string {
+	t.Helper()
+
+	label, content, _ := strings.Cut(line, ": ")
+	if !strings.Contains(content, old) {
+		t.Fatalf("line %s does not contain %s", label, old)
+	}
+
+	return label + ": " + strings.Replace(content, old, new, 1)
+}
+
+func TestDeserializeAmbiguousCharacters(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 5))
+
+	t.Run("base16", func(t *testing.T) {
+		lines := strings.Split(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24), "\n")
+		lines[0] = confuse(t, lines[0], "8", "B")
+		lines[1] = confuse(t, lines[1], "0", "O")
+		lines[2] = confuse(t, lines[2], "6", "G")
+		lines[2] = confuse(t, lines[2], "1", "l")
+		// the block checksum is corrected as well
+		lines[len(lines)-2] = strings.Replace(lines[len(lines)-2], "0", "O", 1)
+		typed := []byte(strings.Join(lines, "\n"))
+
+		decoded, err := DeserializeBinaryEncoded(&typed, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24)
+		if err != nil {
+			t.Fatalf("DeserializeBinaryEncoded failed with error %s", err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+
+	t.Run("base32", func(t *testing.T) {
+		lines := strings.Split(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC32), "\n")
+		// I, L, O, and U are not base32 digits
+		lines[0] = confuse(t, lines[0], "1", "I")
+		lines[1] = confuse(t, lines[1], "0", "O")
+		typed := []byte(strings.Join(lines, "\n"))
+
+		decoded, err := DeserializeBinaryEncoded(&typed, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC32)
+		if err != nil {
+			t.Fatalf("DeserializeBinaryEncoded failed with error %s", err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+
+	t.Run("too many substitutions", func(t *testing.T) {
+		lines := strings.Split(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24), "\n")
+		// D is a base16 digit, so it is only replaced by searching for a matching checksum
+		for i := 0; i < maxAmbiguousSubstitutions+1; i++ {
+			lines[0] = confuse(t, lines[0], "0", "D")
+		}
+		typed := []byte(strings.Join(lines, "\n"))
+
+		if _, err := DeserializeBinaryEncoded(&typed, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24); err == nil {
+			t.Errorf("DeserializeBinaryEncoded should fail with more than %d substitutions in a line", maxAmbiguousSubstitutions)
+		}
+	})
+}
+
+func TestDecodeAmbiguousLine(t *testing.T) {
+	line := []byte{0x01, 0x08, 0x50, 0xB0}
+	content := PaperCryptDataEncodingBase16.EncodeLine(line, 2) + " " + LineChecksumCRC24.Format(LineChecksumCRC24.Sum(line))
+	typed := strings.Replace(strings.Replace(content, "0108", "OlO8", 1), "50B0", "5OB0", 1)
+
+	data, sum, corrections, ok := DecodeAmbiguousLine(typed, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24, len(line))
+	if !ok {
+		t.Fatalf("DecodeAmbiguousLine failed to correct %s", typed)
+	}
+	if !bytes.Equal(data, line) || sum != LineChecksumCRC24.Sum(line) {
+		t.Errorf("Decoding was incorrect, got: %x, want: %x.", data, line)
+	}
+
+	want := []string{"O→0 (group 1)", "l→1 (group 1)", "O→0 (group 1)", "O→0 (group 2)"}
+	if strings.Join(corrections, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Corrections were incorrect, got: %v, want: %v.", corrections, want)
+	}
+
+	// the size of the line must match
+	if _, _, _, ok := DecodeAmbiguousLine(typed, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24, len(line)+1); ok {
+		t.Errorf("DecodeAmbiguousLine should fail with an unexpected line size")
+	}
+}
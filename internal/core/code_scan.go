@@ -0,0 +1,147 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/caarlos0/log"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/aztec"
+	multiqrcode "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// ScanCodeImage reads the payloads of the 2D codes in an image, as they are: a single Aztec code,
+// and any number of QR codes. Images in which no code is found may be preprocessed (see PreprocessSteps), and read again.
+func ScanCodeImage(img image.Image) ([][]byte, error) {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return nil, errors.Join(errors.New("error creating binary bitmap"), err)
+	}
+
+	var results []*gozxing.Result
+
+	// attempt to decode as aztec first
+	aztecReader := aztec.NewAztecReader()
+	result, aztecErr := aztecReader.Decode(bmp, nil)
+	if aztecErr == nil {
+		results = append(results, result)
+	} else {
+		log.Debugf("error decoding aztec: %s", aztecErr)
+	}
+
+	// then look for qrcodes, a page may hold several of them
+	qrReader := multiqrcode.NewQRCodeMultiReader()
+	qrResults, qrErr := qrReader.DecodeMultiple(bmp, nil)
+	if qrErr == nil {
+		log.Debugf("decoded %d QR codes", len(qrResults))
+		results = append(results, qrResults...)
+	}
+	if len(qrResults) == 0 {
+		// the multi reader misses some single codes, such as those of wallet cards, which the plain reader finds
+		result, err := qrcode.NewQRCodeReader().Decode(bmp, nil)
+		if err == nil {
+			log.Debug("decoded a QR code, using the single code reader")
+			results = append(results, result)
+		} else {
+			qrErr = errors.Join(qrErr, err)
+		}
+	}
+
+	if len(results) == 0 {
+		return nil, errors.Join(errors.New("error decoding 2D code"), aztecErr, qrErr)
+	}
+
+	payloads := make([][]byte, 0, len(results))
+	for _, result := range results {
+		// binary (CBOR) payloads are decoded as text, use the raw bytes of the code where possible
+		byteSegments, _ := result.GetResultMetadata()[gozxing.ResultMetadataType_BYTE_SEGMENTS].([][]byte)
+		payloads = append(payloads, ScannedBytes(result.GetText(), byteSegments))
+	}
+
+	return payloads, nil
+}
+
+// DecodeCodeImages reads a document from images of its 2D code, such as scans, or photos:
+// a single image holding the complete code, or the images of all parts of a split code, in any order.
+// Images in which no code is found are preprocessed (contrast stretched, thresholded, and rescaled), and read again.
+func DecodeCodeImages(images ...image.Image) (*PaperCrypt, error) {
+	if len(images) == 0 {
+		return nil, errors.New("no images to read the 2D code from")
+	}
+
+	var payload []byte
+	var parts []QRPart
+	for i, img := range images {
+		scanned, err := scanCodes(img)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("no 2D code found in image %d", i+1), err)
+		}
+
+		for _, data := range scanned {
+			if !IsQRPart(data) {
+				payload = data
+				continue
+			}
+
+			part, err := ParseQRPart(data)
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("error reading the 2D code part in image %d", i+1), err)
+			}
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) > 0 {
+		if payload != nil {
+			return nil, errors.New("found both a complete 2D code, and parts of a split code, only a single document can be read at once")
+		}
+
+		var err error
+		payload, err = JoinQRParts(parts)
+		if err != nil {
+			return nil, errors.Join(errors.New("error reassembling 2D code parts"), err)
+		}
+	}
+
+	return DeserializeQRPayload(payload)
+}
+
+// scanCodes reads the payloads of the 2D codes in an image, preprocessing it, if no code is found at first.
+func scanCodes(img image.Image) ([][]byte, error) {
+	payloads, err := ScanCodeImage(img)
+	if err == nil {
+		return payloads, nil
+	}
+
+	stretched := ContrastStretch(img)
+	for _, step := range PreprocessSteps {
+		if processed := step.Apply(stretched); processed != nil {
+			if payloads, stepErr := ScanCodeImage(processed); stepErr == nil {
+				return payloads, nil
+			}
+		}
+	}
+
+	return nil, WithCategory(ErrorCategoryUnreadableCode, err)
+}
@@ -0,0 +1,58 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"image"
+	_ "image/png"
+	"os"
+	"testing"
+)
+
+func TestScanCodeImageWalletCard(t *testing.T) {
+	// a page of 'generate --profile wallet', rendered at 300 dpi,
+	// the multi code reader does not find enough finder patterns in it
+	file, err := os.Open("testdata/wallet-card-300dpi.png")
+	if err != nil {
+		t.Fatalf("Open failed with error %s", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("Decode failed with error %s", err)
+	}
+
+	results, err := ScanCodeImage(img)
+	if err != nil {
+		t.Fatalf("ScanCodeImage failed with error %s", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got: %d codes, want: 1.", len(results))
+	}
+
+	pc, err := DeserializeQRPayload(results[0])
+	if err != nil {
+		t.Fatalf("DeserializeQRPayload failed with error %s", err)
+	}
+	if len(pc.Data) == 0 {
+		t.Errorf("got: no data, want: the encrypted data of the card.")
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/aztec"
+	"github.com/boombuler/barcode/qr"
+)
+
+// Code2DType is the type of the 2D code holding the document.
+type Code2DType uint8
+
+const (
+	Code2DTypeAztec Code2DType = 0
+	Code2DTypeQR    Code2DType = 1
+	// Code2DTypeColor is the experimental color code, see EncodeColorCodes.
+	Code2DTypeColor Code2DType = 2
+	// Code2DTypeUnknown is returned for unknown code type names.
+	Code2DTypeUnknown Code2DType = 0xFF
+)
+
+// AztecMinECCPercent is the minimum share of error correction codewords of Aztec codes.
+const AztecMinECCPercent = 35
+
+func (c Code2DType) String() string {
+	switch c {
+	case Code2DTypeAztec:
+		return "Aztec"
+	case Code2DTypeQR:
+		return "QR"
+	case Code2DTypeColor:
+		return "Color (experimental)"
+	default:
+		return "Unknown"
+	}
+}
+
+func Code2DTypeFromString(s string) Code2DType {
+	switch strings.ToLower(s) {
+	case "aztec":
+		return Code2DTypeAztec
+	case "qr":
+		return Code2DTypeQR
+	case "color":
+		return Code2DTypeColor
+	default:
+		return Code2DTypeUnknown
+	}
+}
+
+// QRErrorCorrection is the error correction level of QR codes.
+// Level M is the zero value, as it is the default.
+type QRErrorCorrection uint8
+
+const (
+	QRErrorCorrectionM QRErrorCorrection = 0
+	QRErrorCorrectionL QRErrorCorrection = 1
+	QRErrorCorrectionQ QRErrorCorrection = 2
+	QRErrorCorrectionH QRErrorCorrection = 3
+	// QRErrorCorrectionUnknown is returned for unknown level names.
+	QRErrorCorrectionUnknown QRErrorCorrection = 0xFF
+)
+
+// QRMaxVersion is the largest QR code version, 177x177 modules.
+const QRMaxVersion = 40
+
+const (
+	// Code2DPrintSize is the width (and height) of the area 2D codes are printed in on A4 pages, in mm.
+	Code2DPrintSize = 167.0
+
+	// Code2DDefaultDPI is the resolution 2D codes are rendered at, unless set in Code2DOptions.
+	Code2DDefaultDPI = 1200
+
+	// MinScannableModuleSize is the smallest module size, in mm,
+	// that is reliably read by phone cameras once printed.
+	MinScannableModuleSize = 0.5
+)
+
+func (e QRErrorCorrection) String() string {
+	switch e {
+	case QRErrorCorrectionL:
+		return "L"
+	case QRErrorCorrectionM:
+		return "M"
+	case QRErrorCorrectionQ:
+		return "Q"
+	case QRErrorCorrectionH:
+		return "H"
+	default:
+		return "Unknown"
+	}
+}
+
+func QRErrorCorrectionFromString(s string) QRErrorCorrection {
+	switch strings.ToUpper(s) {
+	case "L":
+		return QRErrorCorrectionL
+	case "M":
+		return QRErrorCorrectionM
+	case "Q":
+		return QRErrorCorrectionQ
+	case "H":
+		return QRErrorCorrectionH
+	default:
+		return QRErrorCorrectionUnknown
+	}
+}
+
+func (e QRErrorCorrection) level() qr.ErrorCorrectionLevel {
+	switch e {
+	case QRErrorCorrectionL:
+		return qr.L
+	case QRErrorCorrectionQ:
+		return qr.Q
+	case QRErrorCorrectionH:
+		return qr.H
+	default:
+		return qr.M
+	}
+}
+
+// Code2DOptions control how the 2D code holding the document is generated.
+type Code2DOptions struct {
+	// Type is the type of the 2D code.
+	Type Code2DType
+
+	// QRErrorCorrection is the error correction level of QR codes.
+	QRErrorCorrection QRErrorCorrection
+
+	// QRMaxVersion is the largest version (1-40) of QR codes, payloads that do not fit are split
+	// over several codes. 0 allows all versions.
+	QRMaxVersion int
+
+	// ModuleSize is the printed size of a single module, in mm.
+	// Codes that would exceed the print area are split over several codes.
+	// 0 scales every code to fill the print area.
+	ModuleSize float64
+
+	// PrintArea is the width (and height) of the area codes are printed in, in mm,
+	// Code2DPrintSize if 0, see Page.Code2DPrintSize.
+	PrintArea float64
+
+	// DPI is the resolution codes are rendered at, Code2DDefaultDPI if 0.
+	// With ModuleSize set, each module is rendered as a whole number of dots.
+	DPI int
+}
+
+// Validate checks that the options can be used to generate a 2D code.
+func (o Code2DOptions) Validate() error {
+	if o.Type == Code2DTypeUnknown {
+		return errors.New("unknown 2D code type")
+	}
+	if o.QRErrorCorrection == QRErrorCorrectionUnknown {
+		return errors.New("unknown QR error correction level")
+	}
+	if o.QRMaxVersion < 0 || o.QRMaxVersion > QRMaxVersion {
+		return fmt.Errorf("QR version must be between 0 and %d (0 for no limit)", QRMaxVersion)
+	}
+	if o.PrintArea < 0 {
+		return errors.New("print area must not be negative")
+	}
+	if o.ModuleSize < 0 || o.ModuleSize > o.printArea() {
+		return fmt.Errorf("module size must be between 0 and %.0f mm", o.printArea())
+	}
+	if o.DPI < 0 {
+		return errors.New("DPI must not be negative")
+	}
+
+	return nil
+}
+
+func (o Code2DOptions) printArea() float64 {
+	if o.PrintArea == 0 {
+		return Code2DPrintSize
+	}
+
+	return o.PrintArea
+}
+
+func (o Code2DOptions) dpi() int {
+	if o.DPI == 0 {
+		return Code2DDefaultDPI
+	}
+
+	return o.DPI
+}
+
+// PrintSize returns the printed width of a code of `modules` modules in mm,
+// and the width in pixels it is rendered at.
+func (o Code2DOptions) PrintSize(modules int) (float64, int) {
+	if o.ModuleSize == 0 {
+		// 7795 pixels are 165 mm at 1200 dpi
+		return o.printArea(), int(math.Round(o.printArea() / Code2DPrintSize * 7795))
+	}
+
+	dots := int(math.Round(o.ModuleSize / 25.4 * float64(o.dpi())))
+	if dots < 1 {
+		dots = 1
+	}
+
+	return float64(modules) * o.ModuleSize, modules * dots
+}
+
+// ParseModuleSize parses a module size given either in millimetres ("0.5mm"),
+// or in printer dots at the given resolution ("6dots"), and returns it in mm.
+func ParseModuleSize(value string, dpi int) (float64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	var size float64
+	var err error
+	switch {
+	case strings.HasSuffix(value, "mm"):
+		size, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "mm")), 64)
+	case strings.HasSuffix(value, "dots"):
+		var dots int
+		dots, err = strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(value, "dots")))
+		if dpi <= 0 {
+			dpi = Code2DDefaultDPI
+		}
+		size = float64(dots) * 25.4 / float64(dpi)
+	default:
+		return 0, fmt.Errorf("module size '%s' must end in 'mm' or 'dots'", value)
+	}
+	if err != nil {
+		return 0, errors.Join(fmt.Errorf("invalid module size '%s'", value), err)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("module size '%s' must be positive", value)
+	}
+
+	return size, nil
+}
+
+// Encode2D encodes a payload as a 2D code.
+// QR codes are encoded in byte mode, so binary payloads (such as CBOR) are stored as-is,
+// rather than as text, using 8 bits per byte.
+func Encode2D(payload []byte, opts Code2DOptions) (barcode.Barcode, error) {
+	var code barcode.Barcode
+	var err error
+	switch opts.Type {
+	case Code2DTypeAztec:
+		code, err = aztec.Encode(payload, AztecMinECCPercent, 0)
+		if err != nil {
+			return nil, err
+		}
+	case Code2DTypeQR:
+		// qr.Unicode writes the bytes of the string in byte mode, without converting them
+		code, err = qr.Encode(string(payload), opts.QRErrorCorrection.level(), qr.Unicode)
+		if err != nil {
+			return nil, err
+		}
+
+		// version n codes are 17 + 4n modules wide
+		if version := (code.Bounds().Dx() - 17) / 4; opts.QRMaxVersion != 0 && version > opts.QRMaxVersion {
+			return nil, fmt.Errorf("payload needs QR version %d, larger than version %d", version, opts.QRMaxVersion)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported 2D code type %s", opts.Type)
+	}
+
+	if size, _ := opts.PrintSize(code.Bounds().Dx()); size > opts.printArea() {
+		return nil, fmt.Errorf("code of %d modules is %.1f mm wide at the module size of %.2f mm, larger than %.0f mm", code.Bounds().Dx(), size, opts.ModuleSize, opts.printArea())
+	}
+
+	return code, nil
+}
+
+// ScannedBytes returns the payload of a scanned 2D code.
+// If the code consists of byte mode segments only, the raw bytes of those segments are returned,
+// as the decoded text depends on the character set guessed by the reader.
+// Otherwise, the text is converted using Latin1Bytes.
+func ScannedBytes(text string, byteSegments [][]byte) []byte {
+	segments := bytes.Join(byteSegments, nil)
+	if len(segments) > 0 && len(segments) >= utf8.RuneCountInString(text) {
+		return segments
+	}
+
+	return Latin1Bytes(text)
+}
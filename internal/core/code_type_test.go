@@ -0,0 +1,183 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncode2D(t *testing.T) {
+	payload := []byte{0xA5, 0x00, 0x02, 0xFF, 0xC3, 0x28, '{', 0x80}
+
+	for _, codeType := range []Code2DType{Code2DTypeAztec, Code2DTypeQR} {
+		t.Run(codeType.String(), func(t *testing.T) {
+			code, err := Encode2D(payload, Code2DOptions{Type: codeType})
+			if err != nil {
+				t.Fatalf("Encode2D failed with error %s", err)
+			}
+
+			if code.Bounds().Dx() == 0 {
+				t.Errorf("Encode2D returned an empty code")
+			}
+
+			if parsed := Code2DTypeFromString(codeType.String()); parsed != codeType {
+				t.Errorf("Parsing was incorrect, got: %s, want: %s.", parsed, codeType)
+			}
+		})
+	}
+
+	if _, err := Encode2D(payload, Code2DOptions{Type: Code2DTypeUnknown}); err == nil {
+		t.Errorf("Encode2D should fail for unknown code types")
+	}
+}
+
+func TestScannedBytes(t *testing.T) {
+	payload := []byte{0xA5, 0x00, 0x02, 0xFF, 0xC3, 0x28}
+
+	t.Run("byte segments", func(t *testing.T) {
+		// the reader guessed a multi-byte character set, the text is shorter than the payload
+		got := ScannedBytes("¥\u0000\u0002ÿĨ", [][]byte{payload[:3], payload[3:]})
+		if !bytes.Equal(got, payload) {
+			t.Errorf("got: %x, want: %x.", got, payload)
+		}
+	})
+
+	t.Run("ISO 8859-1 text", func(t *testing.T) {
+		text := make([]rune, len(payload))
+		for i, b := range payload {
+			text[i] = rune(b)
+		}
+
+		got := ScannedBytes(string(text), nil)
+		if !bytes.Equal(got, payload) {
+			t.Errorf("got: %x, want: %x.", got, payload)
+		}
+	})
+
+	t.Run("mixed segments", func(t *testing.T) {
+		// only part of the code is in byte mode, the text is used
+		got := ScannedBytes(`{"v":"2.0.0"}`, [][]byte{[]byte(`2.0.0`)})
+		if string(got) != `{"v":"2.0.0"}` {
+			t.Errorf("got: %s, want: %s.", got, `{"v":"2.0.0"}`)
+		}
+	})
+}
+
+func TestEncode2DQROptions(t *testing.T) {
+	payload := make([]byte, 500)
+
+	low, err := Encode2D(payload, Code2DOptions{Type: Code2DTypeQR, QRErrorCorrection: QRErrorCorrectionL})
+	if err != nil {
+		t.Fatalf("Encode2D failed with error %s", err)
+	}
+	high, err := Encode2D(payload, Code2DOptions{Type: Code2DTypeQR, QRErrorCorrection: QRErrorCorrectionH})
+	if err != nil {
+		t.Fatalf("Encode2D failed with error %s", err)
+	}
+	if high.Bounds().Dx() <= low.Bounds().Dx() {
+		t.Errorf("Level H should need a larger code than level L, got: %d and %d modules.", high.Bounds().Dx(), low.Bounds().Dx())
+	}
+
+	if _, err := Encode2D(payload, Code2DOptions{Type: Code2DTypeQR, QRMaxVersion: 10}); err == nil {
+		t.Errorf("Encode2D should fail if the payload needs a larger version")
+	}
+
+	codes, err := Encode2DParts(payload, Code2DOptions{Type: Code2DTypeQR, QRMaxVersion: 10})
+	if err != nil {
+		t.Fatalf("Encode2DParts failed with error %s", err)
+	}
+	for _, code := range codes {
+		if code.Bounds().Dx() > 17+4*10 {
+			t.Errorf("Code exceeds version 10, got: %d modules.", code.Bounds().Dx())
+		}
+	}
+	if len(codes) < 2 {
+		t.Errorf("Payload should be split, got: %d codes.", len(codes))
+	}
+
+	for version, valid := range map[int]bool{-1: false, 0: true, 40: true, 41: false} {
+		err := (Code2DOptions{Type: Code2DTypeQR, QRErrorCorrection: QRErrorCorrectionM, QRMaxVersion: version}).Validate()
+		if (err == nil) != valid {
+			t.Errorf("Validate of QR version %d was incorrect, got: %v, want valid: %v.", version, err, valid)
+		}
+		if err != nil && !strings.Contains(err.Error(), "0 for no limit") {
+			t.Errorf("Validate error was incorrect, got: %s, want: a range from 0, with 0 for no limit.", err)
+		}
+	}
+}
+
+func TestParseModuleSize(t *testing.T) {
+	tests := []struct {
+		value string
+		dpi   int
+		want  float64
+	}{
+		{"0.5mm", 0, 0.5},
+		{" 1.2 MM ", 600, 1.2},
+		{"6dots", 300, 0.508},
+		{"12dots", 0, 0.254},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseModuleSize(test.value, test.dpi)
+			if err != nil {
+				t.Fatalf("ParseModuleSize failed with error %s", err)
+			}
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("got: %f, want: %f.", got, test.want)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "0.5", "0mm", "-1mm", "2.5dots", "abcmm"} {
+		if _, err := ParseModuleSize(value, 600); err == nil {
+			t.Errorf("ParseModuleSize should fail for '%s'", value)
+		}
+	}
+}
+
+func TestEncode2DModuleSize(t *testing.T) {
+	payload := make([]byte, 1000)
+	opts := Code2DOptions{Type: Code2DTypeQR, ModuleSize: 2, DPI: 600}
+
+	codes, err := Encode2DParts(payload, opts)
+	if err != nil {
+		t.Fatalf("Encode2DParts failed with error %s", err)
+	}
+	if len(codes) < 2 {
+		t.Errorf("Payload should be split, got: %d codes.", len(codes))
+	}
+
+	for _, code := range codes {
+		modules := code.Bounds().Dx()
+		size, pixels := opts.PrintSize(modules)
+		if size > Code2DPrintSize {
+			t.Errorf("Code is too large, got: %.1f mm.", size)
+		}
+		// 2 mm at 600 dpi is 47 dots per module
+		if pixels != modules*47 {
+			t.Errorf("got: %d pixels, want: %d pixels.", pixels, modules*47)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/boombuler/barcode"
+)
+
+// The experimental color code stacks three QR codes, printed in cyan, magenta and yellow ink.
+// Each ink absorbs one of the red, green and blue channels of a scanned image,
+// so the layers can be separated again, tripling the capacity of a page.
+// This needs a good color printer and scanner, and is not part of the stable container format:
+// every layer is a part (see SplitQRPayload) with a part header version of its own.
+
+// ColorCodeLayers is the number of layers of a color code.
+const ColorCodeLayers = 3
+
+// ColorCode is a color code, made up of one QR code per layer.
+type ColorCode [ColorCodeLayers]barcode.Barcode
+
+// Modules returns the width of the largest layer, in modules.
+func (c ColorCode) Modules() int {
+	modules := 0
+	for _, layer := range c {
+		modules = max(modules, layer.Bounds().Dx())
+	}
+
+	return modules
+}
+
+// EncodeColorCodes encodes a payload as color codes, splitting it over as few codes as necessary.
+// The layers are QR codes, generated using opts.
+func EncodeColorCodes(payload []byte, opts Code2DOptions) ([]ColorCode, error) {
+	opts.Type = Code2DTypeQR
+
+	var err error
+	for n := 1; n*ColorCodeLayers <= QRMaxParts; n++ {
+		var parts [][]byte
+		parts, err = splitQRPayload(payload, n*ColorCodeLayers, qrPartVersionColor)
+		if err != nil {
+			return nil, err
+		}
+
+		codes := make([]ColorCode, n)
+		for i, part := range parts {
+			var layer barcode.Barcode
+			layer, err = Encode2D(part, opts)
+			if err != nil {
+				break
+			}
+
+			codes[i/ColorCodeLayers][i%ColorCodeLayers] = layer
+		}
+		if err == nil {
+			return codes, nil
+		}
+	}
+
+	return nil, errors.Join(fmt.Errorf("payload does not fit into %d color codes", QRMaxParts/ColorCodeLayers), err)
+}
+
+// RenderColorCode draws the layers of a color code on top of each other, scaled to `pixels` pixels.
+// Layers are printed in cyan, magenta and yellow, where layers overlap, the inks mix.
+func RenderColorCode(code ColorCode, pixels int) (image.Image, error) {
+	var layers [ColorCodeLayers]barcode.Barcode
+	for i, layer := range code {
+		scaled, err := barcode.Scale(layer, pixels, pixels)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error scaling layer %d", i+1), err)
+		}
+
+		layers[i] = scaled
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, pixels, pixels))
+	for y := 0; y < pixels; y++ {
+		for x := 0; x < pixels; x++ {
+			var channels [ColorCodeLayers]uint8
+			for i, layer := range layers {
+				channels[i] = 0xFF
+				if Dark(layer.At(x, y)) {
+					channels[i] = 0
+				}
+			}
+
+			img.SetRGBA(x, y, color.RGBA{R: channels[0], G: channels[1], B: channels[2], A: 0xFF})
+		}
+	}
+
+	return img, nil
+}
+
+// SplitColorLayers separates the layers of a scanned color code,
+// each layer is returned as a grayscale image that can be read as a QR code.
+func SplitColorLayers(img image.Image) [ColorCodeLayers]*image.Gray {
+	bounds := img.Bounds()
+
+	var layers [ColorCodeLayers]*image.Gray
+	for i := range layers {
+		layers[i] = image.NewGray(bounds)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			for i, channel := range []uint32{r, g, b} {
+				layers[i].SetGray(x, y, color.Gray{Y: uint8(channel >> 8)})
+			}
+		}
+	}
+
+	return layers
+}
+
+// HasColor returns whether an image holds colored pixels, which may be the layers of a color code,
+// rather than only shades of gray.
+func HasColor(img image.Image) bool {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if max(r, g, b)-min(r, g, b) > colorThreshold {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// colorThreshold is the difference of the channels of a pixel, out of 0xFFFF, from which it is colored, rather than gray.
+const colorThreshold = 0x4000
+
+// Dark reports whether a pixel of a code is dark, that is a module, rather than the background.
+func Dark(c color.Color) bool {
+	gray := color.GrayModel.Convert(c).(color.Gray)
+	return gray.Y < 0x80
+}
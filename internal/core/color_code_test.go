@@ -0,0 +1,98 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/boombuler/barcode"
+)
+
+func TestColorCode(t *testing.T) {
+	payload := bytes.Repeat([]byte("PaperCrypt color code "), 200)
+	opts := Code2DOptions{Type: Code2DTypeColor, QRMaxVersion: 20}
+
+	codes, err := EncodeColorCodes(payload, opts)
+	if err != nil {
+		t.Fatalf("EncodeColorCodes failed with error %s", err)
+	}
+
+	t.Run("capacity", func(t *testing.T) {
+		mono, err := Encode2DParts(payload, Code2DOptions{Type: Code2DTypeQR, QRMaxVersion: 20})
+		if err != nil {
+			t.Fatalf("Encode2DParts failed with error %s", err)
+		}
+		if len(codes)*ColorCodeLayers > len(mono)+ColorCodeLayers {
+			t.Errorf("Color codes should hold three QR codes each, got: %d color codes for %d QR codes.", len(codes), len(mono))
+		}
+	})
+
+	t.Run("layers", func(t *testing.T) {
+		var parts []QRPart
+		for _, code := range codes {
+			pixels := code.Modules() * 4
+			img, err := RenderColorCode(code, pixels)
+			if err != nil {
+				t.Fatalf("RenderColorCode failed with error %s", err)
+			}
+
+			if !HasColor(img) {
+				t.Errorf("Color code should be colored")
+			}
+			if gray := GrayImage(img); HasColor(gray) {
+				t.Errorf("Gray image should not be colored")
+			}
+
+			for i, layer := range SplitColorLayers(img) {
+				want, err := barcode.Scale(code[i], pixels, pixels)
+				if err != nil {
+					t.Fatalf("Scale failed with error %s", err)
+				}
+
+				for y := 0; y < pixels; y++ {
+					for x := 0; x < pixels; x++ {
+						if Dark(layer.At(x, y)) != Dark(want.At(x, y)) {
+							t.Fatalf("Layer %d differs at (%d, %d)", i+1, x, y)
+						}
+					}
+				}
+
+				part, err := ParseQRPart([]byte(code[i].Content()))
+				if err != nil {
+					t.Fatalf("ParseQRPart failed with error %s", err)
+				}
+				if !part.Color {
+					t.Errorf("Layer %d should be marked as a color code layer", i+1)
+				}
+				parts = append(parts, part)
+			}
+		}
+
+		joined, err := JoinQRParts(parts)
+		if err != nil {
+			t.Fatalf("JoinQRParts failed with error %s", err)
+		}
+		if !bytes.Equal(joined, payload) {
+			t.Errorf("Reassembled payload does not match")
+		}
+	})
+}
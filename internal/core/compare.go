@@ -0,0 +1,101 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// FieldComparison is a field of two documents, compared by CompareDocuments.
+type FieldComparison struct {
+	// Field is the name of the header field.
+	Field string
+
+	// A and B are the values of the field in the first and the second document.
+	A, B string
+
+	// Equal is true if the values are the same.
+	Equal bool
+
+	// Essential is true for the fields describing the content, which must match for the documents to hold the same data,
+	// and false for those that may change with a reprint, such as the purpose, or the version of PaperCrypt.
+	Essential bool
+}
+
+// CompareDocuments compares the content (the ciphertext), serial number, and checksums of two documents,
+// and their descriptive fields, such as a reprint and the original it was made from.
+func CompareDocuments(a, b *PaperCrypt) []FieldComparison {
+	plaintextSHA256 := func(p *PaperCrypt) string {
+		if len(p.PlaintextSHA256) == 0 {
+			return "(not printed)"
+		}
+
+		return FormatSHA256(p.PlaintextSHA256)
+	}
+
+	metadata := func(p *PaperCrypt) string {
+		if p.PrivateMetadata {
+			return HeaderValueMetadataEncrypted
+		}
+
+		return "(printed)"
+	}
+
+	message := func(p *PaperCrypt) string {
+		if p.ExternalMessage {
+			return HeaderValueMessageExternal
+		}
+
+		return "(PaperCrypt)"
+	}
+
+	comparisons := []FieldComparison{
+		{Field: HeaderFieldSerial, A: a.SerialNumber, B: b.SerialNumber, Essential: true},
+		{Field: HeaderFieldDataFormat, A: a.DataFormat.String(), B: b.DataFormat.String(), Essential: true},
+		{Field: HeaderFieldCRC24, A: fmt.Sprintf("%06x", a.DataCRC24), B: fmt.Sprintf("%06x", b.DataCRC24), Essential: true},
+		{Field: HeaderFieldCRC32, A: fmt.Sprintf("%08x", a.DataCRC32), B: fmt.Sprintf("%08x", b.DataCRC32), Essential: true},
+		{Field: HeaderFieldSHA256, A: FormatSHA256(a.DataSHA256[:]), B: FormatSHA256(b.DataSHA256[:]), Essential: true},
+		{Field: HeaderFieldPlaintextSHA256, A: plaintextSHA256(a), B: plaintextSHA256(b), Essential: true},
+		{Field: HeaderFieldMetadata, A: metadata(a), B: metadata(b), Essential: true},
+		{Field: HeaderFieldMessage, A: message(a), B: message(b), Essential: true},
+		{Field: HeaderFieldDate, A: FormatTimeStamp(a.CreatedAt), B: FormatTimeStamp(b.CreatedAt)},
+		{Field: HeaderFieldExpires, A: FormatDueDate(a.ExpiresAt), B: FormatDueDate(b.ExpiresAt)},
+		{Field: HeaderFieldReviewBy, A: FormatDueDate(a.ReviewBy), B: FormatDueDate(b.ReviewBy)},
+		{Field: HeaderFieldSupersedes, A: a.Supersedes, B: b.Supersedes},
+		{Field: HeaderFieldPurpose, A: a.Purpose, B: b.Purpose},
+		{Field: HeaderFieldComment, A: a.Comment, B: b.Comment},
+		{Field: HeaderFieldVersion, A: a.Version, B: b.Version},
+		{Field: HeaderFieldFormatVersion, A: a.ContainerVersion().String(), B: b.ContainerVersion().String()},
+	}
+	for i := range comparisons {
+		comparisons[i].Equal = comparisons[i].A == comparisons[i].B
+	}
+
+	// the checksums only match if the content does, compare it anyway, byte by byte
+	return append(comparisons, FieldComparison{
+		Field:     "Content",
+		A:         fmt.Sprintf("%d bytes", len(a.Data)),
+		B:         fmt.Sprintf("%d bytes", len(b.Data)),
+		Equal:     bytes.Equal(a.Data, b.Data),
+		Essential: true,
+	})
+}
@@ -0,0 +1,64 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareDocuments(t *testing.T) {
+	createdAt := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	original := NewPaperCrypt("2.0.0", []byte("encrypted data"), "ABCDEF", "Purpose", "", createdAt, PaperCryptDataFormatPGP)
+
+	differences := func(a, b *PaperCrypt) (essential, other []string) {
+		for _, c := range CompareDocuments(a, b) {
+			switch {
+			case c.Equal:
+			case c.Essential:
+				essential = append(essential, c.Field)
+			default:
+				other = append(other, c.Field)
+			}
+		}
+
+		return essential, other
+	}
+
+	// a reprint, with a new purpose, made by a newer version
+	reprint := NewPaperCrypt("2.1.0", []byte("encrypted data"), "ABCDEF", "New Purpose", "", createdAt, PaperCryptDataFormatPGP)
+	if essential, other := differences(original, reprint); len(essential) != 0 || len(other) != 2 {
+		t.Errorf("Comparison was incorrect, got: %v and %v, want: [] and [%s %s].", essential, other, HeaderFieldPurpose, HeaderFieldVersion)
+	}
+
+	// a different document
+	drifted := NewPaperCrypt("2.0.0", []byte("encrypted dat4"), "ABCDEF", "Purpose", "", createdAt, PaperCryptDataFormatPGP)
+	essential, _ := differences(original, drifted)
+	want := []string{HeaderFieldCRC24, HeaderFieldCRC32, HeaderFieldSHA256, "Content"}
+	if len(essential) != len(want) {
+		t.Fatalf("Comparison was incorrect, got: %v, want: %v.", essential, want)
+	}
+	for i := range want {
+		if essential[i] != want[i] {
+			t.Errorf("Comparison was incorrect, got: %v, want: %v.", essential, want)
+		}
+	}
+}
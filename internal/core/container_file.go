@@ -0,0 +1,950 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2023-2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package core is the document format of PaperCrypt: the container of a document, its text, and the payload of its 2D codes,
+// and the parsing, scanning, and decryption of documents. It neither runs other programs, nor uses the file system,
+// or devices, so it builds for WebAssembly on its own, for the offline restore tool (see wasm).
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/caarlos0/log"
+)
+
+const BytesPerLine = 24
+
+const (
+	HeaderFieldVersion         = "PaperCrypt Version"
+	HeaderFieldFormatVersion   = "Format Version"
+	HeaderFieldSerial          = "Content Serial"
+	HeaderFieldPurpose         = "Purpose"
+	HeaderFieldComment         = "Comment"
+	HeaderFieldDate            = "Date"
+	HeaderFieldExpires         = "Expires"
+	HeaderFieldReviewBy        = "Review By"
+	HeaderFieldSupersedes      = "Supersedes"
+	HeaderFieldMetadata        = "Metadata"
+	HeaderFieldMessage         = "Message"
+	HeaderFieldDataFormat      = "Data Format"
+	HeaderFieldDataEncoding    = "Data Encoding"
+	HeaderFieldDataLayout      = "Data Layout"
+	HeaderFieldLineChecksum    = "Line Checksum"
+	HeaderFieldErrorCorrection = "Error Correction"
+	HeaderFieldContentLength   = "Content Length"
+	HeaderFieldCRC24           = "Content CRC-24"
+	HeaderFieldCRC32           = "Content CRC-32"
+	HeaderFieldSHA256          = "Content SHA-256"
+	HeaderFieldPlaintextSHA256 = "Plaintext SHA-256"
+	HeaderFieldMACAlgorithm    = "MAC Algorithm"
+	HeaderFieldMACSalt         = "MAC Salt"
+	HeaderFieldHeaderMAC       = "Header MAC"
+	HeaderFieldHeaderCRC32     = "Header CRC-32"
+)
+
+// HeaderFieldNames lists the fields of the header, as written by GetText.
+var HeaderFieldNames = []string{
+	HeaderFieldVersion, HeaderFieldFormatVersion, HeaderFieldSerial, HeaderFieldPurpose, HeaderFieldComment, HeaderFieldDate,
+	HeaderFieldExpires, HeaderFieldReviewBy, HeaderFieldSupersedes, HeaderFieldDataFormat, HeaderFieldMetadata,
+	HeaderFieldDataEncoding, HeaderFieldDataLayout, HeaderFieldLineChecksum,
+	HeaderFieldErrorCorrection, HeaderFieldContentLength, HeaderFieldCRC24, HeaderFieldCRC32,
+	HeaderFieldSHA256, HeaderFieldPlaintextSHA256, HeaderFieldMACAlgorithm, HeaderFieldMACSalt, HeaderFieldHeaderMAC,
+	HeaderFieldHeaderCRC32,
+}
+
+var (
+	errorParsingHeader     = errors.New("error parsing header")
+	errorParsingBody       = errors.New("error parsing body")
+	errorValidationFailure = WithCategory(ErrorCategoryChecksum, errors.New("validation failure"))
+)
+
+type PaperCrypt struct {
+	// Version is the version of papercrypt used to generate the document.
+	Version string `json:"v"`
+
+	// DataFormat determines whether the data is raw (although still gzipped), or follows the PGP message format (gzipped).
+	DataFormat PaperCryptDataFormat `json:"f"`
+
+	// SerialNumber is the serial number of document, used to identify it. It is generated randomly if not provided.
+	SerialNumber string `json:"sn"`
+
+	// Purpose is the purpose of document
+	Purpose string `json:"p"`
+
+	// Comment is the comment on document
+	Comment string `json:"cm"`
+
+	// CreatedAt is the creation timestamp
+	CreatedAt time.Time `json:"ct"`
+
+	// ExpiresAt is the date after which the content is no longer valid, such as a key that is rotated, it is optional (zero).
+	ExpiresAt time.Time `json:"-"`
+
+	// ReviewBy is the date by which the document should be printed again, and verified, it is optional (zero).
+	ReviewBy time.Time `json:"-"`
+
+	// Supersedes is the serial number of the document this one replaces, such as one whose passphrase was rotated,
+	// it is optional (empty).
+	Supersedes string `json:"sup,omitempty"`
+
+	// PrivateMetadata is true if the purpose and comment are encrypted along with the data (see WrapPrivateMetadata),
+	// they are empty until the document is decoded.
+	PrivateMetadata bool `json:"pm,omitempty"`
+
+	// ExternalMessage is true if the data is an OpenPGP message encrypted by other software, such as gpg
+	// (see NewPaperCryptFromPGPMessage), its plaintext is not compressed by PaperCrypt, and is decoded as it is.
+	ExternalMessage bool `json:"em,omitempty"`
+
+	// DataCRC24 is the CRC-24 checksum of the encrypted data
+	DataCRC24 uint32 `json:"d_c24"`
+
+	// DataCRC32 is the CRC-32 checksum of the encrypted data
+	DataCRC32 uint32 `json:"d_c32"`
+
+	// DataSHA256 is the SHA-256 checksum of the encrypted data
+	DataSHA256 [32]byte `json:"d_s256"`
+
+	// PlaintextSHA256 is the SHA-256 checksum of the decrypted and decompressed data, it is optional,
+	// as it allows anyone holding the document to confirm guesses of its contents
+	PlaintextSHA256 []byte `json:"p_s256,omitempty"`
+
+	// FormatVersion is the version of the container format, PaperCryptContainerVersionMajor3 for documents with a header MAC,
+	// it is unknown (zero) for earlier documents, whose version follows from Version.
+	FormatVersion PaperCryptContainerVersion `json:"fv,omitempty"`
+
+	// HeaderMAC authenticates the header of documents of PaperCryptContainerVersionMajor3, see Authenticate.
+	HeaderMAC *HeaderMAC `json:"mac,omitempty"`
+
+	// Data is the contents of the document
+	// it can be either of two formats:
+	//   a) ASCII armored OpenPGP data, if DataFormat is PGP
+	//      the contained message is gzipped before encryption
+	//   b) Raw data of any kind, if DataFormat is Raw
+	// either way, data is always gzipped after processing
+	Data []byte `json:"d"`
+}
+
+func (p *PaperCrypt) MarshalJSON() ([]byte, error) { // nosemgrep
+	type Alias PaperCrypt
+	return json.Marshal(&struct {
+		CreatedAt  string `json:"ct"`
+		ExpiresAt  string `json:"ex,omitempty"`
+		ReviewBy   string `json:"rb,omitempty"`
+		DataSHA256 string `json:"d_s256"`
+		*Alias
+	}{
+		CreatedAt:  FormatTimeStamp(p.CreatedAt),
+		ExpiresAt:  FormatDueDate(p.ExpiresAt),
+		ReviewBy:   FormatDueDate(p.ReviewBy),
+		DataSHA256: base64.StdEncoding.EncodeToString(p.DataSHA256[:]),
+		Alias:      (*Alias)(p),
+	})
+}
+
+func (p *PaperCrypt) UnmarshalJSON(data []byte) error {
+	type Alias PaperCrypt
+	aux := &struct {
+		CreatedAt  string `json:"ct"`
+		ExpiresAt  string `json:"ex,omitempty"`
+		ReviewBy   string `json:"rb,omitempty"`
+		DataSHA256 string `json:"d_s256"`
+		*Alias
+	}{
+		Alias: (*Alias)(p),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(TimeStampFormatLong, aux.CreatedAt)
+	if err != nil {
+		return err
+	}
+	p.CreatedAt = createdAt
+
+	if p.ExpiresAt, err = ParseOptionalDueDate(aux.ExpiresAt); err != nil {
+		return err
+	}
+	if p.ReviewBy, err = ParseOptionalDueDate(aux.ReviewBy); err != nil {
+		return err
+	}
+
+	dataSHA256, err := BytesFromBase64(aux.DataSHA256)
+	if err != nil {
+		return err
+	}
+	copy(p.DataSHA256[:], dataSHA256)
+
+	return nil
+}
+
+// NewPaperCrypt creates a new paper crypt.
+func NewPaperCrypt(version string, data []byte, serialNumber string, purpose string, comment string, createdAt time.Time, format PaperCryptDataFormat) *PaperCrypt {
+	dataCRC24 := Crc24Checksum(data)
+	dataCRC32 := crc32.ChecksumIEEE(data)
+	dataSHA256 := sha256.Sum256(data)
+
+	return &PaperCrypt{
+		Version:      version,
+		Data:         data,
+		SerialNumber: serialNumber,
+		Purpose:      purpose,
+		Comment:      comment,
+		CreatedAt:    createdAt,
+		DataCRC24:    dataCRC24,
+		DataCRC32:    dataCRC32,
+		DataSHA256:   dataSHA256,
+		DataFormat:   format,
+	}
+}
+
+func (p *PaperCrypt) GetDataLength() int {
+	return len(p.Data)
+}
+
+// VerifyPlaintext checks the decrypted data against the plaintext SHA-256 checksum of the document, if present.
+func (p *PaperCrypt) VerifyPlaintext(plaintext []byte) error {
+	if len(p.PlaintextSHA256) == 0 {
+		return nil
+	}
+
+	actual := sha256.Sum256(plaintext)
+	if !bytes.Equal(actual[:], p.PlaintextSHA256) {
+		return errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch: expected %s, got %s", HeaderFieldPlaintextSHA256, FormatSHA256(p.PlaintextSHA256), FormatSHA256(actual[:])))
+	}
+
+	return nil
+}
+
+// ReadBackPhrase returns the read-back phrase of the document, see ReadBackPhrase.
+func (p *PaperCrypt) ReadBackPhrase() string {
+	return ReadBackPhrase(p.DataSHA256)
+}
+
+// EncodingOptions control how the data block of a document is written, see PaperCrypt.GetText.
+type EncodingOptions struct {
+	// LowerCase writes the encoded data and its checksums using lower case letters.
+	LowerCase bool
+
+	// Encoding is the encoding of the data block.
+	Encoding PaperCryptDataEncoding
+
+	// Layout is the layout of the data block, DefaultDataLayout is used if unset.
+	// It does not apply to the armor and words encodings.
+	Layout DataLayout
+
+	// LineChecksum is the checksum algorithm of the lines of the data block, and the block itself.
+	// It does not apply to the armor and words encodings.
+	LineChecksum LineChecksum
+
+	// ErrorCorrectionLevel is the amount of parity lines appended to the data block, in percent of its lines,
+	// 0 disables error correction. It does not apply to the armor and words encodings.
+	ErrorCorrectionLevel int
+}
+
+// DataLayout returns the layout of the data block.
+func (o EncodingOptions) DataLayout() DataLayout {
+	if o.Layout == (DataLayout{}) {
+		return DefaultDataLayout
+	}
+
+	return o.Layout
+}
+
+// ErrorCorrection returns the error correction of a data block of `dataLength` bytes.
+// ok is false if error correction is disabled.
+func (o EncodingOptions) ErrorCorrection(dataLength int) (ecc ErrorCorrection, ok bool, err error) {
+	if o.ErrorCorrectionLevel == 0 {
+		return ErrorCorrection{}, false, nil
+	}
+
+	bytesPerLine := o.DataLayout().BytesPerLine()
+	ecc, err = NewErrorCorrection((dataLength+bytesPerLine-1)/bytesPerLine, o.ErrorCorrectionLevel)
+	return ecc, err == nil, err
+}
+
+func (p *PaperCrypt) GetBinarySerialized(opts EncodingOptions) (string, error) {
+	if p.Data == nil {
+		return "", errors.New("no data to serialize")
+	}
+
+	if len(p.Data) == 0 {
+		return "", errors.New("no data to serialize")
+	}
+
+	switch opts.Encoding {
+	case PaperCryptDataEncodingArmor:
+		return ArmorData(p.Data)
+	case PaperCryptDataEncodingWords:
+		return EncodeWordStream(p.DataFormat, p.Data), nil
+	}
+
+	block := SerializeBinaryV2(&p.Data, opts.Encoding, opts.DataLayout(), opts.LineChecksum)
+
+	ecc, ok, err := opts.ErrorCorrection(len(p.Data))
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		bytesPerLine := opts.DataLayout().BytesPerLine()
+		lines := make([][]byte, 0, len(p.Data)/bytesPerLine+1)
+		for i := 0; i < len(p.Data); i += bytesPerLine {
+			lines = append(lines, p.Data[i:min(i+bytesPerLine, len(p.Data))])
+		}
+
+		block += "\n" + SerializeParityLines(ecc.Encode(lines), opts.Encoding, opts.DataLayout(), opts.LineChecksum)
+	}
+
+	return block, nil
+}
+
+// GetText returns the text representation of the paper crypt.
+// Header fields that differ from their defaults (such as the data encoding) are only written if set.
+func (p *PaperCrypt) GetText(opts EncodingOptions) ([]byte, error) {
+	headerFields := [][2]string{
+		{HeaderFieldVersion, p.Version},
+	}
+	if p.FormatVersion != PaperCryptContainerVersionUnknown {
+		headerFields = append(headerFields, [2]string{HeaderFieldFormatVersion, p.FormatVersion.String()})
+	}
+	headerFields = append(headerFields,
+		[2]string{HeaderFieldSerial, p.SerialNumber},
+		[2]string{HeaderFieldPurpose, p.Purpose},
+		[2]string{HeaderFieldComment, p.Comment},
+		// format time with nanosecond precision
+		// Sat, 12 Aug 2023 17:33:20.123456789
+		[2]string{HeaderFieldDate, FormatTimeStamp(p.CreatedAt)},
+	)
+	if !p.ExpiresAt.IsZero() {
+		headerFields = append(headerFields, [2]string{HeaderFieldExpires, FormatDueDate(p.ExpiresAt)})
+	}
+	if !p.ReviewBy.IsZero() {
+		headerFields = append(headerFields, [2]string{HeaderFieldReviewBy, FormatDueDate(p.ReviewBy)})
+	}
+	if p.Supersedes != "" {
+		headerFields = append(headerFields, [2]string{HeaderFieldSupersedes, p.Supersedes})
+	}
+	headerFields = append(headerFields, [2]string{HeaderFieldDataFormat, p.DataFormat.String()})
+	if p.PrivateMetadata {
+		headerFields = append(headerFields, [2]string{HeaderFieldMetadata, HeaderValueMetadataEncrypted})
+	}
+	if p.ExternalMessage {
+		headerFields = append(headerFields, [2]string{HeaderFieldMessage, HeaderValueMessageExternal})
+	}
+	if opts.Encoding != PaperCryptDataEncodingBase16 {
+		headerFields = append(headerFields, [2]string{HeaderFieldDataEncoding, opts.Encoding.String()})
+	}
+	if opts.DataLayout() != DefaultDataLayout {
+		headerFields = append(headerFields, [2]string{HeaderFieldDataLayout, opts.DataLayout().String()})
+	}
+	if opts.LineChecksum != LineChecksumCRC24 {
+		headerFields = append(headerFields, [2]string{HeaderFieldLineChecksum, opts.LineChecksum.String()})
+	}
+	ecc, hasErrorCorrection, err := opts.ErrorCorrection(p.GetDataLength())
+	if err != nil {
+		return nil, err
+	}
+	if hasErrorCorrection {
+		headerFields = append(headerFields, [2]string{HeaderFieldErrorCorrection, ecc.String()})
+	}
+	headerFields = append(headerFields,
+		[2]string{HeaderFieldContentLength, fmt.Sprint(p.GetDataLength())},
+		[2]string{HeaderFieldCRC24, fmt.Sprintf("%06x", p.DataCRC24)},
+		[2]string{HeaderFieldCRC32, fmt.Sprintf("%08x", p.DataCRC32)},
+		[2]string{HeaderFieldSHA256, base64.StdEncoding.EncodeToString(p.DataSHA256[:])},
+	)
+	if len(p.PlaintextSHA256) > 0 {
+		headerFields = append(headerFields, [2]string{HeaderFieldPlaintextSHA256, base64.StdEncoding.EncodeToString(p.PlaintextSHA256)})
+	}
+	if p.HeaderMAC != nil {
+		headerFields = append(headerFields, p.HeaderMAC.headerFields()...)
+	}
+
+	headerLines := make([]string, len(headerFields))
+	for i, field := range headerFields {
+		headerLines[i] = fmt.Sprintf("%s: %s", field[0], field[1])
+	}
+	header := strings.Join(headerLines, "\n")
+
+	headerCRC32 := crc32.ChecksumIEEE([]byte(header))
+
+	serializedData, err := p.GetBinarySerialized(opts)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to get serialized data"), err)
+	}
+	if opts.LowerCase {
+		if opts.Encoding.IsCaseSensitive() {
+			return nil, fmt.Errorf("lower case letters are not supported by the %s encoding", opts.Encoding)
+		}
+
+		serializedData = strings.ToLower(serializedData)
+	}
+
+	return []byte(
+		fmt.Sprintf(`%s
+%s: %08x
+
+
+%s
+`,
+			header,
+			HeaderFieldHeaderCRC32,
+			headerCRC32,
+			serializedData)), nil
+}
+
+// MaxContentLength is the largest content length accepted in the header of a document, far more than can be printed,
+// so damaged or malicious headers can not have the data block read into an arbitrarily large buffer.
+const MaxContentLength = 1 << 26
+
+// ParseContentLength parses the content length of a document, see MaxContentLength.
+func ParseContentLength(s string) (int, error) {
+	contentLength, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Join(fmt.Errorf("invalid `%s`", HeaderFieldContentLength), err)
+	}
+	if contentLength < 0 || contentLength > MaxContentLength {
+		return 0, fmt.Errorf("invalid `%s`: %d bytes", HeaderFieldContentLength, contentLength)
+	}
+
+	return contentLength, nil
+}
+
+func newFieldNotPresentError(field string) error {
+	return fmt.Errorf("`%s` not present in header", field)
+}
+
+// ErrDecryption is returned by Decode and DecodePartial, if the data can not be decrypted, mostly with an incorrect passphrase.
+var ErrDecryption = WithCategory(ErrorCategoryPassphrase, errors.New("error decrypting secret contents"))
+
+func (p *PaperCrypt) Decode(passphrase []byte) ([]byte, error) {
+	data, err := p.DecodeWith(func(message []byte) ([]byte, error) {
+		decryptedMessage, err := crypto.DecryptMessageWithPassword(crypto.NewPGPMessage(message), passphrase)
+		if err != nil {
+			return nil, errors.Join(ErrDecryption, err)
+		}
+
+		return decryptedMessage.GetBinary(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the header MAC is checked once the passphrase is known to be right, so a wrong one is reported as such
+	if err := p.VerifyHeaderMAC(passphrase); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// DecodeWith is Decode, with the OpenPGP message decrypted by decrypt, rather than using a passphrase,
+// such as by another implementation of OpenPGP (see GnuPG.DecryptSymmetric).
+func (p *PaperCrypt) DecodeWith(decrypt func(message []byte) ([]byte, error)) ([]byte, error) {
+	data := p.Data
+	if p.DataFormat == PaperCryptDataFormatPGP {
+		// 1. Decompress
+		gzipReader, err := gzip.NewReader(bytes.NewReader(p.Data))
+		if err != nil {
+			return nil, errors.Join(errors.New("error creating gzip reader"), err)
+		}
+
+		decompressed := new(bytes.Buffer)
+		if _, err := decompressed.ReadFrom(gzipReader); err != nil {
+			return nil, errors.Join(errors.New("error reading from gzip reader"), err)
+		}
+		if err := gzipReader.Close(); err != nil {
+			return nil, errors.Join(errors.New("error closing gzip reader"), err)
+		}
+
+		// 9. Decrypt secretContents
+		data, err = decrypt(decompressed.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		// messages encrypted by other software are not compressed before encryption, see ExternalMessage
+		if p.ExternalMessage {
+			return p.revealPrivateMetadata(data)
+		}
+	}
+
+	// 10. Decompress content
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Join(errors.New("error creating gzip reader"), err)
+	}
+
+	decompressed := new(bytes.Buffer)
+	if _, err := decompressed.ReadFrom(gzipReader); err != nil {
+		return nil, errors.Join(errors.New("error reading from gzip reader"), err)
+	}
+	if err := gzipReader.Close(); err != nil {
+		return nil, errors.Join(errors.New("error closing gzip reader"), err)
+	}
+
+	return p.revealPrivateMetadata(decompressed.Bytes())
+}
+
+func TextToHeaderMap(text []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+
+	headerLines := bytes.Split(text, []byte("\n"))
+	for _, headerLine := range headerLines {
+		headerLineSplit := bytes.SplitN(headerLine, []byte(": "), 2)
+		if len(headerLineSplit) != 2 {
+			return nil, errors.Join(errorParsingHeader, fmt.Errorf("error parsing header line: %s", headerLine))
+		}
+
+		key := string(headerLineSplit[0])
+		key = strings.TrimPrefix(key, "# ")
+
+		headers[key] = string(headerLineSplit[1])
+	}
+
+	return headers, nil
+}
+
+func SplitTextHeaderAndBody(data []byte) ([]byte, []byte, error) {
+	dataSplit := bytes.SplitN(data, []byte("\n\n\n"), 2)
+	if len(dataSplit) != 2 {
+		return nil, nil, errors.New("header not discernible, header and content should be separated by two empty lines")
+	}
+	return dataSplit[0], dataSplit[1], nil
+}
+
+// DeserializeText deserializes the text of a document of any major version, told by its header.
+func DeserializeText(data []byte, ignoreVersionMismatch bool, ignoreChecksumMismatch bool) (*PaperCrypt, error) {
+	headersSection, bodySection, err := SplitTextHeaderAndBody(data)
+	if err != nil {
+		return nil, errors.Join(errors.New("header not found"), err)
+	}
+	if len(bodySection) == 0 {
+		return nil, errors.New("no content found")
+	}
+
+	headers, err := TextToHeaderMap(headersSection)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading headers"), err)
+	}
+
+	version, err := textContainerVersion(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var pc *PaperCrypt
+	switch version {
+	case PaperCryptContainerVersionMajor1:
+		pc, err = DeserializeV1Text(data, ignoreVersionMismatch, ignoreChecksumMismatch)
+	case PaperCryptContainerVersionDevel,
+		PaperCryptContainerVersionMajor2,
+		PaperCryptContainerVersionMajor3:
+		// version 3 adds the header MAC to the header of version 2
+		pc, err = DeserializeV2Text(data, ignoreVersionMismatch, ignoreChecksumMismatch)
+	default:
+		return nil, WithCategory(ErrorCategoryVersion, errors.New("unknown version"))
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("error deserializing PaperCrypt document"), err)
+	}
+
+	return pc, nil
+}
+
+// textContainerVersion returns the container format version of a document, from its Format Version,
+// or, for documents before version 3, its PaperCrypt Version.
+func textContainerVersion(headers map[string]string) (PaperCryptContainerVersion, error) {
+	formatVersion := PaperCryptContainerVersionUnknown
+	if value, ok := headers[HeaderFieldFormatVersion]; ok {
+		var err error
+		formatVersion, err = ParseFormatVersion(value)
+		if err != nil {
+			return PaperCryptContainerVersionUnknown, errors.Join(errorParsingHeader, err)
+		}
+	}
+
+	return NegotiateContainerVersion(headers[HeaderFieldVersion], formatVersion)
+}
+
+func DeserializeV2Text(data []byte, ignoreVersionMismatch bool, ignoreChecksumMismatch bool) (*PaperCrypt, error) {
+	pc, _, err := deserializeV2Text(data, ignoreVersionMismatch, ignoreChecksumMismatch, false)
+	return pc, err
+}
+
+// DeserializeV2TextPartial deserializes a document like DeserializeV2Text, but does not fail if lines of the data block
+// are missing, or damaged beyond repair: their bytes are filled with zeros, and returned as lost byte ranges,
+// for DecodePartial. Content checksum mismatches are reported as warnings, if bytes are lost.
+func DeserializeV2TextPartial(data []byte, ignoreVersionMismatch bool) (*PaperCrypt, []ByteRange, error) {
+	return deserializeV2Text(data, ignoreVersionMismatch, false, true)
+}
+
+func deserializeV2Text(data []byte, ignoreVersionMismatch bool, ignoreChecksumMismatch bool, partial bool) (*PaperCrypt, []ByteRange, error) {
+	paperCryptFileContents := NormalizeLineEndings(data)
+
+	headersSection, bodySection, err := SplitTextHeaderAndBody(paperCryptFileContents)
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingHeader, err)
+	}
+
+	headers, err := TextToHeaderMap(headersSection)
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingHeader, err)
+	}
+
+	// Debug: print headers
+	log.WithField("headers", headers).Debug("Read headers")
+
+	// 4. Run Header Validation
+	versionLine, ok := headers[HeaderFieldVersion]
+	if !ok {
+		if !ignoreVersionMismatch {
+			return nil, nil, errors.Join(errorParsingHeader, newFieldNotPresentError(HeaderFieldVersion))
+		}
+
+		log.Warn(Warning("PaperCrypt Version not present in header."))
+	}
+
+	majorVersion, err := textContainerVersion(headers)
+	if err != nil {
+		if !ignoreVersionMismatch {
+			return nil, nil, err
+		}
+
+		log.Warn(Warning(err.Error()))
+	}
+	if !ignoreVersionMismatch && !(majorVersion == PaperCryptContainerVersionMajor2 || majorVersion == PaperCryptContainerVersionMajor3 || majorVersion == PaperCryptContainerVersionDevel) {
+		return nil, nil, errors.Join(errorParsingHeader, WithCategory(ErrorCategoryVersion, fmt.Errorf("unsupported PaperCrypt version '%s'", versionLine)))
+	}
+
+	var headerMAC *HeaderMAC
+	if majorVersion == PaperCryptContainerVersionMajor3 {
+		headerMAC, err = parseHeaderMAC(headers)
+		if err != nil {
+			return nil, nil, errors.Join(errorParsingHeader, err)
+		}
+	}
+
+	// Validate Header checksum
+	{
+		headerCrc, ok := headers[HeaderFieldHeaderCRC32]
+		if !ok {
+			if !ignoreChecksumMismatch {
+				return nil, nil, errors.Join(errorParsingHeader, newFieldNotPresentError(HeaderFieldHeaderCRC32))
+			}
+
+			log.Warn(Warning("Header CRC-32 not present in header"))
+		}
+
+		headerCrc = strings.ToLower(headerCrc)
+		headerCrc = strings.ReplaceAll(headerCrc, "0x", "")
+		headerCrc = strings.ReplaceAll(headerCrc, " ", "")
+		headerCrc32, err := ParseHexUint32(headerCrc)
+		if err != nil {
+			return nil, nil, errors.Join(errorParsingHeader, errors.New("invalid CRC-32 format"), err)
+		}
+
+		headerWithoutCrc := bytes.ReplaceAll(headersSection, []byte("# "), []byte{})
+		headerWithoutCrc = bytes.ReplaceAll(headerWithoutCrc, []byte("\n"+HeaderFieldHeaderCRC32+": "+headers[HeaderFieldHeaderCRC32]), []byte{})
+
+		trace("comparing header checksum", "written", headers[HeaderFieldHeaderCRC32], "computed", fmt.Sprintf("%x", crc32.ChecksumIEEE(headerWithoutCrc)))
+		if !ValidateCRC32(headerWithoutCrc, headerCrc32) {
+			if !ignoreChecksumMismatch {
+				return nil, nil, errors.Join(errorParsingHeader, errorValidationFailure, errors.New("header CRC-32 mismatch: expected "+headers[HeaderFieldHeaderCRC32]+", got "+fmt.Sprintf("%x", crc32.ChecksumIEEE(headerWithoutCrc))))
+			}
+
+			log.Warn(Warning("Header CRC-32 mismatch!"))
+		}
+	}
+
+	var dataFormat PaperCryptDataFormat
+	{
+		dataFormatString, ok := headers[HeaderFieldDataFormat]
+		if !ok {
+			return nil, nil, errors.Join(errorParsingHeader, newFieldNotPresentError(HeaderFieldDataFormat))
+		}
+
+		log.Debugf("Data Format: %s", dataFormatString)
+
+		dataFormat = PaperCryptDataFormatFromString(dataFormatString)
+	}
+
+	privateMetadata := false
+	if metadata, ok := headers[HeaderFieldMetadata]; ok {
+		if metadata != HeaderValueMetadataEncrypted {
+			return nil, nil, errors.Join(errorParsingHeader, fmt.Errorf("unsupported metadata '%s'", metadata))
+		}
+		privateMetadata = true
+	}
+
+	externalMessage := false
+	if message, ok := headers[HeaderFieldMessage]; ok {
+		if message != HeaderValueMessageExternal {
+			return nil, nil, errors.Join(errorParsingHeader, fmt.Errorf("unsupported message '%s'", message))
+		}
+		externalMessage = true
+	}
+
+	dataEncoding := DetectDataEncoding(bodySection)
+	if dataEncodingString, ok := headers[HeaderFieldDataEncoding]; !ok {
+		log.Debugf("Data Encoding (detected): %s", dataEncoding)
+	} else {
+		log.Debugf("Data Encoding: %s", dataEncodingString)
+
+		dataEncoding = PaperCryptDataEncodingFromString(dataEncodingString)
+		if dataEncoding == PaperCryptDataEncodingUnknown {
+			return nil, nil, errors.Join(errorParsingHeader, fmt.Errorf("unsupported data encoding '%s'", dataEncodingString))
+		}
+	}
+
+	dataLayout := DefaultDataLayout
+	if dataLayoutString, ok := headers[HeaderFieldDataLayout]; ok {
+		log.Debugf("Data Layout: %s", dataLayoutString)
+
+		dataLayout, err = ParseDataLayout(dataLayoutString)
+		if err != nil {
+			return nil, nil, errors.Join(errorParsingHeader, err)
+		}
+	}
+
+	lineChecksum := LineChecksumCRC24
+	if lineChecksumString, ok := headers[HeaderFieldLineChecksum]; ok {
+		log.Debugf("Line Checksum: %s", lineChecksumString)
+
+		lineChecksum = LineChecksumFromString(lineChecksumString)
+		if lineChecksum == LineChecksumUnknown {
+			return nil, nil, errors.Join(errorParsingHeader, fmt.Errorf("unsupported line checksum '%s'", lineChecksumString))
+		}
+	}
+
+	errorCorrectionString, hasErrorCorrection := headers[HeaderFieldErrorCorrection]
+	var errorCorrection ErrorCorrection
+	contentLength := 0
+	if hasErrorCorrection {
+		log.Debugf("Error Correction: %s", errorCorrectionString)
+
+		errorCorrection, err = ParseErrorCorrection(errorCorrectionString)
+		if err != nil {
+			return nil, nil, errors.Join(errorParsingHeader, err)
+		}
+	}
+	if hasErrorCorrection || partial {
+		// the content length is required to tell which lines are missing
+		contentLength, err = ParseContentLength(headers[HeaderFieldContentLength])
+		if err != nil {
+			return nil, nil, errors.Join(errorParsingHeader, err)
+		}
+
+		if hasErrorCorrection {
+			dataLines := (contentLength + dataLayout.BytesPerLine() - 1) / dataLayout.BytesPerLine()
+			if err := errorCorrection.CheckDataLines(dataLines); err != nil {
+				return nil, nil, errors.Join(errorParsingHeader, err)
+			}
+		}
+	}
+
+	trace("reading body", "encoding", dataEncoding, "ecc", hasErrorCorrection, "partial", partial, "length", contentLength)
+
+	var pgpMessage *crypto.PGPMessage
+	var body []byte
+	var lost []ByteRange
+	switch dataEncoding {
+	case PaperCryptDataEncodingArmor:
+		body, err = UnarmorData(bodySection)
+	case PaperCryptDataEncodingWords:
+		var streamFormat PaperCryptDataFormat
+		streamFormat, body, err = DecodeWordStream(bodySection)
+		if err == nil && streamFormat != dataFormat {
+			err = fmt.Errorf("data format of the word stream (%s) does not match the header (%s)", streamFormat, dataFormat)
+		}
+	default:
+		if partial {
+			var ecc *ErrorCorrection
+			if hasErrorCorrection {
+				ecc = &errorCorrection
+			}
+			body, lost, err = DeserializeBinaryPartial(&bodySection, dataEncoding, dataLayout, lineChecksum, ecc, contentLength)
+		} else if hasErrorCorrection {
+			body, err = DeserializeBinaryWithParity(&bodySection, dataEncoding, dataLayout, lineChecksum, errorCorrection, contentLength)
+		} else {
+			body, err = DeserializeBinaryEncoded(&bodySection, dataEncoding, dataLayout, lineChecksum)
+		}
+	}
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingBody, err)
+	}
+	if len(lost) > 0 {
+		// the checksums of the content can not match
+		ignoreChecksumMismatch = true
+	}
+
+	switch dataFormat {
+	case PaperCryptDataFormatPGP:
+		pgpMessage = crypto.NewPGPMessage(body)
+		body = pgpMessage.GetBinary()
+	case PaperCryptDataFormatRaw:
+		// do nothing
+	default:
+		return nil, nil, errors.Join(errorParsingBody, errors.New("unsupported data format"))
+	}
+
+	// 5. Verify Body Hashes
+
+	// 5.1 Verify Content Length
+	bodyLength, ok := headers[HeaderFieldContentLength]
+	if !ok {
+		return nil, nil, errors.Join(errorParsingBody, newFieldNotPresentError(HeaderFieldContentLength))
+	}
+
+	if fmt.Sprint(len(body)) != bodyLength {
+		return nil, nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch: expected %s, got %d", HeaderFieldContentLength, bodyLength, len(body)))
+	}
+
+	// 5.2 Verify CRC-32
+	bodyCrc32, ok := headers[HeaderFieldCRC32]
+	if !ok {
+		return nil, nil, errors.Join(errorValidationFailure, newFieldNotPresentError(HeaderFieldCRC32))
+	}
+
+	bodyCrc32Uint32, err := ParseHexUint32(bodyCrc32)
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingBody, err)
+	}
+
+	if !ValidateCRC32(body, bodyCrc32Uint32) {
+		if !ignoreChecksumMismatch {
+			return nil, nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch", HeaderFieldCRC32))
+		}
+
+		log.Warn(Warning("Content CRC-32 mismatch!"))
+	}
+
+	// 5.3 Verify CRC-24
+	bodyCrc24, ok := headers[HeaderFieldCRC24]
+	if !ok {
+		return nil, nil, errors.Join(errorParsingBody, newFieldNotPresentError(HeaderFieldCRC24))
+	}
+
+	bodyCrc24Uint32, err := ParseHexUint32(bodyCrc24)
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingBody, err)
+	}
+
+	if !ValidateCRC24(body, bodyCrc24Uint32) {
+		if !ignoreChecksumMismatch {
+			return nil, nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch", HeaderFieldCRC24))
+		}
+
+		log.Warn(Warning("Content CRC-24 mismatch!"))
+	}
+
+	// 5.4 Verify SHA-256
+	bodySha256, ok := headers[HeaderFieldSHA256]
+	if !ok {
+		return nil, nil, errors.Join(errorParsingBody, newFieldNotPresentError(HeaderFieldSHA256))
+	}
+
+	bodySha256Bytes, err := BytesFromBase64(bodySha256)
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingBody, err)
+	}
+
+	actualSha256 := sha256.Sum256(body)
+	if !bytes.Equal(actualSha256[:], bodySha256Bytes) {
+		if !ignoreChecksumMismatch {
+			return nil, nil, errors.Join(errorValidationFailure, fmt.Errorf("`%s` mismatch", HeaderFieldSHA256))
+		}
+
+		log.Warn(Warning("Content SHA-256 mismatch!"))
+	}
+
+	// 5.5 Read plaintext SHA-256, it can only be verified after decryption
+	var plaintextSha256Bytes []byte
+	if plaintextSha256, ok := headers[HeaderFieldPlaintextSHA256]; ok {
+		plaintextSha256Bytes, err = BytesFromBase64(plaintextSha256)
+		if err != nil || len(plaintextSha256Bytes) != sha256.Size {
+			return nil, nil, errors.Join(errorParsingHeader, fmt.Errorf("invalid `%s`", HeaderFieldPlaintextSHA256), err)
+		}
+	}
+
+	// 5.6 Read the dates the document expires, and is to be reviewed by, if present
+	expiresAt, err := ParseOptionalDueDate(headers[HeaderFieldExpires])
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingHeader, fmt.Errorf("invalid `%s`", HeaderFieldExpires), err)
+	}
+	reviewBy, err := ParseOptionalDueDate(headers[HeaderFieldReviewBy])
+	if err != nil {
+		return nil, nil, errors.Join(errorParsingHeader, fmt.Errorf("invalid `%s`", HeaderFieldReviewBy), err)
+	}
+
+	// 6. Construct PaperCrypt object
+	headerDate, ok := headers[HeaderFieldDate]
+	if !ok {
+		log.Warn(Warning("Date not present in header!"))
+	}
+
+	timestamp, err := time.Parse(TimeStampFormatLong, headerDate)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("invalid date format"), err)
+	}
+
+	// we don't need to pass the checksums, as they are already verified
+	// and will just be recalculated
+	paperCrypt := NewPaperCrypt(
+		versionLine,
+		body,
+		headers[HeaderFieldSerial],
+		headers[HeaderFieldPurpose],
+		headers[HeaderFieldComment],
+		timestamp,
+		dataFormat,
+	)
+	paperCrypt.PlaintextSHA256 = plaintextSha256Bytes
+	paperCrypt.ExpiresAt = expiresAt
+	paperCrypt.ReviewBy = reviewBy
+	paperCrypt.Supersedes = headers[HeaderFieldSupersedes]
+	paperCrypt.PrivateMetadata = privateMetadata
+	paperCrypt.ExternalMessage = externalMessage
+	if headerMAC != nil {
+		paperCrypt.FormatVersion = majorVersion
+		paperCrypt.HeaderMAC = headerMAC
+	}
+
+	// 7. Serialize PaperCrypt object
+	_, err = json.MarshalIndent(paperCrypt, "", "  ")
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("error encoding JSON"), err)
+	}
+	log.WithField("json", paperCrypt).Debug("Serialized PaperCrypt document")
+
+	return paperCrypt, lost, nil
+}
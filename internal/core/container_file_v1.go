@@ -18,7 +18,7 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  */
 
-package internal
+package core
 
 import (
 	"bytes"
@@ -213,7 +213,7 @@ func DeserializeV1Text(data []byte, ignoreVersionMismatch bool, ignoreChecksumMi
 	majorVersion := strings.Split(versionLine, ".")[0]
 	majorVersion = strings.TrimPrefix(majorVersion, "v")
 	if !ignoreVersionMismatch && !(majorVersion == "2" || majorVersion == "1" || majorVersion == "devel") {
-		return nil, errors.Join(errorParsingHeader, fmt.Errorf("unsupported PaperCrypt version '%s'", versionLine))
+		return nil, errors.Join(errorParsingHeader, WithCategory(ErrorCategoryVersion, fmt.Errorf("unsupported PaperCrypt version '%s'", versionLine)))
 	}
 
 	// Validate Header checksum
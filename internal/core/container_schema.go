@@ -0,0 +1,387 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContainerSchema is the JSON Schema of documents in their JSON serialization, as held by the 2D code, and attached to the PDF,
+// of all container format versions. ValidateContainerJSON checks documents against it, and their checksums.
+//
+//go:embed schema/container.schema.json
+var ContainerSchema []byte
+
+// ValidationProblem is a way in which a document does not follow ContainerSchema, or does not match its checksums.
+type ValidationProblem struct {
+	// Field is the key the problem is found at, such as "mac.s", empty for the document as a whole.
+	Field string
+
+	// Message describes the problem.
+	Message string
+
+	// Checksum is true for checksums not matching the data, rather than problems of the structure of the document.
+	Checksum bool
+}
+
+func (p ValidationProblem) String() string {
+	if p.Field == "" {
+		return p.Message
+	}
+
+	return fmt.Sprintf("%s: %s", p.Field, p.Message)
+}
+
+// jsonField is a key of the JSON object of a document, checked by check, which returns the value read, if any.
+type jsonField struct {
+	name     string
+	required bool
+	check    func(value any) (any, error)
+}
+
+// containerFieldsV1 are the keys of documents of PaperCrypt 1.x.
+var containerFieldsV1 = []jsonField{
+	{"Version", true, checkJSONString},
+	{"Data", true, checkJSONObject([]jsonField{{"Data", true, checkJSONBase64(1, 0)}})},
+	{"SerialNumber", true, checkJSONString},
+	{"Purpose", true, checkJSONString},
+	{"Comment", true, checkJSONString},
+	{"CreatedAt", true, checkJSONTime(time.RFC3339Nano)},
+	{"DataCRC24", true, checkJSONUint(0xFFFFFF)},
+	{"DataCRC32", true, checkJSONUint(0xFFFFFFFF)},
+	{"DataSHA256", true, checkJSONByteArray(sha256.Size)},
+}
+
+// containerFields returns the keys of documents of container format version 2, or, with authenticated set, 3.
+func containerFields(authenticated bool) []jsonField {
+	fields := []jsonField{
+		{"v", true, checkJSONString},
+		{"fv", true, checkJSONFormatVersion},
+		{"f", true, checkJSONUint(uint64(PaperCryptDataFormatRaw))},
+		{"sn", true, checkJSONString},
+		{"p", true, checkJSONString},
+		{"cm", true, checkJSONString},
+		{"ct", true, checkJSONTime(TimeStampFormatLong)},
+		{"ex", false, checkJSONTime(TimeStampFormatDate)},
+		{"rb", false, checkJSONTime(TimeStampFormatDate)},
+		{"sup", false, checkJSONString},
+		{"pm", false, checkJSONBool},
+		{"em", false, checkJSONBool},
+		{"d_c24", true, checkJSONUint(0xFFFFFF)},
+		{"d_c32", true, checkJSONUint(0xFFFFFFFF)},
+		{"d_s256", true, checkJSONBase64(sha256.Size, sha256.Size)},
+		{"p_s256", false, checkJSONBase64(sha256.Size, sha256.Size)},
+		{"mac", true, checkJSONObject([]jsonField{
+			{"a", true, checkJSONMACAlgorithm},
+			{"s", true, checkJSONBase64(8, 64)},
+			{"m", true, checkJSONBase64(sha256.Size, sha256.Size)},
+		})},
+		{"d", true, checkJSONBase64(1, 0)},
+	}
+	if !authenticated {
+		// the format version, and header MAC, are unknown to version 2
+		fields = slices.DeleteFunc(fields, func(field jsonField) bool { return field.name == "fv" || field.name == "mac" })
+	}
+
+	return fields
+}
+
+// ValidateContainerJSON checks a document in its JSON serialization against ContainerSchema, and its checksums against its data,
+// so documents written by other programs can be confirmed to be read by PaperCrypt. It returns the container format version
+// of the document, and the problems found, none for a valid document.
+// The header MAC of documents of format version 3 is keyed by the passphrase, it is checked by PaperCrypt.Decode.
+func ValidateContainerJSON(data []byte) (PaperCryptContainerVersion, []ValidationProblem) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil {
+		return PaperCryptContainerVersionUnknown, []ValidationProblem{{Message: fmt.Sprintf("not a JSON object: %s", err)}}
+	}
+	if decoder.More() {
+		return PaperCryptContainerVersionUnknown, []ValidationProblem{{Message: "unexpected data after the JSON object"}}
+	}
+
+	var version PaperCryptContainerVersion
+	var fields []jsonField
+	_, hasFormatVersion := document["fv"]
+	switch {
+	case document["Version"] != nil:
+		version, fields = PaperCryptContainerVersionMajor1, containerFieldsV1
+	case document["v"] != nil && hasFormatVersion:
+		version, fields = PaperCryptContainerVersionMajor3, containerFields(true)
+	case document["v"] != nil:
+		version, fields = PaperCryptContainerVersionMajor2, containerFields(false)
+	default:
+		return PaperCryptContainerVersionUnknown, []ValidationProblem{{Message: "neither `v`, nor `Version` (PaperCrypt 1.x) is present, this is not a PaperCrypt document"}}
+	}
+
+	values, problems := checkJSONFields("", document, fields)
+	if len(problems) > 0 {
+		return version, problems
+	}
+
+	return version, validateContainerChecksums(version, data, values)
+}
+
+// checkJSONFields checks the keys of an object, prefixing the names of fields by prefix, and returns the values read.
+func checkJSONFields(prefix string, object map[string]any, fields []jsonField) (map[string]any, []ValidationProblem) {
+	values := make(map[string]any)
+	var problems []ValidationProblem
+	for _, field := range fields {
+		value, ok := object[field.name]
+		if !ok {
+			if field.required {
+				problems = append(problems, ValidationProblem{Field: prefix + field.name, Message: "required, but missing"})
+			}
+			continue
+		}
+
+		read, err := field.check(value)
+		var nested validationProblems
+		if errors.As(err, &nested) {
+			for _, problem := range nested {
+				problem.Field = prefix + field.name + "." + problem.Field
+				problems = append(problems, problem)
+			}
+			continue
+		}
+		if err != nil {
+			problems = append(problems, ValidationProblem{Field: prefix + field.name, Message: err.Error()})
+			continue
+		}
+		values[field.name] = read
+	}
+
+	var unknown []string
+	for name := range object {
+		if !slices.ContainsFunc(fields, func(field jsonField) bool { return field.name == name }) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		problems = append(problems, ValidationProblem{Field: prefix + name, Message: "unknown key, it would be lost when the document is read"})
+	}
+
+	return values, problems
+}
+
+// validationProblems are the problems of a nested object, returned as the error of its check.
+type validationProblems []ValidationProblem
+
+func (p validationProblems) Error() string {
+	messages := make([]string, len(p))
+	for i, problem := range p {
+		messages[i] = problem.String()
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+func checkJSONObject(fields []jsonField) func(value any) (any, error) {
+	return func(value any) (any, error) {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, errors.New("must be an object")
+		}
+
+		values, problems := checkJSONFields("", object, fields)
+		if len(problems) > 0 {
+			return nil, validationProblems(problems)
+		}
+
+		return values, nil
+	}
+}
+
+func checkJSONString(value any) (any, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("must be a string")
+	}
+
+	return s, nil
+}
+
+func checkJSONBool(value any) (any, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return nil, errors.New("must be true, or false")
+	}
+
+	return b, nil
+}
+
+// checkJSONUint returns a check of integers from 0 to limit.
+func checkJSONUint(limit uint64) func(value any) (any, error) {
+	return func(value any) (any, error) {
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, errors.New("must be a number")
+		}
+
+		n, err := strconv.ParseUint(number.String(), 10, 64)
+		if err != nil || n > limit {
+			return nil, fmt.Errorf("must be an integer from 0 to %d, not %s", limit, number)
+		}
+
+		return n, nil
+	}
+}
+
+// checkJSONBase64 returns a check of base64 encoded strings of at least minLength bytes, and at most maxLength (0 for no limit).
+func checkJSONBase64(minLength int, maxLength int) func(value any) (any, error) {
+	return func(value any) (any, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("must be a base64 encoded string")
+		}
+
+		data, err := base64.StdEncoding.DecodeString(s)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("invalid base64: %s", err)
+		case len(data) < minLength:
+			return nil, fmt.Errorf("must hold at least %d bytes, not %d", minLength, len(data))
+		case maxLength > 0 && len(data) > maxLength:
+			return nil, fmt.Errorf("must hold at most %d bytes, not %d", maxLength, len(data))
+		}
+
+		return data, nil
+	}
+}
+
+// checkJSONByteArray returns a check of arrays of length bytes, written as numbers, as PaperCrypt 1.x did.
+func checkJSONByteArray(length int) func(value any) (any, error) {
+	return func(value any) (any, error) {
+		array, ok := value.([]any)
+		if !ok || len(array) != length {
+			return nil, fmt.Errorf("must be an array of %d bytes", length)
+		}
+
+		data := make([]byte, length)
+		for i, element := range array {
+			n, err := checkJSONUint(0xFF)(element)
+			if err != nil {
+				return nil, fmt.Errorf("byte %d %s", i, err)
+			}
+			data[i] = byte(n.(uint64))
+		}
+
+		return data, nil
+	}
+}
+
+// checkJSONTime returns a check of dates in the layout of time.Parse.
+func checkJSONTime(layout string) func(value any) (any, error) {
+	return func(value any) (any, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("must be a string")
+		}
+
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return nil, fmt.Errorf("must be a date like '%s', not '%s'", layout, s)
+		}
+
+		return t, nil
+	}
+}
+
+func checkJSONFormatVersion(value any) (any, error) {
+	n, err := checkJSONUint(uint64(^uint32(0)))(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return NegotiateContainerVersion("", PaperCryptContainerVersion(n.(uint64)))
+}
+
+func checkJSONMACAlgorithm(value any) (any, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("must be a string")
+	}
+
+	return ParseMACAlgorithm(s)
+}
+
+// validateContainerChecksums checks the checksums of a document, whose structure is valid, against its data,
+// and that PaperCrypt reads it.
+func validateContainerChecksums(version PaperCryptContainerVersion, document []byte, values map[string]any) []ValidationProblem {
+	names := [3]string{"d_c24", "d_c32", "d_s256"}
+	if version == PaperCryptContainerVersionMajor1 {
+		names = [3]string{"DataCRC24", "DataCRC32", "DataSHA256"}
+	}
+
+	var problems []ValidationProblem
+	var data []byte
+	if version == PaperCryptContainerVersionMajor1 {
+		// the checksums of PaperCrypt 1.x cover the OpenPGP message
+		data = values["Data"].(map[string]any)["Data"].([]byte)
+	} else {
+		data = values["d"].([]byte)
+		if !bytes.HasPrefix(data, gzipMagic) {
+			problems = append(problems, ValidationProblem{Field: "d", Message: "the data is not compressed using gzip"})
+		}
+	}
+
+	actualSHA256 := sha256.Sum256(data)
+	checksums := [3][2]string{
+		{fmt.Sprintf("%06x", values[names[0]].(uint64)), fmt.Sprintf("%06x", Crc24Checksum(data))},
+		{fmt.Sprintf("%08x", values[names[1]].(uint64)), fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))},
+		{FormatSHA256(values[names[2]].([]byte)), FormatSHA256(actualSHA256[:])},
+	}
+	for i, checksum := range checksums {
+		if checksum[0] != checksum[1] {
+			problems = append(problems, ValidationProblem{Field: names[i], Message: fmt.Sprintf("does not match the data: expected %s, got %s", checksum[0], checksum[1]), Checksum: true})
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	// the schema, and the checks above, are to match what PaperCrypt reads, this confirms it
+	var err error
+	if version == PaperCryptContainerVersionMajor1 {
+		err = json.Unmarshal(document, &PaperCryptV1{})
+	} else {
+		_, err = DeserializeQRPayload(document)
+	}
+	if err != nil {
+		problems = append(problems, ValidationProblem{Message: fmt.Sprintf("PaperCrypt can not read the document: %s", err)})
+	}
+
+	return problems
+}
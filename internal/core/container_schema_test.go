@@ -0,0 +1,187 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// validDocuments returns a document of each container format version, in its JSON serialization.
+func validDocuments(t *testing.T) map[PaperCryptContainerVersion][]byte {
+	t.Helper()
+
+	createdAt := time.Date(2024, 8, 1, 20, 38, 10, 0, time.UTC)
+	v1, err := json.Marshal(NewPaperCryptV1("1.3.0", crypto.NewPGPMessage([]byte("a message")), "ABC-123", "Purpose", "Comment", createdAt))
+	if err != nil {
+		t.Fatalf("json.Marshal failed with error %s", err)
+	}
+
+	data, err := CompressAndEncrypt([]byte("passphrase"), []byte("content"), false)
+	if err != nil {
+		t.Fatalf("CompressAndEncrypt failed with error %s", err)
+	}
+	pc := NewPaperCrypt("2.0.0", data, "ABC-123", "Purpose", "Comment", createdAt, PaperCryptDataFormatPGP)
+	pc.ReviewBy = createdAt.AddDate(5, 0, 0)
+	v2, err := json.Marshal(pc)
+	if err != nil {
+		t.Fatalf("json.Marshal failed with error %s", err)
+	}
+
+	if err := pc.Authenticate([]byte("passphrase")); err != nil {
+		t.Fatalf("Authenticate failed with error %s", err)
+	}
+	v3, err := json.Marshal(pc)
+	if err != nil {
+		t.Fatalf("json.Marshal failed with error %s", err)
+	}
+
+	return map[PaperCryptContainerVersion][]byte{
+		PaperCryptContainerVersionMajor1: v1,
+		PaperCryptContainerVersionMajor2: v2,
+		PaperCryptContainerVersionMajor3: v3,
+	}
+}
+
+func TestValidateContainerJSON(t *testing.T) {
+	for want, document := range validDocuments(t) {
+		version, problems := ValidateContainerJSON(document)
+		if len(problems) > 0 {
+			t.Errorf("version %s: unexpected problems %v", want, problems)
+		}
+		if version != want {
+			t.Errorf("got: %v, want: %v.", version, want)
+		}
+	}
+}
+
+func TestValidateContainerJSONProblems(t *testing.T) {
+	documents := validDocuments(t)
+
+	tests := []struct {
+		name     string
+		version  PaperCryptContainerVersion
+		change   func(document map[string]any)
+		field    string
+		checksum bool
+	}{
+		{"missing key", PaperCryptContainerVersionMajor2, func(d map[string]any) { delete(d, "sn") }, "sn", false},
+		{"unknown key", PaperCryptContainerVersionMajor2, func(d map[string]any) { d["extra"] = 1 }, "extra", false},
+		{"wrong type", PaperCryptContainerVersionMajor2, func(d map[string]any) { d["d_c32"] = "bc4b3672" }, "d_c32", false},
+		{"out of range", PaperCryptContainerVersionMajor2, func(d map[string]any) { d["d_c24"] = 1 << 24 }, "d_c24", false},
+		{"date", PaperCryptContainerVersionMajor2, func(d map[string]any) { d["ct"] = "2024-08-01" }, "ct", false},
+		{"checksum", PaperCryptContainerVersionMajor2, func(d map[string]any) { d["d_c32"] = 1 }, "d_c32", true},
+		{"v1 checksum", PaperCryptContainerVersionMajor1, func(d map[string]any) { d["DataCRC24"] = 1 }, "DataCRC24", true},
+		{"missing mac", PaperCryptContainerVersionMajor3, func(d map[string]any) { delete(d, "mac") }, "mac", false},
+		{"mac salt", PaperCryptContainerVersionMajor3, func(d map[string]any) { d["mac"].(map[string]any)["s"] = "AA==" }, "mac.s", false},
+		{"future version", PaperCryptContainerVersionMajor3, func(d map[string]any) { d["fv"] = 4 }, "fv", false},
+		{"mac of version 2", PaperCryptContainerVersionMajor3, func(d map[string]any) { delete(d, "fv") }, "mac", false},
+	}
+	for _, test := range tests {
+		var document map[string]any
+		if err := json.Unmarshal(documents[test.version], &document); err != nil {
+			t.Fatalf("json.Unmarshal failed with error %s", err)
+		}
+		test.change(document)
+		data, err := json.Marshal(document)
+		if err != nil {
+			t.Fatalf("json.Marshal failed with error %s", err)
+		}
+
+		_, problems := ValidateContainerJSON(data)
+		if len(problems) != 1 {
+			t.Errorf("%s: got: %v, want: a single problem.", test.name, problems)
+			continue
+		}
+		if problems[0].Field != test.field || problems[0].Checksum != test.checksum {
+			t.Errorf("%s: got: %v, want: %v.", test.name, problems[0], test.field)
+		}
+	}
+
+	for _, document := range []string{"", "[]", `{"Purpose": "none"}`, "{} {}"} {
+		if _, problems := ValidateContainerJSON([]byte(document)); len(problems) == 0 {
+			t.Errorf("Expected %q to be rejected", document)
+		}
+	}
+}
+
+// TestContainerSchemaFields checks that the published schema lists the keys that ValidateContainerJSON checks.
+func TestContainerSchemaFields(t *testing.T) {
+	type object struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var schema struct {
+		Defs map[string]object `json:"$defs"`
+	}
+	if err := json.Unmarshal(ContainerSchema, &schema); err != nil {
+		t.Fatalf("json.Unmarshal failed with error %s", err)
+	}
+
+	keys := func(fields []jsonField, required bool) []string {
+		var names []string
+		for _, field := range fields {
+			if field.required || !required {
+				names = append(names, field.name)
+			}
+		}
+		slices.Sort(names)
+		return names
+	}
+	properties := func(objects ...object) []string {
+		var names []string
+		for _, o := range objects {
+			for name := range o.Properties {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		return names
+	}
+	sorted := func(names []string) []string {
+		names = slices.Clone(names)
+		slices.Sort(names)
+		return names
+	}
+
+	defs := schema.Defs
+	for _, test := range []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"v1 required", sorted(defs["v1"].Required), keys(containerFieldsV1, true)},
+		{"v1 properties", properties(defs["v1"]), keys(containerFieldsV1, false)},
+		{"v2 required", sorted(defs["v2"].Required), keys(containerFields(false), true)},
+		{"v2 properties", properties(defs["v2Properties"]), keys(containerFields(false), false)},
+		{"v3 required", sorted(defs["v3"].Required), keys(containerFields(true), true)},
+		{"v3 properties", properties(defs["v2Properties"], defs["v3"]), keys(containerFields(true), false)},
+	} {
+		if !slices.Equal(test.got, test.want) {
+			t.Errorf("%s: got: %v, want: %v.", test.name, strings.Join(test.got, ", "), strings.Join(test.want, ", "))
+		}
+	}
+}
@@ -18,7 +18,7 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  */
 
-package internal
+package core
 
 import (
 	"hash/crc32"
@@ -46,11 +46,12 @@ func generateCRCTable() {
 	}
 }
 
-func Crc24Checksum(data []byte) uint32 {
-	if crc24Table[0] == 0 {
-		generateCRCTable()
-	}
+func init() {
+	// the first entry of the table is always 0, so it can not tell whether the table was generated
+	generateCRCTable()
+}
 
+func Crc24Checksum(data []byte) uint32 {
 	crc := CRC24Initial
 
 	for _, b := range data {
@@ -0,0 +1,249 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/v2/armor"
+)
+
+type PaperCryptDataEncoding uint8
+
+const (
+	PaperCryptDataEncodingBase16 PaperCryptDataEncoding = 0
+	PaperCryptDataEncodingBase32 PaperCryptDataEncoding = 1
+	PaperCryptDataEncodingBase64 PaperCryptDataEncoding = 2
+	PaperCryptDataEncodingArmor  PaperCryptDataEncoding = 3
+	PaperCryptDataEncodingWords  PaperCryptDataEncoding = 4
+	// PaperCryptDataEncodingUnknown is returned for unknown encoding names.
+	PaperCryptDataEncodingUnknown PaperCryptDataEncoding = 0xFF
+)
+
+const (
+	// base32GroupSize is the number of base32 digits printed together, before a space.
+	base32GroupSize = 4
+	// base64GroupSize is the number of base64 digits printed together, before a space.
+	base64GroupSize = 8
+)
+
+// PaperCryptArmorType is the block type of the data block, when written as ASCII armor.
+const PaperCryptArmorType = "PAPERCRYPT DATA"
+
+// CrockfordBase32 is the base32 encoding using Douglas Crockford's alphabet,
+// which leaves out the letters I, L, O and U, as they are easily confused with 1, 0 and V.
+var CrockfordBase32 = base32.NewEncoding("0123456789ABCDEFGHJKMNPQRSTVWXYZ").WithPadding(base32.NoPadding)
+
+func (e PaperCryptDataEncoding) String() string {
+	switch e {
+	case PaperCryptDataEncodingBase16:
+		return "Base16"
+	case PaperCryptDataEncodingBase32:
+		return "Base32"
+	case PaperCryptDataEncodingBase64:
+		return "Base64"
+	case PaperCryptDataEncodingArmor:
+		return "Armor"
+	case PaperCryptDataEncodingWords:
+		return "Words"
+	default:
+		return "Unknown"
+	}
+}
+
+func PaperCryptDataEncodingFromString(s string) PaperCryptDataEncoding {
+	switch strings.ToLower(s) {
+	case "base16", "hex":
+		return PaperCryptDataEncodingBase16
+	case "base32", "crockford":
+		return PaperCryptDataEncodingBase32
+	case "base64":
+		return PaperCryptDataEncodingBase64
+	case "armor", "armour":
+		return PaperCryptDataEncodingArmor
+	case "words", "pgp-words":
+		return PaperCryptDataEncodingWords
+	default:
+		return PaperCryptDataEncodingUnknown
+	}
+}
+
+// IsCaseSensitive returns whether the digits of the encoding are case-sensitive,
+// in which case the data must not be written using lower case letters.
+func (e PaperCryptDataEncoding) IsCaseSensitive() bool {
+	return e == PaperCryptDataEncodingBase64 || e == PaperCryptDataEncodingArmor
+}
+
+// EncodeLine encodes the data of a single line, returning space separated groups of digits.
+// For base16, groupSize bytes are written per group, other encodings use groups of a fixed number of digits.
+func (e PaperCryptDataEncoding) EncodeLine(data []byte, groupSize int) string {
+	var groups []string
+
+	switch e {
+	case PaperCryptDataEncodingBase32:
+		groups = splitGroups(CrockfordBase32.EncodeToString(data), base32GroupSize)
+	case PaperCryptDataEncodingBase64:
+		groups = splitGroups(base64.StdEncoding.EncodeToString(data), base64GroupSize)
+	default:
+		groups = splitGroups(fmt.Sprintf("%X", data), 2*max(groupSize, 1))
+	}
+
+	return strings.Join(groups, " ")
+}
+
+// DecodeLine decodes the groups of digits of a single line.
+func (e PaperCryptDataEncoding) DecodeLine(groups [][]byte) ([]byte, error) {
+	var joined strings.Builder
+	for _, group := range groups {
+		joined.Write(group)
+	}
+
+	switch e {
+	case PaperCryptDataEncodingBase16:
+		return hex.DecodeString(joined.String())
+	case PaperCryptDataEncodingBase32:
+		return CrockfordBase32.DecodeString(NormalizeCrockfordBase32(joined.String()))
+	case PaperCryptDataEncodingBase64:
+		return base64.StdEncoding.DecodeString(joined.String())
+	default:
+		return nil, fmt.Errorf("unsupported data encoding: %s", e)
+	}
+}
+
+// NormalizeCrockfordBase32 upper-cases the input, and maps the characters
+// Crockford's alphabet leaves out to the digits they are commonly mistaken for.
+func NormalizeCrockfordBase32(s string) string {
+	return strings.NewReplacer(
+		"O", "0",
+		"I", "1",
+		"L", "1",
+		"-", "",
+	).Replace(strings.ToUpper(s))
+}
+
+func splitGroups(s string, size int) []string {
+	groups := make([]string, 0, len(s)/size+1)
+	for i := 0; i < len(s); i += size {
+		groups = append(groups, s[i:min(i+size, len(s))])
+	}
+
+	return groups
+}
+
+// ArmorData writes the data as an ASCII armor block of type PaperCryptArmorType,
+// that is, base64 with a CRC-24 checksum, as defined by OpenPGP.
+func ArmorData(data []byte) (string, error) {
+	return armor.ArmorWithTypeAndCustomHeaders(data, PaperCryptArmorType, "", "")
+}
+
+// UnarmorData reads an ASCII armor block, as written by ArmorData.
+// As empty lines are easily lost when transcribing a document,
+// the empty line separating the armor headers from the data is restored if necessary.
+func UnarmorData(data []byte) ([]byte, error) {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("invalid armor block, expected at least 2 lines, got %d", len(lines))
+	}
+
+	// skip the BEGIN line, and any armor headers
+	headerEnd := 1
+	for headerEnd < len(lines) && strings.Contains(lines[headerEnd], ": ") {
+		headerEnd++
+	}
+
+	armored := strings.Join(lines[:headerEnd], "\n") + "\n\n" + strings.Join(lines[headerEnd:], "\n")
+	return armor.Unarmor(armored)
+}
+
+// DetectDataEncoding guesses the encoding of a data block, for documents that do not state it in their header.
+func DetectDataEncoding(data []byte) PaperCryptDataEncoding {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "-----BEGIN ") {
+		return PaperCryptDataEncodingArmor
+	}
+
+	if firstLine, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n"); IsWordStream(firstLine) {
+		return PaperCryptDataEncodingWords
+	}
+
+	var groups []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if IsColumnIndexLine([]byte(line)) {
+			continue
+		}
+
+		// lines may not be prefixed with their line number
+		if _, after, found := strings.Cut(line, ": "); found {
+			line = after
+		}
+
+		// the last group of a line is its checksum
+		lineGroups := strings.Fields(line)
+		if len(lineGroups) > 1 {
+			groups = append(groups, lineGroups[:len(lineGroups)-1]...)
+		}
+	}
+
+	isBase16 := true
+	hasLower, hasUpper := false, false
+	for _, group := range groups {
+		if len(group)%2 != 0 {
+			isBase16 = false
+		}
+
+		for _, c := range group {
+			switch {
+			case c == '+' || c == '/' || c == '=':
+				return PaperCryptDataEncodingBase64
+			case c >= 'a' && c <= 'z':
+				hasLower = true
+			case c >= 'A' && c <= 'Z':
+				hasUpper = true
+			}
+
+			if !strings.ContainsRune("0123456789ABCDEFabcdef", c) {
+				isBase16 = false
+			}
+		}
+	}
+
+	trace("detecting data encoding", "groups", len(groups), "base16", isBase16, "lowercase", hasLower, "uppercase", hasUpper)
+
+	switch {
+	case isBase16:
+		return PaperCryptDataEncodingBase16
+	case hasLower && hasUpper:
+		// base32 is case-insensitive, and written in a single case
+		return PaperCryptDataEncodingBase64
+	default:
+		return PaperCryptDataEncodingBase32
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDetectDataEncoding(t *testing.T) {
+	data := []byte("PaperCrypt lets you prepare encrypted messages for printing on paper.")
+
+	for _, encoding := range []PaperCryptDataEncoding{
+		PaperCryptDataEncodingBase16,
+		PaperCryptDataEncodingBase32,
+		PaperCryptDataEncodingBase64,
+	} {
+		t.Run(encoding.String(), func(t *testing.T) {
+			encoded := []byte(SerializeBinaryEncoded(&data, encoding, DefaultDataLayout, LineChecksumCRC24))
+			if detected := DetectDataEncoding(encoded); detected != encoding {
+				t.Errorf("Detection was incorrect, got: %s, want: %s.", detected, encoding)
+			}
+		})
+	}
+
+	t.Run("lower case base32", func(t *testing.T) {
+		encoded := []byte(strings.ToLower(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC24)))
+		if detected := DetectDataEncoding(encoded); detected != PaperCryptDataEncodingBase32 {
+			t.Errorf("Detection was incorrect, got: %s, want: %s.", detected, PaperCryptDataEncodingBase32)
+		}
+	})
+
+	t.Run(PaperCryptDataEncodingArmor.String(), func(t *testing.T) {
+		armored, err := ArmorData(data)
+		if err != nil {
+			t.Fatalf("ArmorData failed with error %s", err)
+		}
+
+		if detected := DetectDataEncoding([]byte(armored)); detected != PaperCryptDataEncodingArmor {
+			t.Errorf("Detection was incorrect, got: %s, want: %s.", detected, PaperCryptDataEncodingArmor)
+		}
+	})
+}
+
+func TestUnarmorData(t *testing.T) {
+	data := []byte("PaperCrypt lets you prepare encrypted messages for printing on paper.")
+
+	armored, err := ArmorData(data)
+	if err != nil {
+		t.Fatalf("ArmorData failed with error %s", err)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		decoded, err := UnarmorData([]byte(armored))
+		if err != nil {
+			t.Fatalf("UnarmorData failed with error %s", err)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+
+	t.Run("without empty lines", func(t *testing.T) {
+		transcribed := strings.ReplaceAll(armored, "\n\n", "\n")
+		decoded, err := UnarmorData([]byte(transcribed))
+		if err != nil {
+			t.Fatalf("UnarmorData failed with error %s", err)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+}
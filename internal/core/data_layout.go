@@ -0,0 +1,149 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DataLayout describes how the lines of a data block are laid out for transcription.
+type DataLayout struct {
+	// GroupSize is the number of bytes written together, before a space.
+	// It only applies to base16, other encodings write their digits in groups of a fixed size.
+	GroupSize int
+
+	// Columns is the number of groups per line.
+	Columns int
+
+	// BlockLines is the number of lines after which an empty line is inserted, 0 disables blocks.
+	BlockLines int
+
+	// LineIndices determines whether lines are prefixed with their line number.
+	LineIndices bool
+
+	// ColumnIndices determines whether each block is preceded by a line holding the column numbers.
+	ColumnIndices bool
+}
+
+// DefaultDataLayout is the layout used, unless stated otherwise in the header.
+var DefaultDataLayout = DataLayout{
+	GroupSize:   1,
+	Columns:     BytesPerLine,
+	LineIndices: true,
+}
+
+const (
+	dataLayoutGroup         = "group"
+	dataLayoutColumns       = "columns"
+	dataLayoutBlock         = "block"
+	dataLayoutLineIndices   = "line-indices"
+	dataLayoutColumnIndices = "column-indices"
+)
+
+// ColumnIndexLabel is the label of lines holding column numbers, in place of a line number.
+const ColumnIndexLabel = "#"
+
+// BytesPerLine returns the number of bytes written per line.
+func (l DataLayout) BytesPerLine() int {
+	return l.GroupSize * l.Columns
+}
+
+// Validate checks that the layout can be written and read.
+func (l DataLayout) Validate() error {
+	if l.GroupSize < 1 {
+		return errors.New("group size must be greater than 0")
+	}
+	if l.Columns < 1 {
+		return errors.New("number of columns must be greater than 0")
+	}
+	if l.BlockLines < 0 {
+		return errors.New("number of lines per block must not be negative")
+	}
+
+	return nil
+}
+
+// String returns the layout as written in the header, for example
+// "group=4, columns=6, block=10, line-indices=yes, column-indices=no".
+func (l DataLayout) String() string {
+	return fmt.Sprintf("%s=%d, %s=%d, %s=%d, %s=%s, %s=%s",
+		dataLayoutGroup, l.GroupSize,
+		dataLayoutColumns, l.Columns,
+		dataLayoutBlock, l.BlockLines,
+		dataLayoutLineIndices, yesNo(l.LineIndices),
+		dataLayoutColumnIndices, yesNo(l.ColumnIndices))
+}
+
+// ParseDataLayout parses a layout as written by DataLayout.String.
+// Values that are not present keep their default.
+func ParseDataLayout(s string) (DataLayout, error) {
+	layout := DefaultDataLayout
+
+	for _, part := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return layout, fmt.Errorf("invalid layout option '%s'", part)
+		}
+
+		var err error
+		switch key {
+		case dataLayoutGroup:
+			layout.GroupSize, err = strconv.Atoi(value)
+		case dataLayoutColumns:
+			layout.Columns, err = strconv.Atoi(value)
+		case dataLayoutBlock:
+			layout.BlockLines, err = strconv.Atoi(value)
+		case dataLayoutLineIndices:
+			layout.LineIndices, err = parseYesNo(value)
+		case dataLayoutColumnIndices:
+			layout.ColumnIndices, err = parseYesNo(value)
+		default:
+			return layout, fmt.Errorf("unknown layout option '%s'", key)
+		}
+		if err != nil {
+			return layout, errors.Join(fmt.Errorf("invalid value for layout option '%s'", key), err)
+		}
+	}
+
+	return layout, layout.Validate()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func parseYesNo(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("expected yes or no, got '%s'", s)
+	}
+}
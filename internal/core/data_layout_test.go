@@ -0,0 +1,93 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseDataLayout(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		layout := DataLayout{GroupSize: 4, Columns: 6, BlockLines: 10, LineIndices: false, ColumnIndices: true}
+		parsed, err := ParseDataLayout(layout.String())
+		if err != nil {
+			t.Fatalf("ParseDataLayout failed with error %s", err)
+		}
+
+		if parsed != layout {
+			t.Errorf("Parsing was incorrect, got: %s, want: %s.", parsed, layout)
+		}
+	})
+
+	t.Run("missing options keep their default", func(t *testing.T) {
+		parsed, err := ParseDataLayout("group=2, columns=12")
+		if err != nil {
+			t.Fatalf("ParseDataLayout failed with error %s", err)
+		}
+
+		if !parsed.LineIndices || parsed.BytesPerLine() != 24 {
+			t.Errorf("Parsing was incorrect, got: %s.", parsed)
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		for _, layout := range []string{"group=0", "columns=x", "line-indices=maybe", "rows=3", "group"} {
+			if _, err := ParseDataLayout(layout); err == nil {
+				t.Errorf("ParseDataLayout should fail with '%s'", layout)
+			}
+		}
+	})
+}
+
+func TestSerializeBinaryLayout(t *testing.T) {
+	data := bytes.Repeat([]byte("PaperCrypt lets you prepare encrypted messages for printing on paper."), 4)
+
+	layouts := []DataLayout{
+		{GroupSize: 4, Columns: 6, BlockLines: 3, LineIndices: true, ColumnIndices: true},
+		{GroupSize: 2, Columns: 10, BlockLines: 5, LineIndices: false, ColumnIndices: true},
+		{GroupSize: 1, Columns: 16, LineIndices: false},
+	}
+
+	for _, layout := range layouts {
+		for _, encoding := range []PaperCryptDataEncoding{PaperCryptDataEncodingBase16, PaperCryptDataEncodingBase32, PaperCryptDataEncodingBase64} {
+			t.Run(encoding.String()+" "+layout.String(), func(t *testing.T) {
+				encoded := []byte(SerializeBinaryEncoded(&data, encoding, layout, LineChecksumCRC24))
+				decoded, err := DeserializeBinaryEncoded(&encoded, encoding, layout, LineChecksumCRC24)
+				if err != nil {
+					t.Fatalf("DeserializeBinaryEncoded failed with error %s", err)
+				}
+
+				if !bytes.Equal(decoded, data) {
+					t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+				}
+			})
+		}
+	}
+}
+
+func TestColumnIndices(t *testing.T) {
+	got := ColumnIndices("1F8B0800 00000000 02FF8C90")
+	want := "1        2        3"
+	if got != want {
+		t.Errorf("got: '%s', want: '%s'.", got, want)
+	}
+}
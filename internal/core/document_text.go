@@ -0,0 +1,205 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// byteOrderMark is the UTF-8 byte order mark, which some editors write at the start of text files.
+var byteOrderMark = []byte("\uFEFF")
+
+// NormalizeDocumentText undoes the changes the text of a document picks up when it is edited by hand, or read by OCR,
+// so it can be parsed: a byte order mark, Windows (CRLF) line endings, whitespace at the end of lines,
+// blank lines before and within the header, more blank lines between the header and the data than the two written,
+// and header fields spaced, spelled, or ordered differently than GetText writes them.
+// Headers are only changed if they fail their checksum as they are, text without a header is left as it is,
+// but for its byte order mark, line endings, and trailing whitespace.
+func NormalizeDocumentText(data []byte) []byte {
+	raw := strings.Split(string(NormalizeLineEndings(bytes.TrimLeft(data, string(byteOrderMark)))), "\n")
+	lines := make([]string, len(raw))
+	for i, line := range raw {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	start := 0
+	for start < len(lines) && lines[start] == "" {
+		start++
+	}
+	if start == len(lines) || headerFieldName(lines[start]) == "" {
+		return []byte(strings.Join(lines, "\n"))
+	}
+
+	// the header ends at the first blank line that is not followed by another header field
+	var header, rawHeader []string
+	end := start
+	for ; end < len(lines); end++ {
+		if lines[end] == "" {
+			continue
+		}
+		if end > start && lines[end-1] == "" && headerFieldName(lines[end]) == "" {
+			break
+		}
+
+		header = append(header, lines[end])
+		rawHeader = append(rawHeader, raw[end])
+	}
+	if end == len(lines) {
+		return []byte(strings.Join(lines[start:], "\n"))
+	}
+
+	if !headerChecksumMatches(strings.Join(rawHeader, "\n")) {
+		rawHeader = normalizeHeaderLines(header)
+	}
+
+	return []byte(strings.Join(rawHeader, "\n") + "\n\n\n" + strings.Join(lines[end:], "\n"))
+}
+
+// normalizeHeaderLines writes the header fields as GetText does, "Name: value", in the order of HeaderFieldNames.
+// Lines not holding a known field are kept in their place.
+func normalizeHeaderLines(lines []string) []string {
+	var known []int
+	normalized := make([]string, len(lines))
+	for i, line := range lines {
+		name := headerFieldName(line)
+		if name == "" {
+			normalized[i] = strings.TrimSpace(line)
+			continue
+		}
+
+		_, value, _ := strings.Cut(line, ":")
+		normalized[i] = name + ": " + strings.TrimSpace(value)
+		known = append(known, i)
+	}
+
+	fields := make([]string, len(known))
+	for i, line := range known {
+		fields[i] = normalized[line]
+	}
+	slices.SortStableFunc(fields, func(a, b string) int {
+		return slices.Index(HeaderFieldNames, headerFieldName(a)) - slices.Index(HeaderFieldNames, headerFieldName(b))
+	})
+	for i, line := range known {
+		normalized[line] = fields[i]
+	}
+
+	return normalized
+}
+
+// headerFieldName returns the name of the header field on the line, as written by GetText,
+// ignoring case, surrounding whitespace, and a leading #, or "" if the line holds no known field.
+func headerFieldName(line string) string {
+	name, _, ok := strings.Cut(line, ":")
+	if !ok {
+		return ""
+	}
+
+	name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+	for _, field := range HeaderFieldNames {
+		if strings.EqualFold(name, field) {
+			return field
+		}
+	}
+
+	return ""
+}
+
+// headerChecksumMatches returns whether the header matches its Header CRC-32, as checked by DeserializeText.
+func headerChecksumMatches(header string) bool {
+	headers, err := TextToHeaderMap([]byte(header))
+	if err != nil {
+		return false
+	}
+
+	sum, err := ParseHexUint32(headers[HeaderFieldHeaderCRC32])
+	if err != nil {
+		return false
+	}
+
+	header = strings.ReplaceAll(header, "# ", "")
+	header = strings.ReplaceAll(header, "\n"+HeaderFieldHeaderCRC32+": "+headers[HeaderFieldHeaderCRC32], "")
+	return ValidateCRC32([]byte(header), sum)
+}
+
+// ValidateDocumentText returns an error describing the first difference between the text of a document,
+// and the format written by GetText (or printed, with header lines starting in "# "),
+// for documents that are to be read only if they follow it exactly.
+// It checks the form of the text, which NormalizeDocumentText would change, its content is checked by DeserializeText.
+func ValidateDocumentText(data []byte) error {
+	if bytes.HasPrefix(data, byteOrderMark) {
+		return errors.New("the text starts with a byte order mark")
+	}
+
+	inHeader := true
+	blankLines := 0
+	last := -1
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.Contains(line, "\r") {
+			return fmt.Errorf("line %d: lines must end in a line feed only, not a carriage return", i+1)
+		}
+
+		if inHeader && line == "" {
+			blankLines++
+			continue
+		}
+		if inHeader && blankLines == 0 {
+			name, _, ok := strings.Cut(strings.TrimPrefix(line, "# "), ": ")
+			field := slices.Index(HeaderFieldNames, name)
+			switch {
+			case !ok || field < 0:
+				return fmt.Errorf("line %d: not a header field, written as \"Name: value\": %q", i+1, line)
+			case field == last:
+				return fmt.Errorf("line %d: duplicate header field `%s`", i+1, name)
+			case field < last:
+				return fmt.Errorf("line %d: header field `%s` out of order, it belongs before `%s`", i+1, name, HeaderFieldNames[last])
+			}
+			last = field
+			continue
+		}
+		if inHeader {
+			if last < 0 {
+				return fmt.Errorf("line %d: blank lines before the header", i+1)
+			}
+			if blankLines != 2 {
+				return fmt.Errorf("line %d: the header must be followed by two empty lines, not %d", i+1, blankLines)
+			}
+			inHeader = false
+		}
+
+		// header values are written as they are, the lines of the data never end in whitespace
+		if strings.TrimRight(line, " \t") != line {
+			return fmt.Errorf("line %d: whitespace at the end of the line", i+1)
+		}
+	}
+	if inHeader {
+		return errors.New("header not discernible, header and content should be separated by two empty lines")
+	}
+
+	return nil
+}
+
+func NormalizeLineEndings(data []byte) []byte {
+	return bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+}
@@ -0,0 +1,148 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDocumentTexts returns the text of a document in the encodings and layouts it can be written in.
+func testDocumentTexts(t testing.TB) [][]byte {
+	createdAt, err := time.Parse(TimeStampFormatLong, "Thu, 01 Aug 2024 20:38:10.306596100 +0200")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := NewPaperCrypt("2.0.0", []byte("PaperCrypt lets you prepare encrypted messages for printing on paper."), "EIPESR", "Example Sheet", "Café", createdAt, PaperCryptDataFormatRaw)
+	pc.ReviewBy = time.Date(2029, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	var texts [][]byte
+	for _, opts := range []EncodingOptions{
+		{},
+		{Encoding: PaperCryptDataEncodingBase32, LineChecksum: LineChecksumCRC32},
+		{Encoding: PaperCryptDataEncodingBase64, ErrorCorrectionLevel: 50},
+		{Encoding: PaperCryptDataEncodingArmor},
+		{Encoding: PaperCryptDataEncodingWords},
+	} {
+		text, err := pc.GetText(opts)
+		if err != nil {
+			t.Fatalf("GetText failed with error %s", err)
+		}
+		texts = append(texts, text)
+	}
+
+	return texts
+}
+
+func FuzzDeserializeText(f *testing.F) {
+	for _, text := range testDocumentTexts(f) {
+		f.Add(text)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = DeserializeText(data, false, false)
+		_, _ = DeserializeText(data, true, true)
+		_, _, _ = DeserializeV2TextPartial(data, true)
+
+		normalized := NormalizeDocumentText(data)
+		if again := NormalizeDocumentText(normalized); !bytes.Equal(again, normalized) {
+			t.Errorf("NormalizeDocumentText is not idempotent, got: %q, want: %q.", again, normalized)
+		}
+		_ = ValidateDocumentText(data)
+	})
+}
+
+// printedDocumentText returns the text of a document as printed, with its header lines starting in "# ".
+func printedDocumentText(text string) string {
+	header, body, _ := strings.Cut(text, "\n\n\n")
+	return "# " + strings.ReplaceAll(header, "\n", "\n# ") + "\n\n\n" + body
+}
+
+// editDocumentText changes the text of a document as a hand-edit or OCR might.
+var editDocumentText = map[string]func(string) string{
+	"byte order mark": func(text string) string { return "\uFEFF" + text },
+	"crlf":            func(text string) string { return strings.ReplaceAll(text, "\n", "\r\n") },
+	"trailing whitespace": func(text string) string {
+		return strings.ReplaceAll(text, "\n", " \t\n")
+	},
+	"leading blank lines": func(text string) string { return "\n\n" + text },
+	"extra blank lines":   func(text string) string { return strings.Replace(text, "\n\n\n", "\n\n\n\n\n", 1) },
+	"blank line in header": func(text string) string {
+		return strings.Replace(text, "\n"+HeaderFieldSerial, "\n\n"+HeaderFieldSerial, 1)
+	},
+	"hash prefix": func(text string) string {
+		header, body, _ := strings.Cut(printedDocumentText(text), "\n\n\n")
+		return strings.ReplaceAll(header, "# ", "#") + "\n\n\n" + body
+	},
+	"field case and spacing": func(text string) string {
+		return strings.Replace(text, HeaderFieldPurpose+": ", strings.ToLower(HeaderFieldPurpose)+" :  ", 1)
+	},
+	"reordered fields": func(text string) string {
+		header, body, _ := strings.Cut(text, "\n\n\n")
+		lines := strings.Split(header, "\n")
+		lines[0], lines[len(lines)-1] = lines[len(lines)-1], lines[0]
+		return strings.Join(lines, "\n") + "\n\n\n" + body
+	},
+}
+
+func TestNormalizeDocumentText(t *testing.T) {
+	for _, text := range testDocumentTexts(t) {
+		for _, text := range [][]byte{text, []byte(printedDocumentText(string(text)))} {
+			if normalized := NormalizeDocumentText(text); !bytes.Equal(normalized, text) {
+				t.Errorf("NormalizeDocumentText changed a well-formed document, got: %q, want: %q.", normalized, text)
+			}
+		}
+
+		want, err := DeserializeText(text, false, false)
+		if err != nil {
+			t.Fatalf("DeserializeText failed with error %s", err)
+		}
+		for name, edit := range editDocumentText {
+			got, err := DeserializeText(NormalizeDocumentText([]byte(edit(string(text)))), false, false)
+			if err != nil {
+				t.Errorf("%s: DeserializeText failed with error %s", name, err)
+				continue
+			}
+			if !bytes.Equal(got.Data, want.Data) || got.SerialNumber != want.SerialNumber || got.Purpose != want.Purpose {
+				t.Errorf("%s: got: %v, want: %v.", name, got, want)
+			}
+		}
+	}
+}
+
+func TestValidateDocumentText(t *testing.T) {
+	for _, text := range testDocumentTexts(t) {
+		for _, text := range []string{string(text), printedDocumentText(string(text))} {
+			if err := ValidateDocumentText([]byte(text)); err != nil {
+				t.Errorf("ValidateDocumentText failed with error %s", err)
+			}
+		}
+
+		for name, edit := range editDocumentText {
+			if err := ValidateDocumentText([]byte(edit(string(text)))); err == nil {
+				t.Errorf("%s: ValidateDocumentText accepted the edited document", name)
+			}
+		}
+	}
+}
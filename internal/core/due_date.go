@@ -0,0 +1,101 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDueDate parses the date a document expires, or is to be reviewed by: either a date, such as 2030-01-31,
+// or a period after from (the date of the document), in years, months, or days, such as 5y, 18m, or 90d.
+func ParseDueDate(value string, from time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if date, err := time.Parse(TimeStampFormatDate, value); err == nil {
+		return date, nil
+	}
+
+	if len(value) < 2 {
+		return time.Time{}, fmt.Errorf("invalid date '%s', must be a date (such as 2030-01-31), or a period (such as 5y, 18m, or 90d)", value)
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 1 || from.IsZero() {
+		return time.Time{}, fmt.Errorf("invalid date '%s', must be a date (such as 2030-01-31), or a period (such as 5y, 18m, or 90d)", value)
+	}
+
+	var due time.Time
+	switch value[len(value)-1] {
+	case 'y':
+		due = from.AddDate(n, 0, 0)
+	case 'm':
+		due = from.AddDate(0, n, 0)
+	case 'd':
+		due = from.AddDate(0, 0, n)
+	default:
+		return time.Time{}, fmt.Errorf("invalid period '%s', must be a number of years (y), months (m), or days (d)", value)
+	}
+
+	// only the day is kept, as written in the header
+	return time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// ParseOptionalDueDate parses a date written by FormatDueDate, an empty value is the zero time.
+func ParseOptionalDueDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(TimeStampFormatDate, value)
+}
+
+// FormatDueDate formats the date a document expires, or is to be reviewed by, the zero time is empty.
+func FormatDueDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+
+	return date.Format(TimeStampFormatDate)
+}
+
+// Overdue returns a notice for each date of the document that has passed at now:
+// the date it expires, and the date by which it should be printed again, and verified.
+// A date passes at the end of its day.
+func (p *PaperCrypt) Overdue(now time.Time) []string {
+	return OverdueNotices(p.ExpiresAt, p.ReviewBy, now)
+}
+
+// OverdueNotices returns a notice for each of the dates expiresAt, and reviewBy, that has passed at now,
+// zero dates are not set.
+func OverdueNotices(expiresAt time.Time, reviewBy time.Time, now time.Time) []string {
+	today := now.Format(TimeStampFormatDate)
+
+	var notices []string
+	if !expiresAt.IsZero() && today > FormatDueDate(expiresAt) {
+		notices = append(notices, fmt.Sprintf("The document expired on %s, its content may no longer be valid", FormatDueDate(expiresAt)))
+	}
+	if !reviewBy.IsZero() && today > FormatDueDate(reviewBy) {
+		notices = append(notices, fmt.Sprintf("The document was due for review on %s, print it again, and verify the new sheet", FormatDueDate(reviewBy)))
+	}
+
+	return notices
+}
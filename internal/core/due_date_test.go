@@ -0,0 +1,106 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDueDate(t *testing.T) {
+	from := time.Date(2024, 8, 1, 20, 38, 10, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"2030-01-31", "2030-01-31"},
+		{"5y", "2029-08-01"},
+		{"18m", "2026-02-01"},
+		{"90d", "2024-10-30"},
+	}
+	for _, test := range tests {
+		got, err := ParseDueDate(test.value, from)
+		if err != nil {
+			t.Fatalf("ParseDueDate failed with error %s", err)
+		}
+		if FormatDueDate(got) != test.want {
+			t.Errorf("got: %v, want: %v.", FormatDueDate(got), test.want)
+		}
+	}
+
+	for _, value := range []string{"", "y", "0y", "5w", "next year", "2030-13-01"} {
+		if _, err := ParseDueDate(value, from); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestOverdue(t *testing.T) {
+	pc := NewPaperCrypt("2.0.0", []byte("encrypted data"), "ABCDEF", "", "", time.Now(), PaperCryptDataFormatPGP)
+	pc.ExpiresAt = time.Date(2030, 1, 31, 0, 0, 0, 0, time.UTC)
+	pc.ReviewBy = time.Date(2027, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{time.Date(2027, 8, 1, 23, 0, 0, 0, time.UTC), 0},
+		{time.Date(2027, 8, 2, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC), 2},
+	}
+	for _, test := range tests {
+		if got := pc.Overdue(test.now); len(got) != test.want {
+			t.Errorf("got: %v, want: %v notices.", got, test.want)
+		}
+	}
+
+	if got := pc.Overdue(time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)); !strings.Contains(got[0], "expired on 2030-01-31") {
+		t.Errorf("got: %v, want: a notice of the expiry.", got[0])
+	}
+}
+
+func TestDueDatesInText(t *testing.T) {
+	createdAt, err := time.Parse(TimeStampFormatLong, "Thu, 01 Aug 2024 20:38:10.306596100 +0200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := NewPaperCrypt("2.0.0", []byte("encrypted data"), "ABCDEF", "", "", createdAt, PaperCryptDataFormatRaw)
+	pc.ExpiresAt = time.Date(2030, 1, 31, 0, 0, 0, 0, time.UTC)
+	pc.ReviewBy = time.Date(2027, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	text, err := pc.GetText(EncodingOptions{})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	if !strings.Contains(string(text), "\nReview By: 2027-08-01\n") {
+		t.Errorf("got: %s, want: the review date in the header.", text)
+	}
+
+	restored, err := DeserializeV2Text(text, false, false)
+	if err != nil {
+		t.Fatalf("DeserializeV2Text failed with error %s", err)
+	}
+	if !restored.ExpiresAt.Equal(pc.ExpiresAt) || !restored.ReviewBy.Equal(pc.ReviewBy) {
+		t.Errorf("got: %v and %v, want: %v and %v.", restored.ExpiresAt, restored.ReviewBy, pc.ExpiresAt, pc.ReviewBy)
+	}
+}
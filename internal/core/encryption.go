@@ -0,0 +1,79 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// CompressAndEncrypt prepares the data of a document: the plaintext is compressed, encrypted with the passphrase,
+// and compressed again, or, if raw is set, only compressed.
+func CompressAndEncrypt(passphrase []byte, plaintext []byte, raw bool) ([]byte, error) {
+	compressedData := new(bytes.Buffer)
+	gzipWriter, err := gzip.NewWriterLevel(compressedData, gzip.BestCompression)
+	if err != nil {
+		return nil, errors.Join(errors.New("error creating gzip writer"), err)
+	}
+
+	_, err = gzipWriter.Write(plaintext)
+	if err != nil {
+		return nil, errors.Join(errors.New("error writing to gzip writer"), err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, errors.Join(errors.New("error closing gzip writer"), err)
+	}
+	if raw {
+		return compressedData.Bytes(), nil
+	}
+
+	encryptedSecretContents, err := encryptWithPassphrase(passphrase, compressedData.Bytes())
+	if err != nil {
+		return nil, errors.Join(errors.New("error encrypting secret contents"), err)
+	}
+
+	compressedData.Reset()
+	gzipWriter.Reset(compressedData)
+	_, err = gzipWriter.Write(encryptedSecretContents.GetBinary())
+	if err != nil {
+		return nil, errors.Join(errors.New("error writing to gzip writer"), err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, errors.Join(errors.New("error closing gzip writer"), err)
+	}
+
+	return compressedData.Bytes(), nil
+}
+
+// encryptWithPassphrase encrypts data to an OpenPGP message, using the passphrase.
+func encryptWithPassphrase(passphrase []byte, data []byte) (*crypto.PGPMessage, error) {
+	message := crypto.NewPlainMessage(data)
+
+	encrypted, err := crypto.EncryptMessageWithPassword(message, passphrase)
+	if err != nil {
+		return nil, errors.Join(errors.New("error encrypting message"), err)
+	}
+
+	return encrypted, nil
+}
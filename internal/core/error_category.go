@@ -0,0 +1,106 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrorCategory is the cause of a failure, which scripts can branch on, by the exit code of PaperCrypt.
+type ErrorCategory uint8
+
+const (
+	// ErrorCategoryOther is any failure not listed below.
+	ErrorCategoryOther ErrorCategory = iota
+	// ErrorCategoryInteraction is input to be prompted for, with NonInteractive set.
+	ErrorCategoryInteraction
+	// ErrorCategoryFileExists is an output file that exists, and is not to be overridden.
+	ErrorCategoryFileExists
+	// ErrorCategoryPassphrase is data that can not be decrypted, mostly with an incorrect passphrase.
+	ErrorCategoryPassphrase
+	// ErrorCategoryChecksum is a document, or data, not matching its checksums.
+	ErrorCategoryChecksum
+	// ErrorCategoryUnreadableCode is an image, or a PDF, in which no 2D code can be read.
+	ErrorCategoryUnreadableCode
+	// ErrorCategoryVersion is a document of an unknown, or unsupported, version of PaperCrypt.
+	ErrorCategoryVersion
+	// ErrorCategoryIO is a file that can not be opened, read, or written.
+	ErrorCategoryIO
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrorCategoryOther:
+		return "other"
+	case ErrorCategoryInteraction:
+		return "interaction required"
+	case ErrorCategoryFileExists:
+		return "file exists"
+	case ErrorCategoryPassphrase:
+		return "bad passphrase"
+	case ErrorCategoryChecksum:
+		return "checksum mismatch"
+	case ErrorCategoryUnreadableCode:
+		return "unreadable 2D code"
+	case ErrorCategoryVersion:
+		return "unsupported version"
+	case ErrorCategoryIO:
+		return "I/O error"
+	default:
+		return "unknown"
+	}
+}
+
+// categoryError is an error, marked with its category, see WithCategory.
+type categoryError struct {
+	category ErrorCategory
+	err      error
+}
+
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categoryError) Unwrap() error {
+	return e.err
+}
+
+// WithCategory marks err with the category, which CategoryOf reports for any error wrapping it.
+func WithCategory(category ErrorCategory, err error) error {
+	return &categoryError{category: category, err: err}
+}
+
+// CategoryOf returns the category of the first error marked by WithCategory in the tree of err.
+// Errors of file system operations, which are not marked, are of ErrorCategoryIO.
+func CategoryOf(err error) ErrorCategory {
+	var categorized *categoryError
+	if errors.As(err, &categorized) {
+		return categorized.category
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ErrorCategoryIO
+	}
+
+	return ErrorCategoryOther
+}
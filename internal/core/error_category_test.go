@@ -0,0 +1,54 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCategoryOf(t *testing.T) {
+	_, pathErr := os.Open("papercrypt-no-such-file")
+
+	tests := []struct {
+		err  error
+		want ErrorCategory
+	}{
+		{errors.New("plain"), ErrorCategoryOther},
+		{WithCategory(ErrorCategoryChecksum, errors.New("mismatch")), ErrorCategoryChecksum},
+		{errors.Join(errors.New("error decrypting data"), ErrDecryption), ErrorCategoryPassphrase},
+		{fmt.Errorf("wrapped: %w", WithCategory(ErrorCategoryFileExists, errors.New("file already exists"))), ErrorCategoryFileExists},
+		{errors.Join(errors.New("error opening file"), pathErr), ErrorCategoryIO},
+		// a marked error is preferred to the file system error it wraps
+		{WithCategory(ErrorCategoryVersion, pathErr), ErrorCategoryVersion},
+	}
+	for _, test := range tests {
+		if got := CategoryOf(test.err); got != test.want {
+			t.Errorf("CategoryOf(%q) was incorrect, got: %s, want: %s.", test.err, got, test.want)
+		}
+	}
+
+	if got := WithCategory(ErrorCategoryChecksum, errors.New("mismatch")).Error(); got != "mismatch" {
+		t.Errorf("Error was incorrect, got: %s, want: mismatch.", got)
+	}
+}
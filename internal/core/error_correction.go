@@ -0,0 +1,335 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Error correction adds parity lines to a data block, computed using a systematic Reed-Solomon erasure code
+// (with a Cauchy matrix) over GF(2^8), so that lines which are missing, or fail their checksum, can be reconstructed.
+//
+// Lines are distributed over stripes in turn (line i belongs to stripe i mod stripes),
+// so damage to consecutive lines, such as a stain or a torn corner, is spread over all stripes.
+// Each stripe has its own parity lines, and can recover as many lines as it has parity lines.
+
+const (
+	// ErrorCorrectionName is the name of the error correction scheme, as written in the header.
+	ErrorCorrectionName = "Reed-Solomon"
+
+	// errorCorrectionMaxStripeLines is the maximum number of data lines per stripe,
+	// data and parity lines of a stripe must not exceed the 256 elements of GF(2^8).
+	errorCorrectionMaxStripeLines = 128
+
+	errorCorrectionStripes = "stripes"
+	errorCorrectionParity  = "parity"
+
+	// gfPolynomial is the primitive polynomial x^8 + x^4 + x^3 + x^2 + 1 generating GF(2^8).
+	gfPolynomial = 0x11D
+)
+
+// ParityLinePrefix is the prefix of the line numbers of parity lines.
+const ParityLinePrefix = "P"
+
+// ErrorCorrection describes the parity lines of a data block.
+type ErrorCorrection struct {
+	// Stripes is the number of stripes the data lines are distributed over.
+	Stripes int
+
+	// ParityLines is the number of parity lines per stripe.
+	ParityLines int
+}
+
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= gfPolynomial
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// cauchy returns the coefficient of data line `data` in parity line `parity` of a stripe with `dataLines` data lines.
+func cauchy(parity, data, dataLines int) byte {
+	return gfInv(byte(dataLines+parity) ^ byte(data))
+}
+
+// NewErrorCorrection returns the error correction for a data block of `dataLines` lines,
+// adding about `level` percent of parity lines, at least one per stripe.
+func NewErrorCorrection(dataLines int, level int) (ErrorCorrection, error) {
+	if level < 1 || level > 100 {
+		return ErrorCorrection{}, fmt.Errorf("error correction level must be between 1 and 100 percent, got %d", level)
+	}
+
+	stripes := max((dataLines+errorCorrectionMaxStripeLines-1)/errorCorrectionMaxStripeLines, 1)
+	stripeLines := (dataLines + stripes - 1) / stripes
+
+	return ErrorCorrection{
+		Stripes:     stripes,
+		ParityLines: max((stripeLines*level+99)/100, 1),
+	}, nil
+}
+
+// String returns the error correction as written in the header, for example "Reed-Solomon, stripes=1, parity=3".
+func (e ErrorCorrection) String() string {
+	return fmt.Sprintf("%s, %s=%d, %s=%d", ErrorCorrectionName, errorCorrectionStripes, e.Stripes, errorCorrectionParity, e.ParityLines)
+}
+
+// ParseErrorCorrection parses the error correction as written by ErrorCorrection.String.
+func ParseErrorCorrection(s string) (ErrorCorrection, error) {
+	parts := strings.Split(s, ",")
+	if strings.TrimSpace(parts[0]) != ErrorCorrectionName {
+		return ErrorCorrection{}, fmt.Errorf("unsupported error correction '%s'", parts[0])
+	}
+
+	var e ErrorCorrection
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return e, fmt.Errorf("invalid error correction option '%s'", part)
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return e, errors.Join(fmt.Errorf("invalid value for error correction option '%s'", key), err)
+		}
+
+		switch key {
+		case errorCorrectionStripes:
+			e.Stripes = n
+		case errorCorrectionParity:
+			e.ParityLines = n
+		default:
+			return e, fmt.Errorf("unknown error correction option '%s'", key)
+		}
+	}
+
+	if e.Stripes < 1 || e.ParityLines < 1 || e.ParityLines > 256-errorCorrectionMaxStripeLines {
+		return e, fmt.Errorf("invalid error correction '%s'", s)
+	}
+
+	return e, nil
+}
+
+// CheckDataLines returns an error if the error correction can not belong to a data block of dataLines lines,
+// as every stripe holds at least one data line, and at most errorCorrectionMaxStripeLines.
+func (e ErrorCorrection) CheckDataLines(dataLines int) error {
+	if e.Stripes > max(dataLines, 1) || dataLines > e.Stripes*errorCorrectionMaxStripeLines {
+		return fmt.Errorf("invalid error correction '%s' for %d data lines", e, dataLines)
+	}
+
+	return nil
+}
+
+// stripe returns the indices of the data lines belonging to stripe s.
+func (e ErrorCorrection) stripe(s int, dataLines int) []int {
+	var indices []int
+	for i := s; i < dataLines; i += e.Stripes {
+		indices = append(indices, i)
+	}
+
+	return indices
+}
+
+// Encode computes the parity lines of the data lines, each as long as the longest data line.
+// Parity lines are ordered by stripe.
+func (e ErrorCorrection) Encode(lines [][]byte) [][]byte {
+	lineSize := 0
+	for _, line := range lines {
+		lineSize = max(lineSize, len(line))
+	}
+
+	parity := make([][]byte, 0, e.Stripes*e.ParityLines)
+	for s := 0; s < e.Stripes; s++ {
+		indices := e.stripe(s, len(lines))
+		for p := 0; p < e.ParityLines; p++ {
+			parityLine := make([]byte, lineSize)
+			for d, i := range indices {
+				coefficient := cauchy(p, d, len(indices))
+				for b, value := range lines[i] {
+					parityLine[b] ^= gfMul(coefficient, value)
+				}
+			}
+			parity = append(parity, parityLine)
+		}
+	}
+
+	return parity
+}
+
+// Reconstruct fills in missing (nil) data lines, using the parity lines.
+// Missing parity lines must be nil as well. lineSizes holds the expected length of each data line.
+// It returns the indices of the reconstructed lines. Stripes with too many missing lines are reported
+// in the error, after reconstructing the other stripes, so partial recovery can use them.
+func (e ErrorCorrection) Reconstruct(lines [][]byte, parity [][]byte, lineSizes []int) ([]int, error) {
+	if len(parity) != e.Stripes*e.ParityLines {
+		return nil, fmt.Errorf("expected %d parity lines, got %d", e.Stripes*e.ParityLines, len(parity))
+	}
+
+	var reconstructed []int
+	var errs []error
+	for s := 0; s < e.Stripes; s++ {
+		indices := e.stripe(s, len(lines))
+
+		var missing []int // positions within the stripe
+		for d, i := range indices {
+			if lines[i] == nil {
+				missing = append(missing, d)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		var available []int // parity lines of this stripe
+		for p := 0; p < e.ParityLines && len(available) < len(missing); p++ {
+			if parity[s*e.ParityLines+p] != nil {
+				available = append(available, p)
+			}
+		}
+		if len(available) < len(missing) {
+			errs = append(errs, fmt.Errorf("stripe %d has %d damaged lines, but only %d intact parity lines", s+1, len(missing), len(available)))
+			continue
+		}
+
+		lineSize := len(parity[s*e.ParityLines+available[0]])
+
+		// syndromes: the parity lines, minus the contribution of the intact data lines
+		syndromes := make([][]byte, len(available))
+		for r, p := range available {
+			syndromes[r] = append([]byte{}, parity[s*e.ParityLines+p]...)
+			for d, i := range indices {
+				if lines[i] == nil {
+					continue
+				}
+
+				coefficient := cauchy(p, d, len(indices))
+				for b, value := range lines[i] {
+					syndromes[r][b] ^= gfMul(coefficient, value)
+				}
+			}
+		}
+
+		// solve for the missing lines
+		matrix := make([][]byte, len(available))
+		for r, p := range available {
+			matrix[r] = make([]byte, len(missing))
+			for c, d := range missing {
+				matrix[r][c] = cauchy(p, d, len(indices))
+			}
+		}
+
+		inverse, err := gfInvertMatrix(matrix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for c, d := range missing {
+			line := make([]byte, lineSize)
+			for r := range available {
+				for b := range line {
+					line[b] ^= gfMul(inverse[c][r], syndromes[r][b])
+				}
+			}
+
+			i := indices[d]
+			lines[i] = line[:lineSizes[i]]
+			reconstructed = append(reconstructed, i)
+		}
+	}
+
+	return reconstructed, errors.Join(errs...)
+}
+
+// gfInvertMatrix inverts a square matrix over GF(2^8), using Gauss-Jordan elimination.
+func gfInvertMatrix(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	work := make([][]byte, n)
+	for i := range matrix {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], matrix[i])
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for row := col; row < n; row++ {
+			if work[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot == -1 {
+			return nil, errors.New("matrix is singular")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		scale := gfInv(work[col][col])
+		for j := range work[col] {
+			work[col][j] = gfMul(work[col][j], scale)
+		}
+
+		for row := 0; row < n; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+
+			factor := work[row][col]
+			for j := range work[row] {
+				work[row][j] ^= gfMul(factor, work[col][j])
+			}
+		}
+	}
+
+	inverse := make([][]byte, n)
+	for i := range work {
+		inverse[i] = work[i][n:]
+	}
+
+	return inverse, nil
+}
@@ -0,0 +1,144 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorCorrectionReconstruct(t *testing.T) {
+	for _, dataLines := range []int{1, 10, 100, 300} {
+		t.Run(fmt.Sprintf("%d lines", dataLines), func(t *testing.T) {
+			ecc, err := NewErrorCorrection(dataLines, 10)
+			if err != nil {
+				t.Fatalf("NewErrorCorrection failed with error %s", err)
+			}
+
+			lines := make([][]byte, dataLines)
+			lineSizes := make([]int, dataLines)
+			for i := range lines {
+				lineSizes[i] = BytesPerLine
+				if i == dataLines-1 {
+					lineSizes[i] = 7
+				}
+				lines[i] = make([]byte, lineSizes[i])
+				_, _ = rand.Read(lines[i])
+			}
+			parity := ecc.Encode(lines)
+
+			// erase as many consecutive lines as can be recovered
+			damaged := make([][]byte, dataLines)
+			copy(damaged, lines)
+			erased := min(ecc.Stripes*ecc.ParityLines, dataLines)
+			for i := 0; i < erased; i++ {
+				damaged[i] = nil
+			}
+
+			reconstructed, err := ecc.Reconstruct(damaged, parity, lineSizes)
+			if err != nil {
+				t.Fatalf("Reconstruct failed with error %s", err)
+			}
+			if len(reconstructed) != erased {
+				t.Errorf("Reconstruction count was incorrect, got: %d, want: %d.", len(reconstructed), erased)
+			}
+			for i := range lines {
+				if !bytes.Equal(damaged[i], lines[i]) {
+					t.Errorf("Line %d was reconstructed incorrectly, got: %x, want: %x.", i+1, damaged[i], lines[i])
+				}
+			}
+
+			// one more lost line than there are parity lines can not be recovered
+			if dataLines > erased {
+				copy(damaged, lines)
+				for i := 0; i < ecc.Stripes*(ecc.ParityLines+1); i++ {
+					damaged[i] = nil
+				}
+				if _, err := ecc.Reconstruct(damaged, parity, lineSizes); err == nil {
+					t.Errorf("Reconstruct should fail with too many damaged lines")
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrorCorrection(t *testing.T) {
+	ecc := ErrorCorrection{Stripes: 2, ParityLines: 13}
+	parsed, err := ParseErrorCorrection(ecc.String())
+	if err != nil {
+		t.Fatalf("ParseErrorCorrection failed with error %s", err)
+	}
+	if parsed != ecc {
+		t.Errorf("Parsing was incorrect, got: %s, want: %s.", parsed, ecc)
+	}
+
+	for _, invalid := range []string{"", "Hamming, stripes=1, parity=1", "Reed-Solomon, stripes=0, parity=1", "Reed-Solomon, parity=x"} {
+		if _, err := ParseErrorCorrection(invalid); err == nil {
+			t.Errorf("ParseErrorCorrection should fail for '%s'", invalid)
+		}
+	}
+}
+
+func TestDeserializeBinaryWithParity(t *testing.T) {
+	data := make([]byte, 500)
+	_, _ = rand.Read(data)
+
+	layout := DefaultDataLayout
+	ecc, err := NewErrorCorrection((len(data)+layout.BytesPerLine()-1)/layout.BytesPerLine(), 20)
+	if err != nil {
+		t.Fatalf("NewErrorCorrection failed with error %s", err)
+	}
+
+	var lines [][]byte
+	for i := 0; i < len(data); i += layout.BytesPerLine() {
+		lines = append(lines, data[i:min(i+layout.BytesPerLine(), len(data))])
+	}
+
+	block := SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase16, layout, LineChecksumCRC24) + "\n" +
+		SerializeParityLines(ecc.Encode(lines), PaperCryptDataEncodingBase16, layout, LineChecksumCRC24)
+
+	blockLines := strings.Split(block, "\n")
+	// remove line 2, damage line 3 and the last data line, which is shorter than the others
+	blockLines[2] = blockLines[2][:6] + "X" + blockLines[2][7:]
+	blockLines[len(lines)-1] = ""
+	blockLines[1] = ""
+	damaged := []byte(strings.Join(blockLines, "\n"))
+
+	decoded, err := DeserializeBinaryWithParity(&damaged, PaperCryptDataEncodingBase16, layout, LineChecksumCRC24, ecc, len(data))
+	if err != nil {
+		t.Fatalf("DeserializeBinaryWithParity failed with error %s", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("Decoding was incorrect, got: %x, want: %x.", decoded, data)
+	}
+
+	// too many damaged lines
+	for i := 0; i < len(lines)/2; i++ {
+		blockLines[i] = ""
+	}
+	damaged = []byte(strings.Join(blockLines, "\n"))
+	if _, err := DeserializeBinaryWithParity(&damaged, PaperCryptDataEncodingBase16, layout, LineChecksumCRC24, ecc, len(data)); err == nil {
+		t.Errorf("DeserializeBinaryWithParity should fail with too many damaged lines")
+	}
+}
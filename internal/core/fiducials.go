@@ -0,0 +1,299 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// FiducialSize is the side length of the square markers printed in the corners of each page, in mm.
+	FiducialSize = 4.0
+
+	// FiducialInset is the distance of the center of each marker from the edges of the page, in mm.
+	FiducialInset = 7.0
+
+	// fiducialSearchSize is the largest width or height images are scaled down to, while looking for the markers.
+	fiducialSearchSize = 1000
+
+	// maxRectifiedPixelsPerMM limits the resolution of rectified pages, 12 pixels per mm are about 300 dpi.
+	maxRectifiedPixelsPerMM = 12.0
+)
+
+// Fiducials returns the centers of the corner markers on a page, in mm,
+// in the order top left, top right, bottom right, bottom left.
+func (p Page) Fiducials() [4][2]float64 {
+	width, height := p.Dimensions()
+	return [4][2]float64{
+		{FiducialInset, FiducialInset},
+		{width - FiducialInset, FiducialInset},
+		{width - FiducialInset, height - FiducialInset},
+		{FiducialInset, height - FiducialInset},
+	}
+}
+
+// fiducialRatio returns the ratio of the distances between the markers across and along the page.
+func (p Page) fiducialRatio() float64 {
+	width, height := p.Dimensions()
+	return (width - 2*FiducialInset) / (height - 2*FiducialInset)
+}
+
+// fiducialCandidate is a solid, roughly square dark area of a scan.
+type fiducialCandidate struct {
+	x, y float64 // center
+	size float64 // mean side length
+}
+
+// LocateFiducials finds the corner markers of a page in a scan or photo,
+// and returns their centers in the order of Page.Fiducials, in pixels of the image,
+// along with the page that matches the distances between them best.
+// The page may be rotated and seen at an angle, but all four markers must be visible.
+// Pages turned sideways are taken for landscape pages, which makes no difference to the barcode readers.
+func LocateFiducials(img *image.Gray) ([4][2]float64, Page, bool) {
+	var corners [4][2]float64
+	var page Page
+
+	bounds := img.Bounds()
+	factor := min(float64(fiducialSearchSize)/float64(max(bounds.Dx(), bounds.Dy())), 1)
+	small := img
+	if factor < 1 {
+		small = ScaleGray(img, factor)
+	}
+
+	candidates := fiducialCandidates(AdaptiveThreshold(small))
+	if len(candidates) < 4 {
+		return corners, page, false
+	}
+
+	// the markers are the candidates closest to the corners of the image,
+	// the most extreme in the directions of its diagonals
+	directions := [4][2]float64{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}}
+	var chosen [4]fiducialCandidate
+	for i, d := range directions {
+		best := math.Inf(-1)
+		for _, c := range candidates {
+			if score := d[0]*c.x + d[1]*c.y; score > best {
+				best, chosen[i] = score, c
+			}
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		for j := i + 1; j < 4; j++ {
+			if chosen[i] == chosen[j] {
+				return corners, page, false
+			}
+		}
+		if !similarSize(chosen[i].size, chosen[(i+1)%4].size) {
+			return corners, page, false
+		}
+	}
+
+	for i, c := range chosen {
+		corners[i] = [2]float64{c.x / factor, c.y / factor}
+	}
+
+	width := (distance(corners[0], corners[1]) + distance(corners[3], corners[2])) / 2
+	height := (distance(corners[0], corners[3]) + distance(corners[1], corners[2])) / 2
+	best := 0.4
+	found := false
+	for _, p := range Pages() {
+		if deviation := math.Abs(math.Log(width / height / p.fiducialRatio())); deviation < best {
+			best, page, found = deviation, p, true
+		}
+	}
+
+	return corners, page, found
+}
+
+// fiducialCandidates returns the solid, roughly square dark areas of a black and white image,
+// that are small enough to be markers.
+func fiducialCandidates(img *image.Gray) []fiducialCandidate {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	maxSide := max(min(width, height)/8, 4)
+
+	visited := make([]bool, width*height)
+	var candidates []fiducialCandidate
+	var queue []int
+	for start := range visited {
+		if visited[start] || img.Pix[img.PixOffset(bounds.Min.X+start%width, bounds.Min.Y+start/width)] != 0 {
+			continue
+		}
+
+		// flood fill the dark area
+		visited[start] = true
+		queue = append(queue[:0], start)
+		minX, minY, maxX, maxY := width, height, 0, 0
+		sumX, sumY := 0, 0
+		for i := 0; i < len(queue); i++ {
+			x, y := queue[i]%width, queue[i]/width
+			minX, minY, maxX, maxY = min(minX, x), min(minY, y), max(maxX, x), max(maxY, y)
+			sumX, sumY = sumX+x, sumY+y
+
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n[0] < 0 || n[1] < 0 || n[0] >= width || n[1] >= height {
+					continue
+				}
+				index := n[1]*width + n[0]
+				if !visited[index] && img.Pix[img.PixOffset(bounds.Min.X+n[0], bounds.Min.Y+n[1])] == 0 {
+					visited[index] = true
+					queue = append(queue, index)
+				}
+			}
+		}
+
+		w, h := maxX-minX+1, maxY-minY+1
+		area := len(queue)
+		if w < 4 || h < 4 || w > maxSide || h > maxSide || !similarSize(float64(w), float64(h)) {
+			continue
+		}
+		// a square turned by up to about 20 degrees still fills most of its bounding box
+		if float64(area) < 0.55*float64(w*h) {
+			continue
+		}
+
+		candidates = append(candidates, fiducialCandidate{
+			x:    float64(sumX)/float64(area) + 0.5,
+			y:    float64(sumY)/float64(area) + 0.5,
+			size: math.Sqrt(float64(area)),
+		})
+	}
+
+	return candidates
+}
+
+// RectifyPage finds the corner markers of a page in a scan or photo,
+// and returns the page as if it was scanned straight, at up to about 300 dpi.
+// The second return value is false if the markers were not found.
+func RectifyPage(img *image.Gray) (*image.Gray, bool) {
+	corners, page, ok := LocateFiducials(img)
+	if !ok {
+		return nil, false
+	}
+
+	// keep the resolution of the scan, measured along the top edge of the page
+	pageWidth, pageHeight := page.Dimensions()
+	pixelsPerMM := distance(corners[0], corners[1]) / (pageWidth - 2*FiducialInset)
+	pixelsPerMM = min(max(pixelsPerMM, 1), maxRectifiedPixelsPerMM)
+
+	var markers [4][2]float64
+	for i, f := range page.Fiducials() {
+		markers[i] = [2]float64{f[0] * pixelsPerMM, f[1] * pixelsPerMM}
+	}
+	h, ok := Homography(markers, corners)
+	if !ok {
+		return nil, false
+	}
+
+	bounds := img.Bounds()
+	width, height := int(pageWidth*pixelsPerMM), int(pageHeight*pixelsPerMM)
+	out := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sx, sy := h.Apply(float64(x)+0.5, float64(y)+0.5)
+			out.SetGray(x, y, sampleGray(img, float64(bounds.Min.X)+sx-0.5, float64(bounds.Min.Y)+sy-0.5))
+		}
+	}
+
+	return out, true
+}
+
+// Projection is a perspective transformation, mapping (x, y) to
+// ((h[0]x + h[1]y + h[2]) / w, (h[3]x + h[4]y + h[5]) / w), with w = h[6]x + h[7]y + 1.
+type Projection [8]float64
+
+// Apply maps the point (x, y).
+func (h Projection) Apply(x, y float64) (float64, float64) {
+	w := h[6]*x + h[7]*y + 1
+	return (h[0]*x + h[1]*y + h[2]) / w, (h[3]*x + h[4]*y + h[5]) / w
+}
+
+// Homography returns the projection mapping each of the points `from` to the matching point `to`.
+func Homography(from, to [4][2]float64) (Projection, bool) {
+	// two linear equations per point, in the eight unknowns of the projection
+	var m [8][9]float64
+	for i := 0; i < 4; i++ {
+		x, y, u, v := from[i][0], from[i][1], to[i][0], to[i][1]
+		m[2*i] = [9]float64{x, y, 1, 0, 0, 0, -x * u, -y * u, u}
+		m[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -x * v, -y * v, v}
+	}
+
+	// Gaussian elimination with partial pivoting
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-9 {
+			return Projection{}, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := 0; row < 8; row++ {
+			if row == col {
+				continue
+			}
+			f := m[row][col] / m[col][col]
+			for k := col; k < 9; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+
+	var h Projection
+	for i := 0; i < 8; i++ {
+		h[i] = m[i][8] / m[i][i]
+	}
+
+	return h, true
+}
+
+// sampleGray interpolates the brightness of an image at a point between pixels,
+// points outside the image are white, like the paper around it.
+func sampleGray(img *image.Gray, x, y float64) color.Gray {
+	bounds := img.Bounds()
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	at := func(x, y int) float64 {
+		if !(image.Point{X: x, Y: y}.In(bounds)) {
+			return 0xFF
+		}
+		return float64(img.GrayAt(x, y).Y)
+	}
+
+	top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+	bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+	return color.Gray{Y: uint8(math.Round(top*(1-fy) + bottom*fy))}
+}
+
+func similarSize(a, b float64) bool {
+	return max(a, b) <= 1.6*min(a, b)
+}
+
+func distance(a, b [2]float64) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
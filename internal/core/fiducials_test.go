@@ -0,0 +1,141 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// betweenFiducials returns the position at fractions fx, fy of the distances between the corner markers, in mm.
+func betweenFiducials(page Page, fx, fy float64) (float64, float64) {
+	f := page.Fiducials()
+	return f[0][0] + fx*(f[1][0]-f[0][0]), f[0][1] + fy*(f[3][1]-f[0][1])
+}
+
+// fiducialTestPage draws a page with corner markers and a dark mark of 20 x 10 mm centered at 50% x 45%
+// of the distances between the markers, at `scale` pixels per mm.
+func fiducialTestPage(page Page, scale float64) *image.Gray {
+	width, height := page.Dimensions()
+	img := image.NewGray(image.Rect(0, 0, int(width*scale), int(height*scale)))
+	for i := range img.Pix {
+		img.Pix[i] = 0xF0
+	}
+
+	fill := func(x0, y0, x1, y1 float64) {
+		for y := int(y0 * scale); y < int(y1*scale); y++ {
+			for x := int(x0 * scale); x < int(x1*scale); x++ {
+				img.SetGray(x, y, color.Gray{Y: 0x20})
+			}
+		}
+	}
+	for _, f := range page.Fiducials() {
+		fill(f[0]-FiducialSize/2, f[1]-FiducialSize/2, f[0]+FiducialSize/2, f[1]+FiducialSize/2)
+	}
+	x, y := betweenFiducials(page, 0.5, 0.45)
+	fill(x-10, y-5, x+10, y+5)
+
+	return img
+}
+
+// photograph projects a page onto a darker background, with its corners at `corners`.
+func photograph(page *image.Gray, width, height int, corners [4][2]float64) *image.Gray {
+	w, h := float64(page.Bounds().Dx()), float64(page.Bounds().Dy())
+	toPage, ok := Homography(corners, [4][2]float64{{0, 0}, {w, 0}, {w, h}, {0, h}})
+	if !ok {
+		panic("invalid corners")
+	}
+
+	photo := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			px, py := toPage.Apply(float64(x)+0.5, float64(y)+0.5)
+			value := color.Gray{Y: 0x50}
+			if p := (image.Point{X: int(px), Y: int(py)}); px >= 0 && py >= 0 && p.In(page.Bounds()) {
+				value = page.GrayAt(p.X, p.Y)
+			}
+			photo.SetGray(x, y, value)
+		}
+	}
+
+	return photo
+}
+
+func TestRectifyPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    Page
+		corners [4][2]float64
+	}{
+		{"straight", Page{Paper: PaperSizeA4}, [4][2]float64{{50, 50}, {890, 50}, {890, 1238}, {50, 1238}}},
+		{"perspective", Page{Paper: PaperSizeA4}, [4][2]float64{{120, 60}, {760, 140}, {700, 1000}, {60, 940}}},
+		{"landscape", Page{Paper: PaperSizeA4, Landscape: true}, [4][2]float64{{30, 40}, {1010, 60}, {1020, 733}, {30, 740}}},
+		{"letter", Page{Paper: PaperSizeLetter}, [4][2]float64{{100, 80}, {900, 120}, {920, 1150}, {60, 1120}}},
+		{"legal", Page{Paper: PaperSizeLegal}, [4][2]float64{{200, 40}, {820, 40}, {820, 1260}, {200, 1260}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			photo := photograph(fiducialTestPage(tt.page, 4), 1050, 1300, tt.corners)
+
+			_, page, ok := LocateFiducials(photo)
+			if !ok {
+				t.Fatalf("Corner markers not found")
+			}
+			// A4 and A5 pages have about the same proportions
+			if page != tt.page && (tt.page.Paper != PaperSizeA4 || page != Page{Paper: PaperSizeA5, Landscape: tt.page.Landscape}) {
+				t.Errorf("got: %s, want: %s.", page, tt.page)
+			}
+
+			rectified, ok := RectifyPage(photo)
+			if !ok {
+				t.Fatalf("Corner markers not found")
+			}
+
+			width, _ := page.Dimensions()
+			scale := float64(rectified.Bounds().Dx()) / width
+			dark := func(x, y float64) uint8 { return rectified.GrayAt(int(x*scale), int(y*scale)).Y }
+
+			if got := dark(betweenFiducials(page, 0.5, 0.45)); got > 0x80 {
+				t.Errorf("Mark should be dark, got: %d.", got)
+			}
+			if got := dark(betweenFiducials(page, 0.3, 0.3)); got < 0x80 {
+				t.Errorf("Paper should be bright, got: %d.", got)
+			}
+			for _, f := range page.Fiducials() {
+				if got := dark(f[0], f[1]); got > 0x80 {
+					t.Errorf("Marker at %v mm should be dark, got: %d.", f, got)
+				}
+			}
+		})
+	}
+
+	t.Run("no markers", func(t *testing.T) {
+		blank := image.NewGray(image.Rect(0, 0, 400, 400))
+		for i := range blank.Pix {
+			blank.Pix[i] = 0xFF
+		}
+		if _, ok := RectifyPage(blank); ok {
+			t.Errorf("Markers should not be found on a blank image")
+		}
+	})
+}
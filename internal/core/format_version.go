@@ -18,9 +18,12 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  */
 
-package internal
+package core
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/caarlos0/log"
@@ -61,6 +64,7 @@ const (
 	PaperCryptContainerVersionUnknown PaperCryptContainerVersion = 0
 	PaperCryptContainerVersionMajor1  PaperCryptContainerVersion = 1
 	PaperCryptContainerVersionMajor2  PaperCryptContainerVersion = 2
+	PaperCryptContainerVersionMajor3  PaperCryptContainerVersion = 3
 	PaperCryptContainerVersionDevel   PaperCryptContainerVersion = PaperCryptContainerVersion(0xFFFFFFFF)
 )
 
@@ -70,6 +74,8 @@ func (v PaperCryptContainerVersion) String() string {
 		return "1"
 	case PaperCryptContainerVersionMajor2:
 		return "2"
+	case PaperCryptContainerVersionMajor3:
+		return "3"
 	case PaperCryptContainerVersionDevel:
 		return "devel"
 	default:
@@ -78,7 +84,8 @@ func (v PaperCryptContainerVersion) String() string {
 }
 
 func PaperCryptContainerVersionFromString(s string) PaperCryptContainerVersion {
-	major := strings.Split(s, ".")[0]
+	// builds of 'go install', and 'go build', are versioned after the module, such as v2.1.0-20240101120000-0123456789ab
+	major := strings.Split(strings.TrimPrefix(s, "v"), ".")[0]
 	log.Debugf("PaperCrypt Version: %s", major)
 
 	switch major {
@@ -92,3 +99,33 @@ func PaperCryptContainerVersionFromString(s string) PaperCryptContainerVersion {
 		return PaperCryptContainerVersionUnknown
 	}
 }
+
+// PaperCryptContainerVersionNewest is the newest container format version this version of PaperCrypt reads, and writes.
+const PaperCryptContainerVersionNewest = PaperCryptContainerVersionMajor3
+
+// ParseFormatVersion parses the value of HeaderFieldFormatVersion, which documents state from version 3 on.
+func ParseFormatVersion(s string) (PaperCryptContainerVersion, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+	if err != nil || n < uint64(PaperCryptContainerVersionMajor3) {
+		return PaperCryptContainerVersionUnknown, fmt.Errorf("invalid `%s` '%s'", HeaderFieldFormatVersion, s)
+	}
+
+	return PaperCryptContainerVersion(n), nil
+}
+
+// NegotiateContainerVersion returns the container format version of a document, written by PaperCrypt version,
+// stating formatVersion (or PaperCryptContainerVersionUnknown, before version 3, which are told apart by version).
+// Documents of versions newer than PaperCryptContainerVersionNewest are rejected, rather than misread.
+func NegotiateContainerVersion(version string, formatVersion PaperCryptContainerVersion) (PaperCryptContainerVersion, error) {
+	if formatVersion == PaperCryptContainerVersionUnknown {
+		return PaperCryptContainerVersionFromString(version), nil
+	}
+	if formatVersion > PaperCryptContainerVersionNewest {
+		return PaperCryptContainerVersionUnknown, WithCategory(ErrorCategoryVersion, fmt.Errorf("the document is of format version %d, this version of PaperCrypt reads up to version %d, update PaperCrypt to read it", formatVersion, PaperCryptContainerVersionNewest))
+	}
+	if formatVersion < PaperCryptContainerVersionMajor3 {
+		return PaperCryptContainerVersionUnknown, errors.New("documents before format version 3 do not state it")
+	}
+
+	return formatVersion, nil
+}
@@ -0,0 +1,313 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// macSaltSize is the size of the salt of new header MACs, in bytes.
+	macSaltSize = 16
+
+	// macAlgorithmMaxTime, and macAlgorithmMaxMemory (1 GiB, in KiB), limit the work of checking the header MAC
+	// of a (damaged or forged) document, beyond DefaultMACAlgorithm, yet within the memory of a small machine.
+	macAlgorithmMaxTime   = 64
+	macAlgorithmMaxMemory = 1024 * 1024
+)
+
+// MACAlgorithm identifies how the header MAC of a document is computed: HMAC-SHA256, keyed by the passphrase,
+// stretched using Argon2id with the given parameters. It is written in the header as HeaderFieldMACAlgorithm.
+type MACAlgorithm struct {
+	// Time is the number of passes of Argon2id over the memory.
+	Time uint32
+
+	// Memory is the memory used by Argon2id, in KiB.
+	Memory uint32
+
+	// Threads is the number of lanes of Argon2id.
+	Threads uint8
+}
+
+// DefaultMACAlgorithm is the MAC algorithm of new documents, using the second recommended option of RFC 9106.
+var DefaultMACAlgorithm = MACAlgorithm{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+func (a MACAlgorithm) String() string {
+	return fmt.Sprintf("HMAC-SHA256, Argon2id, t=%d, m=%d, p=%d", a.Time, a.Memory, a.Threads)
+}
+
+// ParseMACAlgorithm parses a MAC algorithm written by MACAlgorithm.String.
+func ParseMACAlgorithm(s string) (MACAlgorithm, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 || strings.TrimSpace(parts[0]) != "HMAC-SHA256" || strings.TrimSpace(parts[1]) != "Argon2id" {
+		return MACAlgorithm{}, fmt.Errorf("unsupported MAC algorithm '%s'", s)
+	}
+
+	var a MACAlgorithm
+	for _, part := range parts[2:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if !ok || err != nil {
+			return a, fmt.Errorf("invalid MAC algorithm option '%s'", part)
+		}
+
+		switch key {
+		case "t":
+			a.Time = uint32(n)
+		case "m":
+			a.Memory = uint32(n)
+		case "p":
+			if n > 255 {
+				return a, fmt.Errorf("invalid MAC algorithm option '%s'", part)
+			}
+			a.Threads = uint8(n)
+		default:
+			return a, fmt.Errorf("unknown MAC algorithm option '%s'", key)
+		}
+	}
+
+	if a.Time < 1 || a.Time > macAlgorithmMaxTime || a.Threads < 1 || a.Memory < 8*uint32(a.Threads) || a.Memory > macAlgorithmMaxMemory {
+		return a, fmt.Errorf("invalid MAC algorithm '%s'", s)
+	}
+
+	return a, nil
+}
+
+// MarshalText writes the MAC algorithm as in the header, for the JSON payload of the 2D code.
+func (a MACAlgorithm) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText reads a MAC algorithm written by MarshalText.
+func (a *MACAlgorithm) UnmarshalText(text []byte) error {
+	algorithm, err := ParseMACAlgorithm(string(text))
+	if err != nil {
+		return err
+	}
+
+	*a = algorithm
+	return nil
+}
+
+// HeaderMAC authenticates the header of a document of PaperCryptContainerVersionMajor3, binding the description
+// of the document (its serial number, purpose, dates, and so on) to the checksums of its content, see PaperCrypt.Authenticate.
+type HeaderMAC struct {
+	Algorithm MACAlgorithm `json:"a"`
+	Salt      []byte       `json:"s"`
+	Sum       []byte       `json:"m"`
+}
+
+// check returns an error if the header MAC is malformed.
+func (m *HeaderMAC) check() error {
+	if _, err := ParseMACAlgorithm(m.Algorithm.String()); err != nil {
+		return err
+	}
+	if len(m.Salt) < 8 || len(m.Salt) > 64 {
+		return fmt.Errorf("invalid `%s`: %d bytes", HeaderFieldMACSalt, len(m.Salt))
+	}
+	if len(m.Sum) != sha256.Size {
+		return fmt.Errorf("invalid `%s`: %d bytes", HeaderFieldHeaderMAC, len(m.Sum))
+	}
+
+	return nil
+}
+
+// parseHeaderMAC reads the header MAC from the header fields of a document of PaperCryptContainerVersionMajor3.
+func parseHeaderMAC(headers map[string]string) (*HeaderMAC, error) {
+	for _, field := range []string{HeaderFieldMACAlgorithm, HeaderFieldMACSalt, HeaderFieldHeaderMAC} {
+		if _, ok := headers[field]; !ok {
+			return nil, newFieldNotPresentError(field)
+		}
+	}
+
+	algorithm, err := ParseMACAlgorithm(headers[HeaderFieldMACAlgorithm])
+	if err != nil {
+		return nil, err
+	}
+	salt, err := BytesFromBase64(headers[HeaderFieldMACSalt])
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("invalid `%s`", HeaderFieldMACSalt), err)
+	}
+	sum, err := BytesFromBase64(headers[HeaderFieldHeaderMAC])
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("invalid `%s`", HeaderFieldHeaderMAC), err)
+	}
+
+	mac := &HeaderMAC{Algorithm: algorithm, Salt: salt, Sum: sum}
+	return mac, mac.check()
+}
+
+// headerFields returns the header fields of the header MAC, as written by GetText.
+func (m *HeaderMAC) headerFields() [][2]string {
+	return [][2]string{
+		{HeaderFieldMACAlgorithm, m.Algorithm.String()},
+		{HeaderFieldMACSalt, base64.StdEncoding.EncodeToString(m.Salt)},
+		{HeaderFieldHeaderMAC, base64.StdEncoding.EncodeToString(m.Sum)},
+	}
+}
+
+// ContainerVersion returns the container format version of the document, its FormatVersion,
+// or, for documents before version 3, the major version of PaperCrypt they were generated by (2 for development builds).
+func (p *PaperCrypt) ContainerVersion() PaperCryptContainerVersion {
+	if p.FormatVersion != PaperCryptContainerVersionUnknown {
+		return p.FormatVersion
+	}
+
+	version := PaperCryptContainerVersionFromString(p.Version)
+	if version == PaperCryptContainerVersionDevel {
+		return PaperCryptContainerVersionMajor2
+	}
+
+	return version
+}
+
+// headerMAC returns the header MAC of the document, adding an empty one if there is none, for the CBOR payload to fill in.
+func (p *PaperCrypt) headerMAC() *HeaderMAC {
+	if p.HeaderMAC == nil {
+		p.HeaderMAC = &HeaderMAC{}
+	}
+
+	return p.HeaderMAC
+}
+
+// checkFormatVersion returns an error if the format version of a document is not supported,
+// or a document of PaperCryptContainerVersionMajor3 lacks a well-formed header MAC.
+func (p *PaperCrypt) checkFormatVersion() error {
+	if p.FormatVersion == PaperCryptContainerVersionUnknown {
+		if p.HeaderMAC != nil {
+			return errors.New("documents before format version 3 have no header MAC")
+		}
+		return nil
+	}
+
+	if _, err := NegotiateContainerVersion(p.Version, p.FormatVersion); err != nil {
+		return err
+	}
+	if p.HeaderMAC == nil {
+		return WithCategory(ErrorCategoryChecksum, fmt.Errorf("the header MAC of the format version %d document is missing", p.FormatVersion))
+	}
+
+	return p.HeaderMAC.check()
+}
+
+// authenticatedHeader returns the canonical serialization of the header fields covered by the header MAC, as "Name: length:value" lines,
+// the length of each value in bytes, so values holding line breaks can not shift text into the next field, in the order of GetText: those describing the document, and its content, with dates in the form of FormatTimeStamp.
+// The version of PaperCrypt, and the fields describing how the data block is printed, are left out,
+// so the document can be printed again in another layout, or restored from its 2D code, keeping its header MAC.
+func (p *PaperCrypt) authenticatedHeader() []byte {
+	fields := [][2]string{
+		{HeaderFieldFormatVersion, p.FormatVersion.String()},
+		{HeaderFieldSerial, p.SerialNumber},
+	}
+	if !p.PrivateMetadata {
+		// only the encrypted data holds the purpose and comment, once they are revealed
+		fields = append(fields, [2]string{HeaderFieldPurpose, p.Purpose}, [2]string{HeaderFieldComment, p.Comment})
+	}
+	fields = append(fields, [2]string{HeaderFieldDate, FormatTimeStamp(p.CreatedAt)})
+	if !p.ExpiresAt.IsZero() {
+		fields = append(fields, [2]string{HeaderFieldExpires, FormatDueDate(p.ExpiresAt)})
+	}
+	if !p.ReviewBy.IsZero() {
+		fields = append(fields, [2]string{HeaderFieldReviewBy, FormatDueDate(p.ReviewBy)})
+	}
+	if p.Supersedes != "" {
+		fields = append(fields, [2]string{HeaderFieldSupersedes, p.Supersedes})
+	}
+	fields = append(fields, [2]string{HeaderFieldDataFormat, p.DataFormat.String()})
+	if p.PrivateMetadata {
+		fields = append(fields, [2]string{HeaderFieldMetadata, HeaderValueMetadataEncrypted})
+	}
+	if p.ExternalMessage {
+		fields = append(fields, [2]string{HeaderFieldMessage, HeaderValueMessageExternal})
+	}
+	fields = append(fields,
+		[2]string{HeaderFieldContentLength, fmt.Sprint(p.GetDataLength())},
+		[2]string{HeaderFieldCRC24, fmt.Sprintf("%06x", p.DataCRC24)},
+		[2]string{HeaderFieldCRC32, fmt.Sprintf("%08x", p.DataCRC32)},
+		[2]string{HeaderFieldSHA256, base64.StdEncoding.EncodeToString(p.DataSHA256[:])},
+	)
+	if len(p.PlaintextSHA256) > 0 {
+		fields = append(fields, [2]string{HeaderFieldPlaintextSHA256, base64.StdEncoding.EncodeToString(p.PlaintextSHA256)})
+	}
+	fields = append(fields, p.HeaderMAC.headerFields()[:2]...)
+
+	var header strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&header, "%s: %d:%s\n", field[0], len(field[1]), field[1])
+	}
+
+	return []byte(header.String())
+}
+
+// headerMACSum computes the header MAC of the document, keyed by passphrase.
+func (p *PaperCrypt) headerMACSum(passphrase []byte) []byte {
+	a := p.HeaderMAC.Algorithm
+	key := argon2.IDKey(passphrase, p.HeaderMAC.Salt, a.Time, a.Memory, a.Threads, sha256.Size)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(p.authenticatedHeader())
+	return mac.Sum(nil)
+}
+
+// Authenticate makes the document one of PaperCryptContainerVersionMajor3, with a header MAC keyed by passphrase
+// (the passphrase its data is encrypted with), so changes to its header are found when it is decoded.
+// It is to be called once the header of the document is complete.
+func (p *PaperCrypt) Authenticate(passphrase []byte) error {
+	salt := make([]byte, macSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return errors.Join(errors.New("error generating the salt of the header MAC"), err)
+	}
+
+	p.FormatVersion = PaperCryptContainerVersionMajor3
+	p.HeaderMAC = &HeaderMAC{Algorithm: DefaultMACAlgorithm, Salt: salt}
+	p.HeaderMAC.Sum = p.headerMACSum(passphrase)
+
+	return nil
+}
+
+// ErrHeaderMAC is returned by Decode, if the header of a document does not match its header MAC.
+var ErrHeaderMAC = WithCategory(ErrorCategoryChecksum, errors.New("the header does not match its MAC, it was changed after the document was generated, or the passphrase is not the one it was generated with"))
+
+// VerifyHeaderMAC checks the header MAC of a document of PaperCryptContainerVersionMajor3, keyed by passphrase,
+// documents of earlier versions have none, and pass.
+func (p *PaperCrypt) VerifyHeaderMAC(passphrase []byte) error {
+	if p.FormatVersion == PaperCryptContainerVersionUnknown {
+		return nil
+	}
+	if err := p.checkFormatVersion(); err != nil {
+		return err
+	}
+
+	if !hmac.Equal(p.headerMACSum(passphrase), p.HeaderMAC.Sum) {
+		return ErrHeaderMAC
+	}
+
+	return nil
+}
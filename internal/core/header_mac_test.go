@@ -0,0 +1,229 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAuthenticatedDocument returns a document of format version 3, encrypted, and authenticated, using passphrase.
+func newAuthenticatedDocument(t *testing.T, passphrase []byte) *PaperCrypt {
+	t.Helper()
+
+	data, err := CompressAndEncrypt(passphrase, []byte("authenticated content"), false)
+	if err != nil {
+		t.Fatalf("CompressAndEncrypt failed with error %s", err)
+	}
+	pc := NewPaperCrypt("2.0.0", data, "ABC-123", "Purpose", "Comment", time.Date(2024, 8, 1, 20, 38, 10, 0, time.UTC), PaperCryptDataFormatPGP)
+	pc.ReviewBy = time.Date(2029, 8, 1, 0, 0, 0, 0, time.UTC)
+	pc.Supersedes = "ABC-122"
+	if err := pc.Authenticate(passphrase); err != nil {
+		t.Fatalf("Authenticate failed with error %s", err)
+	}
+
+	return pc
+}
+
+func TestHeaderMACRoundTrip(t *testing.T) {
+	passphrase := []byte("correct horse")
+	pc := newAuthenticatedDocument(t, passphrase)
+
+	text, err := pc.GetText(EncodingOptions{Encoding: PaperCryptDataEncodingBase32, ErrorCorrectionLevel: 20})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	if !strings.Contains(string(text), HeaderFieldFormatVersion+": 3\n") || !strings.Contains(string(text), HeaderFieldHeaderMAC+": ") {
+		t.Fatalf("the header lacks the format version, or the MAC:\n%s", text)
+	}
+	if err := ValidateDocumentText(text); err != nil {
+		t.Errorf("ValidateDocumentText failed with error %s", err)
+	}
+
+	fromText, err := DeserializeText(text, false, false)
+	if err != nil {
+		t.Fatalf("DeserializeText failed with error %s", err)
+	}
+	documents := []*PaperCrypt{fromText}
+	for _, format := range []QRPayloadFormat{QRPayloadFormatJSON, QRPayloadFormatCBOR} {
+		payload, err := pc.QRPayload(format)
+		if err != nil {
+			t.Fatalf("QRPayload failed with error %s", err)
+		}
+		fromPayload, err := DeserializeQRPayload(payload)
+		if err != nil {
+			t.Fatalf("DeserializeQRPayload failed with error %s", err)
+		}
+		documents = append(documents, fromPayload)
+	}
+
+	for _, document := range documents {
+		if document.FormatVersion != PaperCryptContainerVersionMajor3 || document.HeaderMAC == nil {
+			t.Fatalf("got: %v, want: %v.", document.FormatVersion, PaperCryptContainerVersionMajor3)
+		}
+		if document.Supersedes != pc.Supersedes {
+			t.Errorf("got: %v, want: %v.", document.Supersedes, pc.Supersedes)
+		}
+		if _, err := document.Decode(passphrase); err != nil {
+			t.Errorf("Decode failed with error %s", err)
+		}
+	}
+}
+
+func TestHeaderMACDetectsChanges(t *testing.T) {
+	passphrase := []byte("correct horse")
+	pc := newAuthenticatedDocument(t, passphrase)
+
+	changes := map[string]func(p *PaperCrypt){
+		"purpose":             func(p *PaperCrypt) { p.Purpose = "Something else" },
+		"date":                func(p *PaperCrypt) { p.CreatedAt = p.CreatedAt.Add(time.Hour) },
+		"review by":           func(p *PaperCrypt) { p.ReviewBy = time.Time{} },
+		"superseded document": func(p *PaperCrypt) { p.Supersedes = "" },
+		"serial":              func(p *PaperCrypt) { p.SerialNumber = "ABC-124" },
+	}
+	for name, change := range changes {
+		changed := *pc
+		change(&changed)
+		if _, err := changed.Decode(passphrase); !errors.Is(err, ErrHeaderMAC) {
+			t.Errorf("changing the %s: got: %v, want: %v.", name, err, ErrHeaderMAC)
+		}
+	}
+
+	// text moved from the comment into the purpose, across a line break, changes the header
+	moved, original := *pc, *pc
+	moved.Purpose, moved.Comment = "Purpose\nComment: Comment", "Moved"
+	original.Purpose, original.Comment = "Purpose", "Comment\nComment: Moved"
+	if bytes.Equal(moved.authenticatedHeader(), original.authenticatedHeader()) {
+		t.Errorf("moving text between the purpose and the comment should change the authenticated header")
+	}
+
+	// the text is changed, and its header checksum fixed, the MAC still tells
+	text, err := pc.GetText(EncodingOptions{})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	text = []byte(strings.Replace(string(text), "Purpose: Purpose", "Purpose: Tampered", 1))
+	tampered, err := DeserializeText(text, false, true)
+	if err != nil {
+		t.Fatalf("DeserializeText failed with error %s", err)
+	}
+	if _, err := tampered.Decode(passphrase); !errors.Is(err, ErrHeaderMAC) {
+		t.Errorf("got: %v, want: %v.", err, ErrHeaderMAC)
+	}
+
+	// a wrong passphrase fails to decrypt, before the MAC is checked
+	if _, err := pc.Decode([]byte("wrong")); !errors.Is(err, ErrDecryption) {
+		t.Errorf("got: %v, want: %v.", err, ErrDecryption)
+	}
+}
+
+func TestHeaderMACRequired(t *testing.T) {
+	pc := newAuthenticatedDocument(t, []byte("correct horse"))
+
+	// a downgrade to format version 3 without the MAC is rejected, rather than read as unauthenticated
+	stripped := *pc
+	stripped.HeaderMAC = nil
+	payload, err := stripped.QRPayload(QRPayloadFormatCBOR)
+	if err != nil {
+		t.Fatalf("QRPayload failed with error %s", err)
+	}
+	if _, err := DeserializeQRPayload(payload); err == nil {
+		t.Errorf("Expected a format version 3 payload without a header MAC to be rejected")
+	}
+
+	text, err := pc.GetText(EncodingOptions{})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	lines := strings.Split(string(text), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, HeaderFieldHeaderMAC+": ") {
+			lines = append(lines[:i], lines[i+1:]...)
+			break
+		}
+	}
+	if _, err := DeserializeText([]byte(strings.Join(lines, "\n")), false, true); err == nil {
+		t.Errorf("Expected a format version 3 document without a header MAC to be rejected")
+	}
+}
+
+func TestNegotiateContainerVersion(t *testing.T) {
+	tests := []struct {
+		version       string
+		formatVersion PaperCryptContainerVersion
+		want          PaperCryptContainerVersion
+	}{
+		{"1.0.2", PaperCryptContainerVersionUnknown, PaperCryptContainerVersionMajor1},
+		{"2.3.0", PaperCryptContainerVersionUnknown, PaperCryptContainerVersionMajor2},
+		{"devel", PaperCryptContainerVersionUnknown, PaperCryptContainerVersionDevel},
+		{"v2.0.0-20240101120000-0123456789ab+dirty", PaperCryptContainerVersionUnknown, PaperCryptContainerVersionMajor2},
+		{"2.3.0", PaperCryptContainerVersionMajor3, PaperCryptContainerVersionMajor3},
+		{"devel", PaperCryptContainerVersionMajor3, PaperCryptContainerVersionMajor3},
+	}
+	for _, test := range tests {
+		got, err := NegotiateContainerVersion(test.version, test.formatVersion)
+		if err != nil {
+			t.Fatalf("NegotiateContainerVersion failed with error %s", err)
+		}
+		if got != test.want {
+			t.Errorf("got: %v, want: %v.", got, test.want)
+		}
+	}
+
+	_, err := NegotiateContainerVersion("3.0.0", PaperCryptContainerVersionMajor3+1)
+	if category := CategoryOf(err); category != ErrorCategoryVersion {
+		t.Errorf("got: %v, want: %v.", category, ErrorCategoryVersion)
+	}
+	for _, value := range []string{"", "2", "three", "-3"} {
+		if _, err := ParseFormatVersion(value); err == nil {
+			t.Errorf("Expected format version %q to be rejected", value)
+		}
+	}
+}
+
+func TestParseMACAlgorithm(t *testing.T) {
+	got, err := ParseMACAlgorithm(DefaultMACAlgorithm.String())
+	if err != nil {
+		t.Fatalf("ParseMACAlgorithm failed with error %s", err)
+	}
+	if got != DefaultMACAlgorithm {
+		t.Errorf("got: %v, want: %v.", got, DefaultMACAlgorithm)
+	}
+
+	for _, value := range []string{
+		"",
+		"HMAC-SHA1, Argon2id, t=3, m=65536, p=4",
+		"HMAC-SHA256, scrypt, t=3, m=65536, p=4",
+		"HMAC-SHA256, Argon2id, t=0, m=65536, p=4",
+		"HMAC-SHA256, Argon2id, t=3, m=99999999, p=4",
+		"HMAC-SHA256, Argon2id, t=3, m=2097152, p=4",
+		"HMAC-SHA256, Argon2id, t=3, m=16, p=4",
+		"HMAC-SHA256, Argon2id, t=3, m=65536, p=0",
+		"HMAC-SHA256, Argon2id, t=3, m=65536, p=4, x=1",
+	} {
+		if _, err := ParseMACAlgorithm(value); err == nil {
+			t.Errorf("Expected MAC algorithm %q to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// LineChecksum is the checksum algorithm used for the lines of a data block, and the block itself.
+type LineChecksum uint8
+
+const (
+	LineChecksumCRC24  LineChecksum = 0
+	LineChecksumCRC32  LineChecksum = 1
+	LineChecksumSHA256 LineChecksum = 2
+	// LineChecksumUnknown is returned for unknown algorithm names.
+	LineChecksumUnknown LineChecksum = 0xFF
+)
+
+func (c LineChecksum) String() string {
+	switch c {
+	case LineChecksumCRC24:
+		return "CRC-24"
+	case LineChecksumCRC32:
+		return "CRC-32"
+	case LineChecksumSHA256:
+		return "SHA-256"
+	default:
+		return "Unknown"
+	}
+}
+
+func LineChecksumFromString(s string) LineChecksum {
+	switch strings.ReplaceAll(strings.ToLower(s), "-", "") {
+	case "crc24":
+		return LineChecksumCRC24
+	case "crc32":
+		return LineChecksumCRC32
+	case "sha256":
+		return LineChecksumSHA256
+	default:
+		return LineChecksumUnknown
+	}
+}
+
+// Sum returns the checksum of data.
+// For SHA-256, the hash is truncated to its first four bytes.
+func (c LineChecksum) Sum(data []byte) uint32 {
+	switch c {
+	case LineChecksumCRC32:
+		return crc32.ChecksumIEEE(data)
+	case LineChecksumSHA256:
+		hash := sha256.Sum256(data)
+		return binary.BigEndian.Uint32(hash[:4])
+	default:
+		return Crc24Checksum(data)
+	}
+}
+
+// Format returns the checksum as base16 (hex) digits, padded to the size of the checksum.
+func (c LineChecksum) Format(sum uint32) string {
+	if c == LineChecksumCRC24 {
+		return fmt.Sprintf("%06X", sum)
+	}
+
+	return fmt.Sprintf("%08X", sum)
+}
+
+// Validate checks that checksum matches the checksum of data.
+func (c LineChecksum) Validate(data []byte, checksum uint32) bool {
+	return c.Sum(data) == checksum
+}
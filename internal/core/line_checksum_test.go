@@ -0,0 +1,68 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLineChecksum(t *testing.T) {
+	check := []byte("123456789")
+	sums := map[LineChecksum]string{
+		LineChecksumCRC24:  "21CF02",
+		LineChecksumCRC32:  "CBF43926",
+		LineChecksumSHA256: "15E2B0D3",
+	}
+
+	for checksum, want := range sums {
+		t.Run(checksum.String(), func(t *testing.T) {
+			if got := checksum.Format(checksum.Sum(check)); got != want {
+				t.Errorf("got: %s, want: %s.", got, want)
+			}
+
+			if parsed := LineChecksumFromString(checksum.String()); parsed != checksum {
+				t.Errorf("Parsing was incorrect, got: %s, want: %s.", parsed, checksum)
+			}
+		})
+	}
+
+	data := []byte("PaperCrypt lets you prepare encrypted messages for printing on paper.")
+	for checksum := range sums {
+		t.Run(checksum.String()+" round trip", func(t *testing.T) {
+			encoded := []byte(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase16, DefaultDataLayout, checksum))
+			decoded, err := DeserializeBinaryEncoded(&encoded, PaperCryptDataEncodingBase16, DefaultDataLayout, checksum)
+			if err != nil {
+				t.Fatalf("DeserializeBinaryEncoded failed with error %s", err)
+			}
+
+			if !bytes.Equal(decoded, data) {
+				t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+			}
+
+			// swap two bytes of the first line
+			swapped := bytes.Replace(encoded, []byte("50 61"), []byte("61 50"), 1)
+			if _, err := DeserializeBinaryEncoded(&swapped, PaperCryptDataEncodingBase16, DefaultDataLayout, checksum); err == nil {
+				t.Errorf("DeserializeBinaryEncoded should fail with swapped bytes")
+			}
+		})
+	}
+}
@@ -18,7 +18,7 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  */
 
-package internal
+package core
 
 import (
 	goversion "github.com/caarlos0/go-version"
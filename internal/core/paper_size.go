@@ -0,0 +1,177 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"math"
+	"strings"
+)
+
+// PaperSize is the size of the pages of generated documents.
+type PaperSize uint8
+
+const (
+	// PaperSizeA4 is ISO A4, 210 x 297 mm.
+	PaperSizeA4 PaperSize = 0
+	// PaperSizeLetter is US Letter, 8.5 x 11 in.
+	PaperSizeLetter PaperSize = 1
+	// PaperSizeA5 is ISO A5, 148 x 210 mm.
+	PaperSizeA5 PaperSize = 2
+	// PaperSizeLegal is US Legal, 8.5 x 14 in.
+	PaperSizeLegal PaperSize = 3
+	// PaperSizeUnknown is returned for unknown paper size names.
+	PaperSizeUnknown PaperSize = 0xFF
+)
+
+const (
+	// a4ContentWidth is the width between the margins of A4 pages in portrait orientation, in mm.
+	a4ContentWidth = 170.0
+	// pageHeaderHeight is the space above the content of pages, including the header line, in mm.
+	pageHeaderHeight = 25.0
+	// PageFooterHeight is the space below the content of pages, including the page numbers, in mm.
+	PageFooterHeight = 15.0
+)
+
+// PaperSizes lists the supported paper sizes.
+var PaperSizes = []PaperSize{PaperSizeA4, PaperSizeLetter, PaperSizeA5, PaperSizeLegal}
+
+func (s PaperSize) String() string {
+	switch s {
+	case PaperSizeA4:
+		return "A4"
+	case PaperSizeLetter:
+		return "Letter"
+	case PaperSizeA5:
+		return "A5"
+	case PaperSizeLegal:
+		return "Legal"
+	default:
+		return "Unknown"
+	}
+}
+
+func PaperSizeFromString(s string) PaperSize {
+	switch strings.ToLower(s) {
+	case "a4", "":
+		return PaperSizeA4
+	case "letter":
+		return PaperSizeLetter
+	case "a5":
+		return PaperSizeA5
+	case "legal":
+		return PaperSizeLegal
+	default:
+		return PaperSizeUnknown
+	}
+}
+
+// Dimensions returns the width and height of the paper, in mm.
+func (s PaperSize) Dimensions() (float64, float64) {
+	switch s {
+	case PaperSizeLetter:
+		return 215.9, 279.4
+	case PaperSizeA5:
+		return 148, 210
+	case PaperSizeLegal:
+		return 215.9, 355.6
+	default:
+		return 210, 297
+	}
+}
+
+// Margin returns the left and right margin of pages, in mm.
+// The small A5 pages get narrower margins, which still fit the unprintable area of most printers.
+func (s PaperSize) Margin() float64 {
+	if s == PaperSizeA5 {
+		return 12
+	}
+
+	return 20
+}
+
+// Page is the size and orientation of the pages of generated documents.
+type Page struct {
+	// Paper is the size of the paper.
+	Paper PaperSize
+
+	// Landscape turns the pages sideways, for longer lines of data.
+	Landscape bool
+}
+
+// Pages lists the supported paper sizes, in portrait and landscape orientation.
+func Pages() []Page {
+	pages := make([]Page, 0, 2*len(PaperSizes))
+	for _, landscape := range []bool{false, true} {
+		for _, paper := range PaperSizes {
+			pages = append(pages, Page{Paper: paper, Landscape: landscape})
+		}
+	}
+
+	return pages
+}
+
+func (p Page) String() string {
+	if p.Landscape {
+		return p.Paper.String() + " landscape"
+	}
+
+	return p.Paper.String()
+}
+
+// Dimensions returns the width and height of the page, in mm.
+func (p Page) Dimensions() (float64, float64) {
+	width, height := p.Paper.Dimensions()
+	if p.Landscape {
+		return height, width
+	}
+
+	return width, height
+}
+
+// Margin returns the left and right margin of the page, in mm.
+func (p Page) Margin() float64 {
+	return p.Paper.Margin()
+}
+
+// ContentWidth returns the width of the area between the margins, in mm.
+func (p Page) ContentWidth() float64 {
+	width, _ := p.Dimensions()
+	return width - 2*p.Margin()
+}
+
+// Code2DPrintSize returns the width (and height) of the area 2D codes are printed in, in mm.
+// On landscape pages, the height of the page below the header limits the size.
+func (p Page) Code2DPrintSize() float64 {
+	_, height := p.Dimensions()
+	return min(p.ContentWidth(), height-pageHeaderHeight-PageFooterHeight) - (a4ContentWidth - Code2DPrintSize)
+}
+
+// FitDataLayout adjusts the number of columns of a layout to the width of the page.
+// The default number of columns is chosen for A4 in portrait orientation,
+// narrower pages get fewer columns, and landscape pages more, wider portrait pages keep the layout as it is.
+func (p Page) FitDataLayout(layout DataLayout) DataLayout {
+	ratio := p.ContentWidth() / a4ContentWidth
+	if ratio < 1 || p.Landscape {
+		layout.Columns = max(int(math.Floor(float64(layout.Columns)*ratio)), 1)
+	}
+
+	return layout
+}
@@ -0,0 +1,80 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"testing"
+)
+
+func TestPaperSizeFromString(t *testing.T) {
+	for _, paper := range PaperSizes {
+		if got := PaperSizeFromString(paper.String()); got != paper {
+			t.Errorf("got: %s, want: %s.", got, paper)
+		}
+	}
+	if got := PaperSizeFromString("tabloid"); got != PaperSizeUnknown {
+		t.Errorf("got: %s, want: %s.", got, PaperSizeUnknown)
+	}
+}
+
+func TestPaperSizeCode2DPrintSize(t *testing.T) {
+	if got := (Page{}).Code2DPrintSize(); got != Code2DPrintSize {
+		t.Errorf("got: %.1f, want: %.1f.", got, Code2DPrintSize)
+	}
+
+	a5 := Page{Paper: PaperSizeA5}
+	opts := Code2DOptions{Type: Code2DTypeQR, PrintArea: a5.Code2DPrintSize()}
+	if size, _ := opts.PrintSize(25); size != a5.Code2DPrintSize() {
+		t.Errorf("got: %.1f, want: %.1f.", size, a5.Code2DPrintSize())
+	}
+	for _, page := range Pages() {
+		width, height := page.Dimensions()
+		if size := page.Code2DPrintSize(); size > page.ContentWidth() || size > height-pageHeaderHeight-PageFooterHeight {
+			t.Errorf("2D code of %.1f mm does not fit the %.0f x %.0f mm %s page", size, width, height, page)
+		}
+	}
+}
+
+func TestPaperSizeFitDataLayout(t *testing.T) {
+	tests := []struct {
+		page    Page
+		columns int
+	}{
+		{Page{Paper: PaperSizeA4}, BytesPerLine},
+		{Page{Paper: PaperSizeLetter}, BytesPerLine},
+		{Page{Paper: PaperSizeLegal}, BytesPerLine},
+		{Page{Paper: PaperSizeA5}, 17},
+		{Page{Paper: PaperSizeA4, Landscape: true}, 36},
+		{Page{Paper: PaperSizeA5, Landscape: true}, 26},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page.String(), func(t *testing.T) {
+			layout := tt.page.FitDataLayout(DefaultDataLayout)
+			if layout.Columns != tt.columns {
+				t.Errorf("got: %d, want: %d.", layout.Columns, tt.columns)
+			}
+			if err := layout.Validate(); err != nil {
+				t.Errorf("Validate failed with error %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// ByteRange is a range of bytes, from Start (inclusive) to End (exclusive).
+type ByteRange struct {
+	Start int
+	End   int
+}
+
+// String returns the range as "bytes 48-71", counting from 0, with an inclusive end.
+func (r ByteRange) String() string {
+	if r.End-r.Start == 1 {
+		return fmt.Sprintf("byte %d", r.Start)
+	}
+
+	return fmt.Sprintf("bytes %d-%d", r.Start, r.End-1)
+}
+
+// appendByteRange appends r to ranges, merging it with the last range, if they are adjacent.
+func appendByteRange(ranges []ByteRange, r ByteRange) []ByteRange {
+	if len(ranges) > 0 && ranges[len(ranges)-1].End == r.Start {
+		ranges[len(ranges)-1].End = r.End
+		return ranges
+	}
+
+	return append(ranges, r)
+}
+
+// FormatByteRanges lists the ranges, separated by commas.
+func FormatByteRanges(ranges []ByteRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.String()
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// PartialPlaintext is the data recovered by DecodePartial.
+type PartialPlaintext struct {
+	// Data is the beginning of the decrypted data, as far as it could be recovered.
+	Data []byte
+
+	// Complete is true if all of the data was recovered, confirmed by the checksum of the compressed data.
+	Complete bool
+}
+
+// readPrefix reads from r until the end, or an error, and returns what was read, and whether the end was reached.
+func readPrefix(r io.Reader) ([]byte, bool) {
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, r)
+	return buf.Bytes(), err == nil
+}
+
+// gunzipPrefix decompresses as much of the gzip data as possible, and returns whether the stream
+// was complete, including its checksum.
+func gunzipPrefix(data []byte) ([]byte, bool) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+
+	return readPrefix(gzipReader)
+}
+
+// DecodePartial decrypts and decompresses as much of the content as possible, despite the lost byte ranges
+// (see DeserializeV2TextPartial). As the content is compressed (and for PGP, encrypted in a stream),
+// bytes after the first lost byte can not be recovered, the data is recovered up to that point.
+func (p *PaperCrypt) DecodePartial(passphrase []byte, lost []ByteRange) (*PartialPlaintext, error) {
+	content := p.Data
+	if len(lost) > 0 {
+		content = content[:lost[0].Start]
+	}
+
+	data := content
+	messageComplete := false
+	if p.DataFormat == PaperCryptDataFormatPGP {
+		message, _ := gunzipPrefix(content)
+		if len(message) == 0 {
+			return nil, errors.New("the beginning of the content is lost, nothing can be recovered")
+		}
+
+		prompted := false
+		prompt := func(_ []openpgp.Key, symmetric bool) ([]byte, error) {
+			if prompted || !symmetric {
+				return nil, errors.New("incorrect passphrase")
+			}
+
+			prompted = true
+			return passphrase, nil
+		}
+		details, err := openpgp.ReadMessage(bytes.NewReader(message), nil, prompt, nil)
+		if err != nil {
+			return nil, errors.Join(ErrDecryption, err)
+		}
+
+		// the integrity of the message can only be checked at its end, which may be lost
+		data, messageComplete = readPrefix(details.UnverifiedBody)
+	}
+
+	var plaintext []byte
+	var complete bool
+	if p.ExternalMessage {
+		// the plaintext of messages encrypted by other software is not compressed, its end is confirmed by the message
+		plaintext, complete = data, messageComplete
+	} else {
+		plaintext, complete = gunzipPrefix(data)
+	}
+	if len(plaintext) == 0 && !complete {
+		return nil, errors.New("the beginning of the content is lost, nothing can be recovered")
+	}
+
+	// the private metadata is at the beginning, if it is lost, the recovered data is returned along with what is left of it
+	if data, err := p.revealPrivateMetadata(plaintext); err == nil {
+		plaintext = data
+	}
+
+	// the header MAC covers the header alone, it is checked even if content is lost
+	if err := p.VerifyHeaderMAC(passphrase); err != nil {
+		return nil, err
+	}
+
+	return &PartialPlaintext{Data: plaintext, Complete: complete}, nil
+}
@@ -0,0 +1,151 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// gzipped compresses data, as generate does.
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if _, err := gzipWriter.Write(data); err != nil {
+		t.Fatalf("Writing to gzip writer failed with error %s", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("Closing gzip writer failed with error %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// removeDataLines removes the numbered lines of the data block from the document text.
+func removeDataLines(text []byte, lines ...int) []byte {
+	for _, line := range lines {
+		text = regexp.MustCompile(fmt.Sprintf(`(?m)^ *%d: .*\n`, line)).ReplaceAll(text, nil)
+	}
+
+	return text
+}
+
+func TestByteRangeString(t *testing.T) {
+	ranges := appendByteRange(nil, ByteRange{Start: 48, End: 72})
+	ranges = appendByteRange(ranges, ByteRange{Start: 72, End: 96})
+	ranges = appendByteRange(ranges, ByteRange{Start: 120, End: 121})
+
+	if got, want := FormatByteRanges(ranges), "bytes 48-95, byte 120"; got != want {
+		t.Errorf("Formatting was incorrect, got: %s, want: %s.", got, want)
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	random := make([]byte, 1500)
+	_, _ = rand.Read(random)
+	plaintext := []byte(hex.EncodeToString(random))
+	passphrase := []byte("correct horse battery staple")
+
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(gzipped(t, plaintext)), passphrase)
+	if err != nil {
+		t.Fatalf("EncryptMessageWithPassword failed with error %s", err)
+	}
+
+	pc := NewPaperCrypt("2.0.0", gzipped(t, encrypted.GetBinary()), "ABCDEF", "Purpose", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), PaperCryptDataFormatPGP)
+	text, err := pc.GetText(EncodingOptions{Encoding: PaperCryptDataEncodingBase16, ErrorCorrectionLevel: 5})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	bytesPerLine := DefaultDataLayout.BytesPerLine()
+
+	t.Run("complete", func(t *testing.T) {
+		// a single lost line is reconstructed
+		restored, lost, err := DeserializeV2TextPartial(removeDataLines(text, 20), false)
+		if err != nil {
+			t.Fatalf("DeserializeV2TextPartial failed with error %s", err)
+		}
+		if len(lost) != 0 {
+			t.Errorf("No bytes should be lost, got: %s.", FormatByteRanges(lost))
+		}
+
+		recovered, err := restored.DecodePartial(passphrase, lost)
+		if err != nil {
+			t.Fatalf("DecodePartial failed with error %s", err)
+		}
+		if !recovered.Complete || !bytes.Equal(recovered.Data, plaintext) {
+			t.Errorf("Recovery was incorrect, got: %d bytes (complete: %t), want: %d bytes.", len(recovered.Data), recovered.Complete, len(plaintext))
+		}
+	})
+
+	t.Run("incomplete", func(t *testing.T) {
+		// more consecutive lost lines than error correction can reconstruct, in every stripe, and another one after them
+		ecc, err := NewErrorCorrection((len(pc.Data)+bytesPerLine-1)/bytesPerLine, 5)
+		if err != nil {
+			t.Fatalf("NewErrorCorrection failed with error %s", err)
+		}
+		count := ecc.Stripes * (ecc.ParityLines + 1)
+		var lines []int
+		for line := 20; line < 20+count; line++ {
+			lines = append(lines, line)
+		}
+		lines = append(lines, 30+count)
+
+		restored, lost, err := DeserializeV2TextPartial(removeDataLines(text, lines...), false)
+		if err != nil {
+			t.Fatalf("DeserializeV2TextPartial failed with error %s", err)
+		}
+		want := []ByteRange{{Start: 19 * bytesPerLine, End: (19 + count) * bytesPerLine}, {Start: (29 + count) * bytesPerLine, End: (30 + count) * bytesPerLine}}
+		if FormatByteRanges(lost) != FormatByteRanges(want) {
+			t.Errorf("Lost ranges were incorrect, got: %s, want: %s.", FormatByteRanges(lost), FormatByteRanges(want))
+		}
+
+		recovered, err := restored.DecodePartial(passphrase, lost)
+		if err != nil {
+			t.Fatalf("DecodePartial failed with error %s", err)
+		}
+		if recovered.Complete {
+			t.Errorf("Recovery should be incomplete")
+		}
+		if len(recovered.Data) == 0 || !bytes.HasPrefix(plaintext, recovered.Data) {
+			t.Errorf("Recovered data should be a prefix of the plaintext, got: %d bytes.", len(recovered.Data))
+		}
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		restored, lost, err := DeserializeV2TextPartial(removeDataLines(text, 30, 31, 32, 33), false)
+		if err != nil {
+			t.Fatalf("DeserializeV2TextPartial failed with error %s", err)
+		}
+		if _, err := restored.DecodePartial([]byte("wrong"), lost); err == nil {
+			t.Errorf("DecodePartial should fail with a wrong passphrase")
+		}
+	})
+}
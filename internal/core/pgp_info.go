@@ -0,0 +1,193 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// OpenPGP packet tags, see RFC 9580, section 5.
+const (
+	pgpTagPKESK = 1
+	pgpTagSKESK = 3
+	pgpTagSED   = 9
+	pgpTagSEIPD = 18
+	pgpTagAEAD  = 20
+)
+
+// pgpCiphers names the symmetric ciphers of OpenPGP, by their identifier.
+var pgpCiphers = map[byte]string{
+	2: "TripleDES", 3: "CAST5", 4: "Blowfish", 7: "AES-128", 8: "AES-192", 9: "AES-256", 10: "Twofish",
+	11: "Camellia-128", 12: "Camellia-192", 13: "Camellia-256",
+}
+
+// pgpHashes names the hash algorithms of OpenPGP, by their identifier.
+var pgpHashes = map[byte]string{
+	1: "MD5", 2: "SHA-1", 3: "RIPEMD-160", 8: "SHA-256", 9: "SHA-384", 10: "SHA-512", 11: "SHA-224", 12: "SHA3-256", 14: "SHA3-512",
+}
+
+// pgpAEADModes names the AEAD modes of OpenPGP, by their identifier.
+var pgpAEADModes = map[byte]string{1: "EAX", 2: "OCB", 3: "GCM"}
+
+// pgpName returns the name of an algorithm, or its identifier, if it is unknown.
+func pgpName(names map[byte]string, id byte) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown (%d)", id)
+}
+
+// PGPMessageInfo describes how an OpenPGP message is encrypted, as read from its packets, without decrypting it.
+type PGPMessageInfo struct {
+	// Cipher is the symmetric cipher the data is encrypted with, such as "AES-256".
+	Cipher string
+
+	// KDF describes how the key is derived from the passphrase, such as
+	// "iterated and salted S2K, SHA-256, 65011712 bytes hashed".
+	KDF string
+
+	// Integrity describes how the data is protected against tampering, such as "MDC (SEIPD v1)", or "AEAD, OCB (SEIPD v2)".
+	Integrity string
+}
+
+// parseS2K describes a string-to-key specifier, see RFC 9580, section 3.7.
+func parseS2K(s2k []byte) (string, error) {
+	if len(s2k) < 2 {
+		return "", errors.New("string-to-key specifier is too short")
+	}
+
+	switch s2k[0] {
+	case 0:
+		return fmt.Sprintf("simple S2K, %s", pgpName(pgpHashes, s2k[1])), nil
+	case 1:
+		return fmt.Sprintf("salted S2K, %s", pgpName(pgpHashes, s2k[1])), nil
+	case 3:
+		if len(s2k) < 11 {
+			return "", errors.New("string-to-key specifier is too short")
+		}
+		c := uint32(s2k[10])
+		count := (16 + c&15) << ((c >> 4) + 6)
+		return fmt.Sprintf("iterated and salted S2K, %s, %d bytes hashed", pgpName(pgpHashes, s2k[1]), count), nil
+	case 4:
+		if len(s2k) < 20 {
+			return "", errors.New("string-to-key specifier is too short")
+		}
+		return fmt.Sprintf("Argon2id, %d passes, %d lanes, %d KiB of memory", s2k[17], s2k[18], 1<<s2k[19]), nil
+	default:
+		return "", fmt.Errorf("unknown string-to-key type %d", s2k[0])
+	}
+}
+
+// parseSKESK reads the cipher and key derivation of a symmetric-key encrypted session key packet.
+func parseSKESK(contents []byte, info *PGPMessageInfo) error {
+	if len(contents) < 3 {
+		return errors.New("session key packet is too short")
+	}
+
+	switch contents[0] {
+	case 4:
+		info.Cipher = pgpName(pgpCiphers, contents[1])
+		kdf, err := parseS2K(contents[2:])
+		info.KDF = kdf
+		return err
+	case 5:
+		if len(contents) < 4 {
+			return errors.New("session key packet is too short")
+		}
+		info.Cipher = pgpName(pgpCiphers, contents[1])
+		kdf, err := parseS2K(contents[3:])
+		info.KDF = kdf
+		return err
+	case 6:
+		if len(contents) < 6 {
+			return errors.New("session key packet is too short")
+		}
+		info.Cipher = pgpName(pgpCiphers, contents[2])
+		kdf, err := parseS2K(contents[5:])
+		info.KDF = kdf
+		return err
+	default:
+		return fmt.Errorf("unknown session key packet version %d", contents[0])
+	}
+}
+
+// ReadPGPMessageInfo reads how a binary OpenPGP message is encrypted, from its packets, without decrypting it.
+func ReadPGPMessageInfo(message []byte) (*PGPMessageInfo, error) {
+	info := &PGPMessageInfo{}
+	reader := packet.NewOpaqueReader(bytes.NewReader(message))
+	for {
+		p, err := reader.Next()
+		if err == io.EOF {
+			return nil, errors.New("the message holds no encrypted data")
+		}
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading OpenPGP packet"), err)
+		}
+
+		switch p.Tag {
+		case pgpTagPKESK:
+			info.KDF = "public key"
+		case pgpTagSKESK:
+			if err := parseSKESK(p.Contents, info); err != nil {
+				return nil, err
+			}
+		case pgpTagSED:
+			info.Integrity = "none (legacy encrypted data packet)"
+			return info, nil
+		case pgpTagSEIPD:
+			if len(p.Contents) >= 3 && p.Contents[0] == 2 {
+				// version 2 packets state the cipher themselves
+				info.Cipher = pgpName(pgpCiphers, p.Contents[1])
+				info.Integrity = fmt.Sprintf("AEAD, %s (SEIPD v2)", pgpName(pgpAEADModes, p.Contents[2]))
+			} else {
+				info.Integrity = "MDC (SEIPD v1)"
+			}
+			return info, nil
+		case pgpTagAEAD:
+			if len(p.Contents) >= 3 {
+				info.Cipher = pgpName(pgpCiphers, p.Contents[1])
+				info.Integrity = fmt.Sprintf("AEAD, %s (AEAD encrypted data packet)", pgpName(pgpAEADModes, p.Contents[2]))
+			}
+			return info, nil
+		}
+	}
+}
+
+// EncryptionInfo describes how the content of a document is encrypted, see ReadPGPMessageInfo.
+// It returns nil for documents holding raw data.
+func (p *PaperCrypt) EncryptionInfo() (*PGPMessageInfo, error) {
+	if p.DataFormat != PaperCryptDataFormatPGP {
+		return nil, nil
+	}
+
+	message, err := p.PGPMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadPGPMessageInfo(message)
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+func TestParseS2K(t *testing.T) {
+	salt := make([]byte, 8)
+	tests := []struct {
+		name string
+		s2k  []byte
+		want string
+	}{
+		{"simple", []byte{0, 8}, "simple S2K, SHA-256"},
+		{"salted", append([]byte{1, 2}, salt...), "salted S2K, SHA-1"},
+		{"iterated", append(append([]byte{3, 8}, salt...), 0xff), "iterated and salted S2K, SHA-256, 65011712 bytes hashed"},
+		{"argon2", append(append([]byte{4}, make([]byte, 16)...), 1, 4, 21), "Argon2id, 1 passes, 4 lanes, 2097152 KiB of memory"},
+	}
+	for _, tt := range tests {
+		got, err := parseS2K(tt.s2k)
+		if err != nil {
+			t.Fatalf("parseS2K(%s) failed with error %s", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("parseS2K(%s) was incorrect, got: %s, want: %s.", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseS2K([]byte{3, 8}); err == nil {
+		t.Errorf("parseS2K of a truncated specifier should fail")
+	}
+}
+
+func TestEncryptionInfo(t *testing.T) {
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage([]byte("secret")), []byte("example"))
+	if err != nil {
+		t.Fatalf("EncryptMessageWithPassword failed with error %s", err)
+	}
+
+	pc := NewPaperCrypt("2.0.0", gzipped(t, encrypted.GetBinary()), "ABCDEF", "", "", time.Now(), PaperCryptDataFormatPGP)
+	info, err := pc.EncryptionInfo()
+	if err != nil {
+		t.Fatalf("EncryptionInfo failed with error %s", err)
+	}
+	if info.Cipher != "AES-256" {
+		t.Errorf("EncryptionInfo was incorrect, got: %s, want: %s.", info.Cipher, "AES-256")
+	}
+	if info.KDF == "" || info.Integrity == "" {
+		t.Errorf("EncryptionInfo was incomplete, got: %+v.", info)
+	}
+
+	raw := NewPaperCrypt("2.0.0", gzipped(t, []byte("secret")), "ABCDEF", "", "", time.Now(), PaperCryptDataFormatRaw)
+	info, err = raw.EncryptionInfo()
+	if err != nil {
+		t.Fatalf("EncryptionInfo failed with error %s", err)
+	}
+	if info != nil {
+		t.Errorf("EncryptionInfo of raw data was incorrect, got: %+v, want: nil.", info)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/armor"
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// pgpMessageArmorHeader starts an ASCII armored OpenPGP message, as written by `gpg --armor`.
+const pgpMessageArmorHeader = "-----BEGIN PGP MESSAGE-----"
+
+// gzipMagic are the first bytes of gzip compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// HeaderValueMessageExternal is the value of HeaderFieldMessage of documents holding an OpenPGP message
+// encrypted by other software, see PaperCrypt.ExternalMessage.
+const HeaderValueMessageExternal = "External"
+
+// IsPGPMessage returns whether data is a bare OpenPGP message, rather than a PaperCrypt document:
+// either ASCII armored, or binary, starting with an encrypted session key packet (as written by gpg).
+func IsPGPMessage(data []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(pgpMessageArmorHeader)) {
+		return true
+	}
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return false
+	}
+
+	tag := data[0] & 0x3f // new packet format
+	if data[0]&0x40 == 0 {
+		tag = data[0] >> 2 & 0x0f // old packet format
+	}
+
+	// public-key, or symmetric-key encrypted session key
+	return tag == 1 || tag == 3
+}
+
+// NewPaperCryptFromPGPMessage wraps a bare OpenPGP message (ASCII armored, or binary) in a PaperCrypt document,
+// so it can be decrypted like the content of a document, for when only the ciphertext survived.
+// The document is marked as holding an external message, so Decode returns the plaintext as gpg does,
+// clear ExternalMessage for messages exported by PaperCrypt, whose plaintext is compressed.
+func NewPaperCryptFromPGPMessage(message []byte) (*PaperCrypt, error) {
+	binary := message
+	if trimmed := bytes.TrimSpace(message); bytes.HasPrefix(trimmed, []byte(pgpMessageArmorHeader)) {
+		var err error
+		binary, err = armor.Unarmor(string(trimmed))
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading ASCII armor"), err)
+		}
+	}
+
+	if !IsPGPMessage(binary) {
+		return nil, errors.New("not an encrypted OpenPGP message")
+	}
+
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	if _, err := gzipWriter.Write(binary); err != nil {
+		return nil, errors.Join(errors.New("error writing to gzip writer"), err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, errors.Join(errors.New("error closing gzip writer"), err)
+	}
+
+	pc := NewPaperCrypt(VersionInfo.GitVersion, compressed.Bytes(), "", "", "", time.Now(), PaperCryptDataFormatPGP)
+	pc.ExternalMessage = true
+
+	return pc, nil
+}
+
+// PGPMessage returns the bare OpenPGP message the document holds, as binary, the inverse of NewPaperCryptFromPGPMessage.
+func (p *PaperCrypt) PGPMessage() ([]byte, error) {
+	if p.DataFormat != PaperCryptDataFormatPGP {
+		return nil, errors.New("the document holds raw data, not an OpenPGP message")
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(p.Data))
+	if err != nil {
+		return nil, errors.Join(errors.New("error creating gzip reader"), err)
+	}
+	message, err := io.ReadAll(gzipReader)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading from gzip reader"), err)
+	}
+
+	return message, nil
+}
+
+// ArmoredPGPMessage returns the OpenPGP message the document holds, ASCII armored, as `gpg --decrypt` reads it.
+func (p *PaperCrypt) ArmoredPGPMessage() (string, error) {
+	message, err := p.PGPMessage()
+	if err != nil {
+		return "", err
+	}
+
+	armored, err := armor.ArmorWithType(message, constants.PGPMessageHeader)
+	if err != nil {
+		return "", errors.Join(errors.New("error writing ASCII armor"), err)
+	}
+
+	return armored, nil
+}
@@ -0,0 +1,203 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+func TestIsPGPMessage(t *testing.T) {
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage([]byte("secret")), []byte("example"))
+	if err != nil {
+		t.Fatalf("EncryptMessageWithPassword failed with error %s", err)
+	}
+	armored, err := encrypted.GetArmored()
+	if err != nil {
+		t.Fatalf("GetArmored failed with error %s", err)
+	}
+
+	pc := NewPaperCrypt("2.0.0", gzipped(t, encrypted.GetBinary()), "ABCDEF", "", "", time.Now(), PaperCryptDataFormatPGP)
+	document, err := pc.GetText(EncodingOptions{})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"armored", []byte("\n" + armored), true},
+		{"binary", encrypted.GetBinary(), true},
+		{"document", document, false},
+		{"empty", nil, false},
+		{"gzip", gzipped(t, []byte("secret")), false},
+	}
+	for _, tt := range tests {
+		if got := IsPGPMessage(tt.data); got != tt.want {
+			t.Errorf("IsPGPMessage(%s) was incorrect, got: %t, want: %t.", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewPaperCryptFromPGPMessage(t *testing.T) {
+	passphrase := []byte("example")
+	plaintext := []byte("The quick brown fox jumps over the lazy dog.")
+
+	// PaperCrypt compresses the data before encryption, gpg does not, and its plaintext is returned as it is, even if it is gzip data
+	for name, tc := range map[string]struct {
+		content  []byte
+		external bool
+		want     []byte
+	}{
+		"gpg":        {content: plaintext, external: true, want: plaintext},
+		"gpg gzip":   {content: gzipped(t, plaintext), external: true, want: gzipped(t, plaintext)},
+		"gpg 1f 8b":  {content: []byte{0x1f, 0x8b, 'n', 'o', 't'}, external: true, want: []byte{0x1f, 0x8b, 'n', 'o', 't'}},
+		"papercrypt": {content: gzipped(t, plaintext), want: plaintext},
+	} {
+		t.Run(name, func(t *testing.T) {
+			encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(tc.content), passphrase)
+			if err != nil {
+				t.Fatalf("EncryptMessageWithPassword failed with error %s", err)
+			}
+			armored, err := encrypted.GetArmored()
+			if err != nil {
+				t.Fatalf("GetArmored failed with error %s", err)
+			}
+
+			for _, message := range [][]byte{[]byte(armored), encrypted.GetBinary()} {
+				pc, err := NewPaperCryptFromPGPMessage(message)
+				if err != nil {
+					t.Fatalf("NewPaperCryptFromPGPMessage failed with error %s", err)
+				}
+				if !pc.ExternalMessage {
+					t.Fatalf("ExternalMessage was incorrect, got: %t, want: true.", pc.ExternalMessage)
+				}
+				pc.ExternalMessage = tc.external
+
+				decoded, err := pc.Decode(passphrase)
+				if err != nil {
+					t.Fatalf("Decode failed with error %s", err)
+				}
+				if !bytes.Equal(decoded, tc.want) {
+					t.Errorf("Decoding was incorrect, got: %x, want: %x.", decoded, tc.want)
+				}
+			}
+		})
+	}
+
+	if _, err := NewPaperCryptFromPGPMessage([]byte("-----BEGIN PGP MESSAGE-----\n\nnot armor\n")); err == nil {
+		t.Errorf("NewPaperCryptFromPGPMessage should fail for invalid armor")
+	}
+}
+
+func TestExternalMessageSerialization(t *testing.T) {
+	passphrase := []byte("example")
+	plaintext := gzipped(t, []byte("The quick brown fox jumps over the lazy dog."))
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(plaintext), passphrase)
+	if err != nil {
+		t.Fatalf("EncryptMessageWithPassword failed with error %s", err)
+	}
+	pc, err := NewPaperCryptFromPGPMessage(encrypted.GetBinary())
+	if err != nil {
+		t.Fatalf("NewPaperCryptFromPGPMessage failed with error %s", err)
+	}
+	pc.Version, pc.SerialNumber = "2.0.0", "EIPESR"
+
+	text, err := pc.GetText(EncodingOptions{})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	if !bytes.Contains(text, []byte(HeaderFieldMessage+": "+HeaderValueMessageExternal+"\n")) {
+		t.Errorf("GetText should mark the external message, got: %s", text)
+	}
+	documents := map[string]func() (*PaperCrypt, error){
+		"text": func() (*PaperCrypt, error) { return DeserializeText(text, false, false) },
+	}
+	for _, format := range []QRPayloadFormat{QRPayloadFormatJSON, QRPayloadFormatCBOR} {
+		documents[format.String()] = func() (*PaperCrypt, error) {
+			payload, err := pc.QRPayload(format)
+			if err != nil {
+				return nil, err
+			}
+
+			return DeserializeQRPayload(payload)
+		}
+	}
+
+	for name, document := range documents {
+		deserialized, err := document()
+		if err != nil {
+			t.Fatalf("Deserializing %s failed with error %s", name, err)
+		}
+		if !deserialized.ExternalMessage {
+			t.Errorf("ExternalMessage of %s was incorrect, got: false, want: true.", name)
+		}
+
+		decoded, err := deserialized.Decode(passphrase)
+		if err != nil {
+			t.Fatalf("Decode of %s failed with error %s", name, err)
+		}
+		if !bytes.Equal(decoded, plaintext) {
+			t.Errorf("Decoding of %s was incorrect, got: %x, want: %x.", name, decoded, plaintext)
+		}
+
+		partial, err := deserialized.DecodePartial(passphrase, nil)
+		if err != nil {
+			t.Fatalf("DecodePartial of %s failed with error %s", name, err)
+		}
+		if !partial.Complete || !bytes.Equal(partial.Data, plaintext) {
+			t.Errorf("DecodePartial of %s was incorrect, got: %x (complete: %t), want: %x.", name, partial.Data, partial.Complete, plaintext)
+		}
+	}
+}
+
+func TestArmoredPGPMessage(t *testing.T) {
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage([]byte("secret")), []byte("example"))
+	if err != nil {
+		t.Fatalf("EncryptMessageWithPassword failed with error %s", err)
+	}
+	pc, err := NewPaperCryptFromPGPMessage(encrypted.GetBinary())
+	if err != nil {
+		t.Fatalf("NewPaperCryptFromPGPMessage failed with error %s", err)
+	}
+
+	armored, err := pc.ArmoredPGPMessage()
+	if err != nil {
+		t.Fatalf("ArmoredPGPMessage failed with error %s", err)
+	}
+	message, err := crypto.NewPGPMessageFromArmored(armored)
+	if err != nil {
+		t.Fatalf("NewPGPMessageFromArmored failed with error %s", err)
+	}
+	if !bytes.Equal(message.GetBinary(), encrypted.GetBinary()) {
+		t.Errorf("ArmoredPGPMessage should hold the wrapped message")
+	}
+
+	raw := NewPaperCrypt("2.0.0", gzipped(t, []byte("secret")), "ABCDEF", "", "", time.Now(), PaperCryptDataFormatRaw)
+	if _, err := raw.ArmoredPGPMessage(); err == nil {
+		t.Errorf("ArmoredPGPMessage should fail for raw data")
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPGPWords(t *testing.T) {
+	t.Run("Fingerprint", func(t *testing.T) {
+		data, err := hex.DecodeString("E58294F2E9A227486E8B061B31CC528FD7FA3F19")
+		if err != nil {
+			t.Fatalf("hex.DecodeString failed with error %s", err)
+		}
+
+		want := "topmost Istanbul Pluto vagabond treadmill Pacific brackish dictator goldfish Medusa afflict bravado chatter revolver Dupont midsummer stopwatch whimsical cowbell bottomless"
+		got := strings.Join(PGPWords(data), " ")
+		if got != want {
+			t.Errorf("got: %s, want: %s.", got, want)
+		}
+	})
+
+	t.Run("Unique", func(t *testing.T) {
+		seen := make(map[string]bool, 512)
+		for _, word := range append(PGPWordsEven[:], PGPWordsOdd[:]...) {
+			if seen[word] {
+				t.Errorf("word '%s' is not unique", word)
+			}
+			seen[word] = true
+		}
+	})
+
+	t.Run("ReadBackPhrase", func(t *testing.T) {
+		var hash [32]byte
+		copy(hash[:], []byte{0xE5, 0x82, 0x94, 0xF2, 0xE9, 0xA2, 0x27})
+
+		want := "topmost Istanbul Pluto vagabond treadmill Pacific"
+		if got := ReadBackPhrase(hash); got != want {
+			t.Errorf("got: %s, want: %s.", got, want)
+		}
+	})
+}
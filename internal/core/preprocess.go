@@ -0,0 +1,419 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// PreprocessStep transforms a grayscale scan, to help the barcode readers with difficult images.
+type PreprocessStep struct {
+	// Name describes the step in logs.
+	Name string
+
+	// Apply returns the transformed image, or nil if the step does not apply to the image.
+	Apply func(img *image.Gray) *image.Gray
+}
+
+const (
+	// maxPreprocessSize is the largest width or height images are scaled up to.
+	maxPreprocessSize = 6000
+
+	// deskewMaxAngle is the largest rotation Deskew corrects, in degrees, either way.
+	// Codes turned further are left to the readers, which find them at any angle, if seen straight on.
+	deskewMaxAngle = 20.0
+	// deskewStep is the precision the rotation of an image is estimated to, in degrees.
+	deskewStep = 0.5
+	// preprocessSearchSize is the largest width or height images are scaled down to,
+	// while estimating their rotation, or the outline of their content.
+	preprocessSearchSize = 800
+
+	// perspectiveTolerance is the share by which opposite sides of the outline of the content may differ in length,
+	// and the cosine of its corners may differ from 0, before its perspective is corrected.
+	perspectiveTolerance = 0.03
+	// perspectiveMargin is the white margin around the content once its perspective is corrected,
+	// as a share of its width, or height, keeping the quiet zone of codes.
+	perspectiveMargin = 0.1
+)
+
+// PreprocessSteps are tried in order on scans that can not be read as they are, after ContrastStretch.
+// Pages printed with corner markers are straightened first (see RectifyPage), otherwise,
+// the rotation of the image is corrected (see Deskew), and the outline of its content is mapped onto a rectangle (see CorrectPerspective).
+var PreprocessSteps = []PreprocessStep{
+	{"page detection", func(img *image.Gray) *image.Gray {
+		page, ok := RectifyPage(img)
+		if !ok {
+			return nil
+		}
+		return page
+	}},
+	{"deskew", Deskew},
+	{"perspective correction", func(img *image.Gray) *image.Gray {
+		if straight := Deskew(img); straight != nil {
+			img = straight
+		}
+		return CorrectPerspective(img)
+	}},
+	{"contrast stretch", func(img *image.Gray) *image.Gray { return img }},
+	{"adaptive threshold", func(img *image.Gray) *image.Gray { return AdaptiveThreshold(img) }},
+	{"half scale", func(img *image.Gray) *image.Gray { return ScaleGray(img, 0.5) }},
+	{"double scale", func(img *image.Gray) *image.Gray { return ScaleGray(img, 2) }},
+	{"half scale, adaptive threshold", func(img *image.Gray) *image.Gray { return AdaptiveThreshold(ScaleGray(img, 0.5)) }},
+	{"double scale, adaptive threshold", func(img *image.Gray) *image.Gray { return AdaptiveThreshold(ScaleGray(img, 2)) }},
+}
+
+// GrayImage converts an image to grayscale.
+func GrayImage(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok {
+		return gray
+	}
+
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray.Set(x-bounds.Min.X, y-bounds.Min.Y, img.At(x, y))
+		}
+	}
+
+	return gray
+}
+
+// ContrastStretch converts an image to grayscale, and stretches its brightness,
+// so the darkest percent of the pixels become black, and the brightest percent white.
+// This helps with faded prints, and photos taken in bad lighting.
+func ContrastStretch(img image.Image) *image.Gray {
+	gray := GrayImage(img)
+
+	// sub-images share the pixels of their parent, walk them row by row
+	bounds := gray.Bounds()
+	width := bounds.Dx()
+	row := func(y int) []uint8 {
+		offset := gray.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+		return gray.Pix[offset : offset+width]
+	}
+
+	values := make([]int, 0, width*bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		for _, v := range row(y) {
+			values = append(values, int(v))
+		}
+	}
+	sort.Ints(values)
+	if len(values) == 0 {
+		return gray
+	}
+
+	low, high := values[len(values)/100], values[len(values)-1-len(values)/100]
+	if high <= low {
+		return gray
+	}
+
+	stretched := image.NewGray(image.Rect(0, 0, width, bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		out := stretched.Pix[y*stretched.Stride : y*stretched.Stride+width]
+		for x, v := range row(y) {
+			value := (int(v) - low) * 0xFF / (high - low)
+			out[x] = uint8(min(max(value, 0), 0xFF))
+		}
+	}
+
+	return stretched
+}
+
+// AdaptiveThreshold converts a grayscale image to black and white,
+// comparing each pixel to the mean of its neighbourhood, rather than to a global threshold,
+// so shadows and uneven lighting across the page do not turn whole areas black or white.
+func AdaptiveThreshold(img *image.Gray) *image.Gray {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	radius := max(max(width, height)/32, 4)
+
+	// integral image, so the mean of any window takes constant time
+	integral := make([]int, (width+1)*(height+1))
+	for y := 0; y < height; y++ {
+		rowSum := 0
+		for x := 0; x < width; x++ {
+			rowSum += int(img.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)
+			integral[(y+1)*(width+1)+x+1] = integral[y*(width+1)+x+1] + rowSum
+		}
+	}
+
+	out := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := max(y-radius, 0), min(y+radius+1, height)
+		for x := 0; x < width; x++ {
+			x0, x1 := max(x-radius, 0), min(x+radius+1, width)
+			sum := integral[y1*(width+1)+x1] - integral[y0*(width+1)+x1] - integral[y1*(width+1)+x0] + integral[y0*(width+1)+x0]
+			count := (x1 - x0) * (y1 - y0)
+
+			// pixels more than 10% darker than their surroundings are black
+			value := color.Gray{Y: 0xFF}
+			if int(img.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)*count*100 < sum*90 {
+				value = color.Gray{}
+			}
+			out.SetGray(x, y, value)
+		}
+	}
+
+	return out
+}
+
+// ScaleGray scales a grayscale image by `factor`, averaging the pixels covered by each pixel of the result.
+// Images are not scaled up beyond maxPreprocessSize pixels.
+func ScaleGray(img *image.Gray, factor float64) *image.Gray {
+	bounds := img.Bounds()
+	width, height := int(float64(bounds.Dx())*factor), int(float64(bounds.Dy())*factor)
+	if width < 1 || height < 1 || (factor > 1 && max(width, height) > maxPreprocessSize) {
+		return img
+	}
+
+	out := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy0 := int(float64(y) / factor)
+		sy1 := max(int(float64(y+1)/factor), sy0+1)
+		for x := 0; x < width; x++ {
+			sx0 := int(float64(x) / factor)
+			sx1 := max(int(float64(x+1)/factor), sx0+1)
+
+			sum, count := 0, 0
+			for sy := sy0; sy < sy1 && sy < bounds.Dy(); sy++ {
+				for sx := sx0; sx < sx1 && sx < bounds.Dx(); sx++ {
+					sum += int(img.GrayAt(bounds.Min.X+sx, bounds.Min.Y+sy).Y)
+					count++
+				}
+			}
+			if count > 0 {
+				out.SetGray(x, y, color.Gray{Y: uint8(sum / count)})
+			}
+		}
+	}
+
+	return out
+}
+
+// searchImage returns the image scaled down to at most preprocessSearchSize pixels, converted to black and white,
+// and the factor it was scaled by.
+func searchImage(img *image.Gray) (*image.Gray, float64) {
+	bounds := img.Bounds()
+	factor := min(float64(preprocessSearchSize)/float64(max(bounds.Dx(), bounds.Dy(), 1)), 1)
+	small := img
+	if factor < 1 {
+		small = ScaleGray(img, factor)
+	}
+
+	return AdaptiveThreshold(small), factor
+}
+
+// SkewAngle estimates the angle, in degrees, by which the content of an image (rows of modules, or lines of text)
+// is turned clockwise, up to deskewMaxAngle either way. The angle is the one at which the dark pixels line up
+// in the fewest, most crowded rows.
+func SkewAngle(img *image.Gray) float64 {
+	bw, _ := searchImage(img)
+	bounds := bw.Bounds()
+	centerX, centerY := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+
+	var dark [][2]float64
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			if bw.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y == 0 {
+				dark = append(dark, [2]float64{float64(x) - centerX, float64(y) - centerY})
+			}
+		}
+	}
+	if len(dark) == 0 {
+		return 0
+	}
+
+	diagonal := math.Hypot(centerX, centerY)
+	rows := make([]int, 2*int(diagonal)+2)
+	best, bestScore := 0.0, -1
+	for angle := -deskewMaxAngle; angle <= deskewMaxAngle; angle += deskewStep {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		clear(rows)
+		for _, p := range dark {
+			rows[int(p[1]*cos-p[0]*sin+diagonal)]++
+		}
+
+		score := 0
+		for _, n := range rows {
+			score += n * n
+		}
+		// prefer the smaller correction, if both score the same
+		if score > bestScore || (score == bestScore && math.Abs(angle) < math.Abs(best)) {
+			best, bestScore = angle, score
+		}
+	}
+
+	return best
+}
+
+// Deskew turns an image back by the angle its content is turned by (see SkewAngle), on a white background,
+// large enough to hold all of it. It returns nil if the content is not turned.
+func Deskew(img *image.Gray) *image.Gray {
+	angle := SkewAngle(img)
+	if math.Abs(angle) < deskewStep {
+		return nil
+	}
+
+	return rotateGray(img, angle)
+}
+
+// rotateGray turns an image counterclockwise by angle degrees, undoing a clockwise rotation by the angle.
+func rotateGray(img *image.Gray, angle float64) *image.Gray {
+	bounds := img.Bounds()
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	width := int(math.Ceil(float64(bounds.Dx())*math.Abs(cos) + float64(bounds.Dy())*math.Abs(sin)))
+	height := int(math.Ceil(float64(bounds.Dx())*math.Abs(sin) + float64(bounds.Dy())*math.Abs(cos)))
+	if max(width, height) > maxPreprocessSize {
+		return nil
+	}
+
+	srcX, srcY := float64(bounds.Min.X)+float64(bounds.Dx())/2, float64(bounds.Min.Y)+float64(bounds.Dy())/2
+	out := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		v := float64(y) + 0.5 - float64(height)/2
+		for x := 0; x < width; x++ {
+			u := float64(x) + 0.5 - float64(width)/2
+			out.SetGray(x, y, sampleGray(img, srcX+u*cos-v*sin-0.5, srcY+u*sin+v*cos-0.5))
+		}
+	}
+
+	return out
+}
+
+// CorrectPerspective finds the outline of the dark content of an image, such as a code photographed at an angle,
+// and maps it onto a rectangle, surrounded by a white margin. The corners of the outline are the dark pixels
+// farthest towards the corners of the image, so the content should not be turned (see Deskew).
+// It returns nil if no outline is found, or if it already is a rectangle.
+func CorrectPerspective(img *image.Gray) *image.Gray {
+	corners, ok := contentOutline(img)
+	if !ok {
+		return nil
+	}
+
+	top, bottom := distance(corners[0], corners[1]), distance(corners[3], corners[2])
+	left, right := distance(corners[0], corners[3]), distance(corners[1], corners[2])
+	if rectangular(corners) && math.Abs(top-bottom) <= perspectiveTolerance*max(top, bottom) && math.Abs(left-right) <= perspectiveTolerance*max(left, right) {
+		return nil
+	}
+
+	width, height := (top+bottom)/2, (left+right)/2
+	margin := perspectiveMargin * max(width, height)
+	outWidth, outHeight := int(width+2*margin), int(height+2*margin)
+	if max(outWidth, outHeight) > maxPreprocessSize {
+		return nil
+	}
+
+	target := [4][2]float64{{margin, margin}, {margin + width, margin}, {margin + width, margin + height}, {margin, margin + height}}
+	h, ok := Homography(target, corners)
+	if !ok {
+		return nil
+	}
+
+	bounds := img.Bounds()
+	out := image.NewGray(image.Rect(0, 0, outWidth, outHeight))
+	for y := 0; y < outHeight; y++ {
+		for x := 0; x < outWidth; x++ {
+			sx, sy := h.Apply(float64(x)+0.5, float64(y)+0.5)
+			out.SetGray(x, y, sampleGray(img, float64(bounds.Min.X)+sx-0.5, float64(bounds.Min.Y)+sy-0.5))
+		}
+	}
+
+	return out
+}
+
+// contentOutline returns the corners of the dark content of an image, in pixels of the image,
+// in the order top left, top right, bottom right, bottom left. Specks are ignored, as are outlines
+// covering less than a hundredth of the image.
+func contentOutline(img *image.Gray) ([4][2]float64, bool) {
+	var corners [4][2]float64
+	bw, factor := searchImage(img)
+	bounds := bw.Bounds()
+	isDark := func(x, y int) bool {
+		return image.Pt(x, y).In(bounds) && bw.GrayAt(x, y).Y == 0
+	}
+
+	directions := [4][2]float64{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}}
+	best := [4]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	found := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !isDark(x, y) {
+				continue
+			}
+
+			// specks have fewer than four dark neighbours
+			neighbours := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && isDark(x+dx, y+dy) {
+						neighbours++
+					}
+				}
+			}
+			if neighbours < 4 {
+				continue
+			}
+
+			found = true
+			px, py := float64(x-bounds.Min.X)+0.5, float64(y-bounds.Min.Y)+0.5
+			for i, d := range directions {
+				if score := d[0]*px + d[1]*py; score > best[i] {
+					best[i], corners[i] = score, [2]float64{px / factor, py / factor}
+				}
+			}
+		}
+	}
+	if !found {
+		return corners, false
+	}
+
+	// the area of the outline, by the shoelace formula
+	area := 0.0
+	for i := range corners {
+		next := corners[(i+1)%4]
+		area += corners[i][0]*next[1] - next[0]*corners[i][1]
+	}
+	imageBounds := img.Bounds()
+	if math.Abs(area)/2 < float64(imageBounds.Dx()*imageBounds.Dy())/100 {
+		return corners, false
+	}
+
+	return corners, true
+}
+
+// rectangular returns whether the corners of the quadrilateral are right angles, within perspectiveTolerance.
+func rectangular(corners [4][2]float64) bool {
+	for i := range corners {
+		prev, next := corners[(i+3)%4], corners[(i+1)%4]
+		ax, ay := prev[0]-corners[i][0], prev[1]-corners[i][1]
+		bx, by := next[0]-corners[i][0], next[1]-corners[i][1]
+		if math.Abs(ax*bx+ay*by) > perspectiveTolerance*math.Hypot(ax, ay)*math.Hypot(bx, by) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,226 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/boombuler/barcode"
+)
+
+func TestContrastStretch(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 100, 1))
+	for x := 0; x < 100; x++ {
+		img.SetGray(x, 0, color.Gray{Y: uint8(100 + x/2)})
+	}
+
+	stretched := ContrastStretch(img)
+	if got := stretched.GrayAt(0, 0).Y; got != 0 {
+		t.Errorf("got: %d, want: 0.", got)
+	}
+	if got := stretched.GrayAt(99, 0).Y; got != 0xFF {
+		t.Errorf("got: %d, want: 255.", got)
+	}
+}
+
+func TestContrastStretchSubImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(100 + x/2)})
+		}
+	}
+
+	// sub-images share the pixels, and the stride, of the whole image
+	sub := img.SubImage(image.Rect(60, 10, 90, 40))
+	stretched := ContrastStretch(sub)
+	if stretched.Bounds() != image.Rect(0, 0, 30, 30) {
+		t.Fatalf("got: %v, want: %v.", stretched.Bounds(), image.Rect(0, 0, 30, 30))
+	}
+	if got := stretched.GrayAt(0, 0).Y; got != 0 {
+		t.Errorf("got: %d, want: 0.", got)
+	}
+	if got := stretched.GrayAt(29, 29).Y; got != 0xFF {
+		t.Errorf("got: %d, want: 255.", got)
+	}
+}
+
+func TestAdaptiveThreshold(t *testing.T) {
+	// dark bars on a background that gets brighter from left to right,
+	// the bars on the right are brighter than the background on the left
+	img := image.NewGray(image.Rect(0, 0, 200, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 200; x++ {
+			value := 50 + x
+			if (x/4)%2 == 1 && y >= 10 && y < 30 {
+				value = value / 2
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(value)})
+		}
+	}
+
+	out := AdaptiveThreshold(img)
+	for _, x := range []int{30, 190} {
+		if got := out.GrayAt(x, 20).Y; got != 0 {
+			t.Errorf("Bar at x=%d should be black, got: %d.", x, got)
+		}
+	}
+	for _, x := range []int{10, 170} {
+		if got := out.GrayAt(x, 20).Y; got != 0xFF {
+			t.Errorf("Background at x=%d should be white, got: %d.", x, got)
+		}
+	}
+}
+
+func TestScaleGray(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	img.Pix = []uint8{0, 100, 200, 200, 0, 100, 0, 0}
+
+	half := ScaleGray(img, 0.5)
+	if half.Bounds().Dx() != 2 || half.Bounds().Dy() != 1 {
+		t.Fatalf("got: %v, want: 2x1.", half.Bounds())
+	}
+	if got := half.Pix; got[0] != 50 || got[1] != 100 {
+		t.Errorf("got: %v, want: [50 100].", got)
+	}
+
+	double := ScaleGray(img, 2)
+	if double.Bounds().Dx() != 8 || double.GrayAt(3, 0).Y != 100 {
+		t.Errorf("got: %v, want: 8x4 with pixel (3, 0) = 100.", double.Bounds())
+	}
+
+	huge := image.NewGray(image.Rect(0, 0, maxPreprocessSize, 1))
+	if ScaleGray(huge, 2) != huge {
+		t.Errorf("Images should not be scaled beyond %d pixels", maxPreprocessSize)
+	}
+}
+
+// codeTestImage draws a QR code of the payload, 300 pixels wide, in the middle of a white image of 500 x 500 pixels.
+func codeTestImage(t *testing.T, payload []byte) *image.Gray {
+	code, err := Encode2D(payload, Code2DOptions{Type: Code2DTypeQR})
+	if err != nil {
+		t.Fatalf("Encode2D failed with error %s", err)
+	}
+	codeImg, err := barcode.Scale(code, 300, 300)
+	if err != nil {
+		t.Fatalf("Scale failed with error %s", err)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 500, 500))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(100, 100, 400, 400), codeImg, codeImg.Bounds().Min, draw.Src)
+
+	return img
+}
+
+// tilt projects an image onto a white one of the same size, with its corners at `corners`.
+func tilt(img *image.Gray, corners [4][2]float64) *image.Gray {
+	w, h := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	toImg, ok := Homography(corners, [4][2]float64{{0, 0}, {w, 0}, {w, h}, {0, h}})
+	if !ok {
+		panic("invalid corners")
+	}
+
+	out := image.NewGray(img.Bounds())
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			px, py := toImg.Apply(float64(x)+0.5, float64(y)+0.5)
+			out.SetGray(x, y, sampleGray(img, px-0.5, py-0.5))
+		}
+	}
+
+	return out
+}
+
+// checkScan fails the test if the payload can not be read from the image.
+func checkScan(t *testing.T, img image.Image, payload []byte) {
+	t.Helper()
+
+	results, err := ScanCodeImage(img)
+	if err != nil {
+		t.Fatalf("ScanCodeImage failed with error %s", err)
+	}
+	if len(results) != 1 || !bytes.Equal(results[0], payload) {
+		t.Errorf("got: %q, want: %q.", results, payload)
+	}
+}
+
+func TestDeskew(t *testing.T) {
+	payload := []byte("PaperCrypt deskew")
+	img := codeTestImage(t, payload)
+
+	if got := SkewAngle(img); got != 0 {
+		t.Errorf("got: %v, want: 0.", got)
+	}
+	if Deskew(img) != nil {
+		t.Errorf("Straight images should not be deskewed")
+	}
+
+	for _, angle := range []float64{-12, 7} {
+		// turning back by the negative angle turns the image clockwise
+		turned := rotateGray(img, -angle)
+		if got := SkewAngle(turned); math.Abs(got-angle) > 1 {
+			t.Errorf("got: %v, want: %v.", got, angle)
+		}
+
+		straight := Deskew(turned)
+		if straight == nil {
+			t.Fatalf("Image turned by %v degrees should be deskewed", angle)
+		}
+		if got := SkewAngle(straight); math.Abs(got) > 1 {
+			t.Errorf("got: %v, want: 0.", got)
+		}
+		checkScan(t, straight, payload)
+	}
+}
+
+func TestCorrectPerspective(t *testing.T) {
+	payload := []byte("PaperCrypt perspective")
+	img := codeTestImage(t, payload)
+
+	if CorrectPerspective(img) != nil {
+		t.Errorf("Straight images should not be corrected")
+	}
+
+	tilted := tilt(img, [4][2]float64{{120, 20}, {380, 20}, {500, 500}, {0, 500}})
+	corrected := CorrectPerspective(tilted)
+	if corrected == nil {
+		t.Fatalf("Tilted image should be corrected")
+	}
+
+	// the code fills all of the corrected image, but its margin
+	bounds := corrected.Bounds()
+	if ratio := float64(bounds.Dx()) / float64(bounds.Dy()); math.Abs(ratio-1) > 0.2 {
+		t.Errorf("got: %v, want: about 1.", ratio)
+	}
+	checkScan(t, corrected, payload)
+
+	blank := image.NewGray(image.Rect(0, 0, 100, 100))
+	draw.Draw(blank, blank.Bounds(), image.White, image.Point{}, draw.Src)
+	if CorrectPerspective(blank) != nil {
+		t.Errorf("Blank images should not be corrected")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// HeaderValueMetadataEncrypted is the value of HeaderFieldMetadata of documents with private metadata.
+const HeaderValueMetadataEncrypted = "Encrypted"
+
+// privateMetadataFields are the fields of the document moved inside the encryption, in order.
+var privateMetadataFields = []string{HeaderFieldPurpose, HeaderFieldComment}
+
+// WrapPrivateMetadata prepends the purpose and comment of a document to its plaintext, before it is
+// compressed and encrypted, so the printed header reveals nothing about the contents (see PaperCrypt.PrivateMetadata).
+// They are written as lines like those of the header, separated from the data by two empty lines,
+// so they can be read after restoring the data by hand, too.
+func WrapPrivateMetadata(purpose string, comment string, plaintext []byte) ([]byte, error) {
+	values := []string{purpose, comment}
+
+	var wrapped bytes.Buffer
+	for i, field := range privateMetadataFields {
+		if strings.ContainsAny(values[i], "\r\n") {
+			return nil, fmt.Errorf("%s must not contain line breaks", strings.ToLower(field))
+		}
+		wrapped.WriteString(fmt.Sprintf("%s: %s\n", field, values[i]))
+	}
+	wrapped.WriteString("\n\n")
+	wrapped.Write(plaintext)
+
+	return wrapped.Bytes(), nil
+}
+
+// UnwrapPrivateMetadata splits the plaintext written by WrapPrivateMetadata into the purpose,
+// the comment, and the data.
+func UnwrapPrivateMetadata(plaintext []byte) (purpose string, comment string, data []byte, err error) {
+	header, data, found := bytes.Cut(plaintext, []byte("\n\n\n"))
+	if !found {
+		return "", "", nil, errors.New("private metadata not found before the data")
+	}
+
+	headers, err := TextToHeaderMap(header)
+	if err != nil {
+		return "", "", nil, errors.Join(errors.New("error reading private metadata"), err)
+	}
+
+	return headers[HeaderFieldPurpose], headers[HeaderFieldComment], data, nil
+}
+
+// revealPrivateMetadata restores the purpose and comment of a document with private metadata
+// from its decrypted plaintext, and returns the data without them.
+func (p *PaperCrypt) revealPrivateMetadata(plaintext []byte) ([]byte, error) {
+	if !p.PrivateMetadata {
+		return plaintext, nil
+	}
+
+	purpose, comment, data, err := UnwrapPrivateMetadata(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	p.Purpose, p.Comment = purpose, comment
+
+	return data, nil
+}
@@ -0,0 +1,85 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+func TestPrivateMetadata(t *testing.T) {
+	passphrase := []byte("example")
+	plaintext := []byte("The quick brown fox jumps over the lazy dog.")
+
+	wrapped, err := WrapPrivateMetadata("Bank vault", "Box 12", plaintext)
+	if err != nil {
+		t.Fatalf("WrapPrivateMetadata failed with error %s", err)
+	}
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(gzipped(t, wrapped)), passphrase)
+	if err != nil {
+		t.Fatalf("EncryptMessageWithPassword failed with error %s", err)
+	}
+
+	pc := NewPaperCrypt("2.0.0", gzipped(t, encrypted.GetBinary()), "ABCDEF", "", "", time.Now(), PaperCryptDataFormatPGP)
+	pc.PrivateMetadata = true
+	text, err := pc.GetText(EncodingOptions{})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	if !strings.Contains(string(text), "\nMetadata: Encrypted\n") || strings.Contains(string(text), "Bank vault") {
+		t.Errorf("got: %s, want: the metadata marked as encrypted, and not in the header.", text)
+	}
+
+	restored, err := DeserializeV2Text(text, false, false)
+	if err != nil {
+		t.Fatalf("DeserializeV2Text failed with error %s", err)
+	}
+	if !restored.PrivateMetadata {
+		t.Errorf("got: %v, want: %v.", restored.PrivateMetadata, true)
+	}
+
+	decoded, err := restored.Decode(passphrase)
+	if err != nil {
+		t.Fatalf("Decode failed with error %s", err)
+	}
+	if !bytes.Equal(decoded, plaintext) {
+		t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, plaintext)
+	}
+	if restored.Purpose != "Bank vault" || restored.Comment != "Box 12" {
+		t.Errorf("got: %q and %q, want: %q and %q.", restored.Purpose, restored.Comment, "Bank vault", "Box 12")
+	}
+
+	if _, err := WrapPrivateMetadata("two\nlines", "", plaintext); err == nil {
+		t.Errorf("WrapPrivateMetadata should fail for a purpose with a line break")
+	}
+	if _, _, _, err := UnwrapPrivateMetadata(plaintext); err == nil {
+		t.Errorf("UnwrapPrivateMetadata should fail for data without metadata")
+	}
+
+	header := strings.Replace(string(text), "Metadata: Encrypted", "Metadata: Hidden", 1)
+	if _, err := DeserializeV2Text([]byte(header), false, true); err == nil {
+		t.Errorf("DeserializeV2Text should fail for an unknown metadata mode")
+	}
+}
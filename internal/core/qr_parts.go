@@ -0,0 +1,201 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+
+	"github.com/boombuler/barcode"
+)
+
+// Payloads too large for a single 2D code are split into parts, each prefixed by a part header:
+//
+//	magic "PC", part header version, part number (starting at 1), number of parts,
+//	CRC-32 of the complete payload (4 bytes, big-endian)
+//
+// The checksum identifies the parts belonging together, and validates the reassembled payload.
+// Layers of the experimental color code use their own part header version, see EncodeColorCodes.
+
+// QRPartMagic starts every part of a split 2D code payload.
+const QRPartMagic = "PC"
+
+const (
+	qrPartVersion      = 1
+	qrPartVersionColor = 2
+	qrPartHeaderSize   = len(QRPartMagic) + 3 + 4
+	// QRMaxParts is the maximum number of 2D codes a payload can be split into.
+	QRMaxParts = 255
+)
+
+// QRPart is a part of a 2D code payload.
+type QRPart struct {
+	// Number is the position of the part, starting at 1.
+	Number int
+
+	// Total is the number of parts of the payload.
+	Total int
+
+	// Checksum is the CRC-32 of the complete payload.
+	Checksum uint32
+
+	// Data is the part of the payload held by this part.
+	Data []byte
+
+	// Color is set for layers of an experimental color code.
+	Color bool
+}
+
+// SplitQRPayload splits a payload into `parts` parts of about equal size, each prefixed by a part header.
+func SplitQRPayload(payload []byte, parts int) ([][]byte, error) {
+	return splitQRPayload(payload, parts, qrPartVersion)
+}
+
+func splitQRPayload(payload []byte, parts int, version byte) ([][]byte, error) {
+	if parts < 1 || parts > QRMaxParts {
+		return nil, fmt.Errorf("number of parts must be between 1 and %d, got %d", QRMaxParts, parts)
+	}
+
+	checksum := crc32.ChecksumIEEE(payload)
+	size := (len(payload) + parts - 1) / parts
+
+	result := make([][]byte, parts)
+	for i := range result {
+		start, end := min(i*size, len(payload)), min((i+1)*size, len(payload))
+
+		part := make([]byte, 0, qrPartHeaderSize+end-start)
+		part = append(part, QRPartMagic...)
+		part = append(part, version, byte(i+1), byte(parts))
+		part = binary.BigEndian.AppendUint32(part, checksum)
+		result[i] = append(part, payload[start:end]...)
+	}
+
+	return result, nil
+}
+
+// IsQRPart returns whether the scanned data is a part of a split payload.
+func IsQRPart(data []byte) bool {
+	return len(data) >= qrPartHeaderSize && bytes.HasPrefix(data, []byte(QRPartMagic))
+}
+
+// ParseQRPart parses a part written by SplitQRPayload.
+func ParseQRPart(data []byte) (QRPart, error) {
+	if !IsQRPart(data) {
+		return QRPart{}, errors.New("not a 2D code part")
+	}
+
+	header := data[len(QRPartMagic):qrPartHeaderSize]
+	if header[0] != qrPartVersion && header[0] != qrPartVersionColor {
+		return QRPart{}, fmt.Errorf("unsupported 2D code part version %d", header[0])
+	}
+
+	part := QRPart{
+		Number:   int(header[1]),
+		Total:    int(header[2]),
+		Checksum: binary.BigEndian.Uint32(header[3:]),
+		Data:     data[qrPartHeaderSize:],
+		Color:    header[0] == qrPartVersionColor,
+	}
+	if part.Number < 1 || part.Number > part.Total {
+		return QRPart{}, fmt.Errorf("invalid 2D code part %d of %d", part.Number, part.Total)
+	}
+
+	return part, nil
+}
+
+// JoinQRParts reassembles a payload from its parts, given in any order.
+// Duplicate parts (e.g. from scanning a code twice) are ignored.
+func JoinQRParts(parts []QRPart) ([]byte, error) {
+	if len(parts) == 0 {
+		return nil, errors.New("no 2D code parts")
+	}
+
+	byNumber := make(map[int]QRPart)
+	for _, part := range parts {
+		if part.Total != parts[0].Total || part.Checksum != parts[0].Checksum {
+			return nil, errors.New("2D code parts belong to different documents")
+		}
+
+		byNumber[part.Number] = part
+	}
+
+	numbers := make([]int, 0, len(byNumber))
+	for number := range byNumber {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var missing []int
+	for number := 1; number <= parts[0].Total; number++ {
+		if _, ok := byNumber[number]; !ok {
+			missing = append(missing, number)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing 2D code parts %v of %d", missing, parts[0].Total)
+	}
+
+	var payload []byte
+	for _, number := range numbers {
+		payload = append(payload, byNumber[number].Data...)
+	}
+
+	if crc32.ChecksumIEEE(payload) != parts[0].Checksum {
+		return nil, WithCategory(ErrorCategoryChecksum, errors.New("checksum mismatch of the reassembled 2D code payload"))
+	}
+
+	return payload, nil
+}
+
+// Encode2DParts encodes a payload as a single 2D code if it fits,
+// or splits it into as few parts as necessary, see SplitQRPayload.
+func Encode2DParts(payload []byte, opts Code2DOptions) ([]barcode.Barcode, error) {
+	code, err := Encode2D(payload, opts)
+	if err == nil {
+		return []barcode.Barcode{code}, nil
+	}
+
+	for n := 2; n <= QRMaxParts; n++ {
+		parts, err := SplitQRPayload(payload, n)
+		if err != nil {
+			return nil, err
+		}
+
+		codes := make([]barcode.Barcode, 0, n)
+		for _, part := range parts {
+			code, err := Encode2D(part, opts)
+			if err != nil {
+				break
+			}
+
+			codes = append(codes, code)
+		}
+		if len(codes) == n {
+			return codes, nil
+		}
+	}
+
+	return nil, errors.Join(fmt.Errorf("payload does not fit into %d 2D codes", QRMaxParts), err)
+}
@@ -0,0 +1,101 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestQRParts(t *testing.T) {
+	payload := make([]byte, 1000)
+	_, _ = rand.Read(payload)
+
+	encoded, err := SplitQRPayload(payload, 3)
+	if err != nil {
+		t.Fatalf("SplitQRPayload failed with error %s", err)
+	}
+
+	parse := func(encoded ...[]byte) []QRPart {
+		parts := make([]QRPart, len(encoded))
+		for i, data := range encoded {
+			parts[i], err = ParseQRPart(data)
+			if err != nil {
+				t.Fatalf("ParseQRPart failed with error %s", err)
+			}
+		}
+
+		return parts
+	}
+
+	t.Run("any order", func(t *testing.T) {
+		joined, err := JoinQRParts(parse(encoded[2], encoded[0], encoded[1], encoded[0]))
+		if err != nil {
+			t.Fatalf("JoinQRParts failed with error %s", err)
+		}
+
+		if !bytes.Equal(joined, payload) {
+			t.Errorf("Reassembly was incorrect, got: %x, want: %x.", joined, payload)
+		}
+	})
+
+	t.Run("missing part", func(t *testing.T) {
+		if _, err := JoinQRParts(parse(encoded[0], encoded[2])); err == nil {
+			t.Errorf("JoinQRParts should fail with a missing part")
+		}
+	})
+
+	t.Run("different documents", func(t *testing.T) {
+		other, _ := SplitQRPayload([]byte("another document"), 3)
+		if _, err := JoinQRParts(parse(encoded[0], encoded[1], other[2])); err == nil {
+			t.Errorf("JoinQRParts should fail with parts of different documents")
+		}
+	})
+
+	t.Run("payloads are not parts", func(t *testing.T) {
+		if IsQRPart([]byte(`{"v":"2.0.0"}`)) {
+			t.Errorf("JSON payloads should not be detected as parts")
+		}
+	})
+}
+
+func TestEncode2DParts(t *testing.T) {
+	small := make([]byte, 100)
+	large := make([]byte, 8000)
+	_, _ = rand.Read(large)
+
+	codes, err := Encode2DParts(small, Code2DOptions{Type: Code2DTypeAztec})
+	if err != nil {
+		t.Fatalf("Encode2DParts failed with error %s", err)
+	}
+	if len(codes) != 1 {
+		t.Errorf("Small payloads should fit into a single code, got: %d codes.", len(codes))
+	}
+
+	codes, err = Encode2DParts(large, Code2DOptions{Type: Code2DTypeQR})
+	if err != nil {
+		t.Fatalf("Encode2DParts failed with error %s", err)
+	}
+	if len(codes) < 2 {
+		t.Errorf("Large payloads should be split, got: %d codes.", len(codes))
+	}
+}
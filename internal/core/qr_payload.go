@@ -0,0 +1,446 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// QRPayloadFormat is the serialization of a document inside its 2D code.
+type QRPayloadFormat uint8
+
+const (
+	// QRPayloadFormatJSON serializes the document as JSON, with the data encoded as base64.
+	QRPayloadFormatJSON QRPayloadFormat = 0
+	// QRPayloadFormatCBOR serializes the document as CBOR (RFC 8949), with the data stored as raw bytes.
+	QRPayloadFormatCBOR QRPayloadFormat = 1
+	// QRPayloadFormatUnknown is returned for unknown payload format names.
+	QRPayloadFormatUnknown QRPayloadFormat = 0xFF
+)
+
+// QRPayloadVersionCBOR is the version of the CBOR payload, stored in the payload itself.
+// JSON payloads are considered version 1.
+const QRPayloadVersionCBOR = 2
+
+// keys of the CBOR payload map, small integers are encoded in a single byte
+const (
+	cborKeyPayloadVersion = iota
+	cborKeyVersion
+	cborKeySerialNumber
+	cborKeyPurpose
+	cborKeyComment
+	cborKeyCreatedAt
+	cborKeyDataFormat
+	cborKeyDataCRC24
+	cborKeyDataCRC32
+	cborKeyDataSHA256
+	cborKeyData
+	cborKeyPlaintextSHA256
+	cborKeyExpiresAt
+	cborKeyReviewBy
+	cborKeyPrivateMetadata
+	cborKeyFormatVersion
+	cborKeyMACAlgorithm
+	cborKeyMACSalt
+	cborKeyHeaderMAC
+	cborKeySupersedes
+	cborKeyExternalMessage
+)
+
+// CBOR major types, see RFC 8949, section 3.1
+const (
+	cborMajorUnsigned = 0
+	cborMajorBytes    = 2
+	cborMajorText     = 3
+	cborMajorMap      = 5
+)
+
+func (f QRPayloadFormat) String() string {
+	switch f {
+	case QRPayloadFormatJSON:
+		return "JSON"
+	case QRPayloadFormatCBOR:
+		return "CBOR"
+	default:
+		return "Unknown"
+	}
+}
+
+func QRPayloadFormatFromString(s string) QRPayloadFormat {
+	switch strings.ToLower(s) {
+	case "json":
+		return QRPayloadFormatJSON
+	case "cbor":
+		return QRPayloadFormatCBOR
+	default:
+		return QRPayloadFormatUnknown
+	}
+}
+
+// DetectQRPayloadFormat returns the format of a 2D code payload.
+// JSON payloads are objects, thus start with '{', CBOR payloads are maps (major type 5).
+func DetectQRPayloadFormat(payload []byte) QRPayloadFormat {
+	trimmed := bytes.TrimSpace(payload)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		return QRPayloadFormatJSON
+	case len(payload) > 0 && payload[0]>>5 == cborMajorMap:
+		return QRPayloadFormatCBOR
+	default:
+		return QRPayloadFormatUnknown
+	}
+}
+
+// QRPayload serializes the document for its 2D code.
+func (p *PaperCrypt) QRPayload(format QRPayloadFormat) ([]byte, error) {
+	switch format {
+	case QRPayloadFormatJSON:
+		return json.Marshal(p)
+	case QRPayloadFormatCBOR:
+		return p.MarshalCBOR()
+	default:
+		return nil, fmt.Errorf("unsupported 2D code payload format %s", format)
+	}
+}
+
+// DeserializeQRPayload parses a 2D code payload, written by PaperCrypt.QRPayload in either format.
+func DeserializeQRPayload(payload []byte) (*PaperCrypt, error) {
+	p := &PaperCrypt{}
+	switch DetectQRPayloadFormat(payload) {
+	case QRPayloadFormatJSON:
+		if err := json.Unmarshal(payload, p); err != nil {
+			return nil, errors.Join(errors.New("error deserializing JSON payload"), err)
+		}
+	case QRPayloadFormatCBOR:
+		if err := p.UnmarshalCBOR(payload); err != nil {
+			return nil, errors.Join(errors.New("error deserializing CBOR payload"), err)
+		}
+	default:
+		return nil, errors.New("unknown 2D code payload format")
+	}
+
+	if err := p.checkFormatVersion(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// MarshalCBOR serializes the document as a CBOR map with small integer keys.
+func (p *PaperCrypt) MarshalCBOR() ([]byte, error) {
+	fields := cborKeyData + 1
+	if len(p.PlaintextSHA256) > 0 {
+		fields++
+	}
+	if !p.ExpiresAt.IsZero() {
+		fields++
+	}
+	if !p.ReviewBy.IsZero() {
+		fields++
+	}
+	if p.PrivateMetadata {
+		fields++
+	}
+	if p.FormatVersion != PaperCryptContainerVersionUnknown {
+		fields++
+	}
+	if p.HeaderMAC != nil {
+		fields += 3
+	}
+	if p.Supersedes != "" {
+		fields++
+	}
+	if p.ExternalMessage {
+		fields++
+	}
+
+	buf := new(bytes.Buffer)
+	cborWriteHead(buf, cborMajorMap, uint64(fields))
+
+	cborWriteUint(buf, cborKeyPayloadVersion, QRPayloadVersionCBOR)
+	cborWriteString(buf, cborKeyVersion, p.Version)
+	cborWriteString(buf, cborKeySerialNumber, p.SerialNumber)
+	cborWriteString(buf, cborKeyPurpose, p.Purpose)
+	cborWriteString(buf, cborKeyComment, p.Comment)
+	cborWriteString(buf, cborKeyCreatedAt, FormatTimeStamp(p.CreatedAt))
+	cborWriteUint(buf, cborKeyDataFormat, uint64(p.DataFormat))
+	cborWriteUint(buf, cborKeyDataCRC24, uint64(p.DataCRC24))
+	cborWriteUint(buf, cborKeyDataCRC32, uint64(p.DataCRC32))
+	cborWriteBytes(buf, cborKeyDataSHA256, p.DataSHA256[:])
+	cborWriteBytes(buf, cborKeyData, p.Data)
+	if len(p.PlaintextSHA256) > 0 {
+		cborWriteBytes(buf, cborKeyPlaintextSHA256, p.PlaintextSHA256)
+	}
+	if !p.ExpiresAt.IsZero() {
+		cborWriteString(buf, cborKeyExpiresAt, FormatDueDate(p.ExpiresAt))
+	}
+	if !p.ReviewBy.IsZero() {
+		cborWriteString(buf, cborKeyReviewBy, FormatDueDate(p.ReviewBy))
+	}
+	if p.PrivateMetadata {
+		cborWriteUint(buf, cborKeyPrivateMetadata, 1)
+	}
+	if p.FormatVersion != PaperCryptContainerVersionUnknown {
+		cborWriteUint(buf, cborKeyFormatVersion, uint64(p.FormatVersion))
+	}
+	if p.HeaderMAC != nil {
+		cborWriteString(buf, cborKeyMACAlgorithm, p.HeaderMAC.Algorithm.String())
+		cborWriteBytes(buf, cborKeyMACSalt, p.HeaderMAC.Salt)
+		cborWriteBytes(buf, cborKeyHeaderMAC, p.HeaderMAC.Sum)
+	}
+	if p.Supersedes != "" {
+		cborWriteString(buf, cborKeySupersedes, p.Supersedes)
+	}
+	if p.ExternalMessage {
+		cborWriteUint(buf, cborKeyExternalMessage, 1)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCBOR parses a document serialized by MarshalCBOR.
+// Unknown keys are rejected, as they would be silently lost otherwise.
+func (p *PaperCrypt) UnmarshalCBOR(data []byte) error {
+	r := bytes.NewReader(data)
+
+	major, fields, err := cborReadHead(r)
+	if err != nil {
+		return err
+	}
+	if major != cborMajorMap {
+		return fmt.Errorf("expected a CBOR map, got major type %d", major)
+	}
+
+	payloadVersion := uint64(0)
+	for i := uint64(0); i < fields; i++ {
+		major, key, err := cborReadHead(r)
+		if err != nil {
+			return err
+		}
+		if major != cborMajorUnsigned {
+			return fmt.Errorf("expected an integer key, got major type %d", major)
+		}
+
+		major, value, err := cborReadHead(r)
+		if err != nil {
+			return err
+		}
+
+		var content []byte
+		switch major {
+		case cborMajorUnsigned:
+		case cborMajorBytes, cborMajorText:
+			if value > uint64(r.Len()) {
+				return errors.New("unexpected end of CBOR data")
+			}
+
+			content = make([]byte, value)
+			if _, err := io.ReadFull(r, content); err != nil {
+				return err
+			}
+			if major == cborMajorText && !utf8.Valid(content) {
+				return fmt.Errorf("invalid UTF-8 in CBOR text of key %d", key)
+			}
+		default:
+			return fmt.Errorf("unsupported CBOR major type %d for key %d", major, key)
+		}
+
+		expected := uint8(cborMajorText)
+		switch key {
+		case cborKeyPayloadVersion:
+			expected = cborMajorUnsigned
+			payloadVersion = value
+		case cborKeyVersion:
+			p.Version = string(content)
+		case cborKeySerialNumber:
+			p.SerialNumber = string(content)
+		case cborKeyPurpose:
+			p.Purpose = string(content)
+		case cborKeyComment:
+			p.Comment = string(content)
+		case cborKeyCreatedAt:
+			p.CreatedAt, err = time.Parse(TimeStampFormatLong, string(content))
+			if err != nil {
+				return errors.Join(errors.New("invalid date format"), err)
+			}
+		case cborKeyDataFormat:
+			expected = cborMajorUnsigned
+			p.DataFormat = PaperCryptDataFormat(value)
+		case cborKeyDataCRC24:
+			expected = cborMajorUnsigned
+			p.DataCRC24 = uint32(value)
+		case cborKeyDataCRC32:
+			expected = cborMajorUnsigned
+			p.DataCRC32 = uint32(value)
+		case cborKeyDataSHA256:
+			expected = cborMajorBytes
+			copy(p.DataSHA256[:], content)
+		case cborKeyData:
+			expected = cborMajorBytes
+			p.Data = content
+		case cborKeyPlaintextSHA256:
+			expected = cborMajorBytes
+			p.PlaintextSHA256 = content
+		case cborKeyExpiresAt:
+			p.ExpiresAt, err = ParseOptionalDueDate(string(content))
+			if err != nil {
+				return errors.Join(errors.New("invalid expiry date"), err)
+			}
+		case cborKeyPrivateMetadata:
+			expected = cborMajorUnsigned
+			p.PrivateMetadata = value != 0
+		case cborKeyExternalMessage:
+			expected = cborMajorUnsigned
+			p.ExternalMessage = value != 0
+		case cborKeyReviewBy:
+			p.ReviewBy, err = ParseOptionalDueDate(string(content))
+			if err != nil {
+				return errors.Join(errors.New("invalid review date"), err)
+			}
+		case cborKeyFormatVersion:
+			expected = cborMajorUnsigned
+			if value > uint64(^uint32(0)) {
+				return fmt.Errorf("invalid format version %d", value)
+			}
+			p.FormatVersion = PaperCryptContainerVersion(value)
+		case cborKeyMACAlgorithm:
+			algorithm, err := ParseMACAlgorithm(string(content))
+			if err != nil {
+				return err
+			}
+			p.headerMAC().Algorithm = algorithm
+		case cborKeyMACSalt:
+			expected = cborMajorBytes
+			p.headerMAC().Salt = content
+		case cborKeyHeaderMAC:
+			expected = cborMajorBytes
+			p.headerMAC().Sum = content
+		case cborKeySupersedes:
+			p.Supersedes = string(content)
+		default:
+			return fmt.Errorf("unknown CBOR payload key %d", key)
+		}
+
+		if major != expected {
+			return fmt.Errorf("unexpected CBOR major type %d for key %d", major, key)
+		}
+	}
+
+	if payloadVersion != QRPayloadVersionCBOR {
+		return fmt.Errorf("unsupported CBOR payload version %d", payloadVersion)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d unexpected bytes after CBOR payload", r.Len())
+	}
+
+	return nil
+}
+
+// cborWriteHead writes the initial byte of a data item, and its argument, in the shortest form.
+func cborWriteHead(buf *bytes.Buffer, major uint8, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= 0xFF:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= 0xFFFF:
+		buf.WriteByte(major | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= 0xFFFFFFFF:
+		buf.WriteByte(major | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(major | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+// cborReadHead reads the initial byte of a data item, and its argument.
+// Indefinite lengths are not supported.
+func cborReadHead(r *bytes.Reader) (uint8, uint64, error) {
+	initial, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, errors.New("unexpected end of CBOR data")
+	}
+
+	major, info := initial>>5, initial&0x1F
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("unsupported CBOR additional information %d", info)
+	}
+
+	argument := make([]byte, 1<<(info-24))
+	if _, err := io.ReadFull(r, argument); err != nil {
+		return 0, 0, errors.New("unexpected end of CBOR data")
+	}
+
+	n := uint64(0)
+	for _, b := range argument {
+		n = n<<8 | uint64(b)
+	}
+
+	return major, n, nil
+}
+
+func cborWriteUint(buf *bytes.Buffer, key uint64, value uint64) {
+	cborWriteHead(buf, cborMajorUnsigned, key)
+	cborWriteHead(buf, cborMajorUnsigned, value)
+}
+
+func cborWriteString(buf *bytes.Buffer, key uint64, value string) {
+	cborWriteHead(buf, cborMajorUnsigned, key)
+	cborWriteHead(buf, cborMajorText, uint64(len(value)))
+	buf.WriteString(value)
+}
+
+func cborWriteBytes(buf *bytes.Buffer, key uint64, value []byte) {
+	cborWriteHead(buf, cborMajorUnsigned, key)
+	cborWriteHead(buf, cborMajorBytes, uint64(len(value)))
+	buf.Write(value)
+}
+
+// Latin1Bytes converts text decoded from a 2D code as ISO 8859-1 (the default of Aztec and QR codes)
+// back into the bytes it was encoded from, so binary payloads survive scanning.
+// Text holding characters outside ISO 8859-1 was decoded using another character set, and is returned as UTF-8.
+func Latin1Bytes(text string) []byte {
+	data := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xFF {
+			return []byte(text)
+		}
+
+		data = append(data, byte(r))
+	}
+
+	return data
+}
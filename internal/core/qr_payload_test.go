@@ -0,0 +1,108 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func TestQRPayload(t *testing.T) {
+	data := make([]byte, 1000)
+	_, _ = rand.Read(data)
+
+	createdAt, err := time.Parse(TimeStampFormatLong, "Thu, 01 Aug 2024 20:38:10.306596100 +0200")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := NewPaperCrypt("2.0.0", data, "EIPESR", "Example Sheet", "Café", createdAt, PaperCryptDataFormatPGP)
+	pc.PlaintextSHA256 = pc.DataSHA256[:]
+	pc.ReviewBy = time.Date(2029, 8, 1, 0, 0, 0, 0, time.UTC)
+	pc.PrivateMetadata = true
+
+	sizes := make(map[QRPayloadFormat]int)
+	for _, format := range []QRPayloadFormat{QRPayloadFormatJSON, QRPayloadFormatCBOR} {
+		t.Run(format.String(), func(t *testing.T) {
+			payload, err := pc.QRPayload(format)
+			if err != nil {
+				t.Fatalf("QRPayload failed with error %s", err)
+			}
+			sizes[format] = len(payload)
+
+			if detected := DetectQRPayloadFormat(payload); detected != format {
+				t.Errorf("Detection was incorrect, got: %s, want: %s.", detected, format)
+			}
+
+			// payloads are scanned as ISO 8859-1 text
+			scanned := make([]rune, len(payload))
+			for i, b := range payload {
+				scanned[i] = rune(b)
+			}
+
+			decoded, err := DeserializeQRPayload(Latin1Bytes(string(scanned)))
+			if err != nil {
+				t.Fatalf("DeserializeQRPayload failed with error %s", err)
+			}
+
+			original, _ := pc.GetText(EncodingOptions{})
+			restored, _ := decoded.GetText(EncodingOptions{})
+			if !bytes.Equal(original, restored) {
+				t.Errorf("Decoding was incorrect, got: %s, want: %s.", restored, original)
+			}
+		})
+	}
+
+	if sizes[QRPayloadFormatCBOR] >= sizes[QRPayloadFormatJSON]*4/5 {
+		t.Errorf("CBOR payload should be considerably smaller, got: %d bytes, JSON: %d bytes.", sizes[QRPayloadFormatCBOR], sizes[QRPayloadFormatJSON])
+	}
+
+	t.Run("rejects damaged CBOR", func(t *testing.T) {
+		payload, _ := pc.MarshalCBOR()
+		if _, err := DeserializeQRPayload(payload[:len(payload)-1]); err == nil {
+			t.Errorf("DeserializeQRPayload should fail with truncated data")
+		}
+
+		// change the payload version
+		payload[2] = QRPayloadVersionCBOR + 1
+		if _, err := DeserializeQRPayload(payload); err == nil {
+			t.Errorf("DeserializeQRPayload should fail with an unknown payload version")
+		}
+	})
+}
+
+func FuzzDeserializeQRPayload(f *testing.F) {
+	pc := NewPaperCrypt("2.0.0", []byte("PaperCrypt"), "EIPESR", "Example Sheet", "Café", time.Date(2024, 8, 1, 20, 38, 10, 0, time.UTC), PaperCryptDataFormatRaw)
+	pc.ExpiresAt = time.Date(2029, 8, 1, 0, 0, 0, 0, time.UTC)
+	for _, format := range []QRPayloadFormat{QRPayloadFormatJSON, QRPayloadFormatCBOR} {
+		payload, err := pc.QRPayload(format)
+		if err != nil {
+			f.Fatalf("QRPayload failed with error %s", err)
+		}
+		f.Add(payload)
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		_, _ = DeserializeQRPayload(payload)
+	})
+}
@@ -18,7 +18,7 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  */
 
-package internal
+package core
 
 import (
 	"bytes"
@@ -29,6 +29,13 @@ import (
 	"math/big"
 )
 
+const (
+	// DefaultSerialCharset is the alphabet of random serial numbers, the base32 alphabet.
+	DefaultSerialCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	// DefaultSerialLength is the length of random serial numbers.
+	DefaultSerialLength = 6
+)
+
 // GenerateSerial generates a random serial number of length `length`.
 func GenerateSerial(length uint8) (string, error) {
 	// generate `length` random bytes,
@@ -61,3 +68,26 @@ func GenerateSerial(length uint8) (string, error) {
 
 	return buf.String()[:length], nil
 }
+
+// GenerateSerialFromCharset generates a random serial number of `length` characters, each picked uniformly from charset.
+func GenerateSerialFromCharset(length int, charset string) (string, error) {
+	alphabet := []rune(charset)
+	if len(alphabet) == 0 {
+		return "", errors.New("serial number charset is empty")
+	}
+	if length < 1 {
+		return "", errors.New("serial number length must be positive")
+	}
+
+	serial := make([]rune, length)
+	for i := range serial {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", errors.Join(errors.New("error generating random bytes"), err)
+		}
+
+		serial[i] = alphabet[n.Int64()]
+	}
+
+	return string(serial), nil
+}
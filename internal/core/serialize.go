@@ -0,0 +1,574 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2023-2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/log"
+)
+
+type LineData struct {
+	LineNumber uint32
+	Data       []byte
+	Checksum   uint32
+}
+
+// SerializeBinary returns the encrypted binary data,
+// formatted for restoration
+// lines will hold 22 bytes of data, prefaces by the line number, followed by the CRC-24 of the line,
+// bytes are printed as two base16 (hex) digits, separated by a space.
+// Example:
+//
+//	1: 00 01 02 03 04 05 06 07 08 09 0A 0B 0C 0D 0E 0F 10 11 12 13 14 15 <CRC-24 of this line>
+//	2: ... <CRC-24 of this line>
+//
+// 10: ... <CRC-24 of this line>
+// ...
+// n-1: ... <CRC-24 of this line>
+// n: <CRC-24 of the block>
+//
+// See [example.pdf](example.pdf) for an example.
+func SerializeBinary(data *[]byte, bytesPerLine int) string {
+	layout := DefaultDataLayout
+	layout.Columns = bytesPerLine
+
+	return SerializeBinaryEncoded(data, PaperCryptDataEncodingBase16, layout, LineChecksumCRC24)
+}
+
+// SerializeBinaryEncoded works like SerializeBinary,
+// but writes the data of each line using the given encoding, laid out as described by layout,
+// and checks lines and the block using the given checksum algorithm.
+// Checksums are always written as base16 (hex) digits.
+func SerializeBinaryEncoded(data *[]byte, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum) string {
+	bytesPerLine := layout.BytesPerLine()
+	lines := math.Ceil(float64(len(*data)) / float64(bytesPerLine))
+	lineNumberDigits := int(math.Floor(math.Log10(lines + 1)))
+
+	dataBlock := make([]byte, 0, len(*data)+int(lines)*(lineNumberDigits+1)+1)
+
+	// without line numbers, lines are indented to stay aligned with the column numbers
+	indent := ""
+	columnIndexLine := ""
+	if layout.ColumnIndices && len(*data) > 0 {
+		label := ColumnIndexLabel + ": "
+		if layout.LineIndices {
+			label = strings.Repeat(" ", lineNumberDigits) + label
+		} else {
+			indent = strings.Repeat(" ", len(label))
+		}
+
+		firstLine := encoding.EncodeLine((*data)[:min(bytesPerLine, len(*data))], layout.GroupSize)
+		columnIndexLine = label + ColumnIndices(firstLine) + "\n"
+	}
+
+	for i := 0; i < len(*data); i += bytesPerLine {
+		lineNumber := (i / bytesPerLine) + 1
+		lineNumberPadding := lineNumberDigits - int(math.Floor(math.Log10(float64(lineNumber))))
+
+		startsBlock := lineNumber == 1 || (layout.BlockLines > 0 && (lineNumber-1)%layout.BlockLines == 0)
+		if startsBlock && lineNumber > 1 {
+			dataBlock = append(dataBlock, '\n')
+		}
+		if startsBlock {
+			dataBlock = append(dataBlock, []byte(columnIndexLine)...)
+		}
+
+		line := indent
+		if layout.LineIndices {
+			line = fmt.Sprintf("%s%d: ", string(bytes.Repeat([]byte{' '}, lineNumberPadding)), lineNumber)
+		}
+
+		dataLine := make([]byte, 0, bytesPerLine)
+
+		for j := 0; j < bytesPerLine; j++ {
+			if i+j >= len(*data) {
+				break
+			}
+
+			dataLine = append(dataLine, (*data)[i+j])
+		}
+
+		lineChecksum := checksum.Format(checksum.Sum(dataLine))
+		line += fmt.Sprintf("%s %s\n", encoding.EncodeLine(dataLine, layout.GroupSize), lineChecksum)
+
+		dataBlock = append(dataBlock, []byte(line)...)
+	}
+
+	dataChecksum := checksum.Format(checksum.Sum(*data))
+	finalLineNumber := max(int(lines+1), min(1, int(lines)))
+	if layout.LineIndices {
+		dataBlock = append(dataBlock, []byte(fmt.Sprintf("%d: %s\n", finalLineNumber, dataChecksum))...)
+	} else {
+		dataBlock = append(dataBlock, []byte(fmt.Sprintf("%s%s\n", indent, dataChecksum))...)
+	}
+
+	return string(dataBlock)
+}
+
+// ColumnIndices returns a line holding the (1-based) number of each space separated group of the given line,
+// aligned with the start of the group.
+func ColumnIndices(line string) string {
+	indices := []byte(strings.Repeat(" ", len(line)))
+	column := 0
+	next := 0
+	for i := 0; i < len(line); i++ {
+		if line[i] == ' ' || (i > 0 && line[i-1] != ' ') {
+			continue
+		}
+
+		column++
+		number := fmt.Sprint(column)
+		if i < next || i+len(number) > len(indices) {
+			// not enough room to print the number
+			continue
+		}
+
+		copy(indices[i:], number)
+		next = i + len(number) + 1
+	}
+
+	return strings.TrimRight(string(indices), " ")
+}
+
+// SerializeBinaryV1 serializes binary data using SerializeBinary.
+func SerializeBinaryV1(data *[]byte) string {
+	return SerializeBinary(data, BytesPerLineV1)
+}
+
+// SerializeBinaryV2 serializes binary data using SerializeBinaryEncoded.
+func SerializeBinaryV2(data *[]byte, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum) string {
+	return SerializeBinaryEncoded(data, encoding, layout, checksum)
+}
+
+// DeserializeBinary parses a data block written by SerializeBinary.
+func DeserializeBinary(data *[]byte) ([]byte, error) {
+	return DeserializeBinaryEncoded(data, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24)
+}
+
+// DeserializeBinaryEncoded parses a data block written by SerializeBinaryEncoded,
+// validating the checksum of every line, and of the entire block.
+func DeserializeBinaryEncoded(data *[]byte, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum) ([]byte, error) {
+	rawLines := bytes.Split(*data, []byte{'\n'})
+	lines := make([][]byte, 0)
+
+	// filter out empty lines, and lines holding column numbers
+	for _, line := range rawLines {
+		if len(bytes.TrimSpace(line)) > 0 && !IsColumnIndexLine(line) {
+			lines = append(lines, line)
+		}
+	}
+	trace("read data block", "lines", len(lines), "encoding", encoding, "checksum", checksum, "indices", layout.LineIndices)
+
+	result := make([]LineData, 0)
+
+	var blockChecksumLine []byte
+
+	// 1. Parse lines, validate line checksums
+	for n, line := range lines {
+		// without line numbers, lines are numbered in order of appearance
+		parts := [][]byte{[]byte(fmt.Sprint(n + 1)), bytes.TrimSpace(line)}
+		if layout.LineIndices {
+			parts = bytes.SplitN(line, []byte(": "), 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid line format: %s", line)
+			}
+		}
+
+		lineNumber := strings.ReplaceAll(string(parts[0]), " ", "")
+		lineNumber = strings.ReplaceAll(lineNumber, "\t", "")
+
+		if lineNumber == fmt.Sprint(len(lines)) {
+			// last line, contains the checksum of the data, which is parsed once the data is known
+			trace("read block checksum line", "line", lineNumber)
+			blockChecksumLine = parts[1]
+			continue
+		}
+
+		bytesData, checksumData, err := DecodeLineContent(parts[1], lineNumber, encoding, layout)
+		if err != nil || !checksum.Validate(bytesData, checksumData) {
+			trace("line is not valid as written, trying to correct ambiguous characters", "line", lineNumber, "error", err)
+			// the line may have been typed or read with commonly confused characters, such as O for 0
+			if corrected, sum, ok := correctAmbiguousLine(parts[1], lineNumber, encoding, layout, checksum, 0); ok {
+				bytesData, checksumData, err = corrected, sum, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lineNum := 0
+		_, err = fmt.Sscanf(lineNumber, "%d", &lineNum)
+		if err != nil {
+			return nil, err
+		}
+
+		lineData := LineData{
+			LineNumber: uint32(lineNum),
+			Data:       bytesData,
+			Checksum:   checksumData,
+		}
+
+		if checksum.Validate(lineData.Data, lineData.Checksum) {
+			trace("read line", "line", lineNumber, "bytes", len(lineData.Data), "checksum", checksum.Format(lineData.Checksum))
+			result = append(result, lineData)
+		} else {
+			return nil, WithCategory(ErrorCategoryChecksum, fmt.Errorf("invalid line checksum: line %d has checksum %s, expected %s", lineData.LineNumber, checksum.Format(checksum.Sum(lineData.Data)), checksum.Format(lineData.Checksum)))
+		}
+	}
+
+	// 2. Assemble data
+
+	// 2.1. Sort lines
+	for i := 0; i < len(result); i++ {
+		for j := i + 1; j < len(result); j++ {
+			if result[i].LineNumber > result[j].LineNumber {
+				tmp := result[i]
+				result[i] = result[j]
+				result[j] = tmp
+			}
+		}
+	}
+
+	// 2.2. Ensure that lines are consecutive, starting at 1
+	// as we sorted the lines, we can just check the first and last line
+
+	if len(result) == 0 {
+		return nil, errors.New("no lines found")
+	}
+
+	if result[0].LineNumber != 1 {
+		return nil, fmt.Errorf("invalid first line number: %d", result[0].LineNumber)
+	}
+
+	// this also ensures that we have all lines, as the last line number must equal the number of lines
+	if result[len(result)-1].LineNumber != uint32(len(result)) {
+		return nil, fmt.Errorf("invalid last line number: %d", result[len(result)-1].LineNumber)
+	}
+
+	var resultData []byte
+	for _, line := range result {
+		resultData = append(resultData, line.Data...)
+	}
+
+	// 3. Validate data checksum
+	blockChecksum, err := ParseHexUint32(string(blockChecksumLine))
+	trace("comparing block checksum", "written", string(blockChecksumLine), "computed", checksum.Format(checksum.Sum(resultData)))
+	if err != nil || !checksum.Validate(resultData, blockChecksum) {
+		sum, ok := correctAmbiguousChecksum(blockChecksumLine, fmt.Sprint(len(lines)), checksum, resultData)
+		switch {
+		case ok:
+			blockChecksum = sum
+		case err != nil:
+			return nil, fmt.Errorf("error parsing block %s: %s", checksum, blockChecksumLine)
+		default:
+			return nil, WithCategory(ErrorCategoryChecksum, errors.New("invalid block checksum"))
+		}
+	}
+
+	return resultData, nil
+}
+
+// DecodeLineContent decodes the part of a line after its line number, returning its data and checksum.
+func DecodeLineContent(content []byte, lineNumber string, encoding PaperCryptDataEncoding, layout DataLayout) ([]byte, uint32, error) {
+	lineParts := bytes.Fields(content)
+	// lineParts contains groups of encoded data, followed by the checksum
+	// a line must never contain no data, this a line must contain at least two parts, one group and the checksum
+	// (the last line, containing only the block checksum, is handled by the caller)
+	if len(lineParts) < 2 {
+		return nil, 0, fmt.Errorf("unexpected line length: line %s: %s", lineNumber, content)
+	}
+
+	// lineParts[0] - lineParts[last-1] contain the data
+	bytesData, err := encoding.DecodeLine(lineParts[0 : len(lineParts)-1])
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(bytesData) > layout.BytesPerLine() {
+		return nil, 0, fmt.Errorf("unexpected line length: line %s: %s", lineNumber, content)
+	}
+
+	// while the last part contains the checksum
+	checksumHex := lineParts[len(lineParts)-1]
+
+	checksumData, err := ParseHexUint32(string(checksumHex))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error parsing line checksum: %s", checksumHex)
+	}
+
+	return bytesData, checksumData, nil
+}
+
+// SerializeParityLines writes the parity lines of a data block (see ErrorCorrection),
+// in the same way as SerializeBinaryEncoded writes data lines, numbered P1, P2, and so on.
+func SerializeParityLines(parity [][]byte, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum) string {
+	var block strings.Builder
+	for n, line := range parity {
+		block.WriteString(fmt.Sprintf("%s%d: %s %s\n", ParityLinePrefix, n+1, encoding.EncodeLine(line, layout.GroupSize), checksum.Format(checksum.Sum(line))))
+	}
+
+	return block.String()
+}
+
+// numberedBlock is a data block with line numbers, as read by readNumberedBlock.
+// Lines which are missing, or fail their checksum, are nil.
+type numberedBlock struct {
+	lines     [][]byte
+	lineSizes []int
+	parity    [][]byte
+
+	// blockChecksumLine is the content of the line holding the checksum of the data, if present.
+	blockChecksumLine []byte
+}
+
+// readNumberedBlock reads the data and parity lines of a data block with line numbers, skipping those
+// which are missing, or fail their checksum, contentLength is the expected length of the data.
+func readNumberedBlock(data []byte, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum, parityLines int, contentLength int) numberedBlock {
+	bytesPerLine := layout.BytesPerLine()
+	dataLines := (contentLength + bytesPerLine - 1) / bytesPerLine
+	trace("expecting data block", "lines", dataLines, "parity", parityLines, "width", bytesPerLine)
+
+	block := numberedBlock{
+		lines:     make([][]byte, dataLines),
+		lineSizes: make([]int, dataLines),
+		parity:    make([][]byte, parityLines),
+	}
+	for i := range block.lineSizes {
+		block.lineSizes[i] = min(bytesPerLine, contentLength-i*bytesPerLine)
+	}
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 || IsColumnIndexLine(line) {
+			continue
+		}
+
+		label, content, found := bytes.Cut(line, []byte(": "))
+		lineNumber := strings.TrimSpace(string(label))
+		isParity := strings.HasPrefix(lineNumber, ParityLinePrefix)
+		number, err := strconv.Atoi(strings.TrimPrefix(lineNumber, ParityLinePrefix))
+		if !found || err != nil {
+			log.Warn(Warning(fmt.Sprintf("Skipping unreadable line: %s", line)))
+			continue
+		}
+
+		if !isParity && number == dataLines+1 {
+			// last line, contains the checksum of the data
+			trace("read block checksum line", "line", lineNumber)
+			block.blockChecksumLine = content
+			continue
+		}
+
+		target, expectedSize := block.lines, 0
+		if isParity {
+			target, expectedSize = block.parity, bytesPerLine
+		}
+		if number < 1 || number > len(target) {
+			log.Warn(Warning(fmt.Sprintf("Skipping line with unexpected number: %s", lineNumber)))
+			continue
+		}
+		if !isParity {
+			expectedSize = block.lineSizes[number-1]
+		}
+
+		bytesData, checksumData, err := DecodeLineContent(content, lineNumber, encoding, layout)
+		if err != nil || len(bytesData) != expectedSize || !checksum.Validate(bytesData, checksumData) {
+			trace("line is not valid as written, trying to correct ambiguous characters", "line", lineNumber, "bytes", len(bytesData), "expected", expectedSize, "error", err)
+			if corrected, _, ok := correctAmbiguousLine(content, lineNumber, encoding, layout, checksum, expectedSize); ok {
+				target[number-1] = corrected
+				continue
+			}
+
+			log.Warn(Warning(fmt.Sprintf("Line %s is damaged, trying to reconstruct it.", lineNumber)))
+			continue
+		}
+
+		trace("read line", "line", lineNumber, "bytes", len(bytesData), "checksum", checksum.Format(checksumData))
+		target[number-1] = bytesData
+	}
+
+	return block
+}
+
+// data returns the data lines joined, with missing lines filled with zeros.
+func (b numberedBlock) data() []byte {
+	var data []byte
+	for i, line := range b.lines {
+		if line == nil {
+			line = make([]byte, b.lineSizes[i])
+		}
+		data = append(data, line...)
+	}
+
+	return data
+}
+
+// verifyBlockChecksum checks the checksum of the data against the block checksum line, correcting ambiguous characters.
+// A missing or damaged block checksum line is reported as a warning, relying on the content checksums.
+func (b numberedBlock) verifyBlockChecksum(checksum LineChecksum, data []byte) error {
+	blockChecksum, err := ParseHexUint32(string(b.blockChecksumLine))
+	hasBlockChecksum := b.blockChecksumLine != nil && err == nil
+	if !hasBlockChecksum || !checksum.Validate(data, blockChecksum) {
+		if sum, ok := correctAmbiguousChecksum(b.blockChecksumLine, fmt.Sprint(len(b.lines)+1), checksum, data); ok {
+			blockChecksum, hasBlockChecksum = sum, true
+		}
+	}
+	if !hasBlockChecksum {
+		log.Warn(Warning("Block checksum is missing or damaged, relying on the content checksums."))
+	} else if !checksum.Validate(data, blockChecksum) {
+		return WithCategory(ErrorCategoryChecksum, errors.New("invalid block checksum"))
+	}
+
+	return nil
+}
+
+// DeserializeBinaryWithParity parses a data block followed by parity lines, as written by
+// SerializeBinaryEncoded and SerializeParityLines. Unlike DeserializeBinaryEncoded,
+// lines which are missing, or fail their checksum, are reconstructed using the parity lines, if possible.
+// Line numbers are required, contentLength is the expected length of the data.
+func DeserializeBinaryWithParity(data *[]byte, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum, ecc ErrorCorrection, contentLength int) ([]byte, error) {
+	if !layout.LineIndices {
+		return nil, errors.New("error correction requires line numbers")
+	}
+
+	// each missing data line takes an intact parity line to reconstruct, so a (damaged) content length
+	// far beyond the text is rejected before its data block is read
+	textLines := bytes.Count(*data, []byte{'\n'}) + 1
+	if dataLines := (contentLength + layout.BytesPerLine() - 1) / layout.BytesPerLine(); dataLines > 2*textLines {
+		return nil, fmt.Errorf("too many damaged lines to reconstruct: expected %d data lines, but the text has %d lines", dataLines, textLines)
+	}
+
+	block := readNumberedBlock(*data, encoding, layout, checksum, ecc.Stripes*ecc.ParityLines, contentLength)
+
+	reconstructed, err := ecc.Reconstruct(block.lines, block.parity, block.lineSizes)
+	for _, i := range reconstructed {
+		log.WithField("line", i+1).Info("Reconstructed line using error correction")
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("too many damaged lines to reconstruct"), err)
+	}
+
+	resultData := block.data()
+	if err := block.verifyBlockChecksum(checksum, resultData); err != nil {
+		return nil, err
+	}
+
+	return resultData, nil
+}
+
+// DeserializeBinaryPartial parses a data block like DeserializeBinaryWithParity (or DeserializeBinaryEncoded, if ecc is nil),
+// but does not fail if lines are missing, or damaged beyond repair: they are filled with zeros, and returned as lost byte ranges.
+// Line numbers are required, contentLength is the expected length of the data.
+func DeserializeBinaryPartial(data *[]byte, encoding PaperCryptDataEncoding, layout DataLayout, checksum LineChecksum, ecc *ErrorCorrection, contentLength int) ([]byte, []ByteRange, error) {
+	if !layout.LineIndices {
+		return nil, nil, errors.New("partial recovery requires line numbers")
+	}
+
+	parityLines := 0
+	if ecc != nil {
+		parityLines = ecc.Stripes * ecc.ParityLines
+	}
+	block := readNumberedBlock(*data, encoding, layout, checksum, parityLines, contentLength)
+
+	if ecc != nil {
+		reconstructed, err := ecc.Reconstruct(block.lines, block.parity, block.lineSizes)
+		for _, i := range reconstructed {
+			log.WithField("line", i+1).Info("Reconstructed line using error correction")
+		}
+		if err != nil {
+			log.WithError(err).Warn(Warning("Some lines can not be reconstructed."))
+		}
+	}
+
+	var lost []ByteRange
+	offset := 0
+	for i, line := range block.lines {
+		if line == nil {
+			lost = appendByteRange(lost, ByteRange{Start: offset, End: offset + block.lineSizes[i]})
+		}
+		offset += block.lineSizes[i]
+	}
+
+	resultData := block.data()
+	if len(lost) == 0 {
+		if err := block.verifyBlockChecksum(checksum, resultData); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return resultData, lost, nil
+}
+
+// IsColumnIndexLine returns whether the line holds column numbers, see ColumnIndices.
+func IsColumnIndexLine(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(line), []byte(ColumnIndexLabel+":"))
+}
+
+func ParseHexUint32(hex string) (uint32, error) {
+	h := strings.ToLower(hex)
+	h = strings.ReplaceAll(h, "0x", "")
+	h = strings.ReplaceAll(h, " ", "")
+
+	var n uint32
+	_, err := fmt.Sscanf(h, "%x", &n)
+	if err != nil {
+		return 0, errors.Join(errors.New("error parsing hexadecimal value"), err)
+	}
+	return n, nil
+}
+
+func BytesFromBase64(data string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(data)
+}
+
+// FormatSHA256 formats a checksum as upper case hexadecimal digits, in groups of eight.
+func FormatSHA256(sum []byte) string {
+	hex := fmt.Sprintf("%X", sum)
+
+	groups := make([]string, 0, len(hex)/8+1)
+	for i := 0; i < len(hex); i += 8 {
+		groups = append(groups, hex[i:min(i+8, len(hex))])
+	}
+
+	return strings.Join(groups, " ")
+}
+
+// ParseSHA256 parses a checksum written as hexadecimal digits (as by FormatSHA256, or sha256sum),
+// or as base64 (as in the header of a document).
+func ParseSHA256(text string) ([]byte, error) {
+	digits := strings.Join(strings.Fields(text), "")
+	sum, err := hex.DecodeString(digits)
+	if err != nil {
+		sum, err = base64.StdEncoding.DecodeString(digits)
+	}
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("'%s' is not a SHA-256 checksum, expected 64 hexadecimal digits", text)
+	}
+
+	return sum, nil
+}
@@ -18,11 +18,13 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  */
 
-package internal
+package core
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"strings"
 	"testing"
 )
 
@@ -230,3 +232,84 @@ func TestDeserializeBinary(t *testing.T) {
 		}
 	})
 }
+
+func TestSerializeBinaryEncoded(t *testing.T) {
+	data := []byte("PaperCrypt lets you prepare encrypted messages for printing on paper.")
+
+	t.Run("base16 matches SerializeBinary", func(t *testing.T) {
+		encoded := SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase16, DefaultDataLayout, LineChecksumCRC24)
+		if encoded != SerializeBinary(&data, BytesPerLine) {
+			t.Errorf("SerializeBinaryEncoded output differs from SerializeBinary")
+		}
+	})
+
+	t.Run("base32 round trip", func(t *testing.T) {
+		encoded := []byte(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC24))
+		decoded, err := DeserializeBinaryEncoded(&encoded, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC24)
+		if err != nil {
+			t.Fatalf("DeserializeBinaryEncoded failed with error %s", err)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+
+	t.Run("base32 accepts lower case", func(t *testing.T) {
+		encoded := []byte(strings.ToLower(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC24)))
+		decoded, err := DeserializeBinaryEncoded(&encoded, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC24)
+		if err != nil {
+			t.Fatalf("DeserializeBinaryEncoded failed with error %s", err)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+
+	t.Run("base32 normalizes confusable letters", func(t *testing.T) {
+		normalized := NormalizeCrockfordBase32("oIl-ab")
+		if normalized != "011AB" {
+			t.Errorf("Normalization was incorrect, got: %s, want: %s.", normalized, "011AB")
+		}
+	})
+
+	t.Run("base32 rejects invalid digits", func(t *testing.T) {
+		encoded := []byte(strings.Replace(SerializeBinaryEncoded(&data, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC24), ": ", ": U", 1))
+		_, err := DeserializeBinaryEncoded(&encoded, PaperCryptDataEncodingBase32, DefaultDataLayout, LineChecksumCRC24)
+		if err == nil {
+			t.Errorf("DeserializeBinaryEncoded should fail with invalid base32")
+		}
+	})
+}
+
+func TestFormatSHA256(t *testing.T) {
+	sum := sha256.Sum256([]byte("123456789"))
+	want := "15E2B0D3 C33891EB B0F1EF60 9EC41942 0C20E320 CE94C65F BC8C3312 448EB225"
+	if got := FormatSHA256(sum[:]); got != want {
+		t.Errorf("got: %s, want: %s.", got, want)
+	}
+}
+
+func TestParseSHA256(t *testing.T) {
+	sum := sha256.Sum256([]byte("123456789"))
+	for _, text := range []string{
+		FormatSHA256(sum[:]),
+		"15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225",
+		"FeKw08M4keuw8e9gnsQZQgwg4yDOlMZfvIwzEkSOsiU=",
+	} {
+		got, err := ParseSHA256(text)
+		if err != nil {
+			t.Fatalf("ParseSHA256 failed with error %s", err)
+		}
+		if !bytes.Equal(got, sum[:]) {
+			t.Errorf("Parsing '%s' was incorrect, got: %x, want: %x.", text, got, sum)
+		}
+	}
+
+	for _, invalid := range []string{"", "15E2B0D3", "not a checksum"} {
+		if _, err := ParseSHA256(invalid); err == nil {
+			t.Errorf("ParseSHA256 should fail for '%s'", invalid)
+		}
+	}
+}
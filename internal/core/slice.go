@@ -18,7 +18,7 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  */
 
-package internal
+package core
 
 func SliceHasString(slice []string, str string) bool {
 	for _, s := range slice {
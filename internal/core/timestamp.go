@@ -0,0 +1,106 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TimeStampFormatLong      = "Mon, 02 Jan 2006 15:04:05.000000000 -0700"
+	TimeStampFormatLongTZ    = "Mon, 02 Jan 2006 15:04:05.000000000 MST"
+	TimeStampFormatShort     = "2006-01-02 15:04:05"
+	TimeStampFormatDate      = "2006-01-02"
+	TimeStampFormatPDFHeader = "2006-01-02 15:04 -0700"
+)
+
+// timeStampInputFormats are the formats read by ParseTimeStamp, in order: RFC 3339 and ISO 8601,
+// with or without a time zone, and seconds, and the formats read by earlier versions.
+// A fraction of a second is optional in those ending in .999999999.
+var timeStampInputFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	TimeStampFormatLong,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	TimeStampFormatDate,
+}
+
+// ParseTimeStamp parses the date of a document, given as RFC 3339 (such as 2024-08-01T20:38:10+02:00),
+// ISO 8601 (such as 2024-08-01T20:38, or 2024-08-01), or as written in the header (see TimeStampFormatLong).
+// Dates without a time zone are read in location.
+func ParseTimeStamp(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, format := range timeStampInputFormats {
+		if timestamp, err := time.ParseInLocation(format, value, location); err == nil {
+			return timestamp, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date '%s', must be RFC 3339 (such as 2024-08-01T20:38:10+02:00), or ISO 8601 (such as 2024-08-01 20:38, or 2024-08-01)", value)
+}
+
+// ParseTimeZone parses the name of a time zone: a location of the IANA time zone database (such as Europe/Berlin),
+// UTC, Local (or empty) for the local time zone, or an offset from UTC (such as +02:00, or -0530).
+func ParseTimeZone(name string) (*time.Location, error) {
+	switch name = strings.TrimSpace(name); {
+	case name == "" || strings.EqualFold(name, "Local"):
+		return time.Local, nil
+	case strings.EqualFold(name, "UTC") || name == "Z":
+		return time.UTC, nil
+	case strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-"):
+		hours, minutes, found := strings.Cut(name[1:], ":")
+		if !found && len(hours) == 4 {
+			hours, minutes = hours[:2], hours[2:]
+		}
+		h, err := strconv.Atoi(hours)
+		m, _ := strconv.Atoi(minutes)
+		notDigit := func(r rune) bool { return r < '0' || r > '9' }
+		if err != nil || strings.ContainsFunc(hours+minutes, notDigit) || len(hours) > 2 || len(minutes) > 2 || h > 14 || m > 59 {
+			return nil, fmt.Errorf("invalid time zone offset '%s', must be like +02:00, or -0530", name)
+		}
+
+		offset := (h*60 + m) * 60
+		if name[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone '%s', must be a location (such as Europe/Berlin), UTC, Local, or an offset (such as +02:00)", name)
+	}
+
+	return location, nil
+}
+
+// FormatTimeStamp formats the date of a document as written in its header, and its 2D code: down to the nanosecond,
+// with the offset from UTC as a number, rather than the name of the time zone, which can be ambiguous.
+func FormatTimeStamp(timestamp time.Time) string {
+	return timestamp.Format(TimeStampFormatLong)
+}
@@ -0,0 +1,96 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeStamp(t *testing.T) {
+	location := time.FixedZone("", 2*60*60)
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"2024-08-01T20:38:10Z", "Thu, 01 Aug 2024 20:38:10.000000000 +0000"},
+		{"2024-08-01T20:38:10.3065961-05:00", "Thu, 01 Aug 2024 20:38:10.306596100 -0500"},
+		{"2024-08-01 20:38:10+02:00", "Thu, 01 Aug 2024 20:38:10.000000000 +0200"},
+		{"2024-08-01T20:38Z", "Thu, 01 Aug 2024 20:38:00.000000000 +0000"},
+		{"2024-08-01T20:38:10", "Thu, 01 Aug 2024 20:38:10.000000000 +0200"},
+		{"2024-08-01T20:38", "Thu, 01 Aug 2024 20:38:00.000000000 +0200"},
+		{"Thu, 01 Aug 2024 20:38:10.306596100 -0500", "Thu, 01 Aug 2024 20:38:10.306596100 -0500"},
+		{"2024-08-01 20:38:10", "Thu, 01 Aug 2024 20:38:10.000000000 +0200"},
+		{" 2024-08-01 20:38 ", "Thu, 01 Aug 2024 20:38:00.000000000 +0200"},
+		{"2024-08-01", "Thu, 01 Aug 2024 00:00:00.000000000 +0200"},
+	}
+	for _, test := range tests {
+		got, err := ParseTimeStamp(test.value, location)
+		if err != nil {
+			t.Fatalf("ParseTimeStamp failed with error %s", err)
+		}
+		if FormatTimeStamp(got) != test.want {
+			t.Errorf("got: %v, want: %v.", FormatTimeStamp(got), test.want)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "2024-13-01", "01/08/2024", "2024-08-01T25:00"} {
+		if _, err := ParseTimeStamp(value, location); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestParseTimeZone(t *testing.T) {
+	date := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"UTC", "+0000"},
+		{"Z", "+0000"},
+		{"+02:00", "+0200"},
+		{"-0530", "-0530"},
+		{"+14", "+1400"},
+		{"Europe/Berlin", "+0200"},
+	}
+	for _, test := range tests {
+		location, err := ParseTimeZone(test.name)
+		if err != nil {
+			t.Fatalf("ParseTimeZone failed with error %s", err)
+		}
+		if got := date.In(location).Format("-0700"); got != test.want {
+			t.Errorf("got: %v, want: %v.", got, test.want)
+		}
+	}
+
+	if location, err := ParseTimeZone(""); err != nil || location != time.Local {
+		t.Errorf("got: %v, want: %v.", location, time.Local)
+	}
+
+	for _, name := range []string{"+25:00", "+02:60", "+-2", "+2:+3", "+020", "Mars/Olympus_Mons"} {
+		if _, err := ParseTimeZone(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"github.com/caarlos0/log"
+)
+
+// TraceParsing enables debug messages on every decision made while parsing a document,
+// such as how each line was read, and which checksums were compared. It is set by -vv.
+var TraceParsing bool
+
+// trace logs a debug message on a decision made while parsing a document, if TraceParsing is enabled.
+// fields are given as pairs of a key and its value.
+func trace(msg string, fields ...any) {
+	if !TraceParsing {
+		return
+	}
+
+	entry := log.WithField("trace", "parse")
+	for i := 0; i+1 < len(fields); i += 2 {
+		entry = entry.WithField(fields[i].(string), fields[i+1])
+	}
+	entry.Debug(msg)
+}
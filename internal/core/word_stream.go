@@ -0,0 +1,170 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// WordStreamGroupSize is the number of data words in a group of a word stream,
+	// each group is followed by a checksum word.
+	WordStreamGroupSize = 5
+	// wordStreamBlockChecksumWords is the number of words holding the CRC-24 of the entire stream.
+	wordStreamBlockChecksumWords = 3
+)
+
+// EncodeWordStream encodes data as a stream of PGP words, suitable for reading aloud.
+//
+// The stream starts with a byte holding the data format, followed by the data itself.
+// Each byte is encoded as a single word, alternating between the even and odd word list,
+// so skipped or repeated words are noticed.
+// After every WordStreamGroupSize words, a checksum word is inserted,
+// holding the low byte of the CRC-24 of the group number and the group's data.
+// The stream ends with three words, holding the CRC-24 of the entire stream.
+//
+// Each group is written on its own line, prefixed by its number, for example:
+//
+//	1: <5 data words> <checksum word>
+//	2: ...
+//	n: <3 block checksum words>
+//
+// The line numbers are optional when decoding, so the stream may be dictated without them.
+func EncodeWordStream(format PaperCryptDataFormat, data []byte) string {
+	payload := append([]byte{byte(format)}, data...)
+
+	values := make([]byte, 0, len(payload)+len(payload)/WordStreamGroupSize+1+wordStreamBlockChecksumWords)
+	var lines []int
+	for i := 0; i < len(payload); i += WordStreamGroupSize {
+		group := payload[i:min(i+WordStreamGroupSize, len(payload))]
+		values = append(values, group...)
+		values = append(values, wordStreamGroupChecksum(i/WordStreamGroupSize+1, group))
+		lines = append(lines, len(group)+1)
+	}
+
+	blockCRC := Crc24Checksum(payload)
+	values = append(values, byte(blockCRC>>16), byte(blockCRC>>8), byte(blockCRC))
+	lines = append(lines, wordStreamBlockChecksumWords)
+
+	words := PGPWords(values)
+
+	var stream strings.Builder
+	offset := 0
+	for n, length := range lines {
+		stream.WriteString(fmt.Sprintf("%d: %s\n", n+1, strings.Join(words[offset:offset+length], " ")))
+		offset += length
+	}
+
+	return stream.String()
+}
+
+// DecodeWordStream decodes a stream of PGP words written by EncodeWordStream.
+// Words are matched case-insensitively, line numbers (words ending in a colon) are ignored.
+func DecodeWordStream(stream []byte) (PaperCryptDataFormat, []byte, error) {
+	lookup := make(map[string]int, 2*len(PGPWordsEven))
+	for i := range PGPWordsEven {
+		lookup[strings.ToLower(PGPWordsEven[i])] = i
+		lookup[strings.ToLower(PGPWordsOdd[i])] = i | 0x100
+	}
+
+	values := make([]byte, 0)
+	for _, word := range strings.Fields(string(stream)) {
+		if strings.HasSuffix(word, ":") {
+			continue
+		}
+
+		entry, ok := lookup[strings.ToLower(word)]
+		if !ok {
+			return 0, nil, fmt.Errorf("word %d ('%s') is not part of the PGP word list", len(values)+1, word)
+		}
+
+		if odd := entry&0x100 != 0; odd != (len(values)%2 == 1) {
+			return 0, nil, fmt.Errorf("word %d ('%s') is out of place, a word may have been skipped or repeated before it", len(values)+1, word)
+		}
+
+		values = append(values, byte(entry))
+	}
+
+	if len(values) < wordStreamBlockChecksumWords+2 {
+		return 0, nil, errors.New("word stream is too short")
+	}
+
+	blockChecksum := values[len(values)-wordStreamBlockChecksumWords:]
+	rest := values[:len(values)-wordStreamBlockChecksumWords]
+
+	payload := make([]byte, 0, len(rest))
+	for n := 1; len(rest) > 0; n++ {
+		length := min(len(rest), WordStreamGroupSize+1)
+		if length < 2 {
+			return 0, nil, fmt.Errorf("group %d is incomplete", n)
+		}
+
+		group := rest[:length-1]
+		if checksum := rest[length-1]; checksum != wordStreamGroupChecksum(n, group) {
+			return 0, nil, WithCategory(ErrorCategoryChecksum, fmt.Errorf("invalid checksum word in group %d", n))
+		}
+
+		payload = append(payload, group...)
+		rest = rest[length:]
+	}
+
+	blockCRC := uint32(blockChecksum[0])<<16 | uint32(blockChecksum[1])<<8 | uint32(blockChecksum[2])
+	if !ValidateCRC24(payload, blockCRC) {
+		return 0, nil, WithCategory(ErrorCategoryChecksum, errors.New("invalid block checksum, a group may be missing"))
+	}
+
+	format := PaperCryptDataFormat(payload[0])
+	if format.String() == "Unknown" {
+		return 0, nil, fmt.Errorf("unknown data format %d", payload[0])
+	}
+
+	return format, payload[1:], nil
+}
+
+// IsWordStream returns whether the line consists only of PGP words, and an optional line number.
+func IsWordStream(line string) bool {
+	words := 0
+	for _, word := range strings.Fields(line) {
+		if strings.HasSuffix(word, ":") {
+			continue
+		}
+
+		found := false
+		for i := range PGPWordsEven {
+			if strings.EqualFold(word, PGPWordsEven[i]) || strings.EqualFold(word, PGPWordsOdd[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		words++
+	}
+
+	return words > 0
+}
+
+func wordStreamGroupChecksum(group int, data []byte) byte {
+	return byte(Crc24Checksum(append([]byte{byte(group >> 24), byte(group >> 16), byte(group >> 8), byte(group)}, data...)))
+}
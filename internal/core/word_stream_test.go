@@ -0,0 +1,102 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWordStream(t *testing.T) {
+	data := []byte("PaperCrypt lets you prepare encrypted messages for printing on paper.")
+	stream := EncodeWordStream(PaperCryptDataFormatRaw, data)
+
+	t.Run("round trip", func(t *testing.T) {
+		format, decoded, err := DecodeWordStream([]byte(stream))
+		if err != nil {
+			t.Fatalf("DecodeWordStream failed with error %s", err)
+		}
+
+		if format != PaperCryptDataFormatRaw {
+			t.Errorf("Format was incorrect, got: %s, want: %s.", format, PaperCryptDataFormatRaw)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+
+	t.Run("without line numbers, in lower case", func(t *testing.T) {
+		var words []string
+		for _, word := range strings.Fields(stream) {
+			if !strings.HasSuffix(word, ":") {
+				words = append(words, strings.ToLower(word))
+			}
+		}
+
+		_, decoded, err := DecodeWordStream([]byte(strings.Join(words, " ")))
+		if err != nil {
+			t.Fatalf("DecodeWordStream failed with error %s", err)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Decoding was incorrect, got: %s, want: %s.", decoded, data)
+		}
+	})
+
+	t.Run("skipped word", func(t *testing.T) {
+		words := strings.Fields(stream)
+		skipped := append(append([]string{}, words[:3]...), words[4:]...)
+
+		_, _, err := DecodeWordStream([]byte(strings.Join(skipped, " ")))
+		if err == nil {
+			t.Errorf("DecodeWordStream should fail with a skipped word")
+		}
+	})
+
+	t.Run("swapped words", func(t *testing.T) {
+		words := strings.Fields(stream)
+		// swap the first data words of the first two lines, both at even positions
+		words[1], words[8] = words[8], words[1]
+
+		_, _, err := DecodeWordStream([]byte(strings.Join(words, " ")))
+		if err == nil {
+			t.Errorf("DecodeWordStream should fail with swapped words")
+		}
+	})
+
+	t.Run("missing line", func(t *testing.T) {
+		lines := strings.Split(stream, "\n")
+		missing := append(append([]string{}, lines[:2]...), lines[3:]...)
+
+		_, _, err := DecodeWordStream([]byte(strings.Join(missing, "\n")))
+		if err == nil {
+			t.Errorf("DecodeWordStream should fail with a missing line")
+		}
+	})
+
+	t.Run("detected", func(t *testing.T) {
+		if detected := DetectDataEncoding([]byte(stream)); detected != PaperCryptDataEncodingWords {
+			t.Errorf("Detection was incorrect, got: %s, want: %s.", detected, PaperCryptDataEncodingWords)
+		}
+	})
+}
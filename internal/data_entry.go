@@ -0,0 +1,578 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// LineStatus is the state of a line being typed in, see DataEntry.
+type LineStatus uint8
+
+const (
+	// LineStatusEmpty is a line that has not been typed in yet.
+	LineStatusEmpty LineStatus = iota
+	// LineStatusIncomplete is a line that is shorter than expected, but holds no wrong characters so far.
+	LineStatusIncomplete
+	// LineStatusUnverified is a line that can not be checked (yet), such as a header field before the header CRC-32 is entered.
+	LineStatusUnverified
+	// LineStatusValid is a line whose checksum matches.
+	LineStatusValid
+	// LineStatusInvalid is a line holding a wrong character, of the wrong length, or whose checksum does not match.
+	LineStatusInvalid
+)
+
+// String returns the name of the status.
+func (s LineStatus) String() string {
+	switch s {
+	case LineStatusEmpty:
+		return "empty"
+	case LineStatusIncomplete:
+		return "incomplete"
+	case LineStatusUnverified:
+		return "unverified"
+	case LineStatusValid:
+		return "valid"
+	case LineStatusInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// LineCheck is the result of checking a line being typed in.
+type LineCheck struct {
+	Status LineStatus
+
+	// Column is the index (in characters, including spaces) of the character that is wrong, or -1 if unknown.
+	Column int
+
+	// Suggestion is the character that makes the checksum match, if it was found by replacing the character at Column.
+	Suggestion rune
+
+	// Message describes the problem, if any.
+	Message string
+}
+
+// DataEntryLine is a line of a document being typed in: a header field, or a line of the data block.
+type DataEntryLine struct {
+	// Label is the name of the header field, or the line number.
+	Label string
+
+	// Value is the text typed in, after the label.
+	Value string
+
+	// Template shows the expected structure of the line, with a dot for every character to type.
+	Template string
+
+	// Header is true for header fields.
+	Header bool
+
+	// Optional is true for header fields that are only printed, if they differ from their default.
+	Optional bool
+}
+
+// optionalHeaderFields are left out of the header, if their value is empty,
+// as GetText only writes them if they differ from the default.
+// Version 1 documents have no data format, documents before format version 3 no header MAC.
+var optionalHeaderFields = map[string]bool{
+	core.HeaderFieldFormatVersion:   true,
+	core.HeaderFieldExpires:         true,
+	core.HeaderFieldReviewBy:        true,
+	core.HeaderFieldSupersedes:      true,
+	core.HeaderFieldDataFormat:      true,
+	core.HeaderFieldMetadata:        true,
+	core.HeaderFieldDataEncoding:    true,
+	core.HeaderFieldDataLayout:      true,
+	core.HeaderFieldLineChecksum:    true,
+	core.HeaderFieldErrorCorrection: true,
+	core.HeaderFieldPlaintextSHA256: true,
+	core.HeaderFieldMACAlgorithm:    true,
+	core.HeaderFieldMACSalt:         true,
+	core.HeaderFieldHeaderMAC:       true,
+}
+
+// dataEntryStructure describes the data block of a document, as stated by its header.
+type dataEntryStructure struct {
+	encoding      core.PaperCryptDataEncoding
+	layout        core.DataLayout
+	checksum      core.LineChecksum
+	contentLength int
+	dataLines     int
+	parityLines   int
+}
+
+// lineSize returns the number of bytes of a data line (counted from 0), or of any parity line, if parity is true.
+func (s dataEntryStructure) lineSize(i int, parity bool) int {
+	if parity {
+		return s.layout.BytesPerLine()
+	}
+
+	return min(s.layout.BytesPerLine(), s.contentLength-i*s.layout.BytesPerLine())
+}
+
+// template returns the expected structure of a line holding size bytes, with a dot for every character.
+func (s dataEntryStructure) template(size int) string {
+	line := s.encoding.EncodeLine(make([]byte, size), s.layout.GroupSize) + " " + s.checksum.Format(0)
+	return strings.Map(func(r rune) rune {
+		if r == ' ' {
+			return r
+		}
+
+		return '·'
+	}, line)
+}
+
+// DataEntry is a document typed in line by line, as with `decode --interactive`.
+// Every line is checked as it is typed, using its checksum (or the header CRC-32, for header fields),
+// so typing errors are found right away, rather than when decoding the entire document.
+type DataEntry struct {
+	// Lines holds the header fields, followed by the lines of the data block, once the header describes them.
+	Lines []DataEntryLine
+
+	structure      *dataEntryStructure
+	structureField string
+	structureErr   error
+}
+
+// NewDataEntry returns a DataEntry with the header fields to type in.
+func NewDataEntry() *DataEntry {
+	e := &DataEntry{}
+	for _, name := range core.HeaderFieldNames {
+		e.Lines = append(e.Lines, DataEntryLine{Label: name, Header: true, Optional: optionalHeaderFields[name]})
+	}
+	e.update()
+
+	return e
+}
+
+// SetValue sets the value of a line, updating the lines of the data block, if a header field
+// (or the first line, which shows the number of bytes per line of older documents) changed.
+func (e *DataEntry) SetValue(i int, value string) {
+	e.Lines[i].Value = value
+	if e.Lines[i].Header || e.Lines[i].Label == "1" {
+		e.update()
+	}
+}
+
+// StructureError returns why the lines of the data block are not known yet, if they are not.
+func (e *DataEntry) StructureError() error {
+	return e.structureErr
+}
+
+// headerValue returns the value of a header field.
+func (e *DataEntry) headerValue(name string) string {
+	for _, line := range e.Lines {
+		if line.Header && line.Label == name {
+			return strings.TrimSpace(line.Value)
+		}
+	}
+
+	return ""
+}
+
+// parseStructure reads the structure of the data block from the header fields typed in so far,
+// and the first line of the data block. If that fails, it returns the name of the field at fault.
+func (e *DataEntry) parseStructure(firstLine string) (*dataEntryStructure, string, error) {
+	s := &dataEntryStructure{
+		encoding: core.PaperCryptDataEncodingBase16,
+		layout:   core.DefaultDataLayout,
+		checksum: core.LineChecksumCRC24,
+	}
+
+	if value := e.headerValue(core.HeaderFieldDataEncoding); value != "" {
+		s.encoding = core.PaperCryptDataEncodingFromString(value)
+	}
+	if s.encoding.Alphabet() == "" {
+		return nil, core.HeaderFieldDataEncoding, fmt.Errorf("only base16, base32, and base64 data blocks can be typed in, not '%s'", e.headerValue(core.HeaderFieldDataEncoding))
+	}
+
+	if value := e.headerValue(core.HeaderFieldDataLayout); value != "" {
+		layout, err := core.ParseDataLayout(value)
+		if err != nil {
+			return nil, core.HeaderFieldDataLayout, errors.Join(fmt.Errorf("invalid `%s`", core.HeaderFieldDataLayout), err)
+		}
+		s.layout = layout
+	}
+
+	if value := e.headerValue(core.HeaderFieldLineChecksum); value != "" {
+		s.checksum = core.LineChecksumFromString(value)
+		if s.checksum == core.LineChecksumUnknown {
+			return nil, core.HeaderFieldLineChecksum, fmt.Errorf("unsupported line checksum '%s'", value)
+		}
+	}
+
+	if core.PaperCryptContainerVersionFromString(e.headerValue(core.HeaderFieldVersion)) == core.PaperCryptContainerVersionMajor1 {
+		s.layout.Columns = core.BytesPerLineV1
+	}
+
+	value := e.headerValue(core.HeaderFieldContentLength)
+	if value == "" {
+		return nil, core.HeaderFieldContentLength, fmt.Errorf("enter the `%s` to type in the data block", core.HeaderFieldContentLength)
+	}
+	contentLength, err := core.ParseContentLength(value)
+	if err != nil || contentLength == 0 {
+		return nil, core.HeaderFieldContentLength, fmt.Errorf("invalid `%s`: %s", core.HeaderFieldContentLength, value)
+	}
+	s.contentLength = contentLength
+
+	// documents written before the layout could be chosen may hold fewer bytes per line than the default,
+	// which is only known once the first line is typed in
+	if e.headerValue(core.HeaderFieldDataLayout) == "" {
+		data, sum, err := core.DecodeLineContent([]byte(firstLine), "1", s.encoding, s.layout)
+		if err == nil && s.checksum.Validate(data, sum) && len(data) < s.layout.BytesPerLine() && len(data) < contentLength {
+			s.layout.Columns = len(data)
+		}
+	}
+	s.dataLines = (contentLength + s.layout.BytesPerLine() - 1) / s.layout.BytesPerLine()
+
+	if value := e.headerValue(core.HeaderFieldErrorCorrection); value != "" {
+		ecc, err := core.ParseErrorCorrection(value)
+		if err != nil {
+			return nil, core.HeaderFieldErrorCorrection, err
+		}
+		if !s.layout.LineIndices {
+			return nil, core.HeaderFieldErrorCorrection, errors.New("error correction requires line numbers")
+		}
+		s.parityLines = ecc.Stripes * ecc.ParityLines
+	}
+
+	return s, "", nil
+}
+
+// update rebuilds the lines of the data block from the header, keeping the values typed in so far.
+func (e *DataEntry) update() {
+	values := make(map[string]string)
+	var header []DataEntryLine
+	for _, line := range e.Lines {
+		if line.Header {
+			header = append(header, line)
+		} else {
+			values[line.Label] = line.Value
+		}
+	}
+	e.Lines = header
+
+	e.structure, e.structureField, e.structureErr = e.parseStructure(values["1"])
+	s := e.structure
+	if s == nil {
+		return
+	}
+
+	for n := 1; n <= s.dataLines; n++ {
+		label := strconv.Itoa(n)
+		e.Lines = append(e.Lines, DataEntryLine{Label: label, Value: values[label], Template: s.template(s.lineSize(n-1, false))})
+	}
+
+	label := strconv.Itoa(s.dataLines + 1)
+	e.Lines = append(e.Lines, DataEntryLine{Label: label, Value: values[label], Template: strings.Repeat("·", len(s.checksum.Format(0)))})
+
+	for n := 1; n <= s.parityLines; n++ {
+		label := core.ParityLinePrefix + strconv.Itoa(n)
+		e.Lines = append(e.Lines, DataEntryLine{Label: label, Value: values[label], Template: s.template(s.lineSize(0, true))})
+	}
+}
+
+// headerText returns the header as written by GetText, without the header CRC-32.
+func (e *DataEntry) headerText() string {
+	var lines []string
+	for _, line := range e.Lines {
+		if !line.Header || line.Label == core.HeaderFieldHeaderCRC32 {
+			continue
+		}
+
+		value := strings.TrimSpace(line.Value)
+		if value == "" && optionalHeaderFields[line.Label] {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", line.Label, value))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// headerValid returns whether the header CRC-32 matches the header fields.
+func (e *DataEntry) headerValid() bool {
+	sum, err := core.ParseHexUint32(e.headerValue(core.HeaderFieldHeaderCRC32))
+	return err == nil && crc32.ChecksumIEEE([]byte(e.headerText())) == sum
+}
+
+// Check checks the line with the given index.
+func (e *DataEntry) Check(i int) LineCheck {
+	line := e.Lines[i]
+	if strings.TrimSpace(line.Value) == "" {
+		return LineCheck{Status: LineStatusEmpty, Column: -1}
+	}
+
+	if line.Header {
+		return e.checkHeaderField(line)
+	}
+
+	s := e.structure
+	if blockLine := strconv.Itoa(s.dataLines + 1); line.Label == blockLine {
+		return e.checkBlockChecksum(line.Value)
+	}
+
+	parity := strings.HasPrefix(line.Label, core.ParityLinePrefix)
+	number, _ := strconv.Atoi(strings.TrimPrefix(line.Label, core.ParityLinePrefix))
+	return s.checkLine(line.Value, s.lineSize(number-1, parity))
+}
+
+// checkHeaderField checks the value of a header field, which can only be verified using the header CRC-32,
+// except for the fields describing the data block, which are checked when they are parsed.
+func (e *DataEntry) checkHeaderField(line DataEntryLine) LineCheck {
+	if e.headerValid() {
+		return LineCheck{Status: LineStatusValid, Column: -1}
+	}
+
+	if line.Label == core.HeaderFieldHeaderCRC32 {
+		value := strings.TrimSpace(line.Value)
+		if len(value) < 8 {
+			return LineCheck{Status: LineStatusIncomplete, Column: -1}
+		}
+
+		return LineCheck{Status: LineStatusInvalid, Column: -1, Message: "the header CRC-32 does not match the header fields"}
+	}
+
+	if e.structureErr != nil && line.Label == e.structureField {
+		return LineCheck{Status: LineStatusInvalid, Column: -1, Message: e.structureErr.Error()}
+	}
+
+	return LineCheck{Status: LineStatusUnverified, Column: -1}
+}
+
+// digitPositions returns the indices of the characters of value that are not spaces.
+func digitPositions(value []rune) []int {
+	var positions []int
+	for i, r := range value {
+		if r != ' ' {
+			positions = append(positions, i)
+		}
+	}
+
+	return positions
+}
+
+// lineDigits returns the number of digits of the data, and of the checksum, of a line holding size bytes.
+func (s dataEntryStructure) lineDigits(size int) (int, int) {
+	return len(strings.ReplaceAll(s.encoding.EncodeLine(make([]byte, size), s.layout.GroupSize), " ", "")), len(s.checksum.Format(0))
+}
+
+// lineValidator returns a function telling whether a data or parity line holding size bytes matches its checksum.
+func (s dataEntryStructure) lineValidator(size int) func([]rune) bool {
+	dataDigits, _ := s.lineDigits(size)
+	return func(candidate []rune) bool {
+		digits := []rune(strings.ReplaceAll(string(candidate), " ", ""))
+		if len(digits) < dataDigits {
+			return false
+		}
+		data, err := s.encoding.DecodeLine([][]byte{[]byte(string(digits[:dataDigits]))})
+		if err != nil || len(data) != size {
+			return false
+		}
+		sum, err := core.ParseHexUint32(string(digits[dataDigits:]))
+		return err == nil && s.checksum.Validate(data, sum)
+	}
+}
+
+// checkLine checks a data or parity line holding size bytes.
+func (s dataEntryStructure) checkLine(value string, size int) LineCheck {
+	runes := []rune(value)
+	positions := digitPositions(runes)
+	dataDigits, checksumDigits := s.lineDigits(size)
+	alphabet := s.encoding.Alphabet()
+
+	for n, p := range positions {
+		if n >= dataDigits+checksumDigits {
+			return LineCheck{Status: LineStatusInvalid, Column: p, Message: "the line is too long"}
+		}
+
+		digits, name := alphabet, s.encoding.String()
+		if n >= dataDigits {
+			digits, name = core.HexAlphabet, "checksum"
+		}
+		if !strings.ContainsRune(digits, runes[p]) {
+			return LineCheck{Status: LineStatusInvalid, Column: p, Message: fmt.Sprintf("'%c' is not a %s digit", runes[p], name)}
+		}
+	}
+	if len(positions) < dataDigits+checksumDigits {
+		return LineCheck{Status: LineStatusIncomplete, Column: -1}
+	}
+
+	valid := s.lineValidator(size)
+	if valid(runes) {
+		return LineCheck{Status: LineStatusValid, Column: -1}
+	}
+
+	check := LineCheck{Status: LineStatusInvalid, Column: -1, Message: "the line checksum does not match"}
+	for n, p := range positions {
+		candidates := alphabet
+		if n >= dataDigits {
+			candidates = core.HexAlphabet
+		}
+		if column, suggestion, ok := findSubstitution(runes, p, candidates, s.encoding.IsCaseSensitive(), valid); ok {
+			check.Column, check.Suggestion = column, suggestion
+			check.Message = fmt.Sprintf("the line checksum does not match, is '%c' a '%c'?", runes[p], suggestion)
+			break
+		}
+	}
+
+	return check
+}
+
+// findSubstitution returns the character making the line valid, if the character at position p is replaced by it.
+func findSubstitution(runes []rune, p int, candidates string, caseSensitive bool, valid func([]rune) bool) (int, rune, bool) {
+	original := runes[p]
+	defer func() { runes[p] = original }()
+
+	for _, candidate := range candidates {
+		if candidate == original || !caseSensitive && strings.EqualFold(string(candidate), string(original)) {
+			continue
+		}
+
+		runes[p] = candidate
+		if valid(runes) {
+			return p, candidate, true
+		}
+	}
+
+	return -1, 0, false
+}
+
+// checkBlockChecksum checks the line holding the checksum of the data block,
+// which can only be verified once all data lines are valid.
+func (e *DataEntry) checkBlockChecksum(value string) LineCheck {
+	s := e.structure
+	runes := []rune(value)
+	positions := digitPositions(runes)
+	checksumDigits := len(s.checksum.Format(0))
+
+	for n, p := range positions {
+		if n >= checksumDigits {
+			return LineCheck{Status: LineStatusInvalid, Column: p, Message: "the line is too long"}
+		}
+		if !strings.ContainsRune(core.HexAlphabet, runes[p]) {
+			return LineCheck{Status: LineStatusInvalid, Column: p, Message: fmt.Sprintf("'%c' is not a checksum digit", runes[p])}
+		}
+	}
+	if len(positions) < checksumDigits {
+		return LineCheck{Status: LineStatusIncomplete, Column: -1}
+	}
+
+	valid, ok := e.blockChecksumValidator()
+	if !ok {
+		return LineCheck{Status: LineStatusUnverified, Column: -1, Message: "the block checksum is verified once all data lines are valid"}
+	}
+	if valid(runes) {
+		return LineCheck{Status: LineStatusValid, Column: -1}
+	}
+
+	check := LineCheck{Status: LineStatusInvalid, Column: -1, Message: fmt.Sprintf("the block %s does not match the data", s.checksum)}
+	for _, p := range positions {
+		if column, suggestion, ok := findSubstitution(runes, p, core.HexAlphabet, false, valid); ok {
+			check.Column, check.Suggestion = column, suggestion
+			check.Message = fmt.Sprintf("the block %s does not match the data, is '%c' a '%c'?", s.checksum, runes[p], suggestion)
+			break
+		}
+	}
+
+	return check
+}
+
+// blockChecksumValidator returns a function telling whether a block checksum matches the data lines,
+// if all of them are valid.
+func (e *DataEntry) blockChecksumValidator() (func([]rune) bool, bool) {
+	data, ok := e.data()
+	if !ok {
+		return nil, false
+	}
+
+	return func(candidate []rune) bool {
+		sum, err := core.ParseHexUint32(strings.ReplaceAll(string(candidate), " ", ""))
+		return err == nil && e.structure.checksum.Validate(data, sum)
+	}, true
+}
+
+// data returns the data of the data lines, if all of them are valid.
+func (e *DataEntry) data() ([]byte, bool) {
+	s := e.structure
+	var data []byte
+	for i, line := range e.Lines {
+		number, err := strconv.Atoi(line.Label)
+		if line.Header || err != nil || number > s.dataLines {
+			continue
+		}
+
+		if e.Check(i).Status != LineStatusValid {
+			return nil, false
+		}
+		decoded, _, err := core.DecodeLineContent([]byte(line.Value), line.Label, s.encoding, s.layout)
+		if err != nil {
+			return nil, false
+		}
+		data = append(data, decoded...)
+	}
+
+	return data, true
+}
+
+// Complete returns whether the header CRC-32 matches, and all lines of the data block are valid.
+func (e *DataEntry) Complete() bool {
+	if e.structure == nil || !e.headerValid() {
+		return false
+	}
+
+	for i, line := range e.Lines {
+		if !line.Header && e.Check(i).Status != LineStatusValid {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Text returns the document as written by GetText, to be deserialized.
+// Lines that were not typed in are left out, so error correction can reconstruct them.
+func (e *DataEntry) Text() []byte {
+	var text strings.Builder
+	text.WriteString(e.headerText())
+	text.WriteString(fmt.Sprintf("\n%s: %s\n\n\n", core.HeaderFieldHeaderCRC32, e.headerValue(core.HeaderFieldHeaderCRC32)))
+
+	for _, line := range e.Lines {
+		value := strings.TrimSpace(line.Value)
+		if line.Header || value == "" {
+			continue
+		}
+
+		if e.structure == nil || e.structure.layout.LineIndices {
+			text.WriteString(line.Label + ": ")
+		}
+		text.WriteString(value + "\n")
+	}
+
+	return []byte(text.String())
+}
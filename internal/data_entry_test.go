@@ -0,0 +1,183 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// typeIn fills the entry with the lines of the text of the document, as a user would, in order.
+func typeIn(t *testing.T, e *DataEntry, text []byte) {
+	t.Helper()
+
+	header, data, err := splitDocumentText(text)
+	if err != nil {
+		t.Fatalf("splitDocumentText failed with error %s", err)
+	}
+
+	set := func(label, value string) {
+		for i, line := range e.Lines {
+			if line.Label == label {
+				e.SetValue(i, value)
+				return
+			}
+		}
+		t.Fatalf("line %s not found", label)
+	}
+
+	for _, line := range header {
+		label, value, _ := strings.Cut(line, ": ")
+		set(label, value)
+	}
+	for _, line := range data {
+		if strings.TrimSpace(line) == "" || core.IsColumnIndexLine([]byte(line)) {
+			continue
+		}
+		label, value, _ := strings.Cut(line, ": ")
+		set(strings.TrimSpace(label), value)
+	}
+}
+
+func TestDataEntry(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 5))
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "Purpose", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), core.PaperCryptDataFormatRaw)
+
+	for _, opts := range []TextOptions{
+		{Encoding: core.PaperCryptDataEncodingBase16},
+		{Encoding: core.PaperCryptDataEncodingBase32, LineChecksum: core.LineChecksumCRC32, ErrorCorrectionLevel: 20},
+		{Encoding: core.PaperCryptDataEncodingBase64},
+	} {
+		t.Run(opts.Encoding.String(), func(t *testing.T) {
+			text, err := pc.GetText(opts.EncodingOptions())
+			if err != nil {
+				t.Fatalf("GetText failed with error %s", err)
+			}
+
+			e := NewDataEntry()
+			if e.StructureError() == nil {
+				t.Errorf("the data block should be unknown before the header is typed in")
+			}
+
+			typeIn(t, e, text)
+			if err := e.StructureError(); err != nil {
+				t.Fatalf("StructureError returned %s", err)
+			}
+			for i, line := range e.Lines {
+				if check := e.Check(i); check.Status != LineStatusValid && line.Value != "" {
+					t.Errorf("Line %s is %s: %s", line.Label, check.Status, check.Message)
+				}
+			}
+			if !e.Complete() {
+				t.Errorf("the entry should be complete")
+			}
+
+			typed := e.Text()
+			restored, err := core.DeserializeV2Text(typed, false, false)
+			if err != nil {
+				t.Fatalf("DeserializeV2Text failed with error %s", err)
+			}
+			if !bytes.Equal(restored.Data, data) {
+				t.Errorf("Decoding was incorrect, got: %s, want: %s.", restored.Data, data)
+			}
+		})
+	}
+}
+
+func TestDataEntryCheck(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 5))
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "Purpose", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), core.PaperCryptDataFormatRaw)
+	text, err := pc.GetText(core.EncodingOptions{Encoding: core.PaperCryptDataEncodingBase16})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+
+	e := NewDataEntry()
+	typeIn(t, e, text)
+
+	index := func(label string) int {
+		for i, line := range e.Lines {
+			if line.Label == label {
+				return i
+			}
+		}
+		t.Fatalf("line %s not found", label)
+		return -1
+	}
+	line := index("2")
+	value := e.Lines[line].Value
+
+	t.Run("incomplete", func(t *testing.T) {
+		e.SetValue(line, value[:10])
+		if check := e.Check(line); check.Status != LineStatusIncomplete {
+			t.Errorf("Status was incorrect, got: %s, want: %s.", check.Status, LineStatusIncomplete)
+		}
+	})
+
+	t.Run("wrong character", func(t *testing.T) {
+		e.SetValue(line, value[:5]+"X"+value[6:])
+		if check := e.Check(line); check.Status != LineStatusInvalid || check.Column != 5 {
+			t.Errorf("Check was incorrect, got: %s at %d, want: %s at %d.", check.Status, check.Column, LineStatusInvalid, 5)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		wrong := byte('1')
+		if value[7] == wrong {
+			wrong = '2'
+		}
+		e.SetValue(line, value[:7]+string(wrong)+value[8:])
+		check := e.Check(line)
+		if check.Status != LineStatusInvalid || check.Column != 7 || check.Suggestion != rune(value[7]) {
+			t.Errorf("Check was incorrect, got: %s at %d (%c), want: %s at %d (%c).", check.Status, check.Column, check.Suggestion, LineStatusInvalid, 7, value[7])
+		}
+
+		// the block checksum can not be verified, while a data line is invalid
+		if check := e.Check(index(fmt.Sprint(e.structure.dataLines + 1))); check.Status != LineStatusUnverified {
+			t.Errorf("Status was incorrect, got: %s, want: %s.", check.Status, LineStatusUnverified)
+		}
+		if e.Complete() {
+			t.Errorf("the entry should not be complete")
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		e.SetValue(line, value)
+		purpose := index(core.HeaderFieldPurpose)
+		e.SetValue(purpose, "Purpos")
+		if check := e.Check(index(core.HeaderFieldHeaderCRC32)); check.Status != LineStatusInvalid {
+			t.Errorf("Status was incorrect, got: %s, want: %s.", check.Status, LineStatusInvalid)
+		}
+		if check := e.Check(purpose); check.Status != LineStatusUnverified {
+			t.Errorf("Status was incorrect, got: %s, want: %s.", check.Status, LineStatusUnverified)
+		}
+
+		e.SetValue(purpose, "Purpose")
+		if !e.Complete() {
+			t.Errorf("the entry should be complete")
+		}
+	})
+}
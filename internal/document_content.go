@@ -0,0 +1,297 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// The content of a document is shared by all renderers (see Renderer),
+// only the layout is up to each of them.
+
+// documentSection is an informational section of the first page of a document.
+type documentSection struct {
+	Heading    string
+	Paragraphs []string
+
+	// Code lines follow the paragraphs, centered, in a bold monospace font of CodeSize pt, such as checksums.
+	Code     []string
+	CodeSize float64
+}
+
+// headerLine returns the line printed at the top of each page, holding the header fields in the order of the template.
+func headerLine(p *core.PaperCrypt, opts TextOptions) string {
+	headerFields := make([]string, 0, 3)
+	for _, field := range opts.Template.headerFieldOrder() {
+		switch {
+		case field == PDFHeaderFieldSerial:
+			headerFields = append(headerFields, fmt.Sprintf("%s: %s", opts.Language.T(PDFHeaderSheetID), p.SerialNumber))
+		case field == PDFHeaderFieldDate:
+			headerFields = append(headerFields, p.CreatedAt.Format(core.TimeStampFormatPDFHeader))
+		case field == PDFHeaderFieldPurpose && p.Purpose != "":
+			headerFields = append(headerFields, p.Purpose)
+		}
+	}
+
+	return strings.Join(headerFields, " - ")
+}
+
+// documentSections returns the informational sections of the first page, in the order of the template.
+// codes is the number of 2D codes the document is printed with.
+func documentSections(p *core.PaperCrypt, no2D bool, codes int, opts TextOptions) []documentSection {
+	l := opts.Language
+	sections := map[string]documentSection{
+		PDFSectionDescription: {
+			Heading:    l.T(PDFSectionDescriptionHeading),
+			Paragraphs: []string{l.T(PDFSectionDescriptionContent)},
+		},
+		PDFSectionRepresentation: {
+			Heading:    l.T(PDFSectionRepresentationHeading),
+			Paragraphs: representationParagraphs(p, opts),
+		},
+		PDFSectionRecovery: {
+			Heading:    l.T(PDFSectionRecoveryHeading),
+			Paragraphs: recoveryParagraphs(no2D, codes, opts),
+		},
+		PDFSectionReadBack: {
+			Heading:    l.T(PDFSectionReadBackHeading),
+			Paragraphs: []string{l.T(PDFSectionReadBackContent)},
+			Code:       []string{p.ReadBackPhrase()},
+			CodeSize:   12,
+		},
+		PDFSectionChecksums: {
+			Heading:    l.T(PDFSectionChecksumHeading),
+			Paragraphs: []string{l.Sprintf(PDFSectionChecksumContent, core.HeaderFieldSHA256)},
+			Code:       []string{core.FormatSHA256(p.DataSHA256[:])},
+			CodeSize:   10,
+		},
+	}
+	if len(p.PlaintextSHA256) > 0 {
+		checksums := sections[PDFSectionChecksums]
+		checksums.Paragraphs = append(checksums.Paragraphs, l.Sprintf(PDFSectionChecksumPlaintext, core.HeaderFieldPlaintextSHA256))
+		checksums.Code = append(checksums.Code, core.FormatSHA256(p.PlaintextSHA256))
+		sections[PDFSectionChecksums] = checksums
+	}
+	if opts.Template != nil && opts.Template.Contact != "" {
+		sections[PDFSectionContact] = documentSection{
+			Heading:    l.T(PDFSectionContactHeading),
+			Paragraphs: []string{opts.Template.Contact},
+		}
+	}
+
+	var ordered []documentSection
+	for _, name := range opts.Template.sectionOrder() {
+		if section, ok := sections[name]; ok {
+			ordered = append(ordered, section)
+		}
+	}
+
+	return ordered
+}
+
+func representationParagraphs(p *core.PaperCrypt, opts TextOptions) []string {
+	representation := PDFSectionRepresentationContent
+	switch opts.Encoding {
+	case core.PaperCryptDataEncodingBase32:
+		representation = PDFSectionRepresentationBase32
+	case core.PaperCryptDataEncodingBase64:
+		representation = PDFSectionRepresentationBase64
+	case core.PaperCryptDataEncodingArmor:
+		representation = PDFSectionRepresentationArmor
+	case core.PaperCryptDataEncodingWords:
+		representation = PDFSectionRepresentationWords
+	}
+	bytesPerLine := opts.DataLayout().BytesPerLine()
+	if opts.Encoding == core.PaperCryptDataEncodingWords {
+		bytesPerLine = core.WordStreamGroupSize
+	}
+
+	l := opts.Language
+	paragraphs := []string{l.Sprintf(representation, bytesPerLine, core.CRC24Polynomial, core.CRC24Initial)}
+	if opts.DataLayout() != core.DefaultDataLayout {
+		paragraphs = append(paragraphs, l.Sprintf(PDFSectionRepresentationLayout, core.HeaderFieldDataLayout))
+	}
+	if opts.LineChecksum != core.LineChecksumCRC24 {
+		paragraphs = append(paragraphs, l.Sprintf(PDFSectionRepresentationChecksum, opts.LineChecksum, core.HeaderFieldLineChecksum))
+	}
+	if opts.Profile == OutputProfileStamping {
+		paragraphs = append(paragraphs, l.T(PDFSectionRepresentationStamping))
+	}
+	if ecc, ok, _ := opts.ErrorCorrection(p.GetDataLength()); ok {
+		paragraphs = append(paragraphs, l.Sprintf(PDFSectionRepresentationParity, ecc.Stripes*ecc.ParityLines, core.HeaderFieldErrorCorrection))
+	}
+
+	return paragraphs
+}
+
+func recoveryParagraphs(no2D bool, codes int, opts TextOptions) []string {
+	l := opts.Language
+	paragraphs := []string{l.T(PDFSectionRecoveryContent)}
+	if no2D {
+		paragraphs[0] = l.T(PDFSectionRecoveryContentNo2D)
+	}
+	if codes > 1 && opts.Duplex != DuplexNone {
+		paragraphs = append(paragraphs, l.Sprintf(PDFSectionRecoveryContentPartsDuplex, codes))
+	} else if codes > 1 {
+		paragraphs = append(paragraphs, l.Sprintf(PDFSectionRecoveryContentParts, codes))
+	}
+	if !no2D && opts.Code2D.Type == core.Code2DTypeColor {
+		paragraphs = append(paragraphs, l.T(PDFSectionRecoveryContentColor))
+	}
+
+	return paragraphs
+}
+
+// splitDocumentText splits the text representation of a document (see GetText) into its header and data lines.
+// Empty lines at the end are cut, empty lines in between separate blocks of data.
+func splitDocumentText(text []byte) ([]string, []string, error) {
+	// split at 2 empty lines, to get the header and the data
+	parts := strings.Split(string(text), "\n\n\n")
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("error splitting text content into header and data")
+	}
+
+	dataLines := strings.Split(parts[1], "\n")
+	for len(dataLines) > 0 && dataLines[len(dataLines)-1] == "" {
+		dataLines = dataLines[:len(dataLines)-1]
+	}
+
+	return strings.Split(parts[0], "\n"), dataLines, nil
+}
+
+// code2DImages returns the 2D codes of the document as PNG images, along with their printed sizes in mm.
+// Large payloads are split into several codes.
+func code2DImages(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]*bytes.Buffer, []float64, error) {
+	codes, err := newCode2DImageSet(p, no2D, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	images := make([]*bytes.Buffer, codes.Len())
+	for i := range images {
+		codePNG, err := codes.PNG(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		images[i] = bytes.NewBuffer(codePNG)
+	}
+
+	return images, codes.sizes, nil
+}
+
+// code2DImageSet holds the 2D codes of a document, and encodes their PNG images on request, one at a time,
+// so documents of hundreds of codes, of several megapixels each, do not hold the images of all of them at once.
+type code2DImageSet struct {
+	codes  []barcode.Barcode
+	pixels []int
+	// sizes are the printed sizes of the codes, in mm
+	sizes []float64
+	// pngs are the images of color codes, which are encoded beforehand
+	pngs []*bytes.Buffer
+}
+
+// newCode2DImageSet returns the 2D codes of the document, none with no2D.
+// Large payloads are split into several codes.
+func newCode2DImageSet(p *core.PaperCrypt, no2D bool, opts TextOptions) (*code2DImageSet, error) {
+	if no2D {
+		return &code2DImageSet{}, nil
+	}
+
+	// for the 2D code, serialize *p as set in opts (JSON by default)
+	qrPayload, err := p.QRPayload(opts.QRPayload)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error serializing PaperCrypt to %s", opts.QRPayload), err)
+	}
+
+	if opts.Code2D.Type == core.Code2DTypeColor {
+		images, sizes, err := colorCodePNGs(qrPayload, opts.Code2D)
+		if err != nil {
+			return nil, errors.Join(errors.New("error generating 2D code"), err)
+		}
+		return &code2DImageSet{pngs: images, sizes: sizes}, nil
+	}
+
+	codes, err := core.Encode2DParts(qrPayload, opts.Code2D)
+	if err != nil {
+		return nil, errors.Join(errors.New("error generating 2D code"), err)
+	}
+
+	set := &code2DImageSet{codes: codes}
+	for _, code := range codes {
+		size, pixels := opts.Code2D.PrintSize(code.Bounds().Dx())
+		set.sizes = append(set.sizes, size)
+		set.pixels = append(set.pixels, pixels)
+	}
+
+	return set, nil
+}
+
+// Len returns the number of codes.
+func (s *code2DImageSet) Len() int {
+	return len(s.sizes)
+}
+
+// PNG returns the PNG image of the code i.
+func (s *code2DImageSet) PNG(i int) ([]byte, error) {
+	if s.pngs != nil {
+		return s.pngs[i].Bytes(), nil
+	}
+
+	codePNG := new(bytes.Buffer)
+	if err := writeScaledCodePNG(codePNG, s.codes[i], s.pixels[i]); err != nil {
+		return nil, errors.Join(errors.New("error generating 2D code PNG"), err)
+	}
+
+	return codePNG.Bytes(), nil
+}
+
+// streamed returns whether the images of the codes are encoded on request, rather than beforehand (as color codes are),
+// so the PDF renderer places them in the document as they are written, see writeStreamedPDF.
+func (s *code2DImageSet) streamed() bool {
+	return s.pngs == nil
+}
+
+// writePDFImage writes the image of the code i to w as the data of a PDF image stream (see writeScaledCodeRows),
+// returning the dictionary of the stream.
+func (s *code2DImageSet) writePDFImage(w io.Writer, i int) (pdfDict, error) {
+	if err := writeScaledCodeRows(w, s.codes[i], s.pixels[i]); err != nil {
+		return nil, errors.Join(errors.New("error generating 2D code image"), err)
+	}
+
+	pixels := float64(s.pixels[i])
+	return pdfDict{
+		"Type":             pdfName("XObject"),
+		"Subtype":          pdfName("Image"),
+		"Width":            pixels,
+		"Height":           pixels,
+		"ColorSpace":       pdfName("DeviceGray"),
+		"BitsPerComponent": 8.0,
+		"Filter":           pdfName("FlateDecode"),
+		"DecodeParms":      pdfDict{"Predictor": 15.0, "Colors": 1.0, "BitsPerComponent": 8.0, "Columns": pixels},
+	}, nil
+}
@@ -0,0 +1,126 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Duplex is the way documents are printed on both sides of the paper.
+// Duplex documents hold the 2D code and the data on the front, continuing on the back,
+// followed by the information on the document, and have an even number of pages.
+type Duplex uint8
+
+const (
+	// DuplexNone prints on one side of the paper only.
+	DuplexNone Duplex = 0
+	// DuplexLongEdge flips the paper on its long edge, like the pages of a book.
+	DuplexLongEdge Duplex = 1
+	// DuplexShortEdge flips the paper on its short edge, like the pages of a wall calendar.
+	DuplexShortEdge Duplex = 2
+	// DuplexUnknown is returned for unknown duplex modes.
+	DuplexUnknown Duplex = 0xFF
+)
+
+var pdfTrailerPrevPattern = regexp.MustCompile(`\s*/Prev \d+`)
+
+func (d Duplex) String() string {
+	switch d {
+	case DuplexNone:
+		return "None"
+	case DuplexLongEdge:
+		return "Long-Edge"
+	case DuplexShortEdge:
+		return "Short-Edge"
+	default:
+		return "Unknown"
+	}
+}
+
+func DuplexFromString(s string) Duplex {
+	switch strings.ToLower(s) {
+	case "none", "":
+		return DuplexNone
+	case "long-edge", "long":
+		return DuplexLongEdge
+	case "short-edge", "short":
+		return DuplexShortEdge
+	default:
+		return DuplexUnknown
+	}
+}
+
+// viewerPreference returns the value of the /Duplex viewer preference, which preselects the duplex mode in print dialogs.
+func (d Duplex) viewerPreference() string {
+	switch d {
+	case DuplexLongEdge:
+		return "DuplexFlipLongEdge"
+	case DuplexShortEdge:
+		return "DuplexFlipShortEdge"
+	default:
+		return "Simplex"
+	}
+}
+
+// updatePDFCatalog appends entries to the catalog of a PDF document written by gofpdf (or converted by ConvertToPDFA),
+// writing the new catalog as an incremental update.
+func updatePDFCatalog(doc []byte, entries string) ([]byte, error) {
+	startXRef := pdfStartXRefPattern.FindSubmatch(doc)
+	if startXRef == nil {
+		return nil, errors.New("PDF document has no cross-reference table")
+	}
+	trailers := pdfTrailerPattern.FindAllSubmatch(doc, -1)
+	if trailers == nil {
+		return nil, errors.New("PDF document has no trailer")
+	}
+	trailer := trailers[len(trailers)-1][1]
+
+	root, err := pdfReference(trailer, "Root")
+	if err != nil {
+		return nil, err
+	}
+
+	// the last definition of the catalog is the current one
+	catalogs := regexp.MustCompile(fmt.Sprintf(`(?s)\n%d 0 obj\n<<(.*?)\n>>\nendobj`, root)).FindAllSubmatch(doc, -1)
+	if catalogs == nil {
+		return nil, errors.New("PDF document has no catalog")
+	}
+
+	var out bytes.Buffer
+	out.Write(doc)
+	if !bytes.HasSuffix(doc, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+
+	offset := out.Len()
+	fmt.Fprintf(&out, "%d 0 obj\n<<%s\n%s\n>>\nendobj\n", root, catalogs[len(catalogs)-1][1], entries)
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 1\n0000000000 65535 f \n%d 1\n%010d 00000 n \n", root, offset)
+	fmt.Fprintf(&out, "trailer\n<<%s\n/Prev %s\n>>\n", pdfTrailerPrevPattern.ReplaceAll(bytes.TrimRight(trailer, "\n"), nil), startXRef[1])
+	fmt.Fprintf(&out, "startxref\n%d\n%%%%EOF\n", xref)
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,71 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestDuplexFromString(t *testing.T) {
+	for _, duplex := range []Duplex{DuplexNone, DuplexLongEdge, DuplexShortEdge} {
+		if got := DuplexFromString(duplex.String()); got != duplex {
+			t.Errorf("DuplexFromString was incorrect, got: %s, want: %s.", got, duplex)
+		}
+	}
+	if got := DuplexFromString("sideways"); got != DuplexUnknown {
+		t.Errorf("DuplexFromString was incorrect, got: %s, want: %s.", got, DuplexUnknown)
+	}
+}
+
+func TestGetPDFDuplex(t *testing.T) {
+	loadFonts(t)
+
+	pc := core.NewPaperCrypt("2.0.0", make([]byte, 64), "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatRaw)
+	for _, pdfa := range []bool{false, true} {
+		doc, err := GetPDF(pc, false, TextOptions{Duplex: DuplexShortEdge, PDFA: pdfa})
+		if err != nil {
+			t.Fatalf("GetPDF failed with error %s", err)
+		}
+
+		pdf, err := readPDFDocument(doc)
+		if err != nil {
+			t.Fatalf("readPDFDocument failed with error %s", err)
+		}
+		pages, err := pdf.pages()
+		if err != nil {
+			t.Fatalf("pages failed with error %s", err)
+		}
+		if len(pages)%2 != 0 {
+			t.Errorf("Duplex documents should have an even number of pages, got: %d", len(pages))
+		}
+
+		preferences := pdf.dict(pdf.dict(pdf.trailer, "Root"), "ViewerPreferences")
+		if got := preferences["Duplex"]; got != pdfName("DuplexFlipShortEdge") {
+			t.Errorf("got: %v, want: DuplexFlipShortEdge.", got)
+		}
+		if pdfa && pdf.dict(pdf.trailer, "Root")["Metadata"] == nil {
+			t.Errorf("The catalog of PDF/A documents should keep its metadata")
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// BruteForceGuessesPerSecond is the attacker speed assumed by BruteForceEstimate.
+// It represents a well-funded offline attacker, and is deliberately pessimistic.
+const BruteForceGuessesPerSecond = 1e12
+
+// GenerateRandomWords chooses `amount` distinct words from the word list,
+// using the system's cryptographically secure random number generator.
+func GenerateRandomWords(amount int, wordList []string) ([]string, error) {
+	if amount < 1 {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if amount > len(wordList) {
+		return nil, fmt.Errorf("cannot choose %d distinct words from a list of %d words", amount, len(wordList))
+	}
+
+	chosen := make(map[int]bool, amount)
+	words := make([]string, 0, amount)
+	for len(words) < amount {
+		random, err := rand.Int(rand.Reader, big.NewInt(int64(len(wordList))))
+		if err != nil {
+			return nil, errors.Join(errors.New("error generating random number"), err)
+		}
+
+		index := int(random.Int64())
+		if chosen[index] {
+			continue
+		}
+
+		chosen[index] = true
+		words = append(words, wordList[index])
+	}
+
+	return words, nil
+}
+
+// PhraseEntropyBits returns the entropy of a phrase of `words` distinct words,
+// chosen uniformly at random from a list of `wordListSize` words.
+func PhraseEntropyBits(wordListSize int, words int) float64 {
+	bits := 0.0
+	for i := 0; i < words; i++ {
+		bits += math.Log2(float64(wordListSize - i))
+	}
+
+	return bits
+}
+
+// WordsForEntropy returns the smallest number of distinct words, chosen from a list of `wordListSize` words,
+// that provides at least `bits` bits of entropy.
+func WordsForEntropy(wordListSize int, bits int) (int, error) {
+	if bits < 1 {
+		return 0, errors.New("bits must be greater than 0")
+	}
+
+	for words := 1; words <= wordListSize; words++ {
+		if PhraseEntropyBits(wordListSize, words) >= float64(bits) {
+			return words, nil
+		}
+	}
+
+	return 0, fmt.Errorf("a list of %d words cannot provide %d bits of entropy", wordListSize, bits)
+}
+
+// BruteForceEstimate returns a human-readable estimate of the average time
+// needed to guess a secret with `bits` bits of entropy,
+// at BruteForceGuessesPerSecond guesses per second.
+func BruteForceEstimate(bits float64) string {
+	// on average, half the key space has to be searched
+	seconds := math.Pow(2, bits-1) / BruteForceGuessesPerSecond
+
+	const (
+		minute = 60
+		hour   = 60 * minute
+		day    = 24 * hour
+		year   = 365.25 * day
+	)
+
+	switch {
+	case seconds < 1:
+		return "less than a second"
+	case seconds < hour:
+		return fmt.Sprintf("%.0f minutes", math.Ceil(seconds/minute))
+	case seconds < day:
+		return fmt.Sprintf("%.0f hours", math.Ceil(seconds/hour))
+	case seconds < year:
+		return fmt.Sprintf("%.0f days", math.Ceil(seconds/day))
+	case seconds < 1e6*year:
+		return fmt.Sprintf("%.0f years", math.Ceil(seconds/year))
+	default:
+		return fmt.Sprintf("~10^%.0f years", math.Log10(seconds/year))
+	}
+}
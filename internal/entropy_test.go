@@ -0,0 +1,69 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestWordsForEntropy(t *testing.T) {
+	t.Run("six words of the eff.org list", func(t *testing.T) {
+		bits := PhraseEntropyBits(7776, 6)
+		if math.Abs(bits-77.5) > 0.1 {
+			t.Errorf("Entropy was incorrect, got: %f, want: %f.", bits, 77.5)
+		}
+	})
+
+	t.Run("enough words for the requested entropy", func(t *testing.T) {
+		words, err := WordsForEntropy(7776, 128)
+		if err != nil {
+			t.Fatalf("WordsForEntropy failed with error %s", err)
+		}
+
+		if words != 10 {
+			t.Errorf("Word count was incorrect, got: %d, want: %d.", words, 10)
+		}
+	})
+
+	t.Run("unreachable entropy", func(t *testing.T) {
+		if _, err := WordsForEntropy(4, 128); err == nil {
+			t.Errorf("WordsForEntropy should fail if the word list is too short")
+		}
+	})
+}
+
+func TestGenerateRandomWords(t *testing.T) {
+	list := []string{"a", "b", "c", "d"}
+
+	words, err := GenerateRandomWords(4, list)
+	if err != nil {
+		t.Fatalf("GenerateRandomWords failed with error %s", err)
+	}
+
+	for i, word := range words {
+		if core.SliceHasString(words[i+1:], word) {
+			t.Errorf("Word %s appeared more than once", word)
+		}
+	}
+}
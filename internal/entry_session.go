@@ -0,0 +1,159 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// EntrySessionVersion is the version of the session file format.
+const EntrySessionVersion = 1
+
+// EntrySession is the progress of a document being typed in, saved to a session file
+// (see `decode --session`), so the transcription can be paused, and resumed later, or by someone else.
+type EntrySession struct {
+	Version int `json:"version"`
+
+	// SavedAt is the time the session was saved.
+	SavedAt time.Time `json:"saved_at"`
+
+	// Lines holds the values typed in so far, in order: header fields first, then the lines of the data block.
+	Lines []EntrySessionLine `json:"lines"`
+
+	// Line and Column are the position of the cursor.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// EntrySessionLine is the value typed in for a line, by its label.
+type EntrySessionLine struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Session returns the values typed in so far, with the position of the cursor.
+func (e *DataEntry) Session(line, column int) EntrySession {
+	session := EntrySession{
+		Version: EntrySessionVersion,
+		SavedAt: time.Now(),
+		Line:    line,
+		Column:  column,
+	}
+	for _, l := range e.Lines {
+		if l.Value != "" {
+			session.Lines = append(session.Lines, EntrySessionLine{Label: l.Label, Value: l.Value})
+		}
+	}
+
+	return session
+}
+
+// RestoreDataEntry returns a DataEntry holding the values of the session.
+// As the lines of the data block depend on the header, values are restored in the order they were saved.
+func RestoreDataEntry(session *EntrySession) (*DataEntry, error) {
+	e := NewDataEntry()
+	for _, saved := range session.Lines {
+		found := false
+		for i, line := range e.Lines {
+			if line.Label == saved.Label {
+				e.SetValue(i, saved.Value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("the session holds an unexpected line: %s", saved.Label)
+		}
+	}
+
+	return e, nil
+}
+
+// SaveEntrySession encrypts the session using the passphrase, and writes it to the file at path.
+// The file is replaced at once, so an interrupted save does not lose the progress saved before.
+func SaveEntrySession(path string, session EntrySession, passphrase []byte) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return errors.Join(errors.New("error serializing session"), err)
+	}
+
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(data), passphrase)
+	if err != nil {
+		return errors.Join(errors.New("error encrypting session"), err)
+	}
+	armored, err := encrypted.GetArmored()
+	if err != nil {
+		return errors.Join(errors.New("error encrypting session"), err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Join(errors.New("error saving session"), err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.WriteString(armored); err != nil {
+		temp.Close()
+		return errors.Join(errors.New("error saving session"), err)
+	}
+	if err := temp.Close(); err != nil {
+		return errors.Join(errors.New("error saving session"), err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return errors.Join(errors.New("error saving session"), err)
+	}
+
+	return nil
+}
+
+// LoadEntrySession reads and decrypts the session file at path.
+func LoadEntrySession(path string, passphrase []byte) (*EntrySession, error) {
+	armored, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading session"), err)
+	}
+
+	message, err := crypto.NewPGPMessageFromArmored(string(armored))
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading session"), err)
+	}
+	decrypted, err := crypto.DecryptMessageWithPassword(message, passphrase)
+	if err != nil {
+		return nil, errors.Join(errors.New("error decrypting session, is the passphrase correct?"), err)
+	}
+
+	var session EntrySession
+	if err := json.Unmarshal(decrypted.GetBinary(), &session); err != nil {
+		return nil, errors.Join(errors.New("error parsing session"), err)
+	}
+	if session.Version != EntrySessionVersion {
+		return nil, fmt.Errorf("unsupported session version %d", session.Version)
+	}
+
+	return &session, nil
+}
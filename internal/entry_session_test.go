@@ -0,0 +1,76 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestEntrySession(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 5))
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "Purpose", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), core.PaperCryptDataFormatRaw)
+	text, err := pc.GetText(core.EncodingOptions{Encoding: core.PaperCryptDataEncodingBase32, ErrorCorrectionLevel: 20})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+
+	e := NewDataEntry()
+	typeIn(t, e, text)
+	// the transcription is paused halfway through
+	last := len(e.Lines) - 1
+	e.SetValue(last, e.Lines[last].Value[:5])
+
+	path := filepath.Join(t.TempDir(), "transcription.session")
+	passphrase := []byte("session passphrase")
+	if err := SaveEntrySession(path, e.Session(last, 5), passphrase); err != nil {
+		t.Fatalf("SaveEntrySession failed with error %s", err)
+	}
+
+	if _, err := LoadEntrySession(path, []byte("wrong")); err == nil {
+		t.Errorf("LoadEntrySession should fail with the wrong passphrase")
+	}
+
+	session, err := LoadEntrySession(path, passphrase)
+	if err != nil {
+		t.Fatalf("LoadEntrySession failed with error %s", err)
+	}
+	if session.Line != last || session.Column != 5 {
+		t.Errorf("Position was incorrect, got: %d:%d, want: %d:%d.", session.Line, session.Column, last, 5)
+	}
+
+	restored, err := RestoreDataEntry(session)
+	if err != nil {
+		t.Fatalf("RestoreDataEntry failed with error %s", err)
+	}
+	if len(restored.Lines) != len(e.Lines) {
+		t.Fatalf("Number of lines was incorrect, got: %d, want: %d.", len(restored.Lines), len(e.Lines))
+	}
+	for i, line := range e.Lines {
+		if restored.Lines[i] != line {
+			t.Errorf("Line was incorrect, got: %v, want: %v.", restored.Lines[i], line)
+		}
+	}
+}
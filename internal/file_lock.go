@@ -0,0 +1,76 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2023-2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// fileLock is an exclusive lock on a file, held by a single process at a time, see lockFile.
+type fileLock struct {
+	file *os.File
+}
+
+// lockFile takes the exclusive lock on the file at path, waiting for any other process holding it to release it.
+// The lock is taken on a separate file, path with ".lock" appended, as the file itself is replaced by writeFileAtomically.
+func lockFile(path string) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, errors.Join(errors.New("error creating directory"), err)
+	}
+
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, errors.Join(errors.New("error opening lock file"), err)
+	}
+
+	lock, err := lockOpenFile(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// lockOpenFile takes the exclusive lock on file, which is closed as the lock is released.
+// Files that are only ever appended to, never replaced, are locked as they are, see lockFile for the others.
+func lockOpenFile(file *os.File) (*fileLock, error) {
+	if err := lockFileHandle(file); err != nil {
+		return nil, errors.Join(errors.New("error locking file"), err)
+	}
+
+	return &fileLock{file: file}, nil
+}
+
+// Unlock releases the lock, and closes the file.
+func (l *fileLock) Unlock() error {
+	err := unlockFileHandle(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Join(errors.New("error unlocking file"), err)
+	}
+
+	return nil
+}
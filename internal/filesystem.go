@@ -21,15 +21,20 @@
 package internal
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/caarlos0/log"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+	"golang.org/x/term"
 )
 
+// ErrFileExists is returned by GetFileHandleCarefully, if the file exists, and is not to be overridden.
+var ErrFileExists = core.WithCategory(core.ErrorCategoryFileExists, errors.New("file already exists, use --force to override"))
+
 // GetFileHandleCarefully returns a file handle for the given path.
 // will warn if the file already exists, and error if override is false.
 // if path is empty, returns os.Stdout.
@@ -40,7 +45,7 @@ func GetFileHandleCarefully(path string, override bool) (*os.File, error) {
 
 	if _, err := os.Stat(path); err == nil {
 		if !override {
-			return nil, fmt.Errorf("file %s already exists, use --force to override", path)
+			return nil, fmt.Errorf("%w: %s", ErrFileExists, path)
 		}
 
 		log.WithField("path", path).Warn("Overriding existing file!")
@@ -48,7 +53,7 @@ func GetFileHandleCarefully(path string, override bool) (*os.File, error) {
 
 	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
 	if err != nil {
-		return nil, fmt.Errorf("error opening file '%s': %s", path, err)
+		return nil, fmt.Errorf("error opening file '%s': %w", path, err)
 	}
 
 	return out, nil
@@ -61,6 +66,12 @@ func PrintInputAndGetReader(inFileName string) (*os.File, error) {
 	var err error
 	var inFile *os.File
 	if inFileName == "" || inFileName == "-" {
+		// typing in the data is a prompt too
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			if err := RequireInteraction("the input, use --in or pipe it to stdin"); err != nil {
+				return nil, err
+			}
+		}
 		inFile = os.Stdin
 	} else {
 		inFile, err = os.Open(inFileName)
@@ -106,6 +117,17 @@ func CloseFileIfNotStd(file *os.File) error {
 	return nil
 }
 
-func NormalizeLineEndings(data []byte) []byte {
-	return bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+// writeFileAtomically writes data to the file at path, creating its directory if needed.
+// It writes to a temporary file first, so the file is never left half-written.
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return errors.Join(errors.New("error creating directory"), err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
 }
@@ -0,0 +1,170 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GnuPG exports keys from the keyring of GnuPG, and encrypts, and decrypts files with them,
+// using the gpg command line program.
+type GnuPG struct {
+	// Path is the path of the gpg program.
+	Path string
+}
+
+// NewGnuPG looks up the gpg program, by name in the PATH, or at the given path.
+func NewGnuPG(path string) (*GnuPG, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%s not found, install GnuPG (https://gnupg.org)", path), err)
+	}
+
+	return &GnuPG{Path: resolved}, nil
+}
+
+// ExportSecretKey exports the secret key, and its subkeys, identified by keyID (binary).
+// gpg may ask for the passphrase of the key, using its pinentry.
+func (g *GnuPG) ExportSecretKey(keyID string) ([]byte, error) {
+	return g.export("--export-secret-keys", keyID)
+}
+
+// ExportPublicKey exports the public key identified by keyID (binary).
+func (g *GnuPG) ExportPublicKey(keyID string) ([]byte, error) {
+	return g.export("--export", keyID)
+}
+
+// ImportKey imports the key (ASCII armored, or binary) into the keyring of GnuPG,
+// and returns the report of gpg, listing the keys imported.
+func (g *GnuPG) ImportKey(key []byte) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(g.Path, "--batch", "--import")
+	cmd.Stdin = bytes.NewReader(key)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Join(fmt.Errorf("error running gpg: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return strings.TrimSpace(stderr.String()), nil
+}
+
+// Decrypt decrypts the file, as pass does, gpg may ask for the passphrase of the key, using its pinentry.
+func (g *GnuPG) Decrypt(file string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(g.Path, "--quiet", "--yes", "--decrypt", "--", file)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Join(fmt.Errorf("error running gpg: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Encrypt encrypts the data for the recipients, identified by their key IDs, fingerprints, or email addresses,
+// and writes it to the file, replacing it, as pass does.
+func (g *GnuPG) Encrypt(data []byte, recipients []string, file string) error {
+	args := []string{"--quiet", "--yes", "--batch", "--no-encrypt-to", "--encrypt", "--output", file}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(g.Path, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Join(fmt.Errorf("error running gpg: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return nil
+}
+
+// DecryptSymmetric decrypts an OpenPGP message encrypted using the passphrase, without asking for it.
+// gpg runs in a temporary home directory, so neither the keyring, nor the passphrase cache, of the user are involved.
+func (g *GnuPG) DecryptSymmetric(message []byte, passphrase []byte) ([]byte, error) {
+	home, err := os.MkdirTemp("", "papercrypt-gnupg-")
+	if err != nil {
+		return nil, errors.Join(errors.New("error creating temporary GnuPG home directory"), err)
+	}
+	defer func() {
+		// the agent gpg started for the home directory would otherwise outlive it
+		if gpgconf, err := exec.LookPath("gpgconf"); err == nil {
+			_ = exec.Command(gpgconf, "--homedir", home, "--kill", "gpg-agent").Run()
+		}
+		_ = os.RemoveAll(home)
+	}()
+
+	messageFile := filepath.Join(home, "message.pgp")
+	if err := os.WriteFile(messageFile, message, 0o600); err != nil {
+		return nil, errors.Join(errors.New("error writing message for gpg"), err)
+	}
+
+	// gpg reads the passphrase up to the first line break
+	stdin := make([]byte, 0, len(passphrase)+1)
+	stdin = append(append(stdin, passphrase...), '\n')
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(g.Path, "--homedir", home, "--quiet", "--batch", "--no-symkey-cache",
+		"--pinentry-mode", "loopback", "--passphrase-fd", "0", "--decrypt", "--", messageFile)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Join(fmt.Errorf("error running gpg: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Version returns the first line of the version information of gpg, such as "gpg (GnuPG) 2.4.4".
+func (g *GnuPG) Version() (string, error) {
+	out, err := exec.Command(g.Path, "--version").Output()
+	if err != nil {
+		return "", errors.Join(errors.New("error running gpg"), err)
+	}
+
+	version, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(version), nil
+}
+
+func (g *GnuPG) export(command string, keyID string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(g.Path, command, "--", keyID)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Join(fmt.Errorf("error running gpg: %s", strings.TrimSpace(stderr.String())), err)
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("no key found for %s", keyID)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestGnuPG(t *testing.T) {
+	gpg, err := NewGnuPG("gpg")
+	if err != nil {
+		t.Skip("gpg is not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() {
+		// stop the agent started for the keyring
+		_ = exec.Command("gpgconf", "--kill", "all").Run()
+	})
+
+	key, err := crypto.GenerateKey("Owner", "owner@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	armored, err := key.Armor()
+	if err != nil {
+		t.Fatalf("Armor failed with error %s", err)
+	}
+
+	if _, err := gpg.ExportPublicKey(key.GetFingerprint()); err == nil {
+		t.Fatal("ExportPublicKey succeeded for a key not in the keyring")
+	}
+	if _, err := gpg.ImportKey([]byte(armored)); err != nil {
+		t.Fatalf("ImportKey failed with error %s", err)
+	}
+	if _, err := gpg.ExportPublicKey(key.GetFingerprint()); err != nil {
+		t.Fatalf("ExportPublicKey failed with error %s", err)
+	}
+	secretKey, err := gpg.ExportSecretKey(key.GetFingerprint())
+	if err != nil {
+		t.Fatalf("ExportSecretKey failed with error %s", err)
+	}
+	if _, err := ExtractPaperKey(secretKey); err != nil {
+		t.Errorf("ExtractPaperKey failed with error %s", err)
+	}
+
+	// keys are only encrypted for in batch mode, once they are trusted
+	trust := exec.Command(gpg.Path, "--batch", "--import-ownertrust")
+	trust.Stdin = strings.NewReader(strings.ToUpper(key.GetFingerprint()) + ":6:\n")
+	if err := trust.Run(); err != nil {
+		t.Fatalf("gpg --import-ownertrust failed with error %s", err)
+	}
+	file := filepath.Join(home, "entry.gpg")
+	if err := gpg.Encrypt([]byte("hunter2"), []string{key.GetFingerprint()}, file); err != nil {
+		t.Fatalf("Encrypt failed with error %s", err)
+	}
+	decrypted, err := gpg.Decrypt(file)
+	if err != nil {
+		t.Fatalf("Decrypt failed with error %s", err)
+	}
+	if string(decrypted) != "hunter2" {
+		t.Errorf("Decrypt was incorrect, got: %s, want: %s.", decrypted, "hunter2")
+	}
+	if err := gpg.Encrypt([]byte("hunter2"), []string{"nobody@example.com"}, file); err == nil {
+		t.Error("Encrypt succeeded for a recipient not in the keyring")
+	}
+
+	if _, err := NewGnuPG(home + string(os.PathSeparator) + "gpg"); err == nil {
+		t.Error("NewGnuPG succeeded for a missing program")
+	}
+}
+
+func TestGnuPGDecryptSymmetric(t *testing.T) {
+	gpg, err := NewGnuPG("gpg")
+	if err != nil {
+		t.Skip("gpg is not installed")
+	}
+
+	data, err := core.CompressAndEncrypt([]byte("passphrase"), []byte("hunter2"), false)
+	if err != nil {
+		t.Fatalf("CompressAndEncrypt failed with error %s", err)
+	}
+	pc := core.NewPaperCrypt("2.0.0", data, "ABC123", "", "", time.Now(), core.PaperCryptDataFormatPGP)
+
+	decoded, err := pc.DecodeWith(func(message []byte) ([]byte, error) {
+		return gpg.DecryptSymmetric(message, []byte("passphrase"))
+	})
+	if err != nil {
+		t.Fatalf("DecodeWith failed with error %s", err)
+	}
+	if string(decoded) != "hunter2" {
+		t.Errorf("DecodeWith was incorrect, got: %s, want: %s.", decoded, "hunter2")
+	}
+
+	if _, err := pc.DecodeWith(func(message []byte) ([]byte, error) {
+		return gpg.DecryptSymmetric(message, []byte("wrong"))
+	}); err == nil {
+		t.Error("DecodeWith succeeded with an incorrect passphrase")
+	}
+
+	version, err := gpg.Version()
+	if err != nil {
+		t.Fatalf("Version failed with error %s", err)
+	}
+	if !strings.Contains(version, "GnuPG") {
+		t.Errorf("Version was incorrect, got: %s, want: the version of GnuPG.", version)
+	}
+}
@@ -0,0 +1,312 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// The HTML output is a single file with inline styles, and images and fonts as data URIs,
+// so a document can be printed from any browser, without installing anything.
+// Header and footer are repeated on each printed page, using the header and footer groups of a table.
+// Corner markers are left out, as browsers do not place content on the page exactly.
+
+// htmlImage is an image of an HTML document, with its printed size in mm.
+type htmlImage struct {
+	Src           template.URL
+	Width, Height float64
+	Caption       string
+}
+
+// htmlLine is a line of the data block of an HTML document.
+type htmlLine struct {
+	Text  string
+	Cells []string
+	Class string
+}
+
+type htmlDocument struct {
+	Lang        string
+	Title       string
+	PageSize    string
+	Margin      float64
+	MonoFonts   []template.URL
+	DataFont    template.URL
+	DataSize    float64
+	LineHeight  float64
+	HeaderLine  string
+	Logo        *htmlImage
+	Header      string
+	Footer      string
+	Banner      string
+	Watermark   string
+	WatermarkAt float64
+	Heading     string
+	Sections    []documentSection
+	Codes       []htmlImage
+	HeaderLines []string
+	DataLines   []htmlLine
+
+	InstructionsHeading string
+	InstructionsIntro   string
+	InstructionsStep    string
+	Instructions        []RecoveryStep
+}
+
+var htmlTemplate = template.Must(template.New("document").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+{{- range $i, $font := .MonoFonts}}
+@font-face { font-family: "PaperCrypt Mono"; font-weight: {{if $i}}bold{{else}}normal{{end}}; src: url({{$font}}) format("truetype"); }
+{{- end}}
+{{- if .DataFont}}
+@font-face { font-family: "PaperCrypt Data"; src: url({{.DataFont}}) format("truetype"); }
+{{- end}}
+@page { size: {{.PageSize}}; margin: 10mm {{.Margin}}mm; }
+html { -webkit-print-color-adjust: exact; print-color-adjust: exact; }
+body { margin: 0; font-family: "Noto Sans", "Helvetica Neue", Arial, sans-serif; font-size: 10pt; line-height: 5mm; color: #000; background: #fff; }
+.mono { font-family: "PaperCrypt Mono", "Inconsolata", monospace; }
+table.layout { width: 100%; border-collapse: collapse; }
+table.layout td { padding: 0; vertical-align: top; }
+.header-line { font-size: 10pt; text-align: center; line-height: 10mm; }
+.logo { position: absolute; left: 0; top: 0; }
+.template-header { font-size: 8pt; text-align: center; line-height: 4mm; }
+.template-footer { font-size: 8pt; line-height: 10mm; }
+.banner { background: #000; color: #fff; font-weight: bold; text-align: center; line-height: 5mm; margin: 0.5mm 0; }
+.watermark { position: fixed; top: 50%; left: 50%; transform: translate(-50%, -50%) rotate({{.WatermarkAt}}deg); font-size: 100pt; font-weight: bold; color: rgb(235, 235, 235); white-space: nowrap; z-index: -1; }
+h1 { font-size: 16pt; text-align: center; line-height: 10mm; margin: 0; }
+h2 { font-size: 10pt; margin: 5mm 0 0 0; }
+h2:first-of-type { margin-top: 0; }
+p { margin: 0; text-align: justify; }
+.code-line { font-weight: bold; text-align: center; line-height: 7mm; }
+.code { display: block; margin: 5mm auto; image-rendering: pixelated; }
+.caption { font-weight: bold; text-align: center; }
+.new-page { break-before: page; }
+.data { font-family: {{if .DataFont}}"PaperCrypt Data"{{else}}"PaperCrypt Mono", "Inconsolata", monospace{{end}}; font-size: {{.DataSize}}pt; line-height: {{.LineHeight}}mm; font-weight: bold; white-space: pre; }
+.data .index { font-weight: normal; }
+.data .shade { background: rgb(240, 240, 240); }
+.data .gap { height: 2.5mm; }
+.data .cell { display: inline-block; width: 5.5mm; height: 8mm; line-height: 8mm; border: 0.2mm solid #000; text-align: center; font-size: 16pt; box-sizing: border-box; }
+.data .space { display: inline-block; width: 2.75mm; }
+.data .stamping { margin-bottom: 2mm; }
+.command { font-size: 9pt; line-height: 4.5mm; white-space: pre; background: rgb(240, 240, 240); border: 0.2mm solid #000; padding: 0 1mm; margin-top: 1mm; }
+</style>
+</head>
+<body>
+{{- if .Watermark}}
+<div class="watermark">{{.Watermark}}</div>
+{{- end}}
+<table class="layout">
+<thead><tr><td>
+<div style="position: relative">
+{{- if .Logo}}
+<img class="logo" src="{{.Logo.Src}}" style="width: {{.Logo.Width}}mm; height: {{.Logo.Height}}mm" alt="">
+{{- end}}
+<div class="header-line mono">{{.HeaderLine}}</div>
+</div>
+{{- if .Header}}
+<div class="template-header">{{.Header}}</div>
+{{- end}}
+{{- if .Banner}}
+<div class="banner">{{.Banner}}</div>
+{{- end}}
+</td></tr></thead>
+<tfoot><tr><td>
+{{- if .Banner}}
+<div class="banner">{{.Banner}}</div>
+{{- end}}
+{{- if .Footer}}
+<div class="template-footer">{{.Footer}}</div>
+{{- end}}
+</td></tr></tfoot>
+<tbody><tr><td>
+<h1>{{.Heading}}</h1>
+{{- range .Sections}}
+<h2>{{.Heading}}</h2>
+{{- range .Paragraphs}}
+<p>{{.}}</p>
+{{- end}}
+{{- range .Code}}
+<div class="code-line mono">{{.}}</div>
+{{- end}}
+{{- end}}
+{{- range $i, $code := .Codes}}
+<div{{if $i}} class="new-page"{{end}}>
+{{- if $code.Caption}}
+<div class="caption">{{$code.Caption}}</div>
+{{- end}}
+<img class="code" src="{{$code.Src}}" style="width: {{$code.Width}}mm; height: {{$code.Height}}mm" alt="2D code">
+</div>
+{{- end}}
+<div class="data new-page">
+{{- range .HeaderLines}}
+<div># {{.}}</div>
+{{- end}}
+<div class="gap"></div><div class="gap"></div><div class="gap"></div><div class="gap"></div>
+{{- range .DataLines}}
+{{- if .Cells}}
+<div class="stamping">{{range .Cells}}{{if eq . " "}}<span class="space"></span>{{else}}<span class="cell">{{.}}</span>{{end}}{{end}}</div>
+{{- else}}
+<div{{if .Class}} class="{{.Class}}"{{end}}>{{.Text}}</div>
+{{- end}}
+{{- end}}
+</div>
+{{- if .Instructions}}
+<div class="new-page">
+<h1>{{.InstructionsHeading}}</h1>
+<p>{{.InstructionsIntro}}</p>
+{{- range $i, $step := .Instructions}}
+<h2>{{printf $.InstructionsStep (inc $i)}}</h2>
+<p>{{$step.Text}}</p>
+{{- if $step.Command}}
+<div class="command mono">{{$step.Command}}</div>
+{{- end}}
+{{- end}}
+</div>
+{{- end}}
+</td></tr></tbody>
+</table>
+</body>
+</html>
+`))
+
+// dataURI returns data as a data URI, for embedding into an HTML document.
+func dataURI(mediaType string, data []byte) template.URL {
+	return template.URL("data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data))
+}
+
+// GetHTML returns the document as a self-contained HTML page, for printing from a browser.
+// It holds the same content as GetPDF, with the 2D codes and fonts embedded as data URIs.
+func GetHTML(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error) {
+	text, err := p.GetText(opts.EncodingOptions())
+	if err != nil {
+		return nil, fmt.Errorf("error getting text content: %s", err)
+	}
+
+	headerLines, dataLines, err := splitDocumentText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	images, sizes, err := code2DImages(p, no2D, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	orientation := "portrait"
+	if opts.Page.Landscape {
+		orientation = "landscape"
+	}
+	width, height := opts.Page.Dimensions()
+
+	doc := htmlDocument{
+		Lang:        opts.Language.Tag(),
+		Title:       fmt.Sprintf("%s - %s", opts.Language.T(PDFHeading), p.SerialNumber),
+		PageSize:    strings.ToLower(opts.Page.Paper.String()) + " " + orientation,
+		Margin:      opts.Page.Margin(),
+		DataSize:    opts.dataFontSize(),
+		LineHeight:  max(5, 5*opts.dataFontSize()/PdfDataLineFontSize),
+		HeaderLine:  headerLine(p, opts),
+		Banner:      opts.Banner,
+		Watermark:   opts.Watermark,
+		WatermarkAt: -math.Atan2(height, width) * 180 / math.Pi,
+		Heading:     opts.Language.T(PDFHeading),
+		Sections:    documentSections(p, no2D, len(images), opts),
+		HeaderLines: headerLines,
+	}
+
+	for _, font := range [][]byte{PdfMonoFontRegularBytes, PdfMonoFontBoldBytes} {
+		if font != nil {
+			doc.MonoFonts = append(doc.MonoFonts, dataURI("font/ttf", font))
+		}
+	}
+	if opts.DataFont != nil {
+		doc.DataFont = dataURI("font/ttf", opts.DataFont)
+	}
+
+	if opts.Template != nil {
+		doc.Header, doc.Footer = opts.Template.Header, opts.Template.Footer
+		if opts.Template.logo != nil {
+			logoWidth, logoHeight := opts.Template.logoSize()
+			doc.Logo = &htmlImage{Src: dataURI("image/"+opts.Template.logoType, opts.Template.logo), Width: logoWidth, Height: logoHeight}
+		}
+	}
+
+	for i, img := range images {
+		code := htmlImage{Src: dataURI("image/png", img.Bytes()), Width: sizes[i], Height: sizes[i]}
+		if i > 0 {
+			code.Caption = opts.Language.Sprintf(PDFCodePartCaption, i+1, len(images))
+		}
+		doc.Codes = append(doc.Codes, code)
+	}
+
+	// every second line of a block is shaded, as in the PDF document
+	n := 0
+	for _, line := range dataLines {
+		switch {
+		case line == "":
+			doc.DataLines = append(doc.DataLines, htmlLine{Class: "gap"})
+			n = 0
+		case opts.Profile == OutputProfileStamping:
+			cells := make([]string, 0, len(line))
+			for _, c := range line {
+				cells = append(cells, string(c))
+			}
+			doc.DataLines = append(doc.DataLines, htmlLine{Cells: cells})
+		case core.IsColumnIndexLine([]byte(line)):
+			doc.DataLines = append(doc.DataLines, htmlLine{Text: line, Class: "index"})
+		default:
+			n++
+			class := ""
+			if n%2 == 1 {
+				class = "shade"
+			}
+			doc.DataLines = append(doc.DataLines, htmlLine{Text: line, Class: class})
+		}
+	}
+
+	if opts.Instructions {
+		doc.InstructionsHeading = opts.Language.T(PDFInstructionsHeading)
+		doc.InstructionsIntro = opts.Language.T(PDFInstructionsIntro)
+		doc.InstructionsStep = opts.Language.T(PDFInstructionsStep)
+		doc.Instructions = RecoveryInstructions(p, opts)
+	}
+
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, doc); err != nil {
+		return nil, errors.Join(errors.New("error generating HTML document"), err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestGetHTML(t *testing.T) {
+	pc := core.NewPaperCrypt("devel", []byte("hello"), "ABCDEF", "<b>purpose</b>", "", time.Now(), core.PaperCryptDataFormatRaw)
+	document, err := GetHTML(pc, false, TextOptions{Banner: "SECRET", Instructions: true})
+	if err != nil {
+		t.Fatalf("GetHTML failed with error %s", err)
+	}
+
+	html := string(document)
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"src=\"data:image/png;base64,",
+		"Sheet ID: ABCDEF",
+		"# Purpose: &lt;b&gt;purpose&lt;/b&gt;",
+		"<div class=\"banner\">SECRET</div>",
+		PDFInstructionsHeading,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML document should contain %q", want)
+		}
+	}
+	if strings.Contains(html, "<b>purpose</b>") {
+		t.Errorf("HTML document should escape its text")
+	}
+
+	document, err = GetHTML(pc, true, TextOptions{})
+	if err != nil {
+		t.Fatalf("GetHTML failed with error %s", err)
+	}
+	if strings.Contains(string(document), "data:image/png") {
+		t.Errorf("HTML document should not contain a 2D code")
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"strings"
+
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+const (
+	PDFInstructionsHeading = "Restoring this document without PaperCrypt"
+	PDFInstructionsIntro   = "These steps restore the data of this document using common tools only: a text editor, a Unix-like shell (Linux, macOS, or WSL on Windows), and GnuPG, or any other OpenPGP software. Commands are shown in boxes, type them as shown. The PaperCrypt CLI does all of this at once (`papercrypt decode`), and can also repair damaged lines, but is not required."
+	PDFInstructionsStep    = "Step %d"
+)
+
+// RecoveryStep is a single step of the instructions to restore a document without PaperCrypt.
+type RecoveryStep struct {
+	// Text explains the step.
+	Text string
+
+	// Command is a shell command carrying out the step, empty if the step is done by hand.
+	Command string
+}
+
+// RecoveryInstructions returns the steps to restore the document without PaperCrypt,
+// for the encoding and layout it is written in.
+func RecoveryInstructions(p *core.PaperCrypt, opts TextOptions) []RecoveryStep {
+	l := opts.Language
+	steps := []RecoveryStep{{
+		Text: l.T("Type the data block (the lines following the header lines starting with #) into a text file named data.txt, exactly as printed, one line per line. Empty lines between blocks may be left out."),
+	}}
+
+	// all encodings but the words are cleaned up the same way:
+	// column number lines, parity lines, line numbers, line checksums, and the final checksum line are removed,
+	// commands are split over several lines to fit the page
+	const clean = `grep -v -e '^ *#:' -e '^ *P[0-9]*:' -e '^ *$' data.txt |
+  sed -e '$d' -e 's/^ *[0-9]*: //' -e 's/ [^ ]*$//'`
+	cleanText := l.Sprintf("Remove everything but the data: the lines of column numbers (starting with #:), the parity lines (starting with P1:, P2:, ...), the line numbers, the %s checksum at the end of each line, and the last line, which holds the checksum of the whole block.", opts.LineChecksum)
+
+	switch opts.Encoding {
+	case core.PaperCryptDataEncodingBase32:
+		steps = append(steps,
+			RecoveryStep{Text: cleanText, Command: clean + " > data.b32"},
+			RecoveryStep{
+				Text: l.T("Decode the base 32 digits, line by line. They use Crockford's alphabet, which is translated to the standard base 32 alphabet first, and padded to a multiple of 8 digits."),
+				Command: `while read -r l; do
+  l=$(printf %s "$l" | tr -d ' ' | tr 0123456789ABCDEFGHJKMNPQRSTVWXYZ ABCDEFGHIJKLMNOPQRSTUVWXYZ234567)
+  while [ $((${#l} % 8)) -ne 0 ]; do l="$l="; done
+  printf '%s\n' "$l" | base32 -d
+done < data.b32 > data.bin`,
+			})
+	case core.PaperCryptDataEncodingBase64:
+		steps = append(steps,
+			RecoveryStep{Text: cleanText, Command: clean + " > data.b64"},
+			RecoveryStep{
+				Text: l.T("Decode the base 64 digits, line by line. Letters are case-sensitive."),
+				Command: `while read -r l; do
+  printf '%s\n' "$l" | tr -d ' ' | base64 -d
+done < data.b64 > data.bin`,
+			})
+	case core.PaperCryptDataEncodingArmor:
+		steps = append(steps, RecoveryStep{
+			Text:    l.T("Decode the armor block: leave out the BEGIN and END lines, any header lines (holding a colon), and the checksum line starting with =, and decode the remaining base 64 digits. Letters are case-sensitive."),
+			Command: `grep -v -e '^-----' -e '^=' -e ': ' data.txt | tr -d ' ' | base64 -d > data.bin`,
+		})
+	case core.PaperCryptDataEncodingWords:
+		steps = append(steps,
+			RecoveryStep{Text: l.T("Remove the line numbers, the last word of each line (a checksum word), and the last line (the checksum of the whole block).")},
+			RecoveryStep{Text: l.T("Look up each word in the PGP word list (https://en.wikipedia.org/wiki/PGP_word_list). Every word appears in one of its two columns only, its row gives a byte, written as two hexadecimal digits. Leave out the byte of the very first word, which holds the data format, and write the other bytes into a file named data.hex.")},
+			RecoveryStep{Text: l.T("Convert the hexadecimal digits to binary."), Command: "xxd -r -p data.hex > data.bin"})
+	default:
+		steps = append(steps,
+			RecoveryStep{Text: cleanText, Command: clean + " > data.hex"},
+			RecoveryStep{Text: l.T("Convert the hexadecimal digits to binary."), Command: "xxd -r -p data.hex > data.bin"})
+	}
+
+	steps = append(steps, RecoveryStep{
+		Text:    l.Sprintf("Check the result: the SHA-256 checksum must match the first checksum printed under \"%s\" (%s). If it does not, look for typing errors.", l.T(PDFSectionChecksumHeading), core.HeaderFieldSHA256),
+		Command: "sha256sum data.bin",
+	})
+
+	if p.DataFormat == core.PaperCryptDataFormatPGP {
+		// messages encrypted to a public key were made by other OpenPGP software (see generate --from-pgp),
+		// which does not compress the plaintext using gzip
+		if info, err := p.EncryptionInfo(); err == nil && info.KDF == "public key" {
+			steps = append(steps,
+				RecoveryStep{Text: l.T("Decompress the data (gzip), which yields an OpenPGP message, encrypted to a public key."), Command: "gunzip < data.bin > message.pgp"},
+				RecoveryStep{Text: l.T("Decrypt the message, using the secret key it is encrypted to."), Command: "gpg --decrypt message.pgp > restored"})
+		} else {
+			steps = append(steps,
+				RecoveryStep{Text: l.T("Decompress the data (gzip), which yields an OpenPGP message, encrypted using a passphrase."), Command: "gunzip < data.bin > message.pgp"},
+				RecoveryStep{Text: l.T("Decrypt the message, entering the passphrase when asked, and decompress the result (gzip) again."), Command: "gpg --decrypt message.pgp | gunzip > restored"})
+		}
+	} else {
+		steps = append(steps, RecoveryStep{Text: l.T("The data is not encrypted, only compressed (gzip). Decompress it."), Command: "gunzip < data.bin > restored"})
+	}
+
+	if len(p.PlaintextSHA256) > 0 {
+		steps = append(steps, RecoveryStep{
+			Text:    l.Sprintf("Check the restored data: its SHA-256 checksum must match the second checksum printed under \"%s\" (%s).", l.T(PDFSectionChecksumHeading), core.HeaderFieldPlaintextSHA256),
+			Command: "sha256sum restored",
+		})
+	}
+
+	return append(steps, RecoveryStep{Text: l.T("The file named restored now holds the original data.")})
+}
+
+// writeRecoveryInstructions adds a page holding the recovery instructions to the PDF document.
+func writeRecoveryInstructions(p *core.PaperCrypt, pdf *gofpdf.Fpdf, opts TextOptions) {
+	pdf.AddPage()
+
+	pdf.SetFont(PdfTextFont, "B", 16)
+	pdf.CellFormat(0, 10, opts.Language.T(PDFInstructionsHeading), "", 0, "C", false, 0, "")
+	pdf.Ln(10)
+
+	pdf.SetFont(PdfTextFont, "", 10)
+	pdf.MultiCell(0, 5, opts.Language.T(PDFInstructionsIntro), "", "", false)
+
+	for i, step := range RecoveryInstructions(p, opts) {
+		pdf.Ln(3)
+		pdf.SetFont(PdfTextFont, "B", 10)
+		pdf.CellFormat(0, 5, opts.Language.Sprintf(PDFInstructionsStep, i+1), "", 0, "L", false, 0, "")
+		pdf.Ln(5)
+
+		pdf.SetFont(PdfTextFont, "", 10)
+		pdf.MultiCell(0, 5, step.Text, "", "", false)
+
+		if step.Command != "" {
+			pdf.Ln(1)
+			pdf.SetFillColor(240, 240, 240)
+			pdf.SetFont(PdfMonoFont, "", 9)
+
+			// lines are never wrapped, as that would change the command, long ones are set in a smaller font instead
+			width, _ := pdf.GetPageSize()
+			left, _, right, _ := pdf.GetMargins()
+			available := width - left - right - 2*pdf.GetCellMargin()
+			size := 9.0
+			for _, line := range strings.Split(step.Command, "\n") {
+				if lineWidth := pdf.GetStringWidth(line); lineWidth > available {
+					size = min(size, 9*available/lineWidth)
+				}
+			}
+			pdf.SetFontSize(size)
+
+			pdf.MultiCell(0, size/2, step.Command, "1", "L", true)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func recoveryCommands(steps []RecoveryStep) string {
+	var commands []string
+	for _, step := range steps {
+		commands = append(commands, step.Command)
+	}
+
+	return strings.Join(commands, "\n")
+}
+
+func TestRecoveryInstructions(t *testing.T) {
+	tests := []struct {
+		encoding core.PaperCryptDataEncoding
+		want     string
+	}{
+		{core.PaperCryptDataEncodingBase16, "xxd -r -p data.hex"},
+		{core.PaperCryptDataEncodingBase32, "base32 -d"},
+		{core.PaperCryptDataEncodingBase64, "base64 -d"},
+		{core.PaperCryptDataEncodingArmor, "grep -v -e '^-----'"},
+		{core.PaperCryptDataEncodingWords, "xxd -r -p data.hex"},
+	}
+
+	pc := core.NewPaperCrypt("devel", []byte{0x01}, "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatPGP)
+	for _, tt := range tests {
+		commands := recoveryCommands(RecoveryInstructions(pc, TextOptions{Encoding: tt.encoding}))
+		if !strings.Contains(commands, tt.want) {
+			t.Errorf("Instructions for %s should contain %q, got: %s", tt.encoding, tt.want, commands)
+		}
+		if !strings.Contains(commands, "gpg --decrypt") {
+			t.Errorf("Instructions for %s should decrypt the message using gpg", tt.encoding)
+		}
+	}
+}
+
+func TestRecoveryInstructionsRaw(t *testing.T) {
+	pc := core.NewPaperCrypt("devel", []byte{0x01}, "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatRaw)
+	steps := RecoveryInstructions(pc, TextOptions{})
+	commands := recoveryCommands(steps)
+	if strings.Contains(commands, "gpg") {
+		t.Errorf("Instructions for raw data should not use gpg, got: %s", commands)
+	}
+	if strings.Contains(commands, "sha256sum restored") {
+		t.Errorf("Instructions should not check the restored data without a plaintext checksum")
+	}
+
+	pc.PlaintextSHA256 = []byte{0x01}
+	if got := RecoveryInstructions(pc, TextOptions{}); len(got) != len(steps)+1 || got[len(got)-2].Command != "sha256sum restored" {
+		t.Errorf("Instructions should check the restored data, got: %v", got)
+	}
+}
+
+func TestRecoveryInstructionsPublicKey(t *testing.T) {
+	key, err := crypto.GenerateKey("PaperCrypt", "test@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	keyRing, err := crypto.NewKeyRing(key)
+	if err != nil {
+		t.Fatalf("NewKeyRing failed with error %s", err)
+	}
+	encrypted, err := keyRing.Encrypt(crypto.NewPlainMessage([]byte("secret")), nil)
+	if err != nil {
+		t.Fatalf("Encrypt failed with error %s", err)
+	}
+
+	pc, err := core.NewPaperCryptFromPGPMessage(encrypted.GetBinary())
+	if err != nil {
+		t.Fatalf("NewPaperCryptFromPGPMessage failed with error %s", err)
+	}
+	commands := recoveryCommands(RecoveryInstructions(pc, TextOptions{}))
+	if !strings.Contains(commands, "gpg --decrypt message.pgp > restored") || strings.Contains(commands, "| gunzip") {
+		t.Errorf("Instructions should decrypt the message to the restored data, got: %s", commands)
+	}
+}
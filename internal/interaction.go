@@ -0,0 +1,45 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// NonInteractive is set by --non-interactive, and makes every prompt fail with ErrInteractionRequired,
+// instead of waiting for input that may never come.
+var NonInteractive bool
+
+// ErrInteractionRequired is returned in place of prompting, with NonInteractive set.
+var ErrInteractionRequired = core.WithCategory(core.ErrorCategoryInteraction, errors.New("input is required, but --non-interactive is set"))
+
+// RequireInteraction returns an error wrapping ErrInteractionRequired, naming what would have been prompted for,
+// if NonInteractive is set, and nil otherwise.
+func RequireInteraction(what string) error {
+	if !NonInteractive {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrInteractionRequired, what)
+}
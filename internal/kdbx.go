@@ -0,0 +1,811 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+	"golang.org/x/crypto/twofish"
+)
+
+// KeePass databases (KDBX 3.1, and 4) are read directly, without an export to plaintext on disk,
+// following the format written by KeePass 2, and KeePassXC.
+
+const (
+	kdbxSignature1 = 0x9AA2D903
+	kdbxSignature2 = 0xB54BFB67
+)
+
+// Fields of the outer header of a KeePass database.
+const (
+	kdbxHeaderEnd                 = 0
+	kdbxHeaderCipherID            = 2
+	kdbxHeaderCompression         = 3
+	kdbxHeaderMasterSeed          = 4
+	kdbxHeaderTransformSeed       = 5 // KDBX 3
+	kdbxHeaderTransformRounds     = 6 // KDBX 3
+	kdbxHeaderEncryptionIV        = 7
+	kdbxHeaderProtectedStreamKey  = 8  // KDBX 3
+	kdbxHeaderStreamStartBytes    = 9  // KDBX 3
+	kdbxHeaderInnerRandomStreamID = 10 // KDBX 3
+	kdbxHeaderKdfParameters       = 11 // KDBX 4
+)
+
+// Fields of the inner header of a KDBX 4 database.
+const (
+	kdbxInnerHeaderEnd             = 0
+	kdbxInnerHeaderRandomStreamID  = 1
+	kdbxInnerHeaderRandomStreamKey = 2
+)
+
+// Inner random streams, protecting the passwords, and other protected values, in the XML of the database.
+const (
+	kdbxInnerStreamSalsa20  = 2
+	kdbxInnerStreamChaCha20 = 3
+)
+
+var (
+	kdbxCipherAES      = mustDecodeUUID("31c1f2e6bf714350be5805216afc5aff")
+	kdbxCipherChaCha20 = mustDecodeUUID("d6038a2b8b6f4cb5a524339a31dbb59a")
+	kdbxCipherTwofish  = mustDecodeUUID("ad68f29f576f4bb9a36ad47af965346c")
+
+	kdbxKdfAES      = mustDecodeUUID("c9d9f39a628a4460bf740d08c18a4fea")
+	kdbxKdfArgon2d  = mustDecodeUUID("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdbxKdfArgon2id = mustDecodeUUID("9e298b1956db4773b23dfc3ec6f0a1e6")
+
+	// kdbxSalsa20Nonce is the fixed nonce of the Salsa20 inner random stream.
+	kdbxSalsa20Nonce = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+)
+
+func mustDecodeUUID(s string) []byte {
+	uuid, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return uuid
+}
+
+// KeePassKey is the composite key of a KeePass database, its master password, its key file, or both.
+type KeePassKey struct {
+	Password []byte
+	// KeyFile is the content of the key file.
+	KeyFile []byte
+}
+
+// composite returns the hash of the parts of the key, the key all other keys are derived from.
+func (k KeePassKey) composite() ([]byte, error) {
+	if len(k.Password) == 0 && len(k.KeyFile) == 0 {
+		return nil, errors.New("the master password, or key file, of the KeePass database is required")
+	}
+
+	h := sha256.New()
+	if len(k.Password) > 0 {
+		sum := sha256.Sum256(k.Password)
+		h.Write(sum[:])
+	}
+	if len(k.KeyFile) > 0 {
+		h.Write(keePassKeyFileHash(k.KeyFile))
+	}
+
+	return h.Sum(nil), nil
+}
+
+// keePassKeyFileXML is a key file in the XML format, version 1.0 (base64), or 2.0 (hex, with a hash of the key).
+type keePassKeyFileXML struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Version string   `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+// keePassKeyFileHash returns the key of a key file: the key in an XML key file, a key of 32 bytes, or 64 hex digits,
+// or else the hash of any other file.
+func keePassKeyFileHash(keyFile []byte) []byte {
+	var keyXML keePassKeyFileXML
+	if xml.Unmarshal(keyFile, &keyXML) == nil {
+		var key []byte
+		var err error
+		if strings.HasPrefix(keyXML.Version, "2.") {
+			key, err = hex.DecodeString(strings.Join(strings.Fields(keyXML.Data.Value), ""))
+		} else {
+			key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(keyXML.Data.Value))
+		}
+		if err == nil && len(key) > 0 {
+			return key
+		}
+	}
+
+	if len(keyFile) == 32 {
+		return keyFile
+	}
+	if len(keyFile) == 64 {
+		if key, err := hex.DecodeString(string(keyFile)); err == nil {
+			return key
+		}
+	}
+
+	sum := sha256.Sum256(keyFile)
+	return sum[:]
+}
+
+// kdbxHeader is the outer header of a KeePass database.
+type kdbxHeader struct {
+	cipherID   []byte
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+
+	// KDBX 3
+	transformSeed      []byte
+	transformRounds    uint64
+	protectedStreamKey []byte
+	streamStartBytes   []byte
+	innerStreamID      uint32
+
+	// KDBX 4
+	kdfParameters map[string][]byte
+
+	// length is the length of the header, in bytes.
+	length int
+}
+
+// ReadKeePassDatabase reads the entries of a KeePass database (KDBX 3.1, or 4), unlocking it with the key.
+// Entries in the recycle bin are left out, as are the earlier versions of entries.
+func ReadKeePassDatabase(data []byte, key KeePassKey) ([]VaultEntry, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint32(data[0:]) != kdbxSignature1 || binary.LittleEndian.Uint32(data[4:]) != kdbxSignature2 {
+		return nil, errors.New("not a KeePass database, it must be a .kdbx file")
+	}
+	major := binary.LittleEndian.Uint16(data[10:])
+	if major != 3 && major != 4 {
+		return nil, fmt.Errorf("unsupported KeePass database version %d, only KDBX 3.1, and 4 are supported", major)
+	}
+
+	header, err := readKDBXHeader(data, major)
+	if err != nil {
+		return nil, err
+	}
+	compositeKey, err := key.composite()
+	if err != nil {
+		return nil, err
+	}
+
+	var transformedKey []byte
+	if major == 3 {
+		transformedKey, err = kdbxAESKDF(compositeKey, header.transformSeed, header.transformRounds)
+	} else {
+		transformedKey, err = kdbxKDF(compositeKey, header.kdfParameters)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seeded := sha256.Sum256(append(append([]byte{}, header.masterSeed...), transformedKey...))
+	encryptionKey := seeded[:]
+
+	var payload []byte
+	var stream cipher.Stream
+	if major == 3 {
+		payload, stream, err = readKDBX3Payload(data[header.length:], header, encryptionKey)
+	} else {
+		hmacKey := sha512.Sum512(append(append(append([]byte{}, header.masterSeed...), transformedKey...), 1))
+		payload, stream, err = readKDBX4Payload(data, header, encryptionKey, hmacKey[:])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return readKeePassXML(payload, stream)
+}
+
+// readKDBXHeader reads the outer header, of fields of a type, a length (of 2 bytes in KDBX 3, and 4 in KDBX 4),
+// and a value, ending with an end of header field.
+func readKDBXHeader(data []byte, major uint16) (*kdbxHeader, error) {
+	header := &kdbxHeader{innerStreamID: kdbxInnerStreamSalsa20}
+	errCorrupt := errors.New("the header of the KeePass database is corrupted")
+
+	offset := 12
+	for {
+		if offset+1 > len(data) {
+			return nil, errCorrupt
+		}
+		fieldType := data[offset]
+		offset++
+
+		var length int
+		if major == 3 {
+			if offset+2 > len(data) {
+				return nil, errCorrupt
+			}
+			length = int(binary.LittleEndian.Uint16(data[offset:]))
+			offset += 2
+		} else {
+			if offset+4 > len(data) {
+				return nil, errCorrupt
+			}
+			length = int(binary.LittleEndian.Uint32(data[offset:]))
+			offset += 4
+		}
+		if length < 0 || offset+length > len(data) {
+			return nil, errCorrupt
+		}
+		value := data[offset : offset+length]
+		offset += length
+
+		switch fieldType {
+		case kdbxHeaderEnd:
+			header.length = offset
+			if header.cipherID == nil || header.masterSeed == nil || header.iv == nil {
+				return nil, errCorrupt
+			}
+			if major == 3 && (header.transformSeed == nil || header.streamStartBytes == nil) {
+				return nil, errCorrupt
+			}
+			if major == 4 && header.kdfParameters == nil {
+				return nil, errCorrupt
+			}
+			return header, nil
+		case kdbxHeaderCipherID:
+			header.cipherID = value
+		case kdbxHeaderCompression:
+			if len(value) != 4 {
+				return nil, errCorrupt
+			}
+			header.compressed = binary.LittleEndian.Uint32(value) == 1
+		case kdbxHeaderMasterSeed:
+			header.masterSeed = value
+		case kdbxHeaderTransformSeed:
+			header.transformSeed = value
+		case kdbxHeaderTransformRounds:
+			if len(value) != 8 {
+				return nil, errCorrupt
+			}
+			header.transformRounds = binary.LittleEndian.Uint64(value)
+		case kdbxHeaderEncryptionIV:
+			header.iv = value
+		case kdbxHeaderProtectedStreamKey:
+			header.protectedStreamKey = value
+		case kdbxHeaderStreamStartBytes:
+			header.streamStartBytes = value
+		case kdbxHeaderInnerRandomStreamID:
+			if len(value) != 4 {
+				return nil, errCorrupt
+			}
+			header.innerStreamID = binary.LittleEndian.Uint32(value)
+		case kdbxHeaderKdfParameters:
+			parameters, err := readVariantDictionary(value)
+			if err != nil {
+				return nil, errors.Join(errCorrupt, err)
+			}
+			header.kdfParameters = parameters
+		}
+	}
+}
+
+// readVariantDictionary reads the KDF parameters of KDBX 4, returning the raw values by their names.
+func readVariantDictionary(data []byte) (map[string][]byte, error) {
+	if len(data) < 2 || data[1] != 1 {
+		return nil, errors.New("unsupported KDF parameters version")
+	}
+
+	parameters := make(map[string][]byte)
+	offset := 2
+	for offset < len(data) {
+		valueType := data[offset]
+		offset++
+		if valueType == 0 {
+			return parameters, nil
+		}
+
+		var fields [2][]byte
+		for i := range fields {
+			if offset+4 > len(data) {
+				return nil, errors.New("truncated KDF parameters")
+			}
+			length := int(binary.LittleEndian.Uint32(data[offset:]))
+			offset += 4
+			if length < 0 || offset+length > len(data) {
+				return nil, errors.New("truncated KDF parameters")
+			}
+			fields[i] = data[offset : offset+length]
+			offset += length
+		}
+		parameters[string(fields[0])] = fields[1]
+	}
+
+	return nil, errors.New("truncated KDF parameters")
+}
+
+// kdbxUint reads an unsigned integer KDF parameter, of 4, or 8 bytes.
+func kdbxUint(parameters map[string][]byte, name string) (uint64, error) {
+	switch value := parameters[name]; len(value) {
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(value)), nil
+	case 8:
+		return binary.LittleEndian.Uint64(value), nil
+	default:
+		return 0, fmt.Errorf("the KDF parameter %s is missing", name)
+	}
+}
+
+// kdbxKDF derives the transformed key of KDBX 4, using AES-KDF, Argon2d, or Argon2id.
+func kdbxKDF(compositeKey []byte, parameters map[string][]byte) ([]byte, error) {
+	uuid := parameters["$UUID"]
+	if bytes.Equal(uuid, kdbxKdfAES) {
+		rounds, err := kdbxUint(parameters, "R")
+		if err != nil {
+			return nil, err
+		}
+		return kdbxAESKDF(compositeKey, parameters["S"], rounds)
+	}
+	if !bytes.Equal(uuid, kdbxKdfArgon2d) && !bytes.Equal(uuid, kdbxKdfArgon2id) {
+		return nil, fmt.Errorf("unsupported key derivation function %x", uuid)
+	}
+
+	var values [4]uint64
+	for i, name := range []string{"I", "M", "P", "V"} {
+		value, err := kdbxUint(parameters, name)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	iterations, memory, parallelism, version := values[0], values[1]/1024, values[2], values[3]
+	if version != argon2Version {
+		return nil, fmt.Errorf("unsupported Argon2 version 0x%x, only 0x%x is supported", version, argon2Version)
+	}
+	if iterations > 0xFFFFFFFF || memory > 0xFFFFFFFF || parallelism < 1 || parallelism > 0xFF {
+		return nil, errors.New("invalid Argon2 parameters")
+	}
+	salt, secret, data := parameters["S"], parameters["K"], parameters["A"]
+
+	if bytes.Equal(uuid, kdbxKdfArgon2d) {
+		return argon2dKey(compositeKey, salt, secret, data, uint32(iterations), uint32(memory), uint8(parallelism), 32), nil
+	}
+	if len(secret) > 0 || len(data) > 0 {
+		return nil, errors.New("Argon2id with a secret key, or associated data, is not supported")
+	}
+	return argon2.IDKey(compositeKey, salt, uint32(iterations), uint32(memory), uint8(parallelism), 32), nil
+}
+
+// kdbxAESKDF derives the transformed key using AES-KDF, encrypting the key rounds times with the seed as key.
+func kdbxAESKDF(compositeKey, seed []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, errors.Join(errors.New("invalid AES-KDF seed"), err)
+	}
+
+	key := append([]byte{}, compositeKey...)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(key[:aes.BlockSize], key[:aes.BlockSize])
+		block.Encrypt(key[aes.BlockSize:], key[aes.BlockSize:])
+	}
+
+	sum := sha256.Sum256(key)
+	return sum[:], nil
+}
+
+// kdbxDecrypt decrypts the payload with the cipher of the database.
+func kdbxDecrypt(cipherID, key, iv, data []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+	switch {
+	case bytes.Equal(cipherID, kdbxCipherChaCha20):
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, errors.Join(errors.New("invalid ChaCha20 parameters"), err)
+		}
+		plaintext := make([]byte, len(data))
+		stream.XORKeyStream(plaintext, data)
+		return plaintext, nil
+	case bytes.Equal(cipherID, kdbxCipherAES):
+		block, err = aes.NewCipher(key)
+	case bytes.Equal(cipherID, kdbxCipherTwofish):
+		block, err = twofish.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("unsupported cipher %x", cipherID)
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("invalid cipher parameters"), err)
+	}
+
+	errDecryption := core.WithCategory(core.ErrorCategoryPassphrase, errors.New("error decrypting the KeePass database, check the master password, and key file"))
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errDecryption
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding < 1 || padding > block.BlockSize() || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errDecryption
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// readKDBX3Payload decrypts the payload of a KDBX 3.1 database, starting with the stream start bytes,
+// followed by blocks of an index, their SHA-256 hash, length, and data.
+func readKDBX3Payload(data []byte, header *kdbxHeader, key []byte) ([]byte, cipher.Stream, error) {
+	plaintext, err := kdbxDecrypt(header.cipherID, key, header.iv, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.HasPrefix(plaintext, header.streamStartBytes) {
+		return nil, nil, core.WithCategory(core.ErrorCategoryPassphrase, errors.New("wrong master password, or key file, for the KeePass database"))
+	}
+	plaintext = plaintext[len(header.streamStartBytes):]
+
+	var payload []byte
+	for index := 0; ; index++ {
+		if len(plaintext) < 40 {
+			return nil, nil, errors.New("the KeePass database is truncated")
+		}
+		hash, length := plaintext[4:36], int(binary.LittleEndian.Uint32(plaintext[36:]))
+		plaintext = plaintext[40:]
+		if length == 0 {
+			break
+		}
+		if length < 0 || length > len(plaintext) {
+			return nil, nil, errors.New("the KeePass database is truncated")
+		}
+		if sum := sha256.Sum256(plaintext[:length]); !bytes.Equal(sum[:], hash) {
+			return nil, nil, core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("block %d of the KeePass database is corrupted", index))
+		}
+		payload = append(payload, plaintext[:length]...)
+		plaintext = plaintext[length:]
+	}
+
+	if header.compressed {
+		if payload, err = gunzip(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+	stream, err := newKDBXInnerStream(header.innerStreamID, header.protectedStreamKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, stream, nil
+}
+
+// readKDBX4Payload checks the header, and decrypts the payload of a KDBX 4 database: blocks of their HMAC,
+// length, and data, followed, once decrypted, by the inner header.
+func readKDBX4Payload(data []byte, header *kdbxHeader, key, hmacKey []byte) ([]byte, cipher.Stream, error) {
+	if len(data) < header.length+64 {
+		return nil, nil, errors.New("the KeePass database is truncated")
+	}
+	headerData, rest := data[:header.length], data[header.length:]
+	if sum := sha256.Sum256(headerData); !bytes.Equal(sum[:], rest[:32]) {
+		return nil, nil, core.WithCategory(core.ErrorCategoryChecksum, errors.New("the header of the KeePass database is corrupted"))
+	}
+	if !hmac.Equal(kdbxHMAC(hmacKey, ^uint64(0), headerData), rest[32:64]) {
+		return nil, nil, core.WithCategory(core.ErrorCategoryPassphrase, errors.New("wrong master password, or key file, for the KeePass database"))
+	}
+	rest = rest[64:]
+
+	var ciphertext []byte
+	for index := uint64(0); ; index++ {
+		if len(rest) < 36 {
+			return nil, nil, errors.New("the KeePass database is truncated")
+		}
+		mac, length := rest[:32], int(binary.LittleEndian.Uint32(rest[32:]))
+		if length < 0 || 36+length > len(rest) {
+			return nil, nil, errors.New("the KeePass database is truncated")
+		}
+		if !hmac.Equal(kdbxHMAC(hmacKey, index, rest[32:36+length]), mac) {
+			return nil, nil, core.WithCategory(core.ErrorCategoryChecksum, fmt.Errorf("block %d of the KeePass database is corrupted", index))
+		}
+		if length == 0 {
+			break
+		}
+		ciphertext = append(ciphertext, rest[36:36+length]...)
+		rest = rest[36+length:]
+	}
+
+	payload, err := kdbxDecrypt(header.cipherID, key, header.iv, ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.compressed {
+		if payload, err = gunzip(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the inner header, of fields of a type, a length of 4 bytes, and a value, holds the inner random stream
+	var streamID uint32
+	var streamKey []byte
+	for {
+		if len(payload) < 5 {
+			return nil, nil, errors.New("the inner header of the KeePass database is corrupted")
+		}
+		fieldType, length := payload[0], int(binary.LittleEndian.Uint32(payload[1:]))
+		if length < 0 || 5+length > len(payload) {
+			return nil, nil, errors.New("the inner header of the KeePass database is corrupted")
+		}
+		value := payload[5 : 5+length]
+		payload = payload[5+length:]
+
+		if fieldType == kdbxInnerHeaderEnd {
+			break
+		}
+		switch fieldType {
+		case kdbxInnerHeaderRandomStreamID:
+			if length != 4 {
+				return nil, nil, errors.New("the inner header of the KeePass database is corrupted")
+			}
+			streamID = binary.LittleEndian.Uint32(value)
+		case kdbxInnerHeaderRandomStreamKey:
+			streamKey = value
+		}
+	}
+
+	stream, err := newKDBXInnerStream(streamID, streamKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, stream, nil
+}
+
+// kdbxHMAC returns the HMAC-SHA-256 of the data of a block, with the key of the block at index.
+// The data of the blocks of the payload is preceded by its index.
+func kdbxHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	var indexBytes [8]byte
+	binary.LittleEndian.PutUint64(indexBytes[:], index)
+	blockKey := sha512.Sum512(append(indexBytes[:], hmacKey...))
+
+	mac := hmac.New(sha256.New, blockKey[:])
+	if index != ^uint64(0) {
+		mac.Write(indexBytes[:])
+	}
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Join(errors.New("error decompressing the KeePass database"), err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Join(errors.New("error decompressing the KeePass database"), err)
+	}
+
+	return decompressed, nil
+}
+
+// newKDBXInnerStream returns the inner random stream, protected values are XORed with.
+func newKDBXInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case kdbxInnerStreamSalsa20:
+		stream := &salsa20Stream{key: sha256.Sum256(key)}
+		copy(stream.counter[:], kdbxSalsa20Nonce)
+		return stream, nil
+	case kdbxInnerStreamChaCha20:
+		sum := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	default:
+		return nil, fmt.Errorf("unsupported inner random stream %d", id)
+	}
+}
+
+// salsa20Stream is the Salsa20 key stream, as a cipher.Stream, which golang.org/x/crypto/salsa20 does not provide.
+type salsa20Stream struct {
+	key [32]byte
+	// counter is the nonce, followed by the block counter
+	counter [16]byte
+	block   [64]byte
+	used    int
+}
+
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.used == 0 || s.used == len(s.block) {
+			var zero [64]byte
+			salsa.XORKeyStream(s.block[:], zero[:], &s.counter, &s.key)
+			binary.LittleEndian.PutUint64(s.counter[8:], binary.LittleEndian.Uint64(s.counter[8:])+1)
+			s.used = 0
+		}
+		dst[i] = src[i] ^ s.block[s.used]
+		s.used++
+	}
+}
+
+// keePassGroup is a group of the database, while it is read.
+type keePassGroup struct {
+	path     string
+	recycled bool
+}
+
+// readKeePassXML reads the entries of the XML of a KeePass database. Protected values are decrypted with the stream,
+// in the order they appear in, including those of the earlier versions of entries, and in the recycle bin.
+func readKeePassXML(data []byte, stream cipher.Stream) ([]VaultEntry, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		entries           []VaultEntry
+		elements          []string
+		groups            []keePassGroup
+		entry             *VaultEntry
+		historyDepth      int
+		text              strings.Builder
+		protected         bool
+		fieldKey          string
+		fieldValue        string
+		recycleBinUUID    string
+		recycleBinEnabled = true
+	)
+	parent := func() string {
+		if len(elements) < 2 {
+			return ""
+		}
+		return elements[len(elements)-2]
+	}
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading the entries of the KeePass database"), err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			elements = append(elements, token.Name.Local)
+			text.Reset()
+			protected = false
+			for _, attr := range token.Attr {
+				if attr.Name.Local == "Protected" && attr.Value == "True" {
+					protected = true
+				}
+			}
+
+			switch token.Name.Local {
+			case "Group":
+				group := keePassGroup{}
+				if len(groups) > 0 {
+					group.recycled = groups[len(groups)-1].recycled
+				}
+				groups = append(groups, group)
+			case "History":
+				historyDepth++
+			case "Entry":
+				if historyDepth == 0 {
+					entry = &VaultEntry{}
+				}
+			}
+		case xml.CharData:
+			text.Write(token)
+		case xml.EndElement:
+			value := text.String()
+			text.Reset()
+			if protected {
+				ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+				if err != nil {
+					return nil, errors.Join(errors.New("error reading a protected value of the KeePass database"), err)
+				}
+				stream.XORKeyStream(ciphertext, ciphertext)
+				value = string(ciphertext)
+				protected = false
+			}
+
+			switch name := token.Name.Local; {
+			case name == "RecycleBinUUID" && parent() == "Meta":
+				recycleBinUUID = value
+			case name == "RecycleBinEnabled" && parent() == "Meta":
+				recycleBinEnabled = value == "True"
+			case name == "UUID" && parent() == "Group":
+				if recycleBinEnabled && value != "" && value == recycleBinUUID {
+					groups[len(groups)-1].recycled = true
+				}
+			case name == "Name" && parent() == "Group" && len(groups) > 1:
+				// the root group is left out of the path
+				groups[len(groups)-1].path = value
+				if previous := groups[len(groups)-2].path; previous != "" {
+					groups[len(groups)-1].path = previous + "/" + value
+				}
+			case name == "Key" && parent() == "String":
+				fieldKey = value
+			case name == "Value" && parent() == "String":
+				fieldValue = value
+			case name == "String" && parent() == "Entry" && historyDepth == 0 && entry != nil:
+				setKeePassField(entry, fieldKey, fieldValue)
+				fieldKey, fieldValue = "", ""
+			case name == "Tags" && parent() == "Entry" && historyDepth == 0 && entry != nil:
+				for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						entry.Tags = append(entry.Tags, tag)
+					}
+				}
+			case name == "Entry" && historyDepth == 0 && entry != nil:
+				if len(groups) > 0 && !groups[len(groups)-1].recycled {
+					entry.Folder = groups[len(groups)-1].path
+					entry.Type = "note"
+					if entry.Username != "" || entry.Password != "" || len(entry.URLs) > 0 {
+						entry.Type = "login"
+					}
+					entries = append(entries, *entry)
+				}
+				entry = nil
+			case name == "History":
+				historyDepth--
+			case name == "Group":
+				groups = groups[:len(groups)-1]
+			}
+
+			elements = elements[:len(elements)-1]
+		}
+	}
+
+	return entries, nil
+}
+
+// setKeePassField sets a string field of an entry, the standard fields, and the one-time password secret
+// of KeePassXC (otp), or KeePass (TimeOtp-Secret-Base32), to their fields of the entry, other fields are added to them.
+func setKeePassField(entry *VaultEntry, key, value string) {
+	switch key {
+	case "Title":
+		entry.Name = value
+	case "UserName":
+		entry.Username = value
+	case "Password":
+		entry.Password = value
+	case "URL":
+		if value != "" {
+			entry.URLs = append(entry.URLs, value)
+		}
+	case "Notes":
+		entry.Notes = value
+	case "otp", "TimeOtp-Secret-Base32":
+		if entry.TOTP == "" {
+			entry.TOTP = value
+			return
+		}
+		entry.Fields = appendField(entry.Fields, key, value)
+	default:
+		entry.Fields = appendField(entry.Fields, key, value)
+	}
+}
@@ -0,0 +1,407 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20"
+)
+
+// keePassTestXML is the XML of a test database, with the protected values left to fill in, in order.
+// The earlier version of Bank, and the entry in the recycle bin, are to be left out.
+const keePassTestXML = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Meta>
+		<RecycleBinEnabled>True</RecycleBinEnabled>
+		<RecycleBinUUID>cmVjeWNsZWJpbnJlY3ljbGU=</RecycleBinUUID>
+	</Meta>
+	<Root>
+		<Group>
+			<UUID>cm9vdHJvb3Ryb290cm9vdA==</UUID>
+			<Name>Root</Name>
+			<Entry>
+				<UUID>bWFpbG1haWxtYWlsbWFpbA==</UUID>
+				<String><Key>Title</Key><Value>Mail</Value></String>
+				<String><Key>UserName</Key><Value>owner</Value></String>
+				<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+				<String><Key>URL</Key><Value>https://mail.example</Value></String>
+			</Entry>
+			<Group>
+				<UUID>cmVjeWNsZWJpbnJlY3ljbGU=</UUID>
+				<Name>Recycle Bin</Name>
+				<Entry>
+					<String><Key>Title</Key><Value>Deleted</Value></String>
+					<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+				</Entry>
+			</Group>
+			<Group>
+				<UUID>YmFua2JhbmtiYW5rYmFuaw==</UUID>
+				<Name>Banking</Name>
+				<Group>
+					<UUID>Y2FyZGNhcmRjYXJkY2FyZA==</UUID>
+					<Name>Cards</Name>
+					<Entry>
+						<String><Key>Title</Key><Value>Bank</Value></String>
+						<String><Key>UserName</Key><Value>customer</Value></String>
+						<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+						<String><Key>otp</Key><Value Protected="True">%s</Value></String>
+						<String><Key>PIN</Key><Value Protected="True">%s</Value></String>
+						<String><Key>Notes</Key><Value>Call before travelling</Value></String>
+						<Tags>Finance;Important</Tags>
+						<History>
+							<Entry>
+								<String><Key>Title</Key><Value>Old Bank</Value></String>
+								<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+							</Entry>
+						</History>
+					</Entry>
+				</Group>
+			</Group>
+			<Entry>
+				<String><Key>Title</Key><Value>Safe</Value></String>
+				<String><Key>Notes</Key><Value Protected="True">%s</Value></String>
+			</Entry>
+		</Group>
+		<DeletedObjects />
+	</Root>
+</KeePassFile>`
+
+var keePassTestValues = []string{"mail password", "deleted password", "bank password", "otpauth://totp/Bank?secret=JBSWY3DPEHPK3PXP", "1234", "old password", "12-34-56"}
+
+// keePassTestPayload returns the XML of the test database, its values protected with the inner random stream.
+func keePassTestPayload(t *testing.T, streamID uint32, streamKey []byte) []byte {
+	t.Helper()
+
+	stream, err := newKDBXInnerStream(streamID, streamKey)
+	if err != nil {
+		t.Fatalf("newKDBXInnerStream failed with error %s", err)
+	}
+	values := make([]any, len(keePassTestValues))
+	for i, value := range keePassTestValues {
+		protected := []byte(value)
+		stream.XORKeyStream(protected, protected)
+		values[i] = base64.StdEncoding.EncodeToString(protected)
+	}
+
+	return []byte(fmt.Sprintf(keePassTestXML, values...))
+}
+
+// kdbxTestCompress compresses the payload with gzip.
+func kdbxTestCompress(t *testing.T, payload []byte) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(payload); err != nil {
+		t.Fatalf("Write failed with error %s", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed with error %s", err)
+	}
+
+	return compressed.Bytes()
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Read failed with error %s", err)
+	}
+
+	return b
+}
+
+// kdbxTestField appends a header field, with a length of 2 bytes in KDBX 3, and 4 bytes in KDBX 4.
+func kdbxTestField(header []byte, major int, fieldType byte, value []byte) []byte {
+	header = append(header, fieldType)
+	if major == 3 {
+		header = binary.LittleEndian.AppendUint16(header, uint16(len(value)))
+	} else {
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(value)))
+	}
+
+	return append(header, value...)
+}
+
+// kdbxTestEncrypt encrypts the payload with AES-CBC, or ChaCha20.
+func kdbxTestEncrypt(t *testing.T, cipherID, key, iv, payload []byte) []byte {
+	t.Helper()
+
+	if bytes.Equal(cipherID, kdbxCipherChaCha20) {
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			t.Fatalf("NewUnauthenticatedCipher failed with error %s", err)
+		}
+		ciphertext := make([]byte, len(payload))
+		stream.XORKeyStream(ciphertext, payload)
+		return ciphertext
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher failed with error %s", err)
+	}
+	padding := aes.BlockSize - len(payload)%aes.BlockSize
+	padded := append(append([]byte{}, payload...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	return padded
+}
+
+// kdbx3TestDatabase returns the test database in the KDBX 3.1 format, encrypted with AES,
+// its values protected with Salsa20.
+func kdbx3TestDatabase(t *testing.T, key KeePassKey) []byte {
+	t.Helper()
+
+	masterSeed, transformSeed, iv, streamKey, startBytes := randomBytes(t, 32), randomBytes(t, 32), randomBytes(t, 16), randomBytes(t, 32), randomBytes(t, 32)
+	const rounds = 100
+
+	data := binary.LittleEndian.AppendUint32(nil, kdbxSignature1)
+	data = binary.LittleEndian.AppendUint32(data, kdbxSignature2)
+	data = binary.LittleEndian.AppendUint32(data, 0x00030001)
+	data = kdbxTestField(data, 3, kdbxHeaderCipherID, kdbxCipherAES)
+	data = kdbxTestField(data, 3, kdbxHeaderCompression, binary.LittleEndian.AppendUint32(nil, 1))
+	data = kdbxTestField(data, 3, kdbxHeaderMasterSeed, masterSeed)
+	data = kdbxTestField(data, 3, kdbxHeaderTransformSeed, transformSeed)
+	data = kdbxTestField(data, 3, kdbxHeaderTransformRounds, binary.LittleEndian.AppendUint64(nil, rounds))
+	data = kdbxTestField(data, 3, kdbxHeaderEncryptionIV, iv)
+	data = kdbxTestField(data, 3, kdbxHeaderProtectedStreamKey, streamKey)
+	data = kdbxTestField(data, 3, kdbxHeaderStreamStartBytes, startBytes)
+	data = kdbxTestField(data, 3, kdbxHeaderInnerRandomStreamID, binary.LittleEndian.AppendUint32(nil, kdbxInnerStreamSalsa20))
+	data = kdbxTestField(data, 3, kdbxHeaderEnd, []byte("\r\n\r\n"))
+
+	compositeKey, err := key.composite()
+	if err != nil {
+		t.Fatalf("composite failed with error %s", err)
+	}
+	transformedKey, err := kdbxAESKDF(compositeKey, transformSeed, rounds)
+	if err != nil {
+		t.Fatalf("kdbxAESKDF failed with error %s", err)
+	}
+	encryptionKey := sha256.Sum256(append(append([]byte{}, masterSeed...), transformedKey...))
+
+	// the payload is a single block, followed by the empty block ending it
+	payload := kdbxTestCompress(t, keePassTestPayload(t, kdbxInnerStreamSalsa20, streamKey))
+	hash := sha256.Sum256(payload)
+	plaintext := append(append([]byte{}, startBytes...), binary.LittleEndian.AppendUint32(nil, 0)...)
+	plaintext = append(append(plaintext, hash[:]...), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	plaintext = append(plaintext, payload...)
+	plaintext = append(append(binary.LittleEndian.AppendUint32(plaintext, 1), make([]byte, 32)...), binary.LittleEndian.AppendUint32(nil, 0)...)
+
+	return append(data, kdbxTestEncrypt(t, kdbxCipherAES, encryptionKey[:], iv, plaintext)...)
+}
+
+// kdbx4TestDatabase returns the test database in the KDBX 4 format, encrypted with the cipher, its key derived
+// with the KDF, and its values protected with ChaCha20.
+func kdbx4TestDatabase(t *testing.T, key KeePassKey, cipherID []byte, kdf map[string][]byte) []byte {
+	t.Helper()
+
+	masterSeed, streamKey := randomBytes(t, 32), randomBytes(t, 64)
+	iv := randomBytes(t, 16)
+	if bytes.Equal(cipherID, kdbxCipherChaCha20) {
+		iv = iv[:12]
+	}
+
+	// the KDF parameters, a variant dictionary of byte arrays, and 64-bit integers
+	parameters := []byte{0x00, 0x01}
+	for name, value := range kdf {
+		valueType := byte(0x42)
+		if len(value) == 8 {
+			valueType = 0x05
+		}
+		parameters = append(parameters, valueType)
+		parameters = binary.LittleEndian.AppendUint32(parameters, uint32(len(name)))
+		parameters = append(parameters, name...)
+		parameters = binary.LittleEndian.AppendUint32(parameters, uint32(len(value)))
+		parameters = append(parameters, value...)
+	}
+	parameters = append(parameters, 0)
+
+	header := binary.LittleEndian.AppendUint32(nil, kdbxSignature1)
+	header = binary.LittleEndian.AppendUint32(header, kdbxSignature2)
+	header = binary.LittleEndian.AppendUint32(header, 0x00040000)
+	header = kdbxTestField(header, 4, kdbxHeaderCipherID, cipherID)
+	header = kdbxTestField(header, 4, kdbxHeaderCompression, binary.LittleEndian.AppendUint32(nil, 1))
+	header = kdbxTestField(header, 4, kdbxHeaderMasterSeed, masterSeed)
+	header = kdbxTestField(header, 4, kdbxHeaderEncryptionIV, iv)
+	header = kdbxTestField(header, 4, kdbxHeaderKdfParameters, parameters)
+	header = kdbxTestField(header, 4, kdbxHeaderEnd, []byte("\r\n\r\n"))
+
+	compositeKey, err := key.composite()
+	if err != nil {
+		t.Fatalf("composite failed with error %s", err)
+	}
+	transformedKey, err := kdbxKDF(compositeKey, kdf)
+	if err != nil {
+		t.Fatalf("kdbxKDF failed with error %s", err)
+	}
+	seeded := append(append([]byte{}, masterSeed...), transformedKey...)
+	encryptionKey := sha256.Sum256(seeded)
+	hmacKey := sha512.Sum512(append(seeded, 1))
+
+	// the inner header, followed by the XML
+	var inner []byte
+	for _, field := range []struct {
+		fieldType byte
+		value     []byte
+	}{
+		{kdbxInnerHeaderRandomStreamID, binary.LittleEndian.AppendUint32(nil, kdbxInnerStreamChaCha20)},
+		{kdbxInnerHeaderRandomStreamKey, streamKey},
+		{kdbxInnerHeaderEnd, nil},
+	} {
+		inner = binary.LittleEndian.AppendUint32(append(inner, field.fieldType), uint32(len(field.value)))
+		inner = append(inner, field.value...)
+	}
+	inner = kdbxTestCompress(t, append(inner, keePassTestPayload(t, kdbxInnerStreamChaCha20, streamKey)...))
+	ciphertext := kdbxTestEncrypt(t, cipherID, encryptionKey[:], iv, inner)
+
+	headerHash := sha256.Sum256(header)
+	data := append(append(append([]byte{}, header...), headerHash[:]...), kdbxHMAC(hmacKey[:], ^uint64(0), header)...)
+	for index, block := range [][]byte{ciphertext, nil} {
+		blockData := append(binary.LittleEndian.AppendUint32(nil, uint32(len(block))), block...)
+		data = append(append(data, kdbxHMAC(hmacKey[:], uint64(index), blockData)...), blockData...)
+	}
+
+	return data
+}
+
+func TestReadKeePassDatabase(t *testing.T) {
+	key := KeePassKey{Password: []byte("master password")}
+	argon2Parameters := func(uuid []byte) map[string][]byte {
+		return map[string][]byte{
+			"$UUID": uuid, "S": bytes.Repeat([]byte{7}, 32),
+			"I": binary.LittleEndian.AppendUint64(nil, 2), "M": binary.LittleEndian.AppendUint64(nil, 64*1024),
+			"P": binary.LittleEndian.AppendUint64(nil, 2), "V": binary.LittleEndian.AppendUint64(nil, argon2Version),
+		}
+	}
+
+	for name, database := range map[string][]byte{
+		"KDBX 3.1":                  kdbx3TestDatabase(t, key),
+		"KDBX 4, Argon2d, ChaCha20": kdbx4TestDatabase(t, key, kdbxCipherChaCha20, argon2Parameters(kdbxKdfArgon2d)),
+		"KDBX 4, Argon2id, AES":     kdbx4TestDatabase(t, key, kdbxCipherAES, argon2Parameters(kdbxKdfArgon2id)),
+		"KDBX 4, AES-KDF, AES": kdbx4TestDatabase(t, key, kdbxCipherAES, map[string][]byte{
+			"$UUID": kdbxKdfAES, "S": bytes.Repeat([]byte{7}, 32), "R": binary.LittleEndian.AppendUint64(nil, 100),
+		}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			entries, err := ReadKeePassDatabase(database, key)
+			if err != nil {
+				t.Fatalf("ReadKeePassDatabase failed with error %s", err)
+			}
+
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name)
+			}
+			if want := []string{"Mail", "Bank", "Safe"}; !slices.Equal(names, want) {
+				t.Fatalf("ReadKeePassDatabase was incorrect, got: %v, want: %v.", names, want)
+			}
+
+			mail, bank, safe := entries[0], entries[1], entries[2]
+			if mail.Type != "login" || mail.Folder != "" || mail.Username != "owner" || mail.Password != "mail password" || !slices.Equal(mail.URLs, []string{"https://mail.example"}) {
+				t.Errorf("ReadKeePassDatabase was incorrect, got: %v, want: the login of owner.", mail)
+			}
+			if bank.Folder != "Banking/Cards" || bank.Password != "bank password" || bank.TOTP != keePassTestValues[3] || bank.Notes != "Call before travelling" {
+				t.Errorf("ReadKeePassDatabase was incorrect, got: %v, want: the login of customer, in Banking/Cards.", bank)
+			}
+			if !slices.Equal(bank.Tags, []string{"Finance", "Important"}) || !slices.Equal(bank.Fields, []VaultField{{"PIN", "1234"}}) {
+				t.Errorf("ReadKeePassDatabase was incorrect, got: %v, and %v, want: the tags, and PIN.", bank.Tags, bank.Fields)
+			}
+			if safe.Type != "note" || safe.Notes != "12-34-56" {
+				t.Errorf("ReadKeePassDatabase was incorrect, got: %v, want: a note.", safe)
+			}
+
+			_, err = ReadKeePassDatabase(database, KeePassKey{Password: []byte("wrong password")})
+			if core.CategoryOf(err) != core.ErrorCategoryPassphrase {
+				t.Errorf("ReadKeePassDatabase did not fail with a passphrase error for the wrong password, got: %v.", err)
+			}
+		})
+	}
+
+	if _, err := ReadKeePassDatabase([]byte(bitwardenTestExport), key); err == nil || !strings.Contains(err.Error(), "not a KeePass database") {
+		t.Errorf("ReadKeePassDatabase did not fail for a file other than a KeePass database, got: %v.", err)
+	}
+}
+
+func TestKeePassKeyFileHash(t *testing.T) {
+	key := randomBytes(t, 32)
+	keyXML := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key><Data Hash="%X">%X %X</Data></Key>
+</KeyFile>`, sha256Prefix(key), key[:16], key[16:])
+	other := []byte("any other file")
+	otherHash := sha256.Sum256(other)
+
+	for name, test := range map[string]struct {
+		keyFile, want []byte
+	}{
+		"XML":   {[]byte(keyXML), key},
+		"raw":   {key, key},
+		"hex":   {[]byte(hex.EncodeToString(key)), key},
+		"other": {other, otherHash[:]},
+	} {
+		if got := keePassKeyFileHash(test.keyFile); !bytes.Equal(got, test.want) {
+			t.Errorf("keePassKeyFileHash of the %s key file was incorrect, got: %x, want: %x.", name, got, test.want)
+		}
+	}
+}
+
+func sha256Prefix(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:4]
+}
+
+func TestSalsa20Stream(t *testing.T) {
+	key := sha256.Sum256([]byte("key"))
+	want := make([]byte, 300)
+	salsa20.XORKeyStream(want, want, kdbxSalsa20Nonce, &key)
+
+	stream, err := newKDBXInnerStream(kdbxInnerStreamSalsa20, []byte("key"))
+	if err != nil {
+		t.Fatalf("newKDBXInnerStream failed with error %s", err)
+	}
+	// the key stream continues across calls of any length
+	got := make([]byte, 300)
+	for _, part := range [][2]int{{0, 10}, {10, 64}, {64, 200}, {200, 300}} {
+		stream.XORKeyStream(got[part[0]:part[1]], got[part[0]:part[1]])
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("salsa20Stream was incorrect, the key stream differs from Salsa20")
+	}
+}
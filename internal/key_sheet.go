@@ -0,0 +1,166 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode/qr"
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/datamatrix"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+const (
+	PDFKeySheetHeading            = "PaperCrypt Key Sheet"
+	PDFKeySheetDescriptionHeading = "What is this?"
+	PDFKeySheetDescriptionContent = "This is a PaperCrypt key sheet. It holds a key phrase, which can be used as the passphrase of PaperCrypt recovery sheets. Store it in a different location than the recovery sheets it protects; anyone holding both can read the protected data."
+	PDFKeySheetPhraseHeading      = "Key Phrase"
+	PDFKeySheetPhraseContent      = "Enter the words in order, separated by single spaces. The 2D code below contains the same phrase."
+	PDFKeySheetPhraseFormat       = "Format: %s, %d words."
+)
+
+// GenerateKeySheetPDF renders a printable sheet for a key phrase,
+// containing the serial number and creation date of the sheet,
+// the phrase in large type, and a QR code of the phrase. Its text is translated into the language, English if nil.
+func GenerateKeySheetPDF(serialNumber string, createdAt time.Time, format string, words []string, language *Language) ([]byte, error) {
+	phrase := strings.Join(words, " ")
+
+	dm := new(bytes.Buffer)
+	{
+		// generate a data matrix with the sheet id
+		enc := datamatrix.NewDataMatrixWriter()
+		code, err := enc.Encode(serialNumber, gozxing.BarcodeFormat_DATA_MATRIX, 384, 384, nil)
+		if err != nil {
+			return nil, errors.Join(errors.New("error generating Data Matrix code"), err)
+		}
+
+		err = png.Encode(dm, code)
+		if err != nil {
+			return nil, errors.Join(errors.New("error generating Data Matrix code PNG"), err)
+		}
+	}
+
+	phraseQr := new(bytes.Buffer)
+	{
+		qrSize := 1181 // 100 mm at 300 dpi
+		code, err := qr.Encode(phrase, qr.H, qr.Auto)
+		if err != nil {
+			return nil, errors.Join(errors.New("error generating 2D code"), err)
+		}
+
+		err = writeScaledCodePNG(phraseQr, code, qrSize)
+		if err != nil {
+			return nil, errors.Join(errors.New("error generating 2D code PNG"), err)
+		}
+	}
+
+	pdf := getPdf(core.Page{})
+	pdf.SetHeaderFuncMode(func() {
+		pdf.SetY(5)
+		pdf.SetFont(PdfMonoFont, "", 10)
+		headerLine := fmt.Sprintf("%s: %s - %s", language.T(PDFHeaderSheetID), serialNumber, createdAt.Format(core.TimeStampFormatPDFHeader))
+		pdf.CellFormat(0, 10, headerLine,
+			"", 0, "C", false, 0, "")
+
+		{
+			// add the data matrix code
+			pdf.RegisterImageReader("dm.png", "PNG", dm)
+			imageSize := 5.0
+			pdf.ImageOptions("dm.png", 195, 50, imageSize, imageSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+		}
+
+		pdf.Ln(10)
+	}, true)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont(PdfMonoFont, "", 10)
+		pdf.CellFormat(0, 10, language.Sprintf(PDFPageCaption, pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	{
+		// Info text
+		pdf.SetFont(PdfTextFont, "B", 16)
+		pdf.CellFormat(0, 10, language.T(PDFKeySheetHeading), "", 0, "C", false, 0, "")
+		pdf.Ln(10)
+
+		pdf.SetFont(PdfTextFont, "B", 10)
+		pdf.CellFormat(0, 5, language.T(PDFKeySheetDescriptionHeading), "", 0, "L", false, 0, "")
+		pdf.Ln(5)
+
+		pdf.SetFont(PdfTextFont, "", 10)
+		pdf.MultiCell(0, 5, language.T(PDFKeySheetDescriptionContent), "", "", false)
+		pdf.Ln(5)
+
+		pdf.SetFont(PdfTextFont, "B", 10)
+		pdf.CellFormat(0, 5, language.T(PDFKeySheetPhraseHeading), "", 0, "L", false, 0, "")
+		pdf.Ln(5)
+
+		pdf.SetFont(PdfTextFont, "", 10)
+		pdf.MultiCell(0, 5, language.T(PDFKeySheetPhraseContent)+" "+language.Sprintf(PDFKeySheetPhraseFormat, format, len(words)), "", "", false)
+		pdf.Ln(5)
+	}
+
+	tableWidth := 170.0 // 210mm - 20mm left margin - 20mm right margin
+	columnWidth := tableWidth/3 - 10
+
+	// Print the phrase, three words per row
+	for i := 0; i < len(words); i += 3 {
+		for j := 0; j < 3; j++ {
+			if i+j < len(words) {
+				// print index
+				pdf.SetFont(PdfMonoFont, "", 10)
+				pdf.CellFormat(10, 12, fmt.Sprintf("%d", i+j+1), "", 0, "R", false, 0, "")
+				// print word
+				pdf.SetFont(PdfMonoFont, "B", 18)
+				pdf.CellFormat(columnWidth, 12, words[i+j], "", 0, "L", false, 0, "")
+			}
+		}
+		pdf.Ln(-1)
+	}
+
+	{
+		// add the qr code, centered below the phrase
+		pdf.Ln(10)
+		imageSize := 80.0
+		if pdf.GetY()+imageSize > 280 {
+			pdf.AddPage()
+		}
+
+		pdf.RegisterImageReader("phrase.png", "PNG", phraseQr)
+		pdf.ImageOptions("phrase.png", (210-imageSize)/2, pdf.GetY(), imageSize, imageSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+	}
+
+	pdf.Close()
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	if err != nil {
+		return nil, errors.Join(errors.New("error generating PDF"), err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,248 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// keychainService is the name PaperCrypt stores its secrets under, in the secret store of the operating system.
+const keychainService = "papercrypt"
+
+// ErrSecretNotFound is returned by Keychain.Get, if no secret is stored under the name.
+var ErrSecretNotFound = errors.New("no secret stored under this name")
+
+// Keychain stores secrets in the secret store of the operating system:
+// the Keychain on macOS, the Credential Manager on Windows, and the Secret Service (using libsecret) elsewhere.
+type Keychain interface {
+	// Set stores the secret under the name, replacing any secret stored before.
+	Set(name string, secret []byte) error
+
+	// Get returns the secret stored under the name, or ErrSecretNotFound.
+	Get(name string) ([]byte, error)
+
+	// Delete removes the secret stored under the name, if any.
+	Delete(name string) error
+}
+
+// PassphraseCache caches passphrases in a Keychain, for a limited time,
+// so a batch of documents can be generated without typing the passphrase for each.
+type PassphraseCache struct {
+	Keychain Keychain
+
+	// Expiries is the file the times the cached passphrases expire are noted in, without the passphrases,
+	// so they can be removed once expired, see Purge. None are noted if it is empty.
+	Expiries string
+
+	// Now returns the current time, it is time.Now, unless replaced by tests.
+	Now func() time.Time
+}
+
+// NewPassphraseCache returns a cache of passphrases in the keychain of the operating system,
+// noting the times they expire in the configuration directory of the user.
+func NewPassphraseCache() (*PassphraseCache, error) {
+	keychain, err := NewKeychain()
+	if err != nil {
+		return nil, err
+	}
+	expiries, err := passphraseExpiriesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PassphraseCache{Keychain: keychain, Expiries: expiries, Now: time.Now}, nil
+}
+
+// passphraseExpiriesPath returns the path of the file NewPassphraseCache notes the times passphrases expire in.
+func passphraseExpiriesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Join(errors.New("error finding the configuration directory"), err)
+	}
+
+	return filepath.Join(dir, "papercrypt", "passphrase-cache.json"), nil
+}
+
+// PurgeExpiredPassphrases removes the passphrases cached by NewPassphraseCache that have expired from the keychain,
+// see Purge. It is run on every invocation, and only accesses the keychain if a passphrase has expired.
+func PurgeExpiredPassphrases() error {
+	path, err := passphraseExpiriesPath()
+	if err != nil {
+		return err
+	}
+	expiries, err := readPassphraseExpiries(path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, expires := range expiries {
+		if !now.Before(expires) {
+			cache, err := NewPassphraseCache()
+			if err != nil {
+				return err
+			}
+			return cache.Purge()
+		}
+	}
+
+	return nil
+}
+
+// cachedPassphrase is a passphrase stored in the keychain, along with the time it expires.
+// The keychain itself does not expire secrets, so they are removed once they are found to have expired,
+// when loaded, or by Purge.
+type cachedPassphrase struct {
+	Expires    time.Time `json:"expires"`
+	Passphrase []byte    `json:"passphrase"`
+}
+
+// Store caches the passphrase under the name, until ttl has passed.
+func (c *PassphraseCache) Store(name string, passphrase []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid time to cache the passphrase %s, must be positive", ttl)
+	}
+
+	entry, err := json.Marshal(cachedPassphrase{Expires: c.Now().Add(ttl), Passphrase: passphrase})
+	if err != nil {
+		return errors.Join(errors.New("error encoding JSON"), err)
+	}
+	if err := c.Keychain.Set(name, entry); err != nil {
+		return errors.Join(errors.New("error storing the passphrase in the keychain"), err)
+	}
+
+	return c.noteExpiry(name, c.Now().Add(ttl))
+}
+
+// Load returns the passphrase cached under the name, ok is false if there is none, or it has expired.
+// Expired passphrases are removed from the keychain.
+func (c *PassphraseCache) Load(name string) (passphrase []byte, ok bool, err error) {
+	secret, err := c.Keychain.Get(name)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Join(errors.New("error reading the passphrase from the keychain"), err)
+	}
+
+	var entry cachedPassphrase
+	if err := json.Unmarshal(secret, &entry); err != nil {
+		return nil, false, errors.Join(errors.New("error decoding the cached passphrase"), err)
+	}
+	if !c.Now().Before(entry.Expires) {
+		return nil, false, c.Forget(name)
+	}
+
+	return entry.Passphrase, true, nil
+}
+
+// Forget removes the passphrase cached under the name.
+func (c *PassphraseCache) Forget(name string) error {
+	if err := c.Keychain.Delete(name); err != nil {
+		return errors.Join(errors.New("error removing the passphrase from the keychain"), err)
+	}
+
+	return c.noteExpiry(name, time.Time{})
+}
+
+// Purge removes every passphrase noted in Expiries that has expired from the keychain,
+// so they are not kept there until they are next loaded.
+func (c *PassphraseCache) Purge() error {
+	if c.Expiries == "" {
+		return nil
+	}
+
+	expiries, err := readPassphraseExpiries(c.Expiries)
+	if err != nil {
+		return err
+	}
+
+	now := c.Now()
+	var errs []error
+	for name, expires := range expiries {
+		if !now.Before(expires) {
+			errs = append(errs, c.Forget(name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// noteExpiry notes the time the passphrase cached under the name expires in Expiries,
+// or, if expires is zero, that it is no longer cached.
+func (c *PassphraseCache) noteExpiry(name string, expires time.Time) error {
+	if c.Expiries == "" {
+		return nil
+	}
+
+	lock, err := lockFile(c.Expiries)
+	if err != nil {
+		return errors.Join(errors.New("error locking the expiry times of cached passphrases"), err)
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	expiries, err := readPassphraseExpiries(c.Expiries)
+	if err != nil {
+		return err
+	}
+	if _, noted := expiries[name]; expires.IsZero() && !noted {
+		return nil
+	}
+	if expires.IsZero() {
+		delete(expiries, name)
+	} else {
+		expiries[name] = expires
+	}
+
+	data, err := json.MarshalIndent(expiries, "", "  ")
+	if err != nil {
+		return errors.Join(errors.New("error encoding JSON"), err)
+	}
+	if err := writeFileAtomically(c.Expiries, append(data, '\n')); err != nil {
+		return errors.Join(errors.New("error writing the expiry times of cached passphrases"), err)
+	}
+
+	return nil
+}
+
+// readPassphraseExpiries reads the times cached passphrases expire, by name, noted at path, see noteExpiry.
+func readPassphraseExpiries(path string) (map[string]time.Time, error) {
+	expiries := make(map[string]time.Time)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return expiries, nil
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the expiry times of cached passphrases"), err)
+	}
+
+	if err := json.Unmarshal(data, &expiries); err != nil {
+		return nil, errors.Join(fmt.Errorf("error parsing the expiry times of cached passphrases %s", path), err)
+	}
+
+	return expiries, nil
+}
@@ -0,0 +1,90 @@
+//go:build darwin
+
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errSecItemNotFound is the exit status of the security program, if no item is found.
+const errSecItemNotFound = 44
+
+// securityKeychain stores secrets in the macOS Keychain, using the security command line program.
+type securityKeychain struct{}
+
+// NewKeychain returns the Keychain of macOS.
+func NewKeychain() (Keychain, error) {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil, errors.Join(errors.New("security not found, it is needed to access the Keychain"), err)
+	}
+
+	return securityKeychain{}, nil
+}
+
+func (securityKeychain) run(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("security", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+			return nil, ErrSecretNotFound
+		}
+
+		return nil, errors.Join(fmt.Errorf("error running security: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (k securityKeychain) Set(name string, secret []byte) error {
+	// the command is passed on stdin, so the secret does not show up in the list of processes
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", keychainService, hex.EncodeToString([]byte(name)), hex.EncodeToString(secret))
+	_, err := k.run([]byte(command), "-i")
+	return err
+}
+
+func (k securityKeychain) Get(name string) ([]byte, error) {
+	secret, err := k.run(nil, "find-generic-password", "-s", keychainService, "-a", hex.EncodeToString([]byte(name)), "-w")
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(secret, []byte("\n")), nil
+}
+
+func (k securityKeychain) Delete(name string) error {
+	_, err := k.run(nil, "delete-generic-password", "-s", keychainService, "-a", hex.EncodeToString([]byte(name)))
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,134 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryKeychain keeps secrets in memory, in place of the keychain of the operating system.
+type memoryKeychain map[string][]byte
+
+func (k memoryKeychain) Set(name string, secret []byte) error {
+	k[name] = secret
+	return nil
+}
+
+func (k memoryKeychain) Get(name string) ([]byte, error) {
+	secret, ok := k[name]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+
+	return secret, nil
+}
+
+func (k memoryKeychain) Delete(name string) error {
+	delete(k, name)
+	return nil
+}
+
+func TestPassphraseCache(t *testing.T) {
+	now := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	keychain := memoryKeychain{}
+	cache := &PassphraseCache{Keychain: keychain, Now: func() time.Time { return now }}
+
+	if _, ok, err := cache.Load("passphrase"); ok || err != nil {
+		t.Fatalf("Load of an empty cache was incorrect, got: %t, %v, want: false, nil.", ok, err)
+	}
+
+	if err := cache.Store("passphrase", []byte("correct horse battery staple"), 10*time.Minute); err != nil {
+		t.Fatalf("Store failed with error %s", err)
+	}
+	got, ok, err := cache.Load("passphrase")
+	if err != nil {
+		t.Fatalf("Load failed with error %s", err)
+	}
+	if !ok || string(got) != "correct horse battery staple" {
+		t.Errorf("Load was incorrect, got: %q, want: %q.", got, "correct horse battery staple")
+	}
+
+	// expired passphrases are removed
+	now = now.Add(10 * time.Minute)
+	if _, ok, err := cache.Load("passphrase"); ok || err != nil {
+		t.Fatalf("Load of an expired passphrase was incorrect, got: %t, %v, want: false, nil.", ok, err)
+	}
+	if len(keychain) != 0 {
+		t.Errorf("Load did not remove the expired passphrase, got: %d secrets, want: 0.", len(keychain))
+	}
+
+	if err := cache.Store("passphrase", []byte("x"), 0); err == nil {
+		t.Errorf("Store should fail without a time to cache the passphrase")
+	}
+}
+
+func TestPassphraseCachePurge(t *testing.T) {
+	now := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	keychain := memoryKeychain{}
+	expiries := filepath.Join(t.TempDir(), "papercrypt", "passphrase-cache.json")
+	cache := &PassphraseCache{Keychain: keychain, Expiries: expiries, Now: func() time.Time { return now }}
+
+	for name, ttl := range map[string]time.Duration{"short": 5 * time.Minute, "long": 20 * time.Minute, "forgotten": time.Hour} {
+		if err := cache.Store(name, []byte("passphrase of "+name), ttl); err != nil {
+			t.Fatalf("Store failed with error %s", err)
+		}
+	}
+	if err := cache.Forget("forgotten"); err != nil {
+		t.Fatalf("Forget failed with error %s", err)
+	}
+
+	// nothing has expired yet
+	if err := cache.Purge(); err != nil {
+		t.Fatalf("Purge failed with error %s", err)
+	}
+	if len(keychain) != 2 {
+		t.Errorf("Purge removed a passphrase that has not expired, got: %d secrets, want: 2.", len(keychain))
+	}
+
+	// expired passphrases are removed without being loaded, along with the times they expired
+	now = now.Add(10 * time.Minute)
+	if err := cache.Purge(); err != nil {
+		t.Fatalf("Purge failed with error %s", err)
+	}
+	if _, ok := keychain["short"]; ok || len(keychain) != 1 {
+		t.Errorf("Purge did not remove the expired passphrase, got: %d secrets, want: 1.", len(keychain))
+	}
+	noted, err := readPassphraseExpiries(expiries)
+	if err != nil {
+		t.Fatalf("readPassphraseExpiries failed with error %s", err)
+	}
+	if _, ok := noted["long"]; !ok || len(noted) != 1 {
+		t.Errorf("got: %v, want: only the time the long passphrase expires.", noted)
+	}
+
+	// the times are noted without the passphrases
+	data, err := os.ReadFile(expiries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "passphrase of") {
+		t.Errorf("The passphrase should not be noted, got: %s", data)
+	}
+}
@@ -0,0 +1,85 @@
+//go:build !darwin && !windows
+
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretToolKeychain stores secrets in the Secret Service (such as GNOME Keyring, or KWallet),
+// using the secret-tool command line program of libsecret.
+type secretToolKeychain struct {
+	path string
+}
+
+// NewKeychain returns the Secret Service, through secret-tool.
+func NewKeychain() (Keychain, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, errors.Join(errors.New("secret-tool not found, install libsecret (libsecret-tools) to access the Secret Service"), err)
+	}
+
+	return secretToolKeychain{path: path}, nil
+}
+
+// run runs secret-tool, nothing is found if it fails without a message.
+func (k secretToolKeychain) run(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(k.path, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.TrimSpace(stderr.String()) == "" {
+			return nil, ErrSecretNotFound
+		}
+
+		return nil, errors.Join(fmt.Errorf("error running secret-tool: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (k secretToolKeychain) Set(name string, secret []byte) error {
+	// secret-tool reads the secret from stdin, so it does not show up in the list of processes
+	_, err := k.run(secret, "store", "--label", "PaperCrypt: "+name, "service", keychainService, "name", name)
+	return err
+}
+
+func (k secretToolKeychain) Get(name string) ([]byte, error) {
+	return k.run(nil, "lookup", "service", keychainService, "name", name)
+}
+
+func (k secretToolKeychain) Delete(name string) error {
+	_, err := k.run(nil, "clear", "service", keychainService, "name", name)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,134 @@
+//go:build windows
+
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// Types, and flags of the Credential Manager API, see wincred.h.
+const (
+	credTypeGeneric    = 1
+	credPersistSession = 1
+	errorNotFound      = syscall.Errno(1168)
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// credential is the CREDENTIALW structure of the Credential Manager API.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credentialKeychain stores secrets in the Windows Credential Manager, as generic credentials,
+// kept until the user logs off.
+type credentialKeychain struct{}
+
+// NewKeychain returns the Credential Manager of Windows.
+func NewKeychain() (Keychain, error) {
+	if err := procCredWriteW.Find(); err != nil {
+		return nil, errors.Join(errors.New("the Credential Manager is not available"), err)
+	}
+
+	return credentialKeychain{}, nil
+}
+
+// credentialTarget returns the name of the credential holding the secret stored under the name.
+func credentialTarget(name string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(keychainService + ":" + name)
+}
+
+func (credentialKeychain) Set(name string, secret []byte) error {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return err
+	}
+	if len(secret) == 0 {
+		return errors.New("the secret is empty")
+	}
+
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(secret)),
+		CredentialBlob:     &secret[0],
+		Persist:            credPersistSession,
+	}
+	if ok, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ok == 0 {
+		return errors.Join(errors.New("error writing the credential"), err)
+	}
+
+	return nil
+}
+
+func (credentialKeychain) Get(name string) ([]byte, error) {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *credential
+	if ok, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ok == 0 {
+		if errors.Is(err, errorNotFound) {
+			return nil, ErrSecretNotFound
+		}
+
+		return nil, errors.Join(errors.New("error reading the credential"), err)
+	}
+	defer func() { _, _, _ = procCredFree.Call(uintptr(unsafe.Pointer(cred))) }()
+
+	// the blob is owned by the Credential Manager, and freed with the credential
+	return append([]byte(nil), unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)...), nil
+}
+
+func (credentialKeychain) Delete(name string) error {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return err
+	}
+
+	if ok, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); ok == 0 && !errors.Is(err, errorNotFound) {
+		return errors.Join(errors.New("error deleting the credential"), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The text printed on documents (headings, explanations, labels, and the recovery instructions) is translated
+// by looking up the English text in the translations of a language, embedded into the binary from locales/<code>.json.
+// Text missing from the translations is printed in English.
+// The header and data lines are always written in English, as PaperCrypt reads them back.
+
+// DefaultLanguage is the language documents are written in by default.
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Language translates the text printed on documents. A nil *Language is English.
+type Language struct {
+	// Code is the ISO 639-1 code of the language, such as "de".
+	Code string `json:"-"`
+
+	// Name is the name of the language, in the language itself.
+	Name string `json:"name"`
+
+	// Messages maps English text to its translation.
+	// Format strings keep their verbs, which may be reordered using explicit argument indexes, such as %[2]d.
+	Messages map[string]string `json:"messages"`
+
+	// onMissing is called with text that has no translation, for tests to find it.
+	onMissing func(text string)
+}
+
+// Languages returns the codes of the available languages, in alphabetical order.
+func Languages() []string {
+	codes := []string{DefaultLanguage}
+	entries, _ := localeFiles.ReadDir("locales")
+	for _, entry := range entries {
+		codes = append(codes, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(codes)
+
+	return codes
+}
+
+// LoadLanguage returns the translations of the language with the given code, such as "de".
+func LoadLanguage(code string) (*Language, error) {
+	code = strings.ToLower(code)
+	if code == DefaultLanguage || code == "" {
+		return &Language{Code: DefaultLanguage, Name: "English"}, nil
+	}
+
+	data, err := localeFiles.ReadFile(path.Join("locales", code+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown language '%s', must be one of: %s", code, strings.Join(Languages(), ", "))
+	}
+
+	language := &Language{Code: code}
+	if err := json.Unmarshal(data, language); err != nil {
+		return nil, errors.Join(fmt.Errorf("error reading the translations of language %s", code), err)
+	}
+
+	return language, nil
+}
+
+// T returns the translation of text, or text itself if it has no translation.
+func (l *Language) T(text string) string {
+	if l == nil || l.Code == DefaultLanguage {
+		return text
+	}
+
+	translation, ok := l.Messages[text]
+	if !ok {
+		if l.onMissing != nil {
+			l.onMissing(text)
+		}
+		return text
+	}
+
+	return translation
+}
+
+// Sprintf formats the translation of format.
+func (l *Language) Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(l.T(format), args...)
+}
+
+// Tag returns the code of the language, for HTML and Typst documents.
+func (l *Language) Tag() string {
+	if l == nil {
+		return DefaultLanguage
+	}
+
+	return l.Code
+}
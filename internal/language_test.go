@@ -0,0 +1,175 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"regexp"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// printedTexts returns the English text printed on documents of all kinds, as looked up in the translations.
+func printedTexts() []string {
+	found := make(map[string]bool)
+	l := &Language{Code: "test", onMissing: func(text string) { found[text] = true }}
+
+	for _, text := range []string{
+		PDFHeading, PDFHeaderSheetID, PDFPageCaption, PDFCodePartCaption, PDFBlankPageNote,
+		PDFSheetCaption, PDFSheetCaptionDuplex, PDFSheetFront, PDFSheetBack, PDFSheetHashes,
+		PDFInstructionsHeading, PDFInstructionsIntro, PDFInstructionsStep,
+		WalletCardHint, WalletCardNote, "Date", "Purpose",
+		PDFKeySheetHeading, PDFKeySheetDescriptionHeading, PDFKeySheetDescriptionContent,
+		PDFKeySheetPhraseHeading, PDFKeySheetPhraseContent, PDFKeySheetPhraseFormat,
+		PDFTranscriptionHeading, PDFTranscriptionIntro, PDFTranscriptionCommand,
+		PDFTranscriptionHeaderHeading, PDFTranscriptionDataHeading, PDFTranscriptionOptional,
+	} {
+		l.T(text)
+	}
+
+	for _, format := range []core.PaperCryptDataFormat{core.PaperCryptDataFormatPGP, core.PaperCryptDataFormatRaw} {
+		pc := core.NewPaperCrypt("2.0.0", make([]byte, 64), "ABCDEF", "", "", time.Now(), format)
+		pc.PlaintextSHA256 = make([]byte, 32)
+		for _, encoding := range []core.PaperCryptDataEncoding{core.PaperCryptDataEncodingBase16, core.PaperCryptDataEncodingBase32, core.PaperCryptDataEncodingBase64, core.PaperCryptDataEncodingArmor, core.PaperCryptDataEncodingWords} {
+			opts := TextOptions{Encoding: encoding, Language: l}
+			RecoveryInstructions(pc, opts)
+			documentSections(pc, false, 1, opts)
+		}
+
+		opts := TextOptions{
+			Layout:               core.DataLayout{GroupSize: 2, Columns: 8, LineIndices: true},
+			LineChecksum:         core.LineChecksumCRC32,
+			ErrorCorrectionLevel: 10,
+			Profile:              OutputProfileStamping,
+			Code2D:               core.Code2DOptions{Type: core.Code2DTypeColor},
+			Template:             &PDFTemplate{Contact: "Contact"},
+			Language:             l,
+		}
+		documentSections(pc, false, 2, opts)
+		documentSections(pc, true, 0, opts)
+		opts.Duplex = DuplexLongEdge
+		documentSections(pc, false, 2, opts)
+	}
+
+	// messages encrypted to a public key are restored differently, only the packet tags matter
+	var message bytes.Buffer
+	gzipWriter := gzip.NewWriter(&message)
+	_, _ = gzipWriter.Write([]byte{0xc1, 0x01, 0x03, 0xd2, 0x01, 0x01})
+	_ = gzipWriter.Close()
+	RecoveryInstructions(core.NewPaperCrypt("2.0.0", message.Bytes(), "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatPGP), TextOptions{Language: l})
+
+	texts := make([]string, 0, len(found))
+	for text := range found {
+		texts = append(texts, text)
+	}
+	sort.Strings(texts)
+
+	return texts
+}
+
+var (
+	formatVerb          = regexp.MustCompile(`%(\[\d+\])?[-+# 0]*\d*(\.\d+)?[a-zA-Z%]`)
+	formatArgumentIndex = regexp.MustCompile(`\[\d+\]`)
+)
+
+// formatVerbs returns the verbs of a format string, sorted, without explicit argument indexes.
+func formatVerbs(format string) []string {
+	verbs := formatVerb.FindAllString(format, -1)
+	for i, verb := range verbs {
+		verbs[i] = formatArgumentIndex.ReplaceAllString(verb, "")
+	}
+	sort.Strings(verbs)
+
+	return verbs
+}
+
+func TestLanguages(t *testing.T) {
+	texts := printedTexts()
+	known := make(map[string]bool, len(texts))
+	for _, text := range texts {
+		known[text] = true
+	}
+
+	for _, code := range Languages() {
+		if code == DefaultLanguage {
+			continue
+		}
+
+		language, err := LoadLanguage(code)
+		if err != nil {
+			t.Fatalf("LoadLanguage failed with error %s", err)
+		}
+		if language.Name == "" {
+			t.Errorf("Language %s has no name", code)
+		}
+
+		for _, text := range texts {
+			translation, ok := language.Messages[text]
+			if !ok {
+				t.Errorf("Language %s is missing the translation of %q", code, text)
+				continue
+			}
+			if got, want := formatVerbs(translation), formatVerbs(text); !slices.Equal(got, want) {
+				t.Errorf("Translation of %q into %s has the format verbs %v, want: %v.", text, code, got, want)
+			}
+		}
+		for text := range language.Messages {
+			if !known[text] {
+				t.Errorf("Language %s translates unknown text %q", code, text)
+			}
+		}
+	}
+}
+
+func TestLoadLanguage(t *testing.T) {
+	english, err := LoadLanguage("")
+	if err != nil {
+		t.Fatalf("LoadLanguage failed with error %s", err)
+	}
+	if got := english.T(PDFHeading); got != PDFHeading {
+		t.Errorf("got: %s, want: %s.", got, PDFHeading)
+	}
+
+	var none *Language
+	if got := none.Sprintf(PDFPageCaption, 2); got != "Page 2/{nb}" {
+		t.Errorf("got: %s, want: Page 2/{nb}.", got)
+	}
+
+	german, err := LoadLanguage("DE")
+	if err != nil {
+		t.Fatalf("LoadLanguage failed with error %s", err)
+	}
+	if got := german.T(PDFHeading); got == PDFHeading {
+		t.Errorf("The heading should be translated, got: %s", got)
+	}
+	if got := german.T("untranslated"); got != "untranslated" {
+		t.Errorf("got: %s, want: untranslated.", got)
+	}
+
+	if _, err := LoadLanguage("xx"); err == nil {
+		t.Error("LoadLanguage should fail for unknown languages")
+	}
+}
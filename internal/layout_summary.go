@@ -0,0 +1,181 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// LayoutSummary describes how a document is laid out, without writing it, see NewLayoutSummary.
+type LayoutSummary struct {
+	// DataLength is the length of the data, in bytes.
+	DataLength int
+
+	// DataLines is the number of lines of data printed, parity lines included.
+	DataLines int
+
+	// Codes are the 2D codes printed, none with no 2D code.
+	Codes []CodeLayout
+
+	// Pages is the number of pages of a PDF document, 0 if unknown.
+	Pages int
+}
+
+// CodeLayout describes a printed 2D code, or a layer of a color code.
+type CodeLayout struct {
+	Type core.Code2DType
+
+	// Version is the version (1-40) of a QR code, or 0 for Aztec codes.
+	Version int
+
+	// ErrorCorrection is the error correction level: L, M, Q, or H for QR codes,
+	// or the minimum percentage of error correction of Aztec codes.
+	ErrorCorrection string
+
+	// Modules is the width of the code, in modules.
+	Modules int
+
+	// ModuleSize is the printed size of a single module, in mm.
+	ModuleSize float64
+}
+
+// ScanDifficulty estimates how hard the 2D codes of a document are to scan.
+type ScanDifficulty uint8
+
+const (
+	ScanDifficultyNone ScanDifficulty = iota
+	ScanDifficultyEasy
+	ScanDifficultyModerate
+	ScanDifficultyHard
+)
+
+func (d ScanDifficulty) String() string {
+	switch d {
+	case ScanDifficultyNone:
+		return "none (no 2D code)"
+	case ScanDifficultyEasy:
+		return "easy"
+	case ScanDifficultyModerate:
+		return "moderate"
+	case ScanDifficultyHard:
+		return "hard"
+	default:
+		return "unknown"
+	}
+}
+
+// scanDifficultyManyCodes is the number of codes from which scanning them all becomes tedious.
+const scanDifficultyManyCodes = 4
+
+// ScanDifficulty estimates how hard the codes are to scan, from the size of their modules, and the number of codes:
+// modules below MinScannableModuleSize are hard to read by phone cameras, and up to twice that size need a steady hand.
+func (s *LayoutSummary) ScanDifficulty() ScanDifficulty {
+	if len(s.Codes) == 0 {
+		return ScanDifficultyNone
+	}
+
+	smallest := s.Codes[0].ModuleSize
+	for _, code := range s.Codes {
+		smallest = min(smallest, code.ModuleSize)
+	}
+	switch {
+	case smallest < core.MinScannableModuleSize:
+		return ScanDifficultyHard
+	case smallest < 2*core.MinScannableModuleSize || len(s.Codes) > scanDifficultyManyCodes:
+		return ScanDifficultyModerate
+	default:
+		return ScanDifficultyEasy
+	}
+}
+
+// codeLayout describes a code of the given type and width in modules, as printed with opts.
+func codeLayout(codeType core.Code2DType, modules int, opts core.Code2DOptions) CodeLayout {
+	size, _ := opts.PrintSize(modules)
+	layout := CodeLayout{Type: codeType, Modules: modules, ModuleSize: size / float64(modules)}
+	if codeType == core.Code2DTypeAztec {
+		layout.ErrorCorrection = fmt.Sprintf("%d%%", core.AztecMinECCPercent)
+	} else {
+		// QR codes are 17 modules wide at version 1, and grow by 4 modules per version
+		layout.Version = (modules - 17) / 4
+		layout.ErrorCorrection = opts.QRErrorCorrection.String()
+	}
+
+	return layout
+}
+
+// NewLayoutSummary returns how the document is laid out with opts: the number of data lines, and the 2D codes printed.
+// If pdf is the document rendered as PDF, its pages are counted, otherwise, it may be nil.
+func NewLayoutSummary(p *core.PaperCrypt, no2D bool, opts TextOptions, pdf []byte) (*LayoutSummary, error) {
+	summary := &LayoutSummary{DataLength: p.GetDataLength()}
+
+	text, err := p.GetText(opts.EncodingOptions())
+	if err != nil {
+		return nil, err
+	}
+	_, dataLines, err := splitDocumentText(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range dataLines {
+		if line != "" {
+			summary.DataLines++
+		}
+	}
+
+	if !no2D {
+		payload, err := p.QRPayload(opts.QRPayload)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error serializing PaperCrypt to %s", opts.QRPayload), err)
+		}
+
+		if opts.Code2D.Type == core.Code2DTypeColor {
+			codes, err := core.EncodeColorCodes(payload, opts.Code2D)
+			if err != nil {
+				return nil, errors.Join(errors.New("error generating 2D code"), err)
+			}
+			for _, code := range codes {
+				for _, layer := range code {
+					summary.Codes = append(summary.Codes, codeLayout(core.Code2DTypeColor, layer.Bounds().Dx(), opts.Code2D))
+				}
+			}
+		} else {
+			codes, err := core.Encode2DParts(payload, opts.Code2D)
+			if err != nil {
+				return nil, errors.Join(errors.New("error generating 2D code"), err)
+			}
+			for _, code := range codes {
+				summary.Codes = append(summary.Codes, codeLayout(opts.Code2D.Type, code.Bounds().Dx(), opts.Code2D))
+			}
+		}
+	}
+
+	if pdf != nil {
+		summary.Pages, err = CountPDFPages(pdf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,96 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestLayoutSummary(t *testing.T) {
+	loadFonts(t)
+
+	data := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40))
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "Purpose", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), core.PaperCryptDataFormatRaw)
+	opts := TextOptions{Code2D: core.Code2DOptions{Type: core.Code2DTypeQR, QRErrorCorrection: core.QRErrorCorrectionM, QRMaxVersion: 10, ModuleSize: 1, DPI: 100}}
+
+	doc, err := GetPDF(pc, false, opts)
+	if err != nil {
+		t.Fatalf("GetPDF failed with error %s", err)
+	}
+	summary, err := NewLayoutSummary(pc, false, opts, doc)
+	if err != nil {
+		t.Fatalf("LayoutSummary failed with error %s", err)
+	}
+
+	if summary.DataLength != len(data) {
+		t.Errorf("Data length was incorrect, got: %d, want: %d.", summary.DataLength, len(data))
+	}
+	// 24 bytes per line, and a line holding the block checksum
+	if want := (len(data)+core.BytesPerLine-1)/core.BytesPerLine + 1; summary.DataLines != want {
+		t.Errorf("Data lines were incorrect, got: %d, want: %d.", summary.DataLines, want)
+	}
+	if len(summary.Codes) < 2 {
+		t.Fatalf("Codes were incorrect, got: %d, want the payload to be split.", len(summary.Codes))
+	}
+	for _, code := range summary.Codes {
+		if code.Version < 1 || code.Version > 10 || code.ErrorCorrection != "M" {
+			t.Errorf("Code was incorrect, got: version %d, error correction %s, want: version 1-10, error correction M.", code.Version, code.ErrorCorrection)
+		}
+	}
+	if summary.Pages < 2 {
+		t.Errorf("Pages were incorrect, got: %d, want: at least 2.", summary.Pages)
+	}
+
+	summary, err = NewLayoutSummary(pc, true, opts, nil)
+	if err != nil {
+		t.Fatalf("LayoutSummary failed with error %s", err)
+	}
+	if len(summary.Codes) != 0 || summary.Pages != 0 || summary.ScanDifficulty() != ScanDifficultyNone {
+		t.Errorf("Summary was incorrect, got: %d codes on %d pages, want: no codes, and no pages counted.", len(summary.Codes), summary.Pages)
+	}
+}
+
+func TestScanDifficulty(t *testing.T) {
+	large := CodeLayout{ModuleSize: 2}
+	small := CodeLayout{ModuleSize: 0.8}
+	tiny := CodeLayout{ModuleSize: 0.3}
+
+	tests := []struct {
+		codes []CodeLayout
+		want  ScanDifficulty
+	}{
+		{nil, ScanDifficultyNone},
+		{[]CodeLayout{large}, ScanDifficultyEasy},
+		{[]CodeLayout{large, small}, ScanDifficultyModerate},
+		{[]CodeLayout{large, large, large, large, large}, ScanDifficultyModerate},
+		{[]CodeLayout{large, tiny}, ScanDifficultyHard},
+	}
+	for _, test := range tests {
+		summary := &LayoutSummary{Codes: test.codes}
+		if got := summary.ScanDifficulty(); got != test.want {
+			t.Errorf("ScanDifficulty was incorrect, got: %s, want: %s.", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// maxLineRepairs is the number of candidate corrections offered for a line, see DataEntry.RepairCandidates.
+const maxLineRepairs = 9
+
+// LineRepairKind is the kind of typing error a LineRepair corrects.
+type LineRepairKind uint8
+
+const (
+	// LineRepairLookalike replaces a character with one it is commonly mistaken for, such as B with 8.
+	LineRepairLookalike LineRepairKind = iota
+	// LineRepairTransposition swaps two neighbouring characters.
+	LineRepairTransposition
+	// LineRepairSubstitution replaces a character with any other.
+	LineRepairSubstitution
+)
+
+// String returns the name of the kind.
+func (k LineRepairKind) String() string {
+	switch k {
+	case LineRepairLookalike:
+		return "lookalike"
+	case LineRepairTransposition:
+		return "transposition"
+	case LineRepairSubstitution:
+		return "substitution"
+	default:
+		return "unknown"
+	}
+}
+
+// LineRepair is a correction of a line, making it match its checksum.
+type LineRepair struct {
+	Kind LineRepairKind
+
+	// Value is the corrected line.
+	Value string
+
+	// Column is the index (in characters, including spaces) of the first character changed.
+	Column int
+
+	// Description explains the correction, such as "'B' → '8' (column 13)".
+	Description string
+}
+
+// isLookalike returns whether a and b are commonly mistaken for each other.
+func isLookalike(a, b rune) bool {
+	return slices.Contains(core.AmbiguousCharacters[a], b) || slices.Contains(core.AmbiguousCharacters[b], a)
+}
+
+// RepairCandidates returns corrections making the line with the given index match its checksum,
+// found by trying every single character substitution, and every swap of two neighbouring characters.
+// The candidates are ranked by how likely the typing error is: characters commonly mistaken for each other first,
+// then swapped characters, then any other substitution, up to maxLineRepairs of them.
+// It returns nil for header fields, and lines that are not complete, or already valid.
+func (e *DataEntry) RepairCandidates(i int) []LineRepair {
+	line := e.Lines[i]
+	if line.Header || e.structure == nil || e.Check(i).Status != LineStatusInvalid {
+		return nil
+	}
+
+	s := e.structure
+	runes := []rune(line.Value)
+	positions := digitPositions(runes)
+	caseSensitive := s.encoding.IsCaseSensitive()
+
+	var valid func([]rune) bool
+	var alphabetAt func(n int) string
+	if line.Label == strconv.Itoa(s.dataLines+1) {
+		var ok bool
+		if valid, ok = e.blockChecksumValidator(); !ok || len(positions) != len(s.checksum.Format(0)) {
+			return nil
+		}
+		alphabetAt = func(int) string { return core.HexAlphabet }
+		caseSensitive = false
+	} else {
+		parity := strings.HasPrefix(line.Label, core.ParityLinePrefix)
+		number, _ := strconv.Atoi(strings.TrimPrefix(line.Label, core.ParityLinePrefix))
+		size := s.lineSize(number-1, parity)
+		dataDigits, checksumDigits := s.lineDigits(size)
+		if len(positions) != dataDigits+checksumDigits {
+			return nil
+		}
+
+		valid = s.lineValidator(size)
+		alphabetAt = func(n int) string {
+			if n >= dataDigits {
+				return core.HexAlphabet
+			}
+
+			return s.encoding.Alphabet()
+		}
+	}
+
+	return findLineRepairs(runes, positions, alphabetAt, caseSensitive, valid)
+}
+
+// findLineRepairs tries the substitutions and transpositions of the characters of text at the given positions,
+// drawing replacements of the n-th character from alphabetAt(n), and returns those that are valid, ranked.
+func findLineRepairs(text []rune, positions []int, alphabetAt func(n int) string, caseSensitive bool, valid func([]rune) bool) []LineRepair {
+	var repairs []LineRepair
+	for n, p := range positions {
+		original := text[p]
+		for _, candidate := range alphabetAt(n) {
+			if candidate == original || !caseSensitive && strings.EqualFold(string(candidate), string(original)) {
+				continue
+			}
+
+			text[p] = candidate
+			if valid(text) {
+				kind := LineRepairSubstitution
+				if isLookalike(original, candidate) {
+					kind = LineRepairLookalike
+				}
+				repairs = append(repairs, LineRepair{
+					Kind:        kind,
+					Value:       string(text),
+					Column:      p,
+					Description: fmt.Sprintf("'%c' → '%c' (column %d)", original, candidate, p+1),
+				})
+			}
+		}
+		text[p] = original
+
+		if n+1 < len(positions) {
+			q := positions[n+1]
+			if text[q] == original {
+				continue
+			}
+
+			text[p], text[q] = text[q], text[p]
+			if valid(text) {
+				repairs = append(repairs, LineRepair{
+					Kind:        LineRepairTransposition,
+					Value:       string(text),
+					Column:      p,
+					Description: fmt.Sprintf("'%c%c' → '%c%c' (columns %d and %d)", text[q], text[p], text[p], text[q], p+1, q+1),
+				})
+			}
+			text[p], text[q] = text[q], text[p]
+		}
+	}
+
+	slices.SortStableFunc(repairs, func(a, b LineRepair) int {
+		return int(a.Kind) - int(b.Kind)
+	})
+	if len(repairs) > maxLineRepairs {
+		repairs = repairs[:maxLineRepairs]
+	}
+
+	return repairs
+}
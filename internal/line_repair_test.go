@@ -0,0 +1,99 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestRepairCandidates(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 5))
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "Purpose", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), core.PaperCryptDataFormatRaw)
+	text, err := pc.GetText(core.EncodingOptions{Encoding: core.PaperCryptDataEncodingBase16})
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+
+	e := NewDataEntry()
+	typeIn(t, e, text)
+
+	line := -1
+	for i, l := range e.Lines {
+		if l.Label == "1" {
+			line = i
+		}
+	}
+	value := e.Lines[line].Value // 54 68 65 20 ...
+
+	if repairs := e.RepairCandidates(line); repairs != nil {
+		t.Errorf("A valid line should have no repairs, got: %v.", repairs)
+	}
+
+	tests := []struct {
+		name  string
+		typed string
+		kind  LineRepairKind
+		first bool
+	}{
+		{"lookalike", value[:4] + "B" + value[5:], LineRepairLookalike, true},
+		{"transposition", "45" + value[2:], LineRepairTransposition, true},
+		{"substitution", value[:6] + "C" + value[7:], LineRepairSubstitution, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e.SetValue(line, tt.typed)
+			repairs := e.RepairCandidates(line)
+			if len(repairs) == 0 || len(repairs) > maxLineRepairs {
+				t.Fatalf("Number of repairs was incorrect, got: %d, want: 1 to %d.", len(repairs), maxLineRepairs)
+			}
+			if tt.first && repairs[0].Value != value {
+				t.Errorf("First repair was incorrect, got: %s (%s), want: %s.", repairs[0].Value, repairs[0].Description, value)
+			}
+
+			found := false
+			for i, repair := range repairs {
+				if i > 0 && repair.Kind < repairs[i-1].Kind {
+					t.Errorf("Repairs are not ranked, %s follows %s.", repair.Kind, repairs[i-1].Kind)
+				}
+				if repair.Value == value {
+					found = true
+					if repair.Kind != tt.kind {
+						t.Errorf("Kind was incorrect, got: %s, want: %s.", repair.Kind, tt.kind)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("The original line is not among the repairs: %v.", repairs)
+			}
+		})
+	}
+
+	t.Run("incomplete", func(t *testing.T) {
+		e.SetValue(line, value[:10])
+		if repairs := e.RepairCandidates(line); repairs != nil {
+			t.Errorf("An incomplete line should have no repairs, got: %v.", repairs)
+		}
+	})
+}
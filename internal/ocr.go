@@ -0,0 +1,371 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// OCR recognizes the text printed on an image.
+type OCR interface {
+	// Recognize returns the lines of text of the image.
+	// If charset is not empty, only its characters are recognized.
+	Recognize(img image.Image, charset string) (string, error)
+}
+
+// TesseractOCR recognizes text using the tesseract command line program (https://github.com/tesseract-ocr/tesseract).
+type TesseractOCR struct {
+	// Path is the path of the tesseract program.
+	Path string
+}
+
+// NewTesseractOCR looks up the tesseract program, by name in the PATH, or at the given path.
+func NewTesseractOCR(path string) (*TesseractOCR, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%s not found, install Tesseract (https://github.com/tesseract-ocr/tesseract) to read printed text", path), err)
+	}
+
+	return &TesseractOCR{Path: resolved}, nil
+}
+
+func (t *TesseractOCR) Recognize(img image.Image, charset string) (string, error) {
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return "", errors.Join(errors.New("error encoding image for OCR"), err)
+	}
+
+	// page segmentation mode 6 reads the page as a single, uniform block of text
+	args := []string{"stdin", "stdout", "--psm", "6", "-c", "preserve_interword_spaces=1"}
+	if charset != "" {
+		args = append(args, "-c", "tessedit_char_whitelist="+charset)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(t.Path, args...)
+	cmd.Stdin = &input
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Join(fmt.Errorf("error running tesseract: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return stdout.String(), nil
+}
+
+// OCRCharset returns the characters of data lines written using the encoding:
+// the digits of the encoding, the line numbers, and the labels of parity and column number lines.
+func OCRCharset(encoding core.PaperCryptDataEncoding) string {
+	return "0123456789:" + core.ParityLinePrefix + core.ColumnIndexLabel + encoding.Alphabet()
+}
+
+// ocrSkeleton reduces text to a form in which commonly confused characters are the same,
+// for matching names read by OCR.
+func ocrSkeleton(s string) string {
+	return strings.NewReplacer(
+		" ", "", "0", "o", "d", "o", "q", "o",
+		"1", "l", "i", "l", "|", "l", "7", "t",
+		"2", "z", "5", "s", "8", "b", "6", "g", "4", "a",
+	).Replace(strings.ToLower(s))
+}
+
+// parseOCRHeader returns the header fields found in the text, in order, with the field names corrected.
+// Lines that do not hold a known field are skipped.
+func parseOCRHeader(text string) [][2]string {
+	var fields [][2]string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(text, "\n") {
+		label, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		// the header lines are printed after a #, which may be read as another character
+		label = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(label), "#"))
+		if first, rest, ok := strings.Cut(label, " "); ok && len(first) == 1 {
+			label = rest
+		}
+
+		for _, name := range core.HeaderFieldNames {
+			if seen[name] || ocrSkeleton(label) != ocrSkeleton(name) {
+				continue
+			}
+
+			seen[name] = true
+			fields = append(fields, [2]string{name, strings.TrimSpace(value)})
+			break
+		}
+	}
+
+	return fields
+}
+
+// repairOCRHeader corrects the values of the header fields using the header CRC-32, if possible.
+// It returns the header lines, and whether the checksum matches.
+func repairOCRHeader(fields [][2]string) (string, bool) {
+	var text []rune
+	var positions []int
+	var crcValue []rune
+	for _, field := range fields {
+		if field[0] == core.HeaderFieldHeaderCRC32 {
+			crcValue = []rune(field[1])
+			continue
+		}
+
+		if len(text) > 0 {
+			text = append(text, '\n')
+		}
+		text = append(text, []rune(field[0]+": ")...)
+		for _, r := range field[1] {
+			positions = append(positions, len(text))
+			text = append(text, r)
+		}
+	}
+	header := string(text)
+	if crcValue == nil {
+		return header, false
+	}
+
+	// the checksum is repaired along with the values
+	full := append(append(text, []rune("\n"+core.HeaderFieldHeaderCRC32+": ")...), crcValue...)
+	for i := range crcValue {
+		positions = append(positions, len(text)+len(core.HeaderFieldHeaderCRC32)+3+i)
+	}
+
+	ok := core.RepairAmbiguous(full, positions, nil, func(candidate []rune) bool {
+		body, crc := string(candidate[:len(text)]), string(candidate[len(text)+len(core.HeaderFieldHeaderCRC32)+3:])
+		sum, err := core.ParseHexUint32(crc)
+		return err == nil && len(crc) == 8 && crc32.ChecksumIEEE([]byte(body)) == sum
+	})
+
+	return string(full), ok
+}
+
+// ocrDataLine is a line of the data block read by OCR.
+var ocrDataLine = regexp.MustCompile(`^\s*(` + core.ParityLinePrefix + `?)\s*(\d+)\s*:\s*(.*)$`)
+
+// OCRResult is a document read from its printed text, by OCR, or from the text of a PDF document.
+type OCRResult struct {
+	// Text is the text representation of the document, with the lines that could be read.
+	Text []byte
+
+	// Corrected lists the lines (and header) in which characters were corrected.
+	Corrected []string
+
+	// Unreadable lists the lines that could not be read, even by correcting characters.
+	Unreadable []string
+
+	// HeaderValid is false if the header CRC-32 does not match the header fields read.
+	HeaderValid bool
+}
+
+// ReadDocumentByOCR reads the printed text of the pages of a document:
+// the header, and the data block, using the charset of its encoding.
+// Characters that OCR commonly mistakes for each other are corrected, as long as the checksum of the line (or the header) matches.
+// Lines that can not be read are left out, so error correction can reconstruct them, and listed in the result.
+func ReadDocumentByOCR(pages []image.Image, ocr OCR) (*OCRResult, error) {
+	return readPrintedDocument(len(pages), func(page int, charset string) (string, error) {
+		return ocr.Recognize(pages[page], charset)
+	})
+}
+
+// readPrintedDocument reads a document from the text of its pages, as read by read, restricted to charset if set.
+func readPrintedDocument(pages int, read func(page int, charset string) (string, error)) (*OCRResult, error) {
+	var fullText strings.Builder
+	for i := range pages {
+		text, err := read(i, "")
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading page %d", i+1), err)
+		}
+		fullText.WriteString(text + "\n")
+	}
+
+	fields := parseOCRHeader(fullText.String())
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		values[field[0]] = field[1]
+	}
+
+	result := &OCRResult{}
+	header, ok := repairOCRHeader(fields)
+	result.HeaderValid = ok
+	if ok {
+		if header != strings.Join(headerLines(fields), "\n") {
+			result.Corrected = append(result.Corrected, "header")
+		}
+
+		headerMap, err := core.TextToHeaderMap([]byte(header))
+		if err != nil {
+			return nil, err
+		}
+		values = headerMap
+	}
+
+	encoding := core.PaperCryptDataEncodingBase16
+	if name, ok := values[core.HeaderFieldDataEncoding]; ok {
+		encoding = core.PaperCryptDataEncodingFromString(name)
+	}
+	switch encoding {
+	case core.PaperCryptDataEncodingBase16, core.PaperCryptDataEncodingBase32, core.PaperCryptDataEncodingBase64:
+	default:
+		return nil, fmt.Errorf("only base16, base32, and base64 data blocks can be read from the printed text, not '%s'", values[core.HeaderFieldDataEncoding])
+	}
+
+	layout := core.DefaultDataLayout
+	if s, ok := values[core.HeaderFieldDataLayout]; ok {
+		var err error
+		layout, err = core.ParseDataLayout(s)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("invalid `%s`", core.HeaderFieldDataLayout), err)
+		}
+	}
+	if !layout.LineIndices {
+		return nil, errors.New("reading the data block from the printed text requires line numbers")
+	}
+
+	checksum := core.LineChecksumCRC24
+	if s, ok := values[core.HeaderFieldLineChecksum]; ok {
+		checksum = core.LineChecksumFromString(s)
+		if checksum == core.LineChecksumUnknown {
+			return nil, fmt.Errorf("unsupported line checksum '%s'", s)
+		}
+	}
+
+	contentLength, err := core.ParseContentLength(values[core.HeaderFieldContentLength])
+	if err != nil {
+		return nil, errors.Join(errors.New("the number of lines is unknown"), err)
+	}
+	dataLines := (contentLength + layout.BytesPerLine() - 1) / layout.BytesPerLine()
+
+	parityLines := 0
+	if s, ok := values[core.HeaderFieldErrorCorrection]; ok {
+		ecc, err := core.ParseErrorCorrection(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := ecc.CheckDataLines(dataLines); err != nil {
+			return nil, err
+		}
+		parityLines = ecc.Stripes * ecc.ParityLines
+	}
+
+	// lines by label, in order of appearance, to pick the first one that can be read
+	charset := OCRCharset(encoding)
+	candidates := make(map[string][]string)
+	for i := range pages {
+		text, err := read(i, charset)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading page %d", i+1), err)
+		}
+
+		for _, line := range strings.Split(text, "\n") {
+			match := ocrDataLine.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			number, _ := strconv.Atoi(match[2])
+			label := match[1] + strconv.Itoa(number)
+			candidates[label] = append(candidates[label], match[3])
+		}
+	}
+
+	readLine := func(label string) ([]byte, uint32, bool) {
+		for _, content := range candidates[label] {
+			if data, sum, corrections, ok := core.DecodeAmbiguousLine(content, encoding, layout, checksum, 0); ok {
+				if len(corrections) > 0 {
+					result.Corrected = append(result.Corrected, label)
+				}
+
+				return data, sum, true
+			}
+		}
+
+		result.Unreadable = append(result.Unreadable, label)
+		return nil, 0, false
+	}
+
+	var block strings.Builder
+	var all []byte
+	complete := true
+	for n := 1; n <= dataLines; n++ {
+		data, sum, ok := readLine(strconv.Itoa(n))
+		if !ok {
+			complete = false
+			continue
+		}
+
+		all = append(all, data...)
+		block.WriteString(fmt.Sprintf("%d: %s %s\n", n, encoding.EncodeLine(data, layout.GroupSize), checksum.Format(sum)))
+	}
+
+	// the last line holds the checksum of the block, which can only be corrected if all lines were read
+	blockLabel := strconv.Itoa(dataLines + 1)
+	blockChecksum := ""
+	for _, content := range candidates[blockLabel] {
+		digits := strings.Join(strings.Fields(content), "")
+		if !complete && len(digits) == len(checksum.Format(0)) {
+			blockChecksum = strings.ToUpper(digits)
+			break
+		}
+
+		if sum, _, ok := core.DecodeAmbiguousChecksum(content, checksum, all); complete && ok {
+			blockChecksum = checksum.Format(sum)
+			break
+		}
+	}
+	if blockChecksum == "" {
+		result.Unreadable = append(result.Unreadable, blockLabel)
+	} else {
+		block.WriteString(fmt.Sprintf("%s: %s\n", blockLabel, blockChecksum))
+	}
+
+	for n := 1; n <= parityLines; n++ {
+		data, sum, ok := readLine(core.ParityLinePrefix + strconv.Itoa(n))
+		if ok {
+			block.WriteString(fmt.Sprintf("%s%d: %s %s\n", core.ParityLinePrefix, n, encoding.EncodeLine(data, layout.GroupSize), checksum.Format(sum)))
+		}
+	}
+
+	result.Text = []byte(header + "\n\n\n" + block.String())
+	return result, nil
+}
+
+// headerLines returns the header fields as written by GetText.
+func headerLines(fields [][2]string) []string {
+	lines := make([]string, len(fields))
+	for i, field := range fields {
+		lines[i] = fmt.Sprintf("%s: %s", field[0], field[1])
+	}
+
+	return lines
+}
@@ -0,0 +1,164 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"image"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// fakeOCR returns fixed text, depending on whether the charset is restricted.
+type fakeOCR struct {
+	full string
+	data string
+}
+
+func (f fakeOCR) Recognize(_ image.Image, charset string) (string, error) {
+	if charset == "" {
+		return f.full, nil
+	}
+
+	return f.data, nil
+}
+
+// printedText returns the text of a document as printed, and as read using the charset of its data block.
+func printedText(t *testing.T, pc *core.PaperCrypt, opts TextOptions) (string, string) {
+	t.Helper()
+
+	text, err := pc.GetText(opts.EncodingOptions())
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+	header, data, err := splitDocumentText(text)
+	if err != nil {
+		t.Fatalf("splitDocumentText failed with error %s", err)
+	}
+
+	full := "PaperCrypt Recovery Sheet\n"
+	restricted := ""
+	for _, line := range header {
+		full += "# " + line + "\n"
+		// a restricted charset turns the header into noise
+		restricted += strings.Map(func(r rune) rune {
+			if strings.ContainsRune(OCRCharset(opts.Encoding), r) && r != ':' {
+				return r
+			}
+			return -1
+		}, line) + "\n"
+	}
+
+	return full + "\n" + strings.Join(data, "\n"), restricted + "\n" + strings.Join(data, "\n")
+}
+
+func TestReadDocumentByOCR(t *testing.T) {
+	data := bytes.Repeat([]byte{0x18, 0xD0, 0x7E}, 40)
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "Purpose", "", time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC), core.PaperCryptDataFormatRaw)
+
+	opts := TextOptions{ErrorCorrectionLevel: 20}
+	full, restricted := printedText(t, pc, opts)
+
+	// misread characters in the header, and in two lines, and a line that can not be read
+	full = strings.Replace(full, "# Content Serial: ABCDEF", "H Content Seria1: A8CDEF", 1)
+	lines := strings.Split(restricted, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "2: "):
+			lines[i] = strings.Replace(line, "18", "7B", 1)
+		case strings.HasPrefix(line, "3: "):
+			lines[i] = "3: " + strings.Repeat("AB", 30)
+		case strings.HasPrefix(line, "4: "):
+			lines[i] = strings.Replace(line, "D0", "00", 1)
+		}
+	}
+	restricted = strings.Join(lines, "\n")
+
+	result, err := ReadDocumentByOCR([]image.Image{image.NewGray(image.Rect(0, 0, 1, 1))}, fakeOCR{full: full, data: restricted})
+	if err != nil {
+		t.Fatalf("ReadDocumentByOCR failed with error %s", err)
+	}
+
+	if !result.HeaderValid {
+		t.Errorf("The header should have been corrected:\n%s", result.Text)
+	}
+	if got, want := result.Corrected, []string{"header", "2", "4"}; !slices.Equal(got, want) {
+		t.Errorf("got: %v, want: %v.", got, want)
+	}
+	if got, want := result.Unreadable, []string{"3"}; !slices.Equal(got, want) {
+		t.Errorf("got: %v, want: %v.", got, want)
+	}
+
+	// the unreadable line is reconstructed from the parity lines
+	restored, err := core.DeserializeV2Text(result.Text, false, false)
+	if err != nil {
+		t.Fatalf("DeserializeV2Text failed with error %s", err)
+	}
+	if !bytes.Equal(restored.Data, data) {
+		t.Errorf("got: %x, want: %x.", restored.Data, data)
+	}
+}
+
+func TestReadDocumentByOCREncodings(t *testing.T) {
+	data := bytes.Repeat([]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF}, 12)
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatRaw)
+
+	for _, opts := range []TextOptions{
+		{Encoding: core.PaperCryptDataEncodingBase32, Layout: StampingDataLayout},
+		{Encoding: core.PaperCryptDataEncodingBase64, LineChecksum: core.LineChecksumSHA256},
+		{Layout: core.DataLayout{GroupSize: 4, Columns: 4, BlockLines: 3, LineIndices: true, ColumnIndices: true}},
+	} {
+		full, restricted := printedText(t, pc, opts)
+		result, err := ReadDocumentByOCR([]image.Image{image.NewGray(image.Rect(0, 0, 1, 1))}, fakeOCR{full: full, data: restricted})
+		if err != nil {
+			t.Fatalf("ReadDocumentByOCR failed with error %s", err)
+		}
+		if len(result.Corrected) != 0 || len(result.Unreadable) != 0 || !result.HeaderValid {
+			t.Errorf("%s: got: corrected %v, unreadable %v, header valid %v, want: a clean read.", opts.Encoding, result.Corrected, result.Unreadable, result.HeaderValid)
+		}
+
+		restored, err := core.DeserializeV2Text(result.Text, false, false)
+		if err != nil {
+			t.Fatalf("DeserializeV2Text failed with error %s", err)
+		}
+		if !bytes.Equal(restored.Data, data) {
+			t.Errorf("%s: got: %x, want: %x.", opts.Encoding, restored.Data, data)
+		}
+	}
+
+	_, err := ReadDocumentByOCR(nil, fakeOCR{full: "# Data Encoding: Words\n# Content Length: 10\n"})
+	if err == nil {
+		t.Errorf("Reading the words encoding by OCR should fail")
+	}
+}
+
+func TestOCRSkeleton(t *testing.T) {
+	if ocrSkeleton("Content CRC-Z4") != ocrSkeleton(core.HeaderFieldCRC24) {
+		t.Errorf("Content CRC-Z4 should match %s", core.HeaderFieldCRC24)
+	}
+	if ocrSkeleton("Content CRC-32") == ocrSkeleton(core.HeaderFieldCRC24) {
+		t.Errorf("Content CRC-32 should not match %s", core.HeaderFieldCRC24)
+	}
+}
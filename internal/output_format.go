@@ -0,0 +1,78 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// OutputFormat is the file format documents are written in.
+type OutputFormat uint8
+
+const (
+	// OutputFormatPDF writes a single PDF document.
+	OutputFormatPDF OutputFormat = 0
+	// OutputFormatPNG writes one PNG image per page, see RasterizePDF.
+	OutputFormatPNG OutputFormat = 1
+	// OutputFormatHTML writes a self-contained HTML page, for printing from a browser, see GetHTML.
+	OutputFormatHTML OutputFormat = 2
+	// OutputFormatUnknown is returned for unknown format names.
+	OutputFormatUnknown OutputFormat = 0xFF
+)
+
+func (f OutputFormat) String() string {
+	switch f {
+	case OutputFormatPDF:
+		return "PDF"
+	case OutputFormatPNG:
+		return "PNG"
+	case OutputFormatHTML:
+		return "HTML"
+	default:
+		return "Unknown"
+	}
+}
+
+func OutputFormatFromString(s string) OutputFormat {
+	switch strings.ToLower(s) {
+	case "pdf", "":
+		return OutputFormatPDF
+	case "png":
+		return OutputFormatPNG
+	case "html", "htm":
+		return OutputFormatHTML
+	default:
+		return OutputFormatUnknown
+	}
+}
+
+// PagePath returns the path of a page written to its own file: the page number is appended to the file name,
+// unless the document has a single page. For example, page 2 of "sheet.png" is written to "sheet-2.png".
+func PagePath(path string, page, pages int) string {
+	if pages == 1 {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), page, ext)
+}
@@ -0,0 +1,53 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import "testing"
+
+func TestOutputFormatFromString(t *testing.T) {
+	for _, format := range []OutputFormat{OutputFormatPDF, OutputFormatPNG, OutputFormatHTML} {
+		if got := OutputFormatFromString(format.String()); got != format {
+			t.Errorf("OutputFormatFromString was incorrect, got: %s, want: %s.", got, format)
+		}
+	}
+	if got := OutputFormatFromString("gif"); got != OutputFormatUnknown {
+		t.Errorf("OutputFormatFromString was incorrect, got: %s, want: %s.", got, OutputFormatUnknown)
+	}
+}
+
+func TestPagePath(t *testing.T) {
+	tests := []struct {
+		path        string
+		page, pages int
+		want        string
+	}{
+		{"sheet.png", 1, 1, "sheet.png"},
+		{"sheet.png", 1, 3, "sheet-1.png"},
+		{"out/sheet.v2.png", 3, 3, "out/sheet.v2-3.png"},
+		{"sheet", 2, 2, "sheet-2"},
+	}
+
+	for _, tt := range tests {
+		if got := PagePath(tt.path, tt.page, tt.pages); got != tt.want {
+			t.Errorf("PagePath was incorrect, got: %s, want: %s.", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// OutputProfile is a preset of options for a particular way of storing the document.
+type OutputProfile uint8
+
+const (
+	// OutputProfileDefault leaves all options as they are.
+	OutputProfileDefault OutputProfile = 0
+	// OutputProfileStamping prepares the data block for letter-punching onto metal plates:
+	// base32 (Crockford's alphabet) in upper case only, short lines, and a grid with large cells.
+	OutputProfileStamping OutputProfile = 1
+	// OutputProfileWallet prints a credit-card-sized card, holding a single QR code with high error correction,
+	// to be laminated and carried in a wallet, see getWalletPDF.
+	OutputProfileWallet OutputProfile = 2
+	// OutputProfileUnknown is returned for unknown profile names.
+	OutputProfileUnknown OutputProfile = 0xFF
+)
+
+// StampingDataLayout is the layout of the stamping profile,
+// 10 bytes per line, which encode to exactly four groups of four base32 digits, in blocks of 5 lines.
+var StampingDataLayout = core.DataLayout{
+	GroupSize:   1,
+	Columns:     10,
+	BlockLines:  5,
+	LineIndices: true,
+}
+
+const (
+	// stampingCellWidth is the width of a single character's cell, in mm.
+	stampingCellWidth = 5.5
+	// stampingCellHeight is the height of a single character's cell, in mm.
+	stampingCellHeight = 8.0
+	// stampingLineGap is the space between lines, in mm.
+	stampingLineGap = 2.0
+	// stampingFontSize is the font size of the characters, in pt.
+	stampingFontSize = 16
+)
+
+func (o OutputProfile) String() string {
+	switch o {
+	case OutputProfileDefault:
+		return "Default"
+	case OutputProfileStamping:
+		return "Stamping"
+	case OutputProfileWallet:
+		return "Wallet"
+	default:
+		return "Unknown"
+	}
+}
+
+func OutputProfileFromString(s string) OutputProfile {
+	switch strings.ToLower(s) {
+	case "default", "":
+		return OutputProfileDefault
+	case "stamping":
+		return OutputProfileStamping
+	case "wallet":
+		return OutputProfileWallet
+	default:
+		return OutputProfileUnknown
+	}
+}
+
+// Apply returns the options with the settings of the profile applied.
+func (o OutputProfile) Apply(opts TextOptions) (TextOptions, error) {
+	switch o {
+	case OutputProfileDefault:
+	case OutputProfileStamping:
+		if opts.LowerCase {
+			return opts, errors.New("the stamping profile only uses upper case letters")
+		}
+
+		opts.Encoding = core.PaperCryptDataEncodingBase32
+		opts.Layout = StampingDataLayout
+	case OutputProfileWallet:
+		// the highest error correction level, as laminated cards get scratched and reflect light
+		opts.Code2D.Type = core.Code2DTypeQR
+		opts.Code2D.QRErrorCorrection = core.QRErrorCorrectionH
+		opts.Code2D.QRMaxVersion = WalletQRMaxVersion
+		opts.Code2D.ModuleSize = 0
+		opts.Code2D.PrintArea = walletCodeSize
+		opts.QRPayload = core.QRPayloadFormatCBOR
+	default:
+		return opts, errors.New("unknown output profile")
+	}
+
+	opts.Profile = o
+	return opts, nil
+}
+
+// drawStampingLine draws a line of the data block as a row of cells, one per character,
+// with half a cell of space in place of each space.
+func drawStampingLine(pdf *gofpdf.Fpdf, line string) {
+	for _, c := range line {
+		if c == ' ' {
+			pdf.CellFormat(stampingCellWidth/2, stampingCellHeight, "", "", 0, "C", false, 0, "")
+			continue
+		}
+
+		pdf.CellFormat(stampingCellWidth, stampingCellHeight, string(c), "1", 0, "C", false, 0, "")
+	}
+
+	pdf.Ln(stampingCellHeight + stampingLineGap)
+}
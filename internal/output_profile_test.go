@@ -0,0 +1,151 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestOutputProfileStamping(t *testing.T) {
+	data := make([]byte, 95)
+	_, _ = rand.Read(data)
+
+	opts, err := OutputProfileStamping.Apply(TextOptions{})
+	if err != nil {
+		t.Fatalf("Apply failed with error %s", err)
+	}
+	if opts.Encoding != core.PaperCryptDataEncodingBase32 || opts.Layout != StampingDataLayout {
+		t.Errorf("Apply was incorrect, got: %s and %s, want: %s and %s.", opts.Encoding, opts.Layout, core.PaperCryptDataEncodingBase32, StampingDataLayout)
+	}
+
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatRaw)
+	text, err := pc.GetText(opts.EncodingOptions())
+	if err != nil {
+		t.Fatalf("GetText failed with error %s", err)
+	}
+
+	_, body, err := core.SplitTextHeaderAndBody(text)
+	if err != nil {
+		t.Fatalf("SplitTextHeaderAndBody failed with error %s", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		if strings.Trim(line, " :0123456789ABCDEFGHJKMNPQRSTVWXYZ") != "" {
+			t.Errorf("Line uses characters outside the stamping character set: %s", line)
+		}
+	}
+
+	restored, err := core.DeserializeV2Text(text, false, false)
+	if err != nil {
+		t.Fatalf("DeserializeV2Text failed with error %s", err)
+	}
+	if !bytes.Equal(restored.Data, data) {
+		t.Errorf("Decoding was incorrect, got: %x, want: %x.", restored.Data, data)
+	}
+
+	if _, err := OutputProfileStamping.Apply(TextOptions{LowerCase: true}); err == nil {
+		t.Errorf("Apply should fail with lower case letters")
+	}
+}
+
+// loadFonts loads the fonts of PDF documents, which are embedded by the main package.
+func loadFonts(t *testing.T) {
+	t.Helper()
+
+	if err := LoadFontFiles("../font"); err != nil {
+		t.Fatalf("LoadFontFiles failed with error %s", err)
+	}
+}
+
+func TestOutputProfileWallet(t *testing.T) {
+	loadFonts(t)
+
+	opts, err := OutputProfileWallet.Apply(TextOptions{Page: core.Page{Paper: core.PaperSizeA4}})
+	if err != nil {
+		t.Fatalf("Apply failed with error %s", err)
+	}
+	if opts.Code2D.Type != core.Code2DTypeQR || opts.Code2D.QRErrorCorrection != core.QRErrorCorrectionH {
+		t.Errorf("Apply was incorrect, got: %s with level %s, want: QR with level H.", opts.Code2D.Type, opts.Code2D.QRErrorCorrection)
+	}
+
+	pc := core.NewPaperCrypt("2.0.0", make([]byte, 64), "ABCDEF", "Recovery codes", "", time.Now(), core.PaperCryptDataFormatRaw)
+	doc, err := GetPDF(pc, false, opts)
+	if err != nil {
+		t.Fatalf("GetPDF failed with error %s", err)
+	}
+	pdf, err := readPDFDocument(doc)
+	if err != nil {
+		t.Fatalf("readPDFDocument failed with error %s", err)
+	}
+	if pages, err := pdf.pages(); err != nil || len(pages) != 1 {
+		t.Errorf("got: %d pages, want: 1.", len(pages))
+	}
+
+	// the card is scanned back, from the code image of the PDF, and from the printed page at several resolutions
+	scans := map[string]image.Image{}
+	images, err := ExtractPDFImages(doc)
+	if err != nil || len(images) != 1 {
+		t.Fatalf("got: %d images, error %v, want: 1.", len(images), err)
+	}
+	scans["code image"] = images[0]
+	for _, dpi := range []float64{300, 600} {
+		err := RasterizePDF(doc, dpi, func(_, _ int, img *image.RGBA) error {
+			scans[fmt.Sprintf("%.0f dpi", dpi)] = img
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("RasterizePDF failed with error %s", err)
+		}
+	}
+	for name, img := range scans {
+		results, err := core.ScanCodeImage(img)
+		if err != nil || len(results) != 1 {
+			t.Errorf("%s: got: %d codes, error %v, want: 1.", name, len(results), err)
+			continue
+		}
+		restored, err := core.DeserializeQRPayload(results[0])
+		if err != nil {
+			t.Errorf("%s: DeserializeQRPayload failed with error %s", name, err)
+			continue
+		}
+		if !bytes.Equal(restored.Data, pc.Data) || restored.Purpose != pc.Purpose {
+			t.Errorf("%s: got: %x, want: %x.", name, restored.Data, pc.Data)
+		}
+	}
+
+	if _, err := GetPDF(pc, true, opts); err == nil {
+		t.Errorf("GetPDF should fail without the QR code")
+	}
+
+	large := make([]byte, 4096)
+	_, _ = rand.Read(large)
+	pc = core.NewPaperCrypt("2.0.0", large, "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatRaw)
+	if _, err := GetPDF(pc, false, opts); err == nil {
+		t.Errorf("GetPDF should fail for data that does not fit a single QR code")
+	}
+}
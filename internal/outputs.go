@@ -25,11 +25,12 @@ import (
 	"os"
 
 	"github.com/caarlos0/log"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 func PrintWrittenSize(size int, file *os.File) {
 	if size == 0 {
-		log.Warn(Warning("No data written."))
+		log.Warn(core.Warning("No data written."))
 	} else {
 		log.WithField("size", SprintBinarySize(size)).WithField("path", file.Name()).Debug("Data written.")
 	}
@@ -0,0 +1,278 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/ProtonMail/gopenpgp/v2/armor"
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// OpenPGP packet tags of keys, see RFC 9580, section 5.
+const (
+	pgpTagSecretKey    = 5
+	pgpTagPublicKey    = 6
+	pgpTagSecretSubkey = 7
+	pgpTagPublicSubkey = 14
+)
+
+// paperKeyVersion is the version of the paperkey format, see ExtractPaperKey.
+const paperKeyVersion = 0
+
+// pgpArmorPrefix starts every ASCII armored OpenPGP block.
+const pgpArmorPrefix = "-----BEGIN PGP"
+
+// PaperKeySecret is the secret part of an OpenPGP key, or subkey, as stored by paperkey.
+type PaperKeySecret struct {
+	// Version is the version of the key packet.
+	Version byte
+	// Fingerprint identifies the key, or subkey, the secret belongs to.
+	Fingerprint []byte
+	// Secret is the end of the secret key packet, from the string-to-key usage octet on,
+	// still protected by the passphrase of the key, if it has one.
+	Secret []byte
+}
+
+// FormatFingerprint formats the fingerprint of a key, as shown by gpg.
+func FormatFingerprint(fingerprint []byte) string {
+	return strings.ToUpper(hex.EncodeToString(fingerprint))
+}
+
+// ExtractPaperKey extracts the secret parts of an OpenPGP secret key (ASCII armored, or binary, as exported by
+// `gpg --export-secret-keys`), and of its subkeys, in the raw format of paperkey (https://www.jabberwocky.com/software/paperkey/):
+// everything else, such as the public keys, user IDs, and signatures, can be restored from the public key.
+//
+// The format starts with its version (0), followed, for each key, by the version of the key packet (4),
+// the fingerprint of the key (20 bytes), the length of its secret (2 bytes, big endian), and the secret.
+func ExtractPaperKey(secretKey []byte) ([]byte, error) {
+	data, err := unarmorKey(secretKey, constants.PrivateKeyHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte{paperKeyVersion}
+	reader := packet.NewOpaqueReader(bytes.NewReader(data))
+	found := false
+	for {
+		p, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading OpenPGP packet"), err)
+		}
+		if p.Tag != pgpTagSecretKey && p.Tag != pgpTagSecretSubkey {
+			continue
+		}
+
+		public, fingerprint, err := parseKeyPacket(p)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(p.Contents, public) {
+			return nil, fmt.Errorf("the secret key %s does not start with its public key", FormatFingerprint(fingerprint))
+		}
+		secret := p.Contents[len(public):]
+		if len(secret) > 0xffff {
+			return nil, fmt.Errorf("the secret of key %s is too long", FormatFingerprint(fingerprint))
+		}
+
+		out = append(out, p.Contents[0])
+		out = append(out, fingerprint...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(secret)))
+		out = append(out, secret...)
+		found = true
+	}
+	if !found {
+		return nil, errors.New("no secret key found, export it using 'gpg --export-secret-keys'")
+	}
+
+	return out, nil
+}
+
+// ReadPaperKey reads the secrets stored in the raw format of paperkey, see ExtractPaperKey.
+func ReadPaperKey(data []byte) ([]PaperKeySecret, error) {
+	if len(data) == 0 {
+		return nil, errors.New("no secrets found")
+	}
+	if data[0] != paperKeyVersion {
+		return nil, fmt.Errorf("unsupported paperkey format version %d", data[0])
+	}
+
+	var secrets []PaperKeySecret
+	for rest := data[1:]; len(rest) > 0; {
+		version := rest[0]
+		if version != 4 {
+			return nil, fmt.Errorf("unsupported key version %d", version)
+		}
+		if len(rest) < 1+20+2 {
+			return nil, errors.New("the secrets are truncated")
+		}
+		fingerprint := rest[1:21]
+		length := int(binary.BigEndian.Uint16(rest[21:23]))
+		rest = rest[23:]
+		if len(rest) < length {
+			return nil, errors.New("the secrets are truncated")
+		}
+
+		secrets = append(secrets, PaperKeySecret{Version: version, Fingerprint: fingerprint, Secret: rest[:length]})
+		rest = rest[length:]
+	}
+	if len(secrets) == 0 {
+		return nil, errors.New("no secrets found")
+	}
+
+	return secrets, nil
+}
+
+// RestorePaperKey restores the OpenPGP secret key (binary) from its public key (ASCII armored, or binary),
+// and the secrets extracted by ExtractPaperKey, or by paperkey. It fails if a key, or subkey, has no secret.
+func RestorePaperKey(publicKey []byte, paperKey []byte) ([]byte, error) {
+	secrets, err := ReadPaperKey(paperKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := unarmorKey(publicKey, constants.PublicKeyHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	reader := packet.NewOpaqueReader(bytes.NewReader(data))
+	found := false
+	for {
+		p, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading OpenPGP packet"), err)
+		}
+
+		switch p.Tag {
+		case pgpTagSecretKey, pgpTagSecretSubkey:
+			return nil, errors.New("expected a public key, got a secret key")
+		case pgpTagPublicKey, pgpTagPublicSubkey:
+			_, fingerprint, err := parseKeyPacket(p)
+			if err != nil {
+				return nil, err
+			}
+
+			secret, ok := findPaperKeySecret(secrets, fingerprint)
+			if !ok {
+				return nil, fmt.Errorf("no secret found for key %s, the secrets may belong to another public key", FormatFingerprint(fingerprint))
+			}
+			p.Contents = append(append([]byte{}, p.Contents...), secret...)
+			if p.Tag == pgpTagPublicKey {
+				p.Tag = pgpTagSecretKey
+			} else {
+				p.Tag = pgpTagSecretSubkey
+			}
+
+			// the checksum of unprotected secrets is verified when parsing
+			if _, err := p.Parse(); err != nil {
+				return nil, errors.Join(fmt.Errorf("the secret of key %s is damaged", FormatFingerprint(fingerprint)), err)
+			}
+			found = true
+		}
+
+		if err := p.Serialize(&out); err != nil {
+			return nil, errors.Join(errors.New("error writing OpenPGP packet"), err)
+		}
+	}
+	if !found {
+		return nil, errors.New("no public key found")
+	}
+
+	return out.Bytes(), nil
+}
+
+// ArmorSecretKey ASCII armors a binary OpenPGP secret key.
+func ArmorSecretKey(secretKey []byte) (string, error) {
+	return armor.ArmorWithType(secretKey, constants.PrivateKeyHeader)
+}
+
+// findPaperKeySecret returns the secret of the key with the given fingerprint.
+func findPaperKeySecret(secrets []PaperKeySecret, fingerprint []byte) ([]byte, bool) {
+	for _, secret := range secrets {
+		if bytes.Equal(secret.Fingerprint, fingerprint) {
+			return secret.Secret, true
+		}
+	}
+
+	return nil, false
+}
+
+// parseKeyPacket returns the public part of a (public, or secret) key packet, and the fingerprint of the key.
+// Only version 4 keys are supported, as by paperkey.
+func parseKeyPacket(p *packet.OpaquePacket) (public, fingerprint []byte, err error) {
+	parsed, err := p.Parse()
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("error reading OpenPGP key"), err)
+	}
+
+	var pk *packet.PublicKey
+	switch key := parsed.(type) {
+	case *packet.PublicKey:
+		pk = key
+	case *packet.PrivateKey:
+		pk = &key.PublicKey
+	default:
+		return nil, nil, errors.New("unsupported OpenPGP key algorithm")
+	}
+	if pk.Version != 4 {
+		return nil, nil, fmt.Errorf("unsupported key version %d, only version 4 keys are supported", pk.Version)
+	}
+
+	// the public key, as hashed for the fingerprint, prefixed by 0x99, and its length
+	var hashed bytes.Buffer
+	if err := pk.SerializeForHash(&hashed); err != nil {
+		return nil, nil, errors.Join(errors.New("error serializing OpenPGP key"), err)
+	}
+
+	return hashed.Bytes()[3:], pk.Fingerprint, nil
+}
+
+// unarmorKey returns the binary OpenPGP key, removing the ASCII armor of the given type, if it has one.
+func unarmorKey(data []byte, armorType string) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte(pgpArmorPrefix)) {
+		return data, nil
+	}
+	if !bytes.HasPrefix(trimmed, []byte("-----BEGIN "+armorType+"-----")) {
+		return nil, fmt.Errorf("expected a %s", strings.ToLower(armorType))
+	}
+
+	unarmored, err := armor.Unarmor(string(trimmed))
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading ASCII armor"), err)
+	}
+
+	return unarmored, nil
+}
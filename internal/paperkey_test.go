@@ -0,0 +1,163 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+func TestPaperKey(t *testing.T) {
+	passphrase := []byte("example")
+	for _, keyType := range []string{"x25519", "rsa"} {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := crypto.GenerateKey("Owner", "owner@example.com", keyType, 2048)
+			if err != nil {
+				t.Fatalf("GenerateKey failed with error %s", err)
+			}
+			locked, err := key.Lock(passphrase)
+			if err != nil {
+				t.Fatalf("Lock failed with error %s", err)
+			}
+			armored, err := locked.Armor()
+			if err != nil {
+				t.Fatalf("Armor failed with error %s", err)
+			}
+			public, err := locked.GetPublicKey()
+			if err != nil {
+				t.Fatalf("GetPublicKey failed with error %s", err)
+			}
+
+			secrets, err := ExtractPaperKey([]byte(armored))
+			if err != nil {
+				t.Fatalf("ExtractPaperKey failed with error %s", err)
+			}
+			read, err := ReadPaperKey(secrets)
+			if err != nil {
+				t.Fatalf("ReadPaperKey failed with error %s", err)
+			}
+			// the primary key, and the encryption subkey
+			if len(read) != 2 || FormatFingerprint(read[0].Fingerprint) != strings.ToUpper(locked.GetFingerprint()) {
+				t.Fatalf("ReadPaperKey was incorrect, got: %d secrets, want: 2 secrets of %s.", len(read), locked.GetFingerprint())
+			}
+			// the secrets are much shorter than the key
+			if len(secrets) >= len(armored)/2 {
+				t.Errorf("ExtractPaperKey was incorrect, got: %d bytes, want: less than %d bytes.", len(secrets), len(armored)/2)
+			}
+
+			restored, err := RestorePaperKey(public, secrets)
+			if err != nil {
+				t.Fatalf("RestorePaperKey failed with error %s", err)
+			}
+			restoredKey, err := crypto.NewKey(restored)
+			if err != nil {
+				t.Fatalf("NewKey failed with error %s", err)
+			}
+			if !restoredKey.IsPrivate() || restoredKey.GetFingerprint() != locked.GetFingerprint() {
+				t.Fatalf("RestorePaperKey was incorrect, got: key %s, want: the secret key %s.", restoredKey.GetFingerprint(), locked.GetFingerprint())
+			}
+
+			// the restored key decrypts messages encrypted to the public key
+			unlocked, err := restoredKey.Unlock(passphrase)
+			if err != nil {
+				t.Fatalf("Unlock failed with error %s", err)
+			}
+			encryptionKeyRing, err := crypto.NewKeyRing(key)
+			if err != nil {
+				t.Fatalf("NewKeyRing failed with error %s", err)
+			}
+			encrypted, err := encryptionKeyRing.Encrypt(crypto.NewPlainMessageFromString("secret"), nil)
+			if err != nil {
+				t.Fatalf("Encrypt failed with error %s", err)
+			}
+			decryptionKeyRing, err := crypto.NewKeyRing(unlocked)
+			if err != nil {
+				t.Fatalf("NewKeyRing failed with error %s", err)
+			}
+			decrypted, err := decryptionKeyRing.Decrypt(encrypted, nil, 0)
+			if err != nil {
+				t.Fatalf("Decrypt failed with error %s", err)
+			}
+			if decrypted.GetString() != "secret" {
+				t.Errorf("Decrypt was incorrect, got: %s, want: secret.", decrypted.GetString())
+			}
+
+			armoredRestored, err := ArmorSecretKey(restored)
+			if err != nil {
+				t.Fatalf("ArmorSecretKey failed with error %s", err)
+			}
+			if _, err := crypto.NewKeyFromArmored(armoredRestored); err != nil {
+				t.Errorf("NewKeyFromArmored failed with error %s", err)
+			}
+		})
+	}
+}
+
+func TestPaperKeyErrors(t *testing.T) {
+	key, err := crypto.GenerateKey("Owner", "owner@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	other, err := crypto.GenerateKey("Other", "other@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err)
+	}
+	secretKey, err := key.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed with error %s", err)
+	}
+	public, err := key.GetPublicKey()
+	if err != nil {
+		t.Fatalf("GetPublicKey failed with error %s", err)
+	}
+	otherPublic, err := other.GetPublicKey()
+	if err != nil {
+		t.Fatalf("GetPublicKey failed with error %s", err)
+	}
+
+	if _, err := ExtractPaperKey(public); err == nil {
+		t.Error("ExtractPaperKey succeeded for a public key")
+	}
+
+	secrets, err := ExtractPaperKey(secretKey)
+	if err != nil {
+		t.Fatalf("ExtractPaperKey failed with error %s", err)
+	}
+	if _, err := RestorePaperKey(otherPublic, secrets); err == nil {
+		t.Error("RestorePaperKey succeeded for another public key")
+	}
+	if _, err := RestorePaperKey(secretKey, secrets); err == nil {
+		t.Error("RestorePaperKey succeeded for a secret key")
+	}
+	if _, err := RestorePaperKey(public, secrets[:len(secrets)-10]); err == nil {
+		t.Error("RestorePaperKey succeeded for truncated secrets")
+	}
+
+	// a damaged secret fails its checksum
+	damaged := bytes.Clone(secrets)
+	damaged[len(damaged)-3] ^= 0xff
+	if _, err := RestorePaperKey(public, damaged); err == nil {
+		t.Error("RestorePaperKey succeeded for damaged secrets")
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// passStoreEnv is the environment variable holding the directory of the password store, as used by pass.
+const passStoreEnv = "PASSWORD_STORE_DIR"
+
+// passRecipientsFile is the file of a folder of the store listing the keys its entries are encrypted for,
+// applying to its subfolders without one of their own.
+const passRecipientsFile = ".gpg-id"
+
+// PassStore is the password store of pass (https://www.passwordstore.org): a directory of entries,
+// each a file encrypted with GnuPG, named after the entry, such as email/work.gpg for the entry email/work.
+type PassStore struct {
+	Dir string
+}
+
+// DefaultPassStore returns the password store pass uses, in PASSWORD_STORE_DIR, or else ~/.password-store.
+func DefaultPassStore() (*PassStore, error) {
+	if dir := os.Getenv(passStoreEnv); dir != "" {
+		return &PassStore{Dir: dir}, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, errors.Join(errors.New("error finding the password store, give it with --store"), err)
+	}
+	return &PassStore{Dir: filepath.Join(home, ".password-store")}, nil
+}
+
+// File returns the file of an entry.
+func (s *PassStore) File(entry string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(entry)+".gpg")
+}
+
+// Entries returns the entries of the store, in order, that are selected: named, or in a named folder,
+// or all entries, if none are selected. Hidden files, and folders, such as .git, are left out.
+func (s *PassStore) Entries(selected []string) ([]string, error) {
+	if info, err := os.Stat(s.Dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("no password store found at %s", s.Dir)
+	}
+	if len(selected) == 0 {
+		selected = []string{""}
+	}
+
+	var entries []string
+	for _, selection := range selected {
+		selection = strings.Trim(path.Clean("/"+filepath.ToSlash(selection)), "/")
+		if _, err := os.Stat(s.File(selection)); err == nil && selection != "" {
+			entries = append(entries, selection)
+			continue
+		}
+
+		root := filepath.Join(s.Dir, filepath.FromSlash(selection))
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%s is not in the password store", selection)
+		}
+		err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") && file != root {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !strings.HasSuffix(d.Name(), ".gpg") {
+				return nil
+			}
+
+			relative, err := filepath.Rel(s.Dir, file)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, strings.TrimSuffix(filepath.ToSlash(relative), ".gpg"))
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading the password store"), err)
+		}
+	}
+
+	slices.Sort(entries)
+	return slices.Compact(entries), nil
+}
+
+// Recipients returns the keys an entry is encrypted for, listed in the .gpg-id file of its folder,
+// or of the closest folder above it.
+func (s *PassStore) Recipients(entry string) ([]string, error) {
+	for folder := path.Dir(entry); ; folder = path.Dir(folder) {
+		if folder == "." {
+			folder = ""
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(folder), passRecipientsFile))
+		if err == nil {
+			var recipients []string
+			for _, line := range strings.Split(string(data), "\n") {
+				// lines may be commented, as in pass 1.7.4
+				if line, _, _ = strings.Cut(line, "#"); strings.TrimSpace(line) != "" {
+					recipients = append(recipients, strings.TrimSpace(line))
+				}
+			}
+			if len(recipients) == 0 {
+				return nil, fmt.Errorf("%s lists no keys", filepath.Join(s.Dir, filepath.FromSlash(folder), passRecipientsFile))
+			}
+			return recipients, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, errors.Join(fmt.Errorf("error reading the %s file", passRecipientsFile), err)
+		}
+
+		if folder == "" {
+			return nil, fmt.Errorf("the password store at %s is not initialized, run 'pass init <gpg-id>'", s.Dir)
+		}
+	}
+}
+
+// PassEntry is an entry of a password store, by its path in the store, such as email/work.
+type PassEntry struct {
+	Path string `json:"path"`
+	// Content is the decrypted entry, if it is text, or else Binary.
+	Content string `json:"content,omitempty"`
+	Binary  []byte `json:"binary,omitempty"`
+}
+
+// NewPassEntry returns the entry at path, holding the content.
+func NewPassEntry(path string, content []byte) PassEntry {
+	if utf8.Valid(content) {
+		return PassEntry{Path: path, Content: string(content)}
+	}
+
+	return PassEntry{Path: path, Binary: content}
+}
+
+// Data returns the content of the entry.
+func (e PassEntry) Data() []byte {
+	if e.Binary != nil {
+		return e.Binary
+	}
+
+	return []byte(e.Content)
+}
+
+// PassBackup is the data of a document holding entries of a password store, with their paths,
+// so they can be restored in place.
+type PassBackup struct {
+	Entries []PassEntry `json:"pass_entries"`
+}
+
+// ReadPassBackup reads the entries of a document holding entries of a password store.
+// Their paths must stay inside the store.
+func ReadPassBackup(data []byte) (*PassBackup, error) {
+	var backup PassBackup
+	if err := json.Unmarshal(data, &backup); err != nil || backup.Entries == nil {
+		return nil, errors.Join(errors.New("the document does not hold entries of a password store"), err)
+	}
+	for _, entry := range backup.Entries {
+		if entry.Path == "" || !filepath.IsLocal(filepath.FromSlash(entry.Path)) || path.Clean(entry.Path) != entry.Path {
+			return nil, fmt.Errorf("invalid path of a password store entry: '%s'", entry.Path)
+		}
+	}
+
+	return &backup, nil
+}
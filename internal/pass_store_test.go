@@ -0,0 +1,132 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// passTestStore returns a password store of empty entries, with a .gpg-id file at its root, and in the work folder.
+func passTestStore(t *testing.T) *PassStore {
+	t.Helper()
+
+	dir := t.TempDir()
+	for file, content := range map[string]string{
+		".gpg-id":              "owner@example.com\n",
+		"email/home.gpg":       "",
+		"email/work/mail.gpg":  "",
+		"email/work/.gpg-id":   "# the work key\nwork@example.com\n\nbackup@example.com # offline\n",
+		"server.gpg":           "",
+		"notes.txt":            "",
+		".git/objects/abc.gpg": "",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("MkdirAll failed with error %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile failed with error %s", err)
+		}
+	}
+
+	return &PassStore{Dir: dir}
+}
+
+func TestPassStoreEntries(t *testing.T) {
+	store := passTestStore(t)
+
+	for _, test := range []struct {
+		selected []string
+		want     []string
+	}{
+		{nil, []string{"email/home", "email/work/mail", "server"}},
+		{[]string{"email"}, []string{"email/home", "email/work/mail"}},
+		{[]string{"server", "email/work/", "email/work/mail"}, []string{"email/work/mail", "server"}},
+	} {
+		got, err := store.Entries(test.selected)
+		if err != nil {
+			t.Fatalf("Entries failed with error %s", err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Entries(%v) was incorrect, got: %v, want: %v.", test.selected, got, test.want)
+		}
+	}
+
+	if _, err := store.Entries([]string{"missing"}); err == nil {
+		t.Error("Entries did not fail for an entry not in the store")
+	}
+	if _, err := (&PassStore{Dir: filepath.Join(store.Dir, "missing")}).Entries(nil); err == nil {
+		t.Error("Entries did not fail for a missing store")
+	}
+}
+
+func TestPassStoreRecipients(t *testing.T) {
+	store := passTestStore(t)
+
+	for entry, want := range map[string][]string{
+		"server":              {"owner@example.com"},
+		"email/home":          {"owner@example.com"},
+		"email/work/mail":     {"work@example.com", "backup@example.com"},
+		"email/work/new/mail": {"work@example.com", "backup@example.com"},
+	} {
+		got, err := store.Recipients(entry)
+		if err != nil {
+			t.Fatalf("Recipients failed with error %s", err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Recipients(%s) was incorrect, got: %v, want: %v.", entry, got, want)
+		}
+	}
+
+	if _, err := (&PassStore{Dir: t.TempDir()}).Recipients("server"); err == nil || !strings.Contains(err.Error(), "pass init") {
+		t.Errorf("Recipients did not fail for a store without a .gpg-id file, got: %v.", err)
+	}
+}
+
+func TestReadPassBackup(t *testing.T) {
+	text, binary := NewPassEntry("email/work", []byte("hunter2\n")), NewPassEntry("keys/token", []byte{0xff, 0x00})
+	if text.Content != "hunter2\n" || text.Binary != nil || binary.Binary == nil {
+		t.Errorf("NewPassEntry was incorrect, got: %v, and %v, want: text, and binary content.", text, binary)
+	}
+
+	backup, err := ReadPassBackup([]byte(`{"pass_entries": [{"path": "email/work", "content": "hunter2\n"}, {"path": "keys/token", "binary": "/wA="}]}`))
+	if err != nil {
+		t.Fatalf("ReadPassBackup failed with error %s", err)
+	}
+	if len(backup.Entries) != 2 || string(backup.Entries[0].Data()) != "hunter2\n" || !slices.Equal(backup.Entries[1].Data(), []byte{0xff, 0x00}) {
+		t.Errorf("ReadPassBackup was incorrect, got: %v.", backup.Entries)
+	}
+
+	for _, data := range []string{
+		`{"name": "not a password store"}`,
+		`{"pass_entries": [{"path": "../outside", "content": "x"}]}`,
+		`{"pass_entries": [{"path": "/etc/passwd", "content": "x"}]}`,
+		`{"pass_entries": [{"path": "email//work", "content": "x"}]}`,
+	} {
+		if _, err := ReadPassBackup([]byte(data)); err == nil {
+			t.Errorf("ReadPassBackup did not fail for %s", data)
+		}
+	}
+}
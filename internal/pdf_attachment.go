@@ -0,0 +1,124 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// PDF documents carry the JSON serialized document as an attachment (an embedded file),
+// so the document can be restored from the digital PDF without scanning or typing.
+// The printed copy remains the fallback.
+
+const (
+	// PDFAttachmentName is the file name of the attached document, with the serial number.
+	PDFAttachmentName = "papercrypt-%s.json"
+	// PDFAttachmentDescription is the description of the attached document.
+	PDFAttachmentDescription = "PaperCrypt document, restore it using 'papercrypt scan'"
+)
+
+// attachDocument attaches the JSON serialized document to the PDF, unless disabled,
+// or the document is written as PDF/A-2b, which only allows PDF/A attachments.
+func attachDocument(p *core.PaperCrypt, pdf *gofpdf.Fpdf, opts TextOptions) error {
+	if opts.NoAttachment || opts.PDFA {
+		return nil
+	}
+
+	data, err := p.QRPayload(core.QRPayloadFormatJSON)
+	if err != nil {
+		return errors.Join(errors.New("error serializing the pdf attachment"), err)
+	}
+
+	pdf.SetAttachments([]gofpdf.Attachment{{
+		Content:     data,
+		Filename:    fmt.Sprintf(PDFAttachmentName, p.SerialNumber),
+		Description: PDFAttachmentDescription,
+	}})
+
+	return nil
+}
+
+// ExtractPDFAttachment returns the JSON serialized document attached to a PDF generated by PaperCrypt.
+// ok is false if the PDF has no such attachment, such as scanned documents.
+func ExtractPDFAttachment(data []byte) (attachment []byte, ok bool, err error) {
+	doc, err := readPDFDocument(data)
+	if err != nil {
+		return nil, false, errors.Join(errors.New("error reading the pdf"), err)
+	}
+
+	names := doc.dict(doc.dict(doc.dict(doc.trailer, "Root"), "Names"), "EmbeddedFiles")
+	entries := doc.array(names, "Names")
+	// the name tree holds pairs of names and file specifications
+	for i := 1; i < len(entries); i += 2 {
+		spec, _ := doc.resolve(entries[i]).(pdfDict)
+		if spec == nil {
+			continue
+		}
+
+		name, _ := doc.resolve(spec["UF"]).(string)
+		if name == "" {
+			name, _ = doc.resolve(spec["F"]).(string)
+		}
+		name = pdfTextString(name)
+		if !strings.HasPrefix(name, "papercrypt-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		stream, _ := doc.resolve(doc.dict(spec, "EF")["F"]).(*pdfStream)
+		if stream == nil {
+			return nil, false, fmt.Errorf("pdf attachment %s has no content", name)
+		}
+
+		attachment, err = doc.decode(stream)
+		if err != nil {
+			return nil, false, errors.Join(fmt.Errorf("error reading pdf attachment %s", name), err)
+		}
+
+		return attachment, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// pdfTextString decodes a PDF text string, which is either UTF-16BE with a byte order mark, or PDFDocEncoding.
+// Characters of PDFDocEncoding beyond ASCII are decoded as Latin-1.
+func pdfTextString(s string) string {
+	if len(s) < 2 || s[0] != 0xFE || s[1] != 0xFF {
+		runes := make([]rune, len(s))
+		for i := 0; i < len(s); i++ {
+			runes[i] = rune(s[i])
+		}
+		return string(runes)
+	}
+
+	units := make([]uint16, 0, (len(s)-2)/2)
+	for i := 2; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+
+	return string(utf16.Decode(units))
+}
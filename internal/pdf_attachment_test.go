@@ -0,0 +1,74 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestPDFAttachment(t *testing.T) {
+	loadFonts(t)
+
+	pc := core.NewPaperCrypt("2.0.0", []byte("attached data"), "ABCDEF", "Purpose", "", time.Now(), core.PaperCryptDataFormatRaw)
+	doc, err := GetPDF(pc, false, TextOptions{Duplex: DuplexLongEdge})
+	if err != nil {
+		t.Fatalf("GetPDF failed with error %s", err)
+	}
+
+	attachment, ok, err := ExtractPDFAttachment(doc)
+	if err != nil {
+		t.Fatalf("ExtractPDFAttachment failed with error %s", err)
+	}
+	if !ok {
+		t.Fatal("The PDF should carry the document as an attachment")
+	}
+
+	restored, err := core.DeserializeQRPayload(attachment)
+	if err != nil {
+		t.Fatalf("DeserializeQRPayload failed with error %s", err)
+	}
+	if restored.SerialNumber != pc.SerialNumber || !bytes.Equal(restored.Data, pc.Data) {
+		t.Errorf("got: %s %q, want: %s %q.", restored.SerialNumber, restored.Data, pc.SerialNumber, pc.Data)
+	}
+
+	for _, opts := range []TextOptions{{NoAttachment: true}, {PDFA: true}} {
+		doc, err := GetPDF(pc, false, opts)
+		if err != nil {
+			t.Fatalf("GetPDF failed with error %s", err)
+		}
+		if _, ok, _ := ExtractPDFAttachment(doc); ok {
+			t.Errorf("The PDF should not carry an attachment with options %+v", opts)
+		}
+	}
+}
+
+func TestPDFTextString(t *testing.T) {
+	if got := pdfTextString("\xfe\xff\x00a\x00\xe4"); got != "aä" {
+		t.Errorf("got: %q, want: %q.", got, "aä")
+	}
+	if got := pdfTextString("a\xe4"); got != "aä" {
+		t.Errorf("got: %q, want: %q.", got, "aä")
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// PdfDataFont is the name of the font the header and data lines are printed in, if set in TextOptions.
+	PdfDataFont = "Data"
+
+	// MinDataFontSize and MaxDataFontSize limit the font size of the header and data lines, in pt.
+	MinDataFontSize = 6.0
+	MaxDataFontSize = 20.0
+)
+
+// LoadTrueTypeFont reads a TrueType font file, to print the data block in.
+// OpenType fonts with CFF outlines (.otf) are not supported by the PDF generator.
+func LoadTrueTypeFont(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading font"), err)
+	}
+
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%s is not a TrueType font", path)
+	}
+	switch version := data[:4]; {
+	case bytes.Equal(version, []byte{0, 1, 0, 0}), bytes.Equal(version, []byte("true")):
+		return data, nil
+	case bytes.Equal(version, []byte("OTTO")):
+		return nil, fmt.Errorf("%s is an OpenType font with CFF outlines, which is not supported, use a TrueType (.ttf) font", path)
+	default:
+		return nil, fmt.Errorf("%s is not a TrueType font", path)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTrueTypeFont(t *testing.T) {
+	if _, err := LoadTrueTypeFont("../font/Inconsolata/static/Inconsolata-Medium.ttf"); err != nil {
+		t.Errorf("LoadTrueTypeFont failed with error %s", err)
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"cff.otf":   append([]byte("OTTO"), make([]byte, 16)...),
+		"text.ttf":  []byte("not a font"),
+		"empty.ttf": nil,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("WriteFile failed with error %s", err)
+		}
+		if _, err := LoadTrueTypeFont(path); err == nil {
+			t.Errorf("LoadTrueTypeFont should have rejected %s", name)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/caarlos0/log"
+)
+
+// PDFMagic starts every PDF file.
+const PDFMagic = "%PDF-"
+
+var (
+	pdfObjectStart     = regexp.MustCompile(`\d+\s+\d+\s+obj\s*<<`)
+	pdfImageSubtype    = regexp.MustCompile(`/Subtype\s*/Image\b`)
+	pdfImageMask       = regexp.MustCompile(`/ImageMask\s+true\b`)
+	pdfFilter          = regexp.MustCompile(`/Filter\s*\[?\s*/(\w+)\s*\]?`)
+	pdfLength          = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfBitsPerComp     = regexp.MustCompile(`/BitsPerComponent\s+(\d+)`)
+	pdfWidth           = regexp.MustCompile(`/Width\s+(\d+)`)
+	pdfHeight          = regexp.MustCompile(`/Height\s+(\d+)`)
+	pdfPredictor       = regexp.MustCompile(`/Predictor\s+(\d+)`)
+	pdfStreamKeyword   = regexp.MustCompile(`^\s*stream\r?\n`)
+	pdfEndStreamSuffix = regexp.MustCompile(`\r?\n?endstream`)
+)
+
+// IsPDF returns whether the data is a PDF file.
+// Like PDF readers, it accepts the header anywhere in the first 1024 bytes,
+// as gofpdf writes operators set before the first page in front of it.
+func IsPDF(data []byte) bool {
+	return bytes.Contains(data[:min(len(data), 1024)], []byte(PDFMagic))
+}
+
+// ExtractPDFImages returns the images embedded in a PDF file, in the order they are stored.
+// Scanners store every page as an image, so scanned documents can be read without rendering the PDF.
+// JPEG images, and Flate compressed gray or RGB images of 1 or 8 bits per component are supported,
+// other images (such as CCITT fax compressed ones) are skipped.
+func ExtractPDFImages(data []byte) ([]image.Image, error) {
+	if !IsPDF(data) {
+		return nil, errors.New("not a PDF file")
+	}
+
+	var images []image.Image
+	for _, loc := range pdfObjectStart.FindAllIndex(data, -1) {
+		dictStart := loc[1] - 2
+		dictEnd := pdfDictionaryEnd(data, dictStart)
+		if dictEnd < 0 {
+			continue
+		}
+
+		dict := data[dictStart:dictEnd]
+		if !pdfImageSubtype.Match(dict) || pdfImageMask.Match(dict) {
+			continue
+		}
+
+		stream, ok := pdfStreamData(data[dictEnd:], dict)
+		if !ok {
+			continue
+		}
+
+		img, err := decodePDFImage(dict, stream)
+		if err != nil {
+			log.WithError(err).Debug("skipping PDF image")
+			continue
+		}
+
+		images = append(images, img)
+	}
+
+	if len(images) == 0 {
+		return nil, errors.New("no supported images found in the PDF file, it may have to be converted to images first")
+	}
+
+	return images, nil
+}
+
+// pdfDictionaryEnd returns the index after the dictionary starting at `start`, or -1.
+func pdfDictionaryEnd(data []byte, start int) int {
+	depth := 0
+	for i := start; i < len(data)-1; i++ {
+		switch {
+		case data[i] == '<' && data[i+1] == '<':
+			depth++
+			i++
+		case data[i] == '>' && data[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return -1
+}
+
+// pdfStreamData returns the (still encoded) data of the stream following a dictionary.
+func pdfStreamData(data []byte, dict []byte) ([]byte, bool) {
+	keyword := pdfStreamKeyword.FindIndex(data)
+	if keyword == nil {
+		return nil, false
+	}
+	data = data[keyword[1]:]
+
+	// direct lengths are exact, indirect ones would have to be resolved, so the end marker is searched instead
+	if match := pdfLength.FindSubmatch(dict); match != nil && len(match[2]) == 0 {
+		length, err := strconv.Atoi(string(match[1]))
+		if err == nil && length <= len(data) {
+			return data[:length], true
+		}
+	}
+
+	end := pdfEndStreamSuffix.FindIndex(data)
+	if end == nil {
+		return nil, false
+	}
+
+	return data[:end[0]], true
+}
+
+func pdfInt(re *regexp.Regexp, dict []byte, fallback int) int {
+	match := re.FindSubmatch(dict)
+	if match == nil {
+		return fallback
+	}
+
+	value, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+func decodePDFImage(dict []byte, stream []byte) (image.Image, error) {
+	filter := ""
+	if match := pdfFilter.FindSubmatch(dict); match != nil {
+		filter = string(match[1])
+	}
+
+	switch filter {
+	case "DCTDecode":
+		return jpeg.Decode(bytes.NewReader(stream))
+	case "FlateDecode", "":
+	default:
+		return nil, fmt.Errorf("unsupported PDF image filter %s", filter)
+	}
+
+	if filter == "FlateDecode" {
+		r, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			return nil, errors.Join(errors.New("error decompressing PDF image"), err)
+		}
+
+		stream, err = io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Join(errors.New("error decompressing PDF image"), err)
+		}
+	}
+
+	width, height := pdfInt(pdfWidth, dict, 0), pdfInt(pdfHeight, dict, 0)
+	bits := pdfInt(pdfBitsPerComp, dict, 8)
+	if width <= 0 || height <= 0 || (bits != 1 && bits != 8) {
+		return nil, fmt.Errorf("unsupported PDF image of %dx%d pixels, %d bits per component", width, height, bits)
+	}
+
+	// PNG predictors prefix every row with a filter type byte
+	predictor := pdfInt(pdfPredictor, dict, 1) >= 10
+	rowPrefix := 0
+	if predictor {
+		rowPrefix = 1
+	}
+
+	// the number of components is derived from the data, as color spaces may be indirect references
+	components := (len(stream)/height - rowPrefix) * 8 / bits / width
+	if components != 1 && components != 3 {
+		return nil, fmt.Errorf("unsupported PDF image with %d components", components)
+	}
+
+	rowBytes := (width*components*bits + 7) / 8
+	if len(stream) < height*(rowBytes+rowPrefix) {
+		return nil, errors.New("PDF image data is too short")
+	}
+
+	rows := stream
+	if predictor {
+		var err error
+		rows, err = unfilterPNGRows(stream, height, rowBytes, max(1, components*bits/8))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rasterImage(rows, width, height, components, bits, false), nil
+}
+
+// unfilterPNGRows reverses the PNG row filters, as used by the PNG predictors of PDF and TIFF images.
+func unfilterPNGRows(data []byte, height, rowBytes, bytesPerPixel int) ([]byte, error) {
+	out := make([]byte, height*rowBytes)
+	prev := make([]byte, rowBytes)
+	for y := 0; y < height; y++ {
+		filterType := data[y*(rowBytes+1)]
+		src := data[y*(rowBytes+1)+1 : (y+1)*(rowBytes+1)]
+		row := out[y*rowBytes : (y+1)*rowBytes]
+
+		for x := 0; x < rowBytes; x++ {
+			var left, upLeft byte
+			if x >= bytesPerPixel {
+				left, upLeft = row[x-bytesPerPixel], prev[x-bytesPerPixel]
+			}
+			up := prev[x]
+
+			switch filterType {
+			case 0:
+				row[x] = src[x]
+			case 1:
+				row[x] = src[x] + left
+			case 2:
+				row[x] = src[x] + up
+			case 3:
+				row[x] = src[x] + byte((int(left)+int(up))/2)
+			case 4:
+				row[x] = src[x] + paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("unknown PNG row filter %d", filterType)
+			}
+		}
+
+		prev = row
+	}
+
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// rasterImage creates an image from rows of gray (1 component) or RGB (3 components) pixels,
+// of 1 or 8 bits per component. With whiteIsZero, gray values are inverted.
+func rasterImage(rows []byte, width, height, components, bits int, whiteIsZero bool) image.Image {
+	rowBytes := (width*components*bits + 7) / 8
+
+	if components == 3 {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			row := rows[y*rowBytes:]
+			for x := 0; x < width; x++ {
+				img.SetRGBA(x, y, color.RGBA{R: row[3*x], G: row[3*x+1], B: row[3*x+2], A: 0xFF})
+			}
+		}
+
+		return img
+	}
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := rows[y*rowBytes:]
+		for x := 0; x < width; x++ {
+			var value byte
+			if bits == 1 {
+				value = 0xFF * (row[x/8] >> (7 - x%8) & 1)
+			} else {
+				value = row[x]
+			}
+			if whiteIsZero {
+				value = 0xFF - value
+			}
+
+			img.SetGray(x, y, color.Gray{Y: value})
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,120 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testPDF builds a minimal PDF file holding the given image XObjects.
+func testPDF(objects ...string) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("%PDF-1.4\n")
+	for i, object := range objects {
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	buf.WriteString("trailer\n<< /Size 1 >>\n%%EOF\n")
+
+	return buf.Bytes()
+}
+
+func testImageObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< /Type /XObject /Subtype /Image %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func TestExtractPDFImages(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			gray.SetGray(x, y, color.Gray{Y: uint8(x * 16)})
+		}
+	}
+
+	jpegData := new(bytes.Buffer)
+	if err := jpeg.Encode(jpegData, gray, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// rows with PNG "up" and "sub" filters
+	var rows []byte
+	for y := 0; y < 8; y++ {
+		if y == 0 {
+			rows = append(rows, 1)
+			for x := 0; x < 16; x++ {
+				if x == 0 {
+					rows = append(rows, 0)
+				} else {
+					rows = append(rows, 16)
+				}
+			}
+			continue
+		}
+
+		rows = append(rows, 2)
+		rows = append(rows, make([]byte, 16)...)
+	}
+	flateData := new(bytes.Buffer)
+	w := zlib.NewWriter(flateData)
+	w.Write(rows)
+	w.Close()
+
+	pdf := testPDF(
+		"<< /Type /Catalog >>",
+		testImageObject("/Width 16 /Height 8 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode", jpegData.Bytes()),
+		testImageObject("/Width 16 /Height 8 /ColorSpace [/ICCBased 5 0 R] /BitsPerComponent 8 /Filter /FlateDecode /DecodeParms << /Predictor 15 /Colors 1 /Columns 16 >>", flateData.Bytes()),
+		testImageObject("/Width 16 /Height 8 /ImageMask true /BitsPerComponent 1", make([]byte, 16)),
+		testImageObject("/Width 16 /Height 8 /BitsPerComponent 1 /Filter /CCITTFaxDecode", make([]byte, 16)),
+	)
+
+	images, err := ExtractPDFImages(pdf)
+	if err != nil {
+		t.Fatalf("ExtractPDFImages failed with error %s", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("got: %d images, want: 2 images.", len(images))
+	}
+
+	for i, img := range images {
+		if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 8 {
+			t.Errorf("Image %d has the wrong size, got: %v.", i+1, img.Bounds())
+		}
+
+		for x := 0; x < 16; x++ {
+			got := color.GrayModel.Convert(img.At(x, 7)).(color.Gray).Y
+			if diff := int(got) - x*16; diff < -4 || diff > 4 {
+				t.Errorf("Image %d differs at x=%d, got: %d, want: %d.", i+1, x, got, x*16)
+			}
+		}
+	}
+
+	if _, err := ExtractPDFImages([]byte("not a PDF")); err == nil {
+		t.Errorf("ExtractPDFImages should fail for other files")
+	}
+	if _, err := ExtractPDFImages(testPDF("<< /Type /Catalog >>")); err == nil {
+		t.Errorf("ExtractPDFImages should fail for PDF files without images")
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"math"
+
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+const (
+	// pdfBannerHeight is the height of the classification banners at the top and bottom of each page, in mm.
+	pdfBannerHeight = 6.0
+
+	// pdfWatermarkGray is the brightness of the watermark, light enough not to be taken for a corner marker,
+	// or to hide the data printed over it.
+	pdfWatermarkGray = 235
+
+	// pdfWatermarkMaxFontSize limits the size of short watermarks, in pt.
+	pdfWatermarkMaxFontSize = 120.0
+)
+
+// drawWatermark prints text in large, light grey letters diagonally across the current page,
+// from the bottom left to the top right corner.
+func drawWatermark(pdf *gofpdf.Fpdf, page core.Page, text string) {
+	width, height := page.Dimensions()
+	centerX, centerY := width/2, height/2
+
+	pdf.SetFont(PdfTextFont, "B", 100)
+	size := 100 * 0.7 * math.Hypot(width, height) / max(pdf.GetStringWidth(text), 1)
+	pdf.SetFont(PdfTextFont, "B", min(size, pdfWatermarkMaxFontSize))
+
+	r, g, b := pdf.GetTextColor()
+	pdf.SetTextColor(pdfWatermarkGray, pdfWatermarkGray, pdfWatermarkGray)
+	pdf.TransformBegin()
+	pdf.TransformRotate(math.Atan2(height, width)*180/math.Pi, centerX, centerY)
+	_, fontHeight := pdf.GetFontSize()
+	pdf.Text(centerX-pdf.GetStringWidth(text)/2, centerY+fontHeight/3, text)
+	pdf.TransformEnd()
+	pdf.SetTextColor(r, g, b)
+}
+
+// drawBanner prints a classification banner, white bold text on a black strip across the content width, at y.
+func drawBanner(pdf *gofpdf.Fpdf, page core.Page, text string, y float64) {
+	fr, fg, fb := pdf.GetFillColor()
+	tr, tg, tb := pdf.GetTextColor()
+
+	pdf.SetY(y)
+	pdf.SetFillColor(0, 0, 0)
+	pdf.SetTextColor(0xFF, 0xFF, 0xFF)
+	pdf.SetFont(PdfTextFont, "B", 10)
+	pdf.CellFormat(page.ContentWidth(), pdfBannerHeight-1, text, "", 0, "C", true, 0, "")
+
+	pdf.SetFillColor(fr, fg, fb)
+	pdf.SetTextColor(tr, tg, tb)
+}
@@ -0,0 +1,366 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// N-up layouts place the pages of several documents on one sheet of paper, which is cut apart after printing.
+// Every page is copied as a form XObject, scaled to fit its cell, so the documents are not rendered again.
+
+// NUpLayouts lists the supported numbers of pages per sheet.
+var NUpLayouts = []int{2, 4}
+
+// nupGuideGray is the gray level of the cutting guides, light enough not to be mistaken for content.
+const nupGuideGray = 0.6
+
+// NUpPDF places the pages of PDF documents written by PaperCrypt n pages per sheet, with cutting guides between them.
+// Sheets have the size of the first page: for two pages per sheet it is turned sideways, and pages are shrunk to half its area,
+// for four pages per sheet they are shrunk to a quarter.
+func NUpPDF(docs [][]byte, n int) ([]byte, error) {
+	if !slices.Contains(NUpLayouts, n) {
+		return nil, fmt.Errorf("unsupported number of pages per sheet %d, must be one of %v", n, NUpLayouts)
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("no documents to combine")
+	}
+
+	w := &pdfWriter{}
+	var forms []pdfRef
+	var boxes [][]float64
+	for i, data := range docs {
+		doc, err := readPDFDocument(data)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading document %d", i+1), err)
+		}
+
+		pages, err := doc.pages()
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading pages of document %d", i+1), err)
+		}
+
+		copied := make(map[int]pdfRef)
+		for _, page := range pages {
+			form, box, err := w.copyPage(doc, page, copied)
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("error copying page of document %d", i+1), err)
+			}
+			forms = append(forms, form)
+			boxes = append(boxes, box)
+		}
+	}
+
+	if len(forms) == 0 {
+		return nil, errors.New("the documents have no pages")
+	}
+
+	width, height := boxes[0][2]-boxes[0][0], boxes[0][3]-boxes[0][1]
+	columns, rows := 2, 2
+	if n == 2 {
+		width, height = height, width
+		columns, rows = 2, 1
+		if height > width {
+			columns, rows = 1, 2
+		}
+	}
+	cellWidth, cellHeight := width/float64(columns), height/float64(rows)
+
+	pagesRef := w.reserve()
+	var kids []any
+	for first := 0; first < len(forms); first += n {
+		var content bytes.Buffer
+		resources := make(pdfDict)
+		for i := first; i < min(first+n, len(forms)); i++ {
+			box := boxes[i]
+			boxWidth, boxHeight := box[2]-box[0], box[3]-box[1]
+			scale := min(cellWidth/boxWidth, cellHeight/boxHeight)
+
+			// cells are filled left to right, top to bottom, pages are centered in their cell
+			column, row := (i-first)%columns, (i-first)/columns
+			x := float64(column)*cellWidth + (cellWidth-scale*boxWidth)/2 - scale*box[0]
+			y := height - float64(row+1)*cellHeight + (cellHeight-scale*boxHeight)/2 - scale*box[1]
+
+			name := pdfName("P" + strconv.Itoa(i-first+1))
+			resources[name] = forms[i]
+			fmt.Fprintf(&content, "q %s 0 0 %s %s %s cm /%s Do Q\n", pdfNumber(scale), pdfNumber(scale), pdfNumber(x), pdfNumber(y), name)
+		}
+
+		// dashed cutting guides across the whole sheet
+		fmt.Fprintf(&content, "q %s G 0.5 w [4 4] 0 d\n", pdfNumber(nupGuideGray))
+		for column := 1; column < columns; column++ {
+			x := pdfNumber(float64(column) * cellWidth)
+			fmt.Fprintf(&content, "%s 0 m %s %s l S\n", x, x, pdfNumber(height))
+		}
+		for row := 1; row < rows; row++ {
+			y := pdfNumber(float64(row) * cellHeight)
+			fmt.Fprintf(&content, "0 %s m %s %s l S\n", y, pdfNumber(width), y)
+		}
+		content.WriteString("Q\n")
+
+		contents, err := w.addStream(pdfDict{}, content.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		kids = append(kids, w.add(pdfDict{
+			"Type":      pdfName("Page"),
+			"Parent":    pagesRef,
+			"MediaBox":  []any{0.0, 0.0, width, height},
+			"Resources": pdfDict{"XObject": resources},
+			"Contents":  contents,
+		}))
+	}
+
+	w.set(pagesRef, pdfDict{"Type": pdfName("Pages"), "Kids": kids, "Count": float64(len(kids))})
+	root := w.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pagesRef})
+	info := w.add(pdfDict{"Producer": "PaperCrypt/" + core.VersionInfo.GitVersion})
+
+	return w.bytes(root, info), nil
+}
+
+// pdfWriter writes a PDF document from objects as read by pdfDocument.
+type pdfWriter struct {
+	objects []any
+}
+
+// add adds an indirect object, and returns a reference to it.
+func (w *pdfWriter) add(object any) pdfRef {
+	w.objects = append(w.objects, object)
+	return pdfRef{Number: len(w.objects)}
+}
+
+// reserve returns a reference to an object that is set later.
+func (w *pdfWriter) reserve() pdfRef {
+	return w.add(nil)
+}
+
+func (w *pdfWriter) set(ref pdfRef, object any) {
+	w.objects[ref.Number-1] = object
+}
+
+// addStream adds a stream of data, compressing it.
+func (w *pdfWriter) addStream(dict pdfDict, data []byte) (pdfRef, error) {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return pdfRef{}, errors.Join(errors.New("error compressing stream"), err)
+	}
+	if err := writer.Close(); err != nil {
+		return pdfRef{}, errors.Join(errors.New("error compressing stream"), err)
+	}
+
+	dict["Filter"] = pdfName("FlateDecode")
+	return w.add(&pdfStream{Dict: dict, Data: compressed.Bytes()}), nil
+}
+
+// copyPage copies a page of doc as a form XObject, returning it and the media box of the page.
+// Objects referenced by the page are copied once per document, copied maps their numbers in doc to the copies.
+func (w *pdfWriter) copyPage(doc *pdfDocument, page pdfDict, copied map[int]pdfRef) (pdfRef, []float64, error) {
+	box := []float64{0, 0, 595.28, 841.89}
+	if mediaBox := doc.array(page, "MediaBox"); len(mediaBox) == 4 {
+		for i, v := range mediaBox {
+			value, ok := doc.resolve(v).(float64)
+			if !ok {
+				return pdfRef{}, nil, errors.New("invalid media box")
+			}
+			box[i] = value
+		}
+	}
+
+	var contents []any
+	switch v := doc.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		contents = []any{v}
+	case []any:
+		contents = v
+	}
+
+	var content []byte
+	for _, part := range contents {
+		stream, ok := doc.resolve(part).(*pdfStream)
+		if !ok {
+			return pdfRef{}, nil, errors.New("invalid page contents")
+		}
+
+		data, err := doc.decode(stream)
+		if err != nil {
+			return pdfRef{}, nil, errors.Join(errors.New("error decoding page contents"), err)
+		}
+		content = append(append(content, data...), '\n')
+	}
+
+	form, err := w.addStream(pdfDict{
+		"Type":      pdfName("XObject"),
+		"Subtype":   pdfName("Form"),
+		"BBox":      []any{box[0], box[1], box[2], box[3]},
+		"Resources": w.copyObject(doc, page["Resources"], copied, 0),
+	}, content)
+
+	return form, box, err
+}
+
+// copyObject copies an object of doc, including the objects it references.
+func (w *pdfWriter) copyObject(doc *pdfDocument, object any, copied map[int]pdfRef, depth int) any {
+	if depth > 32 {
+		return nil
+	}
+
+	switch v := object.(type) {
+	case pdfRef:
+		if ref, ok := copied[v.Number]; ok {
+			return ref
+		}
+
+		ref := w.reserve()
+		copied[v.Number] = ref
+		w.set(ref, w.copyObject(doc, doc.objects[v.Number], copied, depth+1))
+		return ref
+	case pdfDict:
+		dict := make(pdfDict, len(v))
+		for key, value := range v {
+			dict[key] = w.copyObject(doc, value, copied, depth+1)
+		}
+		return dict
+	case []any:
+		array := make([]any, len(v))
+		for i, value := range v {
+			array[i] = w.copyObject(doc, value, copied, depth+1)
+		}
+		return array
+	case *pdfStream:
+		return &pdfStream{Dict: w.copyObject(doc, v.Dict, copied, depth+1).(pdfDict), Data: v.Data}
+	default:
+		return v
+	}
+}
+
+// bytes returns the document, with the given catalog and document information.
+func (w *pdfWriter) bytes(root, info pdfRef) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n" + pdfBinaryComment)
+
+	offsets := make([]int, len(w.objects))
+	for i, object := range w.objects {
+		offsets[i] = buf.Len()
+		writePDFIndirectObject(&buf, i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	buf.WriteString("trailer\n")
+	writePDFObject(&buf, pdfDict{"Size": float64(len(w.objects) + 1), "Root": root, "Info": info})
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	return buf.Bytes()
+}
+
+// writePDFIndirectObject writes object as the indirect object of the given number, streams with their length.
+func writePDFIndirectObject(buf *bytes.Buffer, number int, object any) {
+	fmt.Fprintf(buf, "%d 0 obj\n", number)
+	if stream, ok := object.(*pdfStream); ok {
+		dict := make(pdfDict, len(stream.Dict)+1)
+		for key, value := range stream.Dict {
+			dict[key] = value
+		}
+		dict["Length"] = float64(len(stream.Data))
+		writePDFObject(buf, dict)
+		buf.WriteString("\nstream\n")
+		buf.Write(stream.Data)
+		buf.WriteString("\nendstream")
+	} else {
+		writePDFObject(buf, object)
+	}
+	buf.WriteString("\nendobj\n")
+}
+
+// writePDFObject writes a direct object. Strings are written as hex strings, so they need no escaping.
+func writePDFObject(buf *bytes.Buffer, object any) {
+	switch v := object.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case float64:
+		buf.WriteString(pdfNumber(v))
+	case string:
+		fmt.Fprintf(buf, "<%X>", v)
+	case pdfName:
+		buf.WriteString("/" + pdfNameEscape(string(v)))
+	case pdfOperator:
+		buf.WriteString(string(v))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", v.Number, v.Generation)
+	case []any:
+		buf.WriteByte('[')
+		for i, value := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFObject(buf, value)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		// keys are sorted, so documents are reproducible
+		keys := make([]pdfName, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		buf.WriteString("<<")
+		for _, key := range keys {
+			writePDFObject(buf, key)
+			buf.WriteByte(' ')
+			writePDFObject(buf, v[key])
+		}
+		buf.WriteString(">>")
+	}
+}
+
+// pdfNumber formats a number, using as few digits as needed.
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// pdfNameEscape escapes the characters of a name that are not regular characters.
+func pdfNameEscape(name string) string {
+	var escaped []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < '!' || c > '~' || c == '#' || isPDFDelimiter(c) {
+			escaped = append(escaped, fmt.Sprintf("#%02X", c)...)
+		} else {
+			escaped = append(escaped, c)
+		}
+	}
+
+	return string(escaped)
+}
@@ -0,0 +1,76 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"image"
+	"testing"
+)
+
+func TestNUpPDF(t *testing.T) {
+	doc := rasterTestPDF(t)
+
+	combined, err := NUpPDF([][]byte{doc, doc}, 4)
+	if err != nil {
+		t.Fatalf("NUpPDF failed with error %s", err)
+	}
+
+	// the A5 pages are shrunk to half their size, in a 2 by 2 grid, at 10 pixels per mm
+	var sheets []*image.RGBA
+	err = RasterizePDF(combined, 254, func(_, _ int, img *image.RGBA) error {
+		sheets = append(sheets, img)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RasterizePDF failed with error %s", err)
+	}
+	if len(sheets) != 1 || sheets[0].Bounds().Dx() != 1485 {
+		t.Fatalf("got: %d sheets, want: 1 A5 sheet.", len(sheets))
+	}
+	for _, p := range []image.Point{{100, 100}, {100, 1150}} {
+		if c := sheets[0].RGBAAt(p.X, p.Y); c.R != 0 || c.G != 0 || c.B != 0 {
+			t.Errorf("Pixel %v should be black, got: %v", p, c)
+		}
+	}
+	if c := sheets[0].RGBAAt(840, 100); c.R != 0xFF {
+		t.Errorf("The second page is blank, got: %v", c)
+	}
+
+	combined, err = NUpPDF([][]byte{doc}, 2)
+	if err != nil {
+		t.Fatalf("NUpPDF failed with error %s", err)
+	}
+	pdf, err := readPDFDocument(combined)
+	if err != nil {
+		t.Fatalf("readPDFDocument failed with error %s", err)
+	}
+	pages, err := pdf.pages()
+	if err != nil {
+		t.Fatalf("pages failed with error %s", err)
+	}
+	if box := pdf.array(pages[0], "MediaBox"); len(pages) != 1 || box[2].(float64) <= box[3].(float64) {
+		t.Errorf("got: %d sheets of %v, want: 1 landscape sheet.", len(pages), box)
+	}
+
+	if _, err := NUpPDF([][]byte{doc}, 3); err == nil {
+		t.Errorf("NUpPDF should fail for 3 pages per sheet")
+	}
+}
@@ -0,0 +1,841 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+)
+
+// DefaultRasterDPI is the default resolution of raster images of documents, in dots per inch.
+const DefaultRasterDPI = 300
+
+// MaxRasterDPI is the highest supported resolution of raster images, an A4 page at this resolution takes about 560 MB of memory.
+const MaxRasterDPI = 1200
+
+// RasterizePDF renders the pages of a PDF document written by PaperCrypt as images, with the given resolution.
+// Each page is passed to write as it is rendered, along with the number of pages, so only one page is held in memory at a time.
+// Only the features of PDF used by PaperCrypt are supported: paths, images, and text in embedded TrueType fonts.
+func RasterizePDF(doc []byte, dpi float64, write func(page, pages int, img *image.RGBA) error) error {
+	if dpi <= 0 || dpi > MaxRasterDPI {
+		return fmt.Errorf("resolution must be between 1 and %d dpi", MaxRasterDPI)
+	}
+
+	pdf, err := readPDFDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	pages, err := pdf.pages()
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return errors.New("PDF document has no pages")
+	}
+
+	fonts := make(map[pdfRef]*rasterFont)
+	for i, page := range pages {
+		img, err := pdf.renderPage(page, dpi, fonts)
+		if err != nil {
+			return errors.Join(fmt.Errorf("error rendering page %d", i+1), err)
+		}
+
+		if err := write(i+1, len(pages), img); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EncodePNG encodes an image as PNG, recording its resolution, so that it is printed at its original size.
+func EncodePNG(img image.Image, dpi float64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errors.Join(errors.New("error encoding PNG image"), err)
+	}
+
+	// the pHYs chunk holds the pixels per meter, it follows the IHDR chunk, which is always first
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	data := buf.Bytes()
+	if len(data) < ihdrEnd {
+		return nil, errors.New("invalid PNG image")
+	}
+
+	pixelsPerMeter := uint32(math.Round(dpi / 0.0254))
+	chunk := []byte("pHYs")
+	chunk = binary.BigEndian.AppendUint32(chunk, pixelsPerMeter)
+	chunk = binary.BigEndian.AppendUint32(chunk, pixelsPerMeter)
+	chunk = append(chunk, 1) // unit: meter
+
+	phys := binary.BigEndian.AppendUint32(nil, uint32(len(chunk)-4))
+	phys = append(phys, chunk...)
+	phys = binary.BigEndian.AppendUint32(phys, crc32.ChecksumIEEE(chunk))
+
+	return append(append(append(make([]byte, 0, len(data)+len(phys)), data[:ihdrEnd]...), phys...), data[ihdrEnd:]...), nil
+}
+
+// rasterFont is a font of a PDF document, ready for drawing.
+type rasterFont struct {
+	font *trueTypeFont
+
+	// gids maps character codes to glyphs, nil for the identity mapping.
+	gids []uint16
+
+	widths       map[int]float64
+	defaultWidth float64
+}
+
+// gid returns the glyph for a character code.
+func (f *rasterFont) gid(code int) int {
+	if f.gids == nil {
+		return code
+	}
+	if code >= len(f.gids) {
+		return 0
+	}
+
+	return int(f.gids[code])
+}
+
+// width returns the advance width of a character code, in thousandths of the font size.
+func (f *rasterFont) width(code int) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+
+	return f.defaultWidth
+}
+
+// font loads a Type0 font with a TrueType font program (as written by gofpdf for UTF-8 fonts).
+func (d *pdfDocument) font(ref any) (*rasterFont, error) {
+	dict, _ := d.resolve(ref).(pdfDict)
+	if dict == nil || dict["Subtype"] != pdfName("Type0") {
+		return nil, fmt.Errorf("unsupported font %v, only embedded TrueType fonts are supported", dict["BaseFont"])
+	}
+
+	descendants := d.array(dict, "DescendantFonts")
+	if len(descendants) != 1 {
+		return nil, errors.New("font has no descendant font")
+	}
+	cidFont, _ := d.resolve(descendants[0]).(pdfDict)
+	if cidFont == nil || cidFont["Subtype"] != pdfName("CIDFontType2") {
+		return nil, fmt.Errorf("unsupported font %v, only embedded TrueType fonts are supported", dict["BaseFont"])
+	}
+
+	program, _ := d.resolve(d.dict(cidFont, "FontDescriptor")["FontFile2"]).(*pdfStream)
+	if program == nil {
+		return nil, fmt.Errorf("font %v is not embedded", dict["BaseFont"])
+	}
+	data, err := d.decode(program)
+	if err != nil {
+		return nil, err
+	}
+
+	font := &rasterFont{widths: make(map[int]float64), defaultWidth: d.number(cidFont, "DW", 1000)}
+	font.font, err = parseTrueType(data)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error reading font %v", dict["BaseFont"]), err)
+	}
+
+	if cidToGID, ok := d.resolve(cidFont["CIDToGIDMap"]).(*pdfStream); ok {
+		data, err := d.decode(cidToGID)
+		if err != nil {
+			return nil, err
+		}
+
+		font.gids = make([]uint16, len(data)/2)
+		for i := range font.gids {
+			font.gids[i] = binary.BigEndian.Uint16(data[2*i:])
+		}
+	}
+
+	// widths are given as "first [w1 w2 ...]" or "first last w"
+	widths := d.array(cidFont, "W")
+	for i := 0; i+1 < len(widths); {
+		first, _ := d.resolve(widths[i]).(float64)
+		if list, ok := d.resolve(widths[i+1]).([]any); ok {
+			for j, w := range list {
+				font.widths[int(first)+j], _ = d.resolve(w).(float64)
+			}
+			i += 2
+			continue
+		}
+
+		if i+2 >= len(widths) {
+			break
+		}
+		last, _ := d.resolve(widths[i+1]).(float64)
+		w, _ := d.resolve(widths[i+2]).(float64)
+		for code := int(first); code <= int(last) && code-int(first) < 0x10000; code++ {
+			font.widths[code] = w
+		}
+		i += 3
+	}
+
+	return font, nil
+}
+
+// image decodes an image XObject, including its soft mask.
+func (d *pdfDocument) image(stream *pdfStream) (image.Image, error) {
+	data, err := d.decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter := d.resolve(stream.Dict["Filter"]); filter == pdfName("DCTDecode") {
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+
+	width, height := int(d.number(stream.Dict, "Width", 0)), int(d.number(stream.Dict, "Height", 0))
+	bits := int(d.number(stream.Dict, "BitsPerComponent", 8))
+	if width <= 0 || height <= 0 || (bits != 1 && bits != 8) {
+		return nil, fmt.Errorf("unsupported image of %dx%d pixels, %d bits per component", width, height, bits)
+	}
+
+	var img image.Image
+	switch colorSpace := d.resolve(stream.Dict["ColorSpace"]).(type) {
+	case pdfName:
+		components := 1
+		switch colorSpace {
+		case "DeviceGray":
+		case "DeviceRGB":
+			components = 3
+		default:
+			return nil, fmt.Errorf("unsupported image color space %s", colorSpace)
+		}
+		if len(data) < height*((width*components*bits+7)/8) {
+			return nil, errors.New("image data is too short")
+		}
+		img = rasterImage(data, width, height, components, bits, false)
+	case []any:
+		// [/Indexed /DeviceRGB hival lookup]
+		if len(colorSpace) != 4 || d.resolve(colorSpace[0]) != pdfName("Indexed") || d.resolve(colorSpace[1]) != pdfName("DeviceRGB") || bits != 8 {
+			return nil, fmt.Errorf("unsupported image color space %v", colorSpace)
+		}
+
+		var lookup []byte
+		switch v := d.resolve(colorSpace[3]).(type) {
+		case string:
+			lookup = []byte(v)
+		case *pdfStream:
+			if lookup, err = d.decode(v); err != nil {
+				return nil, err
+			}
+		}
+		if len(data) < width*height {
+			return nil, errors.New("image data is too short")
+		}
+
+		palette := make(color.Palette, len(lookup)/3)
+		for i := range palette {
+			palette[i] = color.RGBA{R: lookup[3*i], G: lookup[3*i+1], B: lookup[3*i+2], A: 0xFF}
+		}
+		paletted := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		copy(paletted.Pix, data)
+		img = paletted
+	default:
+		return nil, fmt.Errorf("unsupported image color space %v", colorSpace)
+	}
+
+	mask, ok := d.resolve(stream.Dict["SMask"]).(*pdfStream)
+	if !ok {
+		return img, nil
+	}
+	alpha, err := d.image(mask)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading image mask"), err)
+	}
+
+	masked := image.NewNRGBA(img.Bounds())
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			c.A = color.GrayModel.Convert(alpha.At(x*alpha.Bounds().Dx()/width, y*alpha.Bounds().Dy()/height)).(color.Gray).Y
+			masked.SetNRGBA(x, y, c)
+		}
+	}
+
+	return masked, nil
+}
+
+// rasterState is the graphics state of the content stream interpreter.
+type rasterState struct {
+	ctm          matrix
+	fill, stroke color.RGBA
+	fillAlpha    float64
+	strokeAlpha  float64
+	lineWidth    float64
+
+	font        *rasterFont
+	fontSize    float64
+	charSpacing float64
+	wordSpacing float64
+	hScale      float64
+	leading     float64
+	rise        float64
+	renderMode  int
+}
+
+// mediaBox returns the media box of a page, [x0 y0 x1 y1], in points.
+func (d *pdfDocument) mediaBox(page pdfDict) ([4]float64, error) {
+	var mediaBox [4]float64
+	box := d.array(page, "MediaBox")
+	if len(box) != 4 {
+		return mediaBox, errors.New("page has no media box")
+	}
+	for i, v := range box {
+		mediaBox[i], _ = d.resolve(v).(float64)
+	}
+
+	return mediaBox, nil
+}
+
+// content returns the content streams of a page, joined.
+func (d *pdfDocument) content(page pdfDict) ([]byte, error) {
+	var content []byte
+	var streams []any
+	switch contents := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		streams = []any{contents}
+	case []any:
+		streams = contents
+	}
+	for _, stream := range streams {
+		stream, ok := d.resolve(stream).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := d.decode(stream)
+		if err != nil {
+			return nil, err
+		}
+		content = append(append(content, data...), '\n')
+	}
+
+	return content, nil
+}
+
+// renderPage renders a single page, fonts are cached across pages.
+func (d *pdfDocument) renderPage(page pdfDict, dpi float64, fonts map[pdfRef]*rasterFont) (*image.RGBA, error) {
+	mediaBox, err := d.mediaBox(page)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := dpi / 72
+	width := int(math.Round((mediaBox[2] - mediaBox[0]) * scale))
+	height := int(math.Round((mediaBox[3] - mediaBox[1]) * scale))
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("page has an empty media box")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	content, err := d.content(page)
+	if err != nil {
+		return nil, err
+	}
+
+	r := d.newPageRenderer(page, img, mediaBox, scale, fonts)
+	return img, r.run(content)
+}
+
+// newPageRenderer returns the interpreter of the content of a page, drawing onto img at scale pixels per point,
+// or, if img is nil, collecting the glyphs shown, see ExtractPDFText.
+func (d *pdfDocument) newPageRenderer(page pdfDict, img *image.RGBA, mediaBox [4]float64, scale float64, fonts map[pdfRef]*rasterFont) *pageRenderer {
+	return &pageRenderer{
+		doc:       d,
+		img:       img,
+		resources: d.dict(page, "Resources"),
+		fonts:     fonts,
+		state: rasterState{
+			// PDF user space has its origin at the bottom left, images at the top left
+			ctm:         matrix{scale, 0, 0, -scale, -mediaBox[0] * scale, mediaBox[3] * scale},
+			fill:        color.RGBA{A: 0xFF},
+			stroke:      color.RGBA{A: 0xFF},
+			fillAlpha:   1,
+			strokeAlpha: 1,
+			lineWidth:   1,
+			hScale:      1,
+		},
+	}
+}
+
+// pageRenderer interprets the content stream of a page.
+type pageRenderer struct {
+	doc *pdfDocument
+	// img is nil while only the text of the page is extracted, nothing is drawn then
+	img       *image.RGBA
+	glyphs    []pdfGlyph
+	resources pdfDict
+	fonts     map[pdfRef]*rasterFont
+
+	state rasterState
+	stack []rasterState
+
+	// the current path, in device space
+	paths  [][]rasterPoint
+	closed []bool
+
+	textMatrix, lineMatrix matrix
+}
+
+func (r *pageRenderer) run(content []byte) error {
+	lexer := &pdfLexer{data: content}
+	var operands []any
+	for {
+		object, err := lexer.object()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		operator, ok := object.(pdfOperator)
+		if !ok {
+			operands = append(operands, object)
+			continue
+		}
+
+		if err := r.execute(string(operator), operands); err != nil {
+			return errors.Join(fmt.Errorf("error executing operator %s", operator), err)
+		}
+		operands = operands[:0]
+	}
+}
+
+// runForm runs the content of a form XObject, using its resources, as placed by the current transformation matrix.
+func (r *pageRenderer) runForm(form *pdfStream) error {
+	if len(r.stack) > 64 {
+		return errors.New("form XObjects are nested too deeply")
+	}
+
+	content, err := r.doc.decode(form)
+	if err != nil {
+		return err
+	}
+
+	resources, stack, textMatrix, lineMatrix := r.resources, len(r.stack), r.textMatrix, r.lineMatrix
+	if formResources := r.doc.dict(form.Dict, "Resources"); formResources != nil {
+		r.resources = formResources
+	}
+	r.stack = append(r.stack, r.state)
+	if v, ok := numbers(r.doc.array(form.Dict, "Matrix"), 6); ok {
+		r.state.ctm = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}.multiply(r.state.ctm)
+	}
+
+	err = r.run(content)
+
+	// the graphics state is restored, even if the content of the form is unbalanced
+	r.state, r.stack = r.stack[stack], r.stack[:stack]
+	r.resources, r.textMatrix, r.lineMatrix = resources, textMatrix, lineMatrix
+	return err
+}
+
+// numbers returns the operands as numbers, or false if there are not enough of them.
+func numbers(operands []any, n int) ([]float64, bool) {
+	if len(operands) < n {
+		return nil, false
+	}
+
+	values := make([]float64, n)
+	for i, operand := range operands[len(operands)-n:] {
+		values[i], _ = operand.(float64)
+	}
+
+	return values, true
+}
+
+func grayColor(v float64) color.RGBA {
+	c := uint8(math.Round(min(max(v, 0), 1) * 0xFF))
+	return color.RGBA{R: c, G: c, B: c, A: 0xFF}
+}
+
+func rgbColor(v []float64) color.RGBA {
+	c := func(v float64) uint8 { return uint8(math.Round(min(max(v, 0), 1) * 0xFF)) }
+	return color.RGBA{R: c(v[0]), G: c(v[1]), B: c(v[2]), A: 0xFF}
+}
+
+func cmykColor(v []float64) color.RGBA {
+	return rgbColor([]float64{(1 - v[0]) * (1 - v[3]), (1 - v[1]) * (1 - v[3]), (1 - v[2]) * (1 - v[3])})
+}
+
+func (r *pageRenderer) execute(operator string, operands []any) error {
+	s := &r.state
+
+	switch operator {
+	// graphics state
+	case "q":
+		r.stack = append(r.stack, r.state)
+	case "Q":
+		if len(r.stack) > 0 {
+			r.state = r.stack[len(r.stack)-1]
+			r.stack = r.stack[:len(r.stack)-1]
+		}
+	case "cm":
+		if v, ok := numbers(operands, 6); ok {
+			s.ctm = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}.multiply(s.ctm)
+		}
+	case "w":
+		if v, ok := numbers(operands, 1); ok {
+			s.lineWidth = v[0]
+		}
+	case "gs":
+		if len(operands) > 0 {
+			name, _ := operands[0].(pdfName)
+			state := r.doc.dict(r.doc.dict(r.resources, "ExtGState"), name)
+			s.fillAlpha = r.doc.number(state, "ca", s.fillAlpha)
+			s.strokeAlpha = r.doc.number(state, "CA", s.strokeAlpha)
+		}
+
+	// colors
+	case "g":
+		if v, ok := numbers(operands, 1); ok {
+			s.fill = grayColor(v[0])
+		}
+	case "G":
+		if v, ok := numbers(operands, 1); ok {
+			s.stroke = grayColor(v[0])
+		}
+	case "rg":
+		if v, ok := numbers(operands, 3); ok {
+			s.fill = rgbColor(v)
+		}
+	case "RG":
+		if v, ok := numbers(operands, 3); ok {
+			s.stroke = rgbColor(v)
+		}
+	case "k":
+		if v, ok := numbers(operands, 4); ok {
+			s.fill = cmykColor(v)
+		}
+	case "K":
+		if v, ok := numbers(operands, 4); ok {
+			s.stroke = cmykColor(v)
+		}
+
+	// path construction
+	case "m":
+		if v, ok := numbers(operands, 2); ok {
+			r.paths = append(r.paths, []rasterPoint{s.ctm.apply(v[0], v[1])})
+			r.closed = append(r.closed, false)
+		}
+	case "l":
+		if v, ok := numbers(operands, 2); ok && len(r.paths) > 0 {
+			r.paths[len(r.paths)-1] = append(r.paths[len(r.paths)-1], s.ctm.apply(v[0], v[1]))
+		}
+	case "c", "v", "y":
+		n := 6
+		if operator != "c" {
+			n = 4
+		}
+		v, ok := numbers(operands, n)
+		if !ok || len(r.paths) == 0 {
+			break
+		}
+
+		path := r.paths[len(r.paths)-1]
+		current := path[len(path)-1]
+		var p1, p2, p3 rasterPoint
+		switch operator {
+		case "c":
+			p1, p2, p3 = s.ctm.apply(v[0], v[1]), s.ctm.apply(v[2], v[3]), s.ctm.apply(v[4], v[5])
+		case "v":
+			p1, p2, p3 = current, s.ctm.apply(v[0], v[1]), s.ctm.apply(v[2], v[3])
+		case "y":
+			p1, p2, p3 = s.ctm.apply(v[0], v[1]), s.ctm.apply(v[2], v[3]), s.ctm.apply(v[2], v[3])
+		}
+		r.paths[len(r.paths)-1] = flattenCubic(path, current, p1, p2, p3)
+	case "h":
+		if len(r.closed) > 0 {
+			r.closed[len(r.closed)-1] = true
+		}
+	case "re":
+		if v, ok := numbers(operands, 4); ok {
+			x, y, w, h := v[0], v[1], v[2], v[3]
+			r.paths = append(r.paths, []rasterPoint{s.ctm.apply(x, y), s.ctm.apply(x+w, y), s.ctm.apply(x+w, y+h), s.ctm.apply(x, y+h)})
+			r.closed = append(r.closed, true)
+		}
+
+	// path painting, clipping paths are not supported, as PaperCrypt does not use them
+	case "f", "F", "f*":
+		if r.img != nil {
+			fillPolygons(r.img, r.paths, s.fill, s.fillAlpha, operator == "f*")
+		}
+		r.paths, r.closed = nil, nil
+	case "S", "s":
+		if operator == "s" {
+			r.execute("h", nil)
+		}
+		r.strokePath()
+		r.paths, r.closed = nil, nil
+	case "B", "B*", "b", "b*":
+		if operator[0] == 'b' {
+			r.execute("h", nil)
+		}
+		if r.img != nil {
+			fillPolygons(r.img, r.paths, s.fill, s.fillAlpha, len(operator) == 2)
+		}
+		r.strokePath()
+		r.paths, r.closed = nil, nil
+	case "n":
+		r.paths, r.closed = nil, nil
+
+	// images
+	case "Do":
+		if len(operands) == 0 {
+			break
+		}
+		name, _ := operands[0].(pdfName)
+		stream, ok := r.doc.resolve(r.doc.dict(r.resources, "XObject")[name]).(*pdfStream)
+		if ok && stream.Dict["Subtype"] == pdfName("Form") {
+			return r.runForm(stream)
+		}
+		if !ok || stream.Dict["Subtype"] != pdfName("Image") || r.img == nil {
+			break
+		}
+
+		img, err := r.doc.image(stream)
+		if err != nil {
+			return err
+		}
+		drawImage(r.img, img, s.ctm, s.fillAlpha)
+
+	// text
+	case "BT":
+		r.textMatrix, r.lineMatrix = identityMatrix, identityMatrix
+	case "ET":
+	case "Tf":
+		if len(operands) < 2 {
+			break
+		}
+		name, _ := operands[0].(pdfName)
+		s.fontSize, _ = operands[1].(float64)
+
+		ref, ok := r.doc.dict(r.resources, "Font")[name].(pdfRef)
+		if !ok {
+			return fmt.Errorf("unknown font %s", name)
+		}
+		if r.fonts[ref] == nil {
+			font, err := r.doc.font(ref)
+			if err != nil {
+				return err
+			}
+			r.fonts[ref] = font
+		}
+		s.font = r.fonts[ref]
+	case "Tc":
+		if v, ok := numbers(operands, 1); ok {
+			s.charSpacing = v[0]
+		}
+	case "Tw":
+		if v, ok := numbers(operands, 1); ok {
+			s.wordSpacing = v[0]
+		}
+	case "Tz":
+		if v, ok := numbers(operands, 1); ok {
+			s.hScale = v[0] / 100
+		}
+	case "TL":
+		if v, ok := numbers(operands, 1); ok {
+			s.leading = v[0]
+		}
+	case "Ts":
+		if v, ok := numbers(operands, 1); ok {
+			s.rise = v[0]
+		}
+	case "Tr":
+		if v, ok := numbers(operands, 1); ok {
+			s.renderMode = int(v[0])
+		}
+	case "Td", "TD":
+		if v, ok := numbers(operands, 2); ok {
+			if operator == "TD" {
+				s.leading = -v[1]
+			}
+			r.lineMatrix = matrix{1, 0, 0, 1, v[0], v[1]}.multiply(r.lineMatrix)
+			r.textMatrix = r.lineMatrix
+		}
+	case "Tm":
+		if v, ok := numbers(operands, 6); ok {
+			r.lineMatrix = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+			r.textMatrix = r.lineMatrix
+		}
+	case "T*":
+		r.execute("Td", []any{0.0, -s.leading})
+	case "Tj", "'", "\"":
+		if len(operands) == 0 {
+			break
+		}
+		if operator == "\"" && len(operands) == 3 {
+			s.wordSpacing, _ = operands[0].(float64)
+			s.charSpacing, _ = operands[1].(float64)
+		}
+		if operator != "Tj" {
+			r.execute("T*", nil)
+		}
+		text, _ := operands[len(operands)-1].(string)
+		return r.showText(text)
+	case "TJ":
+		if len(operands) == 0 {
+			break
+		}
+		array, _ := operands[0].([]any)
+		for _, item := range array {
+			switch v := item.(type) {
+			case string:
+				if err := r.showText(v); err != nil {
+					return err
+				}
+			case float64:
+				r.textMatrix = matrix{1, 0, 0, 1, -v / 1000 * s.fontSize * s.hScale, 0}.multiply(r.textMatrix)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *pageRenderer) strokePath() {
+	if r.img == nil {
+		return
+	}
+
+	s := &r.state
+	width := s.lineWidth * s.ctm.scale()
+	fillPolygons(r.img, strokePolygons(r.paths, r.closed, width), s.stroke, s.strokeAlpha, false)
+}
+
+// showText draws a string of two-byte character codes, and advances the text matrix.
+// While extracting text, the glyphs are collected instead.
+func (r *pageRenderer) showText(text string) error {
+	s := &r.state
+	if s.font == nil {
+		return errors.New("no font selected")
+	}
+
+	font := s.font.font
+	for i := 0; i+1 < len(text); i += 2 {
+		code := int(text[i])<<8 | int(text[i+1])
+		start := r.textMatrix
+
+		if r.img != nil && s.renderMode != 3 && s.renderMode != 7 {
+			contours, err := font.contours(s.font.gid(code))
+			if err != nil {
+				return err
+			}
+
+			// glyph space to device space
+			size := s.fontSize / font.unitsPerEm
+			m := matrix{size * s.hScale, 0, 0, size, 0, s.rise}.multiply(r.textMatrix).multiply(s.ctm)
+			fillPolygons(r.img, glyphPolygons(contours, m), s.fill, s.fillAlpha, false)
+		}
+
+		advance := (s.font.width(code)/1000*s.fontSize + s.charSpacing) * s.hScale
+		r.textMatrix = matrix{1, 0, 0, 1, advance, 0}.multiply(r.textMatrix)
+
+		if r.img == nil {
+			m := start.multiply(s.ctm)
+			r.glyphs = append(r.glyphs, pdfGlyph{
+				char:    rune(code),
+				origin:  m.apply(0, s.rise),
+				end:     r.textMatrix.multiply(s.ctm).apply(0, s.rise),
+				size:    s.fontSize * m.scale(),
+				upright: m[1] == 0 && m[2] == 0,
+			})
+		}
+	}
+
+	return nil
+}
+
+// glyphPolygons converts the contours of a glyph, made of lines and quadratic curves, to polygons in device space.
+func glyphPolygons(contours [][]glyphPoint, m matrix) [][]rasterPoint {
+	polygons := make([][]rasterPoint, 0, len(contours))
+	for _, contour := range contours {
+		if len(contour) == 0 {
+			continue
+		}
+
+		// start at a point on the curve, which is implied between two off-curve points
+		start := -1
+		for i, p := range contour {
+			if p.OnCurve {
+				start = i
+				break
+			}
+		}
+		var first rasterPoint
+		if start < 0 {
+			a, b := contour[0], contour[1%len(contour)]
+			first = m.apply((a.X+b.X)/2, (a.Y+b.Y)/2)
+			start = 1
+		} else {
+			first = m.apply(contour[start].X, contour[start].Y)
+			start++
+		}
+
+		polygon := []rasterPoint{first}
+		current := first
+		var control *rasterPoint
+		for i := 0; i < len(contour); i++ {
+			p := contour[(start+i)%len(contour)]
+			point := m.apply(p.X, p.Y)
+
+			switch {
+			case p.OnCurve && control == nil:
+				polygon = append(polygon, point)
+				current = point
+			case p.OnCurve:
+				polygon = flattenQuadratic(polygon, current, *control, point)
+				current, control = point, nil
+			case control == nil:
+				control = &point
+			default:
+				mid := rasterPoint{X: (control.X + point.X) / 2, Y: (control.Y + point.Y) / 2}
+				polygon = flattenQuadratic(polygon, current, *control, mid)
+				current, control = mid, &point
+			}
+		}
+		if control != nil {
+			polygon = flattenQuadratic(polygon, current, *control, first)
+		}
+
+		polygons = append(polygons, polygon)
+	}
+
+	return polygons
+}
@@ -0,0 +1,138 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf/v2"
+)
+
+func rasterTestPDF(t *testing.T) []byte {
+	t.Helper()
+
+	pdf := gofpdf.New("P", "mm", "A5", "")
+	pdf.AddUTF8Font(PdfMonoFont, "", "../font/Inconsolata/static/Inconsolata-Medium.ttf")
+	pdf.AddPage()
+	pdf.SetFillColor(0, 0, 0)
+	pdf.Rect(10, 10, 20, 20, "F")
+	pdf.SetFillColor(255, 0, 0)
+	pdf.Rect(40, 10, 20, 20, "F")
+	pdf.SetDrawColor(0, 0, 255)
+	pdf.SetLineWidth(2)
+	pdf.Line(10, 50, 60, 50)
+	pdf.SetFont(PdfMonoFont, "", 40)
+	pdf.Text(10, 100, "Hello")
+	pdf.AddPage()
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("Output failed with error %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRasterizePDF(t *testing.T) {
+	var pages []*image.RGBA
+	err := RasterizePDF(rasterTestPDF(t), 254, func(page, count int, img *image.RGBA) error {
+		if page != len(pages)+1 || count != 2 {
+			t.Errorf("got: page %d of %d, want: page %d of 2.", page, count, len(pages)+1)
+		}
+		pages = append(pages, img)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RasterizePDF failed with error %s", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got: %d pages, want: 2.", len(pages))
+	}
+
+	// A5 (148.5 by 210 mm in gofpdf) at 254 dpi, that is 10 pixels per mm
+	if got := pages[0].Bounds(); got.Dx() != 1485 || got.Dy() != 2100 {
+		t.Errorf("got: %v, want: 1485x2100.", got)
+	}
+
+	for _, tt := range []struct {
+		x, y    int
+		r, g, b uint8
+	}{
+		{200, 200, 0, 0, 0},          // black square
+		{500, 200, 0xFF, 0, 0},       // red square
+		{350, 200, 0xFF, 0xFF, 0xFF}, // between the squares
+		{350, 500, 0, 0, 0xFF},       // line
+		{350, 515, 0xFF, 0xFF, 0xFF}, // below the line
+	} {
+		c := pages[0].RGBAAt(tt.x, tt.y)
+		if c.R != tt.r || c.G != tt.g || c.B != tt.b {
+			t.Errorf("Pixel (%d, %d) got: %v, want: (%d, %d, %d).", tt.x, tt.y, c, tt.r, tt.g, tt.b)
+		}
+	}
+
+	// the text is 40 pt tall, it covers some, but not all of its box
+	dark := 0
+	for y := 860; y < 1000; y++ {
+		for x := 100; x < 700; x++ {
+			if pages[0].RGBAAt(x, y).R < 0x80 {
+				dark++
+			}
+		}
+	}
+	if dark < 5000 || dark > 60000 {
+		t.Errorf("got: %d dark pixels of text, want: between 5000 and 60000.", dark)
+	}
+
+	for _, v := range pages[1].Pix {
+		if v != 0xFF {
+			t.Errorf("The second page should be blank")
+			break
+		}
+	}
+
+	if err := RasterizePDF([]byte("not a pdf"), 300, func(int, int, *image.RGBA) error { return nil }); err == nil {
+		t.Errorf("RasterizePDF should fail for invalid documents")
+	}
+}
+
+func TestEncodePNG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	data, err := EncodePNG(img, 600)
+	if err != nil {
+		t.Fatalf("EncodePNG failed with error %s", err)
+	}
+
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("Decode failed with error %s", err)
+	}
+
+	chunk := bytes.Index(data, []byte("pHYs"))
+	if chunk < 0 {
+		t.Fatalf("PNG image has no pHYs chunk")
+	}
+	if got := binary.BigEndian.Uint32(data[chunk+4:]); got != 23622 {
+		t.Errorf("got: %d pixels per meter, want: 23622.", got)
+	}
+}
@@ -0,0 +1,553 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// This is a reader for the PDF documents written by PaperCrypt (using gofpdf), it is not a general purpose PDF reader:
+// cross-reference streams, object streams, and encryption are not supported,
+// and filters are limited to the ones used by gofpdf.
+
+type (
+	// pdfName is a PDF name object, without the leading slash.
+	pdfName string
+
+	// pdfOperator is an operator of a content stream, or an unknown keyword.
+	pdfOperator string
+
+	// pdfRef is a reference to an indirect object.
+	pdfRef struct {
+		Number     int
+		Generation int
+	}
+
+	// pdfDict is a PDF dictionary.
+	pdfDict map[pdfName]any
+
+	// pdfStream is a PDF stream, with its data still encoded.
+	pdfStream struct {
+		Dict pdfDict
+		Data []byte
+	}
+)
+
+// pdfDocument holds the objects of a PDF document.
+type pdfDocument struct {
+	objects map[int]any
+	trailer pdfDict
+}
+
+var pdfObjectPattern = regexp.MustCompile(`(?:^|[\r\n\s])(\d+)\s+(\d+)\s+obj\b`)
+
+// readPDFDocument reads all objects of a PDF document.
+// Objects are read in file order, so objects of incremental updates replace the original objects.
+func readPDFDocument(data []byte) (*pdfDocument, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte(PDFMagic)) {
+		return nil, errors.New("not a PDF document")
+	}
+
+	doc := &pdfDocument{objects: make(map[int]any)}
+	for pos := 0; pos < len(data); {
+		match := pdfObjectPattern.FindSubmatchIndex(data[pos:])
+		if match == nil {
+			break
+		}
+
+		number, _ := strconv.Atoi(string(data[pos+match[2] : pos+match[3]]))
+		lexer := &pdfLexer{data: data, pos: pos + match[1]}
+		object, err := lexer.object()
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading object %d", number), err)
+		}
+
+		if dict, ok := object.(pdfDict); ok {
+			lexer.skipSpace()
+			if bytes.HasPrefix(data[lexer.pos:], []byte("stream")) {
+				object, err = lexer.stream(dict)
+				if err != nil {
+					return nil, errors.Join(fmt.Errorf("error reading stream %d", number), err)
+				}
+			}
+		}
+
+		doc.objects[number] = object
+		pos = lexer.pos
+	}
+
+	trailers := regexp.MustCompile(`trailer\s*<<`).FindAllIndex(data, -1)
+	if len(trailers) == 0 {
+		return nil, errors.New("PDF document has no trailer")
+	}
+
+	lexer := &pdfLexer{data: data, pos: trailers[len(trailers)-1][1] - 2}
+	trailer, err := lexer.object()
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading PDF trailer"), err)
+	}
+	doc.trailer, _ = trailer.(pdfDict)
+
+	return doc, nil
+}
+
+// resolve returns the object referenced by v, or v itself if it is not a reference.
+func (d *pdfDocument) resolve(v any) any {
+	for i := 0; i < 16; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[ref.Number]
+	}
+
+	return nil
+}
+
+// dict returns the dictionary at key in dict, resolving references. It returns nil if there is none.
+func (d *pdfDocument) dict(dict pdfDict, key pdfName) pdfDict {
+	switch v := d.resolve(dict[key]).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.Dict
+	default:
+		return nil
+	}
+}
+
+// number returns the number at key in dict, resolving references, or def if there is none.
+func (d *pdfDocument) number(dict pdfDict, key pdfName, def float64) float64 {
+	if v, ok := d.resolve(dict[key]).(float64); ok {
+		return v
+	}
+
+	return def
+}
+
+// array returns the array at key in dict, resolving references. It returns nil if there is none.
+func (d *pdfDocument) array(dict pdfDict, key pdfName) []any {
+	v, _ := d.resolve(dict[key]).([]any)
+	return v
+}
+
+// pages returns the page dictionaries, in order.
+// Inheritable attributes (resources and media box) are copied into the pages.
+func (d *pdfDocument) pages() ([]pdfDict, error) {
+	root := d.dict(d.trailer, "Root")
+	if root == nil {
+		return nil, errors.New("PDF document has no catalog")
+	}
+
+	var pages []pdfDict
+	var walk func(node pdfDict, inherited pdfDict, depth int) error
+	walk = func(node pdfDict, inherited pdfDict, depth int) error {
+		if depth > 32 {
+			return errors.New("PDF page tree is too deep")
+		}
+
+		attributes := make(pdfDict)
+		for key, value := range inherited {
+			attributes[key] = value
+		}
+		for _, key := range []pdfName{"Resources", "MediaBox"} {
+			if value, ok := node[key]; ok {
+				attributes[key] = value
+			}
+		}
+
+		if node["Type"] == pdfName("Page") {
+			page := make(pdfDict)
+			for key, value := range node {
+				page[key] = value
+			}
+			for key, value := range attributes {
+				page[key] = value
+			}
+			pages = append(pages, page)
+			return nil
+		}
+
+		for _, kid := range d.array(node, "Kids") {
+			if kid, ok := d.resolve(kid).(pdfDict); ok {
+				if err := walk(kid, attributes, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := walk(d.dict(root, "Pages"), nil, 0); err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+// CountPDFPages returns the number of pages of a PDF document.
+func CountPDFPages(data []byte) (int, error) {
+	doc, err := readPDFDocument(data)
+	if err != nil {
+		return 0, err
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(pages), nil
+}
+
+// decode returns the decoded data of a stream.
+// Data encoded using DCTDecode (JPEG images) is returned as is.
+func (d *pdfDocument) decode(stream *pdfStream) ([]byte, error) {
+	var filters []any
+	switch filter := d.resolve(stream.Dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{filter}
+	case []any:
+		filters = filter
+	}
+
+	data := stream.Data
+	for _, filter := range filters {
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"):
+			reader, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, errors.Join(errors.New("error decompressing stream"), err)
+			}
+			data, err = io.ReadAll(reader)
+			if err != nil {
+				return nil, errors.Join(errors.New("error decompressing stream"), err)
+			}
+
+			if params := d.dict(stream.Dict, "DecodeParms"); params != nil && d.number(params, "Predictor", 1) >= 10 {
+				colors, bits := int(d.number(params, "Colors", 1)), int(d.number(params, "BitsPerComponent", 8))
+				rowBytes := (colors*bits*int(d.number(params, "Columns", 1)) + 7) / 8
+				if len(data)%(rowBytes+1) != 0 {
+					return nil, errors.New("invalid length of predicted stream data")
+				}
+
+				data, err = unfilterPNGRows(data, len(data)/(rowBytes+1), rowBytes, max(1, colors*bits/8))
+				if err != nil {
+					return nil, err
+				}
+			}
+		case pdfName("DCTDecode"):
+			return data, nil
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+
+	return data, nil
+}
+
+// pdfLexer reads PDF objects, and the operands and operators of content streams.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token reads a regular token: a number or a keyword.
+func (l *pdfLexer) token() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+
+	return string(l.data[start:l.pos])
+}
+
+// object reads the next object. At the end of the data, it returns io.EOF.
+func (l *pdfLexer) object() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		return pdfName(l.name()), nil
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		return l.hexString()
+	case c == '[':
+		l.pos++
+		return l.array()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfOperator(c), nil
+	}
+
+	token := l.token()
+	if token == "" {
+		return nil, fmt.Errorf("unexpected character %q at offset %d", l.data[l.pos], l.pos)
+	}
+
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return pdfOperator(token), nil
+	}
+
+	// an integer might start a reference: "12 0 R"
+	if generation, end, ok := l.reference(); ok && number == float64(int(number)) {
+		l.pos = end
+		return pdfRef{Number: int(number), Generation: generation}, nil
+	}
+
+	return number, nil
+}
+
+// reference checks whether the data at the current position continues a reference,
+// returning its generation, and the position following it.
+func (l *pdfLexer) reference() (int, int, bool) {
+	saved := l.pos
+	defer func() { l.pos = saved }()
+
+	l.skipSpace()
+	generation, err := strconv.Atoi(l.token())
+	if err != nil {
+		return 0, 0, false
+	}
+	l.skipSpace()
+	if l.token() != "R" {
+		return 0, 0, false
+	}
+
+	return generation, l.pos, true
+}
+
+func (l *pdfLexer) name() string {
+	raw := l.token()
+	var name []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(raw[i+1:i+3], 16, 8); err == nil {
+				name = append(name, byte(v))
+				i += 2
+				continue
+			}
+		}
+		name = append(name, raw[i])
+	}
+
+	return string(name)
+}
+
+func (l *pdfLexer) literalString() (string, error) {
+	l.pos++ // (
+	var s []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(s), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+
+	return "", errors.New("unterminated string")
+}
+
+func (l *pdfLexer) hexString() (string, error) {
+	l.pos++ // <
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		return "", errors.New("unterminated hex string")
+	}
+
+	var digits []byte
+	for _, c := range l.data[l.pos : l.pos+end] {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	l.pos += end + 1
+
+	s := make([]byte, len(digits)/2)
+	for i := range s {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return "", errors.Join(errors.New("invalid hex string"), err)
+		}
+		s[i] = byte(v)
+	}
+
+	return string(s), nil
+}
+
+func (l *pdfLexer) array() ([]any, error) {
+	array := []any{}
+	for {
+		v, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if v == pdfOperator("]") {
+			return array, nil
+		}
+		array = append(array, v)
+	}
+}
+
+func (l *pdfLexer) dict() (pdfDict, error) {
+	dict := make(pdfDict)
+	for {
+		l.skipSpace()
+		if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+			l.pos += 2
+			return dict, nil
+		}
+
+		key, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("invalid dictionary key %v", key)
+		}
+
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		dict[name] = value
+	}
+}
+
+// stream reads the data of a stream, l.pos is at the stream keyword.
+func (l *pdfLexer) stream(dict pdfDict) (*pdfStream, error) {
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+
+	length, ok := dict["Length"].(float64)
+	if !ok || l.pos+int(length) > len(l.data) {
+		// indirect or invalid length, look for the end of the stream instead
+		end := bytes.Index(l.data[l.pos:], []byte("endstream"))
+		if end < 0 {
+			return nil, errors.New("unterminated stream")
+		}
+		length = float64(len(bytes.TrimRight(l.data[l.pos:l.pos+end], "\r\n")))
+	}
+
+	data := l.data[l.pos : l.pos+int(length)]
+	l.pos += int(length)
+	l.skipSpace()
+	l.pos += len("endstream")
+
+	return &pdfStream{Dict: dict, Data: data}, nil
+}
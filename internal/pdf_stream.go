@@ -0,0 +1,160 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"slices"
+)
+
+// gofpdf builds the whole document in memory, including every image placed in it, before it is written.
+// The 2D codes of a document are several megapixels each, so the document is laid out with a tiny placeholder image
+// for each code, and the codes are only encoded as the document is written, one at a time, see writeStreamedPDF.
+
+// pdfCodePlaceholderMagic starts the pixels of a placeholder image, followed by the index of its code.
+const pdfCodePlaceholderMagic = "PC2D"
+
+// pdfCodePlaceholderPNG returns the placeholder image of the code i, a grayscale PNG image of a single row of pixels,
+// holding pdfCodePlaceholderMagic, and i.
+func pdfCodePlaceholderPNG(i int) ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, len(pdfCodePlaceholderMagic)+4, 1))
+	copy(img.Pix, pdfCodePlaceholderMagic)
+	binary.BigEndian.PutUint32(img.Pix[len(pdfCodePlaceholderMagic):], uint32(i))
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errors.Join(errors.New("error generating 2D code placeholder"), err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// pdfCodePlaceholderIndex returns the index of the code a placeholder image stands for, ok is false for other objects.
+func pdfCodePlaceholderIndex(doc *pdfDocument, object any) (i int, ok bool) {
+	stream, isStream := object.(*pdfStream)
+	if !isStream || doc.resolve(stream.Dict["Subtype"]) != pdfName("Image") ||
+		doc.number(stream.Dict, "Width", 0) != float64(len(pdfCodePlaceholderMagic)+4) || doc.number(stream.Dict, "Height", 0) != 1 {
+		return 0, false
+	}
+
+	pixels, err := doc.decode(stream)
+	if err != nil || len(pixels) != len(pdfCodePlaceholderMagic)+4 || string(pixels[:len(pdfCodePlaceholderMagic)]) != pdfCodePlaceholderMagic {
+		return 0, false
+	}
+
+	return int(binary.BigEndian.Uint32(pixels[len(pdfCodePlaceholderMagic):])), true
+}
+
+// writeStreamedPDF writes doc, a document laid out with placeholder images (see pdfCodePlaceholderPNG), to w,
+// with the images of the codes in place of the placeholders.
+// The objects of doc are written one at a time, keeping their numbers, each code is encoded as its image is written,
+// so no more than one code image is held in memory at once. Objects replaced by incremental updates are written once,
+// in their last version.
+func writeStreamedPDF(w io.Writer, doc []byte, codes *code2DImageSet) error {
+	layout, err := readPDFDocument(doc)
+	if err != nil {
+		return errors.Join(errors.New("error reading the laid out pdf"), err)
+	}
+
+	first := pdfObjectPattern.FindSubmatchIndex(doc)
+	if first == nil {
+		return errors.New("the laid out pdf holds no objects")
+	}
+
+	written := int64(0)
+	write := func(data []byte) error {
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return errors.Join(errors.New("error writing pdf"), err)
+		}
+		return nil
+	}
+
+	// the file header, and the binary comment following it, are written as they are
+	if err := write(doc[:first[2]]); err != nil {
+		return err
+	}
+
+	numbers := make([]int, 0, len(layout.objects))
+	for number := range layout.objects {
+		numbers = append(numbers, number)
+	}
+	slices.Sort(numbers)
+
+	// the buffers are reused for every object
+	var buf bytes.Buffer
+	var codeImage bytes.Buffer
+	offsets := make(map[int]int64, len(numbers))
+	for _, number := range numbers {
+		object := layout.objects[number]
+		if i, ok := pdfCodePlaceholderIndex(layout, object); ok {
+			if i >= codes.Len() {
+				return fmt.Errorf("the laid out pdf holds a placeholder of code %d, of %d codes", i+1, codes.Len())
+			}
+
+			codeImage.Reset()
+			dict, err := codes.writePDFImage(&codeImage, i)
+			if err != nil {
+				return err
+			}
+			object = &pdfStream{Dict: dict, Data: codeImage.Bytes()}
+		}
+
+		buf.Reset()
+		writePDFIndirectObject(&buf, number, object)
+		offsets[number] = written
+		if err := write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	size := numbers[len(numbers)-1] + 1
+	xref := written
+	buf.Reset()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for number := 1; number < size; number++ {
+		if offset, ok := offsets[number]; ok {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+		} else {
+			buf.WriteString("0000000000 65535 f \n")
+		}
+	}
+
+	// the trailer keeps the catalog, document information, and ID of the laid out document
+	trailer := make(pdfDict, len(layout.trailer))
+	for key, value := range layout.trailer {
+		if key != "Prev" && key != "XRefStm" {
+			trailer[key] = value
+		}
+	}
+	trailer["Size"] = float64(size)
+	buf.WriteString("trailer\n")
+	writePDFObject(&buf, trailer)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	return write(buf.Bytes())
+}
@@ -0,0 +1,117 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// recordingWriter records the size of every write.
+type recordingWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.writes = append(w.writes, len(data))
+	return w.Buffer.Write(data)
+}
+
+func TestWritePDF(t *testing.T) {
+	loadFonts(t)
+
+	pc := core.NewPaperCrypt("2.0.0", bytes.Repeat([]byte("data"), 128), "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatRaw)
+	for _, pdfa := range []bool{false, true} {
+		opts := TextOptions{Code2D: core.Code2DOptions{Type: core.Code2DTypeQR, QRMaxVersion: 10}, PDFA: pdfa}
+		codes, err := newCode2DImageSet(pc, false, opts)
+		if err != nil {
+			t.Fatalf("code2DImageSet failed with error %s", err)
+		}
+		if codes.Len() < 2 {
+			t.Fatalf("got: %d codes, want: at least 2.", codes.Len())
+		}
+
+		w := &recordingWriter{}
+		pages, err := WritePDF(pc, w, false, opts)
+		if err != nil {
+			t.Fatalf("WritePDF failed with error %s", err)
+		}
+		if pages < codes.Len() {
+			t.Errorf("got: %d pages, want: at least %d.", pages, codes.Len())
+		}
+
+		// the document is written an object at a time, no write holds more than a single code image
+		doc := w.Bytes()
+		largest := 0
+		for _, n := range w.writes {
+			largest = max(largest, n)
+		}
+		if len(w.writes) < codes.Len() || largest >= len(doc)/2 {
+			t.Errorf("got: %d writes of at most %d bytes, want: a write per object, of a %d bytes document.", len(w.writes), largest, len(doc))
+		}
+
+		// the placeholders are replaced by the images of the codes
+		images, err := ExtractPDFImages(doc)
+		if err != nil {
+			t.Fatalf("ExtractPDFImages failed with error %s", err)
+		}
+		for i := range codes.Len() {
+			codePNG, err := codes.PNG(i)
+			if err != nil {
+				t.Fatalf("PNG failed with error %s", err)
+			}
+			want, err := png.Decode(bytes.NewReader(codePNG))
+			if err != nil {
+				t.Fatalf("png.Decode failed with error %s", err)
+			}
+
+			found := false
+			for _, img := range images {
+				if gray, ok := img.(*image.Gray); ok && gray.Bounds() == want.Bounds() && bytes.Equal(gray.Pix, want.(*image.Gray).Pix) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("The document does not hold the image of code %d", i+1)
+			}
+		}
+		for _, img := range images {
+			if img.Bounds().Dy() == 1 {
+				t.Errorf("The document holds a placeholder image")
+			}
+		}
+
+		// what is added after the layout, the PDF/A header, or the attached document, is kept
+		if pdfa && !bytes.HasPrefix(doc, []byte("%PDF-1.3\n"+pdfBinaryComment)) {
+			t.Errorf("The PDF/A document does not start with a binary comment")
+		}
+		if attachment, ok, err := ExtractPDFAttachment(doc); err != nil || ok == pdfa || (!pdfa && len(attachment) == 0) {
+			t.Errorf("ExtractPDFAttachment failed with error %v, found: %t", err, ok)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // logos may be JPEG images
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Names of the sections on the first page of a document, in their default order.
+const (
+	PDFSectionDescription    = "description"
+	PDFSectionRepresentation = "representation"
+	PDFSectionRecovery       = "recovery"
+	PDFSectionReadBack       = "read-back"
+	PDFSectionChecksums      = "checksums"
+	PDFSectionContact        = "contact"
+)
+
+// Names of the fields of the header line of each page, in their default order.
+const (
+	PDFHeaderFieldSerial  = "serial"
+	PDFHeaderFieldDate    = "date"
+	PDFHeaderFieldPurpose = "purpose"
+)
+
+var (
+	pdfSections     = []string{PDFSectionDescription, PDFSectionRepresentation, PDFSectionRecovery, PDFSectionReadBack, PDFSectionChecksums, PDFSectionContact}
+	pdfHeaderFields = []string{PDFHeaderFieldSerial, PDFHeaderFieldDate, PDFHeaderFieldPurpose}
+)
+
+// pdfLogoMaxWidth and pdfLogoHeight limit the size of the logo in the header of each page, in mm.
+const (
+	pdfLogoMaxWidth = 30.0
+	pdfLogoHeight   = 8.0
+)
+
+// PDFTemplate customizes the PDF documents, for organizations to brand their recovery sheets.
+// The zero value leaves the layout as it is.
+type PDFTemplate struct {
+	// Logo is the path of a PNG or JPEG image, printed in the top left corner of each page.
+	// Relative paths are relative to the template file.
+	Logo string
+
+	// Header is a line of text printed below the header line of each page.
+	Header string
+
+	// Footer is a line of text printed next to the page number of each page.
+	Footer string
+
+	// Contact is printed as a section of the first page, for example whom to ask for help with the recovery.
+	Contact string
+
+	// HeaderFields is the order of the fields of the header line, fields not listed follow in their default order.
+	HeaderFields []string
+
+	// Sections is the order of the sections of the first page, sections not listed follow in their default order.
+	Sections []string
+
+	logo       []byte
+	logoType   string
+	logoConfig image.Config
+}
+
+// LoadPDFTemplate reads a template file (see ParsePDFTemplate) and the logo it refers to.
+func LoadPDFTemplate(path string) (*PDFTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading template"), err)
+	}
+
+	template, err := ParsePDFTemplate(data)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error parsing template %s", path), err)
+	}
+
+	if template.Logo != "" {
+		logoPath := template.Logo
+		if !filepath.IsAbs(logoPath) {
+			logoPath = filepath.Join(filepath.Dir(path), logoPath)
+		}
+
+		template.logo, err = os.ReadFile(logoPath)
+		if err != nil {
+			return nil, errors.Join(errors.New("error reading logo"), err)
+		}
+		if template.logoConfig, template.logoType, err = image.DecodeConfig(bytes.NewReader(template.logo)); err != nil {
+			return nil, errors.Join(errors.New("error reading logo"), err)
+		}
+		if template.logoType != "png" && template.logoType != "jpeg" {
+			return nil, fmt.Errorf("logo must be a PNG or JPEG image, not %s", template.logoType)
+		}
+		if template.logoConfig.Width == 0 || template.logoConfig.Height == 0 {
+			return nil, errors.New("logo is empty")
+		}
+	}
+
+	return template, nil
+}
+
+// ParsePDFTemplate parses a template, written in a subset of YAML:
+// `key: value` lines, lists written as `[a, b]` or as indented `- item` lines,
+// and text of several lines introduced by `|`, for example:
+//
+//	logo: logo.png
+//	header: ACME Corp. - Confidential
+//	footer: "Keep in the safe, room 101"
+//	contact: |
+//	  IT Security, security@example.com
+//	  +1 555 0100
+//	header_fields: [purpose, serial, date]
+//	sections:
+//	  - contact
+//	  - recovery
+func ParsePDFTemplate(data []byte) (*PDFTemplate, error) {
+	template := new(PDFTemplate)
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unexpected indentation", i+1)
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", i+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		// indented lines belong to the key
+		var block []string
+		for i+1 < len(lines) && (strings.TrimSpace(lines[i+1]) == "" || lines[i+1][0] == ' ' || lines[i+1][0] == '\t') {
+			i++
+			block = append(block, lines[i])
+		}
+
+		var text string
+		var list []string
+		var err error
+		switch {
+		case value == "|":
+			text = templateBlock(block)
+		case value == "" || strings.HasPrefix(value, "["):
+			list, err = templateList(value, block)
+		case len(strings.TrimSpace(strings.Join(block, ""))) > 0:
+			err = errors.New("unexpected indented lines")
+		default:
+			text, err = templateScalar(value)
+		}
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("line %d: invalid value of '%s'", i+1, key), err)
+		}
+
+		switch key {
+		case "logo":
+			template.Logo = text
+		case "header":
+			template.Header = text
+		case "footer":
+			template.Footer = text
+		case "contact":
+			template.Contact = text
+		case "header_fields":
+			template.HeaderFields = list
+		case "sections":
+			template.Sections = list
+		default:
+			return nil, fmt.Errorf("line %d: unknown template option '%s'", i+1, key)
+		}
+	}
+
+	if _, err := orderNames(template.HeaderFields, pdfHeaderFields, "header field"); err != nil {
+		return nil, err
+	}
+	if _, err := orderNames(template.Sections, pdfSections, "section"); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// templateScalar returns a single value, removing quotes, and comments after unquoted values.
+func templateScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", errors.New("unterminated quote")
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// templateBlock returns the lines of a `|` block, without their common indentation.
+func templateBlock(block []string) string {
+	indent := -1
+	for _, line := range block {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	lines := make([]string, len(block))
+	for i, line := range block {
+		if len(line) >= indent && indent >= 0 {
+			line = line[indent:]
+		}
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// templateList returns the items of an inline `[a, b]` list, or of a block of `- item` lines.
+func templateList(value string, block []string) ([]string, error) {
+	var items []string
+	if value != "" {
+		if !strings.HasSuffix(value, "]") {
+			return nil, errors.New("unterminated list")
+		}
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				text, err := templateScalar(item)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, text)
+			}
+		}
+	}
+
+	for _, line := range block {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if value != "" || !strings.HasPrefix(line, "-") {
+			return nil, fmt.Errorf("unexpected line '%s' in list", line)
+		}
+
+		text, err := templateScalar(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, text)
+	}
+
+	return items, nil
+}
+
+// orderNames returns all names of `defaults`, those listed in `order` first.
+func orderNames(order []string, defaults []string, kind string) ([]string, error) {
+	ordered := make([]string, 0, len(defaults))
+	seen := make(map[string]bool, len(defaults))
+	for _, name := range order {
+		name = strings.ToLower(name)
+		known := false
+		for _, d := range defaults {
+			known = known || d == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown %s '%s', must be one of: %s", kind, name, strings.Join(defaults, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s '%s' is listed twice", kind, name)
+		}
+
+		seen[name] = true
+		ordered = append(ordered, name)
+	}
+
+	for _, name := range defaults {
+		if !seen[name] {
+			ordered = append(ordered, name)
+		}
+	}
+
+	return ordered, nil
+}
+
+// sectionOrder returns the names of the sections of the first page, in the order they are printed.
+func (t *PDFTemplate) sectionOrder() []string {
+	if t == nil {
+		return pdfSections
+	}
+
+	sections, _ := orderNames(t.Sections, pdfSections, "section")
+	return sections
+}
+
+// headerFieldOrder returns the names of the fields of the header line, in the order they are printed.
+func (t *PDFTemplate) headerFieldOrder() []string {
+	if t == nil {
+		return pdfHeaderFields
+	}
+
+	fields, _ := orderNames(t.HeaderFields, pdfHeaderFields, "header field")
+	return fields
+}
+
+// logoSize returns the printed width and height of the logo, in mm.
+// It is pdfLogoHeight high, unless that would make it wider than pdfLogoMaxWidth.
+func (t *PDFTemplate) logoSize() (float64, float64) {
+	ratio := float64(t.logoConfig.Width) / float64(t.logoConfig.Height)
+	if width := pdfLogoHeight * ratio; width <= pdfLogoMaxWidth {
+		return width, pdfLogoHeight
+	}
+
+	return pdfLogoMaxWidth, pdfLogoMaxWidth / ratio
+}
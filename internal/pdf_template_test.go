@@ -0,0 +1,127 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePDFTemplate(t *testing.T) {
+	data := []byte(`# ACME recovery sheets
+logo: logo.png
+header: ACME Corp. - Confidential # printed on every page
+footer: "Keep in the safe: room 101"
+contact: |
+  IT Security, security@example.com
+
+  +1 555 0100
+header_fields: [purpose, serial]
+sections:
+  - contact
+  - recovery
+`)
+
+	template, err := ParsePDFTemplate(data)
+	if err != nil {
+		t.Fatalf("ParsePDFTemplate failed with error %s", err)
+	}
+
+	want := &PDFTemplate{
+		Logo:         "logo.png",
+		Header:       "ACME Corp. - Confidential",
+		Footer:       "Keep in the safe: room 101",
+		Contact:      "IT Security, security@example.com\n\n+1 555 0100",
+		HeaderFields: []string{"purpose", "serial"},
+		Sections:     []string{"contact", "recovery"},
+	}
+	if !reflect.DeepEqual(template, want) {
+		t.Errorf("got: %+v, want: %+v.", template, want)
+	}
+
+	if got, want := template.headerFieldOrder(), []string{"purpose", "serial", "date"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v.", got, want)
+	}
+	if got, want := template.sectionOrder(), []string{"contact", "recovery", "description", "representation", "read-back", "checksums"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v.", got, want)
+	}
+	if got := (*PDFTemplate)(nil).sectionOrder(); !reflect.DeepEqual(got, pdfSections) {
+		t.Errorf("got: %v, want: %v.", got, pdfSections)
+	}
+}
+
+func TestParsePDFTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"unknown option", "colour: red"},
+		{"unknown section", "sections: [description, appendix]"},
+		{"duplicate field", "header_fields: [date, date]"},
+		{"missing colon", "logo"},
+		{"unexpected indentation", "  logo: logo.png"},
+		{"indented lines after a value", "header: ACME\n  Corp."},
+		{"unterminated quote", "footer: 'ACME"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePDFTemplate([]byte(tt.data)); err == nil {
+				t.Errorf("ParsePDFTemplate should have failed")
+			}
+		})
+	}
+}
+
+func TestLoadPDFTemplateLogo(t *testing.T) {
+	dir := t.TempDir()
+
+	logo, err := os.Create(filepath.Join(dir, "logo.png"))
+	if err != nil {
+		t.Fatalf("Create failed with error %s", err)
+	}
+	if err := png.Encode(logo, image.NewGray(image.Rect(0, 0, 400, 100))); err != nil {
+		t.Fatalf("Encode failed with error %s", err)
+	}
+	_ = logo.Close()
+
+	path := filepath.Join(dir, "template.yaml")
+	if err := os.WriteFile(path, []byte("logo: logo.png\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed with error %s", err)
+	}
+
+	template, err := LoadPDFTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadPDFTemplate failed with error %s", err)
+	}
+	if template.logoType != "png" {
+		t.Errorf("got: %s, want: png.", template.logoType)
+	}
+
+	// a wide logo is limited by its width
+	if width, height := template.logoSize(); width != pdfLogoMaxWidth || height != pdfLogoMaxWidth/4 {
+		t.Errorf("got: %.1f x %.1f mm, want: %.1f x %.1f mm.", width, height, pdfLogoMaxWidth, pdfLogoMaxWidth/4)
+	}
+}
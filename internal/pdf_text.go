@@ -0,0 +1,127 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// pdfGlyph is a character shown on a page, in points from the top left corner of the page.
+type pdfGlyph struct {
+	char rune
+
+	// origin is the start of the glyph on its baseline, end that of the next glyph
+	origin, end rasterPoint
+
+	// size is the font size
+	size float64
+
+	// upright is false for rotated, or skewed, text, such as the watermark
+	upright bool
+}
+
+// ExtractPDFText returns the text of each page of a PDF document written by PaperCrypt, as laid out on the page:
+// a line for each baseline, from top to bottom, holding the text on it from left to right.
+// Text that is not upright, such as the watermark, is left out.
+// Only the fonts written by gofpdf for UTF-8 text are supported, whose character codes are the Unicode code points.
+func ExtractPDFText(doc []byte) ([]string, error) {
+	pdf, err := readPDFDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := pdf.pages()
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("PDF document has no pages")
+	}
+
+	fonts := make(map[pdfRef]*rasterFont)
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		mediaBox, err := pdf.mediaBox(page)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading page %d", i+1), err)
+		}
+		content, err := pdf.content(page)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading page %d", i+1), err)
+		}
+
+		r := pdf.newPageRenderer(page, nil, mediaBox, 1, fonts)
+		if err := r.run(content); err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading the text of page %d", i+1), err)
+		}
+		texts[i] = pdfTextLines(r.glyphs)
+	}
+
+	return texts, nil
+}
+
+// pdfTextLines arranges glyphs into lines of text: glyphs whose baselines are less than half their size apart
+// are on the same line. Glyphs further apart than a quarter of their size, such as those of separate cells, are separated by a space.
+func pdfTextLines(glyphs []pdfGlyph) string {
+	glyphs = slices.DeleteFunc(slices.Clone(glyphs), func(g pdfGlyph) bool { return !g.upright })
+	slices.SortStableFunc(glyphs, func(a, b pdfGlyph) int { return cmp.Compare(a.origin.Y, b.origin.Y) })
+
+	var lines []string
+	for start := 0; start < len(glyphs); {
+		end := start + 1
+		for end < len(glyphs) && glyphs[end].origin.Y-glyphs[start].origin.Y < glyphs[start].size/2 {
+			end++
+		}
+
+		line := glyphs[start:end]
+		slices.SortStableFunc(line, func(a, b pdfGlyph) int { return cmp.Compare(a.origin.X, b.origin.X) })
+
+		var text strings.Builder
+		for i, g := range line {
+			if i > 0 && g.origin.X-line[i-1].end.X > g.size/4 && g.char != ' ' && line[i-1].char != ' ' {
+				text.WriteByte(' ')
+			}
+			text.WriteRune(g.char)
+		}
+		lines = append(lines, strings.TrimSpace(text.String()))
+		start = end
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ReadDocumentFromPDFText reads a document from the text of the pages of a PDF document generated by PaperCrypt,
+// see ExtractPDFText, as ReadDocumentByOCR reads it from their images. The text is exact, so nothing is corrected,
+// but, as by OCR, only base16, base32, and base64 data blocks with line numbers can be read.
+func ReadDocumentFromPDFText(doc []byte) (*OCRResult, error) {
+	pages, err := ExtractPDFText(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return readPrintedDocument(len(pages), func(page int, _ string) (string, error) {
+		return pages[page], nil
+	})
+}
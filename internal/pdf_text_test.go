@@ -0,0 +1,72 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestReadDocumentFromPDFText(t *testing.T) {
+	loadFonts(t)
+
+	data := bytes.Repeat([]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF}, 40)
+	pc := core.NewPaperCrypt("2.0.0", data, "ABCDEF", "Example Sheet", "Café", time.Now(), core.PaperCryptDataFormatRaw)
+
+	for _, opts := range []TextOptions{
+		{PDFA: true},
+		{Encoding: core.PaperCryptDataEncodingBase32, ErrorCorrectionLevel: 20, Watermark: "COPY"},
+		{Encoding: core.PaperCryptDataEncodingBase64, LineChecksum: core.LineChecksumSHA256, Banner: "CONFIDENTIAL"},
+	} {
+		doc, err := GetPDF(pc, true, opts)
+		if err != nil {
+			t.Fatalf("GetPDF failed with error %s", err)
+		}
+
+		pages, err := ExtractPDFText(doc)
+		if err != nil {
+			t.Fatalf("ExtractPDFText failed with error %s", err)
+		}
+		if text := strings.Join(pages, "\n"); !strings.Contains(text, "# Comment: Café") || strings.Contains(text, "COPY") {
+			t.Errorf("%s: got: %s, want: the header, without the watermark.", opts.Encoding, text)
+		}
+
+		result, err := ReadDocumentFromPDFText(doc)
+		if err != nil {
+			t.Fatalf("ReadDocumentFromPDFText failed with error %s", err)
+		}
+		if len(result.Corrected) != 0 || len(result.Unreadable) != 0 || !result.HeaderValid {
+			t.Errorf("%s: got: corrected %v, unreadable %v, header valid %v, want: a clean read.", opts.Encoding, result.Corrected, result.Unreadable, result.HeaderValid)
+		}
+
+		restored, err := core.DeserializeV2Text(result.Text, false, false)
+		if err != nil {
+			t.Fatalf("DeserializeV2Text failed with error %s", err)
+		}
+		if !bytes.Equal(restored.Data, data) || restored.Comment != pc.Comment {
+			t.Errorf("%s: got: %x, %q, want: %x, %q.", opts.Encoding, restored.Data, restored.Comment, data, pc.Comment)
+		}
+	}
+}
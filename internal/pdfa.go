@@ -0,0 +1,261 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gofpdf does not support PDF/A, ConvertToPDFA adds what is missing to its output:
+// a binary comment following the file header, XMP metadata identifying the document as PDF/A-2b,
+// an output intent with an embedded sRGB color profile, and a document ID.
+// Fonts written by gofpdf are embedded already, and documents never reference external resources.
+// The additions are written as an incremental update, so the objects written by gofpdf stay untouched.
+
+// PDFAConformance is the PDF/A part and conformance level of documents written by ConvertToPDFA.
+const PDFAConformance = "PDF/A-2b"
+
+// pdfBinaryComment marks a PDF file as binary, as required by PDF/A.
+const pdfBinaryComment = "%\xE2\xE3\xCF\xD3\n"
+
+var (
+	pdfStartXRefPattern = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n?$`)
+	pdfXRefPattern      = regexp.MustCompile(`^xref\n0 (\d+)\n`)
+	pdfTrailerPattern   = regexp.MustCompile(`(?s)trailer\n<<(.*?)>>\nstartxref`)
+)
+
+// ConvertToPDFA converts a PDF document written by gofpdf to a PDF/A-2b document.
+// The metadata names creator as the creating application, and date as the creation date.
+func ConvertToPDFA(doc []byte, creator string, date time.Time) ([]byte, error) {
+	// PDF/A requires the file header at the very start of the file,
+	// operators set before the first page are written in front of it by gofpdf
+	start := bytes.Index(doc, []byte("%PDF-"))
+	headerEnd := bytes.IndexByte(doc[max(start, 0):], '\n') + start
+	if start < 0 || headerEnd < start {
+		return nil, errors.New("not a PDF document")
+	}
+
+	match := pdfStartXRefPattern.FindSubmatchIndex(doc)
+	if match == nil {
+		return nil, errors.New("PDF document has no cross-reference table")
+	}
+	xrefOffset, err := strconv.Atoi(string(doc[match[2]:match[3]]))
+	if err != nil || xrefOffset >= len(doc) {
+		return nil, errors.Join(errors.New("invalid cross-reference table offset"), err)
+	}
+
+	// the binary comment moves every object, so the cross-reference table is rewritten
+	shift := len(pdfBinaryComment) - start
+	xref := pdfXRefPattern.FindSubmatch(doc[xrefOffset:])
+	if xref == nil {
+		return nil, errors.New("PDF document has an invalid cross-reference table")
+	}
+	size, err := strconv.Atoi(string(xref[1]))
+	if err != nil {
+		return nil, errors.Join(errors.New("invalid cross-reference table size"), err)
+	}
+
+	entries := xrefOffset + len(xref[0])
+	if entries+size*20 > len(doc) {
+		return nil, errors.New("PDF document has a truncated cross-reference table")
+	}
+
+	var out bytes.Buffer
+	out.Write(doc[start : headerEnd+1])
+	out.WriteString(pdfBinaryComment)
+	out.Write(doc[headerEnd+1 : entries])
+	for i := 0; i < size; i++ {
+		entry := doc[entries+i*20 : entries+(i+1)*20]
+		if entry[17] != 'n' {
+			out.Write(entry)
+			continue
+		}
+
+		offset, err := strconv.Atoi(string(entry[:10]))
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("invalid offset of object %d", i), err)
+		}
+		fmt.Fprintf(&out, "%010d%s", offset+shift, entry[10:])
+	}
+	out.Write(doc[entries+size*20 : match[2]])
+	fmt.Fprintf(&out, "%d\n%%%%EOF\n", xrefOffset+shift)
+
+	trailer := pdfTrailerPattern.FindSubmatch(doc[xrefOffset:])
+	if trailer == nil {
+		return nil, errors.New("PDF document has no trailer")
+	}
+	root, err := pdfReference(trailer[1], "Root")
+	if err != nil {
+		return nil, err
+	}
+	info, err := pdfReference(trailer[1], "Info")
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := regexp.MustCompile(fmt.Sprintf(`(?s)\n%d 0 obj\n<<(.*?)\n>>\nendobj`, root)).FindSubmatch(doc)
+	if catalog == nil {
+		return nil, errors.New("PDF document has no catalog")
+	}
+
+	// the incremental update: metadata and color profile are new objects,
+	// catalog and document information replace the objects written by gofpdf
+	metadata, profile := size, size+1
+	offsets := make(map[int]int)
+	writeObject := func(n int, content string) {
+		offsets[n] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", n, content)
+	}
+
+	xmp := pdfaXMP(creator, date)
+	writeObject(metadata, fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp))
+
+	icc := sRGBProfile()
+	writeObject(profile, fmt.Sprintf("<< /N 3 /Length %d >>\nstream\n%s\nendstream", len(icc), icc))
+
+	writeObject(root, fmt.Sprintf("<<%s\n/Metadata %d 0 R\n/OutputIntents [<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>]\n>>", catalog[1], metadata, profile))
+
+	pdfDate := "D:" + date.UTC().Format("20060102150405") + "Z"
+	writeObject(info, fmt.Sprintf("<<\n/Producer %s\n/Creator %s\n/CreationDate (%s)\n/ModDate (%s)\n>>", pdfString(creator), pdfString(creator), pdfDate, pdfDate))
+
+	xrefStart := out.Len()
+	out.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, n := range []int{root, info} {
+		fmt.Fprintf(&out, "%d 1\n%010d 00000 n \n", n, offsets[n])
+	}
+	fmt.Fprintf(&out, "%d 2\n%010d 00000 n \n%010d 00000 n \n", metadata, offsets[metadata], offsets[profile])
+
+	id := md5.Sum(doc)
+	fmt.Fprintf(&out, "trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n/ID [<%x> <%x>]\n/Prev %d\n>>\n", profile+1, root, info, id, id, xrefOffset+shift)
+	fmt.Fprintf(&out, "startxref\n%d\n%%%%EOF\n", xrefStart)
+
+	return out.Bytes(), nil
+}
+
+// pdfReference returns the number of the object referenced by key in a dictionary.
+func pdfReference(dict []byte, key string) (int, error) {
+	match := regexp.MustCompile(`/` + key + ` (\d+) 0 R`).FindSubmatch(dict)
+	if match == nil {
+		return 0, fmt.Errorf("PDF trailer has no /%s entry", key)
+	}
+
+	return strconv.Atoi(string(match[1]))
+}
+
+// pdfString returns s as a PDF literal string.
+func pdfString(s string) string {
+	return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+}
+
+// pdfaXMP returns the XMP metadata of a PDF/A-2b document, matching the document information written by ConvertToPDFA.
+func pdfaXMP(creator string, date time.Time) string {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(creator))
+	xmpDate := date.UTC().Format("2006-01-02T15:04:05Z")
+
+	return `<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+<pdfaid:part>2</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+<xmp:CreatorTool>` + escaped.String() + `</xmp:CreatorTool>
+<xmp:CreateDate>` + xmpDate + `</xmp:CreateDate>
+<xmp:ModifyDate>` + xmpDate + `</xmp:ModifyDate>
+<pdf:Producer>` + escaped.String() + `</pdf:Producer>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+}
+
+// sRGBProfile returns a minimal ICC (version 2) color profile for sRGB,
+// using the D50-adapted sRGB primaries and a gamma of 2.2.
+func sRGBProfile() []byte {
+	s15Fixed16 := func(v float64) uint32 {
+		return uint32(int32(v * 65536))
+	}
+	xyz := func(x, y, z float64) []byte {
+		tag := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			tag = binary.BigEndian.AppendUint32(tag, s15Fixed16(v))
+		}
+		return tag
+	}
+
+	desc := []byte("desc\x00\x00\x00\x00")
+	description := "sRGB IEC61966-2.1\x00"
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(description)))
+	desc = append(desc, description...)
+	desc = append(desc, make([]byte, 4+4+2+1+67)...) // no Unicode and ScriptCode descriptions
+
+	curve := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x02\x33") // a single u8Fixed8 gamma value, 2.2
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", desc},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	var table, data bytes.Buffer
+	dataOffset := 128 + 4 + 12*len(tags)
+	_ = binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	for _, tag := range tags {
+		table.WriteString(tag.signature)
+		_ = binary.Write(&table, binary.BigEndian, []uint32{uint32(dataOffset + data.Len()), uint32(len(tag.data))})
+		data.Write(tag.data)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(dataOffset+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntrRGB XYZ ")
+	for i, v := range []uint16{2024, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	for i, v := range []float64{0.9642, 1.0, 0.8249} { // D50 illuminant
+		binary.BigEndian.PutUint32(header[68+4*i:], s15Fixed16(v))
+	}
+
+	return append(append(header, table.Bytes()...), data.Bytes()...)
+}
@@ -0,0 +1,138 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jung-kurt/gofpdf/v2"
+)
+
+// checkPDFObjects checks that every cross-reference table of a PDF document points to the objects it lists,
+// following the tables of incremental updates, and returns the number of objects checked.
+func checkPDFObjects(t *testing.T, doc []byte) int {
+	t.Helper()
+
+	sections := regexp.MustCompile(`(\d+) (\d+)\n`)
+	objects := 0
+	for _, match := range regexp.MustCompile(`(?s)\nxref\n(.*?)trailer`).FindAllSubmatch(doc, -1) {
+		table := match[1]
+		for len(table) > 0 {
+			section := sections.FindSubmatch(table)
+			if section == nil {
+				t.Fatalf("Invalid cross-reference table: %q", table)
+			}
+			first, _ := strconv.Atoi(string(section[1]))
+			count, _ := strconv.Atoi(string(section[2]))
+			table = table[len(section[0]):]
+
+			for i := 0; i < count; i++ {
+				entry := table[i*20 : (i+1)*20]
+				if entry[17] == 'n' {
+					offset, _ := strconv.Atoi(string(entry[:10]))
+					if !bytes.HasPrefix(doc[offset:], []byte(fmt.Sprintf("%d 0 obj", first+i))) {
+						t.Errorf("Object %d is not at offset %d", first+i, offset)
+					}
+					objects++
+				}
+			}
+			table = table[count*20:]
+		}
+	}
+
+	return objects
+}
+
+func TestConvertToPDFA(t *testing.T) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTextRenderingMode(4) // written in front of the header
+	pdf.AddPage()
+	pdf.SetFont("Arial", "", 10)
+	pdf.Cell(0, 5, "Hello")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("Output failed with error %s", err)
+	}
+	before := checkPDFObjects(t, buf.Bytes())
+
+	date := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	doc, err := ConvertToPDFA(buf.Bytes(), "PaperCrypt (test) & co", date)
+	if err != nil {
+		t.Fatalf("ConvertToPDFA failed with error %s", err)
+	}
+
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.3\n"+pdfBinaryComment)) {
+		t.Errorf("got: %q, want: header followed by binary comment.", doc[:16])
+	}
+	if got := checkPDFObjects(t, doc); got != before+4 {
+		t.Errorf("got: %d objects, want: %d.", got, before+4)
+	}
+
+	startXRef := pdfStartXRefPattern.FindSubmatch(doc)
+	offset, _ := strconv.Atoi(string(startXRef[1]))
+	if !bytes.HasPrefix(doc[offset:], []byte("xref\n")) {
+		t.Errorf("startxref does not point to the last cross-reference table")
+	}
+
+	for _, want := range []string{
+		"<pdfaid:part>2</pdfaid:part>",
+		"<xmp:CreatorTool>PaperCrypt (test) &amp; co</xmp:CreatorTool>",
+		"<xmp:CreateDate>2024-02-03T04:05:06Z</xmp:CreateDate>",
+		"/CreationDate (D:20240203040506Z)",
+		`/Creator (PaperCrypt \(test\) & co)`,
+		"/OutputIntents [",
+		"/ID [<",
+	} {
+		if !bytes.Contains(doc, []byte(want)) {
+			t.Errorf("PDF/A document should contain %q", want)
+		}
+	}
+
+	if _, err := ConvertToPDFA([]byte("not a pdf"), "", date); err == nil {
+		t.Errorf("ConvertToPDFA should fail for invalid documents")
+	}
+}
+
+func TestSRGBProfile(t *testing.T) {
+	profile := sRGBProfile()
+	if got := binary.BigEndian.Uint32(profile); int(got) != len(profile) {
+		t.Errorf("got: %d, want: %d.", got, len(profile))
+	}
+	if got := string(profile[36:40]); got != "acsp" {
+		t.Errorf("got: %s, want: acsp.", got)
+	}
+
+	tags := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < tags; i++ {
+		entry := profile[132+12*i:]
+		offset, size := binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:])
+		if offset%4 != 0 || int(offset+size) > len(profile) {
+			t.Errorf("Tag %s at offset %d (%d bytes) is out of bounds", entry[:4], offset, size)
+		}
+	}
+}
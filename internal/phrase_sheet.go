@@ -35,6 +35,7 @@ import (
 	"github.com/jung-kurt/gofpdf/v2"
 	"github.com/makiuchi-d/gozxing"
 	"github.com/makiuchi-d/gozxing/datamatrix"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 func GenerateFromSeed(seed int64, amount int, wordList *[]string) ([]string, error) {
@@ -49,7 +50,7 @@ func GenerateFromSeed(seed int64, amount int, wordList *[]string) ([]string, err
 		random := gen.Intn(len(*wordList)) // Intn returns [0, n) (excludes n)
 		w := (*wordList)[random]
 
-		if SliceHasString(words, w) {
+		if core.SliceHasString(words, w) {
 			// if the word is already in the slice, try again
 			log.WithField("word", w).WithField("index", i).Warn("Duplicate word appeared, trying again...")
 			i--
@@ -62,7 +63,7 @@ func GenerateFromSeed(seed int64, amount int, wordList *[]string) ([]string, err
 }
 
 func GeneratePassphraseSheetPDF(seed int64, words []string) ([]byte, error) {
-	pdf := getPdf()
+	pdf := getPdf(core.Page{})
 
 	dm := new(bytes.Buffer)
 	dmDims := [2]int{}
@@ -92,7 +93,7 @@ func GeneratePassphraseSheetPDF(seed int64, words []string) ([]byte, error) {
 		}
 	}
 
-	date := time.Now().Format(TimeStampFormatPDFHeader)
+	date := time.Now().Format(core.TimeStampFormatPDFHeader)
 
 	pdf.SetHeaderFuncMode(func() {
 		pdf.SetY(5)
@@ -0,0 +1,106 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Printer sends documents to the default printer of the system.
+type Printer interface {
+	// Print queues the file at path for printing.
+	Print(path string) error
+}
+
+// NewPrinter returns the printer of the operating system: CUPS on Linux, macOS and BSD, using the lp program
+// at lpPath, or the print command of the application associated with the file type on Windows.
+func NewPrinter(goos string, lpPath string) (Printer, error) {
+	switch goos {
+	case "windows":
+		return NewShellPrinter()
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd":
+		return NewLPPrinter(lpPath)
+	default:
+		return nil, fmt.Errorf("printing is not supported on %s", goos)
+	}
+}
+
+// LPPrinter prints documents using the lp command line program of CUPS (https://www.cups.org).
+type LPPrinter struct {
+	// Path is the path of the lp program.
+	Path string
+}
+
+// NewLPPrinter looks up the lp program, by name in the PATH, or at the given path.
+func NewLPPrinter(path string) (*LPPrinter, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%s not found, install CUPS (https://www.cups.org) to print documents", path), err)
+	}
+
+	return &LPPrinter{Path: resolved}, nil
+}
+
+func (p *LPPrinter) Print(path string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(p.Path, "--", path)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Join(fmt.Errorf("error running lp: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return nil
+}
+
+// ShellPrinter prints documents on Windows, using the print command of the application associated with the file type,
+// started through PowerShell.
+type ShellPrinter struct {
+	// Path is the path of the PowerShell program.
+	Path string
+}
+
+// NewShellPrinter looks up PowerShell, which starts the print command of the associated application.
+func NewShellPrinter() (*ShellPrinter, error) {
+	resolved, err := exec.LookPath("powershell")
+	if err != nil {
+		return nil, errors.Join(errors.New("powershell not found, it is needed to print documents"), err)
+	}
+
+	return &ShellPrinter{Path: resolved}, nil
+}
+
+func (p *ShellPrinter) Print(path string) error {
+	// quotes are doubled to escape them in PowerShell strings
+	script := fmt.Sprintf("$ErrorActionPreference = 'Stop'; Start-Process -FilePath '%s' -Verb Print", strings.ReplaceAll(path, "'", "''"))
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(p.Path, "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Join(fmt.Errorf("error printing using the associated application: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return nil
+}
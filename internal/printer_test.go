@@ -0,0 +1,68 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNewPrinter(t *testing.T) {
+	if _, err := NewPrinter("plan9", "lp"); err == nil {
+		t.Errorf("NewPrinter should fail on unsupported systems")
+	}
+	if _, err := NewPrinter("linux", "papercrypt-no-such-program"); err == nil {
+		t.Errorf("NewPrinter should fail if lp is not found")
+	}
+}
+
+func TestLPPrinter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake lp is a shell script")
+	}
+
+	// the fake lp records the arguments it is called with
+	dir := t.TempDir()
+	argsPath := filepath.Join(dir, "args.txt")
+	lpPath := filepath.Join(dir, "lp")
+	script := "#!/bin/sh\necho \"$@\" > " + argsPath + "\n"
+	if err := os.WriteFile(lpPath, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	printer, err := NewLPPrinter(lpPath)
+	if err != nil {
+		t.Fatalf("NewLPPrinter failed with error %s", err)
+	}
+	if err := printer.Print("/tmp/sheet.pdf"); err != nil {
+		t.Fatalf("Print failed with error %s", err)
+	}
+
+	got, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-- /tmp/sheet.pdf\n"; string(got) != want {
+		t.Errorf("Arguments were incorrect, got: %q, want: %q.", got, want)
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// rasterSubsamples is the number of scanlines sampled per row of pixels, for anti-aliasing.
+const rasterSubsamples = 4
+
+// rasterPoint is a point in device space, in pixels.
+type rasterPoint struct {
+	X, Y float64
+}
+
+// matrix is an affine transformation [a b c d e f], mapping (x, y) to (a*x + c*y + e, b*x + d*y + f), as in PDF.
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns the transformation applying m first, then n.
+func (m matrix) multiply(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) rasterPoint {
+	return rasterPoint{X: m[0]*x + m[2]*y + m[4], Y: m[1]*x + m[3]*y + m[5]}
+}
+
+// invert returns the inverse transformation, and false if there is none.
+func (m matrix) invert() (matrix, bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return matrix{}, false
+	}
+
+	return matrix{
+		m[3] / det, -m[1] / det,
+		-m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det, (m[1]*m[4] - m[0]*m[5]) / det,
+	}, true
+}
+
+// scale returns the average scale factor of the transformation.
+func (m matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// flattenQuadratic appends the points of a quadratic Bézier curve, excluding its start point.
+func flattenQuadratic(points []rasterPoint, p0, p1, p2 rasterPoint) []rasterPoint {
+	steps := curveSteps(math.Hypot(p1.X-p0.X, p1.Y-p0.Y) + math.Hypot(p2.X-p1.X, p2.Y-p1.Y))
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		u := 1 - t
+		points = append(points, rasterPoint{
+			X: u*u*p0.X + 2*u*t*p1.X + t*t*p2.X,
+			Y: u*u*p0.Y + 2*u*t*p1.Y + t*t*p2.Y,
+		})
+	}
+
+	return points
+}
+
+// flattenCubic appends the points of a cubic Bézier curve, excluding its start point.
+func flattenCubic(points []rasterPoint, p0, p1, p2, p3 rasterPoint) []rasterPoint {
+	steps := curveSteps(math.Hypot(p1.X-p0.X, p1.Y-p0.Y) + math.Hypot(p2.X-p1.X, p2.Y-p1.Y) + math.Hypot(p3.X-p2.X, p3.Y-p2.Y))
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		u := 1 - t
+		points = append(points, rasterPoint{
+			X: u*u*u*p0.X + 3*u*u*t*p1.X + 3*u*t*t*p2.X + t*t*t*p3.X,
+			Y: u*u*u*p0.Y + 3*u*u*t*p1.Y + 3*u*t*t*p2.Y + t*t*t*p3.Y,
+		})
+	}
+
+	return points
+}
+
+// curveSteps returns the number of line segments to approximate a curve with a control polygon of the given length.
+func curveSteps(length float64) int {
+	return min(64, max(1, int(math.Sqrt(length)*2)))
+}
+
+// fillPolygons fills polygons, given as lists of points in device space, with an anti-aliased color.
+// Overlapping areas are filled using the non-zero winding rule, or the even-odd rule if evenOdd is set.
+func fillPolygons(img *image.RGBA, polygons [][]rasterPoint, c color.RGBA, alpha float64, evenOdd bool) {
+	type edge struct {
+		x0, y0, x1, y1 float64
+		winding        int
+	}
+
+	bounds := img.Bounds()
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	var edges []edge
+	for _, polygon := range polygons {
+		for i, p := range polygon {
+			q := polygon[(i+1)%len(polygon)]
+			minX, maxX = min(minX, p.X), max(maxX, p.X)
+			if p.Y == q.Y {
+				continue
+			}
+
+			minY, maxY = min(minY, p.Y, q.Y), max(maxY, p.Y, q.Y)
+			if p.Y < q.Y {
+				edges = append(edges, edge{p.X, p.Y, q.X, q.Y, 1})
+			} else {
+				edges = append(edges, edge{q.X, q.Y, p.X, p.Y, -1})
+			}
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+
+	top, bottom := max(bounds.Min.Y, int(math.Floor(minY))), min(bounds.Max.Y, int(math.Ceil(maxY)))
+	left, right := max(bounds.Min.X, int(math.Floor(minX))), min(bounds.Max.X, int(math.Ceil(maxX)))
+	if top >= bottom || left >= right {
+		return
+	}
+
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	type crossing struct {
+		x       float64
+		winding int
+	}
+	coverage := make([]float64, right-left)
+	var crossings []crossing
+	var active []edge
+	next := 0
+	for y := top; y < bottom; y++ {
+		clear(coverage)
+		for s := 0; s < rasterSubsamples; s++ {
+			sy := float64(y) + (float64(s)+0.5)/rasterSubsamples
+
+			for next < len(edges) && edges[next].y0 <= sy {
+				active = append(active, edges[next])
+				next++
+			}
+
+			crossings = crossings[:0]
+			kept := active[:0]
+			for _, e := range active {
+				if e.y1 <= sy {
+					continue
+				}
+				kept = append(kept, e)
+				if e.y0 <= sy {
+					crossings = append(crossings, crossing{e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), e.winding})
+				}
+			}
+			active = kept
+			sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+
+			winding := 0
+			for i, cr := range crossings {
+				if evenOdd {
+					winding ^= 1
+				} else {
+					winding += cr.winding
+				}
+				if winding != 0 && i+1 < len(crossings) {
+					addSpan(coverage, cr.x-float64(left), crossings[i+1].x-float64(left), 1.0/rasterSubsamples)
+				}
+			}
+		}
+
+		for i, cov := range coverage {
+			if cov > 0 {
+				blendPixel(img, left+i, y, c, min(cov, 1)*alpha)
+			}
+		}
+	}
+}
+
+// addSpan adds the coverage of a horizontal span from x0 to x1 to the pixels it touches.
+func addSpan(coverage []float64, x0, x1, weight float64) {
+	x0, x1 = max(x0, 0), min(x1, float64(len(coverage)))
+	if x0 >= x1 {
+		return
+	}
+
+	i0, i1 := int(x0), int(x1)
+	if i0 == i1 {
+		coverage[i0] += (x1 - x0) * weight
+		return
+	}
+
+	coverage[i0] += (float64(i0+1) - x0) * weight
+	for i := i0 + 1; i < i1; i++ {
+		coverage[i] += weight
+	}
+	if i1 < len(coverage) {
+		coverage[i1] += (x1 - float64(i1)) * weight
+	}
+}
+
+// blendPixel paints a pixel with a color, with the given opacity.
+func blendPixel(img *image.RGBA, x, y int, c color.RGBA, alpha float64) {
+	offset := img.PixOffset(x, y)
+	pix := img.Pix[offset : offset+4 : offset+4]
+	pix[0] = uint8(float64(pix[0])*(1-alpha) + float64(c.R)*alpha + 0.5)
+	pix[1] = uint8(float64(pix[1])*(1-alpha) + float64(c.G)*alpha + 0.5)
+	pix[2] = uint8(float64(pix[2])*(1-alpha) + float64(c.B)*alpha + 0.5)
+	pix[3] = 0xFF
+}
+
+// strokePolygons returns the outline of lines of the given width along paths, as polygons to be filled.
+// Lines have square caps, which also covers the joins of thin lines.
+func strokePolygons(paths [][]rasterPoint, closed []bool, width float64) [][]rasterPoint {
+	half := max(width, 1) / 2
+
+	var polygons [][]rasterPoint
+	for i, path := range paths {
+		segments := len(path) - 1
+		if closed[i] {
+			segments++
+		}
+
+		for j := 0; j < segments; j++ {
+			p, q := path[j], path[(j+1)%len(path)]
+			length := math.Hypot(q.X-p.X, q.Y-p.Y)
+			if length == 0 {
+				continue
+			}
+
+			// direction and normal, scaled to half the width
+			dx, dy := (q.X-p.X)/length*half, (q.Y-p.Y)/length*half
+			// all polygons wind the same way, so overlaps do not cancel out
+			polygons = append(polygons, []rasterPoint{
+				{p.X - dx - dy, p.Y - dy + dx},
+				{q.X + dx - dy, q.Y + dy + dx},
+				{q.X + dx + dy, q.Y + dy - dx},
+				{p.X - dx + dy, p.Y - dy - dx},
+			})
+		}
+	}
+
+	return polygons
+}
+
+// drawImage paints an image onto the unit square transformed by m, using the nearest pixel of the image,
+// as in PDF, the top row of the image is painted at the top of the unit square.
+func drawImage(img *image.RGBA, src image.Image, m matrix, alpha float64) {
+	inverse, ok := m.invert()
+	if !ok {
+		return
+	}
+
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		p := m.apply(corner[0], corner[1])
+		minX, maxX = min(minX, p.X), max(maxX, p.X)
+		minY, maxY = min(minY, p.Y), max(maxY, p.Y)
+	}
+
+	bounds := img.Bounds()
+	srcBounds := src.Bounds()
+	width, height := float64(srcBounds.Dx()), float64(srcBounds.Dy())
+	for y := max(bounds.Min.Y, int(math.Floor(minY))); y < min(bounds.Max.Y, int(math.Ceil(maxY))); y++ {
+		for x := max(bounds.Min.X, int(math.Floor(minX))); x < min(bounds.Max.X, int(math.Ceil(maxX))); x++ {
+			p := inverse.apply(float64(x)+0.5, float64(y)+0.5)
+			if p.X < 0 || p.X >= 1 || p.Y <= 0 || p.Y > 1 {
+				continue
+			}
+
+			r, g, b, a := src.At(srcBounds.Min.X+int(p.X*width), srcBounds.Min.Y+int((1-p.Y)*height)).RGBA()
+			if a == 0 {
+				continue
+			}
+			// colors are premultiplied
+			c := color.RGBA{R: uint8(r * 0xFFFF / a >> 8), G: uint8(g * 0xFFFF / a >> 8), B: uint8(b * 0xFFFF / a >> 8)}
+			blendPixel(img, x, y, c, alpha*float64(a)/0xFFFF)
+		}
+	}
+}
@@ -27,6 +27,10 @@ import (
 
 // SensitivePrompt reads a password from the tty (if available) or stdin (if not).
 func SensitivePrompt() ([]byte, error) {
+	if err := RequireInteraction("the passphrase"); err != nil {
+		return nil, err
+	}
+
 	_, _ = fmt.Fprint(os.Stderr, "Passphrase: ")
 
 	p, e := ReadTtyLine()
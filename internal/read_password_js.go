@@ -1,3 +1,5 @@
+//go:build js
+
 /*
  * This file is part of PaperCrypt.
  *
@@ -20,10 +22,9 @@
 
 package internal
 
-const (
-	TimeStampFormatLong      = "Mon, 02 Jan 2006 15:04:05.000000000 -0700"
-	TimeStampFormatLongTZ    = "Mon, 02 Jan 2006 15:04:05.000000000 MST"
-	TimeStampFormatShort     = "2006-01-02 15:04:05"
-	TimeStampFormatDate      = "2006-01-02"
-	TimeStampFormatPDFHeader = "2006-01-02 15:04 -0700"
-)
+import "errors"
+
+// readTtyLine fails in browsers (GOOS=js), which have no terminal to read the passphrase from.
+func readTtyLine() ([]byte, error) {
+	return nil, errors.New("no terminal to read the passphrase from")
+}
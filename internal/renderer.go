@@ -0,0 +1,104 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import "github.com/tmuniversal/papercrypt/v2/internal/core"
+
+import "strings"
+
+// Renderer lays out a document using a typesetting backend.
+// The content of the document is shared by all renderers (see documentSections), only the layout is up to each of them.
+// Besides the built-in PDF and HTML renderers, renderers may write the source code of a typesetting system
+// (such as Typst, LaTeX, or troff), giving power users complete control over the typography.
+type Renderer interface {
+	// Name is the name the renderer is selected by.
+	Name() string
+
+	// Render returns the rendered document.
+	Render(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error)
+}
+
+var (
+	// RendererPDF writes PDF documents, see GetPDF.
+	RendererPDF Renderer = pdfRenderer{}
+	// RendererHTML writes self-contained HTML pages, see GetHTML.
+	RendererHTML Renderer = htmlRenderer{}
+	// RendererTypst writes Typst source code, see GetTypst.
+	RendererTypst Renderer = typstRenderer{}
+
+	// Renderers lists the available renderers.
+	Renderers = []Renderer{RendererPDF, RendererHTML, RendererTypst}
+)
+
+type pdfRenderer struct{}
+
+func (pdfRenderer) Name() string { return "pdf" }
+
+func (pdfRenderer) Render(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error) {
+	return GetPDF(p, no2D, opts)
+}
+
+type htmlRenderer struct{}
+
+func (htmlRenderer) Name() string { return "html" }
+
+func (htmlRenderer) Render(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error) {
+	return GetHTML(p, no2D, opts)
+}
+
+type typstRenderer struct{}
+
+func (typstRenderer) Name() string { return "typst" }
+
+func (typstRenderer) Render(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error) {
+	return GetTypst(p, no2D, opts)
+}
+
+// RendererNames returns the names of the available renderers.
+func RendererNames() []string {
+	names := make([]string, len(Renderers))
+	for i, renderer := range Renderers {
+		names[i] = renderer.Name()
+	}
+
+	return names
+}
+
+// RendererFromName returns the renderer of the given name, or nil if there is none.
+func RendererFromName(name string) Renderer {
+	for _, renderer := range Renderers {
+		if strings.EqualFold(renderer.Name(), name) {
+			return renderer
+		}
+	}
+
+	return nil
+}
+
+// Renderer returns the renderer that writes documents in the output format,
+// PNG images are rasterized from PDF documents.
+func (f OutputFormat) Renderer() Renderer {
+	if f == OutputFormatHTML {
+		return RendererHTML
+	}
+
+	return RendererPDF
+}
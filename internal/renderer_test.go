@@ -0,0 +1,80 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestRendererFromName(t *testing.T) {
+	for _, renderer := range Renderers {
+		if got := RendererFromName(renderer.Name()); got != renderer {
+			t.Errorf("got: %v, want: %v.", got, renderer)
+		}
+	}
+	if got := RendererFromName("Typst"); got != RendererTypst {
+		t.Errorf("got: %v, want: %v.", got, RendererTypst)
+	}
+	if got := RendererFromName("troff"); got != nil {
+		t.Errorf("got: %v, want: nil.", got)
+	}
+
+	if got := OutputFormatPNG.Renderer(); got != RendererPDF {
+		t.Errorf("got: %v, want: %v.", got, RendererPDF)
+	}
+	if got := OutputFormatHTML.Renderer(); got != RendererHTML {
+		t.Errorf("got: %v, want: %v.", got, RendererHTML)
+	}
+}
+
+func TestTypstString(t *testing.T) {
+	if got := typstString("a \"b\" \\c\n"); got != `"a \"b\" \\c\n"` {
+		t.Errorf("got: %s, want: %s.", got, `"a \"b\" \\c\n"`)
+	}
+}
+
+func TestGetTypst(t *testing.T) {
+	pc := core.NewPaperCrypt("2.0.0", make([]byte, 64), "ABCDEF", "Purpose", "", time.Now(), core.PaperCryptDataFormatRaw)
+	doc, err := RendererTypst.Render(pc, false, TextOptions{Instructions: true})
+	if err != nil {
+		t.Fatalf("Render failed with error %s", err)
+	}
+
+	for _, want := range []string{
+		`#set page(`,
+		`#data-line("# Content Serial: ABCDEF")`,
+		`#data-line("1: 00 00 00`,
+		`image(bytes((137,80,78,71,`,
+		`= #"` + PDFInstructionsHeading + `"`,
+	} {
+		if !bytes.Contains(doc, []byte(want)) {
+			t.Errorf("Typst source should contain %s", want)
+		}
+	}
+
+	if _, err := GetTypst(pc, false, TextOptions{DataFont: []byte{0}}); err == nil {
+		t.Error("GetTypst should fail with a custom data font")
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultScannerDPI is the resolution pages are scanned at, enough for the modules of the 2D code, and for OCR.
+const DefaultScannerDPI = 300
+
+// Scanner acquires pages from a locally attached flatbed scanner.
+type Scanner interface {
+	// Acquire scans the page on the scanner, and returns it as a PNG image.
+	Acquire() ([]byte, error)
+}
+
+// NewScanner returns the scanner of the operating system: SANE on Linux, macOS and BSD, using the scanimage program
+// at scanimagePath, or WIA on Windows. If device is empty, the first scanner found is used.
+func NewScanner(goos string, scanimagePath string, device string, dpi int) (Scanner, error) {
+	if dpi <= 0 {
+		return nil, fmt.Errorf("invalid scanner resolution %d, must be positive", dpi)
+	}
+
+	switch goos {
+	case "windows":
+		return NewWIAScanner(device, dpi)
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd":
+		return NewSANEScanner(scanimagePath, device, dpi)
+	default:
+		return nil, fmt.Errorf("scanning is not supported on %s", goos)
+	}
+}
+
+// SANEScanner scans pages using the scanimage command line program of SANE (http://www.sane-project.org).
+type SANEScanner struct {
+	// Path is the path of the scanimage program.
+	Path string
+
+	// Device is the name of the scanner, as listed by 'scanimage -L', or empty for the first scanner.
+	Device string
+
+	// DPI is the resolution to scan at.
+	DPI int
+}
+
+// NewSANEScanner looks up the scanimage program, by name in the PATH, or at the given path.
+func NewSANEScanner(path string, device string, dpi int) (*SANEScanner, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%s not found, install SANE (http://www.sane-project.org) to scan pages", path), err)
+	}
+
+	return &SANEScanner{Path: resolved, Device: device, DPI: dpi}, nil
+}
+
+// args returns the arguments of scanimage, scanning a page in grey at the resolution of the scanner.
+func (s *SANEScanner) args() []string {
+	args := []string{"--format=png", "--mode", "Gray", "--resolution", strconv.Itoa(s.DPI)}
+	if s.Device != "" {
+		args = append(args, "--device-name", s.Device)
+	}
+
+	return args
+}
+
+func (s *SANEScanner) Acquire() ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.Path, s.args()...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Join(fmt.Errorf("error running scanimage: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// WIAScanner scans pages using Windows Image Acquisition, scripted through PowerShell.
+type WIAScanner struct {
+	// Path is the path of the PowerShell program.
+	Path string
+
+	// Device is the name of the scanner, as shown by Windows, or empty for the first scanner.
+	Device string
+
+	// DPI is the resolution to scan at.
+	DPI int
+}
+
+// NewWIAScanner looks up PowerShell, which drives the scanner through the WIA automation objects.
+func NewWIAScanner(device string, dpi int) (*WIAScanner, error) {
+	resolved, err := exec.LookPath("powershell")
+	if err != nil {
+		return nil, errors.Join(errors.New("powershell not found, it is needed to scan pages using Windows Image Acquisition"), err)
+	}
+
+	return &WIAScanner{Path: resolved, Device: device, DPI: dpi}, nil
+}
+
+// wiaScript is the PowerShell script scanning a page, it is formatted with the name of the scanner (or an empty string),
+// the resolution, and the path of the file to write the page to.
+// The properties 6147 and 6148 are the horizontal and vertical resolution, 6146 the color mode (2 for grey).
+const wiaScript = `$ErrorActionPreference = 'Stop'
+$manager = New-Object -ComObject WIA.DeviceManager
+$info = $manager.DeviceInfos | Where-Object { $_.Type -eq 1 -and ('%[1]s' -eq '' -or $_.Properties.Item('Name').Value -eq '%[1]s') } | Select-Object -First 1
+if ($info -eq $null) { throw 'no scanner found' }
+$item = $info.Connect().Items.Item(1)
+foreach ($id in 6147, 6148) { $item.Properties.Item("$id").Value = %[2]d }
+$item.Properties.Item('6146').Value = 2
+$image = $item.Transfer('{B96B3CAF-0728-11D3-9D7B-0000F81EF32E}')
+$image.SaveFile('%[3]s')`
+
+func (s *WIAScanner) Acquire() ([]byte, error) {
+	dir, err := os.MkdirTemp("", "papercrypt-scan")
+	if err != nil {
+		return nil, errors.Join(errors.New("error creating temporary directory"), err)
+	}
+	defer os.RemoveAll(dir)
+
+	// WIA writes the page to a file, quotes are doubled to escape them in PowerShell strings
+	path := filepath.Join(dir, "page.png")
+	quote := strings.NewReplacer("'", "''")
+	script := fmt.Sprintf(wiaScript, quote.Replace(s.Device), s.DPI, quote.Replace(path))
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(s.Path, "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Join(fmt.Errorf("error scanning using WIA: %s", strings.TrimSpace(stderr.String())), err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the scanned page"), err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,52 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewScanner(t *testing.T) {
+	if _, err := NewScanner("plan9", "scanimage", "", DefaultScannerDPI); err == nil {
+		t.Errorf("NewScanner should fail on unsupported systems")
+	}
+	if _, err := NewScanner("linux", "scanimage", "", 0); err == nil {
+		t.Errorf("NewScanner should fail for a resolution of 0 dpi")
+	}
+	if _, err := NewScanner("linux", "papercrypt-no-such-program", "", DefaultScannerDPI); err == nil {
+		t.Errorf("NewScanner should fail if scanimage is not found")
+	}
+}
+
+func TestSANEScannerArgs(t *testing.T) {
+	scanner := &SANEScanner{Path: "scanimage", DPI: 600}
+	got := strings.Join(scanner.args(), " ")
+	if want := "--format=png --mode Gray --resolution 600"; got != want {
+		t.Errorf("args was incorrect, got: %s, want: %s.", got, want)
+	}
+
+	scanner.Device = "genesys:libusb:001:002"
+	got = strings.Join(scanner.args(), " ")
+	if !strings.HasSuffix(got, "--device-name genesys:libusb:001:002") {
+		t.Errorf("args was incorrect, got: %s, want the device to be named.", got)
+	}
+}
@@ -0,0 +1,281 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// serialPlaceholder is a placeholder of a SerialTemplate, such as {seq:04}.
+type serialPlaceholder struct {
+	name string
+	// width is the argument of the placeholder, the width of a sequence number, or the length of a random string.
+	width int
+}
+
+// SerialTemplate is a pattern of serial numbers, such as "HOME-{seq:04}", where placeholders are replaced
+// when a document is generated:
+//   - {seq} is the next number of a counter kept for the template, {seq:04} pads it with zeros to 4 digits
+//   - {random} is a random string, {random:8} one of 8 characters
+//   - {date} is the date of the document, as 20060102, and {year} its year
+type SerialTemplate struct {
+	template string
+	// parts are the literal text between placeholders, and the placeholders, in order.
+	parts []any
+}
+
+// ParseSerialTemplate parses a template of serial numbers, see SerialTemplate.
+func ParseSerialTemplate(template string) (SerialTemplate, error) {
+	if strings.ContainsAny(template, "\r\n") {
+		return SerialTemplate{}, errors.New("serial number template must not contain line breaks")
+	}
+
+	t := SerialTemplate{template: template}
+	rest := template
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			t.parts = append(t.parts, rest)
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, rest[:start])
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return SerialTemplate{}, fmt.Errorf("unclosed placeholder in serial number template '%s'", template)
+		}
+
+		placeholder, err := parseSerialPlaceholder(rest[start+1 : start+end])
+		if err != nil {
+			return SerialTemplate{}, errors.Join(fmt.Errorf("invalid serial number template '%s'", template), err)
+		}
+		t.parts = append(t.parts, placeholder)
+		rest = rest[start+end+1:]
+	}
+
+	return t, nil
+}
+
+func parseSerialPlaceholder(text string) (serialPlaceholder, error) {
+	name, arg, hasArg := strings.Cut(text, ":")
+	p := serialPlaceholder{name: name}
+
+	switch name {
+	case "seq", "random":
+		if !hasArg {
+			break
+		}
+		width, err := strconv.Atoi(arg)
+		if err != nil || width < 1 || width > 32 {
+			return p, fmt.Errorf("invalid width of {%s}: '%s', must be a number from 1 to 32", name, arg)
+		}
+		p.width = width
+	case "date", "year":
+		if hasArg {
+			return p, fmt.Errorf("{%s} takes no argument", name)
+		}
+	default:
+		return p, fmt.Errorf("unknown placeholder {%s}, must be one of: seq, random, date, year", text)
+	}
+
+	return p, nil
+}
+
+// String returns the template as it was parsed.
+func (t SerialTemplate) String() string {
+	return t.template
+}
+
+// HasSequence reports whether the template holds a {seq} placeholder, which needs a counter.
+func (t SerialTemplate) HasSequence() bool {
+	for _, part := range t.parts {
+		if p, ok := part.(serialPlaceholder); ok && p.name == "seq" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expand returns the serial number of the template, with seq as the sequence number,
+// random strings made of charset, DefaultSerialLength characters long unless given, and the date of createdAt.
+func (t SerialTemplate) Expand(seq uint64, charset string, createdAt time.Time) (string, error) {
+	var serial strings.Builder
+	for _, part := range t.parts {
+		p, ok := part.(serialPlaceholder)
+		if !ok {
+			serial.WriteString(part.(string))
+			continue
+		}
+
+		switch p.name {
+		case "seq":
+			serial.WriteString(fmt.Sprintf("%0*d", p.width, seq))
+		case "random":
+			length := p.width
+			if length == 0 {
+				length = core.DefaultSerialLength
+			}
+			random, err := core.GenerateSerialFromCharset(length, charset)
+			if err != nil {
+				return "", err
+			}
+			serial.WriteString(random)
+		case "date":
+			serial.WriteString(createdAt.Format("20060102"))
+		case "year":
+			serial.WriteString(createdAt.Format("2006"))
+		}
+	}
+
+	return serial.String(), nil
+}
+
+// SerialCounter keeps the last sequence number issued for each serial number template in a JSON file,
+// so documents are numbered consecutively across runs.
+// The file is locked from Next until the number is stored, or released, so concurrent runs never issue the same number.
+type SerialCounter struct {
+	path string
+	lock *fileLock
+}
+
+// NewSerialCounter returns the counter stored at path, or, if path is empty,
+// in the configuration directory of the user.
+func NewSerialCounter(path string) (*SerialCounter, error) {
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, errors.Join(errors.New("error finding the configuration directory"), err)
+		}
+		path = filepath.Join(dir, "papercrypt", "serial-counter.json")
+	}
+
+	return &SerialCounter{path: path}, nil
+}
+
+// Path returns the path of the file the counter is stored in.
+func (c *SerialCounter) Path() string {
+	return c.path
+}
+
+func (c *SerialCounter) read() (map[string]uint64, error) {
+	counters := make(map[string]uint64)
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return counters, nil
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the serial number counter"), err)
+	}
+
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return nil, errors.Join(fmt.Errorf("error parsing the serial number counter %s", c.path), err)
+	}
+
+	return counters, nil
+}
+
+// Next returns the sequence number following the last one stored for the template, starting at 1.
+// It is not stored until Store is called, once the document has been written. Until then, the counter is locked,
+// other runs wait in Next for it to be stored, or released, see Release.
+func (c *SerialCounter) Next(template SerialTemplate) (uint64, error) {
+	if err := c.acquire(); err != nil {
+		return 0, err
+	}
+
+	counters, err := c.read()
+	if err != nil {
+		return 0, errors.Join(err, c.Release())
+	}
+
+	return counters[template.String()] + 1, nil
+}
+
+// Store records seq as the last sequence number issued for the template, and releases the counter.
+func (c *SerialCounter) Store(template SerialTemplate, seq uint64) error {
+	if err := c.acquire(); err != nil {
+		return err
+	}
+
+	if err := c.store(template, seq); err != nil {
+		return errors.Join(err, c.Release())
+	}
+
+	return c.Release()
+}
+
+func (c *SerialCounter) store(template SerialTemplate, seq uint64) error {
+	counters, err := c.read()
+	if err != nil {
+		return err
+	}
+	counters[template.String()] = seq
+
+	data, err := json.MarshalIndent(counters, "", "  ")
+	if err != nil {
+		return errors.Join(errors.New("error serializing the serial number counter"), err)
+	}
+
+	if err := writeFileAtomically(c.path, append(data, '\n')); err != nil {
+		return errors.Join(errors.New("error writing the serial number counter"), err)
+	}
+
+	return nil
+}
+
+// acquire locks the counter, unless it is locked by c already.
+func (c *SerialCounter) acquire() error {
+	if c.lock != nil {
+		return nil
+	}
+
+	lock, err := lockFile(c.path)
+	if err != nil {
+		return errors.Join(errors.New("error locking the serial number counter"), err)
+	}
+	c.lock = lock
+
+	return nil
+}
+
+// Release releases the counter without storing a number, such as when no document was written.
+// It does nothing if the counter is not locked.
+func (c *SerialCounter) Release() error {
+	if c.lock == nil {
+		return nil
+	}
+
+	lock := c.lock
+	c.lock = nil
+	return lock.Unlock()
+}
@@ -0,0 +1,200 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestSerialTemplate(t *testing.T) {
+	createdAt := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		template string
+		seq      uint64
+		want     string
+	}{
+		{"HOME-{seq:04}", 7, "HOME-0007"},
+		{"HOME-{seq}", 12345, "HOME-12345"},
+		{"{year}/{seq:3}", 1, "2024/001"},
+		{"OFFICE-{date}", 0, "OFFICE-20240801"},
+		{"plain", 0, "plain"},
+	}
+
+	for _, test := range tests {
+		template, err := ParseSerialTemplate(test.template)
+		if err != nil {
+			t.Fatalf("ParseSerialTemplate failed with error %s", err)
+		}
+
+		got, err := template.Expand(test.seq, core.DefaultSerialCharset, createdAt)
+		if err != nil {
+			t.Fatalf("Expand failed with error %s", err)
+		}
+		if got != test.want {
+			t.Errorf("got: %v, want: %v.", got, test.want)
+		}
+	}
+}
+
+func TestSerialTemplateRandom(t *testing.T) {
+	template, err := ParseSerialTemplate("K-{random:8}")
+	if err != nil {
+		t.Fatalf("ParseSerialTemplate failed with error %s", err)
+	}
+	if template.HasSequence() {
+		t.Errorf("got: %v, want: %v.", true, false)
+	}
+
+	got, err := template.Expand(0, "01", time.Now())
+	if err != nil {
+		t.Fatalf("Expand failed with error %s", err)
+	}
+	random := strings.TrimPrefix(got, "K-")
+	if len(random) != 8 || strings.Trim(random, "01") != "" {
+		t.Errorf("got: %v, want: 8 binary digits.", got)
+	}
+}
+
+func TestSerialTemplateInvalid(t *testing.T) {
+	for _, template := range []string{"A-{seq", "A-{counter}", "A-{seq:x}", "A-{seq:0}", "A-{date:2}", "A\n{seq}"} {
+		if _, err := ParseSerialTemplate(template); err == nil {
+			t.Errorf("Expected template %q to be rejected", template)
+		}
+	}
+}
+
+func TestSerialCounter(t *testing.T) {
+	counter, err := NewSerialCounter(filepath.Join(t.TempDir(), "nested", "counter.json"))
+	if err != nil {
+		t.Fatalf("NewSerialCounter failed with error %s", err)
+	}
+	home, _ := ParseSerialTemplate("HOME-{seq:04}")
+	office, _ := ParseSerialTemplate("OFFICE-{seq}")
+
+	for want := uint64(1); want <= 3; want++ {
+		seq, err := counter.Next(home)
+		if err != nil {
+			t.Fatalf("Next failed with error %s", err)
+		}
+		if seq != want {
+			t.Errorf("got: %v, want: %v.", seq, want)
+		}
+		if err := counter.Store(home, seq); err != nil {
+			t.Fatalf("Store failed with error %s", err)
+		}
+	}
+
+	// every template is counted on its own
+	seq, err := counter.Next(office)
+	if err != nil {
+		t.Fatalf("Next failed with error %s", err)
+	}
+	if seq != 1 {
+		t.Errorf("got: %v, want: %v.", seq, 1)
+	}
+	if err := counter.Release(); err != nil {
+		t.Fatalf("Release failed with error %s", err)
+	}
+}
+
+func TestSerialCounterConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.json")
+	template, _ := ParseSerialTemplate("DOC-{seq}")
+
+	// each run issues a number, while the others wait for it to be stored
+	const runs = 8
+	issued := make(chan uint64, runs)
+	errs := make(chan error, runs)
+	var wg sync.WaitGroup
+	for range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			counter, err := NewSerialCounter(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			seq, err := counter.Next(template)
+			if err != nil {
+				errs <- err
+				return
+			}
+			time.Sleep(time.Millisecond)
+			if err := counter.Store(template, seq); err != nil {
+				errs <- err
+				return
+			}
+			issued <- seq
+		}()
+	}
+	wg.Wait()
+	close(issued)
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("SerialCounter failed with error %s", err)
+	}
+	seen := make(map[uint64]bool)
+	for seq := range issued {
+		if seen[seq] {
+			t.Errorf("got: %v twice, want: every number once.", seq)
+		}
+		seen[seq] = true
+	}
+
+	// a released number is issued again
+	counter, _ := NewSerialCounter(path)
+	for range 2 {
+		seq, err := counter.Next(template)
+		if err != nil {
+			t.Fatalf("Next failed with error %s", err)
+		}
+		if seq != runs+1 {
+			t.Errorf("got: %v, want: %v.", seq, runs+1)
+		}
+		if err := counter.Release(); err != nil {
+			t.Fatalf("Release failed with error %s", err)
+		}
+	}
+}
+
+func TestGenerateSerialFromCharset(t *testing.T) {
+	serial, err := core.GenerateSerialFromCharset(12, "ABC")
+	if err != nil {
+		t.Fatalf("GenerateSerialFromCharset failed with error %s", err)
+	}
+	if len(serial) != 12 || strings.Trim(serial, "ABC") != "" {
+		t.Errorf("got: %v, want: 12 characters of ABC.", serial)
+	}
+
+	if _, err := core.GenerateSerialFromCharset(6, ""); err == nil {
+		t.Error("Expected an empty charset to be rejected")
+	}
+}
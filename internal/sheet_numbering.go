@@ -0,0 +1,139 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf/v2"
+)
+
+// Documents printed on several sheets carry the content hash of every sheet in the footer of each sheet,
+// so a restorer can check that they hold a complete set of matching sheets before typing anything:
+// the hash marked on each sheet must be listed by all other sheets.
+// A sheet is a page, or both sides of a piece of paper for duplex documents.
+
+const (
+	// SheetHashLength is the number of bytes of the SHA-256 hash of a sheet's content that are printed.
+	SheetHashLength = 4
+
+	PDFSheetCaption       = "Sheet %d of %d"
+	PDFSheetCaptionDuplex = "Sheet %d of %d, %s"
+	PDFSheetFront         = "front"
+	PDFSheetBack          = "back"
+	PDFSheetHashes        = "%s: %s, sheets:"
+
+	// sheetHashesFontSize is the largest font size of the list of sheet hashes, in pt, it is shrunk to fit the page.
+	sheetHashesFontSize = 7.0
+	// minSheetHashesFontSize is the smallest font size of the list of sheet hashes, in pt.
+	minSheetHashesFontSize = 4.0
+)
+
+// sheetOfPage returns the number of the sheet a page is printed on.
+func sheetOfPage(page int, duplex Duplex) int {
+	if duplex == DuplexNone {
+		return page
+	}
+
+	return (page + 1) / 2
+}
+
+// sheetCaption returns the caption of a page of a document of several sheets, such as "Sheet 2 of 5".
+func sheetCaption(language *Language, page, sheets int, duplex Duplex) string {
+	if duplex == DuplexNone {
+		return language.Sprintf(PDFSheetCaption, page, sheets)
+	}
+
+	side := PDFSheetFront
+	if page%2 == 0 {
+		side = PDFSheetBack
+	}
+
+	return language.Sprintf(PDFSheetCaptionDuplex, sheetOfPage(page, duplex), sheets, language.T(side))
+}
+
+// sheetHashes returns the content hash of each sheet of a rendered document, as upper case hex digits.
+// The hash covers the content streams of the pages of the sheet, as rendered without the sheet hashes.
+func sheetHashes(data []byte, duplex Duplex) ([]string, error) {
+	doc, err := readPDFDocument(data)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the generated pdf"), err)
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the pages of the generated pdf"), err)
+	}
+
+	// the content of each sheet is hashed as it is read, rather than collected first, for documents of hundreds of pages
+	hashers := make([]hash.Hash, 0, len(pages))
+	for i, page := range pages {
+		stream, ok := doc.resolve(page["Contents"]).(*pdfStream)
+		if !ok {
+			return nil, fmt.Errorf("page %d of the generated pdf has no content", i+1)
+		}
+		content, err := doc.decode(stream)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading page %d of the generated pdf", i+1), err)
+		}
+
+		sheet := sheetOfPage(i+1, duplex) - 1
+		if sheet == len(hashers) {
+			hashers = append(hashers, sha256.New())
+		}
+		hashers[sheet].Write(content)
+	}
+
+	hashes := make([]string, len(hashers))
+	for i, hasher := range hashers {
+		sum := hasher.Sum(nil)
+		hashes[i] = strings.ToUpper(hex.EncodeToString(sum[:SheetHashLength]))
+	}
+
+	return hashes, nil
+}
+
+// drawSheetHashes prints the serial number and the hashes of all sheets at the bottom of the page,
+// the hash of the current sheet is marked by brackets.
+func drawSheetHashes(pdf *gofpdf.Fpdf, opts TextOptions, serial string, sheets []string, sheet int) {
+	entries := []string{opts.Language.Sprintf(PDFSheetHashes, opts.Language.T(PDFHeaderSheetID), serial)}
+	for i, hash := range sheets {
+		if i+1 == sheet {
+			hash = "[" + hash + "]"
+		}
+		entries = append(entries, fmt.Sprintf("%d:%s", i+1, hash))
+	}
+	line := strings.Join(entries, " ")
+
+	size := sheetHashesFontSize
+	pdf.SetFont(PdfMonoFont, "", size)
+	if width := pdf.GetStringWidth(line); width > opts.Page.ContentWidth() {
+		size = max(minSheetHashesFontSize, size*opts.Page.ContentWidth()/width)
+		pdf.SetFont(PdfMonoFont, "", size)
+	}
+
+	pdf.SetY(-8)
+	pdf.CellFormat(0, 3, line, "", 0, "C", false, 0, "")
+}
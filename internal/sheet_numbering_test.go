@@ -0,0 +1,78 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestSheetCaption(t *testing.T) {
+	tests := []struct {
+		page, sheets int
+		duplex       Duplex
+		want         string
+	}{
+		{2, 5, DuplexNone, "Sheet 2 of 5"},
+		{3, 2, DuplexLongEdge, "Sheet 2 of 2, front"},
+		{4, 2, DuplexShortEdge, "Sheet 2 of 2, back"},
+	}
+
+	for _, tt := range tests {
+		if got := sheetCaption(nil, tt.page, tt.sheets, tt.duplex); got != tt.want {
+			t.Errorf("sheetCaption was incorrect, got: %s, want: %s.", got, tt.want)
+		}
+	}
+}
+
+func TestSheetHashes(t *testing.T) {
+	loadFonts(t)
+
+	pc := core.NewPaperCrypt("2.0.0", make([]byte, 64), "ABCDEF", "", "", time.Now(), core.PaperCryptDataFormatRaw)
+	for _, duplex := range []Duplex{DuplexNone, DuplexLongEdge} {
+		doc, err := GetPDF(pc, false, TextOptions{Duplex: duplex})
+		if err != nil {
+			t.Fatalf("GetPDF failed with error %s", err)
+		}
+
+		hashes, err := sheetHashes(doc, duplex)
+		if err != nil {
+			t.Fatalf("sheetHashes failed with error %s", err)
+		}
+		if len(hashes) < 2 {
+			t.Fatalf("got: %d sheets, want: at least 2.", len(hashes))
+		}
+		pattern := regexp.MustCompile(`^[0-9A-F]{8}$`)
+		for i, hash := range hashes {
+			if !pattern.MatchString(hash) {
+				t.Errorf("Invalid hash of sheet %d: %s", i+1, hash)
+			}
+			for _, other := range hashes[:i] {
+				if other == hash {
+					t.Errorf("Sheets should have distinct hashes, got: %s twice", hash)
+				}
+			}
+		}
+	}
+}
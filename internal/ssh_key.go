@@ -0,0 +1,123 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshPrivateKeyTypes are the PEM block types of the private keys read by OpenSSH.
+var sshPrivateKeyTypes = []string{"OPENSSH PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "DSA PRIVATE KEY", "PRIVATE KEY"}
+
+// sshFingerprintPrefix starts the SHA-256 fingerprints of SSH keys, as shown by ssh-keygen.
+const sshFingerprintPrefix = "SHA256:"
+
+// SSHKeyInfo identifies an SSH private key, without its secret.
+type SSHKeyInfo struct {
+	// Type is the type of the key, such as ssh-ed25519.
+	Type string
+	// Fingerprint is the SHA-256 fingerprint of the public key, as shown by ssh-keygen -l.
+	Fingerprint string
+	// Comment is the comment of the key, usually user@host, if known.
+	Comment string
+	// Encrypted is whether the key is protected by a passphrase.
+	Encrypted bool
+}
+
+// String describes the key as ssh-keygen -l does, by its type, fingerprint, and comment.
+func (i SSHKeyInfo) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", i.Type, i.Fingerprint, i.Comment))
+}
+
+// IsSSHPrivateKey returns whether data is a PEM encoded private key, as read by OpenSSH.
+func IsSSHPrivateKey(data []byte) bool {
+	block, _ := pem.Decode(bytes.TrimSpace(data))
+	if block == nil {
+		return false
+	}
+
+	for _, keyType := range sshPrivateKeyTypes {
+		if block.Type == keyType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadSSHPrivateKey reads the type, and fingerprint, of an SSH private key.
+// Keys protected by a passphrase are read without it, in the OpenSSH format, which stores the public key in the clear.
+// The comment is stored with the secret, it is left empty.
+func ReadSSHPrivateKey(data []byte) (SSHKeyInfo, error) {
+	var publicKey ssh.PublicKey
+	encrypted := false
+	signer, err := ssh.ParsePrivateKey(data)
+	if err == nil {
+		publicKey = signer.PublicKey()
+	} else {
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			return SSHKeyInfo{}, errors.Join(errors.New("error reading the SSH private key"), err)
+		}
+		if missing.PublicKey == nil {
+			return SSHKeyInfo{}, errors.New("the public key of an encrypted PEM key can not be read, convert the key to the OpenSSH format using 'ssh-keygen -p -f <key>'")
+		}
+		publicKey = missing.PublicKey
+		encrypted = true
+	}
+
+	return SSHKeyInfo{
+		Type:        publicKey.Type(),
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		Encrypted:   encrypted,
+	}, nil
+}
+
+// ReadSSHPublicKeyComment returns the comment of an SSH public key, in the authorized_keys format of .pub files,
+// if it belongs to the key with the fingerprint.
+func ReadSSHPublicKeyComment(data []byte, fingerprint string) (string, error) {
+	publicKey, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return "", errors.Join(errors.New("error reading the SSH public key"), err)
+	}
+	if ssh.FingerprintSHA256(publicKey) != fingerprint {
+		return "", errors.New("the SSH public key belongs to another private key")
+	}
+
+	return comment, nil
+}
+
+// FindSSHFingerprint returns the first SHA-256 fingerprint of an SSH key in text, such as the comment of a document.
+func FindSSHFingerprint(text string) (string, bool) {
+	for _, field := range strings.Fields(text) {
+		if strings.HasPrefix(field, sshFingerprintPrefix) && len(field) > len(sshFingerprintPrefix) {
+			return field, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,356 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"time"
+
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// The test page is a calibration sheet, holding 2D codes of several module sizes and error correction levels,
+// and samples of the data font in several sizes. It is printed, and scanned back (see ScanTestPage),
+// to find the smallest codes a printer and scanner reproduce reliably, before documents are printed.
+
+const (
+	// testPagePayloadPrefix starts the payload of every code of the test page.
+	testPagePayloadPrefix = "PaperCrypt test page "
+	// testPageSubject is the subject of the test page PDF, telling it apart from scans of the printed page.
+	testPageSubject = "PaperCrypt test page"
+
+	// testPageGridTop is the distance of the first row of codes from the top of the page, in mm.
+	testPageGridTop = 52.0
+	// testPageLabelWidth is the width of the column labelling the rows of codes, in mm.
+	testPageLabelWidth = 22.0
+	// testPageRowGap is the space between rows of codes, in mm.
+	testPageRowGap = 3.0
+	// testPageCellModules is the width of the cells codes are printed in, in modules,
+	// that of the largest code (QR version 4), and its quiet zone, with room to round modules to whole dots.
+	testPageCellModules = (33 + 2*Code2DQuietZone) * 1.15
+
+	// testPageRulerLength is the length of the ruler printed below the codes, in mm.
+	testPageRulerLength = 100.0
+	// testPageFontSample is printed in each size of TestPageFontSizes, the data of a line,
+	// followed by characters easily confused when read by eye, or OCR.
+	testPageFontSample = "1F 8B 08 D0 0D B8 8B E3 3E 6C  0O 1lI 5S 2Z 8B rn m"
+)
+
+// TestPageModuleSizes are the module sizes of the codes of the test page, in mm, one row of codes each.
+var TestPageModuleSizes = []float64{0.2, 0.25, 0.3, 0.4, 0.5, 0.6}
+
+// TestPageFontSizes are the sizes the data font is printed in on the test page, in pt.
+var TestPageFontSizes = []float64{7, 8, 9, 10, 11, 12}
+
+// testPageColumns are the kinds of codes of the test page, one column each.
+var testPageColumns = []TestPageSample{
+	{Type: core.Code2DTypeAztec},
+	{Type: core.Code2DTypeQR, QRErrorCorrection: core.QRErrorCorrectionL},
+	{Type: core.Code2DTypeQR, QRErrorCorrection: core.QRErrorCorrectionM},
+	{Type: core.Code2DTypeQR, QRErrorCorrection: core.QRErrorCorrectionQ},
+	{Type: core.Code2DTypeQR, QRErrorCorrection: core.QRErrorCorrectionH},
+}
+
+// TestPageSample is a code of the test page.
+type TestPageSample struct {
+	// ModuleSize is the size of a module, in mm, one of TestPageModuleSizes.
+	ModuleSize float64
+
+	// Type is the type of the code, either Aztec, or QR.
+	Type core.Code2DType
+
+	// QRErrorCorrection is the error correction level of QR codes.
+	QRErrorCorrection core.QRErrorCorrection
+
+	row, column int
+}
+
+// TestPageSamples returns the codes of the test page, row by row.
+func TestPageSamples() []TestPageSample {
+	samples := make([]TestPageSample, 0, len(TestPageModuleSizes)*len(testPageColumns))
+	for row, size := range TestPageModuleSizes {
+		for column, kind := range testPageColumns {
+			kind.ModuleSize, kind.row, kind.column = size, row, column
+			samples = append(samples, kind)
+		}
+	}
+
+	return samples
+}
+
+// TestPageCodes returns the kinds of codes of the test page, in the order of its columns, without a module size.
+func TestPageCodes() []TestPageSample {
+	return append([]TestPageSample(nil), testPageColumns...)
+}
+
+// Code names the kind of the code, "Aztec", or "QR" and its error correction level, such as "QR M".
+func (s TestPageSample) Code() string {
+	if s.Type == core.Code2DTypeQR {
+		return "QR " + s.QRErrorCorrection.String()
+	}
+
+	return s.Type.String()
+}
+
+func (s TestPageSample) String() string {
+	return fmt.Sprintf("%s, %.2f mm", s.Code(), s.ModuleSize)
+}
+
+// payload returns the content of the code, naming its module size, and kind, so it can be told apart once scanned.
+func (s TestPageSample) payload() []byte {
+	return []byte(fmt.Sprintf("%s%.2fmm %s", testPagePayloadPrefix, s.ModuleSize, s.Code()))
+}
+
+// ParseTestPagePayload returns the code of the test page holding the payload, if any.
+func ParseTestPagePayload(payload []byte) (TestPageSample, bool) {
+	if !bytes.HasPrefix(payload, []byte(testPagePayloadPrefix)) {
+		return TestPageSample{}, false
+	}
+
+	for _, sample := range TestPageSamples() {
+		if bytes.Equal(sample.payload(), payload) {
+			return sample, true
+		}
+	}
+
+	return TestPageSample{}, false
+}
+
+// cell returns the top left corner, and the width (and height), of the square the code is printed in, in mm.
+// Codes are centered in their cells.
+func (s TestPageSample) cell(page core.Page) (float64, float64, float64) {
+	columnWidth := (page.ContentWidth() - testPageLabelWidth) / float64(len(testPageColumns))
+	size := s.ModuleSize * testPageCellModules
+
+	y := testPageGridTop
+	for _, above := range TestPageModuleSizes[:s.row] {
+		y += above*testPageCellModules + testPageRowGap
+	}
+
+	return page.Margin() + testPageLabelWidth + float64(s.column)*columnWidth + (columnWidth-size)/2, y, size
+}
+
+// testPageGridBottom returns the distance of the bottom of the last row of codes from the top of the page, in mm.
+func testPageGridBottom() float64 {
+	bottom := testPageGridTop
+	for _, size := range TestPageModuleSizes {
+		bottom += size*testPageCellModules + testPageRowGap
+	}
+
+	return bottom
+}
+
+// IsTestPagePDF returns whether data is the test page PDF, as GetTestPagePDF returns it, rather than a scan of it.
+// Its codes are drawn as images, which are read as they are, rather than as printed, so the page should be rendered first (see RasterizePDF).
+func IsTestPagePDF(data []byte) bool {
+	return IsPDF(data) && bytes.Contains(data, []byte("/Subject ("+testPageSubject+")"))
+}
+
+// GetTestPagePDF returns the test page, with codes rendered for a printer of the given resolution (in dpi),
+// so each module covers whole dots, like Code2DOptions.DPI.
+// Pages in landscape orientation, and A5 pages, are too small to hold the codes.
+func GetTestPagePDF(page core.Page, dpi int) ([]byte, error) {
+	if dpi <= 0 {
+		return nil, errors.New("DPI must be positive")
+	}
+	if columnWidth := (page.ContentWidth() - testPageLabelWidth) / float64(len(testPageColumns)); columnWidth < TestPageModuleSizes[len(TestPageModuleSizes)-1]*testPageCellModules {
+		return nil, fmt.Errorf("the codes of the test page do not fit across %s pages", page)
+	}
+	_, height := page.Dimensions()
+	fontSamplesHeight := 8.0
+	for _, size := range TestPageFontSizes {
+		fontSamplesHeight += size/2 + 1.5
+	}
+	if testPageGridBottom()+18+fontSamplesHeight > height-core.PageFooterHeight {
+		return nil, fmt.Errorf("the test page does not fit on %s pages", page)
+	}
+
+	pdf := getPdf(page)
+	pdf.SetSubject(testPageSubject, false)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+	drawFiducials(pdf, page)
+
+	pdf.SetY(20)
+	pdf.SetFont(PdfTextFont, "B", 16)
+	pdf.CellFormat(0, 10, "PaperCrypt Test Page", "", 1, "C", false, 0, "")
+	pdf.SetFont(PdfTextFont, "", 9)
+	pdf.MultiCell(0, 4.5, "Print this page at actual size (100%, without scaling to fit), on the printer and paper you print documents on. "+
+		"Scan it, and run `papercrypt testpage verify <scan>`, to find the smallest codes your printer and scanner reproduce reliably. "+
+		"The squares in the corners locate the page in the scan, do not cut them off.", "", "L", false)
+
+	// the kinds of codes head the columns, the module sizes label the rows
+	samples := TestPageSamples()
+	pdf.SetFont(PdfTextFont, "B", 9)
+	for _, sample := range samples[:len(testPageColumns)] {
+		x, _, size := sample.cell(page)
+		pdf.SetXY(x, testPageGridTop-6)
+		pdf.CellFormat(size, 5, sample.Code(), "", 0, "C", false, 0, "")
+	}
+
+	for i, sample := range samples {
+		x, y, cellSize := sample.cell(page)
+		if sample.column == 0 {
+			dots := max(int(math.Round(sample.ModuleSize/25.4*float64(dpi))), 1)
+			pdf.SetXY(page.Margin(), y+cellSize/2-4)
+			pdf.SetFont(PdfTextFont, "B", 9)
+			pdf.CellFormat(testPageLabelWidth, 4, fmt.Sprintf("%.2f mm", sample.ModuleSize), "", 2, "L", false, 0, "")
+			pdf.SetFont(PdfTextFont, "", 7)
+			pdf.CellFormat(testPageLabelWidth, 4, fmt.Sprintf("%d dots", dots), "", 0, "L", false, 0, "")
+		}
+
+		opts := core.Code2DOptions{Type: sample.Type, QRErrorCorrection: sample.QRErrorCorrection, ModuleSize: sample.ModuleSize, DPI: dpi}
+		code, err := core.Encode2D(sample.payload(), opts)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error generating the code %s", sample), err)
+		}
+
+		// the image holds the quiet zone, its modules cover whole dots, so it is printed slightly larger, or smaller, than nominal
+		modules := codeImageModules(code)
+		_, pixels := opts.PrintSize(modules)
+		size := float64(pixels) * 25.4 / float64(dpi)
+		if size > cellSize {
+			return nil, fmt.Errorf("the code %s of %.1f mm does not fit its cell of %.1f mm", sample, size, cellSize)
+		}
+		codePNG, err := Code2DPNG(code, pixels)
+		if err != nil {
+			return nil, err
+		}
+
+		name := fmt.Sprintf("sample-%d.png", i)
+		pdf.RegisterImageReader(name, "PNG", bytes.NewReader(codePNG))
+		pdf.ImageOptions(name, x+(cellSize-size)/2, y+(cellSize-size)/2, size, size, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+	}
+
+	// a ruler, to confirm that the page was printed at its actual size
+	rulerY := testPageGridBottom() + 5
+	pdf.SetLineWidth(0.2)
+	pdf.Line(page.Margin(), rulerY, page.Margin()+testPageRulerLength, rulerY)
+	for mm := 0; mm <= testPageRulerLength; mm += 5 {
+		tick := 1.5
+		if mm%10 == 0 {
+			tick = 3
+		}
+		pdf.Line(page.Margin()+float64(mm), rulerY, page.Margin()+float64(mm), rulerY+tick)
+	}
+	pdf.SetXY(page.Margin(), rulerY+4)
+	pdf.SetFont(PdfTextFont, "", 8)
+	pdf.CellFormat(0, 4, fmt.Sprintf("%.0f mm, measure it to confirm the page is printed at actual size", testPageRulerLength), "", 0, "L", false, 0, "")
+
+	pdf.SetXY(page.Margin(), rulerY+11)
+	pdf.SetFont(PdfTextFont, "B", 9)
+	pdf.CellFormat(0, 5, "Data font sizes (generate --font-size), pick one you read without hesitating", "", 1, "L", false, 0, "")
+	for _, size := range TestPageFontSizes {
+		lineHeight := size/2 + 1.5
+		pdf.SetFont(PdfTextFont, "", 8)
+		pdf.CellFormat(testPageLabelWidth, lineHeight, fmt.Sprintf("%.0f pt", size), "", 0, "L", false, 0, "")
+		pdf.SetFont(PdfMonoFont, "B", size)
+		pdf.CellFormat(0, lineHeight, testPageFontSample, "", 1, "L", false, 0, "")
+	}
+
+	pdf.SetXY(page.Margin(), height-core.PageFooterHeight)
+	pdf.SetFont(PdfTextFont, "", 8)
+	pdf.CellFormat(0, 5, fmt.Sprintf("PaperCrypt %s, %s, %s, codes rendered at %d dpi", core.VersionInfo.GitVersion, time.Now().Format(core.TimeStampFormatDate), page, dpi), "", 0, "C", false, 0, "")
+
+	return outputPDF(pdf)
+}
+
+// TestPageScan is the outcome of scanning a printed test page, see ScanTestPage.
+type TestPageScan struct {
+	// Located is set if the corner markers of the page were found, and each code was read on its own.
+	// Otherwise, the codes were looked for in the whole image.
+	Located bool
+
+	// PixelsPerMM is the resolution of the scan, measured between the corner markers, 0 if they were not found.
+	PixelsPerMM float64
+
+	// Read holds the codes read.
+	Read map[TestPageSample]bool
+}
+
+// ScanTestPage reads the codes of the test page in a scan, or photo, of it, using scan to read the codes in an image,
+// such as ScanCodeImage. The corner markers of the page locate each code, which is cut out of the image, and read on its own,
+// at the resolution of the scan. If they are not found, or the page is turned sideways, the codes are looked for in the whole image.
+func ScanTestPage(img image.Image, scan func(image.Image) ([][]byte, error)) TestPageScan {
+	result := TestPageScan{Read: map[TestPageSample]bool{}}
+	record := func(payloads [][]byte) {
+		for _, payload := range payloads {
+			if sample, ok := ParseTestPagePayload(payload); ok {
+				result.Read[sample] = true
+			}
+		}
+	}
+
+	gray := core.GrayImage(img)
+	corners, page, ok := core.LocateFiducials(gray)
+	var h core.Projection
+	if ok && !page.Landscape {
+		h, ok = core.Homography(page.Fiducials(), corners)
+	}
+	if !ok || page.Landscape {
+		payloads, _ := scan(img)
+		record(payloads)
+		return result
+	}
+
+	width, _ := page.Dimensions()
+	result.Located = true
+	result.PixelsPerMM = math.Hypot(corners[1][0]-corners[0][0], corners[1][1]-corners[0][1]) / (width - 2*core.FiducialInset)
+
+	bounds := gray.Bounds()
+	margin := testPageRowGap / 2
+	for _, sample := range TestPageSamples() {
+		x, y, size := sample.cell(page)
+		area := image.Rectangle{Min: image.Pt(math.MaxInt, math.MaxInt), Max: image.Pt(math.MinInt, math.MinInt)}
+		for _, corner := range [4][2]float64{{x - margin, y - margin}, {x + size + margin, y - margin}, {x + size + margin, y + size + margin}, {x - margin, y + size + margin}} {
+			px, py := h.Apply(corner[0], corner[1])
+			area.Min.X, area.Min.Y = min(area.Min.X, int(math.Floor(px))), min(area.Min.Y, int(math.Floor(py)))
+			area.Max.X, area.Max.Y = max(area.Max.X, int(math.Ceil(px))), max(area.Max.Y, int(math.Ceil(py)))
+		}
+
+		area = area.Add(bounds.Min).Intersect(bounds)
+		if area.Empty() {
+			continue
+		}
+		payloads, err := scan(gray.SubImage(area))
+		if err == nil {
+			record(payloads)
+		}
+	}
+
+	return result
+}
+
+// drawFiducials prints the corner markers on the current page.
+// Plain squares are used, as nested squares would be mistaken for the finder patterns of QR codes.
+func drawFiducials(pdf *gofpdf.Fpdf, page core.Page) {
+	r, g, b := pdf.GetFillColor()
+	pdf.SetFillColor(0, 0, 0)
+	for _, f := range page.Fiducials() {
+		pdf.Rect(f[0]-core.FiducialSize/2, f[1]-core.FiducialSize/2, core.FiducialSize, core.FiducialSize, "F")
+	}
+	pdf.SetFillColor(r, g, b)
+}
@@ -0,0 +1,96 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"image"
+	"testing"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestTestPagePayload(t *testing.T) {
+	for _, sample := range TestPageSamples() {
+		parsed, ok := ParseTestPagePayload(sample.payload())
+		if !ok || parsed != sample {
+			t.Errorf("got: %v, want: %v.", parsed, sample)
+		}
+	}
+
+	if _, ok := ParseTestPagePayload([]byte(`{"v":"2.0.0"}`)); ok {
+		t.Error("the payload of a document was taken for a code of the test page")
+	}
+}
+
+func TestTestPageScan(t *testing.T) {
+	loadFonts(t)
+
+	doc, err := GetTestPagePDF(core.Page{Paper: core.PaperSizeA4}, core.Code2DDefaultDPI)
+	if err != nil {
+		t.Fatalf("GetTestPagePDF failed with error %s", err)
+	}
+	if _, err := GetTestPagePDF(core.Page{Paper: core.PaperSizeA5}, core.Code2DDefaultDPI); err == nil {
+		t.Error("the test page does not fit on A5 pages, but was generated")
+	}
+
+	// a scan at 300 dpi reads modules of 4 pixels and more
+	var scan TestPageScan
+	err = RasterizePDF(doc, 300, func(_, _ int, img *image.RGBA) error {
+		scan = ScanTestPage(img, core.ScanCodeImage)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RasterizePDF failed with error %s", err)
+	}
+
+	if !scan.Located || scan.PixelsPerMM < 11.7 || scan.PixelsPerMM > 11.9 {
+		t.Fatalf("got: %v, %.2f pixels per mm, want: the page located, 11.81 pixels per mm.", scan.Located, scan.PixelsPerMM)
+	}
+	for _, sample := range TestPageSamples() {
+		if sample.ModuleSize >= 0.4 && !scan.Read[sample] {
+			t.Errorf("the code %s was not read", sample)
+		}
+	}
+
+	// scanners write shades of gray, the codes are then cut out as sub-images of the scan, which are preprocessed if not read
+	err = RasterizePDF(doc, 150, func(_, _ int, img *image.RGBA) error {
+		scan = ScanTestPage(core.GrayImage(img), func(img image.Image) ([][]byte, error) {
+			stretched := core.ContrastStretch(img)
+			if payloads, err := core.ScanCodeImage(stretched); err == nil {
+				return payloads, nil
+			}
+			return core.ScanCodeImage(core.AdaptiveThreshold(stretched))
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RasterizePDF failed with error %s", err)
+	}
+	for _, sample := range TestPageSamples() {
+		if sample.ModuleSize >= 0.5 && !scan.Read[sample] {
+			t.Errorf("the code %s was not read at 150 dpi", sample)
+		}
+	}
+
+	if !IsTestPagePDF(doc) {
+		t.Error("the test page PDF was not recognized")
+	}
+}
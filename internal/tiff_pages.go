@@ -0,0 +1,244 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// TIFF tags and values used by DecodeTIFFPages.
+const (
+	tiffTagWidth           = 256
+	tiffTagHeight          = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagStripByteCounts = 279
+	tiffTagPredictor       = 317
+
+	tiffCompressionNone         = 1
+	tiffCompressionDeflate      = 8
+	tiffCompressionPackBits     = 32773
+	tiffCompressionDeflateAdobe = 32946
+
+	tiffPhotometricWhiteIsZero = 0
+
+	tiffTypeShort = 3
+	tiffTypeLong  = 4
+)
+
+// IsTIFF returns whether the data is a TIFF file.
+func IsTIFF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
+
+// DecodeTIFFPages decodes every page of a (multi-page) TIFF file, as written by document scanners.
+// Uncompressed, PackBits and Deflate compressed pages of gray (1 or 8 bits) or RGB (8 bits) pixels are supported,
+// CCITT fax and LZW compressed pages have to be converted to another format first.
+func DecodeTIFFPages(data []byte) ([]image.Image, error) {
+	if !IsTIFF(data) {
+		return nil, errors.New("not a TIFF file")
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	var pages []image.Image
+	offset := order.Uint32(data[4:8])
+	visited := make(map[uint32]bool)
+	for offset != 0 {
+		if visited[offset] {
+			return nil, errors.New("invalid TIFF file, its pages form a loop")
+		}
+		visited[offset] = true
+
+		tags, next, err := readTIFFDirectory(data, offset, order)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error reading TIFF page %d", len(pages)+1), err)
+		}
+
+		page, err := decodeTIFFPage(data, tags)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error decoding TIFF page %d", len(pages)+1), err)
+		}
+
+		pages = append(pages, page)
+		offset = next
+	}
+
+	return pages, nil
+}
+
+// readTIFFDirectory reads the tags of the image file directory at `offset`, and the offset of the next one.
+func readTIFFDirectory(data []byte, offset uint32, order binary.ByteOrder) (map[uint16][]uint32, uint32, error) {
+	if int(offset)+2 > len(data) {
+		return nil, 0, errors.New("directory offset out of range")
+	}
+
+	count := int(order.Uint16(data[offset:]))
+	start := int(offset) + 2
+	if start+count*12+4 > len(data) {
+		return nil, 0, errors.New("directory out of range")
+	}
+
+	tags := make(map[uint16][]uint32, count)
+	for i := 0; i < count; i++ {
+		entry := data[start+i*12 : start+(i+1)*12]
+		tag, fieldType, n := order.Uint16(entry), order.Uint16(entry[2:]), int(order.Uint32(entry[4:]))
+
+		size := 0
+		switch fieldType {
+		case tiffTypeShort:
+			size = 2
+		case tiffTypeLong:
+			size = 4
+		default:
+			continue // only integer tags are needed
+		}
+
+		values := entry[8:12]
+		if n*size > 4 {
+			valuesOffset := int(order.Uint32(values))
+			if valuesOffset+n*size > len(data) {
+				return nil, 0, fmt.Errorf("values of tag %d out of range", tag)
+			}
+			values = data[valuesOffset : valuesOffset+n*size]
+		}
+
+		tags[tag] = make([]uint32, n)
+		for j := range tags[tag] {
+			if size == 2 {
+				tags[tag][j] = uint32(order.Uint16(values[j*2:]))
+			} else {
+				tags[tag][j] = order.Uint32(values[j*4:])
+			}
+		}
+	}
+
+	return tags, order.Uint32(data[start+count*12:]), nil
+}
+
+func tiffTag(tags map[uint16][]uint32, tag uint16, fallback uint32) uint32 {
+	if values := tags[tag]; len(values) > 0 {
+		return values[0]
+	}
+
+	return fallback
+}
+
+func decodeTIFFPage(data []byte, tags map[uint16][]uint32) (image.Image, error) {
+	width, height := int(tiffTag(tags, tiffTagWidth, 0)), int(tiffTag(tags, tiffTagHeight, 0))
+	bits := int(tiffTag(tags, tiffTagBitsPerSample, 1))
+	samples := int(tiffTag(tags, tiffTagSamplesPerPixel, 1))
+	compression := tiffTag(tags, tiffTagCompression, tiffCompressionNone)
+
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("missing image size")
+	}
+	if (samples != 1 || (bits != 1 && bits != 8)) && (samples < 3 || bits != 8) {
+		return nil, fmt.Errorf("unsupported image with %d samples of %d bits per pixel", samples, bits)
+	}
+	if tiffTag(tags, tiffTagPredictor, 1) != 1 {
+		return nil, errors.New("unsupported TIFF predictor")
+	}
+
+	offsets, counts := tags[tiffTagStripOffsets], tags[tiffTagStripByteCounts]
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return nil, errors.New("missing image strips, tiled TIFF images are not supported")
+	}
+
+	var pixels []byte
+	for i, offset := range offsets {
+		end := int(offset) + int(counts[i])
+		if end > len(data) {
+			return nil, errors.New("image strip out of range")
+		}
+		strip := data[offset:end]
+
+		switch compression {
+		case tiffCompressionNone:
+		case tiffCompressionPackBits:
+			strip = unpackBits(strip)
+		case tiffCompressionDeflate, tiffCompressionDeflateAdobe:
+			r, err := zlib.NewReader(bytes.NewReader(strip))
+			if err != nil {
+				return nil, errors.Join(errors.New("error decompressing image strip"), err)
+			}
+			strip, err = io.ReadAll(r)
+			if err != nil {
+				return nil, errors.Join(errors.New("error decompressing image strip"), err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported TIFF compression %d", compression)
+		}
+
+		pixels = append(pixels, strip...)
+	}
+
+	rowBytes := (width*samples*bits + 7) / 8
+	if len(pixels) < height*rowBytes {
+		return nil, errors.New("image data is too short")
+	}
+
+	// extra samples (such as alpha) are dropped
+	if samples > 3 {
+		rgb := make([]byte, 0, width*height*3)
+		for i := 0; i < width*height; i++ {
+			rgb = append(rgb, pixels[i*samples:i*samples+3]...)
+		}
+		pixels, samples = rgb, 3
+	}
+
+	whiteIsZero := tiffTag(tags, tiffTagPhotometric, tiffPhotometricWhiteIsZero) == tiffPhotometricWhiteIsZero && samples == 1
+	return rasterImage(pixels, width, height, samples, bits, whiteIsZero), nil
+}
+
+// unpackBits decompresses PackBits (run-length) encoded data.
+func unpackBits(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(int8(data[i]))
+		i++
+		switch {
+		case n >= 0 && i+n+1 <= len(data):
+			out = append(out, data[i:i+n+1]...)
+			i += n + 1
+		case n < 0 && n != -128 && i < len(data):
+			out = append(out, bytes.Repeat(data[i:i+1], 1-n)...)
+			i++
+		case n == -128:
+		default:
+			return out
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,114 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"testing"
+)
+
+type testTIFFPage struct {
+	width, height, bits, compression, photometric int
+	strip                                         []byte
+}
+
+// testTIFF builds a little-endian TIFF file with one strip per page.
+func testTIFF(pages ...testTIFFPage) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("II*\x00")
+	binary.Write(buf, binary.LittleEndian, uint32(8))
+
+	for i, page := range pages {
+		type entry struct {
+			tag, fieldType uint16
+			count, value   uint32
+		}
+		entries := []entry{
+			{tiffTagWidth, tiffTypeLong, 1, uint32(page.width)},
+			{tiffTagHeight, tiffTypeLong, 1, uint32(page.height)},
+			{tiffTagBitsPerSample, tiffTypeShort, 1, uint32(page.bits)},
+			{tiffTagCompression, tiffTypeShort, 1, uint32(page.compression)},
+			{tiffTagPhotometric, tiffTypeShort, 1, uint32(page.photometric)},
+			{tiffTagStripOffsets, tiffTypeLong, 1, 0},
+			{tiffTagSamplesPerPixel, tiffTypeShort, 1, 1},
+			{tiffTagStripByteCounts, tiffTypeLong, 1, uint32(len(page.strip))},
+		}
+
+		start := uint32(buf.Len())
+		stripOffset := start + 2 + uint32(len(entries))*12 + 4
+		next := stripOffset + uint32(len(page.strip))
+		if i == len(pages)-1 {
+			next = 0
+		}
+
+		binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+		for _, e := range entries {
+			if e.tag == tiffTagStripOffsets {
+				e.value = stripOffset
+			}
+			binary.Write(buf, binary.LittleEndian, e)
+		}
+		binary.Write(buf, binary.LittleEndian, next)
+		buf.Write(page.strip)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeTIFFPages(t *testing.T) {
+	// 8 bit gray, white is zero
+	gray := []byte{0x00, 0x40, 0x80, 0xFF}
+	// 1 bit black is zero, packbits: two literal runs of 1 byte
+	bilevel := []byte{0x00, 0xA0, 0x00, 0x50}
+
+	data := testTIFF(
+		testTIFFPage{4, 1, 8, tiffCompressionNone, tiffPhotometricWhiteIsZero, gray},
+		testTIFFPage{4, 2, 1, tiffCompressionPackBits, 1, bilevel},
+	)
+
+	pages, err := DecodeTIFFPages(data)
+	if err != nil {
+		t.Fatalf("DecodeTIFFPages failed with error %s", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got: %d pages, want: 2 pages.", len(pages))
+	}
+
+	for x, want := range []uint8{0xFF, 0xBF, 0x7F, 0x00} {
+		if got := color.GrayModel.Convert(pages[0].At(x, 0)).(color.Gray).Y; got != want {
+			t.Errorf("Page 1 differs at x=%d, got: %d, want: %d.", x, got, want)
+		}
+	}
+
+	for i, want := range []uint8{0xFF, 0, 0xFF, 0, 0, 0xFF, 0, 0xFF} {
+		x, y := i%4, i/4
+		if got := color.GrayModel.Convert(pages[1].At(x, y)).(color.Gray).Y; got != want {
+			t.Errorf("Page 2 differs at (%d, %d), got: %d, want: %d.", x, y, got, want)
+		}
+	}
+
+	unsupported := testTIFF(testTIFFPage{4, 1, 1, 4, 0, []byte{0}}) // CCITT group 4
+	if _, err := DecodeTIFFPages(unsupported); err == nil {
+		t.Errorf("DecodeTIFFPages should fail for unsupported compressions")
+	}
+}
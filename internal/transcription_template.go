@@ -0,0 +1,305 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+const (
+	PDFTranscriptionHeading       = "PaperCrypt Transcription Template"
+	PDFTranscriptionIntro         = "Copy a PaperCrypt document onto this sheet by hand, one character per cell, so no printer has to be trusted with it. Copy the header lines exactly as shown, leaving empty fields empty. Write the checksum of each line into the shaded cells at its end, and the checksum of the whole block into the shaded cells of the line following the last one. To restore the document, type the header lines, two empty lines, and the data lines into a text file, and decode it using `papercrypt decode`."
+	PDFTranscriptionCommand       = "Generate the document using:"
+	PDFTranscriptionHeaderHeading = "Header"
+	PDFTranscriptionDataHeading   = "Data"
+	PDFTranscriptionOptional      = "(if present)"
+)
+
+const (
+	// transcriptionCellWidth is the width of a single character's cell, in mm.
+	transcriptionCellWidth = 5.0
+	// transcriptionCellHeight is the height of a single character's cell, in mm.
+	transcriptionCellHeight = 7.0
+	// transcriptionLineGap is the space between lines, in mm.
+	transcriptionLineGap = 1.5
+	// transcriptionHeaderRowHeight is the height of the rows of the header section, in mm.
+	transcriptionHeaderRowHeight = 8.0
+	// transcriptionLabelFontSize is the font size of the line numbers and header field names, in pt.
+	transcriptionLabelFontSize = 9
+	// transcriptionMaxColumns limits the number of columns chosen by TranscriptionColumns.
+	transcriptionMaxColumns = 64
+)
+
+// transcriptionHeaderField is a row of the header section of the transcription template.
+type transcriptionHeaderField struct {
+	name string
+	// value is printed if the field is determined by the options of the template, and left blank otherwise
+	value    string
+	optional bool
+}
+
+// transcriptionHeaderFields returns the header fields of documents written using the options,
+// in the order of GetText, so the header CRC-32 matches when the header is typed back.
+func transcriptionHeaderFields(opts TextOptions) []transcriptionHeaderField {
+	fields := []transcriptionHeaderField{
+		{name: core.HeaderFieldVersion},
+		{name: core.HeaderFieldSerial},
+		{name: core.HeaderFieldPurpose},
+		{name: core.HeaderFieldComment},
+		{name: core.HeaderFieldDate},
+		{name: core.HeaderFieldExpires, optional: true},
+		{name: core.HeaderFieldReviewBy, optional: true},
+		{name: core.HeaderFieldDataFormat},
+		{name: core.HeaderFieldMetadata, optional: true},
+	}
+	if opts.Encoding != core.PaperCryptDataEncodingBase16 {
+		fields = append(fields, transcriptionHeaderField{name: core.HeaderFieldDataEncoding, value: opts.Encoding.String()})
+	}
+	if opts.DataLayout() != core.DefaultDataLayout {
+		fields = append(fields, transcriptionHeaderField{name: core.HeaderFieldDataLayout, value: opts.DataLayout().String()})
+	}
+	if opts.LineChecksum != core.LineChecksumCRC24 {
+		fields = append(fields, transcriptionHeaderField{name: core.HeaderFieldLineChecksum, value: opts.LineChecksum.String()})
+	}
+
+	return append(fields,
+		transcriptionHeaderField{name: core.HeaderFieldContentLength},
+		transcriptionHeaderField{name: core.HeaderFieldCRC24},
+		transcriptionHeaderField{name: core.HeaderFieldCRC32},
+		transcriptionHeaderField{name: core.HeaderFieldSHA256},
+		transcriptionHeaderField{name: core.HeaderFieldPlaintextSHA256, optional: true},
+		transcriptionHeaderField{name: core.HeaderFieldHeaderCRC32},
+	)
+}
+
+// transcriptionGroups returns the number of digits of each group of a full line of data.
+func transcriptionGroups(opts TextOptions) []int {
+	layout := opts.DataLayout()
+	line := opts.Encoding.EncodeLine(make([]byte, layout.BytesPerLine()), layout.GroupSize)
+
+	groups := strings.Split(line, " ")
+	digits := make([]int, len(groups))
+	for i, group := range groups {
+		digits[i] = len(group)
+	}
+
+	return digits
+}
+
+// transcriptionLabelWidth returns the width of the line numbers of a grid of `lines` lines, in mm.
+func transcriptionLabelWidth(layout core.DataLayout, lines int) float64 {
+	if !layout.LineIndices {
+		return 0
+	}
+
+	return float64(len(fmt.Sprint(lines))+2) * 2.2
+}
+
+// transcriptionLineWidth returns the width of a line of the grid, in mm.
+func transcriptionLineWidth(opts TextOptions, lines int) float64 {
+	width := transcriptionLabelWidth(opts.DataLayout(), lines)
+	for _, digits := range transcriptionGroups(opts) {
+		width += float64(digits)*transcriptionCellWidth + transcriptionCellWidth/2
+	}
+
+	// a full cell of space separates the checksum from the data
+	checksumDigits := len(opts.LineChecksum.Format(0))
+	return width + transcriptionCellWidth/2 + float64(checksumDigits)*transcriptionCellWidth
+}
+
+// TranscriptionColumns returns the largest number of columns (groups per line) of the layout,
+// whose lines fit the width of the page in the cells of the transcription template, at least 1.
+func TranscriptionColumns(opts TextOptions) int {
+	columns := 1
+	for c := 2; c <= transcriptionMaxColumns; c++ {
+		opts.Layout = opts.DataLayout()
+		opts.Layout.Columns = c
+		// leave room for line numbers of up to three digits
+		if transcriptionLineWidth(opts, 999) > opts.Page.ContentWidth() {
+			break
+		}
+
+		columns = c
+	}
+
+	return columns
+}
+
+// GenerateTranscriptionTemplatePDF renders a blank template to copy a document onto by hand:
+// the fields of the header, and a grid of `lines` lines of cells, laid out for the encoding, layout, and line checksum
+// of the options, each followed by cells for its checksum. If lines is 0, the grid fills the first page.
+// command is printed as the way of generating documents matching the template.
+// Its text is translated into the language of the options.
+func GenerateTranscriptionTemplatePDF(lines int, command string, opts TextOptions) ([]byte, error) {
+	if opts.Encoding == core.PaperCryptDataEncodingArmor || opts.Encoding == core.PaperCryptDataEncodingWords {
+		return nil, fmt.Errorf("transcription templates do not support the %s encoding", opts.Encoding)
+	}
+	if lines < 0 {
+		return nil, errors.New("number of lines must not be negative")
+	}
+	if err := opts.DataLayout().Validate(); err != nil {
+		return nil, err
+	}
+
+	l := opts.Language
+	layout := opts.DataLayout()
+	_, pageHeight := opts.Page.Dimensions()
+	bottom := pageHeight - core.PageFooterHeight - 5
+
+	pdf := getPdf(opts.Page)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont(PdfMonoFont, "", 10)
+		pdf.CellFormat(0, 10, l.Sprintf(PDFPageCaption, pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont(PdfTextFont, "B", 16)
+	pdf.CellFormat(0, 10, l.T(PDFTranscriptionHeading), "", 0, "C", false, 0, "")
+	pdf.Ln(10)
+
+	pdf.SetFont(PdfTextFont, "", 10)
+	pdf.MultiCell(0, 5, l.T(PDFTranscriptionIntro), "", "", false)
+	pdf.Ln(2)
+	pdf.MultiCell(0, 5, l.T(PDFTranscriptionCommand), "", "", false)
+	pdf.SetFont(PdfMonoFont, "", transcriptionLabelFontSize)
+	pdf.MultiCell(0, 5, command, "", "C", false)
+	pdf.Ln(3)
+
+	// header fields, with a line to write on
+	pdf.SetFont(PdfTextFont, "B", 10)
+	pdf.CellFormat(0, 5, l.T(PDFTranscriptionHeaderHeading), "", 0, "L", false, 0, "")
+	pdf.Ln(5)
+
+	fields := transcriptionHeaderFields(opts)
+	pdf.SetFont(PdfMonoFont, "", transcriptionLabelFontSize)
+	labelWidth := 0.0
+	for _, field := range fields {
+		labelWidth = max(labelWidth, pdf.GetStringWidth(field.name+": "))
+	}
+
+	left := opts.Page.Margin()
+	right := left + opts.Page.ContentWidth()
+	for _, field := range fields {
+		pdf.SetFont(PdfMonoFont, "", transcriptionLabelFontSize)
+		pdf.CellFormat(labelWidth, transcriptionHeaderRowHeight, field.name+":", "", 0, "L", false, 0, "")
+
+		switch {
+		case field.value != "":
+			pdf.CellFormat(0, transcriptionHeaderRowHeight, field.value, "", 0, "L", false, 0, "")
+		default:
+			y := pdf.GetY() + transcriptionHeaderRowHeight - 1.5
+			pdf.Line(left+labelWidth, y, right, y)
+			if field.optional {
+				pdf.SetFont(PdfTextFont, "I", 8)
+				pdf.CellFormat(0, transcriptionHeaderRowHeight, l.T(PDFTranscriptionOptional), "", 0, "R", false, 0, "")
+			}
+		}
+		pdf.Ln(transcriptionHeaderRowHeight)
+	}
+	pdf.Ln(4)
+
+	// the grid of the data block
+	pdf.SetFont(PdfTextFont, "B", 10)
+	pdf.CellFormat(0, 5, l.T(PDFTranscriptionDataHeading), "", 0, "L", false, 0, "")
+	pdf.Ln(6)
+
+	rowHeight := transcriptionCellHeight + transcriptionLineGap
+	if lines == 0 {
+		// as many lines as fit the rest of the first page
+		lines = max(int((bottom-pdf.GetY())/rowHeight), 1)
+		for lines > 1 && pdf.GetY()+transcriptionGridHeight(layout, lines) > bottom {
+			lines--
+		}
+	}
+
+	groups := transcriptionGroups(opts)
+	checksumDigits := len(opts.LineChecksum.Format(0))
+	lineLabelWidth := transcriptionLabelWidth(layout, lines)
+
+	pdf.SetFillColor(225, 225, 225)
+	pdf.SetDrawColor(0, 0, 0)
+	for line := 1; line <= lines; line++ {
+		startsBlock := line == 1 || (layout.BlockLines > 0 && (line-1)%layout.BlockLines == 0)
+		if startsBlock && line > 1 {
+			pdf.Ln(transcriptionCellHeight / 2)
+		}
+
+		startsPage := false
+		if pdf.GetY()+rowHeight > bottom {
+			pdf.AddPage()
+			startsPage = true
+		}
+
+		if layout.ColumnIndices && (startsBlock || startsPage) {
+			drawTranscriptionColumnIndices(pdf, groups, lineLabelWidth)
+		}
+
+		pdf.SetFont(PdfMonoFont, "", transcriptionLabelFontSize)
+		if layout.LineIndices {
+			pdf.CellFormat(lineLabelWidth, transcriptionCellHeight, fmt.Sprintf("%d: ", line), "", 0, "R", false, 0, "")
+		}
+		for _, digits := range groups {
+			for i := 0; i < digits; i++ {
+				pdf.CellFormat(transcriptionCellWidth, transcriptionCellHeight, "", "1", 0, "C", false, 0, "")
+			}
+			pdf.CellFormat(transcriptionCellWidth/2, transcriptionCellHeight, "", "", 0, "C", false, 0, "")
+		}
+		pdf.CellFormat(transcriptionCellWidth/2, transcriptionCellHeight, "", "", 0, "C", false, 0, "")
+		for i := 0; i < checksumDigits; i++ {
+			pdf.CellFormat(transcriptionCellWidth, transcriptionCellHeight, "", "1", 0, "C", true, 0, "")
+		}
+
+		pdf.Ln(rowHeight)
+	}
+
+	return outputPDF(pdf)
+}
+
+// transcriptionGridHeight returns the height of a grid of `lines` lines on a single page, in mm.
+func transcriptionGridHeight(layout core.DataLayout, lines int) float64 {
+	blocks := 1
+	if layout.BlockLines > 0 {
+		blocks = (lines + layout.BlockLines - 1) / layout.BlockLines
+	}
+
+	height := float64(lines)*(transcriptionCellHeight+transcriptionLineGap) + float64(blocks-1)*transcriptionCellHeight/2
+	if layout.ColumnIndices {
+		height += float64(blocks) * transcriptionCellHeight / 2
+	}
+
+	return height
+}
+
+// drawTranscriptionColumnIndices prints the number of each group above its first cell.
+func drawTranscriptionColumnIndices(pdf *gofpdf.Fpdf, groups []int, labelWidth float64) {
+	pdf.SetFont(PdfMonoFont, "", 7)
+	pdf.CellFormat(labelWidth, transcriptionCellHeight/2, core.ColumnIndexLabel, "", 0, "R", false, 0, "")
+	for i, digits := range groups {
+		pdf.CellFormat(float64(digits)*transcriptionCellWidth+transcriptionCellWidth/2, transcriptionCellHeight/2, fmt.Sprint(i+1), "", 0, "L", false, 0, "")
+	}
+	pdf.Ln(transcriptionCellHeight / 2)
+}
@@ -0,0 +1,152 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func TestTranscriptionHeaderFields(t *testing.T) {
+	pc := core.NewPaperCrypt("2.0.0", make([]byte, 100), "ABCDEF", "Purpose", "", time.Now(), core.PaperCryptDataFormatPGP)
+
+	for _, opts := range []TextOptions{
+		{},
+		{Encoding: core.PaperCryptDataEncodingBase32, Layout: core.DataLayout{GroupSize: 1, Columns: 12, BlockLines: 5, LineIndices: true}},
+		{Encoding: core.PaperCryptDataEncodingBase64, LineChecksum: core.LineChecksumSHA256},
+	} {
+		for _, optional := range []bool{false, true} {
+			pc.PlaintextSHA256 = nil
+			pc.ExpiresAt, pc.ReviewBy = time.Time{}, time.Time{}
+			pc.PrivateMetadata = optional
+			if optional {
+				pc.PlaintextSHA256 = make([]byte, 32)
+				pc.ExpiresAt = time.Date(2030, 1, 31, 0, 0, 0, 0, time.UTC)
+				pc.ReviewBy = time.Date(2027, 8, 1, 0, 0, 0, 0, time.UTC)
+			}
+
+			text, err := pc.GetText(opts.EncodingOptions())
+			if err != nil {
+				t.Fatalf("GetText failed with error %s", err)
+			}
+			header, _, err := core.SplitTextHeaderAndBody(text)
+			if err != nil {
+				t.Fatalf("SplitTextHeaderAndBody failed with error %s", err)
+			}
+
+			var want []string
+			values := make(map[string]string)
+			for _, line := range strings.Split(string(header), "\n") {
+				name, value, _ := strings.Cut(line, ": ")
+				want = append(want, name)
+				values[name] = value
+			}
+
+			var got []string
+			for _, field := range transcriptionHeaderFields(opts) {
+				if field.optional && !optional {
+					continue
+				}
+				got = append(got, field.name)
+
+				if field.value != "" && field.value != values[field.name] {
+					t.Errorf("Field %s: got: %s, want: %s.", field.name, field.value, values[field.name])
+				}
+			}
+
+			if !slices.Equal(got, want) {
+				t.Errorf("got: %v, want: %v.", got, want)
+			}
+		}
+	}
+}
+
+func TestTranscriptionColumns(t *testing.T) {
+	for _, page := range core.Pages() {
+		for _, encoding := range []core.PaperCryptDataEncoding{core.PaperCryptDataEncodingBase16, core.PaperCryptDataEncodingBase32, core.PaperCryptDataEncodingBase64} {
+			for _, checksum := range []core.LineChecksum{core.LineChecksumCRC24, core.LineChecksumSHA256} {
+				opts := TextOptions{Encoding: encoding, LineChecksum: checksum, Page: page}
+				opts.Layout = core.DefaultDataLayout
+				opts.Layout.Columns = TranscriptionColumns(opts)
+
+				if opts.Layout.Columns < 1 {
+					t.Fatalf("%s, %s: got: %d columns, want at least 1.", page, encoding, opts.Layout.Columns)
+				}
+				if width := transcriptionLineWidth(opts, 999); width > page.ContentWidth() {
+					t.Errorf("%s, %s: lines are %.1f mm wide, the page only %.1f mm.", page, encoding, width, page.ContentWidth())
+				}
+			}
+		}
+	}
+}
+
+func TestTranscriptionGroups(t *testing.T) {
+	data := bytes.Repeat([]byte{0xA5}, 100)
+	for _, encoding := range []core.PaperCryptDataEncoding{core.PaperCryptDataEncodingBase16, core.PaperCryptDataEncodingBase32, core.PaperCryptDataEncodingBase64} {
+		opts := TextOptions{Encoding: encoding, Layout: core.DataLayout{GroupSize: 2, Columns: 5, LineIndices: true}}
+		groups := transcriptionGroups(opts)
+
+		// every line of a document fits the cells of the template
+		block := core.SerializeBinaryEncoded(&data, encoding, opts.Layout, core.LineChecksumCRC24)
+		for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+			_, content, _ := strings.Cut(line, ": ")
+			fields := strings.Fields(content)
+			if len(fields) == 1 {
+				// the checksum of the block
+				continue
+			}
+
+			fields = fields[:len(fields)-1]
+			if len(fields) > len(groups) {
+				t.Fatalf("%s: got: %d groups, the template has %d.", encoding, len(fields), len(groups))
+			}
+			for i, field := range fields {
+				if len(field) > groups[i] {
+					t.Errorf("%s: group %d has %d digits, the template %d.", encoding, i+1, len(field), groups[i])
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateTranscriptionTemplatePDF(t *testing.T) {
+	loadFonts(t)
+
+	for _, lines := range []int{0, 80} {
+		opts := TextOptions{Encoding: core.PaperCryptDataEncodingBase32, Layout: core.DataLayout{GroupSize: 1, Columns: 10, BlockLines: 5, LineIndices: true, ColumnIndices: true}}
+		data, err := GenerateTranscriptionTemplatePDF(lines, "papercrypt generate --encoding base32", opts)
+		if err != nil {
+			t.Fatalf("GenerateTranscriptionTemplatePDF failed with error %s", err)
+		}
+		if !IsPDF(data) {
+			t.Errorf("Template with %d lines is not a PDF document", lines)
+		}
+	}
+
+	if _, err := GenerateTranscriptionTemplatePDF(0, "", TextOptions{Encoding: core.PaperCryptDataEncodingWords}); err == nil {
+		t.Errorf("Templates for the words encoding should fail")
+	}
+}
@@ -0,0 +1,272 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// trueTypeFont holds the glyph outlines of a TrueType font, as embedded into PDF documents.
+// Only the tables needed to draw glyphs are read: hinting, kerning, and character maps are ignored,
+// as PDF documents select glyphs by their index.
+type trueTypeFont struct {
+	unitsPerEm float64
+	loca       []uint32
+	glyf       []byte
+}
+
+// glyphPoint is a point of a glyph outline, in font units.
+type glyphPoint struct {
+	X, Y    float64
+	OnCurve bool
+}
+
+func parseTrueType(data []byte) (*trueTypeFont, error) {
+	if len(data) < 12 {
+		return nil, errors.New("font data is too short")
+	}
+
+	tables := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < count; i++ {
+		entry := data[12+16*i:]
+		if len(entry) < 16 {
+			return nil, errors.New("font table directory is truncated")
+		}
+
+		offset, length := binary.BigEndian.Uint32(entry[8:]), binary.BigEndian.Uint32(entry[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("font table %s is truncated", entry[:4])
+		}
+		tables[string(entry[:4])] = data[offset : offset+length]
+	}
+
+	head, loca, glyf := tables["head"], tables["loca"], tables["glyf"]
+	if len(head) < 54 || loca == nil || glyf == nil {
+		return nil, errors.New("font has no glyph outlines")
+	}
+
+	font := &trueTypeFont{
+		unitsPerEm: float64(binary.BigEndian.Uint16(head[18:])),
+		glyf:       glyf,
+	}
+	if binary.BigEndian.Uint16(head[50:]) == 0 {
+		// short offsets, divided by two
+		for i := 0; i+1 < len(loca); i += 2 {
+			font.loca = append(font.loca, 2*uint32(binary.BigEndian.Uint16(loca[i:])))
+		}
+	} else {
+		for i := 0; i+3 < len(loca); i += 4 {
+			font.loca = append(font.loca, binary.BigEndian.Uint32(loca[i:]))
+		}
+	}
+	if font.unitsPerEm == 0 {
+		font.unitsPerEm = 1000
+	}
+
+	return font, nil
+}
+
+// contours returns the outline of a glyph, as closed contours.
+func (f *trueTypeFont) contours(glyph int) ([][]glyphPoint, error) {
+	return f.glyphContours(glyph, 0)
+}
+
+func (f *trueTypeFont) glyphContours(glyph int, depth int) ([][]glyphPoint, error) {
+	if glyph < 0 || glyph+1 >= len(f.loca) || depth > 8 {
+		return nil, nil
+	}
+
+	start, end := f.loca[glyph], f.loca[glyph+1]
+	if start >= end {
+		return nil, nil // empty glyph, such as a space
+	}
+	if end > uint32(len(f.glyf)) || end-start < 10 {
+		return nil, fmt.Errorf("glyph %d is truncated", glyph)
+	}
+
+	data := f.glyf[start:end]
+	contourCount := int(int16(binary.BigEndian.Uint16(data)))
+	if contourCount < 0 {
+		return f.compositeContours(data[10:], depth)
+	}
+
+	return simpleContours(data[10:], contourCount)
+}
+
+// errTruncatedGlyph is returned for glyph data ending unexpectedly.
+var errTruncatedGlyph = errors.New("glyph data is truncated")
+
+func simpleContours(data []byte, contourCount int) ([][]glyphPoint, error) {
+	if len(data) < 2*contourCount+2 {
+		return nil, errTruncatedGlyph
+	}
+
+	ends := make([]int, contourCount)
+	for i := range ends {
+		ends[i] = int(binary.BigEndian.Uint16(data[2*i:]))
+	}
+	pos := 2 * contourCount
+	pos += 2 + int(binary.BigEndian.Uint16(data[pos:])) // instructions
+	if contourCount == 0 {
+		return nil, nil
+	}
+
+	points := ends[contourCount-1] + 1
+	flags := make([]byte, 0, points)
+	for len(flags) < points {
+		if pos >= len(data) {
+			return nil, errTruncatedGlyph
+		}
+		flag := data[pos]
+		pos++
+		flags = append(flags, flag)
+
+		if flag&0x08 != 0 { // repeat
+			if pos >= len(data) {
+				return nil, errTruncatedGlyph
+			}
+			for n := data[pos]; n > 0 && len(flags) < points; n-- {
+				flags = append(flags, flag)
+			}
+			pos++
+		}
+	}
+
+	// coordinates are deltas, either a byte with a sign flag, or a 16 bit value, or repeated
+	coordinates := func(short, same byte) ([]float64, error) {
+		values := make([]float64, points)
+		value := 0
+		for i, flag := range flags {
+			switch {
+			case flag&short != 0:
+				if pos >= len(data) {
+					return nil, errTruncatedGlyph
+				}
+				if flag&same != 0 {
+					value += int(data[pos])
+				} else {
+					value -= int(data[pos])
+				}
+				pos++
+			case flag&same == 0:
+				if pos+1 >= len(data) {
+					return nil, errTruncatedGlyph
+				}
+				value += int(int16(binary.BigEndian.Uint16(data[pos:])))
+				pos += 2
+			}
+			values[i] = float64(value)
+		}
+		return values, nil
+	}
+
+	xs, err := coordinates(0x02, 0x10)
+	if err != nil {
+		return nil, err
+	}
+	ys, err := coordinates(0x04, 0x20)
+	if err != nil {
+		return nil, err
+	}
+
+	contours := make([][]glyphPoint, 0, contourCount)
+	first := 0
+	for _, last := range ends {
+		if last < first || last >= points {
+			return nil, errors.New("invalid glyph contour")
+		}
+
+		contour := make([]glyphPoint, 0, last-first+1)
+		for i := first; i <= last; i++ {
+			contour = append(contour, glyphPoint{X: xs[i], Y: ys[i], OnCurve: flags[i]&0x01 != 0})
+		}
+		contours = append(contours, contour)
+		first = last + 1
+	}
+
+	return contours, nil
+}
+
+func (f *trueTypeFont) compositeContours(data []byte, depth int) ([][]glyphPoint, error) {
+	var contours [][]glyphPoint
+	for pos := 0; ; {
+		if pos+4 > len(data) {
+			return nil, errTruncatedGlyph
+		}
+		flags := binary.BigEndian.Uint16(data[pos:])
+		component := int(binary.BigEndian.Uint16(data[pos+2:]))
+		pos += 4
+
+		var dx, dy float64
+		if flags&0x0001 != 0 { // 16 bit arguments
+			if pos+4 > len(data) {
+				return nil, errTruncatedGlyph
+			}
+			dx, dy = float64(int16(binary.BigEndian.Uint16(data[pos:]))), float64(int16(binary.BigEndian.Uint16(data[pos+2:])))
+			pos += 4
+		} else {
+			if pos+2 > len(data) {
+				return nil, errTruncatedGlyph
+			}
+			dx, dy = float64(int8(data[pos])), float64(int8(data[pos+1]))
+			pos += 2
+		}
+		if flags&0x0002 == 0 {
+			// the arguments are points to be matched, which is rare, and not supported
+			dx, dy = 0, 0
+		}
+
+		f2dot14 := func(i int) float64 {
+			return float64(int16(binary.BigEndian.Uint16(data[pos+2*i:]))) / 16384
+		}
+		a, b, c, d := 1.0, 0.0, 0.0, 1.0
+		switch {
+		case flags&0x0008 != 0 && pos+2 <= len(data): // scale
+			a = f2dot14(0)
+			d = a
+			pos += 2
+		case flags&0x0040 != 0 && pos+4 <= len(data): // x and y scale
+			a, d = f2dot14(0), f2dot14(1)
+			pos += 4
+		case flags&0x0080 != 0 && pos+8 <= len(data): // 2x2 matrix
+			a, b, c, d = f2dot14(0), f2dot14(1), f2dot14(2), f2dot14(3)
+			pos += 8
+		}
+
+		parts, err := f.glyphContours(component, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			for i, p := range part {
+				part[i].X, part[i].Y = a*p.X+c*p.Y+dx, b*p.X+d*p.Y+dy
+			}
+			contours = append(contours, part)
+		}
+
+		if flags&0x0020 == 0 { // no more components
+			return contours, nil
+		}
+	}
+}
@@ -0,0 +1,314 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// The Typst output is the source code of a Typst (https://typst.app) document, for power users who want
+// complete control over the typography: adjust it, and compile it using 'typst compile document.typ'.
+// Images are embedded as byte arrays, so the source is a single file, fonts are looked up by name.
+
+// typstImage is an image of a Typst document, with its printed size in mm.
+type typstImage struct {
+	Data          string
+	Format        string
+	Width, Height float64
+	Caption       string
+}
+
+// typstLine is a line of the data block of a Typst document.
+type typstLine struct {
+	Text  string
+	Cells []string
+	Gap   bool
+	Shade bool
+	Index bool
+}
+
+type typstDocument struct {
+	Lang        string
+	Title       string
+	PageCaption string
+	Width       float64
+	Height      float64
+	Margin      float64
+	DataSize    float64
+	LineHeight  float64
+	HeaderLine  string
+	Logo        *typstImage
+	Header      string
+	Footer      string
+	Banner      string
+	Watermark   string
+	WatermarkAt float64
+	Heading     string
+	Sections    []documentSection
+	Codes       []typstImage
+	HeaderLines []string
+	DataLines   []typstLine
+
+	InstructionsHeading string
+	InstructionsIntro   string
+	InstructionsStep    string
+	Instructions        []RecoveryStep
+}
+
+var typstTemplate = template.Must(template.New("document").Funcs(template.FuncMap{
+	"str": typstString,
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`// {{.Title}}
+// Generated by PaperCrypt, compile it using Typst 0.13 or newer: typst compile document.typ
+#let mono = ("Inconsolata", "DejaVu Sans Mono")
+#let banner = {{if .Banner}}block(width: 100%, fill: black, inset: 1mm, align(center, text(fill: white, weight: "bold", {{str .Banner}}))){{else}}none{{end}}
+
+#set document(title: {{str .Title}})
+#set page(
+  width: {{.Width}}mm,
+  height: {{.Height}}mm,
+  margin: (x: {{.Margin}}mm, top: 25mm, bottom: 15mm),
+  header: {
+    {{- if .Logo}}
+    place(left + top, dy: 4mm, image({{.Logo.Data}}, format: {{str .Logo.Format}}, width: {{.Logo.Width}}mm, height: {{.Logo.Height}}mm))
+    {{- end}}
+    banner
+    align(center, text(font: mono, size: 10pt, {{str .HeaderLine}}))
+    {{- if .Header}}
+    align(center, text(size: 8pt, {{str .Header}}))
+    {{- end}}
+  },
+  footer: context {
+    set text(size: 8pt)
+    grid(columns: (1fr, auto), {{if .Footer}}{{str .Footer}}{{else}}[]{{end}}, counter(page).display({{str .PageCaption}}, both: true))
+    banner
+  },
+  {{- if .Watermark}}
+  background: place(center + horizon, rotate({{.WatermarkAt}}deg, text(size: 100pt, weight: "bold", fill: luma(235), {{str .Watermark}}))),
+  {{- end}}
+)
+#set text(font: ("Noto Sans", "DejaVu Sans"), size: 10pt, lang: {{str .Lang}})
+#set par(justify: true)
+#show heading.where(level: 1): it => align(center, block(height: 10mm, text(size: 16pt, it.body)))
+#show heading.where(level: 2): it => block(above: 5mm, below: 2mm, text(size: 10pt, weight: "bold", it.body))
+#show raw.where(block: false): set text(font: mono, size: {{.DataSize}}pt)
+#show raw.where(block: true): set text(font: mono, size: 9pt)
+
+#let data-line(line, shade: false, index: false) = block(
+  width: 100%, height: {{.LineHeight}}mm, spacing: 0pt, fill: if shade { luma(240) },
+  align(horizon, text(weight: if index { "regular" } else { "bold" }, raw(line))),
+)
+#let stamping-line(cells) = block(spacing: 2mm, cells.map(cell => if cell == " " { h(2.75mm) } else {
+  box(width: 5.5mm, height: 8mm, stroke: 0.2mm, align(center + horizon, text(font: mono, size: 16pt, weight: "bold", cell)))
+}).join())
+
+= #{{str .Heading}}
+{{range $section := .Sections}}
+== #{{str $section.Heading}}
+{{range $section.Paragraphs}}
+#{{str .}}
+{{end}}
+{{- range $section.Code}}
+#align(center, text(font: mono, weight: "bold", size: {{$section.CodeSize}}pt, {{str .}}))
+{{- end}}
+{{end}}
+{{- range $i, $code := .Codes}}
+#pagebreak()
+{{- if $code.Caption}}
+#align(center, text(weight: "bold", {{str $code.Caption}}))
+{{- end}}
+#align(center, image({{$code.Data}}, format: {{str $code.Format}}, width: {{$code.Width}}mm, height: {{$code.Height}}mm, scaling: "pixelated"))
+{{end}}
+#pagebreak()
+{{- range .HeaderLines}}
+#data-line({{str (printf "# %s" .)}})
+{{- end}}
+#v(10mm)
+{{- range .DataLines}}
+{{- if .Gap}}
+#v(2.5mm)
+{{- else if .Cells}}
+#stamping-line(({{range .Cells}}{{str .}}, {{end}}))
+{{- else}}
+#data-line({{str .Text}}{{if .Shade}}, shade: true{{end}}{{if .Index}}, index: true{{end}})
+{{- end}}
+{{- end}}
+{{if .Instructions}}
+#pagebreak()
+= #{{str .InstructionsHeading}}
+
+#{{str .InstructionsIntro}}
+{{range $i, $step := .Instructions}}
+== #{{str (printf $.InstructionsStep (inc $i))}}
+
+#{{str $step.Text}}
+{{- if $step.Command}}
+
+#block(width: 100%, fill: luma(240), stroke: 0.2mm, inset: 1mm, raw(block: true, {{str $step.Command}}))
+{{- end}}
+{{end}}
+{{- end}}
+`))
+
+// typstString returns s as a Typst string literal.
+func typstString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// typstBytes returns data as a Typst bytes value, for embedding images into the source code.
+func typstBytes(data []byte) string {
+	var b strings.Builder
+	b.Grow(4*len(data) + 10)
+	b.WriteString("bytes((")
+	for i, c := range data {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(int(c)))
+	}
+	b.WriteString(",))")
+
+	return b.String()
+}
+
+// GetTypst returns the source code of the document as a Typst document, holding the same content as GetPDF.
+// Fonts can not be embedded into the source code, so a custom data font (see TextOptions.DataFont) is not supported.
+func GetTypst(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error) {
+	if opts.DataFont != nil {
+		return nil, errors.New("the Typst source code can not embed fonts, change the font in the source code instead")
+	}
+
+	text, err := p.GetText(opts.EncodingOptions())
+	if err != nil {
+		return nil, fmt.Errorf("error getting text content: %s", err)
+	}
+
+	headerLines, dataLines, err := splitDocumentText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	images, sizes, err := code2DImages(p, no2D, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := opts.Page.Dimensions()
+	doc := typstDocument{
+		Lang:        opts.Language.Tag(),
+		Title:       fmt.Sprintf("%s - %s", opts.Language.T(PDFHeading), p.SerialNumber),
+		PageCaption: strings.Replace(opts.Language.T(PDFPageCaption), "%d/{nb}", "1/1", 1),
+		Width:       width,
+		Height:      height,
+		Margin:      opts.Page.Margin(),
+		DataSize:    opts.dataFontSize(),
+		LineHeight:  max(5, 5*opts.dataFontSize()/PdfDataLineFontSize),
+		HeaderLine:  headerLine(p, opts),
+		Banner:      opts.Banner,
+		Watermark:   opts.Watermark,
+		WatermarkAt: -math.Atan2(height, width) * 180 / math.Pi,
+		Heading:     opts.Language.T(PDFHeading),
+		Sections:    documentSections(p, no2D, len(images), opts),
+		HeaderLines: headerLines,
+	}
+
+	if opts.Template != nil {
+		doc.Header, doc.Footer = opts.Template.Header, opts.Template.Footer
+		if opts.Template.logo != nil {
+			logoWidth, logoHeight := opts.Template.logoSize()
+			format := opts.Template.logoType
+			if format == "jpeg" {
+				format = "jpg"
+			}
+			doc.Logo = &typstImage{Data: typstBytes(opts.Template.logo), Format: format, Width: logoWidth, Height: logoHeight}
+		}
+	}
+
+	for i, img := range images {
+		code := typstImage{Data: typstBytes(img.Bytes()), Format: "png", Width: sizes[i], Height: sizes[i]}
+		if i > 0 {
+			code.Caption = opts.Language.Sprintf(PDFCodePartCaption, i+1, len(images))
+		}
+		doc.Codes = append(doc.Codes, code)
+	}
+
+	// every second line of a block is shaded, as in the PDF document
+	n := 0
+	for _, line := range dataLines {
+		switch {
+		case line == "":
+			doc.DataLines = append(doc.DataLines, typstLine{Gap: true})
+			n = 0
+		case opts.Profile == OutputProfileStamping:
+			cells := make([]string, 0, len(line))
+			for _, c := range line {
+				cells = append(cells, string(c))
+			}
+			doc.DataLines = append(doc.DataLines, typstLine{Cells: cells})
+		case core.IsColumnIndexLine([]byte(line)):
+			doc.DataLines = append(doc.DataLines, typstLine{Text: line, Index: true})
+		default:
+			n++
+			doc.DataLines = append(doc.DataLines, typstLine{Text: line, Shade: n%2 == 1})
+		}
+	}
+
+	if opts.Instructions {
+		doc.InstructionsHeading = opts.Language.T(PDFInstructionsHeading)
+		doc.InstructionsIntro = opts.Language.T(PDFInstructionsIntro)
+		doc.InstructionsStep = opts.Language.T(PDFInstructionsStep)
+		doc.Instructions = RecoveryInstructions(p, opts)
+	}
+
+	var buf bytes.Buffer
+	if err := typstTemplate.Execute(&buf, doc); err != nil {
+		return nil, errors.Join(errors.New("error generating Typst document"), err)
+	}
+
+	return buf.Bytes(), nil
+}
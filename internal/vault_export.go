@@ -0,0 +1,390 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// VaultFormat is the export format of a password manager, see ReadVaultExport.
+type VaultFormat uint8
+
+const (
+	// VaultFormatBitwarden is the unencrypted JSON export of Bitwarden.
+	VaultFormatBitwarden VaultFormat = 0
+	// VaultFormatOnePassword is the 1PUX export of 1Password, a zip archive holding export.data.
+	VaultFormatOnePassword VaultFormat = 1
+	// VaultFormatKeePass is a KeePass database (KDBX 3.1, or 4), read with ReadKeePassDatabase.
+	VaultFormatKeePass VaultFormat = 2
+	// VaultFormatUnknown is returned for unknown format names.
+	VaultFormatUnknown VaultFormat = 0xFF
+)
+
+func (f VaultFormat) String() string {
+	switch f {
+	case VaultFormatBitwarden:
+		return "Bitwarden"
+	case VaultFormatOnePassword:
+		return "1Password"
+	case VaultFormatKeePass:
+		return "KeePass"
+	default:
+		return "Unknown"
+	}
+}
+
+func VaultFormatFromString(s string) VaultFormat {
+	switch strings.ToLower(s) {
+	case "bitwarden":
+		return VaultFormatBitwarden
+	case "1password", "1pux":
+		return VaultFormatOnePassword
+	case "keepass", "kdbx":
+		return VaultFormatKeePass
+	default:
+		return VaultFormatUnknown
+	}
+}
+
+// VaultField is a named value of a vault entry, other than its username, password, and one-time password secret.
+type VaultField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// VaultEntry is an entry of a password manager, normalized from its export format.
+type VaultEntry struct {
+	Name string `json:"name"`
+	// Type is the kind of entry, such as login, note, card, or identity.
+	Type string `json:"type"`
+	// Folder is the folder (Bitwarden), the vault (1Password), or the path of the group (KeePass), holding the entry.
+	Folder   string   `json:"folder,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	// TOTP is the secret, or otpauth:// URI, of the one-time passwords of the entry.
+	TOTP   string       `json:"totp,omitempty"`
+	URLs   []string     `json:"urls,omitempty"`
+	Notes  string       `json:"notes,omitempty"`
+	Fields []VaultField `json:"fields,omitempty"`
+}
+
+// ReadVaultExport reads the entries of a password manager export in the given format.
+func ReadVaultExport(format VaultFormat, data []byte) ([]VaultEntry, error) {
+	switch format {
+	case VaultFormatBitwarden:
+		return readBitwardenExport(data)
+	case VaultFormatOnePassword:
+		return readOnePasswordExport(data)
+	case VaultFormatKeePass:
+		return nil, errors.New("a KeePass database is read with ReadKeePassDatabase, unlocking it with its master key")
+	default:
+		return nil, fmt.Errorf("unsupported vault export format: %s", format)
+	}
+}
+
+// FilterVaultEntries returns the entries in the folder, or its subfolders, with the tag, and of one of the names,
+// ignoring case, if they are not empty.
+func FilterVaultEntries(entries []VaultEntry, folder, tag string, names []string) []VaultEntry {
+	folder = strings.TrimSuffix(folder, "/")
+	var filtered []VaultEntry
+	for _, entry := range entries {
+		if folder != "" && !strings.EqualFold(entry.Folder, folder) &&
+			!(len(entry.Folder) > len(folder) && strings.EqualFold(entry.Folder[:len(folder)+1], folder+"/")) {
+			continue
+		}
+		if tag != "" && !containsFold(entry.Tags, tag) {
+			continue
+		}
+		if len(names) > 0 && !containsFold(names, entry.Name) {
+			continue
+		}
+
+		filtered = append(filtered, entry)
+	}
+
+	return filtered
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendField appends the field to fields, unless its value is empty.
+func appendField(fields []VaultField, name, value string) []VaultField {
+	if value == "" {
+		return fields
+	}
+
+	return append(fields, VaultField{Name: name, Value: value})
+}
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		Type     int     `json:"type"`
+		Name     string  `json:"name"`
+		Notes    string  `json:"notes"`
+		FolderID *string `json:"folderId"`
+		Fields   []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+		Login *struct {
+			URIs []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+		} `json:"login"`
+		Card     map[string]any `json:"card"`
+		Identity map[string]any `json:"identity"`
+	} `json:"items"`
+}
+
+// bitwardenItemTypes names the types of Bitwarden items, by their identifier.
+var bitwardenItemTypes = map[int]string{1: "login", 2: "note", 3: "card", 4: "identity"}
+
+func readBitwardenExport(data []byte) ([]VaultEntry, error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, errors.Join(errors.New("error reading the Bitwarden export, it must be exported as JSON"), err)
+	}
+	if export.Encrypted {
+		return nil, errors.New("the Bitwarden export is encrypted, export the vault as unencrypted JSON")
+	}
+
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	entries := make([]VaultEntry, 0, len(export.Items))
+	for _, item := range export.Items {
+		entry := VaultEntry{Name: item.Name, Type: bitwardenItemTypes[item.Type], Notes: item.Notes}
+		if entry.Type == "" {
+			entry.Type = "other"
+		}
+		if item.FolderID != nil {
+			entry.Folder = folders[*item.FolderID]
+		}
+		if item.Login != nil {
+			entry.Username, entry.Password, entry.TOTP = item.Login.Username, item.Login.Password, item.Login.TOTP
+			for _, uri := range item.Login.URIs {
+				if uri.URI != "" {
+					entry.URLs = append(entry.URLs, uri.URI)
+				}
+			}
+		}
+		entry.Fields = appendObjectFields(entry.Fields, item.Card)
+		entry.Fields = appendObjectFields(entry.Fields, item.Identity)
+		for _, field := range item.Fields {
+			entry.Fields = appendField(entry.Fields, field.Name, field.Value)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// appendObjectFields appends the values of a card, or an identity, of a Bitwarden item, in the order of their names.
+func appendObjectFields(fields []VaultField, object map[string]any) []VaultField {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if value, ok := object[name].(string); ok {
+			fields = appendField(fields, name, value)
+		}
+	}
+
+	return fields
+}
+
+type onePasswordExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []struct {
+				State        string `json:"state"`
+				CategoryUUID string `json:"categoryUuid"`
+				Details      struct {
+					LoginFields []struct {
+						Value       string `json:"value"`
+						Name        string `json:"name"`
+						Designation string `json:"designation"`
+					} `json:"loginFields"`
+					NotesPlain string `json:"notesPlain"`
+					Password   string `json:"password"`
+					Sections   []struct {
+						Title  string `json:"title"`
+						Fields []struct {
+							Title string                     `json:"title"`
+							Value map[string]json.RawMessage `json:"value"`
+						} `json:"fields"`
+					} `json:"sections"`
+				} `json:"details"`
+				Overview struct {
+					Title string   `json:"title"`
+					URL   string   `json:"url"`
+					Tags  []string `json:"tags"`
+					URLs  []struct {
+						URL string `json:"url"`
+					} `json:"urls"`
+				} `json:"overview"`
+			} `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+// onePasswordCategories names the categories of 1Password items, by their identifier.
+var onePasswordCategories = map[string]string{
+	"001": "login", "002": "card", "003": "note", "004": "identity", "005": "password", "006": "document",
+	"100": "software license", "101": "bank account", "102": "database", "103": "driver license",
+	"104": "outdoor license", "105": "membership", "106": "passport", "107": "reward program",
+	"108": "social security number", "109": "wireless router", "110": "server", "111": "email account",
+	"112": "api credential", "113": "medical record", "114": "ssh key", "115": "crypto wallet",
+}
+
+// onePasswordDataFile is the file of a 1PUX archive holding the items.
+const onePasswordDataFile = "export.data"
+
+func readOnePasswordExport(data []byte) ([]VaultEntry, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the 1Password export, it must be exported as 1PUX"), err)
+	}
+	file, err := archive.Open(onePasswordDataFile)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("the 1Password export holds no %s", onePasswordDataFile), err)
+	}
+	defer file.Close()
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, errors.Join(errors.New("error reading the 1Password export"), err)
+	}
+
+	var export onePasswordExport
+	if err := json.Unmarshal(contents, &export); err != nil {
+		return nil, errors.Join(errors.New("error reading the 1Password export"), err)
+	}
+
+	var entries []VaultEntry
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, item := range vault.Items {
+				if item.State == "archived" {
+					continue
+				}
+
+				entry := VaultEntry{
+					Name:     item.Overview.Title,
+					Type:     onePasswordCategories[item.CategoryUUID],
+					Folder:   vault.Attrs.Name,
+					Tags:     item.Overview.Tags,
+					Password: item.Details.Password,
+					Notes:    item.Details.NotesPlain,
+				}
+				if entry.Type == "" {
+					entry.Type = "other"
+				}
+				if item.Overview.URL != "" {
+					entry.URLs = append(entry.URLs, item.Overview.URL)
+				}
+				for _, url := range item.Overview.URLs {
+					if url.URL != "" && url.URL != item.Overview.URL {
+						entry.URLs = append(entry.URLs, url.URL)
+					}
+				}
+				for _, field := range item.Details.LoginFields {
+					switch field.Designation {
+					case "username":
+						entry.Username = field.Value
+					case "password":
+						entry.Password = field.Value
+					default:
+						entry.Fields = appendField(entry.Fields, field.Name, field.Value)
+					}
+				}
+				for _, section := range item.Details.Sections {
+					for _, field := range section.Fields {
+						kind, value := onePasswordFieldValue(field.Value)
+						name := field.Title
+						if section.Title != "" {
+							name = section.Title + ": " + name
+						}
+						if kind == "totp" && entry.TOTP == "" {
+							entry.TOTP = value
+							continue
+						}
+						entry.Fields = appendField(entry.Fields, name, value)
+					}
+				}
+
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// onePasswordFieldValue returns the kind, and the value, of a field of a 1Password item, stored as an object
+// with the kind as its single key, such as {"concealed": "..."}. Values other than text are kept as JSON.
+func onePasswordFieldValue(value map[string]json.RawMessage) (string, string) {
+	for kind, raw := range value {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			return kind, text
+		}
+		if string(raw) == "null" {
+			return kind, ""
+		}
+
+		return kind, string(raw)
+	}
+
+	return "", ""
+}
@@ -0,0 +1,176 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+const bitwardenTestExport = `{
+  "encrypted": false,
+  "folders": [{"id": "f1", "name": "Banking"}],
+  "items": [
+    {
+      "type": 1, "name": "Bank", "notes": "PIN is elsewhere", "folderId": "f1",
+      "fields": [{"name": "Customer Number", "value": "1234"}],
+      "login": {"uris": [{"uri": "https://bank.example"}], "username": "owner", "password": "hunter2", "totp": "JBSWY3DPEHPK3PXP"}
+    },
+    {
+      "type": 3, "name": "Card", "folderId": null,
+      "card": {"cardholderName": "Owner", "number": "4111111111111111", "code": null}
+    }
+  ]
+}`
+
+func TestReadBitwardenExport(t *testing.T) {
+	entries, err := ReadVaultExport(VaultFormatBitwarden, []byte(bitwardenTestExport))
+	if err != nil {
+		t.Fatalf("ReadVaultExport failed with error %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ReadVaultExport was incorrect, got: %d entries, want: %d.", len(entries), 2)
+	}
+
+	bank := entries[0]
+	if bank.Name != "Bank" || bank.Type != "login" || bank.Folder != "Banking" {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: Bank, login, in Banking.", bank)
+	}
+	if bank.Username != "owner" || bank.Password != "hunter2" || bank.TOTP != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: the login of owner.", bank)
+	}
+	if !slices.Equal(bank.URLs, []string{"https://bank.example"}) {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: %v.", bank.URLs, []string{"https://bank.example"})
+	}
+	if !slices.Equal(bank.Fields, []VaultField{{"Customer Number", "1234"}}) {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: the customer number.", bank.Fields)
+	}
+
+	card := entries[1]
+	want := []VaultField{{"cardholderName", "Owner"}, {"number", "4111111111111111"}}
+	if card.Type != "card" || card.Folder != "" || !slices.Equal(card.Fields, want) {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: a card with fields %v.", card, want)
+	}
+
+	if _, err := ReadVaultExport(VaultFormatBitwarden, []byte(`{"encrypted": true, "data": "..."}`)); err == nil {
+		t.Error("ReadVaultExport did not fail for an encrypted export")
+	}
+}
+
+// onePasswordTestExport returns a 1PUX archive, holding an active, and an archived item.
+func onePasswordTestExport(t *testing.T) []byte {
+	t.Helper()
+
+	const data = `{"accounts": [{"vaults": [{"attrs": {"name": "Private"}, "items": [
+  {
+    "state": "active", "categoryUuid": "001",
+    "overview": {"title": "Mail", "url": "https://mail.example", "tags": ["Work"]},
+    "details": {
+      "loginFields": [
+        {"value": "owner", "name": "username", "designation": "username"},
+        {"value": "secret", "name": "password", "designation": "password"}
+      ],
+      "notesPlain": "",
+      "sections": [{"title": "Recovery", "fields": [
+        {"title": "one-time password", "value": {"totp": "otpauth://totp/Mail?secret=JBSWY3DPEHPK3PXP"}},
+        {"title": "code", "value": {"concealed": "ABCD-EFGH"}},
+        {"title": "expires", "value": {"date": 1700000000}}
+      ]}]
+    }
+  },
+  {"state": "archived", "categoryUuid": "003", "overview": {"title": "Old"}, "details": {"notesPlain": "gone"}}
+]}]}]}`
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	file, err := archive.Create(onePasswordDataFile)
+	if err != nil {
+		t.Fatalf("Create failed with error %s", err)
+	}
+	if _, err := file.Write([]byte(data)); err != nil {
+		t.Fatalf("Write failed with error %s", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close failed with error %s", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestReadOnePasswordExport(t *testing.T) {
+	entries, err := ReadVaultExport(VaultFormatOnePassword, onePasswordTestExport(t))
+	if err != nil {
+		t.Fatalf("ReadVaultExport failed with error %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("ReadVaultExport was incorrect, got: %d entries, want: %d.", len(entries), 1)
+	}
+
+	mail := entries[0]
+	if mail.Name != "Mail" || mail.Type != "login" || mail.Folder != "Private" || !slices.Equal(mail.Tags, []string{"Work"}) {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: Mail, login, in Private, tagged Work.", mail)
+	}
+	if mail.Username != "owner" || mail.Password != "secret" || mail.TOTP != "otpauth://totp/Mail?secret=JBSWY3DPEHPK3PXP" {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: the login of owner.", mail)
+	}
+	want := []VaultField{{"Recovery: code", "ABCD-EFGH"}, {"Recovery: expires", "1700000000"}}
+	if !slices.Equal(mail.Fields, want) {
+		t.Errorf("ReadVaultExport was incorrect, got: %v, want: %v.", mail.Fields, want)
+	}
+
+	if _, err := ReadVaultExport(VaultFormatOnePassword, []byte(bitwardenTestExport)); err == nil {
+		t.Error("ReadVaultExport did not fail for an export other than 1PUX")
+	}
+}
+
+func TestFilterVaultEntries(t *testing.T) {
+	entries := []VaultEntry{
+		{Name: "a", Folder: "Banking"},
+		{Name: "b", Folder: "Banking", Tags: []string{"Work"}},
+		{Name: "c", Tags: []string{"work"}},
+		{Name: "d", Folder: "Banking/Cards"},
+		{Name: "e", Folder: "Bankingx"},
+	}
+
+	for _, test := range []struct {
+		folder, tag string
+		names       []string
+		want        []string
+	}{
+		{"", "", nil, []string{"a", "b", "c", "d", "e"}},
+		{"banking", "", nil, []string{"a", "b", "d"}},
+		{"Banking/Cards", "", nil, []string{"d"}},
+		{"", "WORK", nil, []string{"b", "c"}},
+		{"Banking", "Work", nil, []string{"b"}},
+		{"", "", []string{"A", "c"}, []string{"a", "c"}},
+		{"Mail", "", nil, nil},
+	} {
+		var names []string
+		for _, entry := range FilterVaultEntries(entries, test.folder, test.tag, test.names) {
+			names = append(names, entry.Name)
+		}
+		if !slices.Equal(names, test.want) {
+			t.Errorf("FilterVaultEntries(%q, %q, %v) was incorrect, got: %v, want: %v.", test.folder, test.tag, test.names, names, test.want)
+		}
+	}
+}
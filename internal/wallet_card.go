@@ -0,0 +1,168 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf/v2"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// The wallet card is a credit-card-sized document (ISO/IEC 7810 ID-1), holding a single QR code,
+// and just enough text to tell cards apart. It is printed at its exact size, to be cut out and laminated.
+
+const (
+	// WalletCardWidth is the width of a wallet card, in mm.
+	WalletCardWidth = 85.60
+	// WalletCardHeight is the height of a wallet card, in mm.
+	WalletCardHeight = 53.98
+	// walletCardCornerRadius is the radius of the rounded corners of a wallet card, in mm.
+	walletCardCornerRadius = 3.18
+
+	// walletCodeSize is the printed width (and height) of the QR code of a wallet card, in mm.
+	walletCodeSize = 44.0
+	// WalletQRMaxVersion is the largest QR version of wallet cards,
+	// its modules of 0.45 mm are about the smallest phone cameras read reliably through a laminate.
+	WalletQRMaxVersion = 20
+	// walletPurposeLines is the number of lines the purpose is printed on, longer purposes are shortened.
+	walletPurposeLines = 3
+)
+
+const (
+	WalletCardHint = "Scan with: papercrypt scan"
+	WalletCardNote = "Cut along the outline, and laminate the card, preferably with a matte film, which does not reflect light into the camera. Keep the passphrase separately."
+)
+
+// getWalletPDF returns a page holding the wallet card, with its outline to cut along.
+func getWalletPDF(p *core.PaperCrypt, no2D bool, opts TextOptions) ([]byte, error) {
+	if no2D {
+		return nil, errors.New("the wallet card holds little more than its QR code, it can not be printed without it")
+	}
+
+	codes, _, err := code2DImages(p, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) != 1 {
+		return nil, fmt.Errorf("the data does not fit into a single QR code of version %d, the largest that can be printed on a wallet card", WalletQRMaxVersion)
+	}
+
+	pdf := getPdf(opts.Page)
+	if err := attachDocument(p, pdf, opts); err != nil {
+		return nil, err
+	}
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+
+	pageWidth, _ := opts.Page.Dimensions()
+	x, y := (pageWidth-WalletCardWidth)/2, 20.0
+
+	pdf.SetDrawColor(160, 160, 160)
+	pdf.SetLineWidth(0.2)
+	pdf.RoundedRect(x, y, WalletCardWidth, WalletCardHeight, walletCardCornerRadius, "1234", "D")
+
+	pdf.RegisterImageReader("wallet.png", "PNG", codes[0])
+	codeMargin := (WalletCardHeight - walletCodeSize) / 2
+	pdf.ImageOptions("wallet.png", x+codeMargin, y+codeMargin, walletCodeSize, walletCodeSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	// the text column right of the code
+	textX := x + walletCodeSize + 2*codeMargin
+	textWidth := x + WalletCardWidth - codeMargin - textX
+	pdf.SetLeftMargin(textX)
+	pdf.SetRightMargin(pageWidth - textX - textWidth)
+	pdf.SetXY(textX, y+codeMargin)
+
+	pdf.SetFont(PdfTextFont, "B", 10)
+	pdf.CellFormat(textWidth, 5, "PaperCrypt", "", 2, "L", false, 0, "")
+	pdf.Ln(1)
+
+	field := func(label string) {
+		pdf.SetFont(PdfTextFont, "", 6)
+		pdf.CellFormat(textWidth, 3, opts.Language.T(label), "", 2, "L", false, 0, "")
+	}
+
+	field(PDFHeaderSheetID)
+	pdf.SetFont(PdfMonoFont, "B", 12)
+	pdf.CellFormat(textWidth, 5, p.SerialNumber, "", 2, "L", false, 0, "")
+	pdf.Ln(1)
+
+	field("Date")
+	pdf.SetFont(PdfMonoFont, "", 7)
+	pdf.CellFormat(textWidth, 3.5, p.CreatedAt.Format(core.TimeStampFormatDate), "", 2, "L", false, 0, "")
+	pdf.Ln(1)
+
+	if p.Purpose != "" {
+		field("Purpose")
+		pdf.SetFont(PdfTextFont, "", 7)
+		for _, line := range wrapWords(pdf, p.Purpose, textWidth, walletPurposeLines) {
+			pdf.CellFormat(textWidth, 3, line, "", 2, "L", false, 0, "")
+		}
+	}
+
+	pdf.SetFont(PdfTextFont, "", 5)
+	pdf.SetXY(textX, y+WalletCardHeight-codeMargin-3)
+	pdf.CellFormat(textWidth, 3, opts.Language.T(WalletCardHint), "", 0, "L", false, 0, "")
+
+	// instructions below the card
+	pdf.SetLeftMargin(x)
+	pdf.SetRightMargin(pageWidth - x - WalletCardWidth)
+	pdf.SetXY(x, y+WalletCardHeight+4)
+	pdf.SetFont(PdfTextFont, "", 8)
+	pdf.SetTextColor(100, 100, 100)
+	pdf.MultiCell(WalletCardWidth, 4, opts.Language.T(WalletCardNote), "", "L", false)
+
+	doc, err := outputPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+
+	return finishPDF(doc, opts)
+}
+
+// wrapWords splits text into lines of words fitting the width in the current font,
+// the last of at most maxLines lines ends in an ellipsis if the text is longer.
+func wrapWords(pdf *gofpdf.Fpdf, text string, width float64, maxLines int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && pdf.GetStringWidth(line+" "+word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		lines[maxLines-1] += "..."
+	}
+
+	return lines
+}
@@ -28,7 +28,9 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/termenv"
 	"github.com/tmuniversal/papercrypt/v2/cmd"
+	"github.com/tmuniversal/papercrypt/v2/font"
 	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
 )
 
 // LicenseText is the license of the application as a string
@@ -46,23 +48,10 @@ var ThirdPartyLicenses string
 //go:embed "eff.org_files_2016_07_18_eff_large_wordlist.txt"
 var WordList string
 
-//go:embed "font/Noto_Sans/NotoSans-Regular.ttf"
-var pdfFontTextRegular string
-
-//go:embed "font/Noto_Sans/NotoSans-Bold.ttf"
-var pdfFontTextBold string
-
-//go:embed "font/Noto_Sans/NotoSans-Italic.ttf"
-var pdfFontTextItalic string
-
-//go:embed "font/Inconsolata/static/Inconsolata-Medium.ttf"
-var pdfFontMonoRegular string
-
-//go:embed "font/Inconsolata/static/Inconsolata-ExtraBold.ttf"
-var pdfFontMonoBold string
-
-//go:embed "font/Inconsolata/Inconsolata-VariableFont_wdth,wght.ttf"
-var pdfFontMonoItalic string
+// BIP39WordList is the BIP39 english word list as a string
+//
+//go:embed "bip-0039_english.txt"
+var BIP39WordList string
 
 var (
 	version   = ""
@@ -83,13 +72,14 @@ func main() {
 	cmd.LicenseText = &LicenseText
 	cmd.ThirdPartyText = &ThirdPartyLicenses
 	cmd.WordListFile = &WordList
-	internal.VersionInfo = buildVersion(version, commit, date, builtBy, treeState)
-	internal.PdfTextFontRegularBytes = []byte(pdfFontTextRegular)
-	internal.PdfTextFontItalicBytes = []byte(pdfFontTextItalic)
-	internal.PdfTextFontBoldBytes = []byte(pdfFontTextBold)
-	internal.PdfMonoFontRegularBytes = []byte(pdfFontMonoRegular)
-	internal.PdfMonoFontBoldBytes = []byte(pdfFontMonoBold)
-	internal.PdfMonoFontItalicBytes = []byte(pdfFontMonoItalic)
+	cmd.BIP39WordListFile = &BIP39WordList
+	core.VersionInfo = buildVersion(version, commit, date, builtBy, treeState)
+	internal.PdfTextFontRegularBytes = font.TextRegular
+	internal.PdfTextFontItalicBytes = font.TextItalic
+	internal.PdfTextFontBoldBytes = font.TextBold
+	internal.PdfMonoFontRegularBytes = font.MonoRegular
+	internal.PdfMonoFontBoldBytes = font.MonoBold
+	internal.PdfMonoFontItalicBytes = font.MonoItalic
 
 	cmd.Execute()
 }
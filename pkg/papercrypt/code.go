@@ -0,0 +1,74 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package papercrypt
+
+import (
+	"errors"
+	"image"
+
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// codeModulePixels is the size of a module of the images returned by EncodeQR, in pixels.
+const codeModulePixels = 8
+
+// EncodeQR returns images of the 2D code of the document, of the type set in opts (an Aztec code by default),
+// surrounded by their quiet zone. Documents too large for a single code are split over several codes,
+// DecodeQR reads them back.
+func (d *Document) EncodeQR(opts Options) ([]image.Image, error) {
+	textOpts, err := opts.textOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := d.container().QRPayload(textOpts.QRPayload)
+	if err != nil {
+		return nil, errors.Join(errors.New("error serializing the 2D code payload"), err)
+	}
+	codes, err := core.Encode2DParts(payload, textOpts.Code2D)
+	if err != nil {
+		return nil, errors.Join(errors.New("error generating 2D code"), err)
+	}
+
+	images := make([]image.Image, len(codes))
+	for i, code := range codes {
+		modules := code.Bounds().Dx() + 2*internal.Code2DQuietZone
+		images[i], err = internal.Code2DImage(code, codeModulePixels*modules)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return images, nil
+}
+
+// DecodeQR reads a document from images of its 2D code, such as scans, or photos:
+// a single image holding the complete code, or the images of all parts of a split code, in any order.
+// Images in which no code is found are preprocessed (contrast stretched, thresholded, and rescaled), and read again.
+func DecodeQR(images ...image.Image) (*Document, error) {
+	pc, err := core.DecodeCodeImages(images...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDocumentFromContainer(pc), nil
+}
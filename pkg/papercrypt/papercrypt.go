@@ -0,0 +1,220 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package papercrypt is the Go API of PaperCrypt, to generate, and read, paper backups from other programs,
+// without running the papercrypt command.
+//
+// A Document is created from the data to back up by Encrypt, printed by RenderPDF, or written as text by Serialize,
+// and read back by Parse, from its text, or by DecodeQR, from images of its 2D codes, before Decrypt restores the data.
+//
+// The API follows semantic versioning: within major version 2 of the module, exported identifiers of this package
+// are neither removed, nor changed incompatibly. The packages below internal are not part of the API.
+package papercrypt
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// FormatVersion is written as the PaperCrypt version of documents whose Version is not set,
+// that of the document format written by this package.
+const FormatVersion = "2.0.0"
+
+// ErrDecryption is returned by Decrypt for data that can not be decrypted, mostly with an incorrect passphrase.
+var ErrDecryption = core.ErrDecryption
+
+// Document is a PaperCrypt document: the data to back up, compressed, and encrypted, as printed on paper,
+// along with its metadata.
+type Document struct {
+	// Version is the version of PaperCrypt that generated the document, FormatVersion if empty.
+	Version string
+
+	// SerialNumber identifies the document, a random one is set by Encrypt.
+	SerialNumber string
+
+	// Purpose, and Comment, describe the document, printed in its header.
+	Purpose string
+	Comment string
+
+	// CreatedAt is the date of the document.
+	CreatedAt time.Time
+
+	// ExpiresAt, and ReviewBy, are the dates after which the content is no longer valid,
+	// and by which the document should be printed again, zero if not set.
+	ExpiresAt time.Time
+	ReviewBy  time.Time
+
+	// Encrypted is true if the data is an OpenPGP message, encrypted using a passphrase,
+	// rather than only compressed.
+	Encrypted bool
+
+	// Data is the data of the document, compressed (gzip), and encrypted, as printed.
+	Data []byte
+
+	// PlaintextSHA256 is the SHA-256 checksum of the data before encryption, verified by Decrypt, if set.
+	PlaintextSHA256 []byte
+
+	// PrivateMetadata is true for documents holding their purpose, and comment, encrypted along with the data
+	// (see 'papercrypt generate --private-metadata'), Decrypt sets them.
+	PrivateMetadata bool
+
+	// ExternalMessage is true for documents holding an OpenPGP message encrypted by other software
+	// (see 'papercrypt generate --from-pgp'), Decrypt returns its plaintext as it is, without decompressing it.
+	ExternalMessage bool
+
+	// headerMAC authenticates the metadata of documents of format version 3, see Authenticate.
+	headerMAC *core.HeaderMAC
+}
+
+// Encrypt returns a new document, holding plaintext, compressed, and encrypted using the passphrase,
+// with a random serial number, dated now.
+func Encrypt(plaintext []byte, passphrase []byte) (*Document, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("the passphrase must not be empty, use Compress to store the data unencrypted")
+	}
+
+	return newDocument(plaintext, passphrase, false)
+}
+
+// Compress returns a new document, holding plaintext compressed, but not encrypted, like Encrypt does otherwise.
+// Use it for data encrypted already.
+func Compress(plaintext []byte) (*Document, error) {
+	return newDocument(plaintext, nil, true)
+}
+
+func newDocument(plaintext []byte, passphrase []byte, raw bool) (*Document, error) {
+	data, err := core.CompressAndEncrypt(passphrase, plaintext, raw)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := core.GenerateSerialFromCharset(core.DefaultSerialLength, core.DefaultSerialCharset)
+	if err != nil {
+		return nil, errors.Join(errors.New("error generating serial number"), err)
+	}
+
+	return &Document{
+		Version:      FormatVersion,
+		SerialNumber: serialNumber,
+		CreatedAt:    time.Now(),
+		Encrypted:    !raw,
+		Data:         data,
+	}, nil
+}
+
+// SetPlaintextHash records the SHA-256 checksum of the plaintext, which Decrypt verifies.
+// Anyone holding the document can use it to confirm guesses of its contents.
+func (d *Document) SetPlaintextHash(plaintext []byte) {
+	sum := sha256.Sum256(plaintext)
+	d.PlaintextSHA256 = sum[:]
+}
+
+// Authenticate makes the document one of format version 3 (see 'papercrypt generate --format-version 3'),
+// its metadata authenticated by a MAC keyed by the passphrase, which is checked by Decrypt.
+// It is to be called once the metadata is set, and the passphrase must be the one the data is encrypted with.
+// Versions of PaperCrypt before format version 3 can not read the document.
+func (d *Document) Authenticate(passphrase []byte) error {
+	if !d.Encrypted {
+		return errors.New("the document is not encrypted, there is no passphrase to authenticate it by")
+	}
+
+	d.headerMAC = nil
+	pc := d.container()
+	if err := pc.Authenticate(passphrase); err != nil {
+		return err
+	}
+	d.headerMAC = pc.HeaderMAC
+
+	return nil
+}
+
+// Authenticated returns whether the metadata of the document is authenticated by a MAC, see Authenticate.
+func (d *Document) Authenticated() bool {
+	return d.headerMAC != nil
+}
+
+// Decrypt returns the data of the document, decrypted using the passphrase, and decompressed.
+// The passphrase is ignored for documents that are not encrypted.
+// For documents whose metadata is authenticated, it is checked as well, failing if it was changed.
+// With PrivateMetadata set, Purpose, and Comment, are set from the decrypted data.
+func (d *Document) Decrypt(passphrase []byte) ([]byte, error) {
+	pc := d.container()
+	data, err := pc.Decode(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := pc.VerifyPlaintext(data); err != nil {
+		return nil, err
+	}
+	if d.PrivateMetadata {
+		d.Purpose, d.Comment = pc.Purpose, pc.Comment
+	}
+
+	return data, nil
+}
+
+// container returns the document as the container of the internal packages.
+func (d *Document) container() *core.PaperCrypt {
+	version := d.Version
+	if version == "" {
+		version = FormatVersion
+	}
+	format := core.PaperCryptDataFormatRaw
+	if d.Encrypted {
+		format = core.PaperCryptDataFormatPGP
+	}
+
+	pc := core.NewPaperCrypt(version, d.Data, d.SerialNumber, d.Purpose, d.Comment, d.CreatedAt, format)
+	pc.ExpiresAt = d.ExpiresAt
+	pc.ReviewBy = d.ReviewBy
+	pc.PlaintextSHA256 = d.PlaintextSHA256
+	pc.PrivateMetadata = d.PrivateMetadata
+	pc.ExternalMessage = d.ExternalMessage
+	if d.PrivateMetadata {
+		// only the encrypted data holds them
+		pc.Purpose, pc.Comment = "", ""
+	}
+	if d.headerMAC != nil {
+		pc.FormatVersion, pc.HeaderMAC = core.PaperCryptContainerVersionMajor3, d.headerMAC
+	}
+
+	return pc
+}
+
+// newDocumentFromContainer returns the document of a container of the internal packages.
+func newDocumentFromContainer(pc *core.PaperCrypt) *Document {
+	return &Document{
+		Version:         pc.Version,
+		SerialNumber:    pc.SerialNumber,
+		Purpose:         pc.Purpose,
+		Comment:         pc.Comment,
+		CreatedAt:       pc.CreatedAt,
+		ExpiresAt:       pc.ExpiresAt,
+		ReviewBy:        pc.ReviewBy,
+		Encrypted:       pc.DataFormat == core.PaperCryptDataFormatPGP,
+		Data:            pc.Data,
+		PlaintextSHA256: pc.PlaintextSHA256,
+		PrivateMetadata: pc.PrivateMetadata,
+		ExternalMessage: pc.ExternalMessage,
+		headerMAC:       pc.HeaderMAC,
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package papercrypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var (
+	testPlaintext  = []byte("correct horse battery staple")
+	testPassphrase = []byte("passphrase")
+)
+
+func TestSerializeParse(t *testing.T) {
+	doc, err := Encrypt(testPlaintext, testPassphrase)
+	if err != nil {
+		t.Fatalf("Encrypt failed with error %s", err)
+	}
+	doc.Purpose = "Test"
+	doc.SetPlaintextHash(testPlaintext)
+
+	for _, encoding := range []Encoding{EncodingBase16, EncodingBase32, EncodingBase64, EncodingArmor, EncodingWords} {
+		text, err := doc.Serialize(Options{Encoding: encoding, NoCode: true})
+		if err != nil {
+			t.Fatalf("Serialize (%s) failed with error %s", encoding, err)
+		}
+
+		parsed, err := Parse(text)
+		if err != nil {
+			t.Fatalf("Parse (%s) failed with error %s", encoding, err)
+		}
+		if parsed.SerialNumber != doc.SerialNumber || parsed.Purpose != doc.Purpose || !parsed.Encrypted {
+			t.Errorf("Parse (%s) was incorrect, got: %+v, want: %+v.", encoding, parsed, doc)
+		}
+
+		data, err := parsed.Decrypt(testPassphrase)
+		if err != nil {
+			t.Fatalf("Decrypt (%s) failed with error %s", encoding, err)
+		}
+		if !bytes.Equal(data, testPlaintext) {
+			t.Errorf("Decrypt (%s) was incorrect, got: %s, want: %s.", encoding, data, testPlaintext)
+		}
+	}
+}
+
+func TestDecryptWrongPassphrase(t *testing.T) {
+	doc, err := Encrypt(testPlaintext, testPassphrase)
+	if err != nil {
+		t.Fatalf("Encrypt failed with error %s", err)
+	}
+
+	if _, err := doc.Decrypt([]byte("wrong")); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Decrypt was incorrect, got: %v, want: %v.", err, ErrDecryption)
+	}
+	if _, err := Encrypt(testPlaintext, nil); err == nil {
+		t.Errorf("Encrypt should fail without a passphrase")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	doc, err := Compress(testPlaintext)
+	if err != nil {
+		t.Fatalf("Compress failed with error %s", err)
+	}
+	if doc.Encrypted {
+		t.Errorf("Compress was incorrect, got: encrypted, want: not encrypted.")
+	}
+
+	data, err := doc.Decrypt(nil)
+	if err != nil {
+		t.Fatalf("Decrypt failed with error %s", err)
+	}
+	if !bytes.Equal(data, testPlaintext) {
+		t.Errorf("Decrypt was incorrect, got: %s, want: %s.", data, testPlaintext)
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	doc, err := Encrypt(testPlaintext, testPassphrase)
+	if err != nil {
+		t.Fatalf("Encrypt failed with error %s", err)
+	}
+
+	pdf, err := doc.RenderPDF(Options{Paper: PaperLetter})
+	if err != nil {
+		t.Fatalf("RenderPDF failed with error %s", err)
+	}
+	if !bytes.Contains(pdf, []byte("%PDF-")) || !bytes.HasSuffix(bytes.TrimSpace(pdf), []byte("%%EOF")) {
+		t.Errorf("RenderPDF was incorrect, got: %d bytes, want: a PDF document.", len(pdf))
+	}
+
+	if _, err := doc.RenderPDF(Options{Paper: "tabloid"}); err == nil {
+		t.Errorf("RenderPDF should fail with an unknown paper size")
+	}
+}
+
+func TestEncodeDecodeQR(t *testing.T) {
+	doc, err := Encrypt(testPlaintext, testPassphrase)
+	if err != nil {
+		t.Fatalf("Encrypt failed with error %s", err)
+	}
+
+	for _, codeType := range []CodeType{CodeAztec, CodeQR} {
+		images, err := doc.EncodeQR(Options{CodeType: codeType})
+		if err != nil {
+			t.Fatalf("EncodeQR (%s) failed with error %s", codeType, err)
+		}
+
+		decoded, err := DecodeQR(images...)
+		if err != nil {
+			t.Fatalf("DecodeQR (%s) failed with error %s", codeType, err)
+		}
+		if decoded.SerialNumber != doc.SerialNumber || !bytes.Equal(decoded.Data, doc.Data) {
+			t.Errorf("DecodeQR (%s) was incorrect, got: %+v, want: %+v.", codeType, decoded, doc)
+		}
+	}
+
+	if _, err := DecodeQR(); err == nil {
+		t.Errorf("DecodeQR should fail without images")
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package papercrypt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tmuniversal/papercrypt/v2/font"
+	"github.com/tmuniversal/papercrypt/v2/internal"
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+// Encoding is the encoding of the data printed on a document.
+type Encoding string
+
+const (
+	// EncodingBase16 prints the data as hexadecimal digits, the default.
+	EncodingBase16 Encoding = "base16"
+	// EncodingBase32 prints the data in Crockford's base 32 alphabet.
+	EncodingBase32 Encoding = "base32"
+	// EncodingBase64 prints the data in base 64.
+	EncodingBase64 Encoding = "base64"
+	// EncodingArmor prints the data as an OpenPGP-style ASCII armor block.
+	EncodingArmor Encoding = "armor"
+	// EncodingWords prints the data as words of the PGP word list, for reading aloud.
+	EncodingWords Encoding = "words"
+)
+
+// PaperSize is the size of the paper a document is laid out for.
+type PaperSize string
+
+const (
+	PaperA4     PaperSize = "a4"
+	PaperLetter PaperSize = "letter"
+	PaperA5     PaperSize = "a5"
+	PaperLegal  PaperSize = "legal"
+)
+
+// CodeType is the type of the 2D code of a document.
+type CodeType string
+
+const (
+	// CodeAztec is an Aztec code, the default.
+	CodeAztec CodeType = "aztec"
+	// CodeQR is a QR code, holding the document in byte mode.
+	CodeQR CodeType = "qr"
+)
+
+// Options are the options documents are written with, the zero value writes them as 'papercrypt generate' does by default.
+type Options struct {
+	// Encoding is the encoding of the printed data, EncodingBase16 if empty.
+	Encoding Encoding
+
+	// Paper is the size of the paper, PaperA4 if empty.
+	Paper PaperSize
+
+	// Landscape lays the document out in landscape orientation.
+	Landscape bool
+
+	// CodeType is the type of the 2D code, CodeAztec if empty.
+	CodeType CodeType
+
+	// NoCode leaves out the 2D code.
+	NoCode bool
+
+	// Language is the language of the text printed on the document, such as "de", English if empty.
+	Language string
+}
+
+// textOptions returns the options of the internal packages, validating o.
+func (o Options) textOptions() (internal.TextOptions, error) {
+	encoding := core.PaperCryptDataEncodingBase16
+	if o.Encoding != "" {
+		encoding = core.PaperCryptDataEncodingFromString(string(o.Encoding))
+		if encoding == core.PaperCryptDataEncodingUnknown {
+			return internal.TextOptions{}, fmt.Errorf("unknown data encoding '%s'", o.Encoding)
+		}
+	}
+	paper := core.PaperSizeFromString(string(o.Paper))
+	if paper == core.PaperSizeUnknown {
+		return internal.TextOptions{}, fmt.Errorf("unknown paper size '%s'", o.Paper)
+	}
+	page := core.Page{Paper: paper, Landscape: o.Landscape}
+
+	codeType := core.Code2DTypeAztec
+	payload := core.QRPayloadFormatJSON
+	switch o.CodeType {
+	case "", CodeAztec:
+	case CodeQR:
+		// as 'papercrypt generate' does, QR codes hold the raw bytes of the data
+		codeType, payload = core.Code2DTypeQR, core.QRPayloadFormatCBOR
+	default:
+		return internal.TextOptions{}, fmt.Errorf("unknown 2D code type '%s'", o.CodeType)
+	}
+
+	language, err := internal.LoadLanguage(o.Language)
+	if err != nil {
+		return internal.TextOptions{}, err
+	}
+
+	layout := core.DefaultDataLayout
+	if encoding != core.PaperCryptDataEncodingArmor && encoding != core.PaperCryptDataEncodingWords {
+		layout.Columns = max(core.BytesPerLine/layout.GroupSize, 1)
+		layout = page.FitDataLayout(layout)
+	}
+
+	return internal.TextOptions{
+		Encoding:  encoding,
+		Layout:    layout,
+		QRPayload: payload,
+		Code2D: core.Code2DOptions{
+			Type:      codeType,
+			DPI:       core.Code2DDefaultDPI,
+			PrintArea: page.Code2DPrintSize(),
+		},
+		Page:     page,
+		Language: language,
+	}, nil
+}
+
+// Serialize returns the text of the document, its header, and its data, as printed, which Parse reads back.
+func (d *Document) Serialize(opts Options) ([]byte, error) {
+	textOpts, err := opts.textOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.container().GetText(textOpts.EncodingOptions())
+}
+
+// Parse reads a document from its text, as written by Serialize, or typed from a printed document
+// (tolerating whitespace, blank lines, reordered header fields, byte order marks, and CRLF line endings),
+// checking the checksums of its header, lines, and data.
+func Parse(text []byte) (*Document, error) {
+	pc, err := core.DeserializeText(core.NormalizeDocumentText(text), false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDocumentFromContainer(pc), nil
+}
+
+var loadFontsOnce sync.Once
+
+// loadFonts loads the fonts PDF documents are laid out in, unless they are loaded already.
+func loadFonts() {
+	loadFontsOnce.Do(func() {
+		if internal.PdfTextFontRegularBytes != nil {
+			return
+		}
+
+		internal.PdfTextFontRegularBytes = font.TextRegular
+		internal.PdfTextFontBoldBytes = font.TextBold
+		internal.PdfTextFontItalicBytes = font.TextItalic
+		internal.PdfMonoFontRegularBytes = font.MonoRegular
+		internal.PdfMonoFontBoldBytes = font.MonoBold
+		internal.PdfMonoFontItalicBytes = font.MonoItalic
+	})
+}
+
+// RenderPDF returns the document laid out as a PDF document, for printing.
+func (d *Document) RenderPDF(opts Options) ([]byte, error) {
+	textOpts, err := opts.textOptions()
+	if err != nil {
+		return nil, err
+	}
+	loadFonts()
+
+	pdf, err := internal.RendererPDF.Render(d.container(), opts.NoCode, textOpts)
+	if err != nil {
+		return nil, errors.Join(errors.New("error rendering the document"), err)
+	}
+
+	return pdf, nil
+}
@@ -0,0 +1,121 @@
+//go:build js && wasm
+
+/*
+ * This file is part of PaperCrypt.
+ *
+ * PaperCrypt lets you prepare encrypted messages for printing on paper.
+ * Copyright (C) 2024 TMUniversal <me@tmuniversal.eu>.
+ *
+ * PaperCrypt is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Command wasm is the offline restore tool: PaperCrypt compiled to WebAssembly, to restore documents in a browser,
+// on any machine, without installing anything, or any network access. See index.html, and 'task build:wasm'.
+// It is built from internal/core only, the parsing, scanning, and decryption of documents,
+// leaving out the parts of PaperCrypt that run other programs, or access printers, cameras, and keychains.
+//
+// It sets the global papercrypt object, whose functions return {data, serialNumber, purpose, comment}, or {error}:
+//
+//	papercrypt.restoreText(text, passphrase)    // the text of a document, as typed from the printed page, or written by 'papercrypt scan'
+//	papercrypt.restoreImages(images, passphrase) // an array of PNG, or JPEG, files of the 2D codes of a document, as Uint8Array
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // photos of the codes
+	_ "image/png"
+	"syscall/js"
+
+	"github.com/tmuniversal/papercrypt/v2/internal/core"
+)
+
+func main() {
+	js.Global().Set("papercrypt", js.ValueOf(map[string]any{
+		"restoreText":   js.FuncOf(restoreText),
+		"restoreImages": js.FuncOf(restoreImages),
+	}))
+
+	// the functions are called from JavaScript, for as long as the page is open
+	select {}
+}
+
+func restoreText(_ js.Value, args []js.Value) any {
+	if len(args) != 2 {
+		return errorResult(errors.New("restoreText takes the text of the document, and the passphrase"))
+	}
+
+	pc, err := core.DeserializeText(core.NormalizeDocumentText([]byte(args[0].String())), false, false)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	return restore(pc, args[1].String())
+}
+
+func restoreImages(_ js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeObject {
+		return errorResult(errors.New("restoreImages takes an array of images, and the passphrase"))
+	}
+
+	images := make([]image.Image, args[0].Length())
+	for i := range images {
+		file := make([]byte, args[0].Index(i).Length())
+		js.CopyBytesToGo(file, args[0].Index(i))
+
+		img, _, err := image.Decode(bytes.NewReader(file))
+		if err != nil {
+			return errorResult(errors.Join(fmt.Errorf("error reading image %d", i+1), err))
+		}
+		images[i] = img
+	}
+
+	pc, err := core.DecodeCodeImages(images...)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	return restore(pc, args[1].String())
+}
+
+// restore decrypts the document, and returns its data, and metadata, as a JavaScript object.
+// The purpose, and comment, of documents with private metadata are those decrypted along with the data.
+func restore(pc *core.PaperCrypt, passphrase string) any {
+	data, err := pc.Decode([]byte(passphrase))
+	if err != nil {
+		if errors.Is(err, core.ErrDecryption) {
+			err = errors.New("could not decrypt the document, check the passphrase")
+		}
+		return errorResult(err)
+	}
+	if err := pc.VerifyPlaintext(data); err != nil {
+		return errorResult(err)
+	}
+
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+
+	return js.ValueOf(map[string]any{
+		"data":         array,
+		"serialNumber": pc.SerialNumber,
+		"purpose":      pc.Purpose,
+		"comment":      pc.Comment,
+	})
+}
+
+func errorResult(err error) any {
+	return js.ValueOf(map[string]any{"error": err.Error()})
+}